@@ -1,222 +1,919 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
-	"math/rand"
+	"log/slog"
+	"net"
 	"net/http"
-	"net/http/httptest"
-	"reflect"
+	"net/url"
+	"os"
+	"os/signal"
 	"sync"
-	"testing"
+	"syscall"
 	"time"
-)
 
-// NodeData represents the data structure for a single node in the distributed system.
-type NodeData struct {
-	ID    int       `json:"id"`
-	Name  string    `json:"name"`
-	Value int       `json:"value"`
-	Time  time.Time `json:"time"`
-}
+	"google.golang.org/grpc"
 
-// Simulate a set of nodes in a distributed system.
-var (
-	nodeCount = 5            // Number of nodes in the simulated system.
-	nodes     []NodeData     // Slice to hold node data.
-	mutex     sync.RWMutex   // RWMutex for thread-safe data access.
-	wg        sync.WaitGroup // WaitGroup for goroutine synchronization.
+	"DistributedSystemSimulator/simulator"
 )
 
-// InitNodes initializes a set of nodes with random data.
-func InitNodes() {
-	mutex.Lock()
-	defer mutex.Unlock()
+// defaultNodeCount is the number of nodes simulated when neither the -nodes
+// flag nor the SIM_NODE_COUNT environment variable is set.
+const defaultNodeCount = 5
 
-	nodes = make([]NodeData, nodeCount)
-	for j := 0; j < nodeCount; j++ {
-		nodes[j] = NodeData{
-			ID:    j,
-			Name:  fmt.Sprintf("Node-%d", j),
-			Value: rand.Intn(100),
-			Time:  time.Now(),
-		}
-	}
-}
+const (
+	// gossipInterval is how often nodes exchange values in gossip mode. It is
+	// shorter than the default update interval so values can converge
+	// between updates.
+	gossipInterval = time.Second
+
+	// heartbeatInterval is how often every up node emits a heartbeat to the
+	// failure detector. The -suspect-timeout flag must exceed it.
+	heartbeatInterval = time.Second
+
+	// replicationInterval is how often replicas of the key-value store that
+	// missed a write are brought up to date.
+	replicationInterval = time.Second
+
+	// telemetryInterval is how often metrics are exported to the
+	// OpenTelemetry collector, when -otel-endpoint names one.
+	telemetryInterval = 10 * time.Second
+
+	// transferInterval is how often joining and leaving nodes transfer a
+	// batch of keys.
+	transferInterval = time.Second
+
+	// antiEntropyInterval is how often every node reconciles its replicated
+	// keys with a random peer.
+	antiEntropyInterval = 5 * time.Second
+
+	// kvSweepInterval is how often expired key-value entries are replaced
+	// by tombstones, and tombstones past their grace period dropped.
+	kvSweepInterval = time.Second
+
+	// busInterval is how often messages published to the message bus are
+	// sent to their subscribers.
+	busInterval = time.Second
+
+	// queueInterval is how often the work queue's producers and consumers
+	// are advanced.
+	queueInterval = time.Second
 
-// GetNodeData handles HTTP requests to retrieve node data.
-func GetNodeData(w http.ResponseWriter, r *http.Request) {
-	mutex.RLock()
-	defer mutex.RUnlock()
+	// loadGenInterval is how often the load generator sends the synthetic
+	// requests due.
+	loadGenInterval = time.Second
 
-	data, err := json.Marshal(nodes)
+	// shutdownTimeout bounds how long in-flight requests may take to complete
+	// once a shutdown has been requested.
+	shutdownTimeout = 10 * time.Second
+)
+
+// options holds the command-line configuration of the simulator.
+type options struct {
+	nodes       int           // Number of nodes in the simulated system.
+	seed        int64         // Seed for the simulator's random source.
+	failProb    float64       // Per-tick probability that the chaos loop fails a node.
+	recoverProb float64       // Per-tick probability that the chaos loop recovers a node.
+	mode        string        // Simulation mode.
+	updaters    int           // Number of concurrent updater workers.
+	fanout      int           // Number of peers each node gossips with per round.
+	n, r, w     int           // Replication factor and read/write quorums of the key-value store.
+	hintTTL     time.Duration // How long a write for a down replica is held as a hint.
+	graceTTL    time.Duration // How long the tombstone of a deleted or expired key-value entry is kept.
+	aeBuckets   int           // Digest buckets per node for anti-entropy.
+	vnodes      int           // Virtual nodes per node on the consistent-hash ring.
+	witnesses   int           // Number of nodes that are witnesses, holding no data.
+	splitBrain  bool          // Whether every side of a partition elects a leader.
+	verifySums  bool          // Whether replicas refuse copies not matching their checksums.
+	restartFor  time.Duration // How long a restarted node stays down.
+	reload      string        // Where a restarted node reloads its state from.
+	batch       int           // Keys a joining or leaving node transfers per round.
+	moves       int           // Rebalance moves that transfer keys at once.
+	hookFails   int           // Failed deliveries in a row before a webhook is dropped.
+
+	updateInterval time.Duration                    // Interval of the updater, chaos, and replay loops.
+	suspectTimeout time.Duration                    // Heartbeat silence after which a node is suspected.
+	latency        time.Duration                    // Simulated network latency of every request.
+	jitter         time.Duration                    // Maximum random delay added to the latency.
+	regions        []simulator.Region               // Regions to place the nodes in, or nil for none.
+	interRegion    time.Duration                    // Latency added to requests to a node in another region.
+	messageLatency simulator.LatencyModel           // Latency model of messages between nodes.
+	linkBandwidth  int                              // Bytes each link between nodes may carry per tick, or 0 for no limit.
+	bandwidthMode  string                           // What happens to messages over the bandwidth limit: queue or drop.
+	retry          simulator.RetryPolicy            // Retry policy of operations between nodes.
+	retryOverrides map[string]simulator.RetryPolicy // Retry policies replacing retry by operation.
+	eventLogSize   int                              // Number of events the event log retains.
+	historySize    int                              // Number of value samples retained per node.
+	inboxSize      int                              // Number of messages retained in each node's inbox.
+	maxNodeKeys    int                              // Number of keys each node's data store may hold.
+	limits         simulator.ResourceLimits         // Resource usages past which a node is overloaded.
+	autoscaler     simulator.AutoscalerSettings     // When the autoscaler adds and removes nodes.
+	scenario       *simulator.Scenario              // Scenario to play, or nil for none.
+	replay         *simulator.Trace                 // Trace to replay in place of random updates, or nil for none.
+	logLevel       slog.Level                       // Minimum level of log records.
+	logFormat      string                           // Log output format: text or json.
+	dataDir        string                           // Directory for snapshots, or "" to disable them.
+	resultsDir     string                           // Directory for CSV results, or "" to disable them.
+	storage        string                           // Storage backend of the nodes and event log.
+	storagePath    string                           // File of the file storage backend.
+	auditFile      string                           // File audit entries are appended to, or "" for none.
+	grpcAddr       string                           // Address of the gRPC server, or "" to disable it.
+	gzip           bool                             // Whether to compress large JSON responses.
+	gzipMinSize    int                              // Smallest response body compressed, in bytes.
+	corsOrigins    []string                         // Origins allowed to call the API from a browser.
+	apiKey         string                           // Key required by mutating requests, or "" for none.
+	protectReads   bool                             // Whether read requests also require the API key.
+	rateLimit      float64                          // Requests per second allowed per client IP, or 0 for no limit.
+	rateBurst      int                              // Requests a client may make at once.
+	trustProxy     bool                             // Whether to identify clients by X-Forwarded-For.
+	tlsCert        string                           // TLS certificate file, or "" to serve plain HTTP.
+	tlsKey         string                           // TLS private key file, or "" to serve plain HTTP.
+	redirectAddr   string                           // Address of the HTTP-to-HTTPS redirect listener, or "" for none.
+	debug          bool                             // Whether to serve the /debug/ endpoints.
+	otelEndpoint   string                           // OpenTelemetry collector to export to, or "" for none.
+
+	settings map[string]simulator.Setting // Effective value of every option and where it came from, for GET /config.
+}
+
+// parseOptions parses the command-line flags in args. Every option can also
+// be set by the JSON or YAML file the -config flag names, keyed by the flag's
+// name, and by its environment variable (see envName): the environment takes
+// precedence over the flags, the flags over the file, and the file over the
+// default. An invalid value is reported along with where it came from. The
+// node count defaults to defaultNodeCount, and must be at least 1. The seed
+// defaults to the current time. The chaos probabilities come from -fail-prob
+// and -recover-prob and must be between 0 and 1. The -suspect-timeout must be
+// longer than heartbeatInterval. The -tls-cert and -tls-key flags must be
+// given together, and -redirect-addr requires them. A -scenario file is
+// parsed and validated here, and its node count and seed replace those from
+// the other sources. A -replay trace likewise sets the node count and mode,
+// and a -regions topology the node count.
+func parseOptions(args []string, getenv func(string) string) (options, error) {
+	var opts options
+	fs := flag.NewFlagSet("simulator", flag.ContinueOnError)
+	var configPath string
+	fs.StringVar(&configPath, "config", "", "JSON or YAML file of option values keyed by flag name; flags and environment variables take precedence")
+	fs.IntVar(&opts.nodes, "nodes", defaultNodeCount, "number of nodes in the simulated system (env SIM_NODE_COUNT)")
+	fs.Int64Var(&opts.seed, "seed", time.Now().UnixNano(), "seed for the random source; runs with the same seed produce the same node values (default: current time)")
+	fs.Float64Var(&opts.failProb, "fail-prob", 0, "per-tick probability that the chaos loop marks a random up node down")
+	fs.Float64Var(&opts.recoverProb, "recover-prob", 0, "per-tick probability that the chaos loop marks a random down node up")
+	fs.DurationVar(&opts.updateInterval, "update-interval", simulator.DefaultUpdateInterval, "how often each updater worker modifies a random node; also the chaos and replay tick")
+	fs.IntVar(&opts.updaters, "updaters", 1, "number of updater workers modifying nodes concurrently")
+	fs.IntVar(&opts.fanout, "gossip-fanout", 1, "number of peers each node exchanges values with per gossip round")
+	fs.StringVar(&opts.mode, "mode", simulator.ModeIndependent, "simulation mode: independent, gossip, or raft")
+	fs.IntVar(&opts.n, "n", simulator.DefaultN, "number of replicas per key in the key-value store")
+	fs.IntVar(&opts.r, "r", simulator.DefaultR, "number of replicas a key-value read must reach")
+	fs.IntVar(&opts.w, "w", simulator.DefaultW, "number of replicas a key-value write must reach")
+	fs.IntVar(&opts.aeBuckets, "antientropy-buckets", simulator.DefaultAntiEntropyBuckets, "number of digest buckets anti-entropy splits each node's keys into")
+	fs.DurationVar(&opts.hintTTL, "hint-ttl", simulator.DefaultHintTTL, "how long a key-value write for a down replica is held as a hint before it is dropped")
+	fs.DurationVar(&opts.graceTTL, "tombstone-grace", simulator.DefaultTombstoneGrace, "how long the tombstone of a deleted or expired key-value entry is kept before it is dropped")
+	fs.IntVar(&opts.vnodes, "vnodes", simulator.DefaultVirtualNodes, "number of virtual nodes per node on the consistent-hash ring")
+	fs.BoolVar(&opts.splitBrain, "split-brain", false, "let every side of a partition elect its own leader outside raft mode")
+	fs.BoolVar(&opts.verifySums, "verify-checksums", false, "make replicas refuse key-value copies that don't match their checksums")
+	fs.DurationVar(&opts.restartFor, "restart-duration", simulator.DefaultRestartDuration, "how long a restarted node stays down")
+	fs.StringVar(&opts.reload, "restart-reload", simulator.ReloadSnapshot, "where a restarted node reloads its state from: snapshot, replicas, or none")
+	fs.IntVar(&opts.batch, "transfer-batch", simulator.DefaultTransferBatch, "number of keys a joining or leaving node transfers per second")
+	fs.IntVar(&opts.moves, "max-concurrent-transfers", simulator.DefaultMaxConcurrentTransfers, "number of rebalance moves that transfer keys at once")
+	fs.IntVar(&opts.hookFails, "webhook-max-failures", simulator.DefaultWebhookMaxFailures, "number of deliveries in a row a webhook may fail before it is dropped")
+	fs.IntVar(&opts.witnesses, "witnesses", 0, "number of nodes, counting from the last, that vote and keep the Raft log but hold no data")
+	fs.DurationVar(&opts.suspectTimeout, "suspect-timeout", simulator.DefaultSuspectTimeout, "heartbeat silence after which the failure detector suspects a node")
+	fs.DurationVar(&opts.latency, "latency", 0, "simulated network latency added to every request")
+	fs.DurationVar(&opts.jitter, "jitter", 0, "maximum random delay added on top of -latency")
+	fs.DurationVar(&opts.interRegion, "inter-region-latency", 0, "latency added to requests to a node outside the client's region")
+	fs.IntVar(&opts.linkBandwidth, "link-bandwidth", 0, "bytes each link between nodes may carry per update interval, or 0 for no limit")
+	fs.StringVar(&opts.bandwidthMode, "bandwidth-policy", simulator.BandwidthQueue, "what happens to messages over -link-bandwidth: queue or drop")
+	fs.IntVar(&opts.eventLogSize, "event-log-size", simulator.DefaultEventLogSize, "number of node change events retained in the event log")
+	fs.IntVar(&opts.historySize, "history-size", simulator.DefaultValueHistorySize, "number of value samples retained per node for /nodes/{id}/history")
+	fs.IntVar(&opts.inboxSize, "inbox-size", simulator.DefaultInboxSize, "number of messages retained per node for /nodes/{id}/inbox")
+	fs.IntVar(&opts.maxNodeKeys, "max-node-keys", simulator.DefaultMaxNodeKeys, "number of keys each node's data store may hold")
+	fs.Float64Var(&opts.limits.CPU, "cpu-limit", 0, "simulated CPU usage, in percent of a core, past which a node is overloaded and rejects requests, or 0 for no limit")
+	fs.Int64Var(&opts.limits.Memory, "memory-limit", 0, "simulated memory, in bytes, past which a node is overloaded, or 0 for no limit")
+	fs.Int64Var(&opts.limits.Disk, "disk-limit", 0, "simulated disk usage, in bytes, past which a node is overloaded, or 0 for no limit")
+	fs.BoolVar(&opts.autoscaler.Enabled, "autoscale", false, "add and remove nodes through the join and leave protocols as their average simulated CPU usage rises and falls")
+	fs.Float64Var(&opts.autoscaler.High, "autoscale-high", simulator.DefaultAutoscaleHigh, "average CPU usage, in percent of a core, over which the autoscaler adds a node")
+	fs.Float64Var(&opts.autoscaler.Low, "autoscale-low", simulator.DefaultAutoscaleLow, "average CPU usage, in percent of a core, under which the autoscaler removes a node")
+	fs.IntVar(&opts.autoscaler.Ticks, "autoscale-ticks", simulator.DefaultAutoscaleTicks, "update intervals in a row the CPU usage must stay over -autoscale-high or under -autoscale-low before the autoscaler acts")
+	fs.IntVar(&opts.autoscaler.Min, "autoscale-min", simulator.DefaultAutoscaleMin, "fewest nodes the autoscaler scales down to")
+	fs.IntVar(&opts.autoscaler.Max, "autoscale-max", simulator.DefaultAutoscaleMax, "most nodes the autoscaler scales up to")
+	fs.TextVar(&opts.logLevel, "log-level", slog.LevelInfo, "minimum log level: debug, info, warn, or error")
+	fs.StringVar(&opts.logFormat, "log-format", "text", "log output format: text or json")
+	fs.BoolVar(&opts.gzip, "gzip", true, "gzip-compress JSON responses for clients that accept it")
+	fs.IntVar(&opts.gzipMinSize, "gzip-min-size", simulator.DefaultCompressMinSize, "smallest JSON response body, in bytes, that is compressed")
+	fs.Var((*listValue)(&opts.corsOrigins), "cors-origins", "comma-separated origins browsers may call the API from, or * for any")
+	fs.StringVar(&opts.apiKey, "api-key", "", "key that mutating requests must present as a Bearer token or X-API-Key header (env SIM_API_KEY)")
+	fs.BoolVar(&opts.protectReads, "protect-reads", false, "also require the API key for read requests, except the health probes")
+	fs.Float64Var(&opts.rateLimit, "rate-limit", 0, "average requests per second allowed per client IP, or 0 for no limit")
+	fs.IntVar(&opts.rateBurst, "rate-burst", 0, "requests a client IP may make at once (default: -rate-limit rounded up)")
+	fs.BoolVar(&opts.trustProxy, "trust-proxy", false, "identify clients by the last X-Forwarded-For address; set only behind a proxy that appends it")
+	fs.StringVar(&opts.tlsCert, "tls-cert", "", "certificate file to serve HTTPS with; requires -tls-key")
+	fs.StringVar(&opts.tlsKey, "tls-key", "", "private key file to serve HTTPS with; requires -tls-cert")
+	fs.StringVar(&opts.redirectAddr, "redirect-addr", "", "address of a plain HTTP listener that redirects to HTTPS, or empty for none")
+	fs.StringVar(&opts.grpcAddr, "grpc-addr", ":9090", "address the gRPC API listens on, or empty to disable it")
+	fs.BoolVar(&opts.debug, "debug", false, "serve pprof profiles under /debug/pprof/ and runtime stats at /debug/vars")
+	fs.StringVar(&opts.otelEndpoint, "otel-endpoint", "", "OpenTelemetry collector to export spans and metrics to over OTLP/HTTP, such as http://localhost:4318, or empty for none")
+	var scenarioPath, replayPath, topology, messageLatency, retryOverrides string
+	var retryBase, retryMax, autoscaleCooldown time.Duration
+	fs.DurationVar(&autoscaleCooldown, "autoscale-cooldown", simulator.DefaultAutoscaleCooldown, "how long the autoscaler waits after adding or removing a node before it does so again")
+	fs.StringVar(&messageLatency, "message-latency", "", "latency of messages between nodes, such as intra-zone=1ms,intra-region=5ms,inter-region=80ms,jitter=2ms")
+	fs.IntVar(&opts.retry.MaxAttempts, "retry-attempts", simulator.DefaultRetryAttempts, "attempts made of replication, hint deliveries, and two-phase commit prepare calls, the first included")
+	fs.DurationVar(&retryBase, "retry-base-delay", simulator.DefaultRetryBaseDelay, "backoff before the first retry, doubled for every later one before jitter")
+	fs.DurationVar(&retryMax, "retry-max-delay", simulator.DefaultRetryMaxDelay, "longest backoff between retries")
+	fs.StringVar(&retryOverrides, "retry-overrides", "", "retry policies by operation as attempts[:base-delay[:max-delay]], such as replication=5:50ms:2s,prepare=1")
+	fs.StringVar(&topology, "regions", "", "regions to place the nodes in with their node counts, such as us-east:3,eu-west:2; replaces -nodes")
+	fs.StringVar(&scenarioPath, "scenario", "", "JSON scenario file setting the node count and seed and a timeline of events to inject")
+	fs.StringVar(&replayPath, "replay", "", "trace file exported from /recording/export to replay in place of random updates")
+	fs.StringVar(&opts.dataDir, "data-dir", "", "directory to restore a snapshot from at startup and save one to at shutdown")
+	fs.StringVar(&opts.resultsDir, "results-dir", "", "directory to write nodes.csv, events.csv, and metrics.csv to at shutdown")
+	fs.StringVar(&opts.storage, "storage", simulator.StorageMemory, "where to keep the nodes and event log: memory or file (alias bolt), which resumes them at startup")
+	fs.StringVar(&opts.storagePath, "storage-path", "simulator.db", "file of the file storage backend")
+	fs.StringVar(&opts.auditFile, "audit-file", "", "file to append every mutating request to as a line of JSON")
+	if err := fs.Parse(args); err != nil {
+		return options{}, err
+	}
+	sources, err := applySources(fs, configPath, getenv)
 	if err != nil {
-		log.Printf("Failed to marshal data: %v", err)
-		http.Error(w, "Failed to marshal data", http.StatusInternalServerError)
-		return
+		return options{}, err
+	}
+	opts.settings = settings(fs, sources)
+	check := func(key, format string, args ...any) error {
+		return invalid(sources, key, format, args...)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	_, err = w.Write(data)
-	if err != nil {
-		log.Printf("Failed to write data: %v", err)
+	if messageLatency != "" {
+		model, err := simulator.ParseLatencyModel(messageLatency)
+		if err != nil {
+			return options{}, check("message-latency", "%v", err)
+		}
+		opts.messageLatency = model
+	}
+	opts.retry.BaseDelay, opts.retry.MaxDelay = simulator.Duration(retryBase), simulator.Duration(retryMax)
+	if opts.retry.MaxAttempts < 1 {
+		return options{}, check("retry-attempts", "retry attempts must be at least 1, got %d", opts.retry.MaxAttempts)
+	}
+	if retryBase < 0 {
+		return options{}, check("retry-base-delay", "retry base delay must not be negative, got %v", retryBase)
+	}
+	if retryMax < retryBase {
+		return options{}, check("retry-max-delay", "retry max delay must be at least the base delay of %v, got %v", retryBase, retryMax)
+	}
+	if retryOverrides != "" {
+		overrides, err := simulator.ParseRetryOverrides(retryOverrides, opts.retry)
+		if err != nil {
+			return options{}, check("retry-overrides", "%v", err)
+		}
+		opts.retryOverrides = overrides
+	}
+	if topology != "" {
+		if scenarioPath != "" || replayPath != "" {
+			return options{}, fmt.Errorf("-regions cannot be combined with -scenario or -replay")
+		}
+		regions, err := simulator.ParseTopology(topology)
+		if err != nil {
+			return options{}, check("regions", "%v", err)
+		}
+		opts.regions, opts.nodes = regions, simulator.TopologySize(regions)
+	}
+	if scenarioPath != "" {
+		scenario, err := simulator.ReadScenario(scenarioPath)
+		if err != nil {
+			return options{}, err
+		}
+		opts.scenario, opts.nodes, opts.seed = scenario, scenario.Nodes, scenario.Seed
+	}
+	if replayPath != "" {
+		if scenarioPath != "" {
+			return options{}, fmt.Errorf("-replay and -scenario cannot be combined")
+		}
+		trace, err := simulator.ReadTrace(replayPath)
+		if err != nil {
+			return options{}, err
+		}
+		opts.replay, opts.nodes = trace, max(len(trace.Nodes), 1)
+		if trace.Mode != "" {
+			opts.mode = trace.Mode
+		}
+	}
+	if opts.nodes < 1 {
+		return options{}, check("nodes", "node count must be at least 1, got %d", opts.nodes)
+	}
+	if opts.updateInterval <= 0 {
+		return options{}, check("update-interval", "update interval must be positive, got %v", opts.updateInterval)
+	}
+	if opts.updaters < 1 {
+		return options{}, check("updaters", "updater count must be at least 1, got %d", opts.updaters)
+	}
+	if opts.fanout < 1 {
+		return options{}, check("gossip-fanout", "gossip fanout must be at least 1, got %d", opts.fanout)
+	}
+	switch opts.mode {
+	case simulator.ModeIndependent, simulator.ModeGossip, simulator.ModeRaft:
+	default:
+		return options{}, check("mode", "unknown mode %q", opts.mode)
+	}
+	if opts.n < 1 {
+		return options{}, check("n", "replication factor must be at least 1, got %d", opts.n)
+	}
+	if opts.r < 1 || opts.r > opts.n {
+		return options{}, check("r", "read quorum must be between 1 and %d, got %d", opts.n, opts.r)
+	}
+	if opts.w < 1 || opts.w > opts.n {
+		return options{}, check("w", "write quorum must be between 1 and %d, got %d", opts.n, opts.w)
+	}
+	if opts.aeBuckets < 1 {
+		return options{}, check("antientropy-buckets", "anti-entropy bucket count must be at least 1, got %d", opts.aeBuckets)
+	}
+	if opts.hintTTL <= 0 {
+		return options{}, check("hint-ttl", "hint TTL must be positive, got %v", opts.hintTTL)
+	}
+	if opts.graceTTL <= 0 {
+		return options{}, check("tombstone-grace", "tombstone grace period must be positive, got %v", opts.graceTTL)
+	}
+	if opts.restartFor <= 0 {
+		return options{}, check("restart-duration", "restart duration must be positive, got %v", opts.restartFor)
+	}
+	if opts.reload != simulator.ReloadSnapshot && opts.reload != simulator.ReloadReplicas && opts.reload != simulator.ReloadNone {
+		return options{}, check("restart-reload", "unknown restart reload source %q", opts.reload)
+	}
+	if opts.batch < 1 {
+		return options{}, check("transfer-batch", "transfer batch must be at least 1, got %d", opts.batch)
 	}
+	if opts.moves < 1 {
+		return options{}, check("max-concurrent-transfers", "max concurrent transfers must be at least 1, got %d", opts.moves)
+	}
+	if opts.hookFails < 1 {
+		return options{}, check("webhook-max-failures", "webhook max failures must be at least 1, got %d", opts.hookFails)
+	}
+	if opts.vnodes < 1 {
+		return options{}, check("vnodes", "virtual node count must be at least 1, got %d", opts.vnodes)
+	}
+	if opts.witnesses < 0 || opts.witnesses >= opts.nodes {
+		return options{}, check("witnesses", "witness count must be between 0 and %d, got %d", opts.nodes-1, opts.witnesses)
+	}
+	if opts.suspectTimeout <= heartbeatInterval {
+		return options{}, check("suspect-timeout", "suspect timeout must be longer than the %v heartbeat interval, got %v", heartbeatInterval, opts.suspectTimeout)
+	}
+	if opts.latency < 0 {
+		return options{}, check("latency", "latency must not be negative, got %v", opts.latency)
+	}
+	if opts.jitter < 0 {
+		return options{}, check("jitter", "jitter must not be negative, got %v", opts.jitter)
+	}
+	if opts.linkBandwidth < 0 {
+		return options{}, check("link-bandwidth", "link bandwidth must not be negative, got %d", opts.linkBandwidth)
+	}
+	if opts.bandwidthMode != simulator.BandwidthQueue && opts.bandwidthMode != simulator.BandwidthDrop {
+		return options{}, check("bandwidth-policy", "unknown bandwidth policy %q", opts.bandwidthMode)
+	}
+	if opts.interRegion < 0 {
+		return options{}, check("inter-region-latency", "inter-region latency must not be negative, got %v", opts.interRegion)
+	}
+	if opts.eventLogSize < 1 {
+		return options{}, check("event-log-size", "event log size must be at least 1, got %d", opts.eventLogSize)
+	}
+	if opts.historySize < 1 {
+		return options{}, check("history-size", "history size must be at least 1, got %d", opts.historySize)
+	}
+	if opts.inboxSize < 1 {
+		return options{}, check("inbox-size", "inbox size must be at least 1, got %d", opts.inboxSize)
+	}
+	if opts.maxNodeKeys < 1 {
+		return options{}, check("max-node-keys", "max node keys must be at least 1, got %d", opts.maxNodeKeys)
+	}
+	if opts.limits.CPU < 0 {
+		return options{}, check("cpu-limit", "CPU limit must not be negative, got %v", opts.limits.CPU)
+	}
+	if opts.limits.Memory < 0 {
+		return options{}, check("memory-limit", "memory limit must not be negative, got %d", opts.limits.Memory)
+	}
+	if opts.limits.Disk < 0 {
+		return options{}, check("disk-limit", "disk limit must not be negative, got %d", opts.limits.Disk)
+	}
+	opts.autoscaler.Cooldown = simulator.Duration(autoscaleCooldown)
+	if opts.autoscaler.Low < 0 {
+		return options{}, check("autoscale-low", "autoscale low watermark must not be negative, got %v", opts.autoscaler.Low)
+	}
+	if opts.autoscaler.High <= opts.autoscaler.Low {
+		return options{}, check("autoscale-high", "autoscale high watermark must be above the low watermark of %v, got %v", opts.autoscaler.Low, opts.autoscaler.High)
+	}
+	if opts.autoscaler.Ticks < 1 {
+		return options{}, check("autoscale-ticks", "autoscale ticks must be at least 1, got %d", opts.autoscaler.Ticks)
+	}
+	if opts.autoscaler.Min < 1 {
+		return options{}, check("autoscale-min", "autoscale min must be at least 1, got %d", opts.autoscaler.Min)
+	}
+	if opts.autoscaler.Max < opts.autoscaler.Min {
+		return options{}, check("autoscale-max", "autoscale max must be at least the min of %d, got %d", opts.autoscaler.Min, opts.autoscaler.Max)
+	}
+	if autoscaleCooldown <= 0 {
+		return options{}, check("autoscale-cooldown", "autoscale cooldown must be positive, got %v", autoscaleCooldown)
+	}
+	if opts.protectReads && opts.apiKey == "" {
+		return options{}, fmt.Errorf("-protect-reads requires an API key")
+	}
+	if opts.rateLimit < 0 {
+		return options{}, check("rate-limit", "rate limit must not be negative, got %v", opts.rateLimit)
+	}
+	if opts.rateBurst < 0 {
+		return options{}, check("rate-burst", "rate burst must not be negative, got %d", opts.rateBurst)
+	}
+	if (opts.tlsCert == "") != (opts.tlsKey == "") {
+		return options{}, fmt.Errorf("-tls-cert and -tls-key must be given together")
+	}
+	if opts.redirectAddr != "" && opts.tlsCert == "" {
+		return options{}, fmt.Errorf("-redirect-addr requires -tls-cert and -tls-key")
+	}
+	if opts.gzipMinSize < 1 {
+		return options{}, check("gzip-min-size", "gzip minimum size must be at least 1, got %d", opts.gzipMinSize)
+	}
+	if opts.logFormat != "text" && opts.logFormat != "json" {
+		return options{}, check("log-format", "unknown log format %q", opts.logFormat)
+	}
+	switch opts.storage {
+	case simulator.StorageMemory, simulator.StorageFile:
+	case simulator.StorageBolt:
+		opts.storage = simulator.StorageFile
+	default:
+		return options{}, check("storage", "unknown storage backend %q", opts.storage)
+	}
+	if opts.storagePath == "" {
+		return options{}, check("storage-path", "storage path must not be empty")
+	}
+	if opts.otelEndpoint != "" {
+		if u, err := url.Parse(opts.otelEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return options{}, check("otel-endpoint", "OpenTelemetry endpoint must be an http or https URL, got %q", opts.otelEndpoint)
+		}
+	}
+	if opts.failProb < 0 || opts.failProb > 1 {
+		return options{}, check("fail-prob", "fail probability must be between 0 and 1, got %v", opts.failProb)
+	}
+	if opts.recoverProb < 0 || opts.recoverProb > 1 {
+		return options{}, check("recover-prob", "recover probability must be between 0 and 1, got %v", opts.recoverProb)
+	}
+	return opts, nil
 }
 
-// RootHandler provides a welcome message at the root endpoint.
-func RootHandler(w http.ResponseWriter, r *http.Request) {
-	message := map[string]string{
-		"message": "Welcome to the Distributed System Simulator! Visit /nodes to get node data.",
-	}
+// listeners holds the listeners run serves the simulator on.
+type listeners struct {
+	http     net.Listener // HTTP API.
+	grpc     net.Listener // gRPC API, or nil to disable it.
+	redirect net.Listener // Plain HTTP redirected to HTTPS, or nil to disable it.
+	tls      *tls.Config  // Configuration to serve the HTTP API over TLS with, or nil for plain HTTP.
+}
 
-	data, err := json.Marshal(message)
-	if err != nil {
-		log.Printf("Failed to marshal message: %v", err)
-		http.Error(w, "Failed to marshal message", http.StatusInternalServerError)
-		return
+// run serves the simulator's HTTP API on lns.http, and its gRPC API and
+// HTTPS redirect on lns.grpc and lns.redirect unless they are nil,
+// periodically updates a random node and injects failures, and reloads the
+// configuration on SIGHUP until ctx is cancelled. It then stops accepting
+// connections on every listener, waits for in-flight requests to complete,
+// and waits for the update goroutine to exit.
+func run(ctx context.Context, sim *simulator.Simulator, lns listeners) error {
+	server := &http.Server{Handler: sim.Handler(), TLSConfig: lns.tls}
+
+	// Drive the simulation clock the background loops below tick from.
+	var wg sync.WaitGroup
+	if clock, ok := sim.Clock().(*simulator.VirtualClock); ok {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			clock.Run(ctx)
+		}()
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	_, err = w.Write(data)
-	if err != nil {
-		log.Printf("Failed to write message: %v", err)
+	if sim.Replaying() {
+		// Re-execute the loaded trace, which already holds the effects of
+		// the updater, chaos, gossip, and heartbeat loops it replaces.
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sim.StartReplay(ctx, sim.UpdateInterval())
+		}()
+	} else {
+		// Periodically update random nodes until shutdown is requested.
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sim.StartUpdater(ctx, sim.UpdateInterval())
+		}()
+
+		// Inject random failures on the same lifecycle as the updater.
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sim.StartChaos(ctx, sim.UpdateInterval())
+		}()
+
+		// Propagate values between nodes in gossip mode.
+		if sim.Mode() == simulator.ModeGossip {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sim.StartGossip(ctx, gossipInterval)
+			}()
+		}
+
+		// Emit heartbeats and run the failure detector.
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sim.StartHeartbeats(ctx, heartbeatInterval)
+		}()
 	}
-}
 
-// UpdateNode updates a random node with new data.
-func UpdateNode() {
-	mutex.Lock()
-	defer mutex.Unlock()
+	// Copy key-value writes to the replicas outside the write quorum.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		sim.StartReplication(ctx, replicationInterval)
+	}()
 
-	index := rand.Intn(nodeCount)
-	nodes[index].Value = rand.Intn(100)
-	nodes[index].Time = time.Now()
-}
+	// Transfer keys to joining nodes, from leaving ones, and between the
+	// nodes of a rebalance.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		sim.StartTransfers(ctx, transferInterval)
+	}()
 
-func main() {
-	// Initialize the nodes with random data.
-	InitNodes()
+	// Reconcile replicas that drifted apart, for example across a partition.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		sim.StartAntiEntropy(ctx, antiEntropyInterval)
+	}()
+
+	// Expire key-value entries written with a TTL.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		sim.StartKVSweeper(ctx, kvSweepInterval)
+	}()
+
+	// Deliver messages published to the message bus.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		sim.StartBus(ctx, busInterval)
+	}()
+
+	// Run the work queue's producers and consumers.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		sim.StartQueue(ctx, queueInterval)
+	}()
 
-	// HTTP server setup.
-	http.HandleFunc("/", RootHandler)      // Root endpoint with a welcome message
-	http.HandleFunc("/nodes", GetNodeData) // Endpoint for node data
+	// Send the load generator's synthetic requests.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		sim.StartLoadGen(ctx, loadGenInterval)
+	}()
+
+	// Write changes to the nodes and event log to the store.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		sim.StartPersist(ctx)
+	}()
+
+	// Deliver notifications to the registered webhooks.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		sim.StartWebhooks(ctx)
+	}()
+
+	// Export spans and metrics to the OpenTelemetry collector, if one was
+	// given.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		sim.StartTelemetry(ctx, telemetryInterval)
+	}()
+
+	// Play the scenario's timeline, if one was loaded.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		sim.StartScenario(ctx)
+	}()
 
-	// Periodically update a random node using goroutines.
+	// Reload the configuration on SIGHUP. The handler is installed before
+	// serving, so a hangup can't kill a simulator that is already up.
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		for {
-			UpdateNode()
-			time.Sleep(5 * time.Second)
+			select {
+			case <-ctx.Done():
+				return
+			case <-hangups:
+				// Reload logs what it changed, or why it failed.
+				sim.Reload()
+			}
 		}
 	}()
 
-	// Start the HTTP server.
-	fmt.Println("Server running on http://localhost:8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
-
-	// Wait for the goroutine to finish.
-	wg.Wait()
-}
+	// Serve until the listener fails or shutdown is requested.
+	serveErr := make(chan error, 1)
+	go func() {
+		if lns.tls != nil {
+			// The certificate is already in TLSConfig.
+			serveErr <- server.ServeTLS(lns.http, "", "")
+			return
+		}
+		serveErr <- server.Serve(lns.http)
+	}()
 
-// TestGetNodeData tests the behavior of the GetNodeData function.
-func TestGetNodeData(t *testing.T) {
-	// Initialize test data.
-	InitNodes()
+	// Serve the gRPC API alongside it.
+	var grpcServer *grpc.Server
+	if lns.grpc != nil {
+		grpcServer = sim.GRPCServer()
+		go func() {
+			if err := grpcServer.Serve(lns.grpc); err != nil {
+				slog.Error("gRPC server failed", "err", err)
+			}
+		}()
+	}
 
-	// Create a test HTTP request.
-	req, err := http.NewRequest("GET", "/nodes", nil)
-	if err != nil {
-		t.Fatalf("Failed to create test request: %v", err)
+	// Send plain HTTP clients to the HTTPS API.
+	var redirectServer *http.Server
+	if lns.redirect != nil {
+		_, port, _ := net.SplitHostPort(lns.http.Addr().String())
+		redirectServer = &http.Server{Handler: redirectToHTTPS(port)}
+		go func() {
+			if err := redirectServer.Serve(lns.redirect); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("redirect server failed", "err", err)
+			}
+		}()
 	}
 
-	// Create a ResponseRecorder to capture the response.
-	rr := httptest.NewRecorder()
+	var err error
+	select {
+	case err = <-serveErr:
+	case <-ctx.Done():
+		// Report not ready while in-flight requests drain.
+		sim.Drain()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		err = server.Shutdown(shutdownCtx)
+	}
+	if redirectServer != nil {
+		// Redirects complete instantly, so there is nothing to drain.
+		redirectServer.Close()
+	}
+	if grpcServer != nil {
+		stopGRPC(grpcServer, shutdownTimeout)
+	}
 
-	// Call the handler function.
-	handler := http.HandlerFunc(GetNodeData)
-	handler.ServeHTTP(rr, req)
+	// Wait for the goroutines to finish, and those of the clusters created
+	// through the API.
+	wg.Wait()
+	sim.StopClusters()
 
-	// Check the response status code.
-	if status := rr.Code; status != http.StatusOK {
-		t.Errorf("Expected status code %d, but got %d", http.StatusOK, status)
+	// Write what the persist goroutine hasn't, and changes that publish no
+	// events, so the next run resumes from the final state.
+	if storeErr := sim.SyncStore(); storeErr != nil && !errors.Is(storeErr, simulator.ErrNoStore) {
+		slog.Error("failed to persist state", "err", storeErr)
 	}
 
-	// Check the response body.
-	var respNodes []NodeData
-	err = json.Unmarshal(rr.Body.Bytes(), &respNodes)
-	if err != nil {
-		t.Errorf("Failed to unmarshal response body: %v", err)
+	// Save the final state so the next run can restore it.
+	if _, snapErr := sim.SaveSnapshot(); snapErr != nil && !errors.Is(snapErr, simulator.ErrNoDataDir) {
+		slog.Error("failed to save snapshot", "err", snapErr)
 	}
 
-	// Check if the response nodes match the expected nodes.
-	if !reflect.DeepEqual(respNodes, nodes) {
-		t.Errorf("Response nodes do not match expected nodes")
+	// And the results of the run, for analysis.
+	if _, exportErr := sim.ExportResults(); exportErr != nil && !errors.Is(exportErr, simulator.ErrNoResultsDir) {
+		slog.Error("failed to export results", "err", exportErr)
 	}
-}
 
-// TestRootHandler tests the behavior of the RootHandler function.
-func TestRootHandler(t *testing.T) {
-	// Create a test HTTP request.
-	req, err := http.NewRequest("GET", "/", nil)
-	if err != nil {
-		t.Fatalf("Failed to create test request: %v", err)
+	// And the spans of the last requests, with the final metrics.
+	telemetryCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if telemetryErr := sim.FlushTelemetry(telemetryCtx); telemetryErr != nil && !errors.Is(telemetryErr, simulator.ErrNoTelemetry) {
+		slog.Error("failed to export telemetry", "err", telemetryErr)
 	}
 
-	// Create a ResponseRecorder to capture the response.
-	rr := httptest.NewRecorder()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
 
-	// Call the handler function.
-	handler := http.HandlerFunc(RootHandler)
-	handler.ServeHTTP(rr, req)
+// redirectToHTTPS returns a handler that permanently redirects every request
+// to the same host and URL over HTTPS on the given port.
+func redirectToHTTPS(port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
 
-	// Check the response status code.
-	if status := rr.Code; status != http.StatusOK {
-		t.Errorf("Expected status code %d, but got %d", http.StatusOK, status)
+// stopGRPC stops server gracefully, cancelling any calls still running after
+// timeout.
+func stopGRPC(server *grpc.Server, timeout time.Duration) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(timeout):
+		server.Stop()
 	}
+}
 
-	// Check the response body.
-	var respMessage map[string]string
-	err = json.Unmarshal(rr.Body.Bytes(), &respMessage)
-	if err != nil {
-		t.Errorf("Failed to unmarshal response body: %v", err)
+// clientRegion returns the region HTTP clients are taken to be in: the first
+// of regions, or none if there are none.
+func clientRegion(regions []simulator.Region) string {
+	if len(regions) == 0 {
+		return ""
 	}
+	return regions[0].Name
+}
 
-	expectedMessage := map[string]string{
-		"message": "Welcome to the Distributed System Simulator! Visit /nodes to get node data.",
+// telemetryExporter returns an OTLP exporter to the collector at endpoint,
+// or nil, disabling telemetry, if endpoint is empty.
+func telemetryExporter(endpoint string) simulator.TelemetryExporter {
+	if endpoint == "" {
+		return nil
 	}
+	return simulator.NewOTLPExporter(endpoint)
+}
 
-	// Check if the response message matches the expected message.
-	if !reflect.DeepEqual(respMessage, expectedMessage) {
-		t.Errorf("Response message does not match expected message")
+// newLogger returns a logger writing records at or above opts.logLevel to
+// stderr in opts.logFormat.
+func newLogger(opts options) *slog.Logger {
+	handlerOpts := &slog.HandlerOptions{Level: opts.logLevel}
+	if opts.logFormat == "json" {
+		return slog.New(slog.NewJSONHandler(os.Stderr, handlerOpts))
 	}
+	return slog.New(slog.NewTextHandler(os.Stderr, handlerOpts))
 }
 
-// TestUpdateNode tests the behavior of the UpdateNode function.
-func TestUpdateNode(t *testing.T) {
-	// Initialize test data.
-	InitNodes()
+func main() {
+	// Determine the size and seed of the simulated system.
+	opts, err := parseOptions(os.Args[1:], os.Getenv)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	// Store the initial state of the nodes.
-	initialNodes := make([]NodeData, len(nodes))
-	copy(initialNodes, nodes)
+	// Log structured records to stderr in the requested format.
+	logger := newLogger(opts)
+	slog.SetDefault(logger)
 
-	// Call the UpdateNode function.
-	UpdateNode()
+	// Append the audit log to the audit file, if one was given.
+	var audit io.Writer
+	if opts.auditFile != "" {
+		f, err := os.OpenFile(opts.auditFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		audit = f
+	}
 
-	// Check if at least one node has been updated.
-	updated := false
-	for i := range nodes {
-		if !reflect.DeepEqual(nodes[i], initialNodes[i]) {
-			updated = true
-			break
+	// Keep the nodes and event log in the chosen storage backend.
+	store := simulator.NewMemoryStore()
+	if opts.storage == simulator.StorageFile {
+		if store, err = simulator.OpenFileStore(opts.storagePath); err != nil {
+			log.Fatal(err)
+		}
+	}
+	defer store.Close()
+
+	// Initialize the nodes with random data. The seed is logged so the run
+	// can be reproduced with -seed.
+	logger.Info("starting simulator", "seed", opts.seed, "nodes", opts.nodes, "mode", opts.mode)
+	sim := simulator.New(simulator.Config{
+		Seed:                   opts.seed,
+		FailProb:               opts.failProb,
+		RecoverProb:            opts.recoverProb,
+		UpdateInterval:         opts.updateInterval,
+		Updaters:               opts.updaters,
+		GossipFanout:           opts.fanout,
+		Mode:                   opts.mode,
+		N:                      opts.n,
+		R:                      opts.r,
+		W:                      opts.w,
+		HintTTL:                opts.hintTTL,
+		TombstoneGrace:         opts.graceTTL,
+		AntiEntropyBuckets:     opts.aeBuckets,
+		VirtualNodes:           opts.vnodes,
+		SuspectTimeout:         opts.suspectTimeout,
+		Latency:                opts.latency,
+		Jitter:                 opts.jitter,
+		InterRegionLatency:     opts.interRegion,
+		ClientRegion:           clientRegion(opts.regions),
+		MessageLatency:         opts.messageLatency,
+		LinkBandwidth:          opts.linkBandwidth,
+		BandwidthPolicy:        opts.bandwidthMode,
+		Retry:                  opts.retry,
+		RetryOverrides:         opts.retryOverrides,
+		Witnesses:              opts.witnesses,
+		SplitBrain:             opts.splitBrain,
+		VerifyChecksums:        opts.verifySums,
+		RestartDuration:        opts.restartFor,
+		RestartReload:          opts.reload,
+		TransferBatch:          opts.batch,
+		MaxConcurrentTransfers: opts.moves,
+		WebhookMaxFailures:     opts.hookFails,
+		EventLogSize:           opts.eventLogSize,
+		ValueHistorySize:       opts.historySize,
+		InboxSize:              opts.inboxSize,
+		MaxNodeKeys:            opts.maxNodeKeys,
+		ResourceLimits:         opts.limits,
+		Autoscaler:             opts.autoscaler,
+		CORSOrigins:            opts.corsOrigins,
+		APIKey:                 opts.apiKey,
+		ProtectReads:           opts.protectReads,
+		RateLimit:              opts.rateLimit,
+		RateBurst:              opts.rateBurst,
+		TrustProxy:             opts.trustProxy,
+		Logger:                 logger,
+		DataDir:                opts.dataDir,
+		ResultsDir:             opts.resultsDir,
+		Store:                  store,
+		AuditWriter:            audit,
+		Settings:               opts.settings,
+		Reload:                 reloadSettings(os.Args[1:], os.Getenv, opts.scenario),
+		Debug:                  opts.debug,
+		Telemetry:              telemetryExporter(opts.otelEndpoint),
+		Clock:                  simulator.NewVirtualClock(time.Now()),
+	})
+	if opts.regions != nil {
+		sim.InitTopology(opts.regions)
+	} else {
+		sim.Init(opts.nodes)
+	}
+	if opts.scenario != nil {
+		sim.LoadScenario(opts.scenario)
+	}
+	if opts.replay != nil {
+		sim.LoadTrace(opts.replay)
+	}
+	// Pick up where the previous run left off, from the store or else the
+	// latest snapshot. A corrupt snapshot is fatal rather than silently
+	// replaced by fresh nodes.
+	resumed, err := sim.Resume()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if opts.dataDir != "" && !resumed {
+		if _, err := sim.RestoreLatest(); err != nil && !errors.Is(err, simulator.ErrNoSnapshot) {
+			log.Fatal(err)
 		}
 	}
 
-	if !updated {
-		t.Error("No node was updated by the UpdateNode function")
+	// Shut down gracefully on SIGINT or SIGTERM.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Start the HTTP server.
+	var lns listeners
+	if lns.http, err = net.Listen("tcp", ":8080"); err != nil {
+		log.Fatal(err)
+	}
+	scheme := "http"
+	if opts.tlsCert != "" {
+		cert, err := tls.LoadX509KeyPair(opts.tlsCert, opts.tlsKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+		lns.tls = &tls.Config{Certificates: []tls.Certificate{cert}}
+		scheme = "https"
+	}
+	logger.Info("server running", "url", scheme+"://localhost:8080")
+	if opts.redirectAddr != "" {
+		if lns.redirect, err = net.Listen("tcp", opts.redirectAddr); err != nil {
+			log.Fatal(err)
+		}
+		logger.Info("redirecting HTTP to HTTPS", "addr", lns.redirect.Addr().String())
+	}
+	if opts.grpcAddr != "" {
+		if lns.grpc, err = net.Listen("tcp", opts.grpcAddr); err != nil {
+			log.Fatal(err)
+		}
+		logger.Info("gRPC server running", "addr", lns.grpc.Addr().String())
+	}
+	if err := run(ctx, sim, lns); err != nil {
+		log.Fatal(err)
 	}
+	logger.Info("server stopped")
 }
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"DistributedSystemSimulator/simulator"
+	"DistributedSystemSimulator/simulator/simulatorpb"
+)
+
+// TestParseOptions tests flag and environment variable handling.
+func TestParseOptions(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		env       string
+		wantNodes int
+		wantSeed  int64 // Checked only when non-zero.
+		wantErr   bool
+	}{
+		{"default", nil, "", defaultNodeCount, 0, false},
+		{"env", nil, "12", 12, 0, false},
+		{"flag", []string{"-nodes=50"}, "", 50, 0, false},
+		{"env overrides flag", []string{"-nodes=50"}, "12", 12, 0, false},
+		{"seed", []string{"-seed=7"}, "", defaultNodeCount, 7, false},
+		{"zero", []string{"-nodes=0"}, "", 0, 0, true},
+		{"negative env", nil, "-3", 0, 0, true},
+		{"non-numeric env", nil, "many", 0, 0, true},
+		{"non-numeric seed", []string{"-seed=abc"}, "", 0, 0, true},
+		{"chaos", []string{"-fail-prob=0.2", "-recover-prob=1"}, "", defaultNodeCount, 0, false},
+		{"updaters", []string{"-update-interval=100ms", "-updaters=4"}, "", defaultNodeCount, 0, false},
+		{"zero update interval", []string{"-update-interval=0"}, "", 0, 0, true},
+		{"zero updaters", []string{"-updaters=0"}, "", 0, 0, true},
+		{"gossip fanout", []string{"-gossip-fanout=3"}, "", defaultNodeCount, 0, false},
+		{"zero gossip fanout", []string{"-gossip-fanout=0"}, "", 0, 0, true},
+		{"gossip mode", []string{"-mode=gossip"}, "", defaultNodeCount, 0, false},
+		{"raft mode", []string{"-mode=raft"}, "", defaultNodeCount, 0, false},
+		{"unknown mode", []string{"-mode=paxos"}, "", 0, 0, true},
+		{"quorums", []string{"-n=5", "-r=3", "-w=3"}, "", defaultNodeCount, 0, false},
+		{"read quorum above N", []string{"-n=3", "-r=4"}, "", 0, 0, true},
+		{"zero write quorum", []string{"-w=0"}, "", 0, 0, true},
+		{"hint ttl", []string{"-hint-ttl=30s"}, "", defaultNodeCount, 0, false},
+		{"zero hint ttl", []string{"-hint-ttl=0"}, "", 0, 0, true},
+		{"tombstone grace", []string{"-tombstone-grace=5m"}, "", defaultNodeCount, 0, false},
+		{"zero tombstone grace", []string{"-tombstone-grace=0"}, "", 0, 0, true},
+		{"zero anti-entropy buckets", []string{"-antientropy-buckets=0"}, "", 0, 0, true},
+		{"zero virtual nodes", []string{"-vnodes=0"}, "", 0, 0, true},
+		{"suspect timeout", []string{"-suspect-timeout=5s"}, "", defaultNodeCount, 0, false},
+		{"suspect timeout within heartbeat interval", []string{"-suspect-timeout=500ms"}, "", 0, 0, true},
+		{"latency", []string{"-latency=50ms", "-jitter=20ms"}, "", defaultNodeCount, 0, false},
+		{"negative jitter", []string{"-jitter=-1ms"}, "", 0, 0, true},
+		{"regions", []string{"-nodes=50", "-regions=us-east:3,eu-west:2", "-inter-region-latency=80ms"}, "", 5, 0, false},
+		{"region without count", []string{"-regions=us-east"}, "", 0, 0, true},
+		{"duplicate region", []string{"-regions=us-east:1,us-east:2"}, "", 0, 0, true},
+		{"regions with scenario", []string{"-regions=us-east:3", "-scenario=scenarios/partition.json"}, "", 0, 0, true},
+		{"negative inter-region latency", []string{"-inter-region-latency=-1ms"}, "", 0, 0, true},
+		{"message latency", []string{"-message-latency=intra-zone=1ms,intra-region=5ms,inter-region=80ms,jitter=2ms"}, "", defaultNodeCount, 0, false},
+		{"unknown message latency", []string{"-message-latency=cross-planet=1s"}, "", 0, 0, true},
+		{"negative message latency", []string{"-message-latency=jitter=-1ms"}, "", 0, 0, true},
+		{"link bandwidth", []string{"-link-bandwidth=4096", "-bandwidth-policy=drop"}, "", defaultNodeCount, 0, false},
+		{"negative link bandwidth", []string{"-link-bandwidth=-1"}, "", 0, 0, true},
+		{"unknown bandwidth policy", []string{"-bandwidth-policy=shape"}, "", 0, 0, true},
+		{"retry", []string{"-retry-attempts=5", "-retry-base-delay=10ms", "-retry-max-delay=500ms", "-retry-overrides=replication=8:1ms,prepare=1"}, "", defaultNodeCount, 0, false},
+		{"zero retry attempts", []string{"-retry-attempts=0"}, "", 0, 0, true},
+		{"retry max delay below base", []string{"-retry-base-delay=1s", "-retry-max-delay=10ms"}, "", 0, 0, true},
+		{"split brain", []string{"-split-brain"}, "", defaultNodeCount, 0, false},
+		{"verify checksums", []string{"-verify-checksums"}, "", defaultNodeCount, 0, false},
+		{"restart", []string{"-restart-duration=5s", "-restart-reload=replicas"}, "", defaultNodeCount, 0, false},
+		{"zero restart duration", []string{"-restart-duration=0"}, "", 0, 0, true},
+		{"unknown restart reload", []string{"-restart-reload=disk"}, "", 0, 0, true},
+		{"transfer batch", []string{"-transfer-batch=64"}, "", defaultNodeCount, 0, false},
+		{"zero transfer batch", []string{"-transfer-batch=0"}, "", 0, 0, true},
+		{"max concurrent transfers", []string{"-max-concurrent-transfers=4"}, "", defaultNodeCount, 0, false},
+		{"zero max concurrent transfers", []string{"-max-concurrent-transfers=0"}, "", 0, 0, true},
+		{"webhook max failures", []string{"-webhook-max-failures=10"}, "", defaultNodeCount, 0, false},
+		{"zero webhook max failures", []string{"-webhook-max-failures=0"}, "", 0, 0, true},
+		{"witnesses", []string{"-witnesses=2"}, "", defaultNodeCount, 0, false},
+		{"negative witnesses", []string{"-witnesses=-1"}, "", 0, 0, true},
+		{"every node a witness", []string{"-nodes=3", "-witnesses=3"}, "", 0, 0, true},
+		{"unknown retry override", []string{"-retry-overrides=gossip=2"}, "", 0, 0, true},
+		{"invalid retry override", []string{"-retry-overrides=hint=two"}, "", 0, 0, true},
+		{"zero event log size", []string{"-event-log-size=0"}, "", 0, 0, true},
+		{"zero history size", []string{"-history-size=0"}, "", 0, 0, true},
+		{"zero inbox size", []string{"-inbox-size=0"}, "", 0, 0, true},
+		{"zero max node keys", []string{"-max-node-keys=0"}, "", 0, 0, true},
+		{"resource limits", []string{"-cpu-limit=80", "-memory-limit=1048576", "-disk-limit=65536"}, "", defaultNodeCount, 0, false},
+		{"negative cpu limit", []string{"-cpu-limit=-1"}, "", 0, 0, true},
+		{"negative memory limit", []string{"-memory-limit=-1"}, "", 0, 0, true},
+		{"autoscaler", []string{"-autoscale", "-autoscale-high=80", "-autoscale-low=20", "-autoscale-min=3", "-autoscale-max=10", "-autoscale-cooldown=1m"}, "", defaultNodeCount, 0, false},
+		{"autoscale high under low", []string{"-autoscale-high=20", "-autoscale-low=40"}, "", 0, 0, true},
+		{"autoscale max under min", []string{"-autoscale-min=4", "-autoscale-max=3"}, "", 0, 0, true},
+		{"zero autoscale cooldown", []string{"-autoscale-cooldown=0s"}, "", 0, 0, true},
+		{"scenario", []string{"-nodes=50", "-scenario=scenarios/partition.json"}, "", 5, 42, false},
+		{"missing scenario", []string{"-scenario=scenarios/missing.json"}, "", 0, 0, true},
+		{"missing trace", []string{"-replay=missing-trace.json"}, "", 0, 0, true},
+		{"replay with scenario", []string{"-replay=missing-trace.json", "-scenario=scenarios/partition.json"}, "", 0, 0, true},
+		{"gzip", []string{"-gzip=false", "-gzip-min-size=1"}, "", defaultNodeCount, 0, false},
+		{"zero gzip minimum size", []string{"-gzip-min-size=0"}, "", 0, 0, true},
+		{"cors origins", []string{"-cors-origins=http://a.test, http://b.test"}, "", defaultNodeCount, 0, false},
+		{"api key", []string{"-api-key=k", "-protect-reads"}, "", defaultNodeCount, 0, false},
+		{"protect reads without a key", []string{"-protect-reads"}, "", 0, 0, true},
+		{"rate limit", []string{"-rate-limit=0.5", "-rate-burst=10", "-trust-proxy"}, "", defaultNodeCount, 0, false},
+		{"negative rate limit", []string{"-rate-limit=-1"}, "", 0, 0, true},
+		{"json logs", []string{"-log-level=debug", "-log-format=json"}, "", defaultNodeCount, 0, false},
+		{"unknown log level", []string{"-log-level=loud"}, "", 0, 0, true},
+		{"unknown log format", []string{"-log-format=xml"}, "", 0, 0, true},
+		{"data dir", []string{"-data-dir=/tmp/sim"}, "", defaultNodeCount, 0, false},
+		{"results dir", []string{"-results-dir=/tmp/results"}, "", defaultNodeCount, 0, false},
+		{"file storage", []string{"-storage=file", "-storage-path=/tmp/sim.db"}, "", defaultNodeCount, 0, false},
+		{"bolt storage", []string{"-storage=bolt"}, "", defaultNodeCount, 0, false},
+		{"unknown storage", []string{"-storage=sqlite"}, "", 0, 0, true},
+		{"empty storage path", []string{"-storage-path="}, "", 0, 0, true},
+		{"audit file", []string{"-audit-file=/tmp/audit.jsonl"}, "", defaultNodeCount, 0, false},
+		{"tls", []string{"-tls-cert=cert.pem", "-tls-key=key.pem", "-redirect-addr=:8081"}, "", defaultNodeCount, 0, false},
+		{"debug", []string{"-debug"}, "", defaultNodeCount, 0, false},
+		{"otel endpoint", []string{"-otel-endpoint=http://localhost:4318"}, "", defaultNodeCount, 0, false},
+		{"otel endpoint without a scheme", []string{"-otel-endpoint=localhost:4318"}, "", 0, 0, true},
+		{"tls cert without key", []string{"-tls-cert=cert.pem"}, "", 0, 0, true},
+		{"tls key without cert", []string{"-tls-key=key.pem"}, "", 0, 0, true},
+		{"redirect without tls", []string{"-redirect-addr=:8081"}, "", 0, 0, true},
+		{"fail probability too high", []string{"-fail-prob=1.5"}, "", 0, 0, true},
+		{"negative recover probability", []string{"-recover-prob=-0.1"}, "", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		getenv := func(key string) string {
+			if key == "SIM_NODE_COUNT" {
+				return tt.env
+			}
+			return ""
+		}
+
+		got, err := parseOptions(tt.args, getenv)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: unexpected error state: %v", tt.name, err)
+			continue
+		}
+		if got.nodes != tt.wantNodes {
+			t.Errorf("%s: expected %d nodes, but got %d", tt.name, tt.wantNodes, got.nodes)
+		}
+		if tt.wantSeed != 0 && got.seed != tt.wantSeed {
+			t.Errorf("%s: expected seed %d, but got %d", tt.name, tt.wantSeed, got.seed)
+		}
+	}
+}
+
+// TestParseCORSOrigins tests splitting the -cors-origins list.
+func TestParseCORSOrigins(t *testing.T) {
+	opts, err := parseOptions([]string{"-cors-origins= http://a.test,,http://b.test "}, func(string) string { return "" })
+	if err != nil {
+		t.Fatalf("parseOptions failed: %v", err)
+	}
+	if want := []string{"http://a.test", "http://b.test"}; !slices.Equal(opts.corsOrigins, want) {
+		t.Errorf("Expected origins %q, got %q", want, opts.corsOrigins)
+	}
+}
+
+// TestParseAPIKey tests that SIM_API_KEY overrides -api-key, and that the
+// key is redacted from the settings.
+func TestParseAPIKey(t *testing.T) {
+	getenv := func(key string) string {
+		if key == "SIM_API_KEY" {
+			return "from-env"
+		}
+		return ""
+	}
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		{nil, "from-env"},
+		{[]string{"-api-key=from-flag"}, "from-env"},
+	} {
+		opts, err := parseOptions(tt.args, getenv)
+		if err != nil {
+			t.Fatalf("parseOptions(%q) failed: %v", tt.args, err)
+		}
+		if opts.apiKey != tt.want {
+			t.Errorf("parseOptions(%q): expected API key %q, got %q", tt.args, tt.want, opts.apiKey)
+		}
+		if got := opts.settings["api-key"]; got.Value != "[redacted]" || got.Source != "env" {
+			t.Errorf("parseOptions(%q): expected the API key redacted, got %+v", tt.args, got)
+		}
+	}
+}
+
+// TestRunGracefulShutdown tests that run serves requests and that cancelling
+// its context shuts down the server and stops the update goroutine.
+func TestRunGracefulShutdown(t *testing.T) {
+	sim := simulator.New(simulator.Config{})
+	sim.Init(defaultNodeCount)
+
+	// Start the servers on random ports.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	grpcLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- run(ctx, sim, listeners{http: ln, grpc: grpcLn})
+	}()
+
+	// Issue a request against the running server.
+	resp, err := http.Get("http://" + ln.Addr().String() + "/nodes")
+	if err != nil {
+		t.Fatalf("Failed to get nodes: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status code %d, but got %d", http.StatusOK, resp.StatusCode)
+	}
+
+	// And one against the gRPC server.
+	conn, err := grpc.NewClient(grpcLn.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to dial gRPC: %v", err)
+	}
+	defer conn.Close()
+	client := simulatorpb.NewSimulatorClient(conn)
+	if _, err := client.ListNodes(ctx, &simulatorpb.ListNodesRequest{}); err != nil {
+		t.Errorf("Failed to list nodes over gRPC: %v", err)
+	}
+
+	// Request shutdown, as the signal handler in main would.
+	cancel()
+
+	// run only returns once the update goroutine has exited.
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("run returned an error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("run did not return after shutdown was requested")
+	}
+
+	// The server must no longer accept connections.
+	if _, err := http.Get("http://" + ln.Addr().String() + "/nodes"); err == nil {
+		t.Error("Expected request after shutdown to fail")
+	}
+	if _, err := client.ListNodes(context.Background(), &simulatorpb.ListNodesRequest{}); err == nil {
+		t.Error("Expected gRPC call after shutdown to fail")
+	}
+}
+
+// TestRunSavesSnapshotOnShutdown tests that run saves a snapshot when it
+// shuts down with a data directory, so the next run can restore the nodes.
+func TestRunSavesSnapshotOnShutdown(t *testing.T) {
+	dir := t.TempDir()
+	sim := simulator.New(simulator.Config{DataDir: dir})
+	sim.Init(defaultNodeCount)
+	sim.SetNode(2, "saved", 42)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- run(ctx, sim, listeners{http: ln})
+	}()
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("run returned an error: %v", err)
+	}
+
+	next := simulator.New(simulator.Config{DataDir: dir})
+	next.Init(1)
+	if _, err := next.RestoreLatest(); err != nil {
+		t.Fatalf("RestoreLatest: %v", err)
+	}
+	got, _ := json.Marshal(next.Snapshot())
+	want, _ := json.Marshal(sim.Snapshot())
+	if string(got) != string(want) {
+		t.Errorf("Restored nodes differ:\ngot  %s\nwant %s", got, want)
+	}
+}
+
+// TestRunExportsResultsOnShutdown tests that run writes the results of a
+// short simulation to CSV files when it shuts down with a results directory.
+func TestRunExportsResultsOnShutdown(t *testing.T) {
+	dir := t.TempDir()
+	sim := simulator.New(simulator.Config{ResultsDir: dir, UpdateInterval: 5 * time.Millisecond, FailProb: 0.5, RecoverProb: 0.5})
+	sim.Init(defaultNodeCount)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- run(ctx, sim, listeners{http: ln})
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(sim.TickSamples()) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for three ticks")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("run returned an error: %v", err)
+	}
+
+	ticks := len(sim.TickSamples())
+	for name, want := range map[string]struct {
+		first string
+		rows  int
+	}{
+		"nodes.csv":   {"id", defaultNodeCount},
+		"events.csv":  {"seq", len(sim.EventHistory(0, 1000).Events)},
+		"metrics.csv": {"tick", ticks},
+	} {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", name, err)
+		}
+		records, err := csv.NewReader(f).ReadAll()
+		f.Close()
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", name, err)
+		}
+		if len(records) != want.rows+1 || records[0][0] != want.first {
+			t.Errorf("%s: expected a header starting with %q and %d rows, got %d records starting with %q", name, want.first, want.rows, len(records)-1, records[0][0])
+		}
+	}
+}
+
+// writeSelfSignedCert writes a self-signed certificate for 127.0.0.1 and its
+// key to PEM files in a temporary directory and returns their paths and the
+// parsed certificate.
+func writeSelfSignedCert(t *testing.T) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "simulator test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	if cert, err = x509.ParseCertificate(der); err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	for file, block := range map[string]*pem.Block{
+		certFile: {Type: "CERTIFICATE", Bytes: der},
+		keyFile:  {Type: "PRIVATE KEY", Bytes: keyDER},
+	} {
+		if err := os.WriteFile(file, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatalf("Failed to write %s: %v", file, err)
+		}
+	}
+	return certFile, keyFile, cert
+}
+
+// TestRunTLS tests that run serves the API over TLS, redirects plain HTTP
+// to it, and closes both listeners on shutdown.
+func TestRunTLS(t *testing.T) {
+	certFile, keyFile, cert := writeSelfSignedCert(t)
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Failed to load key pair: %v", err)
+	}
+
+	sim := simulator.New(simulator.Config{})
+	sim.Init(defaultNodeCount)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	redirectLn, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- run(ctx, sim, listeners{
+			http:     ln,
+			redirect: redirectLn,
+			tls:      &tls.Config{Certificates: []tls.Certificate{pair}},
+		})
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	defer client.CloseIdleConnections()
+	httpsURL := "https://" + ln.Addr().String() + "/nodes"
+	resp, err := client.Get(httpsURL)
+	if err != nil {
+		t.Fatalf("Failed to get nodes over TLS: %v", err)
+	}
+	var nodes []simulator.NodeData
+	err = json.NewDecoder(resp.Body).Decode(&nodes)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Failed to decode nodes: %v", err)
+	}
+	if len(nodes) != defaultNodeCount {
+		t.Errorf("Expected %d nodes, got %d", defaultNodeCount, len(nodes))
+	}
+
+	// Plain HTTP on the HTTPS port is refused.
+	if resp, err := http.Get("http://" + ln.Addr().String() + "/nodes"); err == nil {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			t.Error("Expected plain HTTP on the TLS listener to fail")
+		}
+	}
+
+	// The redirect listener sends plain HTTP clients to the HTTPS API.
+	noFollow := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err = noFollow.Get("http://" + redirectLn.Addr().String() + "/nodes?status=up")
+	if err != nil {
+		t.Fatalf("Failed to get redirect: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPermanentRedirect {
+		t.Errorf("Expected status %d, got %d", http.StatusPermanentRedirect, resp.StatusCode)
+	}
+	if got, want := resp.Header.Get("Location"), httpsURL+"?status=up"; got != want {
+		t.Errorf("Expected redirect to %q, got %q", want, got)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("run returned an error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("run did not return after shutdown was requested")
+	}
+	client.CloseIdleConnections()
+	if _, err := client.Get(httpsURL); err == nil {
+		t.Error("Expected TLS request after shutdown to fail")
+	}
+	if _, err := noFollow.Get("http://" + redirectLn.Addr().String() + "/nodes"); err == nil {
+		t.Error("Expected redirect request after shutdown to fail")
+	}
+}
@@ -0,0 +1,268 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"DistributedSystemSimulator/simulator"
+)
+
+// nodePath returns the path of the node with the given ID, followed by the
+// given suffix.
+func nodePath(id int, suffix string) string {
+	return "/nodes/" + strconv.Itoa(id) + suffix
+}
+
+// nodeRequest is the JSON body of AddNode and UpdateNode.
+type nodeRequest struct {
+	Name    string  `json:"name"`
+	Value   int     `json:"value"`
+	Version *uint64 `json:"version,omitempty"`
+}
+
+// ListNodes returns every node.
+func (c *Client) ListNodes(ctx context.Context) ([]simulator.NodeData, error) {
+	var nodes []simulator.NodeData
+	err := c.call(ctx, http.MethodGet, "/nodes", nil, nil, &nodes)
+	return nodes, err
+}
+
+// GetNode returns the node with the given ID.
+func (c *Client) GetNode(ctx context.Context, id int) (simulator.NodeData, error) {
+	var node simulator.NodeData
+	err := c.call(ctx, http.MethodGet, nodePath(id, ""), nil, nil, &node)
+	return node, err
+}
+
+// AddNode adds a node with the given name and value. It joins once the keys
+// it owns are transferred to it.
+func (c *Client) AddNode(ctx context.Context, name string, value int) (simulator.NodeData, error) {
+	var node simulator.NodeData
+	err := c.call(ctx, http.MethodPost, "/nodes", nil, nodeRequest{Name: name, Value: value}, &node)
+	return node, err
+}
+
+// UpdateNode sets the name and value of the node with the given ID.
+func (c *Client) UpdateNode(ctx context.Context, id int, name string, value int) (simulator.NodeData, error) {
+	var node simulator.NodeData
+	err := c.call(ctx, http.MethodPut, nodePath(id, ""), nil, nodeRequest{Name: name, Value: value}, &node)
+	return node, err
+}
+
+// UpdateNodeIf is UpdateNode, but only if the node is at the given version;
+// otherwise it returns an error matching ErrConflict.
+func (c *Client) UpdateNodeIf(ctx context.Context, id int, name string, value int, version uint64) (simulator.NodeData, error) {
+	var node simulator.NodeData
+	err := c.call(ctx, http.MethodPut, nodePath(id, ""), nil, nodeRequest{Name: name, Value: value, Version: &version}, &node)
+	return node, err
+}
+
+// RemoveNode removes the node with the given ID. Unless force is set, a
+// node with keys to hand off leaves first and is removed once they are,
+// after RemoveNode returns.
+func (c *Client) RemoveNode(ctx context.Context, id int, force bool) error {
+	var query url.Values
+	if force {
+		query = url.Values{"force": {"true"}}
+	}
+	return c.call(ctx, http.MethodDelete, nodePath(id, ""), query, nil, nil)
+}
+
+// FailNode marks the node with the given ID down.
+func (c *Client) FailNode(ctx context.Context, id int) (simulator.NodeData, error) {
+	var node simulator.NodeData
+	err := c.call(ctx, http.MethodPost, nodePath(id, "/fail"), nil, nil, &node)
+	return node, err
+}
+
+// RecoverNode marks the node with the given ID up.
+func (c *Client) RecoverNode(ctx context.Context, id int) (simulator.NodeData, error) {
+	var node simulator.NodeData
+	err := c.call(ctx, http.MethodPost, nodePath(id, "/recover"), nil, nil, &node)
+	return node, err
+}
+
+// Leader returns the current leader. It returns an error matching
+// ErrNotFound if there is none.
+func (c *Client) Leader(ctx context.Context) (simulator.NodeData, error) {
+	var node simulator.NodeData
+	err := c.call(ctx, http.MethodGet, "/leader", nil, nil, &node)
+	return node, err
+}
+
+// Stats returns the cluster-wide statistics.
+func (c *Client) Stats(ctx context.Context) (simulator.ClusterStats, error) {
+	var stats simulator.ClusterStats
+	err := c.call(ctx, http.MethodGet, "/stats", nil, nil, &stats)
+	return stats, err
+}
+
+// partitionLayout is the JSON body of the partition endpoints.
+type partitionLayout struct {
+	Groups  [][]int    `json:"groups"`
+	Regions [][]string `json:"regions,omitempty"`
+}
+
+// Partitions returns the partition groups of node IDs, or none if the
+// cluster is whole.
+func (c *Client) Partitions(ctx context.Context) ([][]int, error) {
+	var layout partitionLayout
+	err := c.call(ctx, http.MethodGet, "/partitions", nil, nil, &layout)
+	return layout.Groups, err
+}
+
+// Partition splits the cluster into the given groups of node IDs, which
+// only reach the nodes in their own group, and returns the resulting groups.
+func (c *Client) Partition(ctx context.Context, groups [][]int) ([][]int, error) {
+	var layout partitionLayout
+	err := c.call(ctx, http.MethodPost, "/partitions", nil, partitionLayout{Groups: groups}, &layout)
+	return layout.Groups, err
+}
+
+// Heal heals every partition.
+func (c *Client) Heal(ctx context.Context) error {
+	return c.call(ctx, http.MethodDelete, "/partitions", nil, nil, nil)
+}
+
+// linkRequest is the JSON body of SetLinkLoss.
+type linkRequest struct {
+	Loss float64 `json:"loss"`
+}
+
+// SetLinkLoss sets the rate of messages lost on the link from the node
+// with ID from to the node with ID to, between 0 and 1.
+func (c *Client) SetLinkLoss(ctx context.Context, from, to int, loss float64) (simulator.LinkInfo, error) {
+	var info simulator.LinkInfo
+	path := "/links/" + strconv.Itoa(from) + "/" + strconv.Itoa(to)
+	err := c.call(ctx, http.MethodPost, path, nil, linkRequest{Loss: loss}, &info)
+	return info, err
+}
+
+// PauseHeartbeats drops the heartbeats of the node with the given ID, so
+// the failure detector comes to suspect it while it stays up.
+func (c *Client) PauseHeartbeats(ctx context.Context, id int) error {
+	return c.call(ctx, http.MethodPost, nodePath(id, "/heartbeats/pause"), nil, nil, nil)
+}
+
+// ResumeHeartbeats restores the heartbeats of the node with the given ID.
+func (c *Client) ResumeHeartbeats(ctx context.Context, id int) error {
+	return c.call(ctx, http.MethodPost, nodePath(id, "/heartbeats/resume"), nil, nil, nil)
+}
+
+// kvRequest is the JSON body of KVPut.
+type kvRequest struct {
+	Value string `json:"value"`
+}
+
+// KVGet reads key from a read quorum. It returns an error matching
+// ErrNotFound if the key doesn't exist and one matching ErrUnavailable if
+// too few replicas are up.
+func (c *Client) KVGet(ctx context.Context, key string) (simulator.KVResult, error) {
+	var result simulator.KVResult
+	err := c.call(ctx, http.MethodGet, "/kv/"+url.PathEscape(key), nil, nil, &result)
+	return result, err
+}
+
+// KVPut writes value for key to a write quorum, expiring after ttl if it is
+// positive. It returns an error matching ErrUnavailable if too few replicas
+// are up.
+func (c *Client) KVPut(ctx context.Context, key, value string, ttl time.Duration) (simulator.KVResult, error) {
+	var query url.Values
+	if ttl > 0 {
+		query = url.Values{"ttl": {ttl.String()}}
+	}
+	var result simulator.KVResult
+	err := c.call(ctx, http.MethodPut, "/kv/"+url.PathEscape(key), query, kvRequest{Value: value}, &result)
+	return result, err
+}
+
+// KVDelete deletes key from a write quorum.
+func (c *Client) KVDelete(ctx context.Context, key string) (simulator.KVResult, error) {
+	var result simulator.KVResult
+	err := c.call(ctx, http.MethodDelete, "/kv/"+url.PathEscape(key), nil, nil, &result)
+	return result, err
+}
+
+// StartLoadgen starts sending synthetic requests to the nodes with the
+// given settings. If it is already running, it carries on with the new
+// settings.
+func (c *Client) StartLoadgen(ctx context.Context, settings simulator.LoadGenSettings) (simulator.LoadGenStats, error) {
+	var stats simulator.LoadGenStats
+	err := c.call(ctx, http.MethodPost, "/loadgen/start", nil, settings, &stats)
+	return stats, err
+}
+
+// StopLoadgen stops sending synthetic requests.
+func (c *Client) StopLoadgen(ctx context.Context) (simulator.LoadGenStats, error) {
+	var stats simulator.LoadGenStats
+	err := c.call(ctx, http.MethodPost, "/loadgen/stop", nil, nil, &stats)
+	return stats, err
+}
+
+// LoadgenStats returns how the synthetic requests were spread over the
+// nodes.
+func (c *Client) LoadgenStats(ctx context.Context) (simulator.LoadGenStats, error) {
+	var stats simulator.LoadGenStats
+	err := c.call(ctx, http.MethodGet, "/loadgen/stats", nil, nil, &stats)
+	return stats, err
+}
+
+// EventHistory returns a page of up to limit events after sequence number
+// since, or simulator.DefaultHistoryLimit if limit is 0.
+func (c *Client) EventHistory(ctx context.Context, since uint64, limit int) (simulator.EventPage, error) {
+	query := url.Values{"since": {strconv.FormatUint(since, 10)}}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	var page simulator.EventPage
+	err := c.call(ctx, http.MethodGet, "/events/history", query, nil, &page)
+	return page, err
+}
+
+// WatchEvents delivers the events logged after sequence number since, in
+// order, on the returned channel as they happen, until ctx is cancelled.
+// It long-polls the simulator, so it resumes where it left off across
+// retried requests and misses nothing unless events are evicted from the
+// simulator's log before it catches up. A request that fails for good is
+// sent on the error channel; then both channels are closed, as they are
+// once ctx is cancelled.
+func (c *Client) WatchEvents(ctx context.Context, since uint64) (<-chan simulator.Event, <-chan error) {
+	events := make(chan simulator.Event)
+	errc := make(chan error, 1)
+	// Each watch waits well within the timeout of a request.
+	wait := min(max(c.timeout/2, time.Millisecond), simulator.MaxWatchTimeout)
+	go func() {
+		defer close(errc)
+		defer close(events)
+		for {
+			query := url.Values{
+				"since_seq": {strconv.FormatUint(since, 10)},
+				"timeout":   {wait.String()},
+			}
+			var page simulator.EventPage
+			err := c.call(ctx, http.MethodGet, "/nodes/watch", query, nil, &page)
+			switch {
+			case ctx.Err() != nil:
+				return
+			case errors.Is(err, errNotModified):
+				continue
+			case err != nil:
+				errc <- err
+				return
+			}
+			for _, e := range page.Events {
+				select {
+				case events <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+			since = max(since, page.Next)
+		}
+	}()
+	return events, errc
+}
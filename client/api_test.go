@@ -0,0 +1,202 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"DistributedSystemSimulator/simulator"
+)
+
+// TestNodes tests the node methods.
+func TestNodes(t *testing.T) {
+	c, sim := newTestClient(t, simulator.Config{Seed: 1})
+	ctx := context.Background()
+
+	nodes, err := c.ListNodes(ctx)
+	if err != nil || len(nodes) != testNodeCount {
+		t.Fatalf("Expected %d nodes, got %d %v", testNodeCount, len(nodes), err)
+	}
+	if node, err := c.GetNode(ctx, 2); err != nil || node.ID != nodes[2].ID || node.Value != nodes[2].Value {
+		t.Errorf("Expected node 2, got %+v %v", node, err)
+	}
+
+	added, err := c.AddNode(ctx, "extra", 7)
+	if err != nil || added.Name != "extra" || added.Value != 7 || added.ID != testNodeCount {
+		t.Errorf("Unexpected added node %+v %v", added, err)
+	}
+	updated, err := c.UpdateNode(ctx, 0, "renamed", 42)
+	if err != nil || updated.Name != "renamed" || updated.Value != 42 {
+		t.Errorf("Unexpected updated node %+v %v", updated, err)
+	}
+	if node, err := c.UpdateNodeIf(ctx, 0, "renamed", 43, updated.Version); err != nil || node.Value != 43 {
+		t.Errorf("Expected the conditional update to apply, got %+v %v", node, err)
+	}
+	if err := c.RemoveNode(ctx, added.ID, true); err != nil {
+		t.Errorf("RemoveNode failed: %v", err)
+	}
+	if _, err := c.GetNode(ctx, added.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the removed node to be gone, got %v", err)
+	}
+
+	leader, err := c.Leader(ctx)
+	if err != nil || !leader.Leader {
+		t.Fatalf("Expected a leader, got %+v %v", leader, err)
+	}
+	id := (leader.ID + 1) % testNodeCount
+	if node, err := c.FailNode(ctx, id); err != nil || node.Status != simulator.StatusDown {
+		t.Errorf("Expected node %d down, got %+v %v", id, node, err)
+	}
+	if stats, err := c.Stats(ctx); err != nil || stats.Down != 1 || stats.Nodes != testNodeCount {
+		t.Errorf("Expected one node down, got %+v %v", stats, err)
+	}
+	if node, err := c.RecoverNode(ctx, id); err != nil || node.Status != simulator.StatusUp {
+		t.Errorf("Expected node %d up, got %+v %v", id, node, err)
+	}
+	if got := sim.Stats(); got.Down != 0 {
+		t.Errorf("Expected the simulator to see the recovery, got %+v", got)
+	}
+}
+
+// TestPartitionsAndKV tests the partition and key-value methods.
+func TestPartitionsAndKV(t *testing.T) {
+	c, _ := newTestClient(t, simulator.Config{Seed: 1})
+	ctx := context.Background()
+
+	if groups, err := c.Partitions(ctx); err != nil || len(groups) != 0 {
+		t.Errorf("Expected no partitions, got %v %v", groups, err)
+	}
+	want := [][]int{{0, 1, 2}, {3, 4}}
+	if groups, err := c.Partition(ctx, want); err != nil || !reflect.DeepEqual(groups, want) {
+		t.Errorf("Expected the groups %v, got %v %v", want, groups, err)
+	}
+	if groups, _ := c.Partitions(ctx); !reflect.DeepEqual(groups, want) {
+		t.Errorf("Expected the groups %v, got %v", want, groups)
+	}
+	if err := c.Heal(ctx); err != nil {
+		t.Errorf("Heal failed: %v", err)
+	}
+	if groups, _ := c.Partitions(ctx); len(groups) != 0 {
+		t.Errorf("Expected the partitions healed, got %v", groups)
+	}
+
+	if result, err := c.KVPut(ctx, "some key", "v1", time.Minute); err != nil || result.Value != "v1" || result.Expires == nil {
+		t.Errorf("Unexpected write %+v %v", result, err)
+	}
+	if result, err := c.KVGet(ctx, "some key"); err != nil || result.Value != "v1" {
+		t.Errorf("Expected to read v1, got %+v %v", result, err)
+	}
+	if result, err := c.KVDelete(ctx, "some key"); err != nil || !result.Deleted {
+		t.Errorf("Unexpected delete %+v %v", result, err)
+	}
+	if _, err := c.KVGet(ctx, "some key"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the deleted key to be gone, got %v", err)
+	}
+}
+
+// TestLoadgen tests the load generator methods.
+func TestLoadgen(t *testing.T) {
+	c, _ := newTestClient(t, simulator.Config{Seed: 1})
+	ctx := context.Background()
+
+	if _, err := c.StopLoadgen(ctx); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected stopping an idle generator to conflict, got %v", err)
+	}
+	if _, err := c.StartLoadgen(ctx, simulator.LoadGenSettings{Rate: -1}); !errors.Is(err, ErrBadRequest) {
+		t.Errorf("Expected a negative rate to be rejected, got %v", err)
+	}
+	settings := simulator.LoadGenSettings{Rate: 10, Strategy: simulator.BalanceRoundRobin}
+	if stats, err := c.StartLoadgen(ctx, settings); err != nil || !stats.Running || stats.Rate != 10 {
+		t.Errorf("Expected the generator running, got %+v %v", stats, err)
+	}
+	if stats, err := c.LoadgenStats(ctx); err != nil || !stats.Running || stats.Strategy != simulator.BalanceRoundRobin {
+		t.Errorf("Unexpected stats %+v %v", stats, err)
+	}
+	if stats, err := c.StopLoadgen(ctx); err != nil || stats.Running {
+		t.Errorf("Expected the generator stopped, got %+v %v", stats, err)
+	}
+}
+
+// TestEvents tests that EventHistory pages through the event log and
+// WatchEvents delivers events as they happen, across watches that time out,
+// for a cluster as well as the default one.
+func TestEvents(t *testing.T) {
+	c, sim := newTestClient(t, simulator.Config{Seed: 1})
+	c.timeout = 100 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if _, err := sim.CreateCluster(simulator.ClusterSpec{Name: "a", Nodes: 3, Seed: 2}); err != nil {
+		t.Fatalf("CreateCluster failed: %v", err)
+	}
+	for _, c := range []*Client{c, c.Cluster("a")} {
+		c.UpdateNode(ctx, 0, "first", 1)
+		events, errc := c.WatchEvents(ctx, 1)
+		// Let a watch or two time out before anything happens.
+		time.Sleep(120 * time.Millisecond)
+		c.UpdateNode(ctx, 1, "second", 2)
+		c.UpdateNode(ctx, 2, "third", 3)
+		for _, want := range []string{"second", "third"} {
+			select {
+			case e := <-events:
+				if e.Type != simulator.EventNodeUpdated || e.Node.Name != want {
+					t.Errorf("Expected %s to be updated, got %+v", want, e)
+				}
+			case err := <-errc:
+				t.Fatalf("Watch failed: %v", err)
+			case <-time.After(time.Second):
+				t.Fatalf("Timed out waiting for %s", want)
+			}
+		}
+
+		page, err := c.EventHistory(ctx, 0, 2)
+		if err != nil || len(page.Events) != 2 || !page.More || page.Events[0].Node.Name != "first" {
+			t.Errorf("Unexpected first page %+v %v", page, err)
+		}
+		if page, err := c.EventHistory(ctx, page.Next, 0); err != nil || len(page.Events) != 1 || page.More {
+			t.Errorf("Unexpected second page %+v %v", page, err)
+		}
+	}
+
+	watchCtx, stop := context.WithCancel(ctx)
+	events, errc := c.WatchEvents(watchCtx, 0)
+	stop()
+	for range events {
+	}
+	if err := <-errc; err != nil {
+		t.Errorf("Expected cancelling a watch to end it quietly, got %v", err)
+	}
+
+	// A watch ended by an error reports it.
+	_, errc = c.Cluster("missing").WatchEvents(ctx, 0)
+	if err := <-errc; !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected a watch of a missing cluster to fail, got %v", err)
+	}
+}
+
+// TestLinksAndHeartbeats tests the link loss and heartbeat methods.
+func TestLinksAndHeartbeats(t *testing.T) {
+	c, sim := newTestClient(t, simulator.Config{Seed: 1})
+	ctx := context.Background()
+
+	if info, err := c.SetLinkLoss(ctx, 0, 1, 0.5); err != nil || info.Loss[0][1] != 0.5 {
+		t.Errorf("Expected the link to lose half its messages, got %+v %v", info, err)
+	}
+	if _, err := c.SetLinkLoss(ctx, 0, 1, 2); !errors.Is(err, ErrBadRequest) {
+		t.Errorf("Expected a loss above 1 to be rejected, got %v", err)
+	}
+	if err := c.PauseHeartbeats(ctx, 2); err != nil {
+		t.Errorf("PauseHeartbeats failed: %v", err)
+	}
+	if err := c.ResumeHeartbeats(ctx, 2); err != nil {
+		t.Errorf("ResumeHeartbeats failed: %v", err)
+	}
+	if err := c.PauseHeartbeats(ctx, 99); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected an unknown node to be rejected, got %v", err)
+	}
+	if got := sim.Links().Loss[0][1]; got != 0.5 {
+		t.Errorf("Expected the simulator to see the loss, got %v", got)
+	}
+}
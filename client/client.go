@@ -0,0 +1,264 @@
+// Package client drives a running simulator through its HTTP API. A Client
+// mirrors the API one method per endpoint and returns the same types the
+// server does, from package simulator, so callers such as test harnesses
+// need no hand-rolled requests.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"DistributedSystemSimulator/simulator"
+)
+
+// Defaults of Config.
+const (
+	DefaultTimeout = 10 * time.Second
+	DefaultRetries = 2
+	DefaultBackoff = 100 * time.Millisecond
+)
+
+// Errors matched by the *Error a Client returns for a failed request, by
+// HTTP status, so callers can write errors.Is(err, client.ErrNotFound).
+var (
+	ErrBadRequest   = errors.New("bad request")  // 400
+	ErrUnauthorized = errors.New("unauthorized") // 401
+	ErrNotFound     = errors.New("not found")    // 404
+	ErrConflict     = errors.New("conflict")     // 409
+	ErrRateLimited  = errors.New("rate limited") // 429
+	ErrUnavailable  = errors.New("unavailable")  // 503
+)
+
+// Error is the error a Client returns when the simulator answers a request
+// with an error status. It carries the simulator's ErrorResponse.
+type Error struct {
+	StatusCode int    // The HTTP status.
+	Code       string // One of the simulator.ErrorCode constants, or "" if the body had none.
+	Message    string
+	RequestID  string // The X-Request-ID of the request, to quote when reporting it.
+}
+
+// Error describes e.
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("simulator: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("simulator: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Is reports whether e has the status target stands for, one of the Err
+// variables of this package.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrUnavailable:
+		return e.StatusCode == http.StatusServiceUnavailable
+	}
+	return false
+}
+
+// Config holds the settings of a Client.
+type Config struct {
+	// BaseURL is the simulator's address, such as "http://localhost:8080".
+	// A path, such as "/clusters/flaky", prefixes every request's.
+	BaseURL string
+
+	// APIKey is sent with every request in the X-API-Key header, if set.
+	APIKey string
+
+	// Timeout bounds each attempt at a request, or DefaultTimeout if 0.
+	// Watches ask the simulator to wait for less than it.
+	Timeout time.Duration
+
+	// Retries is how many times a request is retried after a failure that
+	// may pass, or DefaultRetries if 0; -1 disables retries. Requests the
+	// simulator rate limited are retried, after its Retry-After; so are
+	// requests of idempotent methods that failed to reach it or got 502 or
+	// 504 from a proxy. A 503 is not retried, since it reports the
+	// simulated cluster's state, such as a down node.
+	Retries int
+
+	// Backoff is how long the first retry waits, doubling for each one
+	// after it, or DefaultBackoff if 0.
+	Backoff time.Duration
+
+	// HTTPClient sends the requests, or http.DefaultClient if nil. Its own
+	// Timeout applies on top of Timeout.
+	HTTPClient *http.Client
+}
+
+// Client sends requests to a simulator's HTTP API. It is safe for
+// concurrent use.
+type Client struct {
+	base    *url.URL
+	apiKey  string
+	timeout time.Duration
+	retries int
+	backoff time.Duration
+	http    *http.Client
+}
+
+// New returns a Client for the simulator at cfg.BaseURL, filling in the
+// defaults of other zero fields. It returns an error if BaseURL is not an
+// absolute HTTP or HTTPS URL.
+func New(cfg Config) (*Client, error) {
+	base, err := url.Parse(cfg.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("client: base URL: %v", err)
+	}
+	if (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("client: base URL %q must be an absolute http or https URL", cfg.BaseURL)
+	}
+	base.Path = strings.TrimSuffix(base.Path, "/")
+	base.RawPath = ""
+
+	c := &Client{
+		base:    base,
+		apiKey:  cfg.APIKey,
+		timeout: cfg.Timeout,
+		retries: cfg.Retries,
+		backoff: cfg.Backoff,
+		http:    cfg.HTTPClient,
+	}
+	if c.timeout <= 0 {
+		c.timeout = DefaultTimeout
+	}
+	switch {
+	case c.retries == 0:
+		c.retries = DefaultRetries
+	case c.retries < 0:
+		c.retries = 0
+	}
+	if c.backoff <= 0 {
+		c.backoff = DefaultBackoff
+	}
+	if c.http == nil {
+		c.http = http.DefaultClient
+	}
+	return c, nil
+}
+
+// Cluster returns a Client for the cluster named name, simulated in the
+// same process, with c's settings; see simulator.CreateCluster.
+func (c *Client) Cluster(name string) *Client {
+	cluster := *c
+	base := *c.base
+	base.Path += "/clusters/" + url.PathEscape(name)
+	cluster.base = &base
+	return &cluster
+}
+
+// call sends a request with the given method, path, query, and JSON body,
+// unless body is nil, and decodes the JSON response into out, unless it is
+// nil. It retries as Config.Retries describes. A response with status 300
+// or above is returned as an *Error, except 304 Not Modified, for which
+// call returns errNotModified.
+func (c *Client) call(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("client: encoding request: %v", err)
+		}
+	}
+	u := *c.base
+	u.Path += path
+	u.RawQuery = query.Encode()
+
+	for attempt := 0; ; attempt++ {
+		wait, err := c.attempt(ctx, method, u.String(), data, out)
+		if wait < 0 || attempt >= c.retries || ctx.Err() != nil {
+			return err
+		}
+		wait = max(wait, c.backoff<<attempt)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// errNotModified is returned by call for a 304 Not Modified response, which
+// the simulator's watches send when nothing changed before their timeout.
+var errNotModified = errors.New("not modified")
+
+// attempt sends a request once. It returns how long to wait before retrying
+// it, or a negative duration if it must not be retried.
+func (c *Client) attempt(ctx context.Context, method, u string, data []byte, out any) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	var body io.Reader
+	if data != nil {
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return -1, fmt.Errorf("client: %v", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set(simulator.APIKeyHeader, c.apiKey)
+	}
+
+	idempotent := method != http.MethodPost && method != http.MethodPatch
+	resp, err := c.http.Do(req)
+	if err != nil {
+		if idempotent {
+			return 0, err
+		}
+		return -1, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		return -1, errNotModified
+	case resp.StatusCode >= 300:
+		apiErr := &Error{StatusCode: resp.StatusCode, RequestID: resp.Header.Get(simulator.RequestIDHeader)}
+		var payload simulator.ErrorResponse
+		if json.NewDecoder(resp.Body).Decode(&payload) == nil {
+			apiErr.Code, apiErr.Message = payload.Error.Code, payload.Error.Message
+			if payload.Error.RequestID != "" {
+				apiErr.RequestID = payload.Error.RequestID
+			}
+		}
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests:
+			seconds, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+			return time.Duration(seconds) * time.Second, apiErr
+		case idempotent && (resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusGatewayTimeout):
+			return 0, apiErr
+		}
+		return -1, apiErr
+	case out == nil:
+		return -1, nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return -1, fmt.Errorf("client: decoding %s response: %v", req.URL.Path, err)
+	}
+	return -1, nil
+}
@@ -0,0 +1,136 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"DistributedSystemSimulator/simulator"
+)
+
+// testNodeCount is the number of nodes the simulators under test start with.
+const testNodeCount = 5
+
+// newTestClient returns a Client for a simulator created from cfg, served
+// with its full router by an httptest server, and the simulator.
+func newTestClient(t *testing.T, cfg simulator.Config) (*Client, *simulator.Simulator) {
+	t.Helper()
+	sim := simulator.New(cfg)
+	sim.Init(testNodeCount)
+	srv := httptest.NewServer(sim.Handler())
+	t.Cleanup(srv.Close)
+	t.Cleanup(sim.StopClusters)
+	c, err := New(Config{BaseURL: srv.URL, APIKey: cfg.APIKey})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return c, sim
+}
+
+// TestNew tests the base URLs New accepts and the defaults it fills in.
+func TestNew(t *testing.T) {
+	for _, base := range []string{"", "localhost:8080", "/nodes", "ftp://host", "http://"} {
+		if _, err := New(Config{BaseURL: base}); err == nil {
+			t.Errorf("%q: expected an error", base)
+		}
+	}
+	c, err := New(Config{BaseURL: "http://localhost:8080/", Retries: -1})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if c.base.String() != "http://localhost:8080" || c.timeout != DefaultTimeout || c.retries != 0 || c.backoff != DefaultBackoff || c.http != http.DefaultClient {
+		t.Errorf("Unexpected client %+v", c)
+	}
+	if got := c.Cluster("flaky").base.String(); got != "http://localhost:8080/clusters/flaky" {
+		t.Errorf("Expected the cluster's prefix, got %s", got)
+	}
+}
+
+// TestErrors tests that error responses come back as an *Error matching
+// the error variable of their status.
+func TestErrors(t *testing.T) {
+	c, _ := newTestClient(t, simulator.Config{Seed: 1})
+	ctx := context.Background()
+
+	_, err := c.GetNode(ctx, 99)
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || !errors.Is(err, ErrNotFound) || errors.Is(err, ErrConflict) {
+		t.Fatalf("Expected a not found error, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusNotFound || apiErr.Code != simulator.ErrorCodeNotFound || apiErr.Message != "Node not found" || apiErr.RequestID == "" {
+		t.Errorf("Unexpected error %+v", apiErr)
+	}
+
+	node, _ := c.GetNode(ctx, 0)
+	if _, err := c.UpdateNodeIf(ctx, 0, "Node-0", 1, node.Version+1); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected a version mismatch to conflict, got %v", err)
+	}
+	if _, err := c.Partition(ctx, [][]int{{0, 99}}); !errors.Is(err, ErrBadRequest) {
+		t.Errorf("Expected an unknown node to be a bad request, got %v", err)
+	}
+}
+
+// TestAPIKey tests that the client presents its API key.
+func TestAPIKey(t *testing.T) {
+	c, _ := newTestClient(t, simulator.Config{Seed: 1, APIKey: "secret"})
+	ctx := context.Background()
+	if _, err := c.FailNode(ctx, 1); err != nil {
+		t.Errorf("Expected the key to be accepted, got %v", err)
+	}
+	c.apiKey = "wrong"
+	if _, err := c.FailNode(ctx, 1); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Expected a wrong key to be rejected, got %v", err)
+	}
+}
+
+// TestRetries tests which failed requests are retried, and how often.
+func TestRetries(t *testing.T) {
+	var calls, status atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if status.Load() == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "0")
+		}
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer srv.Close()
+	c, err := New(Config{BaseURL: srv.URL, Retries: 2, Backoff: time.Millisecond})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		status int
+		call   func() error
+		calls  int32
+	}{
+		{http.StatusBadGateway, func() error { _, err := c.GetNode(ctx, 0); return err }, 3},
+		{http.StatusBadGateway, func() error { _, err := c.FailNode(ctx, 0); return err }, 1},
+		{http.StatusTooManyRequests, func() error { _, err := c.FailNode(ctx, 0); return err }, 3},
+		{http.StatusServiceUnavailable, func() error { _, err := c.KVGet(ctx, "k"); return err }, 1},
+	} {
+		status.Store(int32(tt.status))
+		calls.Store(0)
+		var apiErr *Error
+		if err := tt.call(); !errors.As(err, &apiErr) || apiErr.StatusCode != tt.status {
+			t.Errorf("%d: expected the status as an error, got %v", tt.status, err)
+		}
+		if n := calls.Load(); n != tt.calls {
+			t.Errorf("%d: expected %d attempts, got %d", tt.status, tt.calls, n)
+		}
+	}
+
+	// A cancelled context stops the retries.
+	status.Store(http.StatusBadGateway)
+	c.backoff = time.Hour
+	cctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.GetNode(cctx, 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the deadline to end the retries, got %v", err)
+	}
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"DistributedSystemSimulator/simulator"
+)
+
+// commands returns every command of simctl, in the order they are listed.
+func commands() []command {
+	return []command{
+		{name: "nodes list", summary: "List the nodes", run: listNodes},
+		{name: "node get", args: "ID", summary: "Show a node", run: nodeCommand(getNode)},
+		{name: "node add", args: "NAME VALUE", summary: "Add a node", run: addNode},
+		{name: "node update", args: "ID NAME VALUE", summary: "Set a node's name and value", run: updateNode},
+		{name: "node remove", args: "ID", summary: "Remove a node, handing its keys off first", run: removeNode},
+		{name: "node fail", args: "ID", summary: "Mark a node down", run: nodeCommand(failNode)},
+		{name: "node recover", args: "ID", summary: "Mark a node up", run: nodeCommand(recoverNode)},
+		{name: "leader", summary: "Show the current leader", run: showLeader},
+		{name: "stats", summary: "Show cluster-wide statistics", run: showStats},
+		{name: "partition", args: "[GROUPS]", summary: `Partition the cluster into groups such as "0,1|2,3,4", or show the partition`, run: partition},
+		{name: "heal", summary: "Heal every partition", run: heal},
+		{name: "kv get", args: "KEY", summary: "Read a key from a read quorum", run: kvGet},
+		{name: "kv put", args: "KEY VALUE", summary: "Write a key to a write quorum", run: kvPut},
+		{name: "kv delete", args: "KEY", summary: "Delete a key from a write quorum", run: kvDelete},
+		{name: "watch", args: "[-since SEQ]", summary: "Stream events until interrupted", run: watch},
+		{name: "scenario run", args: "[-tick D] FILE", summary: "Play a scenario file's timeline against the cluster", run: runScenario},
+	}
+}
+
+// nArgs returns a usageError unless args has n elements.
+func nArgs(args []string, n int) error {
+	if len(args) != n {
+		return usagef("expected %d arguments, got %d", n, len(args))
+	}
+	return nil
+}
+
+// parseInt parses args[i], named name, as an integer.
+func parseInt(args []string, i int, name string) (int, error) {
+	n, err := strconv.Atoi(args[i])
+	if err != nil {
+		return 0, usagef("%s must be an integer, not %q", name, args[i])
+	}
+	return n, nil
+}
+
+// printJSON writes v to w as indented JSON.
+func printJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// print writes v as JSON, or as the table rows writes, depending on the
+// output format.
+func (e *env) print(v any, rows func(w io.Writer)) error {
+	if e.format == formatJSON {
+		return printJSON(e.out, v)
+	}
+	w := tabwriter.NewWriter(e.out, 0, 4, 2, ' ', 0)
+	rows(w)
+	return w.Flush()
+}
+
+// printNodes prints nodes as a table with a row per node.
+func (e *env) printNodes(v any, nodes ...simulator.NodeData) error {
+	return e.print(v, func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tNAME\tVALUE\tSTATUS\tLEADER\tVERSION")
+		for _, n := range nodes {
+			fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%t\t%d\n", n.ID, n.Name, n.Value, n.Status, n.Leader, n.Version)
+		}
+	})
+}
+
+// printKV prints the result of a key-value operation.
+func (e *env) printKV(result simulator.KVResult) error {
+	return e.print(result, func(w io.Writer) {
+		fmt.Fprintln(w, "KEY\tVALUE\tVERSION\tREPLICAS\tDELETED")
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%t\n", result.Key, result.Value, result.Version, joinInts(result.Replicas, ","), result.Deleted)
+	})
+}
+
+// joinInts returns the decimal forms of ns joined by sep.
+func joinInts(ns []int, sep string) string {
+	parts := make([]string, len(ns))
+	for i, n := range ns {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, sep)
+}
+
+func listNodes(ctx context.Context, e *env, args []string) error {
+	if err := nArgs(args, 0); err != nil {
+		return err
+	}
+	nodes, err := e.client.ListNodes(ctx)
+	if err != nil {
+		return err
+	}
+	return e.printNodes(nodes, nodes...)
+}
+
+// nodeCommand returns a command taking a node ID that calls op with it and
+// prints the node op returns.
+func nodeCommand(op func(ctx context.Context, e *env, id int) (simulator.NodeData, error)) func(context.Context, *env, []string) error {
+	return func(ctx context.Context, e *env, args []string) error {
+		if err := nArgs(args, 1); err != nil {
+			return err
+		}
+		id, err := parseInt(args, 0, "ID")
+		if err != nil {
+			return err
+		}
+		node, err := op(ctx, e, id)
+		if err != nil {
+			return err
+		}
+		return e.printNodes(node, node)
+	}
+}
+
+func getNode(ctx context.Context, e *env, id int) (simulator.NodeData, error) {
+	return e.client.GetNode(ctx, id)
+}
+
+func failNode(ctx context.Context, e *env, id int) (simulator.NodeData, error) {
+	return e.client.FailNode(ctx, id)
+}
+
+func recoverNode(ctx context.Context, e *env, id int) (simulator.NodeData, error) {
+	return e.client.RecoverNode(ctx, id)
+}
+
+func addNode(ctx context.Context, e *env, args []string) error {
+	if err := nArgs(args, 2); err != nil {
+		return err
+	}
+	value, err := parseInt(args, 1, "VALUE")
+	if err != nil {
+		return err
+	}
+	node, err := e.client.AddNode(ctx, args[0], value)
+	if err != nil {
+		return err
+	}
+	return e.printNodes(node, node)
+}
+
+func updateNode(ctx context.Context, e *env, args []string) error {
+	if err := nArgs(args, 3); err != nil {
+		return err
+	}
+	id, err := parseInt(args, 0, "ID")
+	if err != nil {
+		return err
+	}
+	value, err := parseInt(args, 2, "VALUE")
+	if err != nil {
+		return err
+	}
+	node, err := e.client.UpdateNode(ctx, id, args[1], value)
+	if err != nil {
+		return err
+	}
+	return e.printNodes(node, node)
+}
+
+func removeNode(ctx context.Context, e *env, args []string) error {
+	if err := nArgs(args, 1); err != nil {
+		return err
+	}
+	id, err := parseInt(args, 0, "ID")
+	if err != nil {
+		return err
+	}
+	return e.client.RemoveNode(ctx, id, false)
+}
+
+func showLeader(ctx context.Context, e *env, args []string) error {
+	if err := nArgs(args, 0); err != nil {
+		return err
+	}
+	node, err := e.client.Leader(ctx)
+	if err != nil {
+		return err
+	}
+	return e.printNodes(node, node)
+}
+
+func showStats(ctx context.Context, e *env, args []string) error {
+	if err := nArgs(args, 0); err != nil {
+		return err
+	}
+	stats, err := e.client.Stats(ctx)
+	if err != nil {
+		return err
+	}
+	return e.print(stats, func(w io.Writer) {
+		fmt.Fprintln(w, "NODES\tUP\tDOWN\tSUSPECTED\tMIN\tMAX\tMEAN\tUPDATES")
+		fmt.Fprintf(w, "%d\t%d\t%d\t%d\t%d\t%d\t%.2f\t%d\n", stats.Nodes, stats.Up, stats.Down, stats.Suspected, stats.Value.Min, stats.Value.Max, stats.Value.Mean, stats.Updates)
+	})
+}
+
+// parseGroups parses partition groups such as "0,1|2,3,4".
+func parseGroups(spec string) ([][]int, error) {
+	var groups [][]int
+	for _, part := range strings.Split(spec, "|") {
+		var group []int
+		for _, field := range strings.Split(part, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil {
+				return nil, usagef("groups must be node IDs separated by commas, with groups separated by |, such as \"0,1|2,3,4\"; not %q", spec)
+			}
+			group = append(group, id)
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// printGroups prints partition groups as a table with a row per group.
+func (e *env) printGroups(groups [][]int) error {
+	if groups == nil {
+		groups = [][]int{}
+	}
+	return e.print(groups, func(w io.Writer) {
+		fmt.Fprintln(w, "GROUP\tNODES")
+		for i, group := range groups {
+			fmt.Fprintf(w, "%d\t%s\n", i, joinInts(group, ","))
+		}
+	})
+}
+
+func partition(ctx context.Context, e *env, args []string) error {
+	var (
+		groups [][]int
+		err    error
+	)
+	switch len(args) {
+	case 0:
+		groups, err = e.client.Partitions(ctx)
+	case 1:
+		if groups, err = parseGroups(args[0]); err != nil {
+			return err
+		}
+		groups, err = e.client.Partition(ctx, groups)
+	default:
+		return usagef("expected at most 1 argument, got %d", len(args))
+	}
+	if err != nil {
+		return err
+	}
+	return e.printGroups(groups)
+}
+
+func heal(ctx context.Context, e *env, args []string) error {
+	if err := nArgs(args, 0); err != nil {
+		return err
+	}
+	return e.client.Heal(ctx)
+}
+
+func kvGet(ctx context.Context, e *env, args []string) error {
+	if err := nArgs(args, 1); err != nil {
+		return err
+	}
+	result, err := e.client.KVGet(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	return e.printKV(result)
+}
+
+func kvPut(ctx context.Context, e *env, args []string) error {
+	if err := nArgs(args, 2); err != nil {
+		return err
+	}
+	result, err := e.client.KVPut(ctx, args[0], args[1], 0)
+	if err != nil {
+		return err
+	}
+	return e.printKV(result)
+}
+
+func kvDelete(ctx context.Context, e *env, args []string) error {
+	if err := nArgs(args, 1); err != nil {
+		return err
+	}
+	result, err := e.client.KVDelete(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	return e.printKV(result)
+}
+
+// parseFlags parses a command's flags from args and returns the remaining
+// arguments.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return nil, usageError{err.Error()}
+	}
+	return fs.Args(), nil
+}
+
+// watch streams the events logged after -since, one per line, until ctx is
+// cancelled, as by an interrupt. In JSON, each line is an event object.
+func watch(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	since := fs.Uint64("since", 0, "sequence number to stream the events after")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := nArgs(args, 0); err != nil {
+		return err
+	}
+
+	events, errc := e.client.WatchEvents(ctx, *since)
+	if e.format == formatTable {
+		fmt.Fprintln(e.out, "SEQ\tTIME\tTYPE\tID\tNAME\tSTATUS\tVALUE")
+	}
+	encoder := json.NewEncoder(e.out)
+	for ev := range events {
+		if e.format == formatJSON {
+			if err := encoder.Encode(ev); err != nil {
+				return err
+			}
+			continue
+		}
+		n := ev.Node
+		fmt.Fprintf(e.out, "%d\t%s\t%s\t%d\t%s\t%s\t%d\n", ev.Seq, ev.Time.Format(time.RFC3339), ev.Type, n.ID, n.Name, n.Status, n.Value)
+	}
+	return <-errc
+}
+
+// scenarioTarget describes what a scenario event acts on.
+func scenarioTarget(ev simulator.ScenarioEvent) string {
+	switch {
+	case ev.Node != nil:
+		return "node " + strconv.Itoa(*ev.Node)
+	case ev.Groups != nil:
+		parts := make([]string, len(ev.Groups))
+		for i, group := range ev.Groups {
+			parts[i] = joinInts(group, ",")
+		}
+		return strings.Join(parts, "|")
+	case ev.From != nil && ev.To != nil && ev.Loss != nil:
+		return fmt.Sprintf("%d->%d loss %g", *ev.From, *ev.To, *ev.Loss)
+	}
+	return ""
+}
+
+// applyScenarioEvent injects ev into the cluster.
+func (e *env) applyScenarioEvent(ctx context.Context, ev simulator.ScenarioEvent) error {
+	var err error
+	switch ev.Type {
+	case simulator.ScenarioFail:
+		_, err = e.client.FailNode(ctx, *ev.Node)
+	case simulator.ScenarioRecover:
+		_, err = e.client.RecoverNode(ctx, *ev.Node)
+	case simulator.ScenarioPartition:
+		_, err = e.client.Partition(ctx, ev.Groups)
+	case simulator.ScenarioHeal:
+		err = e.client.Heal(ctx)
+	case simulator.ScenarioLoss:
+		_, err = e.client.SetLinkLoss(ctx, *ev.From, *ev.To, *ev.Loss)
+	case simulator.ScenarioPauseHeartbeats:
+		err = e.client.PauseHeartbeats(ctx, *ev.Node)
+	case simulator.ScenarioResumeHeartbeats:
+		err = e.client.ResumeHeartbeats(ctx, *ev.Node)
+	}
+	return err
+}
+
+// runScenario plays the timeline of a scenario file, in the format of the
+// simulator's -scenario flag, against the running cluster, each event once
+// its tick has passed in real time, printing each step as it runs. The
+// file's nodes and seed are ignored, since the cluster is already running;
+// -tick overrides its tick. A failed step doesn't stop the rest, but the
+// command fails with the first step's error.
+func runScenario(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("scenario run", flag.ContinueOnError)
+	tickFlag := fs.Duration("tick", 0, "real time per tick, overriding the file's")
+	args, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := nArgs(args, 1); err != nil {
+		return err
+	}
+	scenario, err := simulator.ReadScenario(args[0])
+	if err != nil {
+		return usageError{err.Error()}
+	}
+	tick := time.Duration(scenario.Tick)
+	switch {
+	case *tickFlag > 0:
+		tick = *tickFlag
+	case tick <= 0:
+		tick = simulator.DefaultScenarioTick
+	}
+
+	if e.format == formatTable {
+		fmt.Fprintln(e.out, "AT\tEVENT\tTARGET\tRESULT")
+	}
+	encoder := json.NewEncoder(e.out)
+	start := time.Now()
+	var first error
+	for _, ev := range scenario.Timeline {
+		if err := waitUntil(ctx, start.Add(time.Duration(ev.At)*tick)); err != nil {
+			return err
+		}
+		step := simulator.ScenarioStep{ScenarioEvent: ev, Executed: true}
+		if err := e.applyScenarioEvent(ctx, ev); err != nil {
+			step.Error = err.Error()
+			if first == nil {
+				first = fmt.Errorf("line %d: %w", ev.Line, err)
+			}
+		}
+		if e.format == formatJSON {
+			encoder.Encode(step)
+			continue
+		}
+		result := "ok"
+		if step.Error != "" {
+			result = step.Error
+		}
+		fmt.Fprintf(e.out, "%d\t%s\t%s\t%s\n", ev.At, ev.Type, scenarioTarget(ev), result)
+	}
+	return first
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"DistributedSystemSimulator/simulator"
+)
+
+// TestNodeCommands tests the node commands in both output formats.
+func TestNodeCommands(t *testing.T) {
+	url, sim := newTestServer(t, simulator.Config{Seed: 1})
+	ctx := context.Background()
+
+	code, out, _ := simctl(ctx, url, "nodes", "list")
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); code != exitOK || len(lines) != testNodeCount+1 || !strings.HasPrefix(lines[0], "ID") {
+		t.Errorf("Expected a header and a row per node, got %d %q", code, out)
+	}
+	code, out, _ = simctl(ctx, url, "-output", "json", "nodes", "list")
+	var nodes []simulator.NodeData
+	if err := json.Unmarshal([]byte(out), &nodes); code != exitOK || err != nil || len(nodes) != testNodeCount {
+		t.Errorf("Expected the nodes as JSON, got %d %q %v", code, out, err)
+	}
+
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"node", "get", "2"}, nodes[2].Name},
+		{[]string{"node", "add", "extra", "7"}, "extra"},
+		{[]string{"node", "update", "0", "renamed", "42"}, "renamed"},
+		{[]string{"node", "fail", "3"}, "down"},
+		{[]string{"stats"}, "SUSPECTED"},
+		{[]string{"node", "recover", "3"}, "up"},
+		{[]string{"leader"}, "true"},
+	} {
+		if code, out, stderr := simctl(ctx, url, tt.args...); code != exitOK || !strings.Contains(out, tt.want) {
+			t.Errorf("%q: expected %q, got %d %q %q", tt.args, tt.want, code, out, stderr)
+		}
+	}
+	if code, _, _ := simctl(ctx, url, "node", "remove", "5"); code != exitOK {
+		t.Errorf("Expected the added node to be removed, got %d", code)
+	}
+	waitFor(t, func() bool { _, ok := sim.Node(5); return !ok })
+	if code, _, _ := simctl(ctx, url, "node", "remove", "5"); code != exitNotFound {
+		t.Errorf("Expected removing a missing node to fail, got %d", code)
+	}
+	if got, _ := sim.Node(0); got.Name != "renamed" || got.Value != 42 {
+		t.Errorf("Expected the simulator to see the update, got %+v", got)
+	}
+}
+
+// TestPartitionCommands tests partition and heal.
+func TestPartitionCommands(t *testing.T) {
+	url, sim := newTestServer(t, simulator.Config{Seed: 1})
+	ctx := context.Background()
+
+	if code, out, _ := simctl(ctx, url, "partition", "0,1|2,3,4"); code != exitOK || !strings.Contains(out, "2,3,4") {
+		t.Errorf("Expected the groups, got %d %q", code, out)
+	}
+	if got := sim.Partition(); !reflect.DeepEqual(got, [][]int{{0, 1}, {2, 3, 4}}) {
+		t.Errorf("Expected the simulator partitioned, got %v", got)
+	}
+	code, out, _ := simctl(ctx, url, "-output", "json", "partition")
+	var groups [][]int
+	if err := json.Unmarshal([]byte(out), &groups); code != exitOK || err != nil || len(groups) != 2 {
+		t.Errorf("Expected the groups as JSON, got %d %q %v", code, out, err)
+	}
+	for _, args := range [][]string{{"partition", "0,x"}, {"partition", "0|1", "2"}} {
+		if code, _, _ := simctl(ctx, url, args...); code != exitUsage {
+			t.Errorf("%q: expected a usage error, got %d", args, code)
+		}
+	}
+	if code, _, _ := simctl(ctx, url, "partition", "0,99"); code != exitBadRequest {
+		t.Errorf("Expected an unknown node to be a bad request, got %d", code)
+	}
+
+	if code, _, _ := simctl(ctx, url, "heal"); code != exitOK || len(sim.Partition()) != 0 {
+		t.Errorf("Expected the partitions healed, got %d %v", code, sim.Partition())
+	}
+	if code, out, _ := simctl(ctx, url, "-output", "json", "partition"); code != exitOK || strings.TrimSpace(out) != "[]" {
+		t.Errorf("Expected no groups, got %d %q", code, out)
+	}
+}
+
+// TestKVCommands tests the key-value commands.
+func TestKVCommands(t *testing.T) {
+	url, _ := newTestServer(t, simulator.Config{Seed: 1})
+	ctx := context.Background()
+
+	if code, out, _ := simctl(ctx, url, "kv", "put", "k", "v1"); code != exitOK || !strings.Contains(out, "v1") {
+		t.Errorf("Unexpected write %d %q", code, out)
+	}
+	code, out, _ := simctl(ctx, url, "-output", "json", "kv", "get", "k")
+	var result simulator.KVResult
+	if err := json.Unmarshal([]byte(out), &result); code != exitOK || err != nil || result.Value != "v1" {
+		t.Errorf("Expected to read v1, got %d %q %v", code, out, err)
+	}
+	if code, _, _ := simctl(ctx, url, "kv", "delete", "k"); code != exitOK {
+		t.Errorf("Expected the delete to succeed, got %d", code)
+	}
+	if code, _, _ := simctl(ctx, url, "kv", "get", "k"); code != exitNotFound {
+		t.Errorf("Expected the deleted key to be gone, got %d", code)
+	}
+
+	// Without a quorum, writes are unavailable.
+	for id := 0; id < testNodeCount; id++ {
+		simctl(ctx, url, "node", "fail", strconv.Itoa(id))
+	}
+	if code, _, _ := simctl(ctx, url, "kv", "put", "k", "v2"); code != exitUnavailable {
+		t.Errorf("Expected the write to be unavailable, got %d", code)
+	}
+}
+
+// TestWatch tests that watch streams events, in both formats, until it is
+// interrupted.
+func TestWatch(t *testing.T) {
+	url, sim := newTestServer(t, simulator.Config{Seed: 1})
+	sim.Fail(1)
+
+	for _, format := range []string{formatTable, formatJSON} {
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		var code int
+		var out string
+		go func() {
+			defer close(done)
+			code, out, _ = simctl(ctx, url, "-output", format, "watch")
+		}()
+		// An event during the watch as well as one before it.
+		time.Sleep(50 * time.Millisecond)
+		sim.Recover(1)
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+		<-done
+
+		if code != exitOK {
+			t.Errorf("%s: expected an interrupted watch to succeed, got %d", format, code)
+		}
+		var types []string
+		scanner := bufio.NewScanner(strings.NewReader(out))
+		for scanner.Scan() {
+			if format == formatTable {
+				if fields := strings.Split(scanner.Text(), "\t"); len(fields) > 2 {
+					types = append(types, fields[2])
+				}
+				continue
+			}
+			var e simulator.Event
+			if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+				t.Fatalf("%s: unexpected line %q: %v", format, scanner.Text(), err)
+			}
+			types = append(types, e.Type)
+		}
+		if format == formatTable {
+			types = types[1:] // The header.
+		}
+		if len(types) < 2 || types[0] != simulator.EventNodeFailed || types[1] != simulator.EventNodeRecovered {
+			t.Errorf("%s: expected the failure and recovery, got %v in %q", format, types, out)
+		}
+		sim.Fail(1)
+	}
+
+	if code, _, _ := simctl(context.Background(), url, "watch", "-since", "x"); code != exitUsage {
+		t.Errorf("Expected a bad -since to be a usage error, got %d", code)
+	}
+}
+
+// TestScenarioRun tests that scenario run plays a timeline, carrying on past
+// a failed step but failing with its error.
+func TestScenarioRun(t *testing.T) {
+	url, sim := newTestServer(t, simulator.Config{Seed: 1})
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "demo.json")
+	// Node 7 is in the scenario's cluster, but not the running one.
+	scenario := `{"nodes": 10, "tick": "1h", "timeline": [
+  {"at": 1, "event": "fail", "node": 2},
+  {"at": 2, "event": "recover", "node": 7},
+  {"at": 3, "event": "partition", "groups": [[0, 1], [2, 3, 4]]},
+  {"at": 4, "event": "loss", "from": 0, "to": 1, "loss": 0.25}
+]}`
+	if err := os.WriteFile(path, []byte(scenario), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	code, _, stderr := simctl(ctx, url, "scenario", "run", "-tick", "time.Millisecond", path)
+	if code != exitUsage {
+		t.Errorf("Expected a bad -tick to be a usage error, got %d %q", code, stderr)
+	}
+	code, out, stderr := simctl(ctx, url, "-output", "json", "scenario", "run", "-tick", "1ms", path)
+	if code != exitNotFound || !strings.Contains(stderr, "line 3") {
+		t.Errorf("Expected the missing node to fail the run, got %d %q", code, stderr)
+	}
+	var steps []simulator.ScenarioStep
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		var step simulator.ScenarioStep
+		if err := json.Unmarshal([]byte(line), &step); err != nil {
+			t.Fatalf("Unexpected line %q: %v", line, err)
+		}
+		steps = append(steps, step)
+	}
+	if len(steps) != 4 || steps[0].Error != "" || steps[1].Error == "" || steps[3].Type != simulator.ScenarioLoss {
+		t.Errorf("Unexpected steps %+v", steps)
+	}
+	if node, _ := sim.Node(2); node.Status != simulator.StatusDown || len(sim.Partition()) != 2 || sim.Links().Loss[0][1] != 0.25 {
+		t.Errorf("Expected every other step to apply, got %+v %v", node, sim.Partition())
+	}
+
+	if code, out, _ := simctl(ctx, url, "scenario", "run", "-tick", "1ms", path); code != exitNotFound || !strings.Contains(out, "AT\tEVENT") || !strings.Contains(out, "node 7") {
+		t.Errorf("Expected a table of the steps, got %d %q", code, out)
+	}
+	if code, _, _ := simctl(ctx, url, "scenario", "run", filepath.Join(t.TempDir(), "missing.json")); code != exitUsage {
+		t.Errorf("Expected a missing file to be a usage error, got %d", code)
+	}
+}
+
+// waitFor waits up to a second for cond to hold.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,205 @@
+// Command simctl controls a running simulator through its HTTP API, with
+// the client package.
+//
+// Usage:
+//
+//	simctl [flags] <command> [arguments]
+//
+// Run simctl -h for the flags and commands. Results are printed as tables,
+// or as JSON with -output=json, and the exit status tells API errors apart
+// so scripts can react to them; see exitCode.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"DistributedSystemSimulator/client"
+)
+
+// Exit statuses of simctl.
+const (
+	exitOK           = 0
+	exitFailure      = 1 // The command failed for another reason, such as an unreachable server.
+	exitUsage        = 2 // The command line is invalid.
+	exitBadRequest   = 3 // The simulator rejected the request as invalid (400).
+	exitUnauthorized = 4 // The API key is missing or wrong (401).
+	exitNotFound     = 5 // The node, key, or other resource does not exist (404).
+	exitConflict     = 6 // The request conflicts with the simulator's state (409).
+	exitUnavailable  = 7 // The simulated cluster cannot serve the request now (503).
+)
+
+// Environment variables read for the defaults of the flags.
+const (
+	envServer = "SIMCTL_SERVER"
+	envAPIKey = "SIM_API_KEY" // The variable the simulator reads its key from.
+)
+
+// defaultServer is the simulator's address unless -server or SIMCTL_SERVER
+// names another.
+const defaultServer = "http://localhost:8080"
+
+// Output formats, as named by the -output flag.
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+)
+
+// usageError is an error in the command line.
+type usageError struct{ msg string }
+
+func (e usageError) Error() string { return e.msg }
+
+// usagef returns a usageError with a message formatted as fmt.Sprintf does.
+func usagef(format string, args ...any) error {
+	return usageError{fmt.Sprintf(format, args...)}
+}
+
+// exitCode returns the exit status for err, returned by a command.
+func exitCode(err error) int {
+	var usage usageError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &usage):
+		return exitUsage
+	case errors.Is(err, client.ErrBadRequest):
+		return exitBadRequest
+	case errors.Is(err, client.ErrUnauthorized):
+		return exitUnauthorized
+	case errors.Is(err, client.ErrNotFound):
+		return exitNotFound
+	case errors.Is(err, client.ErrConflict):
+		return exitConflict
+	case errors.Is(err, client.ErrUnavailable):
+		return exitUnavailable
+	default:
+		return exitFailure
+	}
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:], os.Getenv, os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// run runs simctl with the given arguments, without the program name, and
+// environment, writing results to stdout and errors to stderr, and returns
+// the exit status.
+func run(ctx context.Context, args []string, getenv func(string) string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("simctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	server := getenv(envServer)
+	if server == "" {
+		server = defaultServer
+	}
+	fs.StringVar(&server, "server", server, "URL of the simulator (env "+envServer+")")
+	apiKey := fs.String("api-key", getenv(envAPIKey), "API key to present (env "+envAPIKey+")")
+	cluster := fs.String("cluster", "", "cluster to address, instead of the default one")
+	format := fs.String("output", formatTable, "output format: table or json")
+	timeout := fs.Duration("timeout", client.DefaultTimeout, "timeout of each request")
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: simctl [flags] <command> [arguments]\n\nCommands:\n")
+		for _, cmd := range commands() {
+			fmt.Fprintf(stderr, "  %-30s %s\n", strings.TrimSpace(cmd.name+" "+cmd.args), cmd.summary)
+		}
+		fmt.Fprintf(stderr, "\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if *format != formatTable && *format != formatJSON {
+		fmt.Fprintf(stderr, "simctl: -output must be %s or %s, not %q\n", formatTable, formatJSON, *format)
+		return exitUsage
+	}
+
+	cmd, cmdArgs, ok := findCommand(fs.Args())
+	if !ok {
+		if fs.NArg() == 0 {
+			fmt.Fprintln(stderr, "simctl: no command given")
+		} else {
+			fmt.Fprintf(stderr, "simctl: unknown command %q\n", strings.Join(fs.Args(), " "))
+		}
+		fs.Usage()
+		return exitUsage
+	}
+
+	c, err := client.New(client.Config{BaseURL: server, APIKey: *apiKey, Timeout: *timeout})
+	if err != nil {
+		fmt.Fprintf(stderr, "simctl: %v\n", err)
+		return exitUsage
+	}
+	if *cluster != "" {
+		c = c.Cluster(*cluster)
+	}
+	e := &env{client: c, out: stdout, format: *format}
+	if err := cmd.run(ctx, e, cmdArgs); err != nil {
+		var usage usageError
+		if errors.As(err, &usage) {
+			fmt.Fprintf(stderr, "simctl %s: %v\nUsage: simctl %s %s\n", cmd.name, err, cmd.name, cmd.args)
+		} else {
+			fmt.Fprintf(stderr, "simctl %s: %v\n", cmd.name, err)
+		}
+		return exitCode(err)
+	}
+	return exitOK
+}
+
+// env is what a command runs with.
+type env struct {
+	client *client.Client
+	out    io.Writer
+	format string
+}
+
+// command is a subcommand of simctl.
+type command struct {
+	name    string // One or two words, such as "node fail".
+	args    string // Synopsis of the arguments, such as "ID".
+	summary string
+	run     func(ctx context.Context, e *env, args []string) error
+}
+
+// findCommand returns the command args name and the arguments after its
+// name. Two-word names take precedence over one-word ones.
+func findCommand(args []string) (command, []string, bool) {
+	for _, words := range []int{2, 1} {
+		if len(args) < words {
+			continue
+		}
+		name := strings.Join(args[:words], " ")
+		for _, cmd := range commands() {
+			if cmd.name == name {
+				return cmd, args[words:], true
+			}
+		}
+	}
+	return command{}, nil, false
+}
+
+// waitUntil waits until t or until ctx is done, returning ctx's error in
+// that case.
+func waitUntil(ctx context.Context, t time.Time) error {
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"DistributedSystemSimulator/simulator"
+)
+
+// testNodeCount is the number of nodes the simulators under test start with.
+const testNodeCount = 5
+
+// newTestServer returns the URL of an httptest server of a simulator created
+// from cfg, served with its full router, and the simulator.
+func newTestServer(t *testing.T, cfg simulator.Config) (string, *simulator.Simulator) {
+	t.Helper()
+	sim := simulator.New(cfg)
+	sim.Init(testNodeCount)
+	srv := httptest.NewServer(sim.Handler())
+	t.Cleanup(srv.Close)
+	t.Cleanup(sim.StopClusters)
+	return srv.URL, sim
+}
+
+// simctl runs simctl against the server at url with args and an empty
+// environment, and returns its exit status and output.
+func simctl(ctx context.Context, url string, args ...string) (code int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	args = append([]string{"-server", url}, args...)
+	code = run(ctx, args, func(string) string { return "" }, &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+// TestRun tests the global flags, finding the command, and the exit status
+// of errors.
+func TestRun(t *testing.T) {
+	url, _ := newTestServer(t, simulator.Config{Seed: 1, APIKey: "secret"})
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		args   []string
+		code   int
+		stderr string
+	}{
+		{nil, exitUsage, "no command given"},
+		{[]string{"nodes"}, exitUsage, `unknown command "nodes"`},
+		{[]string{"-output", "yaml", "stats"}, exitUsage, "-output must be"},
+		{[]string{"-bogus", "stats"}, exitUsage, "flag provided but not defined"},
+		{[]string{"-h"}, exitOK, "scenario run [-tick D] FILE"},
+		{[]string{"-api-key", "secret", "node", "fail", "x"}, exitUsage, "Usage: simctl node fail ID"},
+		{[]string{"-api-key", "secret", "node", "fail", "1", "2"}, exitUsage, "expected 1 arguments"},
+		{[]string{"node", "fail", "1"}, exitUnauthorized, "API key"},
+		{[]string{"-api-key", "secret", "node", "get", "99"}, exitNotFound, "Node not found"},
+		{[]string{"-api-key", "secret", "-cluster", "missing", "stats"}, exitNotFound, ""},
+	} {
+		code, _, stderr := simctl(ctx, url, tt.args...)
+		if code != tt.code || !strings.Contains(stderr, tt.stderr) {
+			t.Errorf("%q: expected %d and %q, got %d and %q", tt.args, tt.code, tt.stderr, code, stderr)
+		}
+	}
+
+	// An unreachable server is a plain failure.
+	if code, _, _ := simctl(ctx, "http://127.0.0.1:1", "-timeout", "100ms", "stats"); code != exitFailure {
+		t.Errorf("Expected an unreachable server to fail, got %d", code)
+	}
+}
+
+// TestEnvironment tests that the server and API key default to the
+// environment.
+func TestEnvironment(t *testing.T) {
+	url, _ := newTestServer(t, simulator.Config{Seed: 1, APIKey: "secret"})
+	env := map[string]string{envServer: url, envAPIKey: "secret"}
+	var out, errOut bytes.Buffer
+	code := run(context.Background(), []string{"node", "fail", "1"}, func(key string) string { return env[key] }, &out, &errOut)
+	if code != exitOK || !strings.Contains(out.String(), "down") {
+		t.Errorf("Expected node 1 to fail, got %d %q %q", code, out.String(), errOut.String())
+	}
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"DistributedSystemSimulator/simulator"
+)
+
+// Sources of an option's value, from the lowest precedence to the highest.
+const (
+	sourceDefault = "default"
+	sourceFile    = "file"
+	sourceFlag    = "flag"
+	sourceEnv     = "env"
+)
+
+// redacted replaces the values of secretOptions in GET /config.
+const redacted = "[redacted]"
+
+// secretOptions are the options whose values GET /config doesn't show.
+var secretOptions = map[string]bool{"api-key": true}
+
+// envNames are the environment variables of the options that aren't named
+// after them; see envName.
+var envNames = map[string]string{"nodes": "SIM_NODE_COUNT"}
+
+// envName returns the environment variable that sets the option name:
+// SIM_ followed by the name in upper case with dashes replaced by
+// underscores, such as SIM_FAIL_PROB for -fail-prob.
+func envName(name string) string {
+	if env, ok := envNames[name]; ok {
+		return env
+	}
+	return "SIM_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// listValue is a flag.Value holding a comma-separated list, without its
+// empty items.
+type listValue []string
+
+func (l *listValue) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listValue) Set(list string) error {
+	*l = nil
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// configEntry is an option set by a config file.
+type configEntry struct {
+	key, value string
+	line       int
+}
+
+// readConfigFile reads the options set by the config file at path: a JSON
+// object, or a YAML mapping if the file's extension is .yaml or .yml, of
+// option names, as the flags are named, to their values.
+func readConfigFile(path string) ([]configEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []configEntry
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		entries, err = parseYAMLConfig(data)
+	default:
+		entries, err = parseJSONConfig(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return entries, nil
+}
+
+// parseJSONConfig parses a config file holding a JSON object whose values
+// are strings, numbers, or booleans.
+func parseJSONConfig(data []byte) ([]configEntry, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil, fmt.Errorf("line %d: expected a JSON object", lineAt(data, 0))
+	}
+	var entries []configEntry
+	for decoder.More() {
+		line := lineAt(data, decoder.InputOffset())
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		key := token.(string)
+		token, err = decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		var value string
+		switch v := token.(type) {
+		case string:
+			value = v
+		case json.Number:
+			value = v.String()
+		case bool:
+			value = strconv.FormatBool(v)
+		default:
+			return nil, fmt.Errorf("line %d: the value of %q must be a string, number, or boolean", line, key)
+		}
+		entries = append(entries, configEntry{key: key, value: value, line: line})
+	}
+	if _, err := decoder.Token(); err != nil {
+		return nil, fmt.Errorf("line %d: %w", lineAt(data, decoder.InputOffset()), err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("line %d: unexpected data after the JSON object", lineAt(data, decoder.InputOffset()))
+	}
+	return entries, nil
+}
+
+// parseYAMLConfig parses a config file holding a YAML mapping of keys to
+// plain or quoted scalars, one per line, such as
+//
+//	# Five nodes failing now and then.
+//	nodes: 5
+//	fail-prob: 0.05
+//	message-latency: "intra-zone=1ms,inter-region=80ms"
+//
+// Nested mappings, sequences, and multi-line values aren't supported.
+func parseYAMLConfig(data []byte) ([]configEntry, error) {
+	var entries []configEntry
+	for i, text := range strings.Split(string(data), "\n") {
+		line := i + 1
+		text = strings.TrimRight(text, " \t\r")
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || (i == 0 && trimmed == "---") {
+			continue
+		}
+		if text[0] == ' ' || text[0] == '\t' {
+			return nil, fmt.Errorf("line %d: nested values are not supported", line)
+		}
+		key, value, ok := strings.Cut(text, ":")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t\"'") {
+			return nil, fmt.Errorf("line %d: expected key: value", line)
+		}
+		value, err := yamlScalar(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: the value of %q %v", line, key, err)
+		}
+		entries = append(entries, configEntry{key: key, value: value, line: line})
+	}
+	return entries, nil
+}
+
+// yamlScalar returns the value of the YAML scalar s, which is quoted or
+// plain and may be followed by a comment.
+func yamlScalar(s string) (string, error) {
+	switch {
+	case s == "" || strings.HasPrefix(s, "#"):
+		return "", errors.New("is missing; nested values are not supported")
+	case s[0] == '"':
+		// Double-quoted scalars take Go's escapes, which cover YAML's
+		// common ones.
+		end := 1
+		for end < len(s) && s[end] != '"' {
+			if s[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(s) {
+			return "", errors.New("has no closing quote")
+		}
+		if rest := strings.TrimSpace(s[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", errors.New("has text after the closing quote")
+		}
+		return strconv.Unquote(s[:end+1])
+	case s[0] == '\'':
+		var b strings.Builder
+		for i := 1; i < len(s); i++ {
+			if s[i] != '\'' {
+				b.WriteByte(s[i])
+				continue
+			}
+			if i+1 < len(s) && s[i+1] == '\'' {
+				b.WriteByte('\'')
+				i++
+				continue
+			}
+			if rest := strings.TrimSpace(s[i+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+				return "", errors.New("has text after the closing quote")
+			}
+			return b.String(), nil
+		}
+		return "", errors.New("has no closing quote")
+	case strings.ContainsRune("[{|>&*!", rune(s[0])):
+		return "", errors.New("must be a plain or quoted scalar")
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	return s, nil
+}
+
+// lineAt returns the line of data, counting from 1, that the JSON token
+// after offset starts on.
+func lineAt(data []byte, offset int64) int {
+	for offset < int64(len(data)) && bytes.IndexByte([]byte(" \t\r\n,:"), data[offset]) >= 0 {
+		offset++
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+// optionSource is where an option's value came from.
+type optionSource struct {
+	kind  string // sourceDefault, sourceFile, sourceFlag, or sourceEnv.
+	where string // The flag, file line, or environment variable that set it, or "" for the default.
+}
+
+// invalid returns an error saying why the value of the option key was
+// rejected, naming where it came from unless it is the default.
+func invalid(sources map[string]optionSource, key, format string, args ...any) error {
+	reason := fmt.Sprintf(format, args...)
+	if where := sources[key].where; where != "" {
+		return fmt.Errorf("invalid %s: %s", where, reason)
+	}
+	return errors.New(reason)
+}
+
+// applySources sets the options of fs that weren't set by a flag from the
+// config file at path, if there is one, and then every option whose
+// environment variable is set from that, so the environment takes
+// precedence over the flags, and the flags over the file. It returns where
+// each option's value came from. Unknown keys and invalid values are
+// reported with the file's line or the environment variable.
+func applySources(fs *flag.FlagSet, path string, getenv func(string) string) (map[string]optionSource, error) {
+	sources := make(map[string]optionSource)
+	fs.VisitAll(func(f *flag.Flag) { sources[f.Name] = optionSource{kind: sourceDefault} })
+	fs.Visit(func(f *flag.Flag) { sources[f.Name] = optionSource{kind: sourceFlag, where: "-" + f.Name} })
+
+	if path != "" {
+		entries, err := readConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+		seen := make(map[string]bool)
+		for _, e := range entries {
+			switch {
+			case e.key == "config" || fs.Lookup(e.key) == nil:
+				return nil, fmt.Errorf("%s: line %d: unknown key %q", path, e.line, e.key)
+			case seen[e.key]:
+				return nil, fmt.Errorf("%s: line %d: duplicate key %q", path, e.line, e.key)
+			}
+			seen[e.key] = true
+			if sources[e.key].kind == sourceFlag {
+				continue
+			}
+			if err := fs.Set(e.key, e.value); err != nil {
+				return nil, fmt.Errorf("%s: line %d: invalid value %q for key %q: %v", path, e.line, e.value, e.key, err)
+			}
+			sources[e.key] = optionSource{kind: sourceFile, where: fmt.Sprintf("%s in %s at line %d", e.key, path, e.line)}
+		}
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		env := envName(f.Name)
+		value := getenv(env)
+		if err != nil || f.Name == "config" || value == "" {
+			return
+		}
+		if serr := fs.Set(f.Name, value); serr != nil {
+			err = fmt.Errorf("invalid %s %q: %v", env, value, serr)
+			return
+		}
+		sources[f.Name] = optionSource{kind: sourceEnv, where: env}
+	})
+	return sources, err
+}
+
+// settings returns the effective value of every option of fs and where it
+// came from, with the values of secretOptions redacted.
+func settings(fs *flag.FlagSet, sources map[string]optionSource) map[string]simulator.Setting {
+	effective := make(map[string]simulator.Setting)
+	fs.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if secretOptions[f.Name] && value != "" {
+			value = redacted
+		}
+		effective[f.Name] = simulator.Setting{Value: value, Source: sources[f.Name].kind}
+	})
+	return effective
+}
+
+// reloadSettings returns a simulator.Config.Reload that parses args and the
+// environment variables getenv returns again, re-reading the -config file,
+// and returns the resulting settings. A -scenario file whose timeline no
+// longer matches scenario, the one loaded at startup, is logged, as a new
+// timeline only takes effect on restart.
+func reloadSettings(args []string, getenv func(string) string, scenario *simulator.Scenario) func() (map[string]simulator.Setting, error) {
+	var mu sync.Mutex
+	return func() (map[string]simulator.Setting, error) {
+		opts, err := parseOptions(args, getenv)
+		if err != nil {
+			return nil, err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if !reflect.DeepEqual(opts.scenario, scenario) {
+			slog.Warn("scenario changed; the new timeline takes effect on restart", "scenario", opts.settings["scenario"].Value)
+			scenario = opts.scenario
+		}
+		return opts.settings, nil
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"DistributedSystemSimulator/simulator"
+)
+
+// writeConfig writes content to a file named name in a temporary directory
+// and returns its path.
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+	return path
+}
+
+// TestParseConfigFile tests that a YAML or JSON config file sets options,
+// that flags override it and the environment overrides both, and that the
+// settings record where each value came from.
+func TestParseConfigFile(t *testing.T) {
+	files := map[string]string{
+		"sim.yaml": `---
+# A small, flaky cluster.
+nodes: 8
+seed: 42
+fail-prob: 0.2 # Overridden by SIM_FAIL_PROB.
+update-interval: "2s"
+split-brain: true
+cors-origins: 'http://a.test, http://b.test'
+api-key: hush
+`,
+		"sim.json": `{
+	"nodes": 8,
+	"seed": "42",
+	"fail-prob": 0.2,
+	"update-interval": "2s",
+	"split-brain": true,
+	"cors-origins": "http://a.test, http://b.test",
+	"api-key": "hush"
+}`,
+	}
+	env := map[string]string{"SIM_FAIL_PROB": "0.5"}
+	for name, content := range files {
+		path := writeConfig(t, name, content)
+		opts, err := parseOptions([]string{"-config=" + path, "-seed=43"}, func(key string) string { return env[key] })
+		if err != nil {
+			t.Fatalf("%s: parseOptions failed: %v", name, err)
+		}
+		if opts.nodes != 8 || opts.seed != 43 || opts.failProb != 0.5 || opts.updateInterval != 2*time.Second || !opts.splitBrain || opts.apiKey != "hush" {
+			t.Errorf("%s: expected the merged options, got %+v", name, opts)
+		}
+		if want := []string{"http://a.test", "http://b.test"}; !slices.Equal(opts.corsOrigins, want) {
+			t.Errorf("%s: expected origins %q, got %q", name, want, opts.corsOrigins)
+		}
+
+		for key, want := range map[string]simulator.Setting{
+			"nodes":     {Value: "8", Source: sourceFile},
+			"seed":      {Value: "43", Source: sourceFlag},
+			"fail-prob": {Value: "0.5", Source: sourceEnv},
+			"api-key":   {Value: redacted, Source: sourceFile},
+			"r":         {Value: "2", Source: sourceDefault},
+			"config":    {Value: path, Source: sourceFlag},
+		} {
+			if got := opts.settings[key]; got != want {
+				t.Errorf("%s: expected %s to be %+v, got %+v", name, key, want, got)
+			}
+		}
+	}
+}
+
+// TestParseConfigFileErrors tests that invalid config files and environment
+// variables are rejected, naming the key, value, or line at fault.
+func TestParseConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name, file, content string
+		env                 map[string]string
+		want                string
+	}{
+		{"unknown key", "sim.yaml", "nodes: 3\nshards: 4\n", nil, `line 2: unknown key "shards"`},
+		{"duplicate key", "sim.json", "{\"nodes\": 3,\n\"nodes\": 4}", nil, `line 2: duplicate key "nodes"`},
+		{"bad value", "sim.yaml", "\nupdate-interval: soon\n", nil, `line 2: invalid value "soon" for key "update-interval"`},
+		{"out of range", "sim.json", "{\n  \"fail-prob\": 1.5\n}", nil, "invalid fail-prob in "},
+		{"nested", "sim.yaml", "retry:\n  attempts: 3\n", nil, `line 1: the value of "retry" is missing; nested values are not supported`},
+		{"indented", "sim.yaml", "nodes: 3\n  seed: 4\n", nil, "line 2: nested values are not supported"},
+		{"unquoted", "sim.yaml", "mode: 'raft\n", nil, "line 1: the value of \"mode\" has no closing quote"},
+		{"not an object", "sim.json", "[1, 2]", nil, "line 1: expected a JSON object"},
+		{"nested JSON", "sim.json", "{\"regions\": {\"us\": 3}}", nil, `the value of "regions" must be a string, number, or boolean`},
+		{"missing", "", "", nil, "no such file"},
+		{"bad env", "sim.yaml", "nodes: 3\n", map[string]string{"SIM_UPDATERS": "many"}, `invalid SIM_UPDATERS "many"`},
+		{"env out of range", "sim.yaml", "nodes: 3\n", map[string]string{"SIM_R": "9"}, "invalid SIM_R: read quorum"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "missing.yaml")
+		if tt.file != "" {
+			path = writeConfig(t, tt.file, tt.content)
+		}
+		_, err := parseOptions([]string{"-config=" + path}, func(key string) string { return tt.env[key] })
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+// TestReloadOnHangup tests that run reloads the config file on SIGHUP and
+// on POST /config/reload, applying the runtime-tunable settings that changed,
+// and that a file that no longer parses changes nothing.
+func TestReloadOnHangup(t *testing.T) {
+	path := writeConfig(t, "sim.yaml", "nodes: 3\nfail-prob: 0.1\nupdate-interval: 5s\n")
+	args := []string{"-config=" + path}
+	getenv := func(string) string { return "" }
+	opts, err := parseOptions(args, getenv)
+	if err != nil {
+		t.Fatalf("parseOptions failed: %v", err)
+	}
+	sim := simulator.New(simulator.Config{
+		FailProb:       opts.failProb,
+		UpdateInterval: opts.updateInterval,
+		Settings:       opts.settings,
+		Reload:         reloadSettings(args, getenv, opts.scenario),
+	})
+	sim.Init(opts.nodes)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- run(ctx, sim, listeners{http: ln})
+	}()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("run returned an error: %v", err)
+		}
+	}()
+	base := "http://" + ln.Addr().String()
+	resp, err := http.Get(base + "/healthz")
+	if err != nil {
+		t.Fatalf("Failed to reach the server: %v", err)
+	}
+	resp.Body.Close()
+
+	// A hangup applies the new tunables.
+	if err := os.WriteFile(path, []byte("nodes: 9\nfail-prob: 0.3\nupdate-interval: 1s\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	self, _ := os.FindProcess(os.Getpid())
+	if err := self.Signal(syscall.SIGHUP); err != nil {
+		t.Fatalf("Failed to send SIGHUP: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for sim.Tunables().FailProb != 0.3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected fail-prob 0.3 after SIGHUP, got %+v", sim.Tunables())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := sim.UpdateInterval(); got != time.Second {
+		t.Errorf("Expected an update interval of 1s, got %v", got)
+	}
+	resp, err = http.Get(base + "/config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var settings map[string]simulator.Setting
+	json.NewDecoder(resp.Body).Decode(&settings)
+	resp.Body.Close()
+	if got := settings["fail-prob"]; got != (simulator.Setting{Value: "0.3", Source: sourceFile}) {
+		t.Errorf("Expected the reloaded fail-prob from the file, got %+v", got)
+	}
+	if got := settings["nodes"]; got.Value != "3" {
+		t.Errorf("Expected the node count to wait for a restart, got %+v", got)
+	}
+
+	// POST /config/reload reports what changed.
+	if err := os.WriteFile(path, []byte("nodes: 9\nfail-prob: 0.3\nupdate-interval: 1s\njitter: 5ms\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = http.Post(base+"/config/reload", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result simulator.ReloadResult
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(result.Applied) != 1 || result.Applied[0].Key != "jitter" || len(result.Ignored) != 1 || result.Ignored[0] != (simulator.SettingChange{Key: "nodes", From: "3", To: "9", Source: sourceFile}) {
+		t.Errorf("Expected jitter applied and nodes ignored, got %d %+v", resp.StatusCode, result)
+	}
+
+	// A file that no longer parses leaves the running config untouched.
+	before := sim.Tunables()
+	if err := os.WriteFile(path, []byte("fail-prob: 0.9\nupdate-interval: soon\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = http.Post(base+"/config/reload", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Expected status %d for a broken file, got %d", http.StatusInternalServerError, resp.StatusCode)
+	}
+	if got := sim.Tunables(); got != before {
+		t.Errorf("Expected no change from a broken file, got %+v", got)
+	}
+}
@@ -0,0 +1,210 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// DefaultAntiEntropyBuckets is the number of digest buckets each node splits
+// its keys into when Config.AntiEntropyBuckets is unset.
+const DefaultAntiEntropyBuckets = 16
+
+// digestSize is the size in bytes of one bucket's hash in a digest.
+const digestSize = 8
+
+// ErrUnreachable means two nodes cannot exchange messages under the current
+// partition.
+var ErrUnreachable = errors.New("nodes cannot reach each other")
+
+// AntiEntropyResult is the outcome of reconciling two nodes' replicated keys.
+type AntiEntropyResult struct {
+	A               int   `json:"a"`
+	B               int   `json:"b"`
+	Keys            int   `json:"keys"`             // Keys both nodes are replicas of.
+	BucketsDiffered int   `json:"buckets_differed"` // Buckets whose hashes did not match.
+	KeysTransferred int   `json:"keys_transferred"` // Keys copied from one node to the other.
+	BytesSent       int64 `json:"bytes_sent"`       // Digests plus the keys of differing buckets.
+	BytesFullSync   int64 `json:"bytes_full_sync"`  // What sending every shared key both ways would cost.
+	BytesSaved      int64 `json:"bytes_saved"`      // BytesFullSync minus BytesSent.
+}
+
+// AntiEntropyStats totals the anti-entropy reconciliations performed.
+type AntiEntropyStats struct {
+	Buckets         int   `json:"buckets"`
+	Comparisons     int   `json:"comparisons"` // Node pairs whose digests were compared.
+	BucketsDiffered int   `json:"buckets_differed"`
+	KeysTransferred int   `json:"keys_transferred"`
+	BytesSent       int64 `json:"bytes_sent"`
+	BytesFullSync   int64 `json:"bytes_full_sync"`
+	BytesSaved      int64 `json:"bytes_saved"`
+}
+
+// StartAntiEntropy runs an anti-entropy round once per interval until ctx is
+// cancelled. It blocks, so callers typically run it in its own goroutine.
+func (s *Simulator) StartAntiEntropy(ctx context.Context, interval time.Duration) {
+	ticker := s.cfg.Clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			s.AntiEntropyRound()
+		}
+	}
+}
+
+// AntiEntropyRound has every up node pick a random up peer it can reach and
+// reconcile the keys they are both replicas of, unless the digest message is
+// lost. It returns the number of keys transferred.
+func (s *Simulator) AntiEntropyRound() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	up := s.indicesWithStatus(StatusUp)
+	peers := make([]int, 0, len(up))
+	transferred := 0
+	for _, i := range up {
+		a := s.nodes[i].ID
+		peers = peers[:0]
+		for _, j := range up {
+			if b := s.nodes[j].ID; b != a && s.reachable(a, b) {
+				peers = append(peers, b)
+			}
+		}
+		if len(peers) == 0 {
+			continue
+		}
+		b := peers[s.rng.Intn(len(peers))]
+		if !s.deliver(a, b) {
+			continue
+		}
+		transferred += s.reconcile(a, b).KeysTransferred
+	}
+	return transferred
+}
+
+// Reconcile runs anti-entropy between the nodes with IDs a and b. It returns
+// ErrNodeNotFound, ErrNodeDown, or ErrUnreachable if they cannot reconcile.
+func (s *Simulator) Reconcile(a, b int) (AntiEntropyResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range []int{a, b} {
+		if _, err := s.upNode(id); err != nil {
+			return AntiEntropyResult{}, err
+		}
+	}
+	if !s.reachable(a, b) {
+		return AntiEntropyResult{}, ErrUnreachable
+	}
+	return s.reconcile(a, b), nil
+}
+
+// reconcile exchanges bucket digests of the keys a and b are both replicas
+// of and, for each bucket whose hashes differ, copies the newer version of
+// every key in it to the other node, unless it fails checksum verification.
+// Buckets that match are not sent. The caller must hold s.mu for writing.
+func (s *Simulator) reconcile(a, b int) AntiEntropyResult {
+	buckets := s.cfg.AntiEntropyBuckets
+	result := AntiEntropyResult{A: a, B: b, BytesSent: int64(2 * buckets * digestSize)}
+
+	// kvKeys is sorted, so every bucket is too.
+	keys := make([][]string, buckets)
+	for _, key := range s.kvKeys() {
+		replicas := s.preferenceList(key, s.cfg.N)
+		if !slices.Contains(replicas, a) || !slices.Contains(replicas, b) {
+			continue
+		}
+		bucket := hashString(key) % uint64(buckets)
+		keys[bucket] = append(keys[bucket], key)
+		result.Keys++
+		for _, id := range []int{a, b} {
+			if entry, ok := s.replicaData[id][key]; ok {
+				result.BytesFullSync += entrySize(key, entry)
+			}
+		}
+	}
+
+	now := s.cfg.Clock.Now()
+	for _, bucket := range keys {
+		if s.bucketDigest(a, bucket) == s.bucketDigest(b, bucket) {
+			continue
+		}
+		result.BucketsDiffered++
+		for _, key := range bucket {
+			ea, okA := s.replicaData[a][key]
+			eb, okB := s.replicaData[b][key]
+			if okA {
+				result.BytesSent += entrySize(key, ea)
+			}
+			if okB {
+				result.BytesSent += entrySize(key, eb)
+			}
+			switch {
+			case okA && s.wants(b, key, ea, now):
+				if s.intact(b, key, ea) {
+					s.storeReplica(b, key, ea)
+					result.KeysTransferred++
+				}
+			case okB && s.wants(a, key, eb, now):
+				if s.intact(a, key, eb) {
+					s.storeReplica(a, key, eb)
+					result.KeysTransferred++
+				}
+			}
+		}
+	}
+	result.BytesSaved = result.BytesFullSync - result.BytesSent
+
+	stats := &s.antiEntropy
+	stats.Comparisons++
+	stats.BucketsDiffered += result.BucketsDiffered
+	stats.KeysTransferred += result.KeysTransferred
+	stats.BytesSent += result.BytesSent
+	stats.BytesFullSync += result.BytesFullSync
+	stats.BytesSaved += result.BytesSaved
+	if result.KeysTransferred > 0 {
+		s.logger.Debug("anti-entropy", "a", a, "b", b, "buckets_differed", result.BucketsDiffered, "keys_transferred", result.KeysTransferred)
+	}
+	return result
+}
+
+// bucketDigest hashes the keys in bucket, which must be sorted, that the
+// node with the given ID holds, together with their versions and whether
+// they are tombstones. The caller must hold s.mu.
+func (s *Simulator) bucketDigest(id int, bucket []string) uint64 {
+	h := fnv.New64a()
+	for _, key := range bucket {
+		if entry, ok := s.replicaData[id][key]; ok {
+			h.Write([]byte(key))
+			h.Write([]byte{0})
+			h.Write([]byte(strconv.FormatUint(entry.Version, 10)))
+			if entry.Deleted {
+				h.Write([]byte{'d'})
+			}
+			h.Write([]byte{0})
+		}
+	}
+	return h.Sum64()
+}
+
+// entrySize estimates the bytes needed to send key and entry to a peer.
+func entrySize(key string, entry KVEntry) int64 {
+	return int64(len(key) + len(entry.Value) + 8)
+}
+
+// AntiEntropyStats returns the totals of the reconciliations performed.
+func (s *Simulator) AntiEntropyStats() AntiEntropyStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := s.antiEntropy
+	stats.Buckets = s.cfg.AntiEntropyBuckets
+	return stats
+}
@@ -0,0 +1,106 @@
+package simulator
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// TestReconcile tests that reconciling two nodes that differ in a handful of
+// keys transfers only those keys.
+func TestReconcile(t *testing.T) {
+	s := New(Config{Seed: 1, N: testNodeCount, R: 1, W: testNodeCount, AntiEntropyBuckets: 32})
+	s.Init(testNodeCount)
+	for i := 0; i < 200; i++ {
+		if _, err := s.KVPut(fmt.Sprintf("key-%d", i), "v1"); err != nil {
+			t.Fatalf("KVPut failed: %v", err)
+		}
+	}
+
+	// Node 1 gets three newer writes and node 0 loses two keys.
+	s.mu.Lock()
+	for _, key := range []string{"key-3", "key-50", "key-120"} {
+		entry := s.replicaData[1][key]
+		entry.Value, entry.Version = "v2", entry.Version+1000
+		s.replicaData[1][key] = entry
+	}
+	delete(s.replicaData[0], "key-7")
+	delete(s.replicaData[0], "key-99")
+	s.mu.Unlock()
+
+	result, err := s.Reconcile(0, 1)
+	if err != nil {
+		t.Fatalf("Reconcile failed: %v", err)
+	}
+	if result.Keys != 200 || result.KeysTransferred != 5 {
+		t.Errorf("Expected 5 of 200 keys to be transferred, got %+v", result)
+	}
+	if result.BucketsDiffered == 0 || result.BucketsDiffered > 5 {
+		t.Errorf("Expected between 1 and 5 differing buckets, got %d", result.BucketsDiffered)
+	}
+	if result.BytesSaved <= 0 || result.BytesSent+result.BytesSaved != result.BytesFullSync {
+		t.Errorf("Expected a digest sync to save bytes over a full sync, got %+v", result)
+	}
+
+	s.mu.RLock()
+	for _, key := range []string{"key-3", "key-7", "key-50", "key-99", "key-120"} {
+		if a, b := s.replicaData[0][key], s.replicaData[1][key]; a != b {
+			t.Errorf("Expected %s to match, got %+v and %+v", key, a, b)
+		}
+	}
+	if s.replicaData[0]["key-3"].Value != "v2" {
+		t.Errorf("Expected the newer version to win")
+	}
+	s.mu.RUnlock()
+
+	again, _ := s.Reconcile(0, 1)
+	if again.BucketsDiffered != 0 || again.KeysTransferred != 0 {
+		t.Errorf("Expected reconciled nodes to have matching digests, got %+v", again)
+	}
+
+	rr := doRequest(t, s.Handler(), "GET", "/antientropy/stats", "")
+	expectCode(t, rr, http.StatusOK)
+	var stats AntiEntropyStats
+	decodeBody(t, rr, &stats)
+	if stats.Buckets != 32 || stats.Comparisons != 2 || stats.KeysTransferred != 5 || stats.BytesSaved <= 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+// TestAntiEntropyRound tests that rounds bring a replica that missed writes
+// back in sync, and that only reachable up nodes reconcile.
+func TestAntiEntropyRound(t *testing.T) {
+	s := New(Config{Seed: 1, N: testNodeCount, R: 1, W: testNodeCount - 1})
+	s.Init(testNodeCount)
+	s.Fail(4)
+	for i := 0; i < 20; i++ {
+		if _, err := s.KVPut(fmt.Sprintf("key-%d", i), "v"); err != nil {
+			t.Fatalf("KVPut failed: %v", err)
+		}
+	}
+	if _, err := s.Reconcile(0, 4); !errors.Is(err, ErrNodeDown) {
+		t.Errorf("Expected ErrNodeDown, got %v", err)
+	}
+	s.Recover(4)
+
+	transferred := 0
+	for round := 0; round < 10; round++ {
+		transferred += s.AntiEntropyRound()
+	}
+	if transferred != 20 {
+		t.Errorf("Expected the 20 missed keys to be transferred, got %d", transferred)
+	}
+	s.mu.RLock()
+	if held := len(s.replicaData[4]); held != 20 {
+		t.Errorf("Expected node 4 to hold every key, got %d", held)
+	}
+	s.mu.RUnlock()
+
+	if err := s.SetPartition([][]int{{0, 1}, {2, 3, 4}}); err != nil {
+		t.Fatalf("SetPartition failed: %v", err)
+	}
+	if _, err := s.Reconcile(0, 4); !errors.Is(err, ErrUnreachable) {
+		t.Errorf("Expected ErrUnreachable, got %v", err)
+	}
+}
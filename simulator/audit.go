@@ -0,0 +1,232 @@
+package simulator
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultAuditLogSize is the number of entries the audit log retains, used
+// when Config.AuditLogSize is unset.
+const DefaultAuditLogSize = 1000
+
+const (
+	// auditBodyLimit is how much of a request body is read to summarize it.
+	auditBodyLimit = 4096
+
+	// auditSummaryLength bounds the length of a body summary.
+	auditSummaryLength = 256
+)
+
+// AuditEntry records one mutating HTTP request.
+type AuditEntry struct {
+	Seq        uint64    `json:"seq"` // Increases by one with every entry.
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	RequestID  string    `json:"request_id"`
+	RemoteAddr string    `json:"remote_addr"`
+	KeyID      string    `json:"key_id,omitempty"` // Fingerprint of the API key presented, if Config.APIKey is set.
+	Node       *int      `json:"node,omitempty"`   // ID of the node the path names, if any.
+	Body       string    `json:"body,omitempty"`   // The start of the body, with secrets redacted.
+	Status     int       `json:"status"`
+}
+
+// auditLog retains the latest audit entries, oldest first. It has its own
+// lock, so requests are audited without waiting for s.mu.
+type auditLog struct {
+	mu      sync.Mutex
+	seq     uint64
+	entries []AuditEntry
+}
+
+// AuditQuery selects audit entries. A zero field selects every entry.
+type AuditQuery struct {
+	Node  *int      // Only entries naming the node with this ID.
+	Since time.Time // Only entries from this time on.
+	Until time.Time // Only entries before this time.
+}
+
+// matches reports whether e is selected by q.
+func (q AuditQuery) matches(e AuditEntry) bool {
+	switch {
+	case q.Node != nil && (e.Node == nil || *e.Node != *q.Node):
+		return false
+	case !q.Since.IsZero() && e.Time.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && !e.Time.Before(q.Until):
+		return false
+	}
+	return true
+}
+
+// Audit returns the retained audit entries selected by q, oldest first.
+func (s *Simulator) Audit(q AuditQuery) []AuditEntry {
+	s.audit.mu.Lock()
+	defer s.audit.mu.Unlock()
+
+	entries := []AuditEntry{}
+	for _, e := range s.audit.entries {
+		if q.matches(e) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// record appends e to the audit log, evicting the oldest entry once
+// Config.AuditLogSize are retained, and writes it to Config.AuditWriter as
+// a line of JSON, if set.
+func (s *Simulator) record(e AuditEntry) {
+	s.audit.mu.Lock()
+	defer s.audit.mu.Unlock()
+
+	s.audit.seq++
+	e.Seq = s.audit.seq
+	if len(s.audit.entries) >= s.cfg.AuditLogSize {
+		s.audit.entries = append(s.audit.entries[:0], s.audit.entries[1:]...)
+	}
+	s.audit.entries = append(s.audit.entries, e)
+	if s.cfg.AuditWriter == nil {
+		return
+	}
+	line, err := json.Marshal(e)
+	if err == nil {
+		_, err = s.cfg.AuditWriter.Write(append(line, '\n'))
+	}
+	if err != nil {
+		s.logger.Error("failed to write audit entry", "seq", e.Seq, "err", err)
+	}
+}
+
+// withAudit records every mutating request passed to next in the audit log
+// once it has been served. The entry is recorded even if next panics, with
+// a 500 status unless next wrote one first.
+func (s *Simulator) withAudit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		e := AuditEntry{
+			Time:       time.Now(),
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			RequestID:  RequestIDFromContext(r.Context()),
+			RemoteAddr: r.RemoteAddr,
+			Node:       auditNode(r.URL.Path),
+		}
+		if s.cfg.APIKey != "" {
+			if key := presentedKey(r.Header.Get(APIKeyHeader), r.Header.Get("Authorization")); key != "" {
+				sum := sha256.Sum256([]byte(key))
+				e.KeyID = hex.EncodeToString(sum[:6])
+			}
+		}
+		// Read the start of the body now, so it is summarized even if next
+		// never reads it, and hand next the whole body.
+		if r.Body != nil {
+			head, _ := io.ReadAll(io.LimitReader(r.Body, auditBodyLimit+1))
+			e.Body = summarizeBody(head)
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+		}
+
+		rec := &statusRecorder{ResponseWriter: w}
+		defer func() {
+			e.Status = rec.code
+			if v := recover(); v != nil {
+				if e.Status == 0 {
+					e.Status = http.StatusInternalServerError
+				}
+				s.record(e)
+				panic(v)
+			}
+			if e.Status == 0 {
+				e.Status = http.StatusOK
+			}
+			s.record(e)
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// auditNode returns the ID of the node path names, as "/nodes/{id}" or
+// "/topics/{name}/subscribers/{id}" do, or nil if it names none.
+func auditNode(path string) *int {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 0; i+1 < len(segments); i++ {
+		if segments[i] != "nodes" && segments[i] != "subscribers" {
+			continue
+		}
+		if id, err := strconv.Atoi(segments[i+1]); err == nil {
+			return &id
+		}
+	}
+	return nil
+}
+
+// summarizeBody returns the start of a request body read up to
+// auditBodyLimit bytes past it. A complete JSON object is compacted, with
+// the value of any "secret" field redacted, and the summary is cut to
+// auditSummaryLength bytes.
+func summarizeBody(head []byte) string {
+	if len(head) <= auditBodyLimit {
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(head, &fields) == nil {
+			if _, ok := fields["secret"]; ok {
+				fields["secret"] = json.RawMessage(`"[redacted]"`)
+				head, _ = json.Marshal(fields)
+			}
+			var compact bytes.Buffer
+			if json.Compact(&compact, head) == nil {
+				head = compact.Bytes()
+			}
+		}
+	}
+	summary := strings.ToValidUTF8(string(head), "�")
+	if len(summary) > auditSummaryLength || len(head) > auditBodyLimit {
+		summary = strings.ToValidUTF8(summary[:min(len(summary), auditSummaryLength)], "") + "..."
+	}
+	return summary
+}
+
+// getAudit handles HTTP requests for the audit log with the optional query
+// parameters "node" (a node ID), and "since" and "until" (RFC 3339 times).
+func (s *Simulator) getAudit(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	var q AuditQuery
+	if v := values.Get("node"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Query parameter \"node\" must be a node ID")
+			return
+		}
+		q.Node = &id
+	}
+	for _, param := range []struct {
+		name string
+		t    *time.Time
+	}{{"since", &q.Since}, {"until", &q.Until}} {
+		if v := values.Get(param.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("Query parameter %q must be an RFC 3339 time", param.name))
+				return
+			}
+			*param.t = t
+		}
+	}
+	writeJSON(w, http.StatusOK, s.Audit(q))
+}
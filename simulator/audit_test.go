@@ -0,0 +1,134 @@
+package simulator
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestAudit tests that every mutating request, failed or not, is recorded
+// in the audit log and the audit writer, and that reads aren't.
+func TestAudit(t *testing.T) {
+	var written bytes.Buffer
+	s := New(Config{Seed: 1, APIKey: testAPIKey, AuditWriter: &written})
+	s.Init(testNodeCount)
+	h := s.Handler()
+	key := map[string]string{APIKeyHeader: testAPIKey, RequestIDHeader: "audit-1"}
+	sum := sha256.Sum256([]byte(testAPIKey))
+	keyID := hex.EncodeToString(sum[:6])
+
+	requests := []struct {
+		method, path, body string
+		header             map[string]string
+		status             int
+	}{
+		{"PUT", "/nodes/1", `{"name":"renamed", "value":7}`, key, http.StatusOK},
+		{"PUT", "/nodes/2", `{"name":"renamed","value":7}`, map[string]string{APIKeyHeader: "wrong"}, http.StatusUnauthorized},
+		{"PUT", "/nodes/9", `{"name":"renamed","value":7}`, key, http.StatusNotFound},
+		{"POST", "/nodes/3/fail", "", key, http.StatusOK},
+		{"PUT", "/nodes/3", `{"name":`, key, http.StatusBadRequest},
+		{"GET", "/nodes/1", "", key, http.StatusOK},
+		{"POST", "/webhooks", `{"url":"http://example.com/hook","secret":"hush"}`, key, http.StatusCreated},
+		{"DELETE", "/webhooks/7", "", nil, http.StatusUnauthorized},
+	}
+	for _, req := range requests {
+		if rr := authRequest(h, req.method, req.path, req.body, req.header); rr.Code != req.status {
+			t.Fatalf("%s %s: expected status %d, got %d: %s", req.method, req.path, req.status, rr.Code, rr.Body)
+		}
+	}
+
+	var entries []AuditEntry
+	decodeBody(t, doRequest(t, h, "GET", "/audit", ""), &entries)
+	var audited []int
+	for i, req := range requests {
+		if req.method != "GET" {
+			audited = append(audited, i)
+		}
+	}
+	if len(entries) != len(audited) {
+		t.Fatalf("Expected %d entries, got %+v", len(audited), entries)
+	}
+	for i, e := range entries {
+		req := requests[audited[i]]
+		if e.Seq != uint64(i+1) || e.Method != req.method || e.Path != req.path || e.Status != req.status {
+			t.Errorf("Entry %d: expected %s %s with %d, got %+v", i, req.method, req.path, req.status, e)
+		}
+	}
+	if e := entries[0]; e.RequestID != "audit-1" || e.KeyID != keyID || e.Node == nil || *e.Node != 1 || e.Body != `{"name":"renamed","value":7}` {
+		t.Errorf("Expected the first write with its request ID, key, node, and body, got %+v", e)
+	}
+	if e := entries[1]; e.KeyID == "" || e.KeyID == keyID {
+		t.Errorf("Expected the wrong key fingerprinted apart from the right one, got %q", e.KeyID)
+	}
+	if e := entries[4]; e.Body != `{"name":` {
+		t.Errorf("Expected a malformed body kept as sent, got %q", e.Body)
+	}
+	if e := entries[5]; e.Node != nil || strings.Contains(e.Body, "hush") || !strings.Contains(e.Body, `"secret":"[redacted]"`) {
+		t.Errorf("Expected the webhook secret redacted, got %+v", e)
+	}
+	if e := entries[6]; e.KeyID != "" {
+		t.Errorf("Expected no key ID without a key, got %q", e.KeyID)
+	}
+	if got, ok := s.Node(1); !ok || got.Name != "renamed" {
+		t.Errorf("Expected the audited write to reach the handler, got %+v", got)
+	}
+
+	// The writer receives the same entries, one per line.
+	lines := bufio.NewScanner(&written)
+	for i := 0; lines.Scan(); i++ {
+		var e AuditEntry
+		if err := json.Unmarshal(lines.Bytes(), &e); err != nil || i >= len(entries) || e.Seq != entries[i].Seq || e.Path != entries[i].Path {
+			t.Errorf("Line %d: expected entry %d, got %s (%v)", i, i+1, lines.Bytes(), err)
+		}
+	}
+
+	var filtered []AuditEntry
+	decodeBody(t, doRequest(t, h, "GET", "/audit?node=3", ""), &filtered)
+	if len(filtered) != 2 || filtered[0].Path != "/nodes/3/fail" || filtered[1].Status != http.StatusBadRequest {
+		t.Errorf("Expected the two requests naming node 3, got %+v", filtered)
+	}
+	until := url.QueryEscape(entries[2].Time.Format(time.RFC3339Nano))
+	decodeBody(t, doRequest(t, h, "GET", "/audit?until="+until, ""), &filtered)
+	if len(filtered) != 2 || filtered[1].Seq != 2 {
+		t.Errorf("Expected the two entries before the third, got %+v", filtered)
+	}
+	decodeBody(t, doRequest(t, h, "GET", "/audit?since="+until, ""), &filtered)
+	if len(filtered) != len(entries)-2 || filtered[0].Seq != 3 {
+		t.Errorf("Expected the entries from the third on, got %+v", filtered)
+	}
+	for _, query := range []string{"node=x", "since=yesterday", "until=1"} {
+		expectCode(t, doRequest(t, h, "GET", "/audit?"+query, ""), http.StatusBadRequest)
+	}
+}
+
+// TestAuditPanic tests that a request whose handler panics is still
+// audited.
+func TestAuditPanic(t *testing.T) {
+	s := New(Config{Seed: 1, AuditLogSize: 2})
+	h := s.withAudit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("handler failed")
+	}))
+
+	for i := 0; i < 3; i++ {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("Expected the panic to propagate")
+				}
+			}()
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/nodes/4/fail", nil))
+		}()
+	}
+	entries := s.Audit(AuditQuery{})
+	if len(entries) != 2 || entries[0].Seq != 2 || entries[1].Status != http.StatusInternalServerError || *entries[1].Node != 4 {
+		t.Errorf("Expected the last two failed requests, got %+v", entries)
+	}
+}
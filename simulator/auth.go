@@ -0,0 +1,112 @@
+package simulator
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"DistributedSystemSimulator/simulator/simulatorpb"
+)
+
+// APIKeyHeader is the header that carries the API key as an alternative to
+// an Authorization: Bearer header.
+const APIKeyHeader = "X-API-Key"
+
+// validKey reports whether key is the configured API key. The comparison
+// takes constant time so the key can't be guessed byte by byte.
+func (s *Simulator) validKey(key string) bool {
+	return key != "" && subtle.ConstantTimeCompare([]byte(key), []byte(s.cfg.APIKey)) == 1
+}
+
+// presentedKey returns the API key presented in the given X-API-Key and
+// Authorization header values, if any.
+func presentedKey(apiKey, authorization string) string {
+	if apiKey != "" {
+		return apiKey
+	}
+	if scheme, token, ok := strings.Cut(authorization, " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// needsKey reports whether a request with the given method and path must
+// present the API key: every mutating request does, and so does every read
+// except the health probes if Config.ProtectReads is set.
+func (s *Simulator) needsKey(method, path string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return s.cfg.ProtectReads && path != "/healthz" && path != "/readyz"
+	default:
+		return true
+	}
+}
+
+// withAuth rejects requests that need the API key but don't present it with
+// 401 Unauthorized. It does nothing unless Config.APIKey is set.
+func (s *Simulator) withAuth(next http.Handler) http.Handler {
+	if s.cfg.APIKey == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.needsKey(r.Method, r.URL.Path) && !s.validKey(presentedKey(r.Header.Get(APIKeyHeader), r.Header.Get("Authorization"))) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="simulator"`)
+			writeError(w, http.StatusUnauthorized, "Missing or invalid API key")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// grpcReadMethods are the gRPC methods that don't change the simulation.
+var grpcReadMethods = map[string]bool{
+	simulatorpb.Simulator_ListNodes_FullMethodName:  true,
+	simulatorpb.Simulator_GetNode_FullMethodName:    true,
+	simulatorpb.Simulator_WatchNodes_FullMethodName: true,
+}
+
+// authorizeGRPC applies the HTTP API's key requirements to a gRPC call of
+// the given method, reading the key from the "authorization" or "x-api-key"
+// metadata.
+func (s *Simulator) authorizeGRPC(ctx context.Context, method string) error {
+	if s.cfg.APIKey == "" || (grpcReadMethods[method] && !s.cfg.ProtectReads) {
+		return nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(name string) string {
+		if values := md.Get(name); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	if !s.validKey(presentedKey(first("x-api-key"), first("authorization"))) {
+		return status.Error(codes.Unauthenticated, "missing or invalid API key")
+	}
+	return nil
+}
+
+// grpcAuthInterceptors returns the server options that enforce the API key
+// on unary and streaming calls.
+func (s *Simulator) grpcAuthInterceptors() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := s.authorizeGRPC(ctx, info.FullMethod); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.ChainStreamInterceptor(func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := s.authorizeGRPC(ss.Context(), info.FullMethod); err != nil {
+				return err
+			}
+			return handler(srv, ss)
+		}),
+	}
+}
@@ -0,0 +1,103 @@
+package simulator
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+
+	"DistributedSystemSimulator/simulator/simulatorpb"
+)
+
+// testAPIKey is the API key configured in the authentication tests.
+const testAPIKey = "s3cret-key"
+
+// authRequest issues a request with the given headers.
+func authRequest(h http.Handler, method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+// TestAPIKey tests that mutating endpoints require the API key while read
+// endpoints stay open.
+func TestAPIKey(t *testing.T) {
+	s := New(Config{APIKey: testAPIKey})
+	s.Init(testNodeCount)
+	h := s.Handler()
+	body := `{"name":"renamed","value":1}`
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   int
+	}{
+		{"missing", nil, http.StatusUnauthorized},
+		{"wrong bearer", map[string]string{"Authorization": "Bearer nope"}, http.StatusUnauthorized},
+		{"wrong header", map[string]string{APIKeyHeader: "nope"}, http.StatusUnauthorized},
+		{"wrong scheme", map[string]string{"Authorization": "Basic " + testAPIKey}, http.StatusUnauthorized},
+		{"bearer", map[string]string{"Authorization": "Bearer " + testAPIKey}, http.StatusOK},
+		{"header", map[string]string{APIKeyHeader: testAPIKey}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		rr := authRequest(h, "PUT", "/nodes/1", body, tt.header)
+		if rr.Code != tt.want {
+			t.Errorf("%s: expected status code %d, got %d", tt.name, tt.want, rr.Code)
+		}
+		if tt.want == http.StatusUnauthorized && rr.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: expected a WWW-Authenticate header", tt.name)
+		}
+	}
+
+	if rr := authRequest(h, "GET", "/nodes", "", nil); rr.Code != http.StatusOK {
+		t.Errorf("Expected reads to stay open, got status code %d", rr.Code)
+	}
+}
+
+// TestAPIKeyProtectReads tests that ProtectReads requires the API key for
+// reads, except the health probes.
+func TestAPIKeyProtectReads(t *testing.T) {
+	s := New(Config{APIKey: testAPIKey, ProtectReads: true})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	for _, tt := range []struct {
+		path   string
+		header map[string]string
+		want   int
+	}{
+		{"/nodes", nil, http.StatusUnauthorized},
+		{"/nodes", map[string]string{"Authorization": "Bearer wrong"}, http.StatusUnauthorized},
+		{"/nodes", map[string]string{"Authorization": "Bearer " + testAPIKey}, http.StatusOK},
+		{"/healthz", nil, http.StatusOK},
+	} {
+		if rr := authRequest(h, "GET", tt.path, "", tt.header); rr.Code != tt.want {
+			t.Errorf("GET %s with %v: expected status code %d, got %d", tt.path, tt.header, tt.want, rr.Code)
+		}
+	}
+}
+
+// TestAPIKeyGRPC tests that the gRPC API enforces the same key.
+func TestAPIKeyGRPC(t *testing.T) {
+	s := New(Config{APIKey: testAPIKey})
+	s.Init(testNodeCount)
+	client := dialGRPC(t, s)
+	update := &simulatorpb.UpdateNodeRequest{Id: 1, Name: "renamed", Value: 1}
+
+	_, err := client.ListNodes(context.Background(), &simulatorpb.ListNodesRequest{})
+	expectGRPCCode(t, err, codes.OK)
+	_, err = client.UpdateNode(context.Background(), update)
+	expectGRPCCode(t, err, codes.Unauthenticated)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+testAPIKey)
+	_, err = client.UpdateNode(ctx, update)
+	expectGRPCCode(t, err, codes.OK)
+}
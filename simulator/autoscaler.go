@@ -0,0 +1,276 @@
+package simulator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+)
+
+// Defaults of the autoscaler, used for the zero fields of
+// Config.Autoscaler.
+const (
+	DefaultAutoscaleHigh     = 70 // Average CPU percent above which nodes are added.
+	DefaultAutoscaleLow      = 30 // Average CPU percent below which nodes are removed.
+	DefaultAutoscaleTicks    = 3
+	DefaultAutoscaleMin      = 1
+	DefaultAutoscaleMax      = 16
+	DefaultAutoscaleCooldown = 30 * time.Second
+)
+
+// maxAutoscaleDecisions is the number of decisions GET /autoscaler lists.
+const maxAutoscaleDecisions = 100
+
+// Actions taken by the autoscaler.
+const (
+	ScaleUp   = "scale-up"   // A node was added through the join protocol.
+	ScaleDown = "scale-down" // A node was removed through the leave protocol.
+)
+
+// ErrInvalidAutoscaler means the settings of the autoscaler were rejected.
+var ErrInvalidAutoscaler = errors.New("invalid autoscaler settings")
+
+// AutoscalerSettings configure the autoscaler, which adds a node when the
+// average CPU usage of the nodes has been over High for Ticks resource
+// rounds in a row, and removes one when it has been under Low as long,
+// keeping between Min and Max nodes and waiting Cooldown of simulation time
+// after each change before the next.
+type AutoscalerSettings struct {
+	Enabled  bool     `json:"enabled"`
+	High     float64  `json:"high"`  // Percent of one core.
+	Low      float64  `json:"low"`   // Percent of one core.
+	Ticks    int      `json:"ticks"` // Consecutive rounds over High or under Low.
+	Min      int      `json:"min"`
+	Max      int      `json:"max"`
+	Cooldown Duration `json:"cooldown"`
+}
+
+// withDefaults returns a with its zero fields set to the defaults.
+func (a AutoscalerSettings) withDefaults() AutoscalerSettings {
+	if a.High == 0 {
+		a.High = DefaultAutoscaleHigh
+	}
+	if a.Low == 0 {
+		a.Low = DefaultAutoscaleLow
+	}
+	if a.Ticks == 0 {
+		a.Ticks = DefaultAutoscaleTicks
+	}
+	if a.Min == 0 {
+		a.Min = DefaultAutoscaleMin
+	}
+	if a.Max == 0 {
+		a.Max = DefaultAutoscaleMax
+	}
+	if a.Cooldown == 0 {
+		a.Cooldown = Duration(DefaultAutoscaleCooldown)
+	}
+	return a
+}
+
+// validate returns an error wrapping ErrInvalidAutoscaler if a is invalid.
+func (a AutoscalerSettings) validate() error {
+	switch {
+	case a.Low < 0 || math.IsNaN(a.Low) || math.IsInf(a.Low, 0):
+		return fmt.Errorf("%w: low must be a non-negative number", ErrInvalidAutoscaler)
+	case !(a.High > a.Low) || math.IsInf(a.High, 0):
+		return fmt.Errorf("%w: high must be a number above low", ErrInvalidAutoscaler)
+	case a.Ticks < 1:
+		return fmt.Errorf("%w: ticks must be at least 1", ErrInvalidAutoscaler)
+	case a.Min < 1:
+		return fmt.Errorf("%w: min must be at least 1", ErrInvalidAutoscaler)
+	case a.Max < a.Min:
+		return fmt.Errorf("%w: max must be at least min", ErrInvalidAutoscaler)
+	case a.Cooldown < 0:
+		return fmt.Errorf("%w: cooldown must not be negative", ErrInvalidAutoscaler)
+	}
+	return nil
+}
+
+// AutoscaleDecision is a node the autoscaler added or removed.
+type AutoscaleDecision struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"` // ScaleUp or ScaleDown.
+	NodeID int       `json:"node_id"`
+	CPU    float64   `json:"cpu"`   // Average CPU usage that prompted it.
+	Nodes  int       `json:"nodes"` // Nodes the cluster was scaled to.
+}
+
+// AutoscalerStatus reports the settings and state of the autoscaler.
+type AutoscalerStatus struct {
+	AutoscalerSettings
+	Nodes     int     `json:"nodes"`      // Nodes counted against Min and Max: all but those leaving.
+	CPU       float64 `json:"cpu"`        // Average CPU usage at the last round.
+	HighTicks int     `json:"high_ticks"` // Rounds in a row the usage has been over High.
+	LowTicks  int     `json:"low_ticks"`  // Rounds in a row the usage has been under Low.
+
+	// CooldownRemaining is how much longer the autoscaler waits after its
+	// last decision before it makes another, or zero if it doesn't.
+	CooldownRemaining Duration `json:"cooldown_remaining"`
+
+	Decisions []AutoscaleDecision `json:"decisions"` // Most recent last.
+}
+
+// autoscaler is the state of the autoscaler.
+type autoscaler struct {
+	settings            AutoscalerSettings
+	cpu                 float64
+	highTicks, lowTicks int
+	last                time.Time // Time of the last decision, or zero before the first.
+	decisions           []AutoscaleDecision
+}
+
+// SetAutoscaler replaces the settings of the autoscaler, filling in zero
+// fields with the defaults. Disabling it forgets how many rounds in a row
+// the usage has been over or under the watermarks. It returns an error
+// wrapping ErrInvalidAutoscaler if settings is invalid.
+func (s *Simulator) SetAutoscaler(settings AutoscalerSettings) error {
+	settings = settings.withDefaults()
+	if err := settings.validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a := &s.autoscaler
+	a.settings = settings
+	if !settings.Enabled {
+		a.highTicks, a.lowTicks = 0, 0
+	}
+	s.logger.Info("autoscaler configured", "enabled", settings.Enabled, "high", settings.High, "low", settings.Low,
+		"ticks", settings.Ticks, "min", settings.Min, "max", settings.Max, "cooldown", time.Duration(settings.Cooldown))
+	return nil
+}
+
+// Autoscaler returns the settings and state of the autoscaler.
+func (s *Simulator) Autoscaler() AutoscalerStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	a := &s.autoscaler
+	status := AutoscalerStatus{
+		AutoscalerSettings: a.settings,
+		Nodes:              s.scaledNodes(),
+		CPU:                a.cpu,
+		HighTicks:          a.highTicks,
+		LowTicks:           a.lowTicks,
+		Decisions:          append([]AutoscaleDecision{}, a.decisions...),
+	}
+	if !a.last.IsZero() {
+		status.CooldownRemaining = Duration(max(time.Duration(a.settings.Cooldown)-s.cfg.Clock.Now().Sub(a.last), 0))
+	}
+	return status
+}
+
+// AutoscaleRound averages the CPU usage ResourceRound last sampled over the
+// active nodes that are up, and counts the rounds in a row it has been over
+// or under the watermarks. Once either count reaches Ticks, and the cooldown
+// since the last decision has passed, it adds a node through the join
+// protocol, or has the active node with the highest ID leave, unless that
+// would take the nodes past Max or Min. It returns the decision and true if
+// it made one. It does nothing while the autoscaler is disabled.
+// StartUpdater runs it after every ResourceRound.
+func (s *Simulator) AutoscaleRound() (AutoscaleDecision, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a := &s.autoscaler
+	if !a.settings.Enabled {
+		return AutoscaleDecision{}, false
+	}
+	var total float64
+	up := 0
+	for i := range s.nodes {
+		if n := &s.nodes[i]; n.Membership == MemberActive && n.Status == StatusUp {
+			total += n.Resources.CPU
+			up++
+		}
+	}
+	if up == 0 {
+		a.cpu, a.highTicks, a.lowTicks = 0, 0, 0
+		return AutoscaleDecision{}, false
+	}
+	a.cpu = total / float64(up)
+	switch {
+	case a.cpu > a.settings.High:
+		a.highTicks, a.lowTicks = a.highTicks+1, 0
+	case a.cpu < a.settings.Low:
+		a.highTicks, a.lowTicks = 0, a.lowTicks+1
+	default:
+		a.highTicks, a.lowTicks = 0, 0
+	}
+
+	now := s.cfg.Clock.Now()
+	if !a.last.IsZero() && now.Sub(a.last) < time.Duration(a.settings.Cooldown) {
+		return AutoscaleDecision{}, false
+	}
+	nodes := s.scaledNodes()
+	decision := AutoscaleDecision{Time: now, CPU: a.cpu}
+	switch {
+	case a.highTicks >= a.settings.Ticks && nodes < a.settings.Max:
+		node, _ := s.insertNode(fmt.Sprintf("Node-%d", s.nextID), s.rng.Intn(100), NodeMetadata{}, true)
+		decision.Action, decision.NodeID, decision.Nodes = ScaleUp, node.ID, nodes+1
+	case a.lowTicks >= a.settings.Ticks && nodes > a.settings.Min:
+		index := -1
+		for i := range s.nodes {
+			if s.nodes[i].Membership == MemberActive && (index < 0 || s.nodes[i].ID > s.nodes[index].ID) {
+				index = i
+			}
+		}
+		node, _, _, err := s.leave(index)
+		if err != nil {
+			return AutoscaleDecision{}, false
+		}
+		decision.Action, decision.NodeID, decision.Nodes = ScaleDown, node.ID, nodes-1
+	default:
+		return AutoscaleDecision{}, false
+	}
+
+	a.highTicks, a.lowTicks = 0, 0
+	a.last = now
+	a.decisions = append(a.decisions, decision)
+	if len(a.decisions) > maxAutoscaleDecisions {
+		a.decisions = a.decisions[len(a.decisions)-maxAutoscaleDecisions:]
+	}
+	s.logger.Info("autoscaler decision", "action", decision.Action, "node_id", decision.NodeID, "cpu", decision.CPU, "nodes", decision.Nodes)
+	return decision, true
+}
+
+// scaledNodes returns the number of nodes the autoscaler counts against its
+// bounds: all but those leaving. The caller must hold s.mu.
+func (s *Simulator) scaledNodes() int {
+	count := 0
+	for i := range s.nodes {
+		if s.nodes[i].Membership != MemberLeaving {
+			count++
+		}
+	}
+	return count
+}
+
+// getAutoscaler handles HTTP requests for the state of the autoscaler.
+func (s *Simulator) getAutoscaler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Autoscaler())
+}
+
+// patchAutoscaler handles HTTP requests to change the autoscaler from a body
+// like {"enabled":true,"high":80}. Fields left out keep their current
+// values.
+func (s *Simulator) patchAutoscaler(w http.ResponseWriter, r *http.Request) {
+	payload := s.Autoscaler().AutoscalerSettings
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "Malformed JSON body")
+		return
+	}
+
+	if err := s.SetAutoscaler(payload); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Autoscaler())
+}
@@ -0,0 +1,122 @@
+package simulator
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestAutoscaler tests that the node count follows synthetic load up to the
+// autoscaler's maximum and back down to its minimum, changing no sooner than
+// the cooldown allows.
+func TestAutoscaler(t *testing.T) {
+	clock := latencyClock(t)
+	s := New(Config{Clock: clock, Seed: 1, Autoscaler: AutoscalerSettings{
+		Enabled: true, High: 70, Low: 30, Ticks: 2, Min: 3, Max: 7, Cooldown: Duration(3 * time.Second),
+	}})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	for _, phase := range []struct {
+		rate  float64
+		nodes []int // Node count after each tick.
+	}{
+		// 600 requests a second keep 6 cores busy, 120% CPU on average
+		// over 5 nodes and 86% over 7: the second tick over High adds a
+		// node, the cooldown holds off the next until the fifth, and the
+		// maximum stops a third.
+		{600, []int{5, 6, 6, 6, 7, 7, 7, 7}},
+		// Under Low, nodes leave every cooldown down to the minimum.
+		{50, []int{7, 6, 6, 6, 5, 5, 5, 4, 4, 4, 3, 3, 3, 3}},
+	} {
+		if _, err := s.GenerateLoad(LoadGenSettings{Rate: phase.rate, Strategy: BalanceRoundRobin}); err != nil {
+			t.Fatalf("GenerateLoad failed: %v", err)
+		}
+		for i, want := range phase.nodes {
+			runLoadGen(t, s, clock, 1)
+			s.ResourceRound()
+			s.AutoscaleRound()
+			if got := len(s.Snapshot()); got != want {
+				t.Fatalf("Rate %v, tick %d: expected %d nodes, got %d", phase.rate, i+1, want, got)
+			}
+		}
+	}
+
+	var status AutoscalerStatus
+	rr := doRequest(t, h, "GET", "/autoscaler", "")
+	expectCode(t, rr, http.StatusOK)
+	decodeBody(t, rr, &status)
+	if status.Nodes != 3 || status.LowTicks != 3 || status.CooldownRemaining != Duration(0) || !status.Enabled {
+		t.Errorf("Unexpected status %+v", status)
+	}
+	if len(status.Decisions) != 6 {
+		t.Fatalf("Expected 6 decisions, got %+v", status.Decisions)
+	}
+	for i, d := range status.Decisions {
+		want := ScaleUp
+		if i >= 2 {
+			want = ScaleDown
+		}
+		if d.Action != want || (i > 0 && d.Time.Sub(status.Decisions[i-1].Time) < 3*time.Second) {
+			t.Errorf("Decision %d: expected a %s after the cooldown, got %+v", i, want, d)
+		}
+	}
+	if up, down := status.Decisions[1], status.Decisions[2]; up.NodeID != 6 || up.Nodes != 7 || down.NodeID != 6 || down.Nodes != 6 || down.CPU >= 30 {
+		t.Errorf("Expected node 6 added then first to leave, got %+v and %+v", up, down)
+	}
+
+	// A longer cooldown runs from the last decision, 3 ticks ago, however
+	// long the load has been over High.
+	if _, err := s.GenerateLoad(LoadGenSettings{Rate: 600, Strategy: BalanceRoundRobin}); err != nil {
+		t.Fatalf("GenerateLoad failed: %v", err)
+	}
+	expectCode(t, doRequest(t, h, "PATCH", "/autoscaler", `{"ticks":1,"cooldown":"10s"}`), http.StatusOK)
+	for i := 1; i <= 7; i++ {
+		runLoadGen(t, s, clock, 1)
+		s.ResourceRound()
+		d, ok := s.AutoscaleRound()
+		if ok != (i == 7) || ok && d.Action != ScaleUp {
+			t.Fatalf("Tick %d: unexpected decision %+v", i, d)
+		}
+		if got := s.Autoscaler(); i == 1 && (got.HighTicks != 1 || got.CooldownRemaining != Duration(6*time.Second)) {
+			t.Errorf("Expected 6s of cooldown left, got %+v", got)
+		}
+	}
+	if got := s.Autoscaler(); got.Nodes != 4 || got.CooldownRemaining != Duration(10*time.Second) {
+		t.Errorf("Expected a new cooldown, got %+v", got)
+	}
+
+	expectCode(t, doRequest(t, h, "PATCH", "/autoscaler", `{"high":20,"low":40}`), http.StatusBadRequest)
+	expectCode(t, doRequest(t, h, "PATCH", "/autoscaler", `{"enabled":false}`), http.StatusOK)
+	runLoadGen(t, s, clock, 10)
+	s.ResourceRound()
+	if d, ok := s.AutoscaleRound(); ok {
+		t.Errorf("Expected no decision while disabled, got %+v", d)
+	}
+}
+
+// TestAutoscalerSettings tests the defaults and validation of the autoscaler
+// settings.
+func TestAutoscalerSettings(t *testing.T) {
+	s := New(Config{Seed: 1})
+	got := s.Autoscaler().AutoscalerSettings
+	want := AutoscalerSettings{
+		High: DefaultAutoscaleHigh, Low: DefaultAutoscaleLow, Ticks: DefaultAutoscaleTicks,
+		Min: DefaultAutoscaleMin, Max: DefaultAutoscaleMax, Cooldown: Duration(DefaultAutoscaleCooldown),
+	}
+	if got != want {
+		t.Errorf("Expected the defaults %+v, got %+v", want, got)
+	}
+	for _, settings := range []AutoscalerSettings{
+		{High: 50, Low: 50},
+		{Low: -1},
+		{Ticks: -1},
+		{Min: 4, Max: 3},
+		{Cooldown: Duration(-time.Second)},
+	} {
+		if err := s.SetAutoscaler(settings); !errors.Is(err, ErrInvalidAutoscaler) {
+			t.Errorf("%+v: expected ErrInvalidAutoscaler, got %v", settings, err)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package simulator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// MaxBatchSize is the largest number of updates POST /nodes/batch accepts.
+const MaxBatchSize = 1000
+
+// Outcomes of one update in a batch.
+const (
+	BatchUpdated  = "updated"   // The node was updated.
+	BatchNotFound = "not_found" // No node has the given ID.
+	BatchInvalid  = "invalid"   // The update is missing a field or has an invalid one.
+	BatchSkipped  = "skipped"   // The update was valid, but an atomic batch was aborted.
+)
+
+// NodeUpdate is one update in a batch. Name is optional and left unchanged
+// when omitted.
+type NodeUpdate struct {
+	ID    *int    `json:"id"`
+	Value *int    `json:"value"`
+	Name  *string `json:"name,omitempty"`
+}
+
+// BatchItemResult is the outcome of one update in a batch.
+type BatchItemResult struct {
+	Index  int       `json:"index"` // Position of the update in the batch.
+	ID     *int      `json:"id"`
+	Status string    `json:"status"`          // One of the Batch outcome constants.
+	Error  string    `json:"error,omitempty"` // Why the update failed.
+	Node   *NodeData `json:"node,omitempty"`  // The node after the update.
+}
+
+// BatchResult is the outcome of a batch of updates.
+type BatchResult struct {
+	Results []BatchItemResult `json:"results"`
+	Updated int               `json:"updated"` // Number of nodes updated.
+	Failed  int               `json:"failed"`  // Number of updates that were not found or invalid.
+
+	// Error explains why an atomic batch was aborted. It is nil otherwise.
+	Error *APIError `json:"error,omitempty"`
+}
+
+// batchRequest is the object form of the JSON payload accepted by
+// batchUpdate. The payload may also be a bare array of updates.
+type batchRequest struct {
+	Atomic  bool         `json:"atomic"`
+	Updates []NodeUpdate `json:"updates"`
+}
+
+// validate returns why u cannot be applied, or "" if it can.
+func (u NodeUpdate) validate() string {
+	switch {
+	case u.ID == nil:
+		return "Field \"id\" is required"
+	case u.Value == nil:
+		return "Field \"value\" is required"
+	case u.Name != nil && *u.Name == "":
+		return "Field \"name\" must not be empty"
+	}
+	return ""
+}
+
+// BatchUpdate applies updates in order under a single acquisition of the
+// lock, so no reader observes a partially applied batch. Updates that are
+// invalid or name a missing node are reported and skipped. If atomic is true,
+// any such update aborts the batch and no node is changed; the result's
+// Error is then set and the valid updates are reported as BatchSkipped.
+func (s *Simulator) BatchUpdate(updates []NodeUpdate, atomic bool) BatchResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := BatchResult{Results: make([]BatchItemResult, len(updates))}
+	indexes := make([]int, len(updates))
+	for i, u := range updates {
+		item := BatchItemResult{Index: i, ID: u.ID}
+		if msg := u.validate(); msg != "" {
+			item.Status, item.Error = BatchInvalid, msg
+		} else if indexes[i] = s.findNode(*u.ID); indexes[i] < 0 {
+			item.Status, item.Error = BatchNotFound, "Node not found"
+		}
+		if item.Status != "" {
+			result.Failed++
+			if atomic && result.Error == nil {
+				result.Error = &APIError{
+					Code:    ErrorCodeBadRequest,
+					Message: fmt.Sprintf("Batch aborted: update %d: %s", i, item.Error),
+				}
+			}
+		}
+		result.Results[i] = item
+	}
+
+	for i, u := range updates {
+		item := &result.Results[i]
+		if item.Status != "" {
+			continue
+		}
+		if result.Error != nil {
+			item.Status = BatchSkipped
+			continue
+		}
+		node := &s.nodes[indexes[i]]
+		if u.Name != nil {
+			node.Name = *u.Name
+		}
+		node.Value = *u.Value
+		node.tick()
+		s.publish(EventNodeUpdated, indexes[i])
+		updated := node.clone()
+		item.Status, item.Node = BatchUpdated, &updated
+		result.Updated++
+	}
+
+	s.logger.Info("batch applied", "updated", result.Updated, "failed", result.Failed, "atomic", atomic)
+	return result
+}
+
+// batchUpdate handles HTTP requests to update many nodes at once from a body
+// that is either an array of updates or an object with "updates" and
+// "atomic" fields. It returns 200 with the outcome of every update, or 400
+// with the same outcomes and an error if an atomic batch was aborted.
+func (s *Simulator) batchUpdate(w http.ResponseWriter, r *http.Request) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		writeError(w, http.StatusBadRequest, "Malformed JSON body")
+		return
+	}
+	var payload batchRequest
+	target := interface{}(&payload)
+	if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("[")) {
+		target = &payload.Updates
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(target); err != nil {
+		writeError(w, http.StatusBadRequest, "Malformed JSON body")
+		return
+	}
+	if len(payload.Updates) == 0 {
+		writeError(w, http.StatusBadRequest, "The batch must contain at least one update")
+		return
+	}
+	if len(payload.Updates) > MaxBatchSize {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("The batch must contain at most %d updates", MaxBatchSize))
+		return
+	}
+
+	result := s.BatchUpdate(payload.Updates, payload.Atomic)
+	if result.Error != nil {
+		result.Error.RequestID = w.Header().Get(RequestIDHeader)
+		writeJSON(w, http.StatusBadRequest, result)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,133 @@
+package simulator
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// batchStatuses returns the status of every item in result.
+func batchStatuses(result BatchResult) []string {
+	statuses := make([]string, len(result.Results))
+	for i, item := range result.Results {
+		statuses[i] = item.Status
+	}
+	return statuses
+}
+
+// TestBatchUpdate tests that a mixed batch applies the valid updates and
+// reports the rest.
+func TestBatchUpdate(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	h := s.Handler()
+	before, _ := s.Node(1)
+
+	rr := doRequest(t, h, "POST", "/nodes/batch", `[
+		{"id": 0, "value": 10, "name": "renamed"},
+		{"id": 99, "value": 1},
+		{"id": 1},
+		{"value": 5},
+		{"id": 2, "value": 20, "name": ""},
+		{"id": 1, "value": 30}
+	]`)
+	expectCode(t, rr, http.StatusOK)
+	var result BatchResult
+	decodeBody(t, rr, &result)
+
+	want := []string{BatchUpdated, BatchNotFound, BatchInvalid, BatchInvalid, BatchInvalid, BatchUpdated}
+	if got := batchStatuses(result); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected statuses %v, got %v", want, got)
+	}
+	if result.Updated != 2 || result.Failed != 4 {
+		t.Errorf("Expected 2 updated and 4 failed, got %d and %d", result.Updated, result.Failed)
+	}
+	if result.Error != nil {
+		t.Errorf("Expected no error, got %+v", result.Error)
+	}
+	for i, item := range result.Results {
+		if item.Index != i {
+			t.Errorf("Item %d: expected index %d, got %d", i, i, item.Index)
+		}
+		if (item.Status == BatchUpdated) != (item.Node != nil) {
+			t.Errorf("Item %d: expected a node only for updates, got %+v", i, item)
+		}
+		if item.Status != BatchUpdated && item.Error == "" {
+			t.Errorf("Item %d: expected an error message", i)
+		}
+	}
+
+	if node, _ := s.Node(0); node.Name != "renamed" || node.Value != 10 {
+		t.Errorf("Expected node 0 to be renamed with value 10, got %+v", node)
+	}
+	if node, _ := s.Node(1); node.Name != before.Name || node.Value != 30 {
+		t.Errorf("Expected node 1 to keep its name and have value 30, got %+v", node)
+	}
+	if node, _ := s.Node(2); node.Value == 20 {
+		t.Errorf("Expected the invalid update to node 2 to be skipped, got %+v", node)
+	}
+}
+
+// TestBatchUpdateAtomic tests that an atomic batch with any failing update
+// changes nothing, while one without failures applies every update.
+func TestBatchUpdateAtomic(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	h := s.Handler()
+	before := s.Snapshot()
+	seq := s.EventHistory(0, MaxHistoryLimit).Next
+
+	rr := doRequest(t, h, "POST", "/nodes/batch", `{"atomic": true, "updates": [
+		{"id": 0, "value": 10},
+		{"id": 99, "value": 1},
+		{"id": 2, "value": 20}
+	]}`)
+	expectCode(t, rr, http.StatusBadRequest)
+	var result BatchResult
+	decodeBody(t, rr, &result)
+	if want := []string{BatchSkipped, BatchNotFound, BatchSkipped}; !reflect.DeepEqual(batchStatuses(result), want) {
+		t.Errorf("Expected statuses %v, got %v", want, batchStatuses(result))
+	}
+	if result.Error == nil || result.Error.Code != ErrorCodeBadRequest || !strings.Contains(result.Error.Message, "update 1") {
+		t.Errorf("Expected an error naming update 1, got %+v", result.Error)
+	}
+	if result.Updated != 0 {
+		t.Errorf("Expected no updates, got %d", result.Updated)
+	}
+	if after := s.Snapshot(); !reflect.DeepEqual(after, before) {
+		t.Errorf("Expected an aborted batch to change nothing")
+	}
+	if next := s.EventHistory(0, MaxHistoryLimit).Next; next != seq {
+		t.Errorf("Expected an aborted batch to publish no events, sequence moved from %d to %d", seq, next)
+	}
+
+	rr = doRequest(t, h, "POST", "/nodes/batch", `{"atomic": true, "updates": [
+		{"id": 0, "value": 10},
+		{"id": 2, "value": 20}
+	]}`)
+	expectCode(t, rr, http.StatusOK)
+	var applied BatchResult
+	decodeBody(t, rr, &applied)
+	if applied.Updated != 2 || applied.Error != nil {
+		t.Errorf("Expected both updates to apply, got %+v", applied)
+	}
+	for id, want := range map[int]int{0: 10, 2: 20} {
+		if node, _ := s.Node(id); node.Value != want {
+			t.Errorf("Expected node %d to have value %d, got %d", id, want, node.Value)
+		}
+	}
+}
+
+// TestBatchUpdateBadRequest tests that malformed, empty, and oversized
+// batches are rejected.
+func TestBatchUpdateBadRequest(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	oversized := "[" + strings.Repeat(`{"id":0,"value":1},`, MaxBatchSize) + `{"id":0,"value":1}]`
+	for _, body := range []string{`not json`, `[]`, `{"updates": []}`, `{"updates": [], "extra": 1}`, oversized} {
+		expectCode(t, doRequest(t, h, "POST", "/nodes/batch", body), http.StatusBadRequest)
+	}
+}
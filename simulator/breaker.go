@@ -0,0 +1,121 @@
+package simulator
+
+import (
+	"net/http"
+	"sort"
+	"time"
+)
+
+// States of the load generator's circuit breaker for a node.
+const (
+	BreakerClosed   = "closed"    // Requests go to the node.
+	BreakerOpen     = "open"      // Requests fail at once without reaching the node.
+	BreakerHalfOpen = "half-open" // The next request is a probe deciding whether to close.
+)
+
+// Defaults of the load generator's circuit breakers.
+const (
+	// DefaultBreakerThreshold is the number of consecutive failed requests
+	// to a node that open its breaker when LoadGenSettings.BreakerThreshold
+	// is unset.
+	DefaultBreakerThreshold = 5
+
+	// DefaultBreakerCooldown is how long a breaker stays open before it lets
+	// a probe through when LoadGenSettings.BreakerCooldown is unset.
+	DefaultBreakerCooldown = 5 * time.Second
+)
+
+// Breaker reports the state of the load generator's circuit breaker for one
+// node.
+type Breaker struct {
+	ID             int       `json:"id"`
+	State          string    `json:"state"`
+	Failures       int       `json:"failures"`        // Consecutive failed requests.
+	OpenedAt       time.Time `json:"opened_at"`       // When the breaker last opened, or zero if it never has.
+	Opens          uint64    `json:"opens"`           // Times the breaker has opened.
+	ShortCircuited uint64    `json:"short_circuited"` // Requests failed at once while the breaker was open.
+}
+
+// breaker is the circuit breaker the load generator keeps for one node.
+type breaker struct {
+	state    string
+	failures int
+	openedAt time.Time
+	opens    uint64
+}
+
+// setBreaker moves the breaker of the node with the given ID to state at
+// at, logging and counting the transition. The caller must hold s.mu for
+// writing.
+func (s *Simulator) setBreaker(id int, b *breaker, state string, at time.Time) {
+	s.logger.Info("circuit breaker changed", "id", id, "from", b.state, "to", state, "failures", b.failures)
+	if s.loadGen.transitions == nil {
+		s.loadGen.transitions = make(map[string]uint64)
+	}
+	s.loadGen.transitions[state]++
+	b.state = state
+	if state == BreakerOpen {
+		b.openedAt = at
+		b.opens++
+	}
+}
+
+// allowRequest reports whether the breaker of the node with the given ID lets
+// a request through at at. An open breaker whose cool-down has passed turns
+// half-open and lets the request through as a probe. The caller must hold
+// s.mu for writing.
+func (s *Simulator) allowRequest(id int, b *breaker, at time.Time) bool {
+	if b.state != BreakerOpen {
+		return true
+	}
+	if at.Sub(b.openedAt) < time.Duration(s.loadGen.settings.BreakerCooldown) {
+		return false
+	}
+	s.setBreaker(id, b, BreakerHalfOpen, at)
+	return true
+}
+
+// recordResult counts a request through the breaker of the node with the
+// given ID: a success closes a half-open breaker, and a failure opens it
+// again, as does the threshold of consecutive failures a closed one. The
+// caller must hold s.mu for writing.
+func (s *Simulator) recordResult(id int, b *breaker, ok bool, at time.Time) {
+	if ok {
+		b.failures = 0
+		if b.state == BreakerHalfOpen {
+			s.setBreaker(id, b, BreakerClosed, at)
+		}
+		return
+	}
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= s.loadGen.settings.BreakerThreshold {
+		s.setBreaker(id, b, BreakerOpen, at)
+	}
+}
+
+// Breakers returns the state of the load generator's circuit breakers for
+// the nodes it has sent requests to, by ID.
+func (s *Simulator) Breakers() []Breaker {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	breakers := make([]Breaker, 0, len(s.loadGen.nodes))
+	for id, n := range s.loadGen.nodes {
+		breakers = append(breakers, Breaker{
+			ID:             id,
+			State:          n.breaker.state,
+			Failures:       n.breaker.failures,
+			OpenedAt:       n.breaker.openedAt,
+			Opens:          n.breaker.opens,
+			ShortCircuited: n.shortCircuited,
+		})
+	}
+	sort.Slice(breakers, func(i, j int) bool { return breakers[i].ID < breakers[j].ID })
+	return breakers
+}
+
+// getBreakers handles HTTP requests for the state of the load generator's
+// circuit breakers.
+func (s *Simulator) getBreakers(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Breakers())
+}
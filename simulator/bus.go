@@ -0,0 +1,436 @@
+package simulator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultInboxSize is the number of messages each node's inbox retains when
+// Config.InboxSize is unset.
+const DefaultInboxSize = 64
+
+// Errors returned by the message bus.
+var (
+	// ErrInvalidTopic means a topic name was rejected.
+	ErrInvalidTopic = errors.New("topic names must be non-empty and contain no slash")
+
+	// ErrTopicNotFound means no such topic exists.
+	ErrTopicNotFound = errors.New("topic not found")
+
+	// ErrNotSubscribed means the node is not subscribed to the topic.
+	ErrNotSubscribed = errors.New("node is not subscribed to the topic")
+)
+
+// BusMessage is a message published to a topic of the message bus.
+type BusMessage struct {
+	ID        uint64    `json:"id"`
+	Topic     string    `json:"topic"`
+	From      int       `json:"from"` // ID of the publishing node.
+	Payload   string    `json:"payload"`
+	Published time.Time `json:"published"`
+}
+
+// InboxMessage is a message that reached a subscriber.
+type InboxMessage struct {
+	BusMessage
+	Received time.Time `json:"received"`
+}
+
+// NodeInbox lists the messages most recently delivered to one node, oldest
+// first.
+type NodeInbox struct {
+	NodeID   int            `json:"node_id"`
+	Messages []InboxMessage `json:"messages"`
+}
+
+// TopicInfo describes a topic of the message bus and the fate of the
+// messages published to it, counted once per subscriber.
+type TopicInfo struct {
+	Name        string `json:"name"`
+	Subscribers []int  `json:"subscribers"` // Subscribed node IDs, in order.
+	Count       int    `json:"subscriber_count"`
+	Published   uint64 `json:"published"`
+	Delivered   uint64 `json:"delivered"`
+	Dropped     uint64 `json:"dropped"`
+	Pending     int    `json:"pending"` // Deliveries waiting to be sent or in flight.
+}
+
+// PublishResult describes a message that has been published and the
+// subscribers it is on its way to.
+type PublishResult struct {
+	Message     BusMessage `json:"message"`
+	Subscribers []int      `json:"subscribers"`
+}
+
+// topicState is a topic of the message bus.
+type topicState struct {
+	subscribers map[int]bool
+	published   uint64
+	delivered   uint64
+	dropped     uint64
+}
+
+// busDelivery is a published message waiting to be sent to a subscriber.
+type busDelivery struct {
+	msg BusMessage
+	to  int
+}
+
+// inboxRing is a fixed-capacity ring buffer of inbox messages that
+// overwrites the oldest message once full.
+type inboxRing struct {
+	messages []InboxMessage
+	start    int // Index of the oldest message once the buffer is full.
+}
+
+// add appends m, evicting the oldest message if the ring is at capacity.
+func (r *inboxRing) add(m InboxMessage, capacity int) {
+	if len(r.messages) < capacity {
+		r.messages = append(r.messages, m)
+		return
+	}
+	r.messages[r.start] = m
+	r.start = (r.start + 1) % len(r.messages)
+}
+
+// ordered returns the messages oldest first.
+func (r *inboxRing) ordered() []InboxMessage {
+	out := make([]InboxMessage, 0, len(r.messages))
+	out = append(out, r.messages[r.start:]...)
+	return append(out, r.messages[:r.start]...)
+}
+
+// checkTopic returns ErrInvalidTopic if name may not name a topic.
+func checkTopic(name string) error {
+	if name == "" || strings.Contains(name, "/") {
+		return ErrInvalidTopic
+	}
+	return nil
+}
+
+// topic returns the topic with the given name, creating it if needed. The
+// caller must hold s.mu for writing.
+func (s *Simulator) topic(name string) *topicState {
+	t, ok := s.topics[name]
+	if !ok {
+		t = &topicState{subscribers: make(map[int]bool)}
+		s.topics[name] = t
+	}
+	return t
+}
+
+// Subscribe subscribes the node with the given ID to the named topic,
+// creating the topic if needed. It returns ErrNodeNotFound if no such node
+// exists.
+func (s *Simulator) Subscribe(name string, id int) (TopicInfo, error) {
+	if err := checkTopic(name); err != nil {
+		return TopicInfo{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.findNode(id) < 0 {
+		return TopicInfo{}, ErrNodeNotFound
+	}
+	s.topic(name).subscribers[id] = true
+	s.logger.Info("node subscribed", "topic", name, "node_id", id)
+	return s.topicInfo(name), nil
+}
+
+// Unsubscribe unsubscribes the node with the given ID from the named topic.
+// Messages already on their way to it are still delivered. It returns
+// ErrTopicNotFound if no such topic exists and ErrNotSubscribed if the node
+// isn't subscribed to it.
+func (s *Simulator) Unsubscribe(name string, id int) (TopicInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.topics[name]
+	if !ok {
+		return TopicInfo{}, ErrTopicNotFound
+	}
+	if !t.subscribers[id] {
+		return TopicInfo{}, ErrNotSubscribed
+	}
+	delete(t.subscribers, id)
+	s.logger.Info("node unsubscribed", "topic", name, "node_id", id)
+	return s.topicInfo(name), nil
+}
+
+// Publish publishes a message with the given payload from the node with ID
+// from to the named topic, creating the topic if needed. The message is
+// delivered to every current subscriber by later bus rounds. It returns
+// ErrNodeNotFound if no such node exists.
+func (s *Simulator) Publish(name string, from int, payload string) (PublishResult, error) {
+	if err := checkTopic(name); err != nil {
+		return PublishResult{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.findNode(from) < 0 {
+		return PublishResult{}, ErrNodeNotFound
+	}
+	t := s.topic(name)
+	s.busSeq++
+	msg := BusMessage{ID: s.busSeq, Topic: name, From: from, Payload: payload, Published: s.cfg.Clock.Now()}
+	result := PublishResult{Message: msg, Subscribers: sortedIDs(t.subscribers)}
+	for _, id := range result.Subscribers {
+		s.busPending = append(s.busPending, busDelivery{msg: msg, to: id})
+	}
+	t.published++
+	s.logger.Debug("message published", "topic", name, "from", from, "subscribers", len(result.Subscribers))
+	return result, nil
+}
+
+// StartBus runs a bus round once per interval until ctx is cancelled. It
+// blocks, so callers typically run it in its own goroutine.
+func (s *Simulator) StartBus(ctx context.Context, interval time.Duration) {
+	ticker := s.cfg.Clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			s.BusRound()
+		}
+	}
+}
+
+// BusRound sends every published message still waiting for a subscriber
+// whose publisher and subscriber are up and can reach each other. Messages
+// lost to the link's loss rate are counted as dropped and not retried, while
+// those for down or partitioned subscribers, and those the bandwidth limit
+// drops, wait for a later round. Sent messages reach the subscriber's inbox
+// after the latency of the link; those sent in earlier rounds that have
+// arrived by now are delivered first. It returns the number of messages
+// sent.
+func (s *Simulator) BusRound() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.cfg.Clock.Now()
+	s.deliverArrived(now)
+
+	sent := 0
+	pending := s.busPending[:0]
+	for _, d := range s.busPending {
+		from, to := s.findNode(d.msg.From), s.findNode(d.to)
+		if s.nodes[from].Status != StatusUp || s.nodes[to].Status != StatusUp || !s.reachable(d.msg.From, d.to) {
+			pending = append(pending, d)
+			continue
+		}
+		topic := s.topic(d.msg.Topic)
+		if !s.deliver(d.msg.From, d.to) {
+			topic.dropped++
+			continue
+		}
+		if !s.send(now, d.msg.From, d.to, MessageBus, "bus/"+d.msg.Topic, d.msg, func(arrived time.Time) {
+			s.receiveBusMessage(d.to, d.msg, arrived)
+		}) {
+			pending = append(pending, d)
+			continue
+		}
+		sent++
+	}
+	clear(s.busPending[len(pending):])
+	s.busPending = pending
+	return sent
+}
+
+// receiveBusMessage adds msg, which arrived at the node with the given ID at
+// arrived, to the node's inbox. Messages for nodes that have gone are
+// discarded. The caller must hold s.mu for writing.
+func (s *Simulator) receiveBusMessage(id int, msg BusMessage, arrived time.Time) {
+	if s.findNode(id) < 0 {
+		return
+	}
+	ring := s.inboxes[id]
+	if ring == nil {
+		ring = &inboxRing{}
+		s.inboxes[id] = ring
+	}
+	ring.add(InboxMessage{BusMessage: msg, Received: arrived}, s.cfg.InboxSize)
+	s.topic(msg.Topic).delivered++
+}
+
+// forgetSubscriber drops the subscriptions, inbox, and pending messages to
+// or from the node with the given ID. The caller must hold s.mu for writing.
+func (s *Simulator) forgetSubscriber(id int) {
+	for _, t := range s.topics {
+		delete(t.subscribers, id)
+	}
+	delete(s.inboxes, id)
+	pending := s.busPending[:0]
+	for _, d := range s.busPending {
+		if d.msg.From != id && d.to != id {
+			pending = append(pending, d)
+		}
+	}
+	clear(s.busPending[len(pending):])
+	s.busPending = pending
+}
+
+// topicInfo describes the named topic, which must exist. The caller must
+// hold s.mu.
+func (s *Simulator) topicInfo(name string) TopicInfo {
+	t := s.topics[name]
+	info := TopicInfo{
+		Name:        name,
+		Subscribers: sortedIDs(t.subscribers),
+		Count:       len(t.subscribers),
+		Published:   t.published,
+		Delivered:   t.delivered,
+		Dropped:     t.dropped,
+	}
+	for _, d := range s.busPending {
+		if d.msg.Topic == name {
+			info.Pending++
+		}
+	}
+	for _, m := range s.inFlight {
+		if m.topic == "bus/"+name {
+			info.Pending++
+		}
+	}
+	return info
+}
+
+// sortedIDs returns the IDs in set in increasing order.
+func sortedIDs(set map[int]bool) []int {
+	ids := make([]int, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// Topics returns every topic of the message bus, by name.
+func (s *Simulator) Topics() []TopicInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	topics := make([]TopicInfo, 0, len(s.topics))
+	for name := range s.topics {
+		topics = append(topics, s.topicInfo(name))
+	}
+	sort.Slice(topics, func(i, j int) bool { return topics[i].Name < topics[j].Name })
+	return topics
+}
+
+// Inbox returns the messages most recently delivered to the node with the
+// given ID, oldest first. It returns false if no such node exists.
+func (s *Simulator) Inbox(id int) (NodeInbox, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.findNode(id) < 0 {
+		return NodeInbox{}, false
+	}
+	inbox := NodeInbox{NodeID: id, Messages: []InboxMessage{}}
+	if ring := s.inboxes[id]; ring != nil {
+		inbox.Messages = ring.ordered()
+	}
+	return inbox, true
+}
+
+// writeBusError writes the HTTP response for an error of the message bus.
+func writeBusError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNodeNotFound):
+		writeError(w, http.StatusNotFound, "Node not found")
+	case errors.Is(err, ErrTopicNotFound):
+		writeError(w, http.StatusNotFound, "Topic not found")
+	case errors.Is(err, ErrNotSubscribed):
+		writeError(w, http.StatusNotFound, "Node is not subscribed to the topic")
+	default:
+		writeError(w, http.StatusBadRequest, err.Error())
+	}
+}
+
+// getTopics handles HTTP requests to list the topics of the message bus.
+func (s *Simulator) getTopics(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Topics())
+}
+
+// subscribe handles HTTP requests to subscribe a node to a topic.
+func (s *Simulator) subscribe(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseNodeID(w, r)
+	if !ok {
+		return
+	}
+	info, err := s.Subscribe(r.PathValue("name"), id)
+	if err != nil {
+		writeBusError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// unsubscribe handles HTTP requests to unsubscribe a node from a topic.
+func (s *Simulator) unsubscribe(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseNodeID(w, r)
+	if !ok {
+		return
+	}
+	info, err := s.Unsubscribe(r.PathValue("name"), id)
+	if err != nil {
+		writeBusError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// publishRequest is the JSON payload accepted by publish.
+type publishRequest struct {
+	From    *int   `json:"from"`
+	Payload string `json:"payload"`
+}
+
+// publishMessage handles HTTP requests to publish a message to a topic from
+// a body like {"from":0,"payload":"hello"}.
+func (s *Simulator) publishMessage(w http.ResponseWriter, r *http.Request) {
+	var payload publishRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "Malformed JSON body")
+		return
+	}
+	if payload.From == nil {
+		writeError(w, http.StatusBadRequest, "Field \"from\" is required")
+		return
+	}
+
+	result, err := s.Publish(r.PathValue("name"), *payload.From, payload.Payload)
+	if err != nil {
+		writeBusError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, result)
+}
+
+// getInbox handles HTTP requests for the messages recently delivered to a
+// node.
+func (s *Simulator) getInbox(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseNodeID(w, r)
+	if !ok {
+		return
+	}
+	inbox, ok := s.Inbox(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "Node not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, inbox)
+}
@@ -0,0 +1,119 @@
+package simulator
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// TestMessageBus tests that a message published while a subscriber is
+// partitioned away reaches the rest at once and that subscriber once the
+// partition heals.
+func TestMessageBus(t *testing.T) {
+	s := New(Config{Seed: 1})
+	s.Init(3)
+	h := s.Handler()
+
+	for _, id := range []string{"1", "2"} {
+		expectCode(t, doRequest(t, h, "PUT", "/topics/orders/subscribers/"+id, ""), http.StatusOK)
+	}
+	if err := s.SetPartition([][]int{{0, 1}, {2}}); err != nil {
+		t.Fatalf("SetPartition failed: %v", err)
+	}
+
+	rr := doRequest(t, h, "POST", "/topics/orders/publish", `{"from":0,"payload":"order-1"}`)
+	expectCode(t, rr, http.StatusAccepted)
+	var published PublishResult
+	decodeBody(t, rr, &published)
+	if want := []int{1, 2}; !reflect.DeepEqual(published.Subscribers, want) {
+		t.Errorf("Expected the message to go to %v, got %v", want, published.Subscribers)
+	}
+	if inbox, _ := s.Inbox(1); len(inbox.Messages) != 0 {
+		t.Errorf("Expected no delivery before the next round, got %+v", inbox.Messages)
+	}
+
+	s.BusRound()
+	inboxes := func() (one, two []InboxMessage) {
+		a, _ := s.Inbox(1)
+		b, _ := s.Inbox(2)
+		return a.Messages, b.Messages
+	}
+	one, two := inboxes()
+	if len(one) != 1 || one[0].Payload != "order-1" || one[0].From != 0 || len(two) != 0 {
+		t.Fatalf("Expected only node 1 to receive the message, got %+v and %+v", one, two)
+	}
+	var topics []TopicInfo
+	decodeBody(t, doRequest(t, h, "GET", "/topics", ""), &topics)
+	if len(topics) != 1 || topics[0].Count != 2 || topics[0].Published != 1 || topics[0].Delivered != 1 || topics[0].Pending != 1 {
+		t.Errorf("Expected one delivery and one pending, got %+v", topics)
+	}
+
+	s.HealPartition()
+	s.BusRound()
+	if _, two = inboxes(); len(two) != 1 || two[0].ID != published.Message.ID {
+		t.Errorf("Expected node 2 to receive the message after healing, got %+v", two)
+	}
+	if topics := s.Topics(); topics[0].Delivered != 2 || topics[0].Pending != 0 {
+		t.Errorf("Expected both deliveries made, got %+v", topics[0])
+	}
+	if kind := s.Traffic(DefaultTrafficTop).Kinds[MessageBus]; kind.Messages != 2 {
+		t.Errorf("Expected 2 bus messages counted as traffic, got %+v", kind)
+	}
+
+	// A message lost on the link is dropped rather than retried.
+	s.SetLinkLoss(0, 1, 1)
+	s.Publish("orders", 0, "order-2")
+	s.BusRound()
+	s.BusRound()
+	if topics := s.Topics(); topics[0].Delivered != 3 || topics[0].Dropped != 1 || topics[0].Pending != 0 {
+		t.Errorf("Expected the delivery to node 1 to be dropped, got %+v", topics[0])
+	}
+
+	expectCode(t, doRequest(t, h, "DELETE", "/topics/orders/subscribers/2", ""), http.StatusOK)
+	for _, tt := range []struct {
+		method, path, body string
+		want               int
+	}{
+		{"DELETE", "/topics/orders/subscribers/2", "", http.StatusNotFound},
+		{"DELETE", "/topics/missing/subscribers/1", "", http.StatusNotFound},
+		{"PUT", "/topics/orders/subscribers/9", "", http.StatusNotFound},
+		{"PUT", "/topics/orders/subscribers/x", "", http.StatusBadRequest},
+		{"POST", "/topics/orders/publish", `{"payload":"x"}`, http.StatusBadRequest},
+		{"POST", "/topics/orders/publish", `{"from":9,"payload":"x"}`, http.StatusNotFound},
+		{"GET", "/nodes/9/inbox", "", http.StatusNotFound},
+	} {
+		if rr := doRequest(t, h, tt.method, tt.path, tt.body); rr.Code != tt.want {
+			t.Errorf("%s %s %s: expected status code %d, got %d", tt.method, tt.path, tt.body, tt.want, rr.Code)
+		}
+	}
+	if _, err := s.Subscribe("a/b", 0); !errors.Is(err, ErrInvalidTopic) {
+		t.Errorf("Expected ErrInvalidTopic, got %v", err)
+	}
+
+	// Removing a node drops its subscriptions and inbox.
+	s.RemoveNode(1)
+	if topics := s.Topics(); topics[0].Count != 0 {
+		t.Errorf("Expected no subscribers left, got %+v", topics[0])
+	}
+}
+
+// TestInboxSize tests that an inbox keeps only the most recent messages.
+func TestInboxSize(t *testing.T) {
+	s := New(Config{InboxSize: 2})
+	s.Init(2)
+	s.Subscribe("t", 1)
+	for _, payload := range []string{"a", "b", "c"} {
+		s.Publish("t", 0, payload)
+	}
+	s.BusRound()
+
+	inbox, _ := s.Inbox(1)
+	var got []string
+	for _, m := range inbox.Messages {
+		got = append(got, m.Payload)
+	}
+	if want := []string{"b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected inbox %v, got %v", want, got)
+	}
+}
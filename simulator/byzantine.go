@@ -0,0 +1,207 @@
+package simulator
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// ConsistencyMajority reads go to 2f+1 replicas and return the answer at
+// least f+1 of them agree on, masking up to f byzantine replicas.
+const ConsistencyMajority = "majority"
+
+// Errors returned by KVMajorityRead.
+var (
+	// ErrInvalidFaults means a majority read asked to mask a negative
+	// number of faults, or more than the key's replicas can outvote.
+	ErrInvalidFaults = errors.New("invalid number of faults to mask")
+
+	// ErrNoMajority means no answer got f+1 of the 2f+1 votes of a
+	// majority read.
+	ErrNoMajority = errors.New("replicas disagree without a majority")
+)
+
+// Vote is one replica's answer to a majority read.
+type Vote struct {
+	ID      int    `json:"id"`
+	Present bool   `json:"present"`           // The replica answered with a live copy of the key.
+	Value   string `json:"value,omitempty"`   // Omitted unless Present.
+	Version uint64 `json:"version,omitempty"` // Omitted unless Present.
+}
+
+// MajorityRead describes a key-value read decided by a vote of its replicas.
+type MajorityRead struct {
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+	Version uint64 `json:"version"`
+	F       int    `json:"f"`     // Faults masked: the read asked 2f+1 replicas.
+	Votes   []Vote `json:"votes"` // Answers of the replicas asked, in preference-list order.
+
+	// Disagreed lists the replicas outvoted by the majority, or every
+	// replica asked if there was none.
+	Disagreed []int `json:"disagreed,omitempty"`
+}
+
+// corruptValue returns a random value other than v, as a byzantine node
+// reports in place of v. The caller must hold s.mu for writing.
+func (s *Simulator) corruptValue(v int) int {
+	return v ^ 1<<s.rng.Intn(16)
+}
+
+// corruptString returns a random string other than v, as a byzantine node
+// reports in place of v. The caller must hold s.mu for writing.
+func (s *Simulator) corruptString(v string) string {
+	return v + string(rune('a'+s.rng.Intn(26)))
+}
+
+// replyEntry returns entry, the copy of a key held by the node with the given
+// ID, as the node reports it in a reply or a replication message: with a
+// corrupted value if the node is byzantine. The caller must hold s.mu for
+// writing.
+func (s *Simulator) replyEntry(id int, entry KVEntry) KVEntry {
+	if s.nodes[s.findNode(id)].Byzantine && !entry.Deleted {
+		entry.Value = s.corruptString(entry.Value)
+	}
+	return entry
+}
+
+// ToggleByzantine makes the node with the given ID byzantine, or honest
+// again if it was byzantine. A byzantine node keeps its true state but lies
+// about it: it reports randomly corrupted values in direct reads of the
+// node, in key-value reads it serves, and in the gossip and replication
+// messages it sends. It returns the updated node and false if no such node
+// exists.
+func (s *Simulator) ToggleByzantine(id int) (NodeData, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := s.findNode(id)
+	if index < 0 {
+		return NodeData{}, false
+	}
+	s.nodes[index].Byzantine = !s.nodes[index].Byzantine
+	s.publish(EventNodeUpdated, index)
+	s.logger.Info("node byzantine mode changed", "node_id", id, "byzantine", s.nodes[index].Byzantine)
+	return s.nodes[index].clone(), true
+}
+
+// ReadNode returns the node with the given ID as the node itself answers a
+// read: with a corrupted value if it is byzantine. It returns false if no
+// such node exists.
+func (s *Simulator) ReadNode(id int) (NodeData, bool) {
+	// Corrupting the value consumes the random source.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := s.findNode(id)
+	if index < 0 {
+		return NodeData{}, false
+	}
+	node := s.nodeCopy(index)
+	if node.Byzantine {
+		node.Value = s.corruptValue(node.Value)
+	}
+	return node, true
+}
+
+// KVMajorityRead reads key from 2f+1 of its N replicas, chosen at random
+// among the key's up replicas, and returns the answer at least f+1 of them
+// give. Up to f byzantine replicas are thus outvoted, as are replicas that
+// missed the latest write. Unlike KVGet, it repairs nothing. A read where
+// some replica disagreed is counted as masked, or as unresolved if there was
+// no majority. It returns an error wrapping ErrInvalidFaults if f is
+// negative or 2f+1 exceeds N, an error wrapping ErrQuorumUnavailable if
+// fewer than 2f+1 replicas are up, ErrNoMajority if no answer has f+1 votes,
+// and ErrKeyNotFound if the majority don't hold the key.
+func (s *Simulator) KVMajorityRead(key string, f int) (MajorityRead, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if f < 0 || 2*f+1 > s.cfg.N {
+		return MajorityRead{}, fmt.Errorf("%w: f must be between 0 and %d, got %d", ErrInvalidFaults, (s.cfg.N-1)/2, f)
+	}
+	targets, err := s.quorum(key, 2*f+1, -1)
+	if err != nil {
+		return MajorityRead{}, err
+	}
+
+	now := s.cfg.Clock.Now()
+	read := MajorityRead{Key: key, F: f}
+	tally := make(map[Vote]int)
+	for _, id := range targets {
+		vote := Vote{}
+		if entry, ok := s.replicaData[id][key]; ok && entry.live(now) {
+			entry = s.replyEntry(id, entry)
+			vote = Vote{Present: true, Value: entry.Value, Version: entry.Version}
+		}
+		tally[vote]++
+		vote.ID = id
+		read.Votes = append(read.Votes, vote)
+	}
+
+	var winner Vote
+	found := false
+	for vote, n := range tally {
+		if n > f {
+			winner, found = vote, true
+		}
+	}
+	for _, vote := range read.Votes {
+		if answer := (Vote{Present: vote.Present, Value: vote.Value, Version: vote.Version}); !found || answer != winner {
+			read.Disagreed = append(read.Disagreed, vote.ID)
+		}
+	}
+	switch {
+	case !found:
+		s.disagreements.unresolved++
+		s.logger.Warn("majority read without a majority", "key", key, "f", f, "replicas", targets)
+		return read, ErrNoMajority
+	case len(read.Disagreed) > 0:
+		s.disagreements.masked++
+		s.logger.Info("majority read outvoted replicas", "key", key, "f", f, "disagreed", read.Disagreed)
+	}
+	if !winner.Present {
+		return read, ErrKeyNotFound
+	}
+	read.Value, read.Version = winner.Value, winner.Version
+	return read, nil
+}
+
+// getKVMajority handles HTTP requests to read a key by a vote of 2f+1
+// replicas, where f is the "f" query parameter and defaults to the most
+// faults the key's N replicas can mask.
+func (s *Simulator) getKVMajority(w http.ResponseWriter, r *http.Request) {
+	f := (s.cfg.N - 1) / 2
+	if raw := r.URL.Query().Get("f"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Query parameter \"f\" must be an integer")
+			return
+		}
+		f = n
+	}
+
+	read, err := s.KVMajorityRead(r.PathValue("key"), f)
+	if err != nil {
+		writeKVError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, read)
+}
+
+// toggleByzantine handles HTTP requests to make a node byzantine, or honest
+// again.
+func (s *Simulator) toggleByzantine(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseNodeID(w, r)
+	if !ok {
+		return
+	}
+
+	node, found := s.ToggleByzantine(id)
+	if !found {
+		writeError(w, http.StatusNotFound, "Node not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, node)
+}
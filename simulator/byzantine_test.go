@@ -0,0 +1,83 @@
+package simulator
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestByzantine tests that a byzantine node's direct reads are corrupted
+// while majority reads outvote it, and that too many byzantine replicas
+// leave no majority.
+func TestByzantine(t *testing.T) {
+	s := New(Config{Seed: 1, N: 5, R: 1, W: 5})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	expectCode(t, doRequest(t, h, "PUT", "/kv/color", `{"value":"blue"}`), http.StatusOK)
+	var node NodeData
+	decodeBody(t, doRequest(t, h, "POST", "/nodes/2/byzantine", ""), &node)
+	if !node.Byzantine {
+		t.Fatalf("Expected node 2 to be byzantine, got %+v", node)
+	}
+	var nodes []NodeData
+	decodeBody(t, doRequest(t, h, "GET", "/nodes", ""), &nodes)
+	for _, node := range nodes {
+		if node.Byzantine != (node.ID == 2) {
+			t.Errorf("Expected only node 2 to be flagged byzantine, got %+v", node)
+		}
+	}
+
+	// Direct reads of the byzantine node lie; those of honest nodes don't.
+	for id := 1; id <= 2; id++ {
+		truth, _ := s.Node(id)
+		decodeBody(t, doRequest(t, h, "GET", "/nodes/"+strconv.Itoa(id), ""), &node)
+		if (node.Value != truth.Value) != (id == 2) {
+			t.Errorf("Direct read of node %d got %d, and it holds %d", id, node.Value, truth.Value)
+		}
+	}
+	for served := false; !served; {
+		read, err := s.KVRead("color", ConsistencyEventual, 0, "")
+		if err != nil {
+			t.Fatalf("KVRead failed: %v", err)
+		}
+		if served = read.ServedBy == 2; served && read.Value == "blue" {
+			t.Errorf("Expected node 2 to serve a corrupted value, got %+v", read)
+		}
+	}
+
+	// Majority reads mask the byzantine replica.
+	for i := 0; i < 10; i++ {
+		var read MajorityRead
+		decodeBody(t, doRequest(t, h, "GET", "/kv/color?consistency=majority&f=1", ""), &read)
+		if read.Value != "blue" || len(read.Votes) != 3 {
+			t.Fatalf("Expected 3 replicas to vote for blue, got %+v", read)
+		}
+	}
+	read, err := s.KVMajorityRead("color", 2)
+	if err != nil || read.Value != "blue" || !reflect.DeepEqual(read.Disagreed, []int{2}) {
+		t.Fatalf("Expected node 2 to be outvoted, got %+v and %v", read, err)
+	}
+	for _, query := range []string{"f=3", "f=-1", "f=x"} {
+		expectCode(t, doRequest(t, h, "GET", "/kv/color?consistency=majority&"+query, ""), http.StatusBadRequest)
+	}
+
+	// Three liars among five replicas are more than f=2 can mask.
+	s.ToggleByzantine(3)
+	s.ToggleByzantine(4)
+	if _, err := s.KVMajorityRead("color", 2); !errors.Is(err, ErrNoMajority) {
+		t.Errorf("Expected no majority, got %v", err)
+	}
+	body := doRequest(t, h, "GET", "/metrics", "").Body.String()
+	for _, want := range []string{"sim_byzantine_nodes 3", `sim_byzantine_disagreements_total{outcome="unresolved"} 1`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q", want)
+		}
+	}
+	if strings.Contains(body, `sim_byzantine_disagreements_total{outcome="masked"} 0`) {
+		t.Error("Expected masked disagreements to be counted")
+	}
+}
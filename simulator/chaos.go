@@ -0,0 +1,71 @@
+package simulator
+
+import (
+	"context"
+	"time"
+)
+
+// ChaosStats summarizes the node failures and recoveries seen by a Simulator,
+// whether injected by the chaos loop or requested through the API.
+type ChaosStats struct {
+	TotalFailures   int `json:"total_failures"`
+	TotalRecoveries int `json:"total_recoveries"`
+	CurrentlyDown   int `json:"currently_down"`
+}
+
+// StartChaos injects random failures once per interval until ctx is
+// cancelled, or at Tunables.UpdateInterval once SetTunables changes it. On
+// each tick a random up node is marked down with probability
+// Tunables.FailProb, and a random down node is marked up with probability
+// Tunables.RecoverProb. It blocks, so callers typically run it in its own
+// goroutine.
+func (s *Simulator) StartChaos(ctx context.Context, interval time.Duration) {
+	ticker := s.newIntervalTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.changed():
+			ticker.refresh()
+		case <-ticker.C():
+			s.chaosStep()
+		}
+	}
+}
+
+// chaosStep performs a single tick of the chaos loop.
+func (s *Simulator) chaosStep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := s.Tunables()
+	if s.rng.Float64() < t.FailProb {
+		if up := s.indicesWithStatus(StatusUp); len(up) > 0 {
+			index := up[s.rng.Intn(len(up))]
+			s.transition(index, StatusDown)
+			s.logger.Debug("chaos failed node", "node_id", s.nodes[index].ID)
+		}
+	}
+
+	if s.rng.Float64() < t.RecoverProb {
+		if down := s.indicesWithStatus(StatusDown); len(down) > 0 {
+			index := down[s.rng.Intn(len(down))]
+			s.transition(index, StatusUp)
+			s.logger.Debug("chaos recovered node", "node_id", s.nodes[index].ID)
+		}
+	}
+}
+
+// ChaosStats returns the current failure statistics.
+func (s *Simulator) ChaosStats() ChaosStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return ChaosStats{
+		TotalFailures:   s.failures,
+		TotalRecoveries: s.recoveries,
+		CurrentlyDown:   len(s.indicesWithStatus(StatusDown)),
+	}
+}
@@ -0,0 +1,66 @@
+package simulator
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestStartChaos tests that the chaos loop fails nodes when FailProb is 1 and
+// that /chaos/stats reports the transitions.
+func TestStartChaos(t *testing.T) {
+	s := New(Config{FailProb: 1})
+	s.Init(testNodeCount)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.StartChaos(ctx, time.Millisecond)
+	}()
+
+	// Every tick fails a node, so all nodes go down after a few ticks.
+	deadline := time.Now().Add(2 * time.Second)
+	for s.ChaosStats().CurrentlyDown < testNodeCount {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected all nodes to go down, got %+v", s.ChaosStats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	for _, node := range s.Snapshot() {
+		if node.Status != StatusDown {
+			t.Errorf("Expected node %d to be down", node.ID)
+		}
+	}
+
+	var stats ChaosStats
+	rr := doRequest(t, s.Handler(), "GET", "/chaos/stats", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, rr.Code)
+	}
+	decodeBody(t, rr, &stats)
+	want := ChaosStats{TotalFailures: testNodeCount, TotalRecoveries: 0, CurrentlyDown: testNodeCount}
+	if stats != want {
+		t.Errorf("Expected stats %+v, but got %+v", want, stats)
+	}
+}
+
+// TestChaosStepRecovers tests that a chaos tick with RecoverProb 1 brings a
+// down node back up, and that manual transitions are counted too.
+func TestChaosStepRecovers(t *testing.T) {
+	s := New(Config{RecoverProb: 1})
+	s.Init(testNodeCount)
+
+	s.Fail(1)
+	s.Fail(1) // Failing a down node is not a new failure.
+	s.chaosStep()
+
+	want := ChaosStats{TotalFailures: 1, TotalRecoveries: 1, CurrentlyDown: 0}
+	if stats := s.ChaosStats(); stats != want {
+		t.Errorf("Expected stats %+v, but got %+v", want, stats)
+	}
+}
@@ -0,0 +1,342 @@
+package simulator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// clockResolution is how often a running VirtualClock advances its time.
+const clockResolution = 10 * time.Millisecond
+
+// MaxClockSpeed is the largest factor SetSpeed accepts.
+const MaxClockSpeed = 1000
+
+// Errors returned by VirtualClock.
+var (
+	// ErrClockRunning is returned by Step while the clock is not paused.
+	ErrClockRunning = errors.New("simulator: clock is running")
+
+	// ErrInvalidSpeed is returned by SetSpeed for factors that are not
+	// positive or are over MaxClockSpeed.
+	ErrInvalidSpeed = fmt.Errorf("simulator: speed factor must be positive and at most %d", MaxClockSpeed)
+)
+
+// Clock is the time source the simulation loops tick from. RealClock follows
+// the wall clock; a VirtualClock can be paused, sped up, and stepped.
+type Clock interface {
+	// Now returns the current time on the clock.
+	Now() time.Time
+
+	// NewTicker returns a Ticker that delivers the clock's time once per
+	// interval. Like time.Ticker, it drops ticks for slow receivers.
+	NewTicker(interval time.Duration) Ticker
+}
+
+// Ticker delivers ticks of a Clock.
+type Ticker interface {
+	// C returns the channel the ticks are delivered on.
+	C() <-chan time.Time
+
+	// Stop turns off the ticker. No more ticks are sent after it returns.
+	Stop()
+}
+
+// RealClock is a Clock that follows the wall clock. It is used when
+// Config.Clock is unset.
+type RealClock struct{}
+
+// Now returns time.Now().
+func (RealClock) Now() time.Time { return time.Now() }
+
+// NewTicker returns a Ticker backed by a time.Ticker.
+func (RealClock) NewTicker(interval time.Duration) Ticker {
+	return realTicker{time.NewTicker(interval)}
+}
+
+// realTicker adapts a time.Ticker to the Ticker interface.
+type realTicker struct{ *time.Ticker }
+
+// C returns the time.Ticker's channel.
+func (t realTicker) C() <-chan time.Time { return t.Ticker.C }
+
+// VirtualClock is a Clock whose time only advances while Run is driving it,
+// at the multiple of the wall clock's rate set with SetSpeed, or when Step is
+// called while it is paused. The same simulation can then be slowed down,
+// fast-forwarded, or walked through one tick at a time.
+type VirtualClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	speed   float64
+	paused  bool
+	tickers []*virtualTicker
+}
+
+// virtualTicker is a Ticker of a VirtualClock.
+type virtualTicker struct {
+	clock    *VirtualClock
+	interval time.Duration
+	next     time.Time // When the ticker fires next; guarded by clock.mu.
+	c        chan time.Time
+}
+
+// ClockState describes a Clock.
+type ClockState struct {
+	Virtual bool      `json:"virtual"`
+	Now     time.Time `json:"now"`
+	Paused  bool      `json:"paused"`
+	Speed   float64   `json:"speed"`
+}
+
+// NewVirtualClock returns a running VirtualClock at normal speed whose time
+// starts at start.
+func NewVirtualClock(start time.Time) *VirtualClock {
+	return &VirtualClock{now: start, speed: 1}
+}
+
+// Now returns the clock's current time.
+func (c *VirtualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTicker returns a Ticker that first fires interval after the clock's
+// current time.
+func (c *VirtualClock) NewTicker(interval time.Duration) Ticker {
+	if interval <= 0 {
+		panic("simulator: non-positive interval for NewTicker")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &virtualTicker{clock: c, interval: interval, next: c.now.Add(interval), c: make(chan time.Time, 1)}
+	c.tickers = append(c.tickers, t)
+	return t
+}
+
+// C returns the ticker's channel.
+func (t *virtualTicker) C() <-chan time.Time { return t.c }
+
+// Stop removes the ticker from its clock.
+func (t *virtualTicker) Stop() {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, other := range c.tickers {
+		if other == t {
+			c.tickers = append(c.tickers[:i], c.tickers[i+1:]...)
+			return
+		}
+	}
+}
+
+// Run advances the clock in step with the wall clock, scaled by its speed,
+// until ctx is cancelled. Paused clocks do not advance. It blocks, so callers
+// typically run it in its own goroutine.
+func (c *VirtualClock) Run(ctx context.Context) {
+	ticker := time.NewTicker(clockResolution)
+	defer ticker.Stop()
+
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			c.mu.Lock()
+			if !c.paused {
+				c.advance(c.now.Add(scaleDuration(now.Sub(last), c.speed)))
+			}
+			c.mu.Unlock()
+			last = now
+		}
+	}
+}
+
+// scaleDuration returns d times factor, clamped to the longest Duration.
+func scaleDuration(d time.Duration, factor float64) time.Duration {
+	scaled := float64(d) * factor
+	if scaled >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return time.Duration(scaled)
+}
+
+// advance moves the clock to to, firing every ticker due by then once, with
+// the latest time it was due at; like time.Ticker, it drops the ticks missed
+// in between. The caller must hold c.mu.
+func (c *VirtualClock) advance(to time.Time) {
+	for _, t := range c.tickers {
+		if t.next.After(to) {
+			continue
+		}
+		due := t.next.Add(to.Sub(t.next) / t.interval * t.interval)
+		select {
+		case t.c <- due:
+		default:
+		}
+		t.next = due.Add(t.interval)
+	}
+	c.now = to
+}
+
+// Pause stops the clock's time until Resume is called.
+func (c *VirtualClock) Pause() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.paused = true
+}
+
+// Resume lets the clock's time advance again after Pause.
+func (c *VirtualClock) Resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.paused = false
+}
+
+// SetSpeed sets how many times faster than the wall clock the clock runs. It
+// returns ErrInvalidSpeed unless factor is positive and at most
+// MaxClockSpeed.
+func (c *VirtualClock) SetSpeed(factor float64) error {
+	if !(factor > 0 && factor <= MaxClockSpeed) {
+		return ErrInvalidSpeed
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.speed = factor
+	return nil
+}
+
+// Step advances a paused clock to the next time any of its tickers fires and
+// fires them, so each simulation loop due then runs once. It returns
+// ErrClockRunning unless the clock is paused. Without tickers, the time does
+// not change.
+func (c *VirtualClock) Step() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.paused {
+		return ErrClockRunning
+	}
+	if len(c.tickers) == 0 {
+		return nil
+	}
+	next := c.tickers[0].next
+	for _, t := range c.tickers[1:] {
+		if t.next.Before(next) {
+			next = t.next
+		}
+	}
+	c.advance(next)
+	return nil
+}
+
+// State returns the clock's time, whether it is paused, and its speed.
+func (c *VirtualClock) State() ClockState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return ClockState{Virtual: true, Now: c.now, Paused: c.paused, Speed: c.speed}
+}
+
+// Clock returns the clock the simulation loops tick from.
+func (s *Simulator) Clock() Clock {
+	return s.cfg.Clock
+}
+
+// speedRequest is the JSON payload accepted by setClockSpeed.
+type speedRequest struct {
+	Factor *float64 `json:"factor"`
+}
+
+// clockState returns the state of s's clock. A RealClock is never paused and
+// always runs at normal speed.
+func (s *Simulator) clockState() ClockState {
+	if clock, ok := s.cfg.Clock.(*VirtualClock); ok {
+		return clock.State()
+	}
+	return ClockState{Now: s.cfg.Clock.Now(), Speed: 1}
+}
+
+// virtualClock returns s's clock if it can be controlled, and otherwise
+// writes a 409 error and returns false.
+func (s *Simulator) virtualClock(w http.ResponseWriter) (*VirtualClock, bool) {
+	clock, ok := s.cfg.Clock.(*VirtualClock)
+	if !ok {
+		writeError(w, http.StatusConflict, "The simulation clock follows real time and cannot be controlled")
+	}
+	return clock, ok
+}
+
+// getClock handles HTTP requests to retrieve the state of the simulation
+// clock.
+func (s *Simulator) getClock(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.clockState())
+}
+
+// pauseClock handles HTTP requests to pause the simulation clock.
+func (s *Simulator) pauseClock(w http.ResponseWriter, r *http.Request) {
+	if clock, ok := s.virtualClock(w); ok {
+		clock.Pause()
+		s.logger.Info("clock paused")
+		writeJSON(w, http.StatusOK, clock.State())
+	}
+}
+
+// resumeClock handles HTTP requests to resume the simulation clock.
+func (s *Simulator) resumeClock(w http.ResponseWriter, r *http.Request) {
+	if clock, ok := s.virtualClock(w); ok {
+		clock.Resume()
+		s.logger.Info("clock resumed")
+		writeJSON(w, http.StatusOK, clock.State())
+	}
+}
+
+// setClockSpeed handles HTTP requests to change the speed of the simulation
+// clock from a body like {"factor":10}.
+func (s *Simulator) setClockSpeed(w http.ResponseWriter, r *http.Request) {
+	clock, ok := s.virtualClock(w)
+	if !ok {
+		return
+	}
+
+	var payload speedRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "Malformed JSON body")
+		return
+	}
+	if payload.Factor == nil {
+		writeError(w, http.StatusBadRequest, "Field \"factor\" is required")
+		return
+	}
+	if err := clock.SetSpeed(*payload.Factor); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Field \"factor\" must be positive and at most %d", MaxClockSpeed))
+		return
+	}
+	s.logger.Info("clock speed changed", "factor", *payload.Factor)
+	writeJSON(w, http.StatusOK, clock.State())
+}
+
+// stepClock handles HTTP requests to advance the paused simulation clock by
+// one tick.
+func (s *Simulator) stepClock(w http.ResponseWriter, r *http.Request) {
+	clock, ok := s.virtualClock(w)
+	if !ok {
+		return
+	}
+	if err := clock.Step(); err != nil {
+		writeError(w, http.StatusConflict, "The clock must be paused to step")
+		return
+	}
+	writeJSON(w, http.StatusOK, clock.State())
+}
@@ -0,0 +1,162 @@
+package simulator
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// waitFor polls done until it reports true, failing the test after a second.
+func waitFor(t *testing.T, done func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// tickerCount returns the number of tickers registered with c.
+func tickerCount(c *VirtualClock) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.tickers)
+}
+
+// TestClockStep tests that stepping a paused clock runs exactly one update
+// per step, and none in between.
+func TestClockStep(t *testing.T) {
+	clock := NewVirtualClock(time.Unix(0, 0))
+	s := New(Config{Clock: clock})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	rr := doRequest(t, h, "POST", "/clock/pause", "")
+	expectCode(t, rr, http.StatusOK)
+	var paused ClockState
+	decodeBody(t, rr, &paused)
+	if !paused.Virtual || !paused.Paused {
+		t.Errorf("Expected a paused virtual clock, got %+v", paused)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.StartUpdater(ctx, 5*time.Second)
+	waitFor(t, func() bool { return tickerCount(clock) == 1 })
+
+	for step := 1; step <= 3; step++ {
+		expectCode(t, doRequest(t, h, "POST", "/clock/step", ""), http.StatusOK)
+		waitFor(t, func() bool { return updateCount(s) == step })
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := updateCount(s); n != 3 {
+		t.Errorf("Expected exactly 3 update rounds, got %d", n)
+	}
+	if now := clock.Now(); !now.Equal(time.Unix(15, 0)) {
+		t.Errorf("Expected the clock to have advanced by 15s, got %v", now)
+	}
+
+	// Stepping is only allowed while paused.
+	expectCode(t, doRequest(t, h, "POST", "/clock/resume", ""), http.StatusOK)
+	expectCode(t, doRequest(t, h, "POST", "/clock/step", ""), http.StatusConflict)
+}
+
+// TestClockRun tests that a running clock advances at its speed and stands
+// still while paused.
+func TestClockRun(t *testing.T) {
+	clock := NewVirtualClock(time.Unix(0, 0))
+	s := New(Config{Clock: clock})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	rr := doRequest(t, h, "POST", "/clock/speed", `{"factor":1000}`)
+	expectCode(t, rr, http.StatusOK)
+	var state ClockState
+	decodeBody(t, rr, &state)
+	if state.Speed != 1000 {
+		t.Errorf("Expected a speed of 1000, got %v", state.Speed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go clock.Run(ctx)
+	go s.StartUpdater(ctx, 5*time.Second)
+
+	// At 1000x, a 5s interval passes every 5ms of real time.
+	waitFor(t, func() bool { return updateCount(s) >= 3 })
+
+	clock.Pause()
+	time.Sleep(2 * clockResolution)
+	before := clock.Now()
+	time.Sleep(3 * clockResolution)
+	if after := clock.Now(); !after.Equal(before) {
+		t.Errorf("Expected a paused clock to stand still, went from %v to %v", before, after)
+	}
+}
+
+// TestClockErrors tests bad speed requests and control of a real clock.
+func TestClockErrors(t *testing.T) {
+	s := New(Config{Clock: NewVirtualClock(time.Now())})
+	h := s.Handler()
+	expectCode(t, doRequest(t, h, "POST", "/clock/speed", `{"factor":0}`), http.StatusBadRequest)
+	expectCode(t, doRequest(t, h, "POST", "/clock/speed", `{"factor":1001}`), http.StatusBadRequest)
+	expectCode(t, doRequest(t, h, "POST", "/clock/speed", `{"factor":1e300}`), http.StatusBadRequest)
+	expectCode(t, doRequest(t, h, "POST", "/clock/speed", `{}`), http.StatusBadRequest)
+	expectCode(t, doRequest(t, h, "POST", "/clock/speed", `{"factor":"x"}`), http.StatusBadRequest)
+
+	real := New(Config{}).Handler()
+	rr := doRequest(t, real, "GET", "/clock", "")
+	expectCode(t, rr, http.StatusOK)
+	var state ClockState
+	decodeBody(t, rr, &state)
+	if state.Virtual || state.Paused || state.Speed != 1 {
+		t.Errorf("Expected a real clock at normal speed, got %+v", state)
+	}
+	for _, path := range []string{"/clock/pause", "/clock/resume", "/clock/step"} {
+		expectCode(t, doRequest(t, real, "POST", path, ""), http.StatusConflict)
+	}
+}
+
+// TestClockAdvance tests that a clock moved far ahead fires each ticker once,
+// at the latest time it was due, and that scaled durations don't overflow.
+func TestClockAdvance(t *testing.T) {
+	start := time.Unix(0, 0)
+	clock := NewVirtualClock(start)
+	ticker := clock.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	clock.mu.Lock()
+	clock.advance(start.Add(time.Hour + time.Second/2))
+	clock.mu.Unlock()
+	select {
+	case got := <-ticker.C():
+		if want := start.Add(time.Hour); !got.Equal(want) {
+			t.Errorf("Expected a tick at %v, got %v", want, got)
+		}
+	default:
+		t.Fatal("Expected a tick")
+	}
+	select {
+	case got := <-ticker.C():
+		t.Errorf("Expected the missed ticks dropped, got another at %v", got)
+	default:
+	}
+	clock.Pause()
+	if err := clock.Step(); err != nil {
+		t.Fatal(err)
+	}
+	if want := start.Add(time.Hour + time.Second); !clock.Now().Equal(want) {
+		t.Errorf("Expected the next tick at %v, got %v", want, clock.Now())
+	}
+
+	if got := scaleDuration(time.Hour, 1e300); got != math.MaxInt64 {
+		t.Errorf("Expected the longest duration, got %v", got)
+	}
+	if got := scaleDuration(time.Second, MaxClockSpeed); got != 1000*time.Second {
+		t.Errorf("Expected 1000s, got %v", got)
+	}
+}
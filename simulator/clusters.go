@@ -0,0 +1,438 @@
+package simulator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCluster is the name of the cluster a Simulator simulates itself,
+// which the HTTP API's unprefixed paths address.
+const DefaultCluster = "default"
+
+// maxClusterNodes bounds the node count of a cluster created by
+// CreateCluster.
+const maxClusterNodes = 1000
+
+// clusterName is the form of a cluster name: lowercase letters, digits,
+// and dashes, starting with a letter or digit.
+var clusterName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+
+// Errors returned by CreateCluster, GetCluster, and DeleteCluster.
+var (
+	// ErrInvalidCluster means a cluster's name, node count, or Tunables
+	// were rejected.
+	ErrInvalidCluster = errors.New("invalid cluster")
+
+	// ErrClusterExists means a cluster with the requested name exists.
+	ErrClusterExists = errors.New("cluster already exists")
+
+	// ErrNoCluster means no cluster has the requested name.
+	ErrNoCluster = errors.New("cluster not found")
+
+	// ErrDefaultCluster means the default cluster was asked to be deleted.
+	ErrDefaultCluster = errors.New("the default cluster cannot be deleted")
+)
+
+// ClusterSpec describes a cluster to create.
+type ClusterSpec struct {
+	Name  string
+	Nodes int   // Node count, or 0 for as many as the default cluster has.
+	Seed  int64 // Seed of the cluster's random source, or 0 for one derived from the time.
+
+	// Tunables are the cluster's initial Tunables, or nil for the default
+	// cluster's current ones.
+	Tunables *Tunables
+}
+
+// ClusterInfo describes a cluster.
+type ClusterInfo struct {
+	Name     string       `json:"name"`
+	Seed     int64        `json:"seed"`
+	Created  time.Time    `json:"created"`
+	Config   Tunables     `json:"config"`
+	Stats    ClusterStats `json:"stats"`
+	Leader   *int         `json:"leader"` // ID of the leader, or nil for none.
+	EventSeq uint64       `json:"event_seq"`
+
+	// Replication describes the replication links from the cluster.
+	Replication []ReplicationLink `json:"replication,omitempty"`
+}
+
+// clusterTable holds the clusters created by CreateCluster, by name. It has
+// its own lock, so requests are routed to a cluster without waiting for the
+// default cluster's s.mu.
+type clusterTable struct {
+	mu       sync.Mutex
+	clusters map[string]*cluster
+	links    map[linkKey]*replicationLink // Replication links between any two clusters.
+}
+
+// cluster is a Simulator created by CreateCluster and its background loops.
+type cluster struct {
+	sim     *Simulator
+	handler http.Handler // Serves the cluster's HTTP API, prefix stripped.
+	created time.Time
+	cancel  context.CancelFunc // Stops the loops.
+	done    chan struct{}      // Closed once the loops have stopped.
+}
+
+// CreateCluster creates a cluster independent of s and the other clusters,
+// with nodes, event log, and every other piece of state of its own, and
+// starts its updater and chaos loops, ticking from a clock of its own. It
+// takes the rest of its Config from s. The cluster runs until DeleteCluster
+// or StopClusters stops it. It returns an error wrapping ErrInvalidCluster
+// for an invalid spec, or ErrClusterExists if the name is taken.
+func (s *Simulator) CreateCluster(spec ClusterSpec) (ClusterInfo, error) {
+	switch {
+	case !clusterName.MatchString(spec.Name):
+		return ClusterInfo{}, fmt.Errorf("%w: name must be up to 63 lowercase letters, digits, and dashes", ErrInvalidCluster)
+	case spec.Name == DefaultCluster:
+		return ClusterInfo{}, ErrClusterExists
+	case spec.Nodes < 0 || spec.Nodes > maxClusterNodes:
+		return ClusterInfo{}, fmt.Errorf("%w: nodes must be at most %d, or 0 for as many as the default cluster has", ErrInvalidCluster, maxClusterNodes)
+	}
+	tunables := s.Tunables()
+	if spec.Tunables != nil {
+		tunables = *spec.Tunables
+	}
+	if err := tunables.validate(); err != nil {
+		return ClusterInfo{}, fmt.Errorf("%w: %v", ErrInvalidCluster, err)
+	}
+	if spec.Nodes == 0 {
+		s.mu.RLock()
+		spec.Nodes = len(s.nodes)
+		s.mu.RUnlock()
+	}
+	if spec.Seed == 0 {
+		spec.Seed = time.Now().UnixNano()
+	}
+
+	t := &s.clusters
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.clusters[spec.Name]; ok {
+		return ClusterInfo{}, ErrClusterExists
+	}
+
+	// State that lives outside the process belongs to the default cluster
+	// alone.
+	cfg := s.cfg
+	cfg.Seed = spec.Seed
+	cfg.UpdateInterval = time.Duration(tunables.UpdateInterval)
+	cfg.FailProb, cfg.RecoverProb = tunables.FailProb, tunables.RecoverProb
+	cfg.GossipFanout = tunables.GossipFanout
+	cfg.Latency, cfg.Jitter = time.Duration(tunables.Latency), time.Duration(tunables.Jitter)
+	cfg.DataDir, cfg.ResultsDir, cfg.Store = "", "", nil
+	cfg.AuditWriter, cfg.Settings, cfg.Reload, cfg.Telemetry = nil, nil, nil, nil
+	cfg.Logger = s.logger.With("cluster", spec.Name)
+	if _, ok := s.cfg.Clock.(*VirtualClock); ok {
+		cfg.Clock = NewVirtualClock(s.cfg.Clock.Now())
+	} else {
+		cfg.Clock = RealClock{}
+	}
+	sim := New(cfg)
+	sim.cluster = spec.Name
+	sim.telemetry = s.telemetry // Exported alongside the default cluster's.
+	sim.Init(spec.Nodes)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &cluster{
+		sim:     sim,
+		handler: sim.withLatency(withJSONErrors(sim.routes())),
+		created: time.Now(),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go c.run(ctx)
+	if t.clusters == nil {
+		t.clusters = make(map[string]*cluster)
+	}
+	t.clusters[spec.Name] = c
+
+	s.logger.Info("cluster created", "cluster", spec.Name, "nodes", spec.Nodes, "seed", spec.Seed)
+	return c.info(spec.Name), nil
+}
+
+// run runs the cluster's clock, updater, and chaos loops until ctx is
+// cancelled.
+func (c *cluster) run(ctx context.Context) {
+	defer close(c.done)
+	var wg sync.WaitGroup
+	loops := []func(){
+		func() { c.sim.StartUpdater(ctx, c.sim.UpdateInterval()) },
+		func() { c.sim.StartChaos(ctx, c.sim.UpdateInterval()) },
+	}
+	if clock, ok := c.sim.cfg.Clock.(*VirtualClock); ok {
+		loops = append(loops, func() { clock.Run(ctx) })
+	}
+	for _, loop := range loops {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			loop()
+		}()
+	}
+	wg.Wait()
+}
+
+// info describes c, named name.
+func (c *cluster) info(name string) ClusterInfo {
+	return c.sim.clusterInfo(name, c.created)
+}
+
+// clusterInfo describes s as the cluster named name, created at created.
+func (s *Simulator) clusterInfo(name string, created time.Time) ClusterInfo {
+	info := ClusterInfo{
+		Name:    name,
+		Seed:    s.cfg.Seed,
+		Created: created,
+		Config:  s.Tunables(),
+		Stats:   s.Stats(),
+	}
+	if leader, ok := s.Leader(); ok {
+		info.Leader = &leader.ID
+	}
+	s.mu.RLock()
+	s.feedMu.Lock()
+	info.EventSeq = s.eventSeq
+	s.feedMu.Unlock()
+	if len(s.outbound) > 0 {
+		info.Replication = s.outboundLinks()
+	}
+	s.mu.RUnlock()
+	return info
+}
+
+// Clusters describes the default cluster, s itself, and then every cluster
+// created by CreateCluster, ordered by name.
+func (s *Simulator) Clusters() []ClusterInfo {
+	t := &s.clusters
+	t.mu.Lock()
+	names := make([]string, 0, len(t.clusters))
+	for name := range t.clusters {
+		names = append(names, name)
+	}
+	clusters := make([]*cluster, len(names))
+	sort.Strings(names)
+	for i, name := range names {
+		clusters[i] = t.clusters[name]
+	}
+	t.mu.Unlock()
+
+	infos := []ClusterInfo{s.clusterInfo(DefaultCluster, s.started)}
+	for i, c := range clusters {
+		infos = append(infos, c.info(names[i]))
+	}
+	return infos
+}
+
+// GetCluster describes the cluster named name. It returns ErrNoCluster if
+// there is none.
+func (s *Simulator) GetCluster(name string) (ClusterInfo, error) {
+	if name == DefaultCluster {
+		return s.clusterInfo(DefaultCluster, s.started), nil
+	}
+	s.clusters.mu.Lock()
+	c, ok := s.clusters.clusters[name]
+	s.clusters.mu.Unlock()
+	if !ok {
+		return ClusterInfo{}, ErrNoCluster
+	}
+	return c.info(name), nil
+}
+
+// DeleteCluster stops the loops of the cluster named name and the
+// replication links from and to it, waits for them to exit, and discards the
+// cluster. It returns ErrDefaultCluster for the
+// default cluster and ErrNoCluster if there is none by that name.
+func (s *Simulator) DeleteCluster(name string) error {
+	if name == DefaultCluster {
+		return ErrDefaultCluster
+	}
+	t := &s.clusters
+	t.mu.Lock()
+	c, ok := t.clusters[name]
+	delete(t.clusters, name)
+	t.mu.Unlock()
+	if !ok {
+		return ErrNoCluster
+	}
+	// Like a server shutting down, end the cluster's event streams and
+	// watches before its loops.
+	c.sim.Drain()
+	s.stopLinks(name)
+	c.cancel()
+	<-c.done
+	s.logger.Info("cluster deleted", "cluster", name)
+	return nil
+}
+
+// StopClusters deletes every cluster created by CreateCluster, waiting for
+// their loops to exit, so callers typically call it at shutdown.
+func (s *Simulator) StopClusters() {
+	s.clusters.mu.Lock()
+	names := make([]string, 0, len(s.clusters.clusters))
+	for name := range s.clusters.clusters {
+		names = append(names, name)
+	}
+	s.clusters.mu.Unlock()
+	for _, name := range names {
+		s.DeleteCluster(name)
+	}
+}
+
+// clusterRoutes is the pattern routing the API of every cluster to
+// clusterRouter.
+const clusterRoutes = "/clusters/{name}/{path...}"
+
+// clusterPath splits a path of the form "/clusters/{name}/{path...}" into
+// the cluster name and the rest of the path, with a leading slash.
+func clusterPath(path string) (name, rest string, ok bool) {
+	tail, ok := strings.CutPrefix(path, "/clusters/")
+	if !ok {
+		return "", "", false
+	}
+	name, rest, ok = strings.Cut(tail, "/")
+	return name, "/" + rest, ok && name != ""
+}
+
+// clusterRouter returns a handler serving requests for
+// "/clusters/{name}/{path...}" with the HTTP API of the cluster named name,
+// as if for path. mux serves the default cluster's.
+func (s *Simulator) clusterRouter(mux *http.ServeMux) http.Handler {
+	defaultHandler := withJSONErrors(mux)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, rest, _ := clusterPath(r.URL.Path)
+		h := defaultHandler
+		if name != DefaultCluster {
+			s.clusters.mu.Lock()
+			c, ok := s.clusters.clusters[name]
+			s.clusters.mu.Unlock()
+			if !ok {
+				writeError(w, http.StatusNotFound, "Cluster not found")
+				return
+			}
+			h = c.handler
+		}
+
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path, r2.URL.RawPath = rest, ""
+		h.ServeHTTP(w, r2)
+	})
+}
+
+// clusterRequest is the JSON payload accepted by createCluster. Config
+// holds Tunables, defaulting to the default cluster's.
+type clusterRequest struct {
+	Name   string          `json:"name"`
+	Nodes  int             `json:"nodes"`
+	Seed   int64           `json:"seed"`
+	Config json.RawMessage `json:"config"`
+}
+
+// writeClusterError writes the HTTP response for an error returned by
+// CreateCluster, GetCluster, or DeleteCluster.
+func writeClusterError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidCluster):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrNoCluster):
+		writeError(w, http.StatusNotFound, "Cluster not found")
+	case errors.Is(err, ErrClusterExists), errors.Is(err, ErrDefaultCluster):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// nestedCluster writes a 404 and returns true if s is a cluster created by
+// CreateCluster, whose API doesn't manage clusters.
+func (s *Simulator) nestedCluster(w http.ResponseWriter) bool {
+	if s.cluster == "" {
+		return false
+	}
+	writeError(w, http.StatusNotFound, "Clusters cannot be nested")
+	return true
+}
+
+// getClusters handles HTTP requests to list the clusters.
+func (s *Simulator) getClusters(w http.ResponseWriter, r *http.Request) {
+	if s.nestedCluster(w) {
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Clusters())
+}
+
+// createCluster handles HTTP requests to create a cluster.
+func (s *Simulator) createCluster(w http.ResponseWriter, r *http.Request) {
+	if s.nestedCluster(w) {
+		return
+	}
+	var payload clusterRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "Malformed JSON body")
+		return
+	}
+	spec := ClusterSpec{Name: payload.Name, Nodes: payload.Nodes, Seed: payload.Seed}
+	if payload.Config != nil {
+		tunables := s.Tunables()
+		decoder := json.NewDecoder(strings.NewReader(string(payload.Config)))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&tunables); err != nil {
+			if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("Field %s cannot be set per cluster", field))
+				return
+			}
+			writeError(w, http.StatusBadRequest, "Malformed JSON body")
+			return
+		}
+		spec.Tunables = &tunables
+	}
+
+	info, err := s.CreateCluster(spec)
+	if err != nil {
+		writeClusterError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/clusters/"+info.Name)
+	writeJSON(w, http.StatusCreated, info)
+}
+
+// getCluster handles HTTP requests to describe a cluster.
+func (s *Simulator) getCluster(w http.ResponseWriter, r *http.Request) {
+	if s.nestedCluster(w) {
+		return
+	}
+	info, err := s.GetCluster(r.PathValue("name"))
+	if err != nil {
+		writeClusterError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// deleteCluster handles HTTP requests to delete a cluster.
+func (s *Simulator) deleteCluster(w http.ResponseWriter, r *http.Request) {
+	if s.nestedCluster(w) {
+		return
+	}
+	if err := s.DeleteCluster(r.PathValue("name")); err != nil {
+		writeClusterError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
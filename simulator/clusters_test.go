@@ -0,0 +1,148 @@
+package simulator
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestClusters tests that clusters created through POST /clusters run apart
+// from each other and from the default cluster, each with the nodes its seed
+// generates, its own event log, and its own clock, and that deleting one
+// stops it.
+func TestClusters(t *testing.T) {
+	s := New(Config{Seed: 1, Clock: NewVirtualClock(time.Unix(0, 0))})
+	s.Init(testNodeCount)
+	h := s.Handler()
+	defer s.StopClusters()
+
+	for name, seed := range map[string]string{"a": "2", "b": "3"} {
+		rr := doRequest(t, h, "POST", "/clusters", `{"name": "`+name+`", "nodes": 3, "seed": `+seed+`, "config": {"update-interval": "1s"}}`)
+		expectCode(t, rr, http.StatusCreated)
+		var info ClusterInfo
+		decodeBody(t, rr, &info)
+		if info.Name != name || info.Stats.Nodes != 3 || info.Config.UpdateInterval != Duration(time.Second) || info.Config.FailProb != s.Tunables().FailProb {
+			t.Errorf("Unexpected cluster %+v", info)
+		}
+		expectCode(t, doRequest(t, h, "POST", "/clusters/"+name+"/clock/pause", ""), http.StatusOK)
+	}
+
+	// Each cluster holds the nodes its seed generates.
+	nodes := func(prefix string) []NodeData {
+		rr := doRequest(t, h, "GET", prefix+"/nodes", "")
+		expectCode(t, rr, http.StatusOK)
+		var nodes []NodeData
+		decodeBody(t, rr, &nodes)
+		return nodes
+	}
+	for name, seed := range map[string]int64{"a": 2, "b": 3} {
+		want := New(Config{Seed: seed})
+		want.Init(3)
+		got := nodes("/clusters/" + name)
+		if len(got) != 3 {
+			t.Fatalf("Expected 3 nodes in %s, got %d", name, len(got))
+		}
+		for i, node := range want.Snapshot() {
+			if got[i].Value != node.Value {
+				t.Errorf("Expected node %d of %s to have value %d, got %d", i, name, node.Value, got[i].Value)
+			}
+		}
+	}
+	if legacy, prefixed := nodes(""), nodes("/clusters/default"); len(legacy) != testNodeCount || !reflect.DeepEqual(legacy, prefixed) {
+		t.Errorf("Expected the unprefixed paths to serve the default cluster, got %d and %d nodes", len(legacy), len(prefixed))
+	}
+
+	// A change to one cluster is seen by it alone.
+	before := map[string][]NodeData{"": nodes(""), "/clusters/b": nodes("/clusters/b")}
+	expectCode(t, doRequest(t, h, "PUT", "/clusters/a/nodes/0", `{"name": "Node-0", "value": 999}`), http.StatusOK)
+	if got := nodes("/clusters/a")[0].Value; got != 999 {
+		t.Errorf("Expected node 0 of a to have value 999, got %d", got)
+	}
+	for prefix, want := range before {
+		if got := nodes(prefix); !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected the nodes of %q to be untouched, got %+v", prefix, got)
+		}
+	}
+	events := func(prefix string) []Event {
+		rr := doRequest(t, h, "GET", prefix+"/events/history", "")
+		expectCode(t, rr, http.StatusOK)
+		var page EventPage
+		decodeBody(t, rr, &page)
+		return page.Events
+	}
+	if got := events("/clusters/a"); len(got) != 1 || got[0].Seq != 1 || got[0].Node.Value != 999 {
+		t.Errorf("Expected a to log the update alone, got %+v", got)
+	}
+	if got, other := events("/clusters/b"), events(""); len(got) != 0 || len(other) != 0 {
+		t.Errorf("Expected no events in b or the default cluster, got %+v and %+v", got, other)
+	}
+
+	// Stepping a cluster's clock runs its updater alone.
+	a := s.clusters.clusters["a"].sim
+	waitFor(t, func() bool { return tickerCount(a.cfg.Clock.(*VirtualClock)) == 2 })
+	expectCode(t, doRequest(t, h, "POST", "/clusters/a/clock/step", ""), http.StatusOK)
+	waitFor(t, func() bool { return updateCount(a) == 1 })
+	if n := updateCount(s.clusters.clusters["b"].sim) + updateCount(s); n != 0 {
+		t.Errorf("Expected no updates outside a, got %d", n)
+	}
+
+	rr := doRequest(t, h, "GET", "/clusters", "")
+	expectCode(t, rr, http.StatusOK)
+	var infos []ClusterInfo
+	decodeBody(t, rr, &infos)
+	if len(infos) != 3 || infos[0].Name != DefaultCluster || infos[0].Stats.Nodes != testNodeCount || infos[1].Name != "a" || infos[1].Seed != 2 || infos[1].Stats.Updates != 1 || infos[2].Name != "b" {
+		t.Errorf("Unexpected clusters %+v", infos)
+	}
+
+	// Deleting a cluster stops it and frees its name.
+	expectCode(t, doRequest(t, h, "DELETE", "/clusters/a", ""), http.StatusNoContent)
+	expectCode(t, doRequest(t, h, "GET", "/clusters/a/nodes", ""), http.StatusNotFound)
+	expectCode(t, doRequest(t, h, "GET", "/clusters/a", ""), http.StatusNotFound)
+	expectCode(t, doRequest(t, h, "DELETE", "/clusters/a", ""), http.StatusNotFound)
+	if n := tickerCount(a.cfg.Clock.(*VirtualClock)); n != 0 {
+		t.Errorf("Expected the loops of a to have stopped, got %d tickers", n)
+	}
+	if !a.draining.Load() {
+		t.Error("Expected a to be drained")
+	}
+	expectCode(t, doRequest(t, h, "POST", "/clusters", `{"name": "a", "seed": 4}`), http.StatusCreated)
+
+	// Stopping the clusters drains every one of them.
+	b := s.clusters.clusters["b"].sim
+	s.StopClusters()
+	if !b.draining.Load() || len(s.Clusters()) != 1 {
+		t.Errorf("Expected b to be drained and deleted, got %+v", s.Clusters())
+	}
+}
+
+// TestClusterErrors tests the requests POST /clusters and DELETE
+// /clusters/{name} reject.
+func TestClusterErrors(t *testing.T) {
+	s := New(Config{Seed: 1})
+	s.Init(testNodeCount)
+	h := s.Handler()
+	defer s.StopClusters()
+
+	expectCode(t, doRequest(t, h, "POST", "/clusters", `{"name": "a"}`), http.StatusCreated)
+	for _, tt := range []struct {
+		body string
+		code int
+	}{
+		{`{"name": "a"}`, http.StatusConflict},
+		{`{"name": "default"}`, http.StatusConflict},
+		{`{"name": "Not/A/Name"}`, http.StatusBadRequest},
+		{`{"name": "c", "nodes": -1}`, http.StatusBadRequest},
+		{`{"name": "c", "nodes": 1001}`, http.StatusBadRequest},
+		{`{"name": "c", "config": {"fail-prob": 2}}`, http.StatusBadRequest},
+		{`{"name": "c", "config": {"mode": "raft"}}`, http.StatusBadRequest},
+		{`{"name": "c", "shards": 2}`, http.StatusBadRequest},
+	} {
+		if rr := doRequest(t, h, "POST", "/clusters", tt.body); rr.Code != tt.code {
+			t.Errorf("%s: expected status %d, got %d: %s", tt.body, tt.code, rr.Code, rr.Body)
+		}
+	}
+	expectCode(t, doRequest(t, h, "DELETE", "/clusters/default", ""), http.StatusConflict)
+	expectCode(t, doRequest(t, h, "GET", "/clusters/a/clusters", ""), http.StatusNotFound)
+	expectCode(t, doRequest(t, h, "GET", "/clusters/missing/nodes", ""), http.StatusNotFound)
+}
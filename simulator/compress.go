@@ -0,0 +1,150 @@
+package simulator
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// DefaultCompressMinSize is the smallest response body, in bytes, that is
+// compressed when Config.CompressMinSize is unset.
+const DefaultCompressMinSize = 1024
+
+// gzipResponseWriter compresses a JSON response once its body reaches
+// minSize bytes. Until then the status and body are held back, so a small
+// response is sent uncompressed exactly as the handler wrote it. Flushing or
+// hijacking before the decision marks the response as a stream and disables
+// compression.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	minSize int
+
+	status  int          // Status held back until the decision, or 0.
+	buf     []byte       // Body held back until the decision.
+	decided bool         // Set once the status has been sent.
+	gz      *gzip.Writer // Compressor, if the response is compressed.
+}
+
+// WriteHeader holds back code until the body size is known.
+func (g *gzipResponseWriter) WriteHeader(code int) {
+	if g.decided {
+		g.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if g.status == 0 {
+		g.status = code
+	}
+}
+
+// Write buffers b until the body reaches the threshold, then writes it
+// through the compressor.
+func (g *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !g.decided {
+		g.buf = append(g.buf, b...)
+		if len(g.buf) < g.minSize {
+			return len(b), nil
+		}
+		if err := g.decide(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if g.gz != nil {
+		return g.gz.Write(b)
+	}
+	return g.ResponseWriter.Write(b)
+}
+
+// decide sends the held-back status and body, compressing them if compress
+// is set and the response is uncompressed JSON.
+func (g *gzipResponseWriter) decide(compress bool) error {
+	g.decided = true
+	header := g.Header()
+	if strings.HasPrefix(header.Get("Content-Type"), "application/json") {
+		header.Add("Vary", "Accept-Encoding")
+	} else {
+		compress = false
+	}
+	if header.Get("Content-Encoding") != "" {
+		compress = false
+	}
+
+	if compress {
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", "gzip")
+		g.gz = gzip.NewWriter(g.ResponseWriter)
+	}
+	if g.status == 0 {
+		g.status = http.StatusOK
+	}
+	g.ResponseWriter.WriteHeader(g.status)
+
+	buf := g.buf
+	g.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := g.Write(buf)
+	return err
+}
+
+// Flush sends everything written so far. A response flushed before reaching
+// the threshold is treated as a stream and left uncompressed.
+func (g *gzipResponseWriter) Flush() {
+	if !g.decided {
+		g.decide(false)
+	}
+	if g.gz != nil {
+		g.gz.Flush()
+	}
+	if f, ok := g.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hijacks the underlying connection if nothing has been sent yet.
+func (g *gzipResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := g.ResponseWriter.(http.Hijacker)
+	if !ok || g.decided {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	g.decided = true
+	return h.Hijack()
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (g *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
+// close sends a response that never reached the threshold and finishes the
+// compressed stream of one that did.
+func (g *gzipResponseWriter) close() {
+	if !g.decided && (g.status != 0 || len(g.buf) > 0) {
+		g.decide(false)
+	}
+	if g.gz != nil {
+		g.gz.Close()
+	}
+}
+
+// withCompression gzip-compresses JSON responses of at least
+// Config.CompressMinSize bytes for clients that accept gzip, if
+// Config.Compress is set.
+func (s *Simulator) withCompression(next http.Handler) http.Handler {
+	if !s.cfg.Compress {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !acceptsGzip(r) || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipResponseWriter{ResponseWriter: w, minSize: s.cfg.CompressMinSize}
+		defer gw.close()
+		next.ServeHTTP(gw, r)
+	})
+}
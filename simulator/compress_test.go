@@ -0,0 +1,134 @@
+package simulator
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// getEncoded issues a GET request for path with the given Accept-Encoding
+// header, if any.
+func getEncoded(h http.Handler, path, acceptEncoding string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", path, nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+// gunzip returns the decompressed body of rr.
+func gunzip(t *testing.T, rr *httptest.ResponseRecorder) []byte {
+	t.Helper()
+
+	gz, err := gzip.NewReader(rr.Body)
+	if err != nil {
+		t.Fatalf("Failed to open the gzip stream: %v", err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("Failed to decompress the body: %v", err)
+	}
+	return data
+}
+
+// TestCompression tests that large JSON responses are compressed for
+// clients that accept gzip and decompress to the plain response.
+func TestCompression(t *testing.T) {
+	s := New(Config{Compress: true, CompressMinSize: 512})
+	s.Init(50)
+	h := s.Handler()
+
+	plain := getEncoded(h, "/nodes", "")
+	if got := plain.Header().Get("Content-Encoding"); got != "" {
+		t.Fatalf("Expected no encoding without Accept-Encoding, got %q", got)
+	}
+
+	compressed := getEncoded(h, "/nodes", "gzip")
+	if got := compressed.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Expected gzip encoding, got %q", got)
+	}
+	if got := strings.Join(compressed.Header().Values("Vary"), ", "); !strings.Contains(got, "Accept-Encoding") {
+		t.Errorf("Expected Vary to include Accept-Encoding, got %q", got)
+	}
+	if compressed.Body.Len() >= plain.Body.Len() {
+		t.Errorf("Expected the compressed body to be smaller than %d bytes, got %d", plain.Body.Len(), compressed.Body.Len())
+	}
+	if got := gunzip(t, compressed); !bytes.Equal(got, plain.Body.Bytes()) {
+		t.Errorf("Decompressed body differs from the plain response:\ngot  %s\nwant %s", got, plain.Body)
+	}
+
+	// Small responses and clients refusing gzip get the plain body.
+	for _, tt := range []struct{ path, acceptEncoding string }{
+		{"/nodes/0", "gzip"},
+		{"/nodes", "gzip;q=0"},
+	} {
+		rr := getEncoded(h, tt.path, tt.acceptEncoding)
+		if got := rr.Header().Get("Content-Encoding"); got != "" {
+			t.Errorf("%s with %q: expected no encoding, got %q", tt.path, tt.acceptEncoding, got)
+		}
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s with %q: expected status code %d, got %d", tt.path, tt.acceptEncoding, http.StatusOK, rr.Code)
+		}
+	}
+
+	// Status codes survive buffering.
+	rr := getEncoded(h, "/nodes/99", "gzip")
+	if rr.Code != http.StatusNotFound || rr.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected an uncompressed 404, got %d with encoding %q", rr.Code, rr.Header().Get("Content-Encoding"))
+	}
+	etag := plain.Header().Get("ETag")
+	req := httptest.NewRequest("GET", "/nodes", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+		t.Errorf("Expected an empty 304, got %d with %d bytes", rr.Code, rr.Body.Len())
+	}
+}
+
+// TestCompressionDisabled tests that nothing is compressed unless
+// Config.Compress is set.
+func TestCompressionDisabled(t *testing.T) {
+	s := New(Config{CompressMinSize: 1})
+	s.Init(50)
+
+	if got := getEncoded(s.Handler(), "/nodes", "gzip").Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Expected no encoding, got %q", got)
+	}
+}
+
+// TestCompressionSkipsStreams tests that a Server-Sent Events stream is
+// left uncompressed.
+func TestCompressionSkipsStreams(t *testing.T) {
+	s := New(Config{Compress: true, CompressMinSize: 1})
+	s.Init(testNodeCount)
+	server := httptest.NewServer(s.Handler())
+	t.Cleanup(server.Close)
+
+	req, err := http.NewRequest("GET", server.URL+"/events", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}, Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open the stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if got := resp.Header.Get("Content-Encoding"); got != "" {
+		t.Errorf("Expected an uncompressed stream, got encoding %q", got)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("Expected an event stream, got %q", got)
+	}
+}
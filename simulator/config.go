@@ -0,0 +1,353 @@
+package simulator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Setting is the effective value of a command-line option and where it came
+// from: "default", "file", "flag", "env", or SourceRuntime.
+type Setting struct {
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// Errors returned by SetTunables and Reload.
+var (
+	// ErrInvalidTunables means a change to the Tunables was rejected.
+	ErrInvalidTunables = errors.New("invalid tunables")
+
+	// ErrNoReload means Reload was called without a Config.Reload.
+	ErrNoReload = errors.New("configuration reloading is not available")
+
+	// ErrReloadFailed means Config.Reload failed to read the configuration.
+	ErrReloadFailed = errors.New("configuration reload failed")
+)
+
+// SourceRuntime is the Setting.Source of a value changed by SetTunables.
+const SourceRuntime = "runtime"
+
+// Tunables are the settings that can be changed while the simulator runs,
+// through SetTunables or PATCH /config. They are keyed by the names of the
+// command-line flags that set them at startup.
+type Tunables struct {
+	UpdateInterval Duration `json:"update-interval"` // See Config.UpdateInterval.
+	FailProb       float64  `json:"fail-prob"`       // See Config.FailProb.
+	RecoverProb    float64  `json:"recover-prob"`    // See Config.RecoverProb.
+	GossipFanout   int      `json:"gossip-fanout"`   // See Config.GossipFanout.
+	Latency        Duration `json:"latency"`         // See Config.Latency.
+	Jitter         Duration `json:"jitter"`          // See Config.Jitter.
+}
+
+// tunableState is the current Tunables. It is replaced, never modified, so
+// the loops and handlers reading it need no lock.
+type tunableState struct {
+	Tunables
+	changed chan struct{}     // Closed once the state is replaced.
+	sources map[string]string // Sources of the Tunables changed since startup, by key.
+}
+
+// validate returns an error wrapping ErrInvalidTunables if t is invalid.
+func (t Tunables) validate() error {
+	probability := func(p float64) bool { return p >= 0 && p <= 1 }
+	switch {
+	case t.UpdateInterval <= 0:
+		return fmt.Errorf("%w: update-interval must be positive", ErrInvalidTunables)
+	case !probability(t.FailProb):
+		return fmt.Errorf("%w: fail-prob must be between 0 and 1", ErrInvalidTunables)
+	case !probability(t.RecoverProb):
+		return fmt.Errorf("%w: recover-prob must be between 0 and 1", ErrInvalidTunables)
+	case t.GossipFanout < 1:
+		return fmt.Errorf("%w: gossip-fanout must be at least 1", ErrInvalidTunables)
+	case t.Latency < 0:
+		return fmt.Errorf("%w: latency must not be negative", ErrInvalidTunables)
+	case t.Jitter < 0:
+		return fmt.Errorf("%w: jitter must not be negative", ErrInvalidTunables)
+	}
+	return nil
+}
+
+// values returns t's values keyed by flag name, formatted as the flags
+// format them.
+func (t Tunables) values() map[string]string {
+	float := func(f float64) string { return strconv.FormatFloat(f, 'g', -1, 64) }
+	return map[string]string{
+		"update-interval": time.Duration(t.UpdateInterval).String(),
+		"fail-prob":       float(t.FailProb),
+		"recover-prob":    float(t.RecoverProb),
+		"gossip-fanout":   strconv.Itoa(t.GossipFanout),
+		"latency":         time.Duration(t.Latency).String(),
+		"jitter":          time.Duration(t.Jitter).String(),
+	}
+}
+
+// initTunables sets the Tunables from the Config.
+func (s *Simulator) initTunables() {
+	s.tunables.Store(&tunableState{
+		Tunables: Tunables{
+			UpdateInterval: Duration(s.cfg.UpdateInterval),
+			FailProb:       s.cfg.FailProb,
+			RecoverProb:    s.cfg.RecoverProb,
+			GossipFanout:   s.cfg.GossipFanout,
+			Latency:        Duration(s.cfg.Latency),
+			Jitter:         Duration(s.cfg.Jitter),
+		},
+		changed: make(chan struct{}),
+	})
+}
+
+// Tunables returns the current Tunables.
+func (s *Simulator) Tunables() Tunables {
+	return s.tunables.Load().Tunables
+}
+
+// set sets the tunable key, named as its flag, to value, formatted as the
+// flag takes it. It reports whether key is a tunable.
+func (t *Tunables) set(key, value string) (bool, error) {
+	var err error
+	switch key {
+	case "update-interval":
+		err = t.UpdateInterval.UnmarshalText([]byte(value))
+	case "fail-prob":
+		t.FailProb, err = strconv.ParseFloat(value, 64)
+	case "recover-prob":
+		t.RecoverProb, err = strconv.ParseFloat(value, 64)
+	case "gossip-fanout":
+		t.GossipFanout, err = strconv.Atoi(value)
+	case "latency":
+		err = t.Latency.UnmarshalText([]byte(value))
+	case "jitter":
+		err = t.Jitter.UnmarshalText([]byte(value))
+	default:
+		return false, nil
+	}
+	if err != nil {
+		return true, fmt.Errorf("%w: %s: %v", ErrInvalidTunables, key, err)
+	}
+	return true, nil
+}
+
+// SetTunables replaces the Tunables with t, taking effect at once: the loops
+// ticking at the update interval move to the new one, bandwidth is metered
+// per tick of it, and the nodes whose latency is the old Latency get the new
+// one. It returns an error wrapping ErrInvalidTunables, changing nothing, if
+// t is invalid.
+func (s *Simulator) SetTunables(t Tunables) error {
+	if err := t.validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.applyTunables(t, func(string) string { return SourceRuntime })
+	return nil
+}
+
+// applyTunables replaces the Tunables with the valid t, recording source(key)
+// as the source of every tunable it changes. The caller must hold s.mu for
+// writing.
+func (s *Simulator) applyTunables(t Tunables, source func(key string) string) {
+	old := s.tunables.Load()
+	next := &tunableState{Tunables: t, changed: make(chan struct{}), sources: maps.Clone(old.sources)}
+	if next.sources == nil {
+		next.sources = make(map[string]string)
+	}
+	before, after := old.values(), t.values()
+	for key, value := range after {
+		if value != before[key] {
+			next.sources[key] = source(key)
+			s.logger.Info("tunable changed", "key", key, "from", before[key], "to", value, "source", next.sources[key])
+		}
+	}
+	if t.UpdateInterval != old.UpdateInterval {
+		// Bandwidth windows are numbered in ticks of the old interval.
+		s.traffic.windows = nil
+	}
+	if t.Latency != old.Latency {
+		for i := range s.nodes {
+			if s.nodes[i].Latency == old.Latency {
+				s.nodes[i].Latency = t.Latency
+				s.publish(EventNodeUpdated, i)
+			}
+		}
+	}
+	s.tunables.Store(next)
+	close(old.changed)
+}
+
+// effectiveSettings returns Config.Settings with the Tunables changed since
+// startup in place of their startup values.
+func (s *Simulator) effectiveSettings() map[string]Setting {
+	settings := maps.Clone(s.cfg.Settings)
+	if settings == nil {
+		settings = map[string]Setting{}
+	}
+	state := s.tunables.Load()
+	values := state.values()
+	for key, source := range state.sources {
+		settings[key] = Setting{Value: values[key], Source: source}
+	}
+	return settings
+}
+
+// SettingChange is a setting whose reloaded value differs from its
+// effective one.
+type SettingChange struct {
+	Key    string `json:"key"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Source string `json:"source"` // Where the reloaded value came from.
+}
+
+// ReloadResult reports what Reload found changed, by key.
+type ReloadResult struct {
+	Applied []SettingChange `json:"applied"` // Tunables now at their reloaded values.
+	Ignored []SettingChange `json:"ignored"` // Settings that only take effect on restart.
+}
+
+// Reload re-reads the configuration through Config.Reload and compares
+// every setting with its effective value. The Tunables that differ take
+// their reloaded values at once, as if set by SetTunables, and the other
+// settings that differ are reported and left alone, as they only take effect
+// on restart. Settings left at their defaults on both sides, like a seed
+// drawn from the clock, are never reported. It returns ErrNoReload without
+// a Config.Reload, and an error wrapping ErrReloadFailed or
+// ErrInvalidTunables, changing nothing, if the configuration can't be read
+// or is invalid.
+func (s *Simulator) Reload() (ReloadResult, error) {
+	if s.cfg.Reload == nil {
+		return ReloadResult{}, ErrNoReload
+	}
+	reloaded, err := s.cfg.Reload()
+	if err != nil {
+		s.logger.Error("config reload failed", "err", err)
+		return ReloadResult{}, fmt.Errorf("%w: %v", ErrReloadFailed, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	effective := s.effectiveSettings()
+	keys := make([]string, 0, len(reloaded))
+	for key := range reloaded {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	t := s.Tunables()
+	result := ReloadResult{Applied: []SettingChange{}, Ignored: []SettingChange{}}
+	for _, key := range keys {
+		now, next := effective[key], reloaded[key]
+		if next.Value == now.Value || now.Source == "default" && next.Source == "default" {
+			continue
+		}
+		change := SettingChange{Key: key, From: now.Value, To: next.Value, Source: next.Source}
+		tunable, err := t.set(key, next.Value)
+		if err != nil {
+			s.logger.Error("config reload failed", "err", err)
+			return ReloadResult{}, err
+		}
+		if tunable {
+			result.Applied = append(result.Applied, change)
+		} else {
+			result.Ignored = append(result.Ignored, change)
+		}
+	}
+	if err := t.validate(); err != nil {
+		s.logger.Error("config reload failed", "err", err)
+		return ReloadResult{}, err
+	}
+
+	s.applyTunables(t, func(key string) string { return reloaded[key].Source })
+	for _, change := range result.Ignored {
+		s.logger.Warn("setting change requires a restart", "key", change.Key, "from", change.From, "to", change.To)
+	}
+	s.logger.Info("config reloaded", "applied", len(result.Applied), "ignored", len(result.Ignored))
+	return result, nil
+}
+
+// intervalTicker ticks a loop meant to run at the update interval. It ticks
+// at the interval it is started with until SetTunables changes
+// Tunables.UpdateInterval, and at the new interval from then on.
+type intervalTicker struct {
+	s      *Simulator
+	ticker Ticker
+	state  *tunableState
+}
+
+// newIntervalTicker returns an intervalTicker first ticking at interval.
+func (s *Simulator) newIntervalTicker(interval time.Duration) *intervalTicker {
+	return &intervalTicker{s: s, ticker: s.cfg.Clock.NewTicker(interval), state: s.tunables.Load()}
+}
+
+// C returns the channel of the current ticker, which changes on refresh.
+func (t *intervalTicker) C() <-chan time.Time { return t.ticker.C() }
+
+// changed returns a channel closed once the Tunables change, after which
+// refresh must be called.
+func (t *intervalTicker) changed() <-chan struct{} { return t.state.changed }
+
+// refresh picks up the current Tunables, restarting the ticker at the new
+// update interval if it changed.
+func (t *intervalTicker) refresh() {
+	next := t.s.tunables.Load()
+	if next.UpdateInterval != t.state.UpdateInterval {
+		t.ticker.Stop()
+		t.ticker = t.s.cfg.Clock.NewTicker(time.Duration(next.UpdateInterval))
+	}
+	t.state = next
+}
+
+// Stop stops the current ticker.
+func (t *intervalTicker) Stop() { t.ticker.Stop() }
+
+// getConfig handles HTTP requests for the effective configuration: the
+// Config.Settings the simulator was started with, and the Tunables changed
+// since.
+func (s *Simulator) getConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.effectiveSettings())
+}
+
+// patchConfig handles HTTP requests to change the Tunables from a body like
+// {"update-interval":"1s","fail-prob":0.1}, keyed by flag name. Keys left out
+// keep their values, and an invalid body or value changes nothing.
+func (s *Simulator) patchConfig(w http.ResponseWriter, r *http.Request) {
+	payload := s.Tunables()
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&payload); err != nil {
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Field %s cannot be changed at runtime", field))
+			return
+		}
+		writeError(w, http.StatusBadRequest, "Malformed JSON body")
+		return
+	}
+	if err := s.SetTunables(payload); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, s.effectiveSettings())
+}
+
+// reloadConfig handles HTTP requests to reload the configuration. A
+// configuration that can't be read or is invalid is reported with a 500,
+// having changed nothing.
+func (s *Simulator) reloadConfig(w http.ResponseWriter, r *http.Request) {
+	result, err := s.Reload()
+	switch {
+	case errors.Is(err, ErrNoReload):
+		writeError(w, http.StatusConflict, "Configuration reloading is not available")
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, result)
+	}
+}
@@ -0,0 +1,204 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestGetConfig tests that GET /config serves the settings the simulator
+// was configured with, and an empty object without any.
+func TestGetConfig(t *testing.T) {
+	settings := map[string]Setting{
+		"nodes":   {Value: "8", Source: "file"},
+		"api-key": {Value: "[redacted]", Source: "env"},
+	}
+	s := New(Config{Seed: 1, Settings: settings})
+	rr := doRequest(t, s.Handler(), "GET", "/config", "")
+	expectCode(t, rr, http.StatusOK)
+	var got map[string]Setting
+	decodeBody(t, rr, &got)
+	if len(got) != 2 || got["nodes"] != settings["nodes"] || got["api-key"] != settings["api-key"] {
+		t.Errorf("Expected %+v, got %+v", settings, got)
+	}
+
+	rr = doRequest(t, New(Config{Seed: 1}).Handler(), "GET", "/config", "")
+	if body := rr.Body.String(); body != "{}" {
+		t.Errorf("Expected an empty object, got %q", body)
+	}
+}
+
+// TestPatchConfig tests that PATCH /config changes the given tunables and
+// nothing else, takes effect on chaos and latency at once, and rejects
+// invalid patches as a whole.
+func TestPatchConfig(t *testing.T) {
+	settings := map[string]Setting{
+		"fail-prob": {Value: "0", Source: "default"},
+		"jitter":    {Value: "0s", Source: "default"},
+	}
+	s := New(Config{Seed: 1, Latency: 10 * time.Millisecond, Settings: settings})
+	s.Init(testNodeCount)
+	s.SetLatency(2, 50*time.Millisecond)
+	h := s.Handler()
+
+	initial := s.Tunables()
+	for _, body := range []string{
+		`{"fail-prob":1,"jitter":"-1s"}`,
+		`{"fail-prob":1,"nodes":3}`,
+		`{"update-interval":"0s"}`,
+		`{"gossip-fanout":0}`,
+		`{"recover-prob":1.5}`,
+		`{"latency":"soon"}`,
+	} {
+		rr := doRequest(t, h, "PATCH", "/config", body)
+		expectCode(t, rr, http.StatusBadRequest)
+		if got := s.Tunables(); got != initial {
+			t.Errorf("%s: expected no change, got %+v", body, got)
+		}
+	}
+	if rr := doRequest(t, h, "PATCH", "/config", `{"nodes":3}`); !strings.Contains(rr.Body.String(), `Field \"nodes\" cannot be changed at runtime`) {
+		t.Errorf("Expected the unknown key named, got %s", rr.Body)
+	}
+
+	rr := doRequest(t, h, "PATCH", "/config", `{"fail-prob":1,"latency":"20ms"}`)
+	expectCode(t, rr, http.StatusOK)
+	var got map[string]Setting
+	decodeBody(t, rr, &got)
+	if got["fail-prob"] != (Setting{Value: "1", Source: SourceRuntime}) || got["latency"] != (Setting{Value: "20ms", Source: SourceRuntime}) || got["jitter"] != settings["jitter"] {
+		t.Errorf("Expected the patched settings from the runtime, got %+v", got)
+	}
+	want := initial
+	want.FailProb, want.Latency = 1, Duration(20*time.Millisecond)
+	if got := s.Tunables(); got != want {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+
+	// The chaos loop fails a node on its next tick, and nodes at the old base
+	// latency move to the new one.
+	s.chaosStep()
+	if stats := s.ChaosStats(); stats.CurrentlyDown != 1 {
+		t.Errorf("Expected the new fail probability to fail a node, got %+v", stats)
+	}
+	for id, want := range map[int]time.Duration{0: 20 * time.Millisecond, 2: 50 * time.Millisecond} {
+		if node, _ := s.Node(id); time.Duration(node.Latency) != want {
+			t.Errorf("Expected node %d at %v, got %v", id, want, node.Latency)
+		}
+	}
+	if latency := s.requestLatency("/kv/x", ""); latency != 20*time.Millisecond {
+		t.Errorf("Expected requests at the new latency, got %v", latency)
+	}
+}
+
+// TestPatchConfigInterval tests that changing the update interval at
+// runtime changes how often a running updater ticks.
+func TestPatchConfigInterval(t *testing.T) {
+	clock := NewVirtualClock(time.Unix(0, 0))
+	clock.Pause()
+	s := New(Config{Seed: 1, Clock: clock, UpdateInterval: 5 * time.Second})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.StartUpdater(ctx, s.UpdateInterval())
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	tickingEvery := func(interval time.Duration) bool {
+		clock.mu.Lock()
+		defer clock.mu.Unlock()
+		return len(clock.tickers) == 1 && clock.tickers[0].interval == interval
+	}
+	waitFor(t, func() bool { return tickingEvery(5 * time.Second) })
+
+	// step advances the clock to the next tick and waits for its update.
+	step := func(updates int, at time.Duration) {
+		t.Helper()
+		if err := clock.Step(); err != nil {
+			t.Fatalf("Step failed: %v", err)
+		}
+		waitFor(t, func() bool { return updateCount(s) == updates })
+		if now := clock.Now(); !now.Equal(time.Unix(0, 0).Add(at)) {
+			t.Errorf("Expected update %d at %v, got %v", updates, at, now.Sub(time.Unix(0, 0)))
+		}
+	}
+	step(1, 5*time.Second)
+
+	expectCode(t, doRequest(t, h, "PATCH", "/config", `{"update-interval":"2s"}`), http.StatusOK)
+	waitFor(t, func() bool { return tickingEvery(2 * time.Second) })
+	if got := s.UpdateInterval(); got != 2*time.Second {
+		t.Errorf("Expected an update interval of 2s, got %v", got)
+	}
+	step(2, 7*time.Second)
+	step(3, 9*time.Second)
+
+	// Changing another tunable leaves the ticker alone.
+	expectCode(t, doRequest(t, h, "PATCH", "/config", `{"recover-prob":0.5}`), http.StatusOK)
+	step(4, 11*time.Second)
+}
+
+// TestReload tests that Reload applies the tunables whose reloaded values
+// differ, reports the other changed settings as ignored, skips settings at
+// their defaults on both sides, and changes nothing on failure.
+func TestReload(t *testing.T) {
+	if _, err := New(Config{Seed: 1}).Reload(); !errors.Is(err, ErrNoReload) {
+		t.Errorf("Expected ErrNoReload, got %v", err)
+	}
+
+	startup := map[string]Setting{
+		"seed":      {Value: "1", Source: "default"},
+		"nodes":     {Value: "5", Source: "flag"},
+		"fail-prob": {Value: "0", Source: "default"},
+		"latency":   {Value: "0s", Source: "default"},
+	}
+	var reloaded map[string]Setting
+	var reloadErr error
+	s := New(Config{Seed: 1, Settings: startup, Reload: func() (map[string]Setting, error) { return reloaded, reloadErr }})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	reloaded = map[string]Setting{
+		"seed":      {Value: "2", Source: "default"},
+		"nodes":     {Value: "7", Source: "env"},
+		"fail-prob": {Value: "0.25", Source: "file"},
+		"latency":   {Value: "0s", Source: "default"},
+	}
+	rr := doRequest(t, h, "POST", "/config/reload", "")
+	expectCode(t, rr, http.StatusOK)
+	var result ReloadResult
+	decodeBody(t, rr, &result)
+	want := ReloadResult{
+		Applied: []SettingChange{{Key: "fail-prob", From: "0", To: "0.25", Source: "file"}},
+		Ignored: []SettingChange{{Key: "nodes", From: "5", To: "7", Source: "env"}},
+	}
+	if !reflect.DeepEqual(result, want) {
+		t.Errorf("Expected %+v, got %+v", want, result)
+	}
+	if got := s.Tunables().FailProb; got != 0.25 {
+		t.Errorf("Expected fail-prob 0.25, got %v", got)
+	}
+	if got := s.effectiveSettings()["fail-prob"]; got != (Setting{Value: "0.25", Source: "file"}) {
+		t.Errorf("Expected the reloaded fail-prob from the file, got %+v", got)
+	}
+
+	// Failures change nothing.
+	before := s.Tunables()
+	reloaded = map[string]Setting{"fail-prob": {Value: "0.5", Source: "file"}, "latency": {Value: "-1s", Source: "file"}}
+	expectCode(t, doRequest(t, h, "POST", "/config/reload", ""), http.StatusInternalServerError)
+	reloaded, reloadErr = nil, errors.New("sim.yaml: line 2: unknown key")
+	if _, err := s.Reload(); !errors.Is(err, ErrReloadFailed) || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected the read error wrapped in ErrReloadFailed, got %v", err)
+	}
+	if got := s.Tunables(); got != before {
+		t.Errorf("Expected no change after failed reloads, got %+v", got)
+	}
+}
@@ -0,0 +1,127 @@
+package simulator
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Consistency levels of a key-value read from a single replica.
+const (
+	// ConsistencyStrong reads go to the key's primary: the first of its
+	// replicas that is up.
+	ConsistencyStrong = "strong"
+
+	// ConsistencyBounded reads go to a random replica if its copy is at most
+	// the read's maximum staleness old, and to the primary otherwise.
+	ConsistencyBounded = "bounded"
+
+	// ConsistencyEventual reads go to a random replica, whatever its copy.
+	ConsistencyEventual = "eventual"
+)
+
+// ErrInvalidConsistency means a read asked for an unknown consistency level
+// or a negative staleness bound.
+var ErrInvalidConsistency = errors.New("invalid consistency")
+
+// ReplicaRead describes a key-value read served by a single replica.
+type ReplicaRead struct {
+	Key         string `json:"key"`
+	Value       string `json:"value"`
+	Version     uint64 `json:"version"`
+	Consistency string `json:"consistency"`
+	ServedBy    int    `json:"served_by"` // ID of the replica that served the read.
+	Primary     bool   `json:"primary"`   // Whether that replica is the key's primary.
+
+	// FellBack is set on a bounded read that a replica couldn't serve
+	// within the staleness bound, so it went to the primary.
+	FellBack bool `json:"fell_back,omitempty"`
+
+	Age     Duration `json:"age"`     // How long ago the copy read was written.
+	Latency Duration `json:"latency"` // Simulated latency of reaching the replica that served the read.
+}
+
+// KVRead reads key from a single replica chosen by consistency, one of
+// ConsistencyStrong, ConsistencyBounded, and ConsistencyEventual. A bounded
+// read accepts a copy at most maxStaleness old. Unlike KVGet, it contacts no
+// quorum and repairs nothing, so a replica that missed a write serves the
+// older copy, and even the primary's copy is only current when W is N or the
+// copy has been replicated since. Latency is that of a client in region.
+// It returns an error wrapping ErrInvalidConsistency for an unknown
+// consistency or a negative maxStaleness, ErrQuorumUnavailable if no
+// replica of key is up, and ErrKeyNotFound if the replica read doesn't hold
+// the key or its copy has expired.
+func (s *Simulator) KVRead(key, consistency string, maxStaleness time.Duration, region string) (ReplicaRead, error) {
+	switch {
+	case consistency != ConsistencyStrong && consistency != ConsistencyBounded && consistency != ConsistencyEventual:
+		return ReplicaRead{}, fmt.Errorf("%w %q, expected strong, bounded, or eventual", ErrInvalidConsistency, consistency)
+	case maxStaleness < 0:
+		return ReplicaRead{}, fmt.Errorf("%w: max staleness must not be negative", ErrInvalidConsistency)
+	}
+
+	// Choosing a replica consumes the random source.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var up []int
+	for _, id := range s.preferenceList(key, s.cfg.N) {
+		if s.nodes[s.findNode(id)].Status == StatusUp {
+			up = append(up, id)
+		}
+	}
+	if len(up) == 0 {
+		return ReplicaRead{}, fmt.Errorf("%w: need 1, have 0", ErrQuorumUnavailable)
+	}
+
+	now := time.Now()
+	read := ReplicaRead{Key: key, Consistency: consistency, ServedBy: up[0]}
+	if consistency != ConsistencyStrong {
+		read.ServedBy = up[s.rng.Intn(len(up))]
+	}
+	entry, ok := s.replicaData[read.ServedBy][key]
+	if consistency == ConsistencyBounded && read.ServedBy != up[0] && (!ok || now.Sub(entry.Time) > maxStaleness) {
+		read.ServedBy, read.FellBack = up[0], true
+		entry, ok = s.replicaData[up[0]][key]
+	}
+	read.Primary = read.ServedBy == up[0]
+	read.Latency = Duration(s.nodeLatency(&s.nodes[s.findNode(read.ServedBy)], region))
+	if !ok || !entry.live(s.cfg.Clock.Now()) {
+		return read, ErrKeyNotFound
+	}
+	entry = s.replyEntry(read.ServedBy, entry)
+	read.Value, read.Version, read.Age = entry.Value, entry.Version, Duration(now.Sub(entry.Time))
+	return read, nil
+}
+
+// getKVConsistent handles HTTP requests to read a key from a single replica
+// with a consistency query parameter, and a max_staleness duration for
+// bounded reads.
+func (s *Simulator) getKVConsistent(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	var maxStaleness time.Duration
+	consistency := values.Get("consistency")
+	if consistency == ConsistencyBounded {
+		raw := values.Get("max_staleness")
+		if raw == "" {
+			writeError(w, http.StatusBadRequest, "Query parameter \"max_staleness\" is required for bounded reads")
+			return
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 {
+			writeError(w, http.StatusBadRequest, "Query parameter \"max_staleness\" must be a non-negative duration")
+			return
+		}
+		maxStaleness = d
+	}
+
+	read, err := s.KVRead(r.PathValue("key"), consistency, maxStaleness, s.clientRegion(r))
+	switch {
+	case errors.Is(err, ErrInvalidConsistency):
+		writeError(w, http.StatusBadRequest, "Query parameter \"consistency\" must be strong, bounded, or eventual")
+	case err != nil:
+		writeKVError(w, err)
+	default:
+		writeJSON(w, http.StatusOK, read)
+	}
+}
@@ -0,0 +1,75 @@
+package simulator
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestKVReadConsistency tests that strong reads go to the primary, eventual
+// reads to any replica, and bounded reads to a replica only while its copy
+// is within the staleness bound.
+func TestKVReadConsistency(t *testing.T) {
+	s := New(Config{Seed: 1, N: 3, R: 1, W: 3})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	if _, err := s.KVPut("color", "blue"); err != nil {
+		t.Fatalf("KVPut failed: %v", err)
+	}
+	// The replicas other than the primary hold a copy a minute old.
+	s.mu.Lock()
+	replicas := s.preferenceList("color", 3)
+	primary := replicas[0]
+	for _, id := range replicas[1:] {
+		s.storeReplica(id, "color", KVEntry{Value: "red", Time: time.Now().Add(-time.Minute)})
+	}
+	s.mu.Unlock()
+	s.SetLatency(primary, 50*time.Millisecond)
+
+	reads := func(query string) map[int]ReplicaRead {
+		t.Helper()
+		served := make(map[int]ReplicaRead)
+		for i := 0; i < 30; i++ {
+			var read ReplicaRead
+			rr := doRequest(t, h, "GET", "/kv/color?"+query, "")
+			expectCode(t, rr, http.StatusOK)
+			decodeBody(t, rr, &read)
+			served[read.ServedBy] = read
+		}
+		return served
+	}
+
+	for id, read := range reads("consistency=strong") {
+		if id != primary || read.Value != "blue" || !read.Primary || read.Latency != Duration(50*time.Millisecond) {
+			t.Errorf("Expected strong reads to get blue from the primary, got %+v", read)
+		}
+	}
+	eventual := reads("consistency=eventual")
+	if len(eventual) != 3 {
+		t.Errorf("Expected eventual reads to reach all 3 replicas, got %+v", eventual)
+	}
+	for id, read := range eventual {
+		if id != primary && (read.Value != "red" || read.Age < Duration(time.Minute)) {
+			t.Errorf("Expected replica %d to serve its minute-old copy, got %+v", id, read)
+		}
+	}
+	fellBack := false
+	for id, read := range reads("consistency=bounded&max_staleness=10s") {
+		fellBack = fellBack || read.FellBack
+		if id != primary || read.Value != "blue" {
+			t.Errorf("Expected bounded reads to fall back to the primary, got %+v", read)
+		}
+	}
+	if !fellBack {
+		t.Error("Expected some bounded reads to fall back")
+	}
+	if served := reads("consistency=bounded&max_staleness=2m"); len(served) != 3 {
+		t.Errorf("Expected a looser bound to accept every replica, got %+v", served)
+	}
+
+	for _, query := range []string{"consistency=linear", "consistency=bounded", "consistency=bounded&max_staleness=-1s"} {
+		expectCode(t, doRequest(t, h, "GET", "/kv/color?"+query, ""), http.StatusBadRequest)
+	}
+	expectCode(t, doRequest(t, h, "GET", "/kv/missing?consistency=strong", ""), http.StatusNotFound)
+}
@@ -0,0 +1,57 @@
+package simulator
+
+import (
+	"net/http"
+	"slices"
+)
+
+// Headers browsers may read from and send to the API across origins.
+const (
+	corsExposedHeaders = "ETag, X-Request-ID, X-Keys-Moved, X-Total-Count, X-Next-Offset"
+	corsAllowedMethods = "GET, POST, PUT, PATCH, DELETE, OPTIONS"
+	corsAllowedHeaders = "Content-Type, Accept, Authorization, If-Match, If-None-Match, X-API-Key, X-Client-Region, X-Request-ID"
+	corsMaxAge         = "600"
+)
+
+// withCORS lets browsers on the origins in Config.CORSOrigins call the API.
+// It answers preflight requests itself and adds CORS headers to every
+// response for an allowed origin. Requests from other origins are served
+// without CORS headers, so the browser blocks them.
+func (s *Simulator) withCORS(next http.Handler) http.Handler {
+	if len(s.cfg.CORSOrigins) == 0 {
+		return next
+	}
+	wildcard := slices.Contains(s.cfg.CORSOrigins, "*")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		header := w.Header()
+		header.Add("Vary", "Origin")
+		allowed := wildcard || slices.Contains(s.cfg.CORSOrigins, origin)
+		if allowed {
+			if wildcard {
+				header.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				header.Set("Access-Control-Allow-Origin", origin)
+			}
+			header.Set("Access-Control-Expose-Headers", corsExposedHeaders)
+		}
+
+		if !preflight {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if allowed {
+			header.Set("Access-Control-Allow-Methods", corsAllowedMethods)
+			header.Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+			header.Set("Access-Control-Max-Age", corsMaxAge)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,94 @@
+package simulator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// corsRequest issues a request with the given method and Origin header.
+func corsRequest(h http.Handler, method, path, origin string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Origin", origin)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+// TestCORSPreflight tests that preflight requests from allowed origins are
+// answered with the allowed methods and headers.
+func TestCORSPreflight(t *testing.T) {
+	s := New(Config{CORSOrigins: []string{"http://dashboard.test"}})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	preflight := http.Header{"Access-Control-Request-Method": {"PUT"}}
+	rr := corsRequest(h, "OPTIONS", "/nodes/1", "http://dashboard.test", preflight)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, got %d", http.StatusNoContent, rr.Code)
+	}
+	for name, want := range map[string]string{
+		"Access-Control-Allow-Origin":  "http://dashboard.test",
+		"Access-Control-Allow-Methods": corsAllowedMethods,
+		"Access-Control-Allow-Headers": corsAllowedHeaders,
+		"Access-Control-Max-Age":       corsMaxAge,
+	} {
+		if got := rr.Header().Get(name); got != want {
+			t.Errorf("Expected %s %q, got %q", name, want, got)
+		}
+	}
+
+	// The routes changing part of a resource are PATCH routes.
+	patch := http.Header{"Access-Control-Request-Method": {"PATCH"}}
+	rr = corsRequest(h, "OPTIONS", "/nodes/1/metadata", "http://dashboard.test", patch)
+	if got := rr.Header().Get("Access-Control-Allow-Methods"); rr.Code != http.StatusNoContent || !slices.Contains(strings.Split(got, ", "), "PATCH") {
+		t.Errorf("Expected a PATCH preflight allowed, got %d with methods %q", rr.Code, got)
+	}
+
+	rr = corsRequest(h, "OPTIONS", "/nodes/1", "http://evil.test", preflight)
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status code %d for a disallowed preflight, got %d", http.StatusNoContent, rr.Code)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Expected no CORS headers for a disallowed origin, got %q", got)
+	}
+}
+
+// TestCORSOrigins tests the CORS headers on simple requests.
+func TestCORSOrigins(t *testing.T) {
+	tests := []struct {
+		name    string
+		origins []string
+		origin  string
+		want    string
+	}{
+		{"allowed", []string{"http://a.test", "http://dashboard.test"}, "http://dashboard.test", "http://dashboard.test"},
+		{"disallowed", []string{"http://a.test"}, "http://evil.test", ""},
+		{"wildcard", []string{"*"}, "http://anything.test", "*"},
+		{"disabled", nil, "http://dashboard.test", ""},
+	}
+	for _, tt := range tests {
+		s := New(Config{CORSOrigins: tt.origins})
+		s.Init(testNodeCount)
+
+		rr := corsRequest(s.Handler(), "GET", "/nodes", tt.origin, nil)
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: expected status code %d, got %d", tt.name, http.StatusOK, rr.Code)
+		}
+		if got := rr.Header().Get("Access-Control-Allow-Origin"); got != tt.want {
+			t.Errorf("%s: expected Access-Control-Allow-Origin %q, got %q", tt.name, tt.want, got)
+		}
+		wantExposed := ""
+		if tt.want != "" {
+			wantExposed = corsExposedHeaders
+		}
+		if got := rr.Header().Get("Access-Control-Expose-Headers"); got != wantExposed {
+			t.Errorf("%s: expected exposed headers %q, got %q", tt.name, wantExposed, got)
+		}
+	}
+}
@@ -0,0 +1,390 @@
+package simulator
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+// PNCounter is a counter CRDT that supports increments and decrements. Each
+// node only adds to its own entries, and two counters merge by taking the
+// maximum of every entry, so replicas converge whatever order they merge in.
+type PNCounter struct {
+	P map[int]uint64 `json:"p"` // Increments by node ID.
+	N map[int]uint64 `json:"n"` // Decrements by node ID.
+}
+
+// Value returns the sum of the increments minus the sum of the decrements.
+func (c PNCounter) Value() int64 {
+	var v int64
+	for _, n := range c.P {
+		v += int64(n)
+	}
+	for _, n := range c.N {
+		v -= int64(n)
+	}
+	return v
+}
+
+// add records delta as a contribution of the node with the given ID.
+func (c *PNCounter) add(id int, delta int64) {
+	if c.P == nil {
+		c.P, c.N = make(map[int]uint64), make(map[int]uint64)
+	}
+	if delta >= 0 {
+		c.P[id] += uint64(delta)
+	} else {
+		c.N[id] += uint64(-delta)
+	}
+}
+
+// merge folds other into c.
+func (c *PNCounter) merge(other PNCounter) {
+	if c.P == nil {
+		c.P, c.N = make(map[int]uint64), make(map[int]uint64)
+	}
+	for id, n := range other.P {
+		c.P[id] = max(c.P[id], n)
+	}
+	for id, n := range other.N {
+		c.N[id] = max(c.N[id], n)
+	}
+}
+
+// clone returns a copy of c that shares no memory with it.
+func (c PNCounter) clone() PNCounter {
+	var copied PNCounter
+	copied.merge(c)
+	return copied
+}
+
+// LWWRegister is a last-writer-wins register CRDT. Of two writes, the one
+// with the later hybrid logical clock timestamp wins, and the one from the
+// node with the higher ID breaks ties. A write made after seeing another
+// therefore wins even if its node's wall clock is behind.
+type LWWRegister struct {
+	Value string `json:"value"`
+	HLC   HLC    `json:"hlc"`
+	Node  int    `json:"node"` // ID of the node that made the write.
+}
+
+// newer reports whether r wins over other.
+func (r LWWRegister) newer(other LWWRegister) bool {
+	if c := r.HLC.Compare(other.HLC); c != 0 {
+		return c > 0
+	}
+	return r.Node > other.Node
+}
+
+// crdtState holds one node's replicas of the CRDTs.
+type crdtState struct {
+	counters  map[string]PNCounter
+	registers map[string]LWWRegister
+}
+
+// CounterState describes a counter across the cluster.
+type CounterState struct {
+	Name string `json:"name"`
+
+	// Value and Contributions are those of the counter merged from every
+	// node's replica, that is, what the nodes converge to.
+	Value         int64         `json:"value"`
+	Contributions map[int]int64 `json:"contributions"` // Net contribution by node ID.
+
+	Replicas  []CounterReplica `json:"replicas"`
+	Converged bool             `json:"converged"` // Every node's replica has Value.
+}
+
+// CounterReplica is one node's replica of a counter.
+type CounterReplica struct {
+	ID    int   `json:"id"`
+	Value int64 `json:"value"`
+}
+
+// RegisterState describes a register across the cluster.
+type RegisterState struct {
+	Name      string            `json:"name"`
+	Register  LWWRegister       `json:"register"` // The winning write.
+	Replicas  []RegisterReplica `json:"replicas"`
+	Converged bool              `json:"converged"` // Every node's replica holds Register.
+}
+
+// RegisterReplica is one node's replica of a register. Register is nil if
+// the node has not seen any write to it.
+type RegisterReplica struct {
+	ID       int          `json:"id"`
+	Register *LWWRegister `json:"register"`
+}
+
+// ErrCRDTNotFound means no node holds a CRDT with the given name.
+var ErrCRDTNotFound = errors.New("CRDT not found")
+
+// crdtsOf returns the CRDT replicas of the node with the given ID, creating
+// them if needed. The caller must hold s.mu for writing.
+func (s *Simulator) crdtsOf(id int) *crdtState {
+	state := s.crdts[id]
+	if state == nil {
+		state = &crdtState{counters: make(map[string]PNCounter), registers: make(map[string]LWWRegister)}
+		s.crdts[id] = state
+	}
+	return state
+}
+
+// IncrementCounter adds delta, which may be negative, to the named counter
+// on the node with the given ID. The change reaches the other nodes through
+// gossip. It returns ErrNodeNotFound or ErrNodeDown if the node cannot
+// accept the increment.
+func (s *Simulator) IncrementCounter(name string, id int, delta int64) (CounterState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.upNode(id); err != nil {
+		return CounterState{}, err
+	}
+	state := s.crdtsOf(id)
+	counter := state.counters[name]
+	counter.add(id, delta)
+	state.counters[name] = counter
+	s.logger.Debug("counter incremented", "name", name, "node_id", id, "delta", delta)
+	return s.counterState(name), nil
+}
+
+// Counter returns the named counter across the cluster. It returns
+// ErrCRDTNotFound if no node holds it.
+func (s *Simulator) Counter(name string) (CounterState, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, state := range s.crdts {
+		if _, ok := state.counters[name]; ok {
+			return s.counterState(name), nil
+		}
+	}
+	return CounterState{}, ErrCRDTNotFound
+}
+
+// counterState builds the CounterState of the named counter. The caller must
+// hold s.mu.
+func (s *Simulator) counterState(name string) CounterState {
+	var merged PNCounter
+	for _, id := range s.crdtIDs() {
+		merged.merge(s.crdts[id].counters[name])
+	}
+	cs := CounterState{Name: name, Value: merged.Value(), Contributions: make(map[int]int64), Converged: true}
+	for id, n := range merged.P {
+		cs.Contributions[id] += int64(n)
+	}
+	for id, n := range merged.N {
+		cs.Contributions[id] -= int64(n)
+	}
+	for i := range s.nodes {
+		id := s.nodes[i].ID
+		var value int64
+		if state := s.crdts[id]; state != nil {
+			value = state.counters[name].Value()
+		}
+		cs.Replicas = append(cs.Replicas, CounterReplica{ID: id, Value: value})
+		cs.Converged = cs.Converged && value == cs.Value
+	}
+	return cs
+}
+
+// SetRegister writes value to the named register on the node with the given
+// ID. The write reaches the other nodes through gossip. It returns
+// ErrNodeNotFound or ErrNodeDown if the node cannot accept the write.
+func (s *Simulator) SetRegister(name string, id int, value string) (RegisterState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, err := s.upNode(id)
+	if err != nil {
+		return RegisterState{}, err
+	}
+	write := LWWRegister{Value: value, HLC: s.nodes[index].stamp(), Node: id}
+	s.version++ // The node's Clock moved.
+	state := s.crdtsOf(id)
+	if current, ok := state.registers[name]; !ok || write.newer(current) {
+		state.registers[name] = write
+	}
+	s.logger.Debug("register set", "name", name, "node_id", id)
+	return s.registerState(name), nil
+}
+
+// Register returns the named register across the cluster. It returns
+// ErrCRDTNotFound if no node holds it.
+func (s *Simulator) Register(name string) (RegisterState, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, state := range s.crdts {
+		if _, ok := state.registers[name]; ok {
+			return s.registerState(name), nil
+		}
+	}
+	return RegisterState{}, ErrCRDTNotFound
+}
+
+// registerState builds the RegisterState of the named register. The caller
+// must hold s.mu.
+func (s *Simulator) registerState(name string) RegisterState {
+	rs := RegisterState{Name: name, Converged: true}
+	found := false
+	for _, id := range s.crdtIDs() {
+		if r, ok := s.crdts[id].registers[name]; ok && (!found || r.newer(rs.Register)) {
+			rs.Register, found = r, true
+		}
+	}
+	for i := range s.nodes {
+		replica := RegisterReplica{ID: s.nodes[i].ID}
+		if state := s.crdts[replica.ID]; state != nil {
+			if r, ok := state.registers[name]; ok {
+				replica.Register = &r
+			}
+		}
+		rs.Replicas = append(rs.Replicas, replica)
+		rs.Converged = rs.Converged && replica.Register != nil && !rs.Register.newer(*replica.Register)
+	}
+	return rs
+}
+
+// crdtIDs returns the IDs of the nodes holding CRDT replicas, sorted. The
+// caller must hold s.mu.
+func (s *Simulator) crdtIDs() []int {
+	ids := make([]int, 0, len(s.crdts))
+	for id := range s.crdts {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// mergeCRDTs sends the CRDT replicas of each of the nodes with IDs a and b to
+// the other, which merges them into its own, unless the message is lost.
+// The receiver's hybrid logical clock moves past the sender's. Nodes without
+// CRDTs send nothing. The caller must hold s.mu for writing.
+func (s *Simulator) mergeCRDTs(a, b int) {
+	for _, pair := range [][2]int{{a, b}, {b, a}} {
+		from, to := pair[0], pair[1]
+		src := s.crdts[from]
+		if src == nil || !s.deliver(from, to) {
+			continue
+		}
+		s.nodes[s.findNode(to)].observe(s.nodes[s.findNode(from)].stamp())
+		s.version++ // Both nodes' Clocks moved.
+		dst := s.crdtsOf(to)
+		for name, counter := range src.counters {
+			merged := dst.counters[name].clone()
+			merged.merge(counter)
+			dst.counters[name] = merged
+		}
+		for name, r := range src.registers {
+			if current, ok := dst.registers[name]; !ok || r.newer(current) {
+				dst.registers[name] = r
+			}
+		}
+	}
+}
+
+// writeCRDTError maps a CRDT error to an HTTP error response.
+func writeCRDTError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNodeNotFound):
+		writeError(w, http.StatusNotFound, "Node not found")
+	case errors.Is(err, ErrCRDTNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrNodeDown):
+		writeError(w, http.StatusServiceUnavailable, "Node is down")
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// parseCRDTNode returns the node ID given in the "node" query parameter,
+// writing a 400 response if it is missing or invalid.
+func parseCRDTNode(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.URL.Query().Get("node"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Query parameter \"node\" must be a node ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// incrementCounter handles HTTP requests to add the "delta" query parameter,
+// 1 by default, to a counter on the node given by the "node" query
+// parameter.
+func (s *Simulator) incrementCounter(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseCRDTNode(w, r)
+	if !ok {
+		return
+	}
+	delta := int64(1)
+	if raw := r.URL.Query().Get("delta"); raw != "" {
+		var err error
+		if delta, err = strconv.ParseInt(raw, 10, 64); err != nil {
+			writeError(w, http.StatusBadRequest, "Query parameter \"delta\" must be an integer")
+			return
+		}
+	}
+
+	counter, err := s.IncrementCounter(r.PathValue("name"), id, delta)
+	if err != nil {
+		writeCRDTError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, counter)
+}
+
+// getCounter handles HTTP requests to read a counter across the cluster.
+func (s *Simulator) getCounter(w http.ResponseWriter, r *http.Request) {
+	counter, err := s.Counter(r.PathValue("name"))
+	if err != nil {
+		writeCRDTError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, counter)
+}
+
+// registerRequest is the JSON payload accepted by putRegister.
+type registerRequest struct {
+	Value *string `json:"value"`
+}
+
+// putRegister handles HTTP requests to write a register on the node given by
+// the "node" query parameter from a body like {"value":"v"}.
+func (s *Simulator) putRegister(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseCRDTNode(w, r)
+	if !ok {
+		return
+	}
+	var payload registerRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "Malformed JSON body")
+		return
+	}
+	if payload.Value == nil {
+		writeError(w, http.StatusBadRequest, "Field \"value\" is required")
+		return
+	}
+
+	register, err := s.SetRegister(r.PathValue("name"), id, *payload.Value)
+	if err != nil {
+		writeCRDTError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, register)
+}
+
+// getRegister handles HTTP requests to read a register across the cluster.
+func (s *Simulator) getRegister(w http.ResponseWriter, r *http.Request) {
+	register, err := s.Register(r.PathValue("name"))
+	if err != nil {
+		writeCRDTError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, register)
+}
@@ -0,0 +1,122 @@
+package simulator
+
+import (
+	"net/http"
+	"testing"
+)
+
+// gossipUntil runs gossip rounds until done reports true, failing the test
+// after 100 rounds.
+func gossipUntil(t *testing.T, s *Simulator, done func() bool) {
+	t.Helper()
+	for round := 0; round < 100; round++ {
+		if done() {
+			return
+		}
+		s.GossipRound()
+	}
+	t.Fatalf("Expected gossip to converge within 100 rounds")
+}
+
+// TestCRDTCounter tests that increments made on both sides of a partition
+// merge to their sum once the partition heals.
+func TestCRDTCounter(t *testing.T) {
+	s := New(Config{Seed: 1})
+	s.Init(testNodeCount)
+	h := s.Handler()
+	if err := s.SetPartition([][]int{{0, 1}, {2, 3, 4}}); err != nil {
+		t.Fatalf("SetPartition failed: %v", err)
+	}
+
+	for _, req := range []string{"node=0", "node=0&delta=2", "node=1&delta=4", "node=3&delta=10", "node=4&delta=-2"} {
+		expectCode(t, doRequest(t, h, "POST", "/crdt/counter/hits/increment?"+req, ""), http.StatusOK)
+	}
+	for round := 0; round < 20; round++ {
+		s.GossipRound()
+	}
+	counter, _ := s.Counter("hits")
+	for _, replica := range counter.Replicas {
+		want := int64(7)
+		if replica.ID >= 2 {
+			want = 8
+		}
+		if replica.Value != want {
+			t.Errorf("Expected node %d to count %d within its partition, got %d", replica.ID, want, replica.Value)
+		}
+	}
+
+	s.HealPartition()
+	gossipUntil(t, s, func() bool {
+		counter, _ := s.Counter("hits")
+		return counter.Converged
+	})
+
+	rr := doRequest(t, h, "GET", "/crdt/counter/hits", "")
+	expectCode(t, rr, http.StatusOK)
+	var merged CounterState
+	decodeBody(t, rr, &merged)
+	if merged.Value != 15 {
+		t.Errorf("Expected the merged counter to be 15, got %d", merged.Value)
+	}
+	for id, want := range map[int]int64{0: 3, 1: 4, 3: 10, 4: -2} {
+		if got := merged.Contributions[id]; got != want {
+			t.Errorf("Expected node %d to contribute %d, got %d", id, want, got)
+		}
+	}
+	for _, replica := range merged.Replicas {
+		if replica.Value != 15 {
+			t.Errorf("Expected node %d to count 15, got %d", replica.ID, replica.Value)
+		}
+	}
+}
+
+// TestCRDTRegister tests that concurrent register writes converge on the
+// latest one.
+func TestCRDTRegister(t *testing.T) {
+	s := New(Config{Seed: 1})
+	s.Init(testNodeCount)
+	h := s.Handler()
+	if err := s.SetPartition([][]int{{0, 1}, {2, 3, 4}}); err != nil {
+		t.Fatalf("SetPartition failed: %v", err)
+	}
+
+	expectCode(t, doRequest(t, h, "PUT", "/crdt/register/leader?node=0", `{"value":"first"}`), http.StatusOK)
+	expectCode(t, doRequest(t, h, "PUT", "/crdt/register/leader?node=3", `{"value":"second"}`), http.StatusOK)
+	s.HealPartition()
+	gossipUntil(t, s, func() bool {
+		register, _ := s.Register("leader")
+		return register.Converged
+	})
+
+	rr := doRequest(t, h, "GET", "/crdt/register/leader", "")
+	expectCode(t, rr, http.StatusOK)
+	var register RegisterState
+	decodeBody(t, rr, &register)
+	if register.Register.Value != "second" || register.Register.Node != 3 {
+		t.Errorf("Expected the later write to win, got %+v", register.Register)
+	}
+
+	// Ties on the HLC timestamp go to the higher node ID.
+	a := LWWRegister{Value: "a", HLC: register.Register.HLC, Node: 1}
+	b := LWWRegister{Value: "b", HLC: register.Register.HLC, Node: 2}
+	if a.newer(b) || !b.newer(a) {
+		t.Errorf("Expected node 2 to win the tie")
+	}
+}
+
+// TestCRDTErrors tests requests for missing CRDTs and nodes and with bad
+// parameters.
+func TestCRDTErrors(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	expectCode(t, doRequest(t, h, "GET", "/crdt/counter/missing", ""), http.StatusNotFound)
+	expectCode(t, doRequest(t, h, "GET", "/crdt/register/missing", ""), http.StatusNotFound)
+	expectCode(t, doRequest(t, h, "POST", "/crdt/counter/hits/increment", ""), http.StatusBadRequest)
+	expectCode(t, doRequest(t, h, "POST", "/crdt/counter/hits/increment?node=0&delta=x", ""), http.StatusBadRequest)
+	expectCode(t, doRequest(t, h, "POST", "/crdt/counter/hits/increment?node=99", ""), http.StatusNotFound)
+	expectCode(t, doRequest(t, h, "PUT", "/crdt/register/r?node=0", `{}`), http.StatusBadRequest)
+	s.Fail(2)
+	expectCode(t, doRequest(t, h, "POST", "/crdt/counter/hits/increment?node=2", ""), http.StatusServiceUnavailable)
+}
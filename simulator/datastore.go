@@ -0,0 +1,234 @@
+package simulator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// DefaultMaxNodeKeys is the number of keys each node's data store may hold
+// when Config.MaxNodeKeys is unset.
+const DefaultMaxNodeKeys = 1024
+
+// Errors returned by the per-node data store.
+var (
+	// ErrNodeDown means the node is down and cannot serve the request.
+	ErrNodeDown = errors.New("node is down")
+
+	// ErrNodeOverloaded means the node is over one of Config.ResourceLimits
+	// and refuses the request.
+	ErrNodeOverloaded = errors.New("node is overloaded")
+
+	// ErrStoreFull means a node's data store already holds
+	// Config.MaxNodeKeys keys.
+	ErrStoreFull = errors.New("node data store is full")
+)
+
+// DataEntry is one key in a node's data store.
+type DataEntry struct {
+	NodeID  int    `json:"node_id"`
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+	Version uint64 `json:"version"` // Version of the node after the key was last read or written.
+}
+
+// DataKeys lists the keys in a node's data store.
+type DataKeys struct {
+	NodeID int      `json:"node_id"`
+	Keys   []string `json:"keys"` // Sorted.
+}
+
+// dataRequest is the JSON payload accepted by putDataKey.
+type dataRequest struct {
+	Value *string `json:"value"`
+}
+
+// upNode returns the index of the up node with the given ID. It returns
+// ErrNodeNotFound or ErrNodeDown otherwise. The caller must hold s.mu.
+func (s *Simulator) upNode(id int) (int, error) {
+	index := s.findNode(id)
+	if index < 0 {
+		return -1, ErrNodeNotFound
+	}
+	if s.nodes[index].Status == StatusDown {
+		return -1, ErrNodeDown
+	}
+	return index, nil
+}
+
+// GetData returns key from the data store of the node with the given ID. It
+// returns ErrNodeNotFound, ErrNodeDown, ErrNodeOverloaded, or ErrKeyNotFound
+// if it cannot.
+func (s *Simulator) GetData(id int, key string) (DataEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	index, err := s.servingNode(id)
+	if err != nil {
+		return DataEntry{}, err
+	}
+	value, ok := s.store[id][key]
+	if !ok {
+		return DataEntry{}, ErrKeyNotFound
+	}
+	return DataEntry{NodeID: id, Key: key, Value: value, Version: s.nodeCopy(index).Version}, nil
+}
+
+// SetData stores value under key in the data store of the node with the
+// given ID and records the change as a local event on the node. It returns
+// ErrNodeNotFound, ErrNodeDown, or ErrNodeOverloaded if the node cannot
+// accept the write, and ErrStoreFull if key is new and the store is at
+// Config.MaxNodeKeys.
+func (s *Simulator) SetData(id int, key, value string) (DataEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, err := s.servingNode(id)
+	if err != nil {
+		return DataEntry{}, err
+	}
+	data := s.store[id]
+	if data == nil {
+		data = make(map[string]string)
+		s.store[id] = data
+	}
+	if _, exists := data[key]; !exists && len(data) >= s.cfg.MaxNodeKeys {
+		return DataEntry{}, fmt.Errorf("%w: %d keys", ErrStoreFull, len(data))
+	}
+	data[key] = value
+	s.nodes[index].tick()
+	s.publish(EventNodeUpdated, index)
+	s.logger.Debug("node data set", "node_id", id, "key", key)
+	return DataEntry{NodeID: id, Key: key, Value: value, Version: s.nodes[index].Version}, nil
+}
+
+// DeleteData removes key from the data store of the node with the given ID.
+// It returns ErrNodeNotFound, ErrNodeDown, ErrNodeOverloaded, or
+// ErrKeyNotFound if it cannot.
+func (s *Simulator) DeleteData(id int, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index, err := s.servingNode(id)
+	if err != nil {
+		return err
+	}
+	if _, ok := s.store[id][key]; !ok {
+		return ErrKeyNotFound
+	}
+	delete(s.store[id], key)
+	s.nodes[index].tick()
+	s.publish(EventNodeUpdated, index)
+	s.logger.Debug("node data deleted", "node_id", id, "key", key)
+	return nil
+}
+
+// ListData returns the keys in the data store of the node with the given
+// ID. It returns ErrNodeNotFound, ErrNodeDown, or ErrNodeOverloaded if it
+// cannot.
+func (s *Simulator) ListData(id int) (DataKeys, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, err := s.servingNode(id); err != nil {
+		return DataKeys{}, err
+	}
+	keys := make([]string, 0, len(s.store[id]))
+	for key := range s.store[id] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return DataKeys{NodeID: id, Keys: keys}, nil
+}
+
+// writeDataError maps a data store error to an HTTP error response.
+func writeDataError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNodeNotFound):
+		writeError(w, http.StatusNotFound, "Node not found")
+	case errors.Is(err, ErrKeyNotFound):
+		writeError(w, http.StatusNotFound, "Key not found")
+	case errors.Is(err, ErrNodeDown):
+		writeError(w, http.StatusServiceUnavailable, "Node is down")
+	case errors.Is(err, ErrNodeOverloaded):
+		writeError(w, http.StatusServiceUnavailable, "Node is overloaded")
+	case errors.Is(err, ErrStoreFull):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// listDataKeys handles HTTP requests to list the keys a node stores.
+func (s *Simulator) listDataKeys(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseNodeID(w, r)
+	if !ok {
+		return
+	}
+	keys, err := s.ListData(id)
+	if err != nil {
+		writeDataError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, keys)
+}
+
+// getDataKey handles HTTP requests to read one key a node stores.
+func (s *Simulator) getDataKey(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseNodeID(w, r)
+	if !ok {
+		return
+	}
+	entry, err := s.GetData(id, r.PathValue("key"))
+	if err != nil {
+		writeDataError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, entry)
+}
+
+// putDataKey handles HTTP requests to store a key on a node from a body
+// like {"value":"v"}.
+func (s *Simulator) putDataKey(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseNodeID(w, r)
+	if !ok {
+		return
+	}
+
+	var payload dataRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "Malformed JSON body")
+		return
+	}
+	if payload.Value == nil {
+		writeError(w, http.StatusBadRequest, "Field \"value\" is required")
+		return
+	}
+	if !s.checkWritable(w, r, id, true) {
+		return
+	}
+
+	entry, err := s.SetData(id, r.PathValue("key"), *payload.Value)
+	if err != nil {
+		writeDataError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, entry)
+}
+
+// deleteDataKey handles HTTP requests to remove a key from a node.
+func (s *Simulator) deleteDataKey(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseNodeID(w, r)
+	if !ok || !s.checkWritable(w, r, id, true) {
+		return
+	}
+	if err := s.DeleteData(id, r.PathValue("key")); err != nil {
+		writeDataError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
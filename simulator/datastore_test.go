@@ -0,0 +1,125 @@
+package simulator
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// TestNodeDataCRUD tests setting, reading, overwriting, and deleting keys in
+// a node's data store, and that every change bumps the node.
+func TestNodeDataCRUD(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	h := s.Handler()
+	before, _ := s.Node(1)
+
+	rr := doRequest(t, h, "PUT", "/nodes/1/data/color", `{"value": "red"}`)
+	expectCode(t, rr, http.StatusOK)
+	var set DataEntry
+	decodeBody(t, rr, &set)
+	if set.NodeID != 1 || set.Key != "color" || set.Value != "red" || set.Version != before.Version+1 {
+		t.Errorf("Unexpected entry after set: %+v", set)
+	}
+	after, _ := s.Node(1)
+	if after.Version != before.Version+1 || after.Time.Before(before.Time) || after.VectorClock[1] != before.VectorClock[1]+1 {
+		t.Errorf("Expected the set to tick node 1, got %+v", after)
+	}
+
+	expectCode(t, doRequest(t, h, "PUT", "/nodes/1/data/color", `{"value": "blue"}`), http.StatusOK)
+	rr = doRequest(t, h, "GET", "/nodes/1/data/color", "")
+	expectCode(t, rr, http.StatusOK)
+	var got DataEntry
+	decodeBody(t, rr, &got)
+	if got.Value != "blue" || got.Version != before.Version+2 {
+		t.Errorf("Expected the overwritten value at version %d, got %+v", before.Version+2, got)
+	}
+
+	// Stores are per node.
+	expectCode(t, doRequest(t, h, "GET", "/nodes/2/data/color", ""), http.StatusNotFound)
+
+	expectCode(t, doRequest(t, h, "DELETE", "/nodes/1/data/color", ""), http.StatusNoContent)
+	if node, _ := s.Node(1); node.Version != before.Version+3 {
+		t.Errorf("Expected the delete to bump node 1 to version %d, got %d", before.Version+3, node.Version)
+	}
+	expectCode(t, doRequest(t, h, "GET", "/nodes/1/data/color", ""), http.StatusNotFound)
+	expectCode(t, doRequest(t, h, "DELETE", "/nodes/1/data/color", ""), http.StatusNotFound)
+}
+
+// TestNodeDataList tests that listing returns a node's keys in order.
+func TestNodeDataList(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	rr := doRequest(t, h, "GET", "/nodes/0/data", "")
+	expectCode(t, rr, http.StatusOK)
+	var empty DataKeys
+	decodeBody(t, rr, &empty)
+	if empty.NodeID != 0 || empty.Keys == nil || len(empty.Keys) != 0 {
+		t.Errorf("Expected an empty key list, got %+v", empty)
+	}
+
+	for _, key := range []string{"b", "c", "a"} {
+		expectCode(t, doRequest(t, h, "PUT", "/nodes/0/data/"+key, `{"value": "x"}`), http.StatusOK)
+	}
+	rr = doRequest(t, h, "GET", "/nodes/0/data", "")
+	expectCode(t, rr, http.StatusOK)
+	var keys DataKeys
+	decodeBody(t, rr, &keys)
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(keys.Keys, want) {
+		t.Errorf("Expected keys %v, got %v", want, keys.Keys)
+	}
+}
+
+// TestNodeDataLimit tests that a full store rejects new keys but still
+// accepts overwrites.
+func TestNodeDataLimit(t *testing.T) {
+	s := New(Config{MaxNodeKeys: 2})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	expectCode(t, doRequest(t, h, "PUT", "/nodes/0/data/a", `{"value": "1"}`), http.StatusOK)
+	expectCode(t, doRequest(t, h, "PUT", "/nodes/0/data/b", `{"value": "2"}`), http.StatusOK)
+	rr := doRequest(t, h, "PUT", "/nodes/0/data/c", `{"value": "3"}`)
+	expectCode(t, rr, http.StatusConflict)
+	var body ErrorResponse
+	decodeBody(t, rr, &body)
+	if body.Error.Code != ErrorCodeConflict {
+		t.Errorf("Expected error code %q, got %q", ErrorCodeConflict, body.Error.Code)
+	}
+
+	expectCode(t, doRequest(t, h, "PUT", "/nodes/0/data/a", `{"value": "4"}`), http.StatusOK)
+	expectCode(t, doRequest(t, h, "PUT", "/nodes/1/data/c", `{"value": "3"}`), http.StatusOK)
+	expectCode(t, doRequest(t, h, "DELETE", "/nodes/0/data/b", ""), http.StatusNoContent)
+	expectCode(t, doRequest(t, h, "PUT", "/nodes/0/data/c", `{"value": "3"}`), http.StatusOK)
+}
+
+// TestNodeDataErrors tests requests for missing and down nodes and with bad
+// bodies, and that removing a node discards its store.
+func TestNodeDataErrors(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	expectCode(t, doRequest(t, h, "GET", "/nodes/99/data", ""), http.StatusNotFound)
+	expectCode(t, doRequest(t, h, "PUT", "/nodes/99/data/k", `{"value": "v"}`), http.StatusNotFound)
+	expectCode(t, doRequest(t, h, "GET", "/nodes/abc/data/k", ""), http.StatusBadRequest)
+	for _, body := range []string{`not json`, `{}`, `{"value": 1}`, `{"value": "v", "extra": 1}`} {
+		expectCode(t, doRequest(t, h, "PUT", "/nodes/0/data/k", body), http.StatusBadRequest)
+	}
+
+	expectCode(t, doRequest(t, h, "PUT", "/nodes/1/data/k", `{"value": "v"}`), http.StatusOK)
+	s.Fail(1)
+	expectCode(t, doRequest(t, h, "GET", "/nodes/1/data/k", ""), http.StatusServiceUnavailable)
+	expectCode(t, doRequest(t, h, "PUT", "/nodes/1/data/k", `{"value": "w"}`), http.StatusServiceUnavailable)
+	s.Recover(1)
+	if entry, err := s.GetData(1, "k"); err != nil || entry.Value != "v" {
+		t.Errorf("Expected the key to survive a failure, got %+v, %v", entry, err)
+	}
+
+	s.RemoveNode(1)
+	if _, ok := s.store[1]; ok {
+		t.Errorf("Expected the removed node's store to be discarded")
+	}
+}
@@ -0,0 +1,63 @@
+package simulator
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+)
+
+// DebugVars is a snapshot of the runtime state served by /debug/vars.
+type DebugVars struct {
+	Goroutines int       `json:"goroutines"`
+	Uptime     float64   `json:"uptime_seconds"` // Time since the Simulator was created.
+	Heap       HeapStats `json:"heap"`
+}
+
+// HeapStats summarizes the Go heap, as reported by runtime.ReadMemStats.
+type HeapStats struct {
+	Alloc   uint64 `json:"alloc_bytes"` // Bytes of allocated heap objects.
+	Sys     uint64 `json:"sys_bytes"`   // Bytes of heap memory obtained from the OS.
+	InUse   uint64 `json:"inuse_bytes"` // Bytes in in-use spans.
+	Objects uint64 `json:"objects"`     // Number of allocated heap objects.
+	NumGC   uint32 `json:"num_gc"`      // Number of completed GC cycles.
+}
+
+// debugHandler returns the handler for the /debug/ endpoints: the
+// net/http/pprof profiles under /debug/pprof/ and the runtime state at
+// /debug/vars. They are registered on their own mux, which Handler mounts
+// only when Config.Debug is set.
+func (s *Simulator) debugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /debug/pprof/", pprof.Index)
+	mux.HandleFunc("GET /debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("GET /debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("GET /debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("POST /debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("GET /debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("GET /debug/vars", s.getDebugVars)
+	return mux
+}
+
+// DebugVars returns the current goroutine count, heap statistics, and
+// uptime.
+func (s *Simulator) DebugVars() DebugVars {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	return DebugVars{
+		Goroutines: runtime.NumGoroutine(),
+		Uptime:     time.Since(s.started).Seconds(),
+		Heap: HeapStats{
+			Alloc:   mem.HeapAlloc,
+			Sys:     mem.HeapSys,
+			InUse:   mem.HeapInuse,
+			Objects: mem.HeapObjects,
+			NumGC:   mem.NumGC,
+		},
+	}
+}
+
+// getDebugVars serves the runtime state.
+func (s *Simulator) getDebugVars(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.DebugVars())
+}
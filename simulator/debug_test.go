@@ -0,0 +1,44 @@
+package simulator
+
+import (
+	"net/http"
+	"testing"
+)
+
+// TestDebugEndpointsDisabled tests that the debug endpoints are not routed
+// unless Config.Debug is set.
+func TestDebugEndpointsDisabled(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/goroutine", "/debug/vars"} {
+		expectCode(t, doRequest(t, h, "GET", path, ""), http.StatusNotFound)
+	}
+}
+
+// TestDebugEndpoints tests that Config.Debug serves the pprof profiles and
+// the runtime state.
+func TestDebugEndpoints(t *testing.T) {
+	s := New(Config{Debug: true})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/goroutine?debug=1", "/debug/pprof/cmdline"} {
+		expectCode(t, doRequest(t, h, "GET", path, ""), http.StatusOK)
+	}
+
+	rr := doRequest(t, h, "GET", "/debug/vars", "")
+	expectCode(t, rr, http.StatusOK)
+	var vars DebugVars
+	decodeBody(t, rr, &vars)
+	if vars.Goroutines < 1 {
+		t.Errorf("Expected at least one goroutine, got %d", vars.Goroutines)
+	}
+	if vars.Heap.Alloc == 0 || vars.Heap.Sys == 0 {
+		t.Errorf("Expected non-zero heap stats, got %+v", vars.Heap)
+	}
+	if vars.Uptime <= 0 {
+		t.Errorf("Expected a positive uptime, got %v", vars.Uptime)
+	}
+}
@@ -0,0 +1,173 @@
+package simulator
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultSuspectTimeout is how long a node may go without a heartbeat before
+// the failure detector suspects it, used when Config.SuspectTimeout is unset.
+const DefaultSuspectTimeout = 3 * time.Second
+
+// heartbeatState is the failure detector's view of one node.
+type heartbeatState struct {
+	last   time.Time // When the node's last heartbeat arrived.
+	paused bool      // Set while the node's heartbeats are being dropped.
+}
+
+// DetectorInfo describes the failure detector's view of the cluster.
+type DetectorInfo struct {
+	Timeout string         `json:"timeout"`
+	Nodes   []DetectorNode `json:"nodes"`
+}
+
+// DetectorNode describes the failure detector's view of one node. Suspicion
+// is the time since the last heartbeat as a fraction of the timeout; the node
+// is suspected once it reaches 1.
+type DetectorNode struct {
+	ID               int       `json:"id"`
+	LastHeartbeat    time.Time `json:"last_heartbeat"`
+	Suspicion        float64   `json:"suspicion"`
+	Suspected        bool      `json:"suspected"`
+	HeartbeatsPaused bool      `json:"heartbeats_paused"`
+}
+
+// StartHeartbeats has every up node emit a heartbeat once per interval, and
+// runs the failure detector after each round, until ctx is cancelled. Down
+// nodes and nodes whose heartbeats are paused stay silent, so the detector
+// suspects them once the timeout elapses. It blocks, so callers typically
+// run it in its own goroutine.
+func (s *Simulator) StartHeartbeats(ctx context.Context, interval time.Duration) {
+	ticker := s.cfg.Clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C():
+			s.heartbeatRound(now)
+		}
+	}
+}
+
+// heartbeatRound sends a heartbeat at now from every up node that isn't
+// paused to the failure detector, which runs on the leader, then updates
+// every node's suspicion. A heartbeat counts from when it arrives, so under a
+// latency model nodes far from the leader are heard from later.
+func (s *Simulator) heartbeatRound(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deliverArrived(now)
+	detector := -1
+	for _, node := range s.nodes {
+		if node.Leader {
+			detector = node.ID
+		}
+	}
+	for _, node := range s.nodes {
+		hb := s.heartbeat(node.ID)
+		if node.Status != StatusUp || hb.paused {
+			continue
+		}
+		id, to := node.ID, detector
+		if to < 0 {
+			to = id
+		}
+		s.send(now, id, to, MessageHeartbeat, "", heartbeatPayload{ID: id, Sent: now}, func(arrived time.Time) {
+			if hb, ok := s.heartbeats[id]; ok && arrived.After(hb.last) {
+				hb.last = arrived
+			}
+		})
+	}
+	s.detect(now)
+	if s.Mode() == ModeRaft {
+		// Heartbeats double as the leader's AppendEntries, which bring
+		// lagging followers up to date.
+		s.replicate()
+	}
+}
+
+// detect marks nodes suspected when their last heartbeat is older than the
+// timeout and clears suspicion otherwise, re-electing the leader if anything
+// changed. The caller must hold s.mu for writing.
+func (s *Simulator) detect(now time.Time) {
+	changed := false
+	for i := range s.nodes {
+		node := &s.nodes[i]
+		suspected := now.Sub(s.heartbeat(node.ID).last) >= s.cfg.SuspectTimeout
+		if suspected == node.Suspected {
+			continue
+		}
+
+		node.Suspected = suspected
+		changed = true
+		s.publish(EventNodeUpdated, i)
+		if suspected {
+			s.logger.Warn("node suspected", "node_id", node.ID)
+		} else {
+			s.logger.Info("node no longer suspected", "node_id", node.ID)
+		}
+	}
+	if changed {
+		s.electLeader()
+	}
+}
+
+// heartbeat returns the detector state of the node with the given ID,
+// creating it with a fresh heartbeat if needed. The caller must hold s.mu for
+// writing.
+func (s *Simulator) heartbeat(id int) *heartbeatState {
+	hb, ok := s.heartbeats[id]
+	if !ok {
+		hb = &heartbeatState{last: s.cfg.Clock.Now()}
+		s.heartbeats[id] = hb
+	}
+	return hb
+}
+
+// PauseHeartbeats drops the heartbeats of the node with the given ID without
+// marking it down, simulating a node that is alive but unreachable by the
+// detector. It returns false if no such node exists.
+func (s *Simulator) PauseHeartbeats(id int) bool {
+	return s.setHeartbeatsPaused(id, true)
+}
+
+// ResumeHeartbeats stops dropping the heartbeats of the node with the given
+// ID. It returns false if no such node exists.
+func (s *Simulator) ResumeHeartbeats(id int) bool {
+	return s.setHeartbeatsPaused(id, false)
+}
+
+// setHeartbeatsPaused implements PauseHeartbeats and ResumeHeartbeats.
+func (s *Simulator) setHeartbeatsPaused(id int, paused bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.findNode(id) < 0 {
+		return false
+	}
+	s.heartbeat(id).paused = paused
+	return true
+}
+
+// Detector returns the failure detector's view of every node.
+func (s *Simulator) Detector() DetectorInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.cfg.Clock.Now()
+	info := DetectorInfo{Timeout: s.cfg.SuspectTimeout.String()}
+	for _, node := range s.nodes {
+		hb := s.heartbeat(node.ID)
+		info.Nodes = append(info.Nodes, DetectorNode{
+			ID:               node.ID,
+			LastHeartbeat:    hb.last,
+			Suspicion:        float64(now.Sub(hb.last)) / float64(s.cfg.SuspectTimeout),
+			Suspected:        node.Suspected,
+			HeartbeatsPaused: hb.paused,
+		})
+	}
+	return info
+}
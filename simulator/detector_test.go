@@ -0,0 +1,125 @@
+package simulator
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// suspected returns whether the node with the given ID is suspected.
+func suspected(t *testing.T, s *Simulator, id int) bool {
+	t.Helper()
+
+	node, ok := s.Node(id)
+	if !ok {
+		t.Fatalf("Node %d not found", id)
+	}
+	return node.Suspected
+}
+
+// TestDetectorSuspectsSilentNodes tests that a node whose heartbeats stop is
+// suspected after the timeout, that it recovers when they resume, and that
+// leader election honors suspicion.
+func TestDetectorSuspectsSilentNodes(t *testing.T) {
+	s := New(Config{SuspectTimeout: time.Second})
+	s.Init(3)
+	start := time.Now()
+
+	s.heartbeatRound(start)
+	for id := 0; id < 3; id++ {
+		if suspected(t, s, id) {
+			t.Errorf("Node %d suspected right after a heartbeat", id)
+		}
+	}
+
+	// Stop the leader's heartbeats.
+	s.PauseHeartbeats(0)
+	s.heartbeatRound(start.Add(500 * time.Millisecond))
+	if suspected(t, s, 0) {
+		t.Error("Node 0 suspected before the timeout")
+	}
+	s.heartbeatRound(start.Add(1500 * time.Millisecond))
+	if !suspected(t, s, 0) {
+		t.Error("Node 0 not suspected after the timeout")
+	}
+	if suspected(t, s, 1) || suspected(t, s, 2) {
+		t.Error("Nodes with heartbeats were suspected")
+	}
+	if leader, ok := s.Leader(); !ok || leader.ID != 1 {
+		t.Errorf("Expected node 1 to lead while node 0 is suspected, got %+v", leader)
+	}
+
+	// Resuming heartbeats clears suspicion and restores leadership.
+	s.ResumeHeartbeats(0)
+	s.heartbeatRound(start.Add(2 * time.Second))
+	if suspected(t, s, 0) {
+		t.Error("Node 0 still suspected after heartbeats resumed")
+	}
+	if leader, ok := s.Leader(); !ok || leader.ID != 0 {
+		t.Errorf("Expected node 0 to lead again, got %+v", leader)
+	}
+
+	// A down node stops heartbeating, so it is suspected too.
+	s.Fail(2)
+	s.heartbeatRound(start.Add(3500 * time.Millisecond))
+	if !suspected(t, s, 2) {
+		t.Error("Down node 2 not suspected after the timeout")
+	}
+	s.Recover(2)
+	s.heartbeatRound(start.Add(4 * time.Second))
+	if suspected(t, s, 2) {
+		t.Error("Recovered node 2 still suspected")
+	}
+}
+
+// TestStartHeartbeats tests the heartbeat loop and GET /detector in real
+// time.
+func TestStartHeartbeats(t *testing.T) {
+	s := New(Config{SuspectTimeout: 30 * time.Millisecond})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	if rr := doRequest(t, h, "POST", "/nodes/3/heartbeats/pause", ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusNoContent, rr.Code)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.StartHeartbeats(ctx, 5*time.Millisecond)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !suspected(t, s, 3) {
+		if time.Now().After(deadline) {
+			t.Fatal("Node 3 was never suspected")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	var info DetectorInfo
+	decodeBody(t, doRequest(t, h, "GET", "/detector", ""), &info)
+	if info.Timeout != "30ms" || len(info.Nodes) != testNodeCount {
+		t.Fatalf("Unexpected detector info: %+v", info)
+	}
+	for _, node := range info.Nodes {
+		if node.ID == 3 {
+			if !node.Suspected || !node.HeartbeatsPaused || node.Suspicion < 1 {
+				t.Errorf("Expected node 3 to be suspected with paused heartbeats, got %+v", node)
+			}
+		} else if node.Suspected || node.HeartbeatsPaused {
+			t.Errorf("Expected node %d to be healthy, got %+v", node.ID, node)
+		}
+	}
+
+	doRequest(t, h, "POST", "/nodes/3/heartbeats/resume", "")
+	for suspected(t, s, 3) {
+		if time.Now().After(deadline) {
+			t.Fatal("Node 3 was never cleared")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if rr := doRequest(t, h, "POST", "/nodes/99/heartbeats/pause", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, but got %d", http.StatusNotFound, rr.Code)
+	}
+}
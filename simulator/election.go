@@ -0,0 +1,89 @@
+package simulator
+
+// electLeader elects a leader and demotes every other node. By default it
+// runs a bully-style election: the up node with the lowest ID that the
+// failure detector doesn't suspect wins. In raft mode the winner must also
+// gather votes from a majority, and a new leader starts a new term.
+// Witnesses never win. With Config.SplitBrain set, outside raft mode, every
+// side of a partition elects a leader of its own instead; see
+// splitBrainLeaders. Every node that becomes leader is issued the next
+// fencing token. If no primary is up, the leader holding the highest token is
+// promoted to primary. The caller must hold s.mu for writing.
+func (s *Simulator) electLeader() {
+	var leaders []int
+	switch {
+	case s.Mode() == ModeRaft:
+		if leader := s.raftCandidate(); leader >= 0 {
+			leaders = []int{leader}
+		}
+	case s.cfg.SplitBrain:
+		leaders = s.splitBrainLeaders()
+	default:
+		leader := -1
+		for i := range s.nodes {
+			if !s.canLead(i) {
+				continue
+			}
+			if leader < 0 || s.nodes[i].ID < s.nodes[leader].ID {
+				leader = i
+			}
+		}
+		if leader >= 0 {
+			leaders = []int{leader}
+		}
+	}
+
+	elected := make(map[int]bool, len(leaders))
+	for _, i := range leaders {
+		elected[i] = true
+	}
+	for i := range s.nodes {
+		if s.nodes[i].Leader == elected[i] {
+			continue
+		}
+		s.nodes[i].Leader = elected[i]
+		s.version++
+		if elected[i] {
+			s.issueToken(i)
+		}
+	}
+	leader := s.topLeader()
+	s.noteLeader(leader)
+	if s.Mode() == ModeRaft {
+		s.raftElected(leader)
+	}
+	s.failOver(leader)
+}
+
+// canLead reports whether the node at index may be elected: it is up, not
+// suspected by the failure detector, active, and not a witness. The caller
+// must hold s.mu.
+func (s *Simulator) canLead(index int) bool {
+	node := &s.nodes[index]
+	return node.Status == StatusUp && !node.Suspected && node.Membership == MemberActive && node.Role != RoleWitness
+}
+
+// topLeader returns the index of the leader holding the highest fencing
+// token, or -1 if no node leads. The caller must hold s.mu.
+func (s *Simulator) topLeader() int {
+	top := -1
+	for i := range s.nodes {
+		if s.nodes[i].Leader && (top < 0 || s.tokens[s.nodes[i].ID] > s.tokens[s.nodes[top].ID]) {
+			top = i
+		}
+	}
+	return top
+}
+
+// Leader returns the current leader and false if no node could be elected.
+// During a split brain it returns the leader holding the highest fencing
+// token.
+func (s *Simulator) Leader() (NodeData, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if i := s.topLeader(); i >= 0 {
+		return s.nodeCopy(i), true
+	}
+	return NodeData{}, false
+}
@@ -0,0 +1,92 @@
+package simulator
+
+import (
+	"net/http"
+	"testing"
+)
+
+// leaderID returns the ID reported by GET /leader, or -1 if it returns 503.
+func leaderID(t *testing.T, h http.Handler) int {
+	t.Helper()
+
+	rr := doRequest(t, h, "GET", "/leader", "")
+	switch rr.Code {
+	case http.StatusOK:
+		var leader NodeData
+		decodeBody(t, rr, &leader)
+		if !leader.Leader {
+			t.Errorf("Expected the leader flag to be set on %+v", leader)
+		}
+		return leader.ID
+	case http.StatusServiceUnavailable:
+		return -1
+	default:
+		t.Fatalf("Unexpected status code %d from /leader", rr.Code)
+		return -1
+	}
+}
+
+// TestLeaderElection tests that leadership moves to the next eligible node
+// when the leader fails and that a recovered lower-ID node reclaims it.
+func TestLeaderElection(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	if got := leaderID(t, h); got != 0 {
+		t.Fatalf("Expected node 0 to lead initially, but got %d", got)
+	}
+
+	// Failing the leader moves leadership to the next eligible node.
+	s.Fail(0)
+	if got := leaderID(t, h); got != 1 {
+		t.Errorf("Expected node 1 to lead after node 0 failed, but got %d", got)
+	}
+	s.Fail(1)
+	if got := leaderID(t, h); got != 2 {
+		t.Errorf("Expected node 2 to lead after node 1 failed, but got %d", got)
+	}
+
+	// Recovering a lower-ID node reclaims leadership.
+	s.Recover(0)
+	if got := leaderID(t, h); got != 0 {
+		t.Errorf("Expected node 0 to reclaim leadership, but got %d", got)
+	}
+
+	// Exactly one node carries the leader flag.
+	leaders := 0
+	for _, node := range s.Snapshot() {
+		if node.Leader {
+			leaders++
+		}
+	}
+	if leaders != 1 {
+		t.Errorf("Expected exactly one leader, but got %d", leaders)
+	}
+
+	// With every node down there is no leader.
+	for id := 0; id < testNodeCount; id++ {
+		s.Fail(id)
+	}
+	if got := leaderID(t, h); got != -1 {
+		t.Errorf("Expected no leader with every node down, but got %d", got)
+	}
+}
+
+// TestLeaderElectionMembership tests that removing and adding nodes also
+// triggers a new election.
+func TestLeaderElectionMembership(t *testing.T) {
+	s := New(Config{})
+	s.Init(2)
+
+	s.RemoveNode(0)
+	if leader, ok := s.Leader(); !ok || leader.ID != 1 {
+		t.Errorf("Expected node 1 to lead after node 0 was removed, got %+v", leader)
+	}
+
+	s.Fail(1)
+	added := s.AddNode("Node-new", 1)
+	if leader, ok := s.Leader(); !ok || leader.ID != added.ID {
+		t.Errorf("Expected new node %d to lead, got %+v", added.ID, leader)
+	}
+}
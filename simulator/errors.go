@@ -0,0 +1,108 @@
+package simulator
+
+import "net/http"
+
+// Error codes carried in the "code" field of every error response, so
+// clients can tell failures apart without parsing messages.
+const (
+	ErrorCodeBadRequest       = "bad_request"        // The request is malformed or a parameter is invalid.
+	ErrorCodeUnauthorized     = "unauthorized"       // The API key is missing or wrong.
+	ErrorCodeNotFound         = "not_found"          // The node, resource, or route does not exist.
+	ErrorCodeMethodNotAllowed = "method_not_allowed" // The route exists but not for this method.
+	ErrorCodeConflict         = "conflict"           // The request conflicts with the current state.
+	ErrorCodeRateLimited      = "rate_limited"       // The client has exceeded its rate limit.
+	ErrorCodeInternal         = "internal"           // The server failed to handle the request.
+	ErrorCodeUnavailable      = "unavailable"        // A node or the simulator cannot serve the request now.
+)
+
+// ErrorResponse is the JSON body of every error response.
+type ErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// APIError describes why a request failed.
+type APIError struct {
+	Code    string `json:"code"` // One of the ErrorCode constants.
+	Message string `json:"message"`
+
+	// RequestID is the X-Request-ID of the failed request, so clients can
+	// quote it when reporting the error.
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// errorCode returns the error code for an HTTP status.
+func errorCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return ErrorCodeBadRequest
+	case http.StatusUnauthorized:
+		return ErrorCodeUnauthorized
+	case http.StatusNotFound:
+		return ErrorCodeNotFound
+	case http.StatusMethodNotAllowed:
+		return ErrorCodeMethodNotAllowed
+	case http.StatusConflict:
+		return ErrorCodeConflict
+	case http.StatusTooManyRequests:
+		return ErrorCodeRateLimited
+	case http.StatusServiceUnavailable:
+		return ErrorCodeUnavailable
+	default:
+		return ErrorCodeInternal
+	}
+}
+
+// writeError writes an ErrorResponse with the given status, the code for
+// that status, and message. If the response carries a request ID, the body
+// includes it.
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, ErrorResponse{Error: APIError{
+		Code:      errorCode(status),
+		Message:   message,
+		RequestID: w.Header().Get(RequestIDHeader),
+	}})
+}
+
+// withJSONErrors serves requests with mux, but answers requests that match
+// no route with an ErrorResponse instead of the mux's plain-text 404 and 405
+// responses.
+func withJSONErrors(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h, pattern := mux.Handler(r)
+		if pattern != "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+
+		// Find out whether the mux would reject the method or the path. Its
+		// built-in handlers only set headers and write a short message.
+		probe := &probeWriter{header: make(http.Header)}
+		h.ServeHTTP(probe, r)
+		switch probe.code {
+		case http.StatusMethodNotAllowed:
+			w.Header().Set("Allow", probe.header.Get("Allow"))
+			writeError(w, http.StatusMethodNotAllowed, "Method "+r.Method+" not allowed on "+r.URL.Path)
+		case http.StatusNotFound:
+			writeError(w, http.StatusNotFound, "No endpoint at "+r.URL.Path)
+		default:
+			// Redirects, such as those cleaning up the path.
+			h.ServeHTTP(w, r)
+		}
+	})
+}
+
+// probeWriter is an http.ResponseWriter that records the status and headers
+// written to it and discards the body.
+type probeWriter struct {
+	header http.Header
+	code   int
+}
+
+func (p *probeWriter) Header() http.Header         { return p.header }
+func (p *probeWriter) Write(b []byte) (int, error) { return len(b), nil }
+
+func (p *probeWriter) WriteHeader(code int) {
+	if p.code == 0 {
+		p.code = code
+	}
+}
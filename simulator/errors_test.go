@@ -0,0 +1,92 @@
+package simulator
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// TestErrorEnvelope tests that handler errors, rejected methods, and unknown
+// routes all return the same JSON error envelope.
+func TestErrorEnvelope(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	tests := []struct {
+		name, method, path string
+		wantStatus         int
+		wantCode           string
+	}{
+		{"missing node", "GET", "/nodes/99", http.StatusNotFound, ErrorCodeNotFound},
+		{"bad node ID", "GET", "/nodes/abc", http.StatusBadRequest, ErrorCodeBadRequest},
+		{"bad method", "PATCH", "/nodes", http.StatusMethodNotAllowed, ErrorCodeMethodNotAllowed},
+		{"unknown path", "GET", "/no-such-endpoint", http.StatusNotFound, ErrorCodeNotFound},
+	}
+	for _, tt := range tests {
+		rr := doRequest(t, h, tt.method, tt.path, "")
+		if rr.Code != tt.wantStatus {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.wantStatus, rr.Code)
+			continue
+		}
+		if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s: expected JSON content type, got %q", tt.name, ct)
+		}
+
+		var body map[string]map[string]string
+		decodeBody(t, rr, &body)
+		if len(body) != 1 || body["error"] == nil {
+			t.Errorf("%s: expected a body with only an error object, got %s", tt.name, rr.Body)
+			continue
+		}
+		var keys []string
+		for key := range body["error"] {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		if want := []string{"code", "message", "request_id"}; !reflect.DeepEqual(keys, want) {
+			t.Errorf("%s: expected error fields %v, got %v", tt.name, want, keys)
+		}
+		if got := body["error"]["code"]; got != tt.wantCode {
+			t.Errorf("%s: expected code %q, got %q", tt.name, tt.wantCode, got)
+		}
+		if body["error"]["message"] == "" {
+			t.Errorf("%s: expected an error message", tt.name)
+		}
+		if got, want := body["error"]["request_id"], rr.Header().Get(RequestIDHeader); got != want {
+			t.Errorf("%s: expected request ID %q, got %q", tt.name, want, got)
+		}
+	}
+}
+
+// TestErrorEnvelopeKeepsAllow tests that a rejected method still lists the
+// allowed methods.
+func TestErrorEnvelopeKeepsAllow(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+
+	rr := doRequest(t, s.Handler(), "POST", "/healthz", "")
+	expectCode(t, rr, http.StatusMethodNotAllowed)
+	if got := rr.Header().Get("Allow"); got != "GET, HEAD" {
+		t.Errorf("Expected Allow %q, got %q", "GET, HEAD", got)
+	}
+}
+
+// TestErrorCode tests the mapping from HTTP statuses to error codes.
+func TestErrorCode(t *testing.T) {
+	for status, want := range map[int]string{
+		http.StatusBadRequest:          ErrorCodeBadRequest,
+		http.StatusUnauthorized:        ErrorCodeUnauthorized,
+		http.StatusNotFound:            ErrorCodeNotFound,
+		http.StatusMethodNotAllowed:    ErrorCodeMethodNotAllowed,
+		http.StatusConflict:            ErrorCodeConflict,
+		http.StatusTooManyRequests:     ErrorCodeRateLimited,
+		http.StatusServiceUnavailable:  ErrorCodeUnavailable,
+		http.StatusInternalServerError: ErrorCodeInternal,
+	} {
+		if got := errorCode(status); got != want {
+			t.Errorf("errorCode(%d) = %q, want %q", status, got, want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package simulator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// nodesETag returns an entity tag identifying the state of the nodes at the
+// given version in the given media type. It changes whenever the nodes do,
+// and differs between Simulators so a tag from before a restart never
+// matches one issued after it.
+func (s *Simulator) nodesETag(version uint64, media string) string {
+	tag := fmt.Sprintf("%x-%x", s.epoch, version)
+	if media != mediaJSON {
+		tag += "-" + media[strings.Index(media, "/")+1:]
+	}
+	return `"` + tag + `"`
+}
+
+// nodeETag returns the ETag of a single node, which is its quoted version.
+func nodeETag(node NodeData) string {
+	return `"` + strconv.FormatUint(node.Version, 10) + `"`
+}
+
+// parseNodeETag returns the version named by a single node ETag, with or
+// without quotes and a weak W/ prefix.
+func parseNodeETag(etag string) (uint64, error) {
+	etag = strings.TrimPrefix(strings.TrimSpace(etag), "W/")
+	return strconv.ParseUint(strings.Trim(etag, `"`), 10, 64)
+}
+
+// etagMatches reports whether the If-None-Match header value header matches
+// etag. Weak tags compare equal to their strong counterpart, and "*" matches
+// any tag.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package simulator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// getNodes issues GET /nodes with the given If-None-Match header, if any.
+func getNodes(h http.Handler, ifNoneMatch string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/nodes", nil)
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+// TestNodesETag tests that GET /nodes returns an ETag, answers a matching
+// If-None-Match with 304, and changes the ETag once a node changes.
+func TestNodesETag(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	rr := getNodes(h, "")
+	etag := rr.Header().Get("ETag")
+	if rr.Code != http.StatusOK || etag == "" {
+		t.Fatalf("Expected 200 with an ETag, got %d with %q", rr.Code, etag)
+	}
+
+	// Heartbeat rounds that change nothing keep the ETag.
+	s.heartbeatRound(time.Now())
+	for _, header := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+		rr = getNodes(h, header)
+		if rr.Code != http.StatusNotModified {
+			t.Errorf("If-None-Match %s: expected status code %d, got %d", header, http.StatusNotModified, rr.Code)
+		}
+		if rr.Body.Len() != 0 {
+			t.Errorf("If-None-Match %s: expected an empty body, got %q", header, rr.Body)
+		}
+		if got := rr.Header().Get("ETag"); got != etag {
+			t.Errorf("If-None-Match %s: expected ETag %q, got %q", header, etag, got)
+		}
+	}
+
+	s.SetNode(0, "Node-0", 1000)
+	rr = getNodes(h, etag)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d after an update, got %d", http.StatusOK, rr.Code)
+	}
+	if got := rr.Header().Get("ETag"); got == etag {
+		t.Errorf("Expected the ETag to change after an update, still %q", got)
+	}
+	var nodes []NodeData
+	decodeBody(t, rr, &nodes)
+	if nodes[0].Value != 1000 {
+		t.Errorf("Expected the updated value 1000, got %d", nodes[0].Value)
+	}
+
+	// Another simulator never issues the same tag.
+	other := New(Config{})
+	other.Init(testNodeCount)
+	if rr := getNodes(other.Handler(), etag); rr.Code != http.StatusOK {
+		t.Errorf("Expected a tag from another simulator to mismatch, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,167 @@
+package simulator
+
+import "errors"
+
+// DefaultEventLogSize is the number of events retained when
+// Config.EventLogSize is unset.
+const DefaultEventLogSize = 1024
+
+// Limits on the page size of EventHistory.
+const (
+	DefaultHistoryLimit = 100
+	MaxHistoryLimit     = 1000
+)
+
+// EventPage is one page of the event log.
+type EventPage struct {
+	Events []Event `json:"events"`
+
+	// Oldest is the sequence number of the oldest retained event, or 0 if
+	// the log is empty. Events before it have been evicted.
+	Oldest uint64 `json:"oldest"`
+
+	// Next is the value of since that fetches the following page.
+	Next uint64 `json:"next"`
+
+	// More reports whether events after this page exist.
+	More bool `json:"more"`
+}
+
+// ReplayResult reports the outcome of Replay.
+type ReplayResult struct {
+	Replayed int        `json:"replayed"`
+	Nodes    []NodeData `json:"nodes"`
+}
+
+// ErrEventLogGap means the event log cannot rebuild the nodes because an
+// event refers to a node that doesn't exist at that point.
+var ErrEventLogGap = errors.New("event log does not describe a consistent history")
+
+// EventHistory returns up to limit retained events with a sequence number
+// above since, oldest first. A limit outside 1 to MaxHistoryLimit means
+// DefaultHistoryLimit.
+func (s *Simulator) EventHistory(since uint64, limit int) EventPage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.feedMu.Lock()
+	defer s.feedMu.Unlock()
+
+	if limit < 1 || limit > MaxHistoryLimit {
+		limit = DefaultHistoryLimit
+	}
+
+	events := s.eventsSince(since)
+	page := EventPage{Events: events, Next: since}
+	if len(events) > limit {
+		page.Events, page.More = events[:limit], true
+	}
+	if n := len(page.Events); n > 0 {
+		page.Next = page.Events[n-1].Seq
+	}
+	if len(s.eventLog) > 0 {
+		page.Oldest = s.eventLog[0].Seq
+	}
+	return page
+}
+
+// Replay resets the nodes to the state before the oldest retained event and
+// replays the event log on top of it, so the rebuilt nodes match the current
+// ones exactly when the log is a faithful record. Leadership is recomputed
+// afterwards. Replay doesn't publish events.
+func (s *Simulator) Replay() (ReplayResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	nodes := cloneNodes(s.eventBase)
+	for _, e := range s.eventLog {
+		var ok bool
+		if nodes, ok = applyEvent(nodes, e); !ok {
+			return ReplayResult{}, ErrEventLogGap
+		}
+	}
+
+	// Raft terms aren't logged, so each node keeps the term it has now.
+	for i := range nodes {
+		if index := s.findNode(nodes[i].ID); index >= 0 {
+			nodes[i].Term = s.nodes[index].Term
+		}
+	}
+	s.nodes = nodes
+	for i := range s.nodes {
+		s.nodes[i].Checksum = s.checksum(i) // Replicated keys may have changed since.
+	}
+	s.version++
+	s.electLeader()
+	s.queueStoreReset()
+	return ReplayResult{Replayed: len(s.eventLog), Nodes: cloneNodes(s.nodes)}, nil
+}
+
+// appendEvent appends e to the event log, evicting the oldest event into
+// the base snapshot once the log is full, and queues the changes for
+// Config.Store. The caller must hold s.mu for writing or s.feedMu.
+func (s *Simulator) appendEvent(e Event) {
+	s.eventLog = append(s.eventLog, e)
+	s.queueStore(storeOp{event: e})
+	s.trimEventLog()
+}
+
+// trimEventLog evicts the oldest events into the base snapshot until the
+// log fits in Config.EventLogSize. The caller must hold s.mu as for
+// appendEvent.
+func (s *Simulator) trimEventLog() {
+	for len(s.eventLog) > s.cfg.EventLogSize {
+		s.eventBase, _ = applyEvent(s.eventBase, s.eventLog[0])
+		s.queueStore(storeOp{event: s.eventLog[0], evicted: true})
+		s.eventLog[0] = Event{}
+		s.eventLog = s.eventLog[1:]
+	}
+}
+
+// resetEventLog empties the event log, takes the current nodes as its
+// base, and queues the result to replace the contents of Config.Store. The
+// caller must hold s.mu for writing.
+func (s *Simulator) resetEventLog() {
+	s.eventLog = nil
+	s.eventBase = cloneNodes(s.nodes)
+	s.queueStoreReset()
+}
+
+// eventsSince returns the retained events with a sequence number above seq.
+// The caller must hold s.mu for writing or s.feedMu.
+func (s *Simulator) eventsSince(seq uint64) []Event {
+	for i, e := range s.eventLog {
+		if e.Seq > seq {
+			return append([]Event{}, s.eventLog[i:]...)
+		}
+	}
+	return nil
+}
+
+// applyEvent returns nodes with e applied and false if e refers to a node
+// that nodes doesn't hold. It may modify nodes in place.
+func applyEvent(nodes []NodeData, e Event) ([]NodeData, bool) {
+	if e.Type == EventNodeAdded {
+		return append(nodes, e.Node.clone()), true
+	}
+
+	for i := range nodes {
+		if nodes[i].ID != e.Node.ID {
+			continue
+		}
+		if e.Type == EventNodeRemoved {
+			return append(nodes[:i], nodes[i+1:]...), true
+		}
+		nodes[i] = e.Node.clone()
+		return nodes, true
+	}
+	return nodes, false
+}
+
+// cloneNodes returns a deep copy of nodes.
+func cloneNodes(nodes []NodeData) []NodeData {
+	out := make([]NodeData, len(nodes))
+	for i := range nodes {
+		out[i] = nodes[i].clone()
+	}
+	return out
+}
@@ -0,0 +1,98 @@
+package simulator
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// mutate performs a mix of updates, failures, recoveries, and membership
+// changes on s.
+func mutate(s *Simulator) {
+	s.Update()
+	s.SetNode(1, "renamed", 42)
+	s.Fail(2)
+	s.AddNode("extra", 7)
+	s.Update()
+	s.Recover(2)
+	s.RemoveNode(3)
+	s.SetLatency(4, 0)
+	s.Fail(0)
+	s.Update()
+}
+
+// TestReplay tests that replaying the event log rebuilds the current nodes,
+// including after old events have been evicted.
+func TestReplay(t *testing.T) {
+	for _, size := range []int{DefaultEventLogSize, 3} {
+		t.Run(fmt.Sprintf("size=%d", size), func(t *testing.T) {
+			s := New(Config{Seed: 1, EventLogSize: size})
+			s.Init(testNodeCount)
+			mutate(s)
+			want := s.Snapshot()
+
+			rr := doRequest(t, s.Handler(), "POST", "/replay", "")
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, rr.Code, rr.Body)
+			}
+			var result ReplayResult
+			decodeBody(t, rr, &result)
+
+			// Failing primary node 0 hands its role to node 1 in two
+			// more events.
+			if wantReplayed := min(size, 12); result.Replayed != wantReplayed {
+				t.Errorf("Expected %d replayed events, got %d", wantReplayed, result.Replayed)
+			}
+			if got := s.Snapshot(); !reflect.DeepEqual(got, want) {
+				t.Errorf("Replayed nodes differ:\ngot  %+v\nwant %+v", got, want)
+			}
+			var wantJSON []NodeData
+			jsonRoundTrip(t, want, &wantJSON)
+			if !reflect.DeepEqual(result.Nodes, wantJSON) {
+				t.Errorf("Replay returned %+v, expected %+v", result.Nodes, wantJSON)
+			}
+		})
+	}
+}
+
+// TestEventHistory tests paging through GET /events/history.
+func TestEventHistory(t *testing.T) {
+	s := New(Config{EventLogSize: 8})
+	s.Init(testNodeCount)
+	h := s.Handler()
+	for i := 0; i < 10; i++ {
+		s.SetNode(0, "Node-0", i)
+	}
+
+	var seqs []uint64
+	var since uint64
+	for pages := 0; ; pages++ {
+		if pages == 10 {
+			t.Fatal("Paging did not terminate")
+		}
+		var page EventPage
+		decodeBody(t, doRequest(t, h, "GET", fmt.Sprintf("/events/history?since=%d&limit=3", since), ""), &page)
+		if page.Oldest != 3 {
+			t.Errorf("Expected the oldest retained event to be 3, got %d", page.Oldest)
+		}
+		for _, e := range page.Events {
+			seqs = append(seqs, e.Seq)
+		}
+		since = page.Next
+		if !page.More {
+			break
+		}
+	}
+
+	// The two oldest events were evicted.
+	if want := []uint64{3, 4, 5, 6, 7, 8, 9, 10}; !reflect.DeepEqual(seqs, want) {
+		t.Errorf("Expected sequence numbers %v, got %v", want, seqs)
+	}
+
+	for _, path := range []string{"/events/history?since=-1", "/events/history?limit=0", "/events/history?limit=5000"} {
+		if rr := doRequest(t, h, "GET", path, ""); rr.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: expected status code %d, but got %d", path, http.StatusBadRequest, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package simulator
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types published when nodes change.
+const (
+	EventNodeUpdated   = "node.updated"   // A node's value or name changed.
+	EventNodeFailed    = "node.failed"    // A node went down.
+	EventNodeRecovered = "node.recovered" // A node came back up.
+	EventNodeAdded     = "node.added"     // A node joined the cluster.
+	EventNodeRemoved   = "node.removed"   // A node left the cluster.
+)
+
+// Event describes one change to a node. For EventNodeRemoved, Node holds the
+// node as it was just before it was removed.
+type Event struct {
+	Seq  uint64    `json:"seq"` // Increases by one with every event.
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	Node NodeData  `json:"node"`
+}
+
+// subscriberBuffer is how many events a subscriber may fall behind by before
+// it is dropped.
+const subscriberBuffer = 64
+
+// hub broadcasts events to any number of subscribers. Publishing never
+// blocks: a subscriber whose buffer is full is dropped and its channel
+// closed, so a slow client can't hold up the simulator.
+type hub struct {
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+// subscribe returns a channel that receives every event published from now
+// on. The channel is closed if the subscriber falls too far behind.
+func (h *hub) subscribe() chan Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.subs == nil {
+		h.subs = make(map[chan Event]struct{})
+	}
+	ch := make(chan Event, subscriberBuffer)
+	h.subs[ch] = struct{}{}
+	return ch
+}
+
+// unsubscribe stops delivering events to ch and closes it, unless it was
+// already dropped.
+func (h *hub) unsubscribe(ch chan Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subs[ch]; ok {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
+
+// publish delivers e to every subscriber, dropping those that are full.
+func (h *hub) publish(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subs {
+		select {
+		case ch <- e:
+		default:
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// publish announces a change of the given type to the node at index and
+// appends it to the event log and, for new values, to the node's value
+// history. Every change is published, so it also advances the node version.
+// The caller must hold s.mu for writing, or for reading along with the
+// node's lock for writing, as Update does.
+func (s *Simulator) publish(eventType string, index int) {
+	s.nodes[index].Version++
+	s.announce(eventType, index)
+}
+
+// announce is publish without advancing the node version, for changes
+// replayed from a trace that already carry theirs. It also appends the event
+// to any trace being recorded, wakes the node's watches, and queues it for
+// the webhooks that want it. The caller must hold s.mu as for publish.
+// Holding s.feedMu, taken here, keeps event sequence numbers in the order the
+// changes were made and the subscribers seeing them in that order, even while
+// several updates run at once.
+func (s *Simulator) announce(eventType string, index int) {
+	s.feedMu.Lock()
+	defer s.feedMu.Unlock()
+
+	s.eventSeq++
+	s.version++
+	s.nodes[index].Checksum = s.checksum(index)
+	e := Event{Seq: s.eventSeq, Type: eventType, Time: time.Now(), Node: s.nodes[index].clone()}
+	s.appendEvent(e)
+	if eventType == EventNodeUpdated || eventType == EventNodeAdded {
+		s.recordValue(index, e.Time)
+	}
+	if s.recording {
+		s.trace.Events = append(s.trace.Events, TraceEvent{Tick: s.trace.Ticks, Event: e})
+	}
+	s.events.publish(e)
+	s.wakeWatchers(e.Node.ID)
+	s.notifyWebhooks(WebhookPayload{Type: e.Type, Time: e.Time, Seq: e.Seq, Node: &e.Node})
+}
@@ -0,0 +1,87 @@
+package simulator
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// exportNodes handles HTTP requests to export every node as newline-delimited
+// JSON. The nodes are copied under the lock and then written one line at a
+// time, so a slow client doesn't hold up the simulator.
+func (s *Simulator) exportNodes(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	nodes := s.sharedNodes().nodes
+	s.mu.RUnlock()
+
+	streamNDJSON(w, r, len(nodes), func(i int) interface{} { return nodes[i] })
+}
+
+// exportEvents handles HTTP requests to export the retained event log as
+// newline-delimited JSON, oldest first.
+func (s *Simulator) exportEvents(w http.ResponseWriter, r *http.Request) {
+	s.feedMu.Lock()
+	events := s.eventsSince(0)
+	s.feedMu.Unlock()
+
+	streamNDJSON(w, r, len(events), func(i int) interface{} { return events[i] })
+}
+
+// streamNDJSON writes the n values returned by record as newline-delimited
+// JSON, flushing after every line. The output is gzip-compressed if the
+// query parameter gzip=1 is set or the client accepts gzip.
+func streamNDJSON(w http.ResponseWriter, r *http.Request, n int, record func(int) interface{}) {
+	flusher, _ := w.(http.Flusher)
+	var out io.Writer = w
+	flush := func() {
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	w.Header().Set("Content-Type", mediaNDJSON)
+	w.Header().Set("Vary", "Accept-Encoding")
+	if r.URL.Query().Get("gzip") == "1" || acceptsGzip(r) {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		out = gz
+		flush = func() {
+			gz.Flush()
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(out)
+	for i := 0; i < n; i++ {
+		if err := encoder.Encode(record(i)); err != nil {
+			return
+		}
+		flush()
+	}
+}
+
+// acceptsGzip reports whether the Accept-Encoding header of r allows a
+// gzip-encoded response.
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if coding = strings.TrimSpace(coding); coding != "gzip" && coding != "*" {
+			continue
+		}
+		q := 1.0
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				q = parsed
+			}
+		}
+		return q > 0
+	}
+	return false
+}
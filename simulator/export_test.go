@@ -0,0 +1,127 @@
+package simulator
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// ndjsonLines returns the lines of body.
+func ndjsonLines(t *testing.T, body io.Reader) [][]byte {
+	t.Helper()
+
+	var lines [][]byte
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		lines = append(lines, append([]byte{}, scanner.Bytes()...))
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("Failed to read the export: %v", err)
+	}
+	return lines
+}
+
+// decodeNodeLines decodes every line of an export independently as a node.
+func decodeNodeLines(t *testing.T, lines [][]byte) []NodeData {
+	t.Helper()
+
+	nodes := make([]NodeData, len(lines))
+	for i, line := range lines {
+		if err := json.Unmarshal(line, &nodes[i]); err != nil {
+			t.Fatalf("Line %d %q doesn't parse: %v", i+1, line, err)
+		}
+	}
+	return nodes
+}
+
+// TestExportNodes tests streaming a 1000-node cluster from GET /nodes/export.
+func TestExportNodes(t *testing.T) {
+	s := New(Config{})
+	s.Init(1000)
+	h := s.Handler()
+
+	rr := doRequest(t, h, "GET", "/nodes/export", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Expected the NDJSON content type, got %q", ct)
+	}
+	if !rr.Flushed {
+		t.Error("Expected the export to be flushed")
+	}
+
+	nodes := decodeNodeLines(t, ndjsonLines(t, rr.Body))
+	if len(nodes) != 1000 {
+		t.Fatalf("Expected 1000 lines, got %d", len(nodes))
+	}
+	for i, node := range nodes {
+		if node.ID != i || node.Name == "" {
+			t.Fatalf("Line %d holds unexpected node %+v", i+1, node)
+		}
+	}
+}
+
+// TestExportGzip tests that exports are compressed on request.
+func TestExportGzip(t *testing.T) {
+	s := New(Config{})
+	s.Init(1000)
+	h := s.Handler()
+
+	for _, tt := range []struct {
+		path, acceptEncoding string
+	}{
+		{"/nodes/export?gzip=1", ""},
+		{"/nodes/export", "deflate, gzip;q=0.8"},
+	} {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		if got := rr.Header().Get("Content-Encoding"); got != "gzip" {
+			t.Fatalf("%s: expected gzip encoding, got %q", tt.path, got)
+		}
+		gz, err := gzip.NewReader(rr.Body)
+		if err != nil {
+			t.Fatalf("%s: failed to open the gzip stream: %v", tt.path, err)
+		}
+		if nodes := decodeNodeLines(t, ndjsonLines(t, gz)); len(nodes) != 1000 {
+			t.Errorf("%s: expected 1000 lines, got %d", tt.path, len(nodes))
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/nodes/export", nil)
+	req.Header.Set("Accept-Encoding", "gzip;q=0")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if got := rr.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Expected no encoding when gzip is refused, got %q", got)
+	}
+}
+
+// TestExportEvents tests exporting the event log from GET /events/export.
+func TestExportEvents(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	mutate(s)
+
+	lines := ndjsonLines(t, doRequest(t, s.Handler(), "GET", "/events/export", "").Body)
+	want := s.EventHistory(0, MaxHistoryLimit).Events
+	if len(lines) != len(want) {
+		t.Fatalf("Expected %d lines, got %d", len(want), len(lines))
+	}
+	for i, line := range lines {
+		var e Event
+		if err := json.Unmarshal(line, &e); err != nil {
+			t.Fatalf("Line %d %q doesn't parse: %v", i+1, line, err)
+		}
+		if e.Seq != want[i].Seq || e.Type != want[i].Type || e.Node.ID != want[i].Node.ID {
+			t.Errorf("Line %d: expected event %d %s, got %d %s", i+1, want[i].Seq, want[i].Type, e.Seq, e.Type)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package simulator
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Media types GET /nodes and GET /nodes/{id} can respond with.
+const (
+	mediaJSON = "application/json"
+	mediaXML  = "application/xml"
+	mediaCSV  = "text/csv"
+)
+
+// negotiate returns the media type that best satisfies the Accept header of
+// r, preferring JSON on ties and falling back to it when nothing listed is
+// supported.
+func negotiate(r *http.Request) string {
+	best, bestQ := mediaJSON, 0.0
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+
+		switch mediaType {
+		case "application/json", "*/*", "application/*":
+			mediaType = mediaJSON
+		case "application/xml", "text/xml":
+			mediaType = mediaXML
+		case "text/csv":
+		default:
+			continue
+		}
+		if q > bestQ || (q == bestQ && mediaType == mediaJSON) {
+			best, bestQ = mediaType, q
+		}
+	}
+	return best
+}
+
+// xmlNodes is the XML encoding of a node list or NodePage.
+type xmlNodes struct {
+	XMLName    xml.Name   `xml:"nodes"`
+	Total      *int       `xml:"total,attr,omitempty"`
+	NextOffset *int       `xml:"next_offset,attr,omitempty"`
+	Nodes      []NodeData `xml:"node"`
+}
+
+// csvHeader names the columns of CSV output, matching the JSON field names.
+var csvHeader = []string{"id", "name", "value", "time", "status", "leader", "term", "latency", "suspected", "vector_clock", "version", "hlc", "clock", "skew", "region", "zone", "tags", "role", "byzantine", "membership", "resources"}
+
+// csvRecord returns the CSV columns of node. The vector clock, hybrid
+// logical clock timestamps, tags, and resource usage are encoded as JSON
+// objects, as in JSON output, except that a node without tags has an empty
+// tags column.
+func csvRecord(node NodeData) []string {
+	var tags []byte
+	if len(node.Tags) > 0 {
+		tags, _ = json.Marshal(node.Tags)
+	}
+	clock, _ := json.Marshal(node.VectorClock)
+	hlc, _ := json.Marshal(node.HLC)
+	hlcClock, _ := json.Marshal(node.Clock)
+	resources, _ := json.Marshal(node.Resources)
+	return []string{
+		strconv.Itoa(node.ID),
+		node.Name,
+		strconv.Itoa(node.Value),
+		node.Time.Format(time.RFC3339Nano),
+		node.Status,
+		strconv.FormatBool(node.Leader),
+		strconv.FormatUint(node.Term, 10),
+		time.Duration(node.Latency).String(),
+		strconv.FormatBool(node.Suspected),
+		string(clock),
+		strconv.FormatUint(node.Version, 10),
+		string(hlc),
+		string(hlcClock),
+		time.Duration(node.Skew).String(),
+		node.Region,
+		node.Zone,
+		string(tags),
+		node.Role,
+		strconv.FormatBool(node.Byzantine),
+		node.Membership,
+		string(resources),
+	}
+}
+
+// writeNodes writes nodes in the given media type. If page is
+// set, its nodes are written instead, and its totals are included as XML
+// attributes or, for CSV, as the X-Total-Count and X-Next-Offset headers.
+func writeNodes(w http.ResponseWriter, media string, nodes []NodeData, page *NodePage) {
+	if media == mediaJSON {
+		if page != nil {
+			writeJSON(w, http.StatusOK, page)
+		} else {
+			writeJSON(w, http.StatusOK, nodes)
+		}
+		return
+	}
+
+	var total, next *int
+	if page != nil {
+		nodes, total, next = page.Nodes, &page.Total, page.NextOffset
+	}
+	if media == mediaXML {
+		writeXML(w, xmlNodes{Total: total, NextOffset: next, Nodes: nodes})
+		return
+	}
+
+	if total != nil {
+		w.Header().Set("X-Total-Count", strconv.Itoa(*total))
+	}
+	if next != nil {
+		w.Header().Set("X-Next-Offset", strconv.Itoa(*next))
+	}
+	records := [][]string{csvHeader}
+	for _, node := range nodes {
+		records = append(records, csvRecord(node))
+	}
+	writeCSV(w, records)
+}
+
+// writeNode writes node in the given media type.
+func writeNode(w http.ResponseWriter, media string, node NodeData) {
+	w.Header().Set("Vary", "Accept")
+	switch media {
+	case mediaXML:
+		writeXML(w, struct {
+			XMLName xml.Name `xml:"node"`
+			NodeData
+		}{NodeData: node})
+	case mediaCSV:
+		writeCSV(w, [][]string{csvHeader, csvRecord(node)})
+	default:
+		writeJSON(w, http.StatusOK, node)
+	}
+}
+
+// writeXML writes v as an XML document with a 200 status.
+func writeXML(w http.ResponseWriter, v interface{}) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		slog.Error("failed to marshal response", "err", err)
+		writeError(w, http.StatusInternalServerError, "Failed to marshal data")
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaXML+"; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(append([]byte(xml.Header), data...)); err != nil {
+		slog.Error("failed to write response", "err", err)
+	}
+}
+
+// writeCSV writes records as CSV with a 200 status.
+func writeCSV(w http.ResponseWriter, records [][]string) {
+	w.Header().Set("Content-Type", mediaCSV+"; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := csv.NewWriter(w).WriteAll(records); err != nil {
+		slog.Error("failed to write response", "err", err)
+	}
+}
@@ -0,0 +1,172 @@
+package simulator
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// getAs issues a GET request for path with the given Accept header.
+func getAs(h http.Handler, path, accept string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", path, nil)
+	req.Header.Set("Accept", accept)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+// formatNodes returns a simulator whose nodes exercise every field.
+func formatNodes(t *testing.T) *Simulator {
+	t.Helper()
+
+	s := New(Config{Latency: 15 * time.Millisecond})
+	s.Init(3)
+	s.SetNode(1, `Node "one", with <markup>`, 42)
+	region, rack := "eu-west", "r1"
+	s.PatchMetadata(1, MetadataPatch{Region: &region, Tags: map[string]*string{"rack": &rack, "tier": &region}})
+	s.Fail(2)
+	s.mu.Lock()
+	s.nodes[s.findNode(1)].Resources = Resources{CPU: 12.5, Memory: 2048, Disk: 256, Overloaded: true}
+	s.mu.Unlock()
+	return s
+}
+
+// TestXMLOutput tests that GET /nodes and GET /nodes/{id} honor
+// Accept: application/xml.
+func TestXMLOutput(t *testing.T) {
+	s := formatNodes(t)
+	h := s.Handler()
+	var want []NodeData
+	jsonRoundTrip(t, s.Snapshot(), &want)
+
+	rr := getAs(h, "/nodes", "application/xml")
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/xml") {
+		t.Fatalf("Expected an XML content type, got %q", ct)
+	}
+	var list xmlNodes
+	if err := xml.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("Failed to parse XML %q: %v", rr.Body, err)
+	}
+	if !reflect.DeepEqual(list.Nodes, want) {
+		t.Errorf("XML nodes differ:\ngot  %+v\nwant %+v", list.Nodes, want)
+	}
+	if !strings.Contains(rr.Body.String(), "<vector_clock><entry node=\"1\">2</entry></vector_clock>") {
+		t.Errorf("Expected vector clock entries named after JSON fields, got %s", rr.Body)
+	}
+	if !strings.Contains(rr.Body.String(), `<tags><tag key="rack">r1</tag><tag key="tier">eu-west</tag></tags>`) {
+		t.Errorf("Expected tags in key order, got %s", rr.Body)
+	}
+
+	rr = getAs(h, "/nodes/1", "text/xml")
+	var node NodeData
+	if err := xml.Unmarshal(rr.Body.Bytes(), &node); err != nil {
+		t.Fatalf("Failed to parse XML %q: %v", rr.Body, err)
+	}
+	if !reflect.DeepEqual(node, want[1]) {
+		t.Errorf("XML node differs:\ngot  %+v\nwant %+v", node, want[1])
+	}
+
+	rr = getAs(h, "/nodes?limit=2", "application/xml")
+	var page xmlNodes
+	if err := xml.Unmarshal(rr.Body.Bytes(), &page); err != nil {
+		t.Fatalf("Failed to parse XML %q: %v", rr.Body, err)
+	}
+	if len(page.Nodes) != 2 || page.Total == nil || *page.Total != 3 || page.NextOffset == nil || *page.NextOffset != 2 {
+		t.Errorf("Expected a page of 2 of 3 nodes, got %s", rr.Body)
+	}
+}
+
+// TestCSVOutput tests that GET /nodes and GET /nodes/{id} honor
+// Accept: text/csv.
+func TestCSVOutput(t *testing.T) {
+	s := formatNodes(t)
+	h := s.Handler()
+	nodes := s.Snapshot()
+
+	for _, path := range []string{"/nodes", "/nodes/1"} {
+		rr := getAs(h, path, "text/csv")
+		if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+			t.Fatalf("%s: expected a CSV content type, got %q", path, ct)
+		}
+		records, err := csv.NewReader(rr.Body).ReadAll()
+		if err != nil {
+			t.Fatalf("%s: failed to parse CSV: %v", path, err)
+		}
+		if !reflect.DeepEqual(records[0], csvHeader) {
+			t.Errorf("%s: expected header %v, got %v", path, csvHeader, records[0])
+		}
+
+		want := nodes
+		if path == "/nodes/1" {
+			want = nodes[1:2]
+		}
+		if len(records) != len(want)+1 {
+			t.Fatalf("%s: expected %d rows, got %d", path, len(want)+1, len(records))
+		}
+		for i, node := range want {
+			row := records[i+1]
+			if row[1] != node.Name || row[4] != node.Status || row[7] != "15ms" {
+				t.Errorf("%s: row %v doesn't match node %+v", path, row, node)
+			}
+			if node.ID == 1 && (row[14] != "eu-west" || row[16] != `{"rack":"r1","tier":"eu-west"}`) {
+				t.Errorf("%s: expected node 1's region and tags, got %v", path, row)
+			}
+			resources := `{"cpu":0,"memory":0,"disk":0,"overloaded":false}`
+			if node.ID == 1 {
+				resources = `{"cpu":12.5,"memory":2048,"disk":256,"overloaded":true}`
+			}
+			if row[20] != resources {
+				t.Errorf("%s: expected node %d's resources %s, got %q", path, node.ID, resources, row[20])
+			}
+			parsed, err := time.Parse(time.RFC3339Nano, row[3])
+			if err != nil || !parsed.Equal(node.Time) {
+				t.Errorf("%s: expected time %v, got %q", path, node.Time, row[3])
+			}
+		}
+	}
+
+	rr := getAs(h, "/nodes?limit=1&offset=1", "text/csv")
+	if rr.Header().Get("X-Total-Count") != "3" || rr.Header().Get("X-Next-Offset") != "2" {
+		t.Errorf("Expected paging headers 3 and 2, got %q and %q", rr.Header().Get("X-Total-Count"), rr.Header().Get("X-Next-Offset"))
+	}
+}
+
+// TestNegotiate tests choosing a media type from the Accept header.
+func TestNegotiate(t *testing.T) {
+	for _, tt := range []struct {
+		accept string
+		want   string
+	}{
+		{"", mediaJSON},
+		{"*/*", mediaJSON},
+		{"image/png", mediaJSON},
+		{"not a media type", mediaJSON},
+		{"text/csv", mediaCSV},
+		{"text/csv;q=0.5, application/xml", mediaXML},
+		{"text/csv, application/json", mediaJSON},
+		{"application/json;q=0.1, text/csv;q=0.9", mediaCSV},
+	} {
+		req := httptest.NewRequest("GET", "/nodes", nil)
+		req.Header.Set("Accept", tt.accept)
+		if got := negotiate(req); got != tt.want {
+			t.Errorf("Accept %q: expected %s, got %s", tt.accept, tt.want, got)
+		}
+	}
+
+	// Unknown types fall back to JSON, and each representation has its own
+	// ETag.
+	s := formatNodes(t)
+	h := s.Handler()
+	rr := getAs(h, "/nodes", "image/png")
+	if ct := rr.Header().Get("Content-Type"); ct != mediaJSON {
+		t.Errorf("Expected a JSON fallback, got %q", ct)
+	}
+	if getAs(h, "/nodes", "text/csv").Header().Get("ETag") == rr.Header().Get("ETag") {
+		t.Error("Expected CSV and JSON to have different ETags")
+	}
+}
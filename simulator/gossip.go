@@ -0,0 +1,178 @@
+package simulator
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+// Convergence reports how many up nodes agree on the latest value, that is,
+// the value of the up node(s) with the newest HLC timestamp.
+type Convergence struct {
+	Nodes       []int     `json:"nodes,omitempty"` // Set for partition groups only.
+	LatestValue int       `json:"latest_value"`
+	LatestTime  time.Time `json:"latest_time"`
+	LatestHLC   HLC       `json:"latest_hlc"`
+	Agreeing    int       `json:"agreeing"`
+	Total       int       `json:"total"`
+	Converged   bool      `json:"converged"`
+
+	// Groups reports convergence within each partition group while the
+	// cluster is partitioned.
+	Groups []Convergence `json:"groups,omitempty"`
+}
+
+// StartGossip runs a gossip round once per interval until ctx is cancelled.
+// It blocks, so callers typically run it in its own goroutine.
+func (s *Simulator) StartGossip(ctx context.Context, interval time.Duration) {
+	ticker := s.cfg.Clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			s.GossipRound()
+		}
+	}
+}
+
+// GossipRound performs one round of gossip: every up node picks
+// Tunables.GossipFanout random up peers it can reach, or all of them if
+// fewer, and exchanges values with each, with the older of the two adopting
+// the newer value. The hybrid logical clock timestamp is used as the version,
+// so a node's value only ever moves forward and a causally later write wins
+// even when its wall clock is behind. The two also merge their CRDT replicas.
+// While the cluster is partitioned, nodes only reach peers in their own
+// group, and witnesses, which store no data, take no part. Values sent in
+// earlier rounds that have arrived by now are applied first; under a latency
+// model, a value sent this round arrives in a later one.
+func (s *Simulator) GossipRound() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.cfg.Clock.Now()
+	s.deliverArrived(now)
+
+	fanout := s.Tunables().GossipFanout
+	up := slices.DeleteFunc(s.indicesWithStatus(StatusUp), func(i int) bool { return s.nodes[i].Role == RoleWitness })
+	peers := make([]int, 0, len(up))
+	for _, i := range up {
+		peers = peers[:0]
+		for _, j := range up {
+			if j != i && s.reachable(s.nodes[i].ID, s.nodes[j].ID) {
+				peers = append(peers, j)
+			}
+		}
+		if len(peers) == 0 {
+			continue
+		}
+		// Draw the peers without replacement, moving each to the front.
+		for n := 0; n < min(fanout, len(peers)); n++ {
+			m := n + s.rng.Intn(len(peers)-n)
+			peers[n], peers[m] = peers[m], peers[n]
+			j := peers[n]
+			s.exchange(now, i, j)
+			s.mergeCRDTs(s.nodes[i].ID, s.nodes[j].ID)
+		}
+	}
+}
+
+// exchange sends the newer of the values held by the nodes at indices i and
+// j to the other node at now, unless the message carrying it is lost. The
+// caller must hold s.mu for writing.
+func (s *Simulator) exchange(now time.Time, i, j int) {
+	a, b := &s.nodes[i], &s.nodes[j]
+	switch {
+	case a.HLC.After(b.HLC):
+		if s.deliver(a.ID, b.ID) {
+			s.sendValue(now, i, j)
+		}
+	case b.HLC.After(a.HLC):
+		if s.deliver(b.ID, a.ID) {
+			s.sendValue(now, j, i)
+		}
+	}
+}
+
+// sendValue sends the value of the node at index from to the node at index to
+// at now, which adopts it on arrival unless it has since seen a newer one or
+// gone down. The caller must hold s.mu for writing.
+func (s *Simulator) sendValue(now time.Time, from, to int) {
+	src := &s.nodes[from]
+	msg := src.stamp()
+	s.version++ // The sender's Clock moved.
+	sent := NodeData{Value: src.Value, Time: src.Time, HLC: src.HLC, VectorClock: src.VectorClock.clone()}
+	if src.Byzantine {
+		sent.Value = s.corruptValue(sent.Value)
+	}
+	dstID := s.nodes[to].ID
+	payload := gossipPayload{Value: sent.Value, Time: sent.Time, HLC: sent.HLC, Stamp: msg, VectorClock: sent.VectorClock}
+	s.send(now, src.ID, dstID, MessageGossip, "", payload, func(time.Time) {
+		index := s.findNode(dstID)
+		if index < 0 || s.nodes[index].Status != StatusUp || !sent.HLC.After(s.nodes[index].HLC) {
+			return
+		}
+		receive(&s.nodes[index], sent, msg)
+		s.publish(EventNodeUpdated, index)
+	})
+}
+
+// receive makes dst adopt the value of src, sent in a message stamped msg,
+// along with its timestamps. Sending was an event on src and receiving is
+// one on dst, so dst's hybrid logical clock moves past msg, and dst merges
+// src's vector clock and advances its own entry.
+func receive(dst *NodeData, src NodeData, msg HLC) {
+	dst.observe(msg)
+	dst.Value, dst.Time, dst.HLC = src.Value, src.Time, src.HLC
+	if dst.VectorClock == nil {
+		dst.VectorClock = VectorClock{}
+	}
+	dst.VectorClock.merge(src.VectorClock)
+	dst.VectorClock[dst.ID]++
+}
+
+// Convergence returns how many up nodes currently agree on the latest value.
+// While the cluster is partitioned, it also reports convergence within each
+// group.
+func (s *Simulator) Convergence() Convergence {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.rlockNodes()
+	defer s.runlockNodes()
+
+	c := s.convergence(s.indicesWithStatus(StatusUp))
+	for _, group := range s.groups {
+		var indices []int
+		for _, id := range group {
+			if index := s.findNode(id); index >= 0 && s.nodes[index].Status == StatusUp {
+				indices = append(indices, index)
+			}
+		}
+		gc := s.convergence(indices)
+		gc.Nodes = append([]int{}, group...)
+		c.Groups = append(c.Groups, gc)
+	}
+	return c
+}
+
+// convergence computes the convergence of the nodes at the given indices. The
+// caller must hold s.mu.
+func (s *Simulator) convergence(indices []int) Convergence {
+	c := Convergence{Total: len(indices)}
+	for _, i := range indices {
+		if s.nodes[i].HLC.After(c.LatestHLC) {
+			c.LatestValue = s.nodes[i].Value
+			c.LatestTime = s.nodes[i].Time
+			c.LatestHLC = s.nodes[i].HLC
+		}
+	}
+	for _, i := range indices {
+		if s.nodes[i].HLC == c.LatestHLC && s.nodes[i].Value == c.LatestValue {
+			c.Agreeing++
+		}
+	}
+	c.Converged = c.Agreeing == c.Total
+	return c
+}
@@ -0,0 +1,84 @@
+package simulator
+
+import (
+	"net/http"
+	"testing"
+)
+
+// TestGossipConvergence tests that a value written to one node spreads to
+// every up node over several gossip rounds.
+func TestGossipConvergence(t *testing.T) {
+	s := New(Config{Seed: 1, Mode: ModeGossip})
+	s.Init(20)
+	h := s.Handler()
+
+	// Write a new value to one node; it is now the latest.
+	s.SetNode(7, "Node-7", 1234)
+
+	var c Convergence
+	decodeBody(t, doRequest(t, h, "GET", "/convergence", ""), &c)
+	if c.LatestValue != 1234 || c.Agreeing != 1 || c.Total != 20 || c.Converged {
+		t.Fatalf("Unexpected convergence before gossip: %+v", c)
+	}
+
+	// Values converge over several rounds rather than instantly.
+	rounds := 0
+	for !s.Convergence().Converged {
+		if rounds == 50 {
+			t.Fatalf("Did not converge after %d rounds: %+v", rounds, s.Convergence())
+		}
+		s.GossipRound()
+		rounds++
+	}
+	if rounds < 2 {
+		t.Errorf("Expected convergence to take several rounds, but took %d", rounds)
+	}
+
+	rr := doRequest(t, h, "GET", "/convergence", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, rr.Code)
+	}
+	decodeBody(t, rr, &c)
+	if !c.Converged || c.Agreeing != 20 || c.LatestValue != 1234 {
+		t.Errorf("Unexpected convergence after gossip: %+v", c)
+	}
+	for _, node := range s.Snapshot() {
+		if node.Value != 1234 {
+			t.Errorf("Node %d has value %d, expected 1234", node.ID, node.Value)
+		}
+	}
+}
+
+// TestGossipSkipsDownNodes tests that down nodes neither receive nor spread
+// values.
+func TestGossipSkipsDownNodes(t *testing.T) {
+	s := New(Config{Seed: 1, Mode: ModeGossip})
+	s.Init(testNodeCount)
+	s.Fail(3)
+	before := s.Snapshot()[3]
+
+	s.SetNode(0, "Node-0", 999)
+	for i := 0; i < 50; i++ {
+		s.GossipRound()
+	}
+
+	if after := s.Snapshot()[3]; after.Value != before.Value || !after.Time.Equal(before.Time) {
+		t.Errorf("Down node received gossip: before %+v, after %+v", before, after)
+	}
+	if c := s.Convergence(); !c.Converged || c.Total != testNodeCount-1 {
+		t.Errorf("Expected the up nodes to converge, got %+v", c)
+	}
+}
+
+// TestGossipFanout tests that a node gossips with Tunables.GossipFanout
+// peers per round, so a fanout reaching every peer converges in one round.
+func TestGossipFanout(t *testing.T) {
+	s := New(Config{Seed: 1, Mode: ModeGossip, GossipFanout: 19})
+	s.Init(20)
+	s.SetNode(7, "Node-7", 1234)
+
+	s.GossipRound()
+	if c := s.Convergence(); !c.Converged || c.LatestValue != 1234 {
+		t.Errorf("Expected one round to converge, got %+v", c)
+	}
+}
@@ -0,0 +1,125 @@
+package simulator
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"DistributedSystemSimulator/simulator/simulatorpb"
+)
+
+// GRPCServer returns a gRPC server serving the simulator's gRPC API, which
+// shares its state and API key requirements with the HTTP API.
+func (s *Simulator) GRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	server := grpc.NewServer(append(s.grpcAuthInterceptors(), opts...)...)
+	simulatorpb.RegisterSimulatorServer(server, &grpcService{s: s})
+	return server
+}
+
+// grpcService implements simulatorpb.SimulatorServer on top of a Simulator.
+type grpcService struct {
+	simulatorpb.UnimplementedSimulatorServer
+	s *Simulator
+}
+
+// ListNodes returns every node.
+func (g *grpcService) ListNodes(ctx context.Context, req *simulatorpb.ListNodesRequest) (*simulatorpb.ListNodesResponse, error) {
+	nodes := g.s.Snapshot()
+	resp := &simulatorpb.ListNodesResponse{Nodes: make([]*simulatorpb.NodeData, len(nodes))}
+	for i, node := range nodes {
+		resp.Nodes[i] = nodeToProto(node)
+	}
+	return resp, nil
+}
+
+// GetNode returns one node, mirroring GET /nodes/{id}.
+func (g *grpcService) GetNode(ctx context.Context, req *simulatorpb.GetNodeRequest) (*simulatorpb.NodeData, error) {
+	node, found := g.s.Node(int(req.GetId()))
+	if !found {
+		return nil, status.Error(codes.NotFound, "node not found")
+	}
+	if node.Status == StatusDown {
+		return nil, status.Error(codes.Unavailable, "node is down")
+	}
+	return nodeToProto(node), nil
+}
+
+// UpdateNode sets a node's name and value, mirroring PUT /nodes/{id}.
+func (g *grpcService) UpdateNode(ctx context.Context, req *simulatorpb.UpdateNodeRequest) (*simulatorpb.NodeData, error) {
+	if req.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "name is required")
+	}
+	node, found := g.s.SetNode(int(req.GetId()), req.GetName(), int(req.GetValue()))
+	if !found {
+		return nil, status.Error(codes.NotFound, "node not found")
+	}
+	return nodeToProto(node), nil
+}
+
+// WatchNodes streams node changes from the same event hub as /ws and
+// /events. Response headers are sent once the subscription is in place, so
+// a client that waits for them sees every change made afterwards.
+func (g *grpcService) WatchNodes(req *simulatorpb.WatchNodesRequest, stream simulatorpb.Simulator_WatchNodesServer) error {
+	events := g.s.events.subscribe()
+	defer g.s.events.unsubscribe(events)
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-g.s.drained:
+			return status.Error(codes.Unavailable, "shutting down")
+		case e, ok := <-events:
+			if !ok {
+				g.s.logger.Warn("dropped slow gRPC watcher")
+				return status.Error(codes.ResourceExhausted, "client fell too far behind")
+			}
+			if err := stream.Send(eventToProto(e)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// nodeToProto converts node to its Protocol Buffers message.
+func nodeToProto(node NodeData) *simulatorpb.NodeData {
+	clock := make(map[int64]uint64, len(node.VectorClock))
+	for id, n := range node.VectorClock {
+		clock[int64(id)] = n
+	}
+	return &simulatorpb.NodeData{
+		Id:          int64(node.ID),
+		Name:        node.Name,
+		Value:       int64(node.Value),
+		Time:        timestamppb.New(node.Time),
+		Status:      node.Status,
+		Leader:      node.Leader,
+		Term:        node.Term,
+		Latency:     durationpb.New(time.Duration(node.Latency)),
+		Suspected:   node.Suspected,
+		VectorClock: clock,
+		Version:     node.Version,
+		Hlc:         &simulatorpb.Hlc{Physical: node.HLC.Physical, Logical: node.HLC.Logical},
+		Skew:        durationpb.New(time.Duration(node.Skew)),
+		Clock:       &simulatorpb.Hlc{Physical: node.Clock.Physical, Logical: node.Clock.Logical},
+	}
+}
+
+// eventToProto converts e to its Protocol Buffers message.
+func eventToProto(e Event) *simulatorpb.NodeEvent {
+	return &simulatorpb.NodeEvent{
+		Seq:  e.Seq,
+		Type: e.Type,
+		Time: timestamppb.New(e.Time),
+		Node: nodeToProto(e.Node),
+	}
+}
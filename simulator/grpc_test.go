@@ -0,0 +1,128 @@
+package simulator
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"DistributedSystemSimulator/simulator/simulatorpb"
+)
+
+// dialGRPC serves s's gRPC API over an in-process connection and returns a
+// client for it.
+func dialGRPC(t *testing.T, s *Simulator) simulatorpb.SimulatorClient {
+	t.Helper()
+
+	ln := bufconn.Listen(1 << 20)
+	server := s.GRPCServer()
+	go server.Serve(ln)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return ln.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return simulatorpb.NewSimulatorClient(conn)
+}
+
+// TestGRPCListAndUpdate tests listing, getting, and updating nodes over
+// gRPC, and that changes are visible to the HTTP API.
+func TestGRPCListAndUpdate(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	client := dialGRPC(t, s)
+	ctx := context.Background()
+
+	list, err := client.ListNodes(ctx, &simulatorpb.ListNodesRequest{})
+	if err != nil {
+		t.Fatalf("ListNodes failed: %v", err)
+	}
+	if len(list.Nodes) != testNodeCount {
+		t.Fatalf("Expected %d nodes, got %d", testNodeCount, len(list.Nodes))
+	}
+	for i, node := range s.Snapshot() {
+		got := list.Nodes[i]
+		if got.Id != int64(node.ID) || got.Name != node.Name || got.Value != int64(node.Value) || !got.Time.AsTime().Equal(node.Time) {
+			t.Errorf("Node %d differs: got %v, want %+v", i, got, node)
+		}
+	}
+
+	updated, err := client.UpdateNode(ctx, &simulatorpb.UpdateNodeRequest{Id: 2, Name: "via-grpc", Value: 77})
+	if err != nil {
+		t.Fatalf("UpdateNode failed: %v", err)
+	}
+	if updated.Name != "via-grpc" || updated.Value != 77 {
+		t.Errorf("Expected the updated node, got %v", updated)
+	}
+	var node NodeData
+	decodeBody(t, doRequest(t, s.Handler(), "GET", "/nodes/2", ""), &node)
+	if node.Name != "via-grpc" || node.Value != 77 {
+		t.Errorf("Expected the HTTP API to see the update, got %+v", node)
+	}
+
+	s.Fail(3)
+	_, err = client.GetNode(ctx, &simulatorpb.GetNodeRequest{Id: 99})
+	expectGRPCCode(t, err, codes.NotFound)
+	_, err = client.GetNode(ctx, &simulatorpb.GetNodeRequest{Id: 3})
+	expectGRPCCode(t, err, codes.Unavailable)
+	_, err = client.UpdateNode(ctx, &simulatorpb.UpdateNodeRequest{Id: 99, Name: "x"})
+	expectGRPCCode(t, err, codes.NotFound)
+	_, err = client.UpdateNode(ctx, &simulatorpb.UpdateNodeRequest{Id: 0})
+	expectGRPCCode(t, err, codes.InvalidArgument)
+}
+
+// expectGRPCCode fails the test unless err carries the status code want.
+func expectGRPCCode(t *testing.T, err error, want codes.Code) {
+	t.Helper()
+
+	if got := status.Code(err); got != want {
+		t.Errorf("Expected code %v, got %v (%v)", want, got, err)
+	}
+}
+
+// TestGRPCWatchNodes tests that WatchNodes streams node changes.
+func TestGRPCWatchNodes(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	client := dialGRPC(t, s)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.WatchNodes(ctx, &simulatorpb.WatchNodesRequest{})
+	if err != nil {
+		t.Fatalf("WatchNodes failed: %v", err)
+	}
+	// The headers arrive once the server has subscribed.
+	if _, err := stream.Header(); err != nil {
+		t.Fatalf("Failed to receive headers: %v", err)
+	}
+
+	s.SetNode(1, "watched", 5)
+	s.Fail(1)
+	for _, want := range []string{EventNodeUpdated, EventNodeFailed} {
+		e, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv failed: %v", err)
+		}
+		if e.Type != want || e.Node.GetId() != 1 || e.Node.GetName() != "watched" {
+			t.Errorf("Expected a %s event for node 1, got %v", want, e)
+		}
+	}
+
+	// Draining ends the stream.
+	s.Drain()
+	_, err = stream.Recv()
+	expectGRPCCode(t, err, codes.Unavailable)
+}
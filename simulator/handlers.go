@@ -0,0 +1,994 @@
+package simulator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Handler returns an http.Handler serving the simulator's HTTP API, with
+// request IDs, logging, CORS, metrics, rate limiting, authentication,
+// compression, and simulated latency applied to the routes of NewRouter.
+func (s *Simulator) Handler() http.Handler {
+	mux := s.routes()
+	return withRequestID(s.withTelemetry(mux, s.withLogging(s.withAudit(s.withCORS(s.withMetrics(mux, s.withRateLimit(s.withAuth(s.withCompression(s.withLatency(withJSONErrors(mux)))))))))))
+}
+
+// NewRouter returns an http.Handler routing each endpoint of s's HTTP API by
+// method and path, without the middleware Handler adds. A request for a
+// known path with the wrong method gets 405 Method Not Allowed with an Allow
+// header listing the methods the path accepts, and one for an unknown path
+// gets 404 Not Found, both with an ErrorResponse body.
+func NewRouter(s *Simulator) http.Handler {
+	return withJSONErrors(s.routes())
+}
+
+// routes returns a mux with every endpoint of the HTTP API registered.
+func (s *Simulator) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	for _, rt := range s.apiRoutes() {
+		mux.HandleFunc(rt.pattern(), rt.handler)
+	}
+	if s.cfg.Debug {
+		mux.Handle("/debug/", s.debugHandler()) // Profiling and runtime state
+	}
+	mux.Handle(clusterRoutes, s.clusterRouter(mux)) // The API of every cluster
+	return mux
+}
+
+// getNodeData handles HTTP requests to retrieve node data as JSON, XML, or
+// CSV, depending on the Accept header. With any of the query parameters of
+// NodeQuery, it returns the selected page of nodes in a NodePage instead of
+// the plain list. The response carries an ETag, and a request whose
+// If-None-Match matches it gets 304 Not Modified without a body.
+func (s *Simulator) getNodeData(w http.ResponseWriter, r *http.Request) {
+	query, ok := parseNodeQuery(w, r)
+	if !ok {
+		return
+	}
+	media := negotiate(r)
+
+	// Encoding the nodes, which may be slow, happens on a copy taken at a
+	// single version, without holding up updates or membership changes.
+	s.mu.RLock()
+	snap := s.sharedNodes()
+	s.mu.RUnlock()
+
+	etag := s.nodesETag(snap.version, media)
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Vary", "Accept")
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if query != nil {
+		page := query.apply(snap.nodes)
+		writeNodes(w, media, nil, &page)
+		return
+	}
+	if media == mediaJSON {
+		// Every plain JSON listing between two changes is the same, so it
+		// is marshaled once and served from the snapshot after that.
+		data, err := snap.marshalJSON()
+		if err != nil {
+			slog.Error("failed to marshal response", "err", err)
+			writeError(w, http.StatusInternalServerError, "Failed to marshal data")
+			return
+		}
+		writeJSONData(w, http.StatusOK, data)
+		return
+	}
+	writeNodes(w, media, snap.nodes, nil)
+}
+
+// getSingleNode handles HTTP requests to retrieve a single node by its ID.
+func (s *Simulator) getSingleNode(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseNodeID(w, r)
+	if !ok {
+		return
+	}
+
+	node, found := s.ReadNode(id)
+	if !found {
+		writeError(w, http.StatusNotFound, "Node not found")
+		return
+	}
+	if node.Status == StatusDown {
+		writeError(w, http.StatusServiceUnavailable, "Node is down")
+		return
+	}
+
+	w.Header().Set("ETag", nodeETag(node))
+	writeNode(w, negotiate(r), node)
+}
+
+// nodeUpdateRequest is the JSON payload accepted by putNode and createNode.
+// Fields are pointers so missing fields can be told apart from zero values.
+type nodeUpdateRequest struct {
+	Name  *string `json:"name"`
+	Value *int    `json:"value"`
+
+	// NodeMetadata places a node createNode adds. putNode rejects it;
+	// PATCH /nodes/{id}/metadata changes it instead.
+	NodeMetadata
+
+	// Version makes putNode conditional on the node's current version, like
+	// an If-Match header.
+	Version *uint64 `json:"version,omitempty"`
+}
+
+// decodeNodePayload decodes and validates a nodeUpdateRequest from the request
+// body. It writes a 400 response and returns false if the payload is invalid.
+func decodeNodePayload(w http.ResponseWriter, r *http.Request) (nodeUpdateRequest, bool) {
+	var payload nodeUpdateRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "Malformed JSON body")
+		return payload, false
+	}
+	if payload.Name == nil || *payload.Name == "" {
+		writeError(w, http.StatusBadRequest, "Field \"name\" is required")
+		return payload, false
+	}
+	if payload.Value == nil {
+		writeError(w, http.StatusBadRequest, "Field \"value\" is required")
+		return payload, false
+	}
+	return payload, true
+}
+
+// createNode handles HTTP requests to add a new node to the system. The node
+// joins through the membership protocol, so it is created joining unless it
+// has no keys to receive.
+func (s *Simulator) createNode(w http.ResponseWriter, r *http.Request) {
+	payload, ok := decodeNodePayload(w, r)
+	if !ok {
+		return
+	}
+	if payload.Version != nil {
+		writeError(w, http.StatusBadRequest, "Field \"version\" is only accepted by PUT")
+		return
+	}
+	if err := payload.NodeMetadata.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	node, moved := s.addNode(*payload.Name, *payload.Value, payload.NodeMetadata, true)
+	w.Header().Set("X-Keys-Moved", strconv.Itoa(moved))
+	writeJSON(w, http.StatusCreated, node)
+}
+
+// putNode handles HTTP requests to set the name and value of a node by its ID.
+// An If-Match header or a "version" field in the body makes the update
+// conditional: it fails with 409 if the node's version has moved on.
+func (s *Simulator) putNode(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseNodeID(w, r)
+	if !ok {
+		return
+	}
+
+	payload, ok := decodeNodePayload(w, r)
+	if !ok {
+		return
+	}
+	if payload.Region != "" || payload.Zone != "" || payload.Tags != nil {
+		writeError(w, http.StatusBadRequest, "Region, zone, and tags are changed with PATCH /nodes/{id}/metadata")
+		return
+	}
+	if !s.checkWritable(w, r, id, false) {
+		return
+	}
+	version := payload.Version
+	if header := r.Header.Get("If-Match"); header != "" && header != "*" {
+		v, err := parseNodeETag(header)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "If-Match must be a node version such as \"3\"")
+			return
+		}
+		if version != nil && *version != v {
+			writeError(w, http.StatusBadRequest, "If-Match and field \"version\" disagree")
+			return
+		}
+		version = &v
+	}
+
+	node, err := s.setNode(id, *payload.Name, *payload.Value, version)
+	switch {
+	case errors.Is(err, ErrNodeNotFound):
+		writeError(w, http.StatusNotFound, "Node not found")
+	case errors.Is(err, ErrVersionMismatch):
+		w.Header().Set("ETag", nodeETag(node))
+		writeError(w, http.StatusConflict, fmt.Sprintf("Node is at version %d, not %d", node.Version, *version))
+	default:
+		w.Header().Set("ETag", nodeETag(node))
+		writeJSON(w, http.StatusOK, node)
+	}
+}
+
+// deleteNode handles HTTP requests to remove a node from the system by its ID.
+// The node leaves through the membership protocol: a node with keys to hand
+// off is returned leaving with 202, and removed once they are. With
+// "force=true" it is removed at once.
+func (s *Simulator) deleteNode(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseNodeID(w, r)
+	if !ok {
+		return
+	}
+
+	if r.URL.Query().Get("force") == "true" {
+		moved, found := s.removeNode(id)
+		if !found {
+			writeError(w, http.StatusNotFound, "Node not found")
+			return
+		}
+		w.Header().Set("X-Keys-Moved", strconv.Itoa(moved))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	node, moved, removed, err := s.leaveNode(id)
+	switch {
+	case errors.Is(err, ErrNodeNotFound):
+		writeError(w, http.StatusNotFound, "Node not found")
+	case errors.Is(err, ErrMembershipChange):
+		writeError(w, http.StatusConflict, fmt.Sprintf("Node %d is already leaving", id))
+	case removed:
+		w.Header().Set("X-Keys-Moved", strconv.Itoa(moved))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeJSON(w, http.StatusAccepted, node)
+	}
+}
+
+// failNode handles HTTP requests to mark a node as down by its ID.
+func (s *Simulator) failNode(w http.ResponseWriter, r *http.Request) {
+	s.setNodeStatus(w, r, s.Fail)
+}
+
+// recoverNode handles HTTP requests to mark a node as up by its ID.
+func (s *Simulator) recoverNode(w http.ResponseWriter, r *http.Request) {
+	s.setNodeStatus(w, r, s.Recover)
+}
+
+// setNodeStatus applies transition to the node named in the request path and
+// writes the updated node.
+func (s *Simulator) setNodeStatus(w http.ResponseWriter, r *http.Request, transition func(int) (NodeData, bool)) {
+	id, ok := parseNodeID(w, r)
+	if !ok {
+		return
+	}
+
+	node, found := transition(id)
+	if !found {
+		writeError(w, http.StatusNotFound, "Node not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, node)
+}
+
+// latencyRequest is the JSON payload accepted by setNodeLatency.
+type latencyRequest struct {
+	Latency *Duration `json:"latency"`
+}
+
+// setNodeLatency handles HTTP requests to set a node's simulated latency
+// from a body like {"latency":"100ms"}.
+func (s *Simulator) setNodeLatency(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseNodeID(w, r)
+	if !ok {
+		return
+	}
+
+	var payload latencyRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "Malformed JSON body")
+		return
+	}
+	if payload.Latency == nil || *payload.Latency < 0 {
+		writeError(w, http.StatusBadRequest, "Field \"latency\" must be a non-negative duration")
+		return
+	}
+
+	node, found := s.SetLatency(id, time.Duration(*payload.Latency))
+	if !found {
+		writeError(w, http.StatusNotFound, "Node not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, node)
+}
+
+// skewRequest is the JSON payload accepted by setNodeSkew.
+type skewRequest struct {
+	Skew *Duration `json:"skew"`
+}
+
+// setNodeSkew handles HTTP requests to set how far a node's wall clock is
+// off from real time from a body like {"skew":"-2s"}.
+func (s *Simulator) setNodeSkew(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseNodeID(w, r)
+	if !ok {
+		return
+	}
+
+	var payload skewRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "Malformed JSON body")
+		return
+	}
+	if payload.Skew == nil {
+		writeError(w, http.StatusBadRequest, "Field \"skew\" must be a duration")
+		return
+	}
+
+	node, found := s.SetSkew(id, time.Duration(*payload.Skew))
+	if !found {
+		writeError(w, http.StatusNotFound, "Node not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, node)
+}
+
+// getNodeHistory handles HTTP requests to retrieve a node's recent values
+// with the optional query parameters "since" (an RFC 3339 time) and "limit".
+func (s *Simulator) getNodeHistory(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseNodeID(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	var since time.Time
+	if v := query.Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Query parameter \"since\" must be an RFC 3339 time")
+			return
+		}
+		since = t
+	}
+	limit := DefaultHistoryLimit
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxHistoryLimit {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Query parameter \"limit\" must be between 1 and %d", MaxHistoryLimit))
+			return
+		}
+		limit = n
+	}
+
+	history, found := s.History(id, since, limit)
+	if !found {
+		writeError(w, http.StatusNotFound, "Node not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, history)
+}
+
+// nodeClockResponse is the JSON body returned by getNodeClock.
+type nodeClockResponse struct {
+	ID          int         `json:"id"`
+	VectorClock VectorClock `json:"vector_clock"`
+}
+
+// getNodeClock handles HTTP requests to retrieve a node's vector clock.
+func (s *Simulator) getNodeClock(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseNodeID(w, r)
+	if !ok {
+		return
+	}
+
+	node, found := s.Node(id)
+	if !found {
+		writeError(w, http.StatusNotFound, "Node not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, nodeClockResponse{ID: node.ID, VectorClock: node.VectorClock})
+}
+
+// causalityResponse is the JSON body returned by getCausality.
+type causalityResponse struct {
+	A        int    `json:"a"`
+	B        int    `json:"b"`
+	Relation string `json:"relation"` // Of the vector clocks.
+
+	// HLC and Wall order node a's state before or after node b's, or as
+	// equal, by hybrid logical clock and by wall clock. HLC never orders a
+	// state before one it happens after, while skewed wall clocks can.
+	HLC  string `json:"hlc"`
+	Wall string `json:"wall"`
+}
+
+// Orders of two timestamps reported by getCausality.
+const (
+	orderBefore = "before"
+	orderAfter  = "after"
+	orderEqual  = "equal"
+)
+
+// order names the result of a comparison that is negative, positive, or 0.
+func order(c int) string {
+	switch {
+	case c < 0:
+		return orderBefore
+	case c > 0:
+		return orderAfter
+	}
+	return orderEqual
+}
+
+// getCausality handles HTTP requests to report whether node a's state
+// happens before, happens after, or is concurrent with node b's, according to
+// their vector clocks, and how their hybrid logical and wall clocks order
+// them.
+func (s *Simulator) getCausality(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	a, errA := strconv.Atoi(query.Get("a"))
+	b, errB := strconv.Atoi(query.Get("b"))
+	if errA != nil || errB != nil {
+		writeError(w, http.StatusBadRequest, "Query parameters \"a\" and \"b\" must be node IDs")
+		return
+	}
+
+	nodeA, foundA := s.Node(a)
+	nodeB, foundB := s.Node(b)
+	if !foundA || !foundB {
+		writeError(w, http.StatusNotFound, "Node not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, causalityResponse{
+		A:        a,
+		B:        b,
+		Relation: nodeA.VectorClock.Compare(nodeB.VectorClock),
+		HLC:      order(nodeA.HLC.Compare(nodeB.HLC)),
+		Wall:     order(nodeA.Time.Compare(nodeB.Time)),
+	})
+}
+
+// partitionLayout is the JSON body accepted by createPartitions and returned
+// by getPartitions. Requests give either groups of node IDs or groups of
+// regions, which stand for the nodes in them.
+type partitionLayout struct {
+	Groups  [][]int    `json:"groups"`
+	Regions [][]string `json:"regions,omitempty"`
+}
+
+// getPartitions handles HTTP requests to retrieve the partition layout. An
+// unpartitioned cluster reports no groups.
+func (s *Simulator) getPartitions(w http.ResponseWriter, r *http.Request) {
+	groups := s.Partition()
+	if groups == nil {
+		groups = [][]int{}
+	}
+	writeJSON(w, http.StatusOK, partitionLayout{Groups: groups})
+}
+
+// createPartitions handles HTTP requests to split the cluster into groups.
+func (s *Simulator) createPartitions(w http.ResponseWriter, r *http.Request) {
+	var layout partitionLayout
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&layout); err != nil {
+		writeError(w, http.StatusBadRequest, "Malformed JSON body")
+		return
+	}
+	var err error
+	switch {
+	case len(layout.Groups) > 0 && len(layout.Regions) > 0:
+		writeError(w, http.StatusBadRequest, "Fields \"groups\" and \"regions\" are mutually exclusive")
+		return
+	case len(layout.Regions) > 0:
+		err = s.PartitionRegions(layout.Regions)
+	case len(layout.Groups) > 0:
+		err = s.SetPartition(layout.Groups)
+	default:
+		writeError(w, http.StatusBadRequest, "Field \"groups\" or \"regions\" is required")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, partitionLayout{Groups: s.Partition()})
+}
+
+// deletePartitions handles HTTP requests to heal a partition.
+func (s *Simulator) deletePartitions(w http.ResponseWriter, r *http.Request) {
+	s.HealPartition()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// linkRequest is the JSON payload accepted by setLinkLoss.
+type linkRequest struct {
+	Loss *float64 `json:"loss"`
+}
+
+// setLinkLoss handles HTTP requests to set the loss rate of the link from
+// node a to node b.
+func (s *Simulator) setLinkLoss(w http.ResponseWriter, r *http.Request) {
+	a, errA := strconv.Atoi(r.PathValue("a"))
+	b, errB := strconv.Atoi(r.PathValue("b"))
+	if errA != nil || errB != nil {
+		writeError(w, http.StatusBadRequest, "Invalid node ID")
+		return
+	}
+
+	var payload linkRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "Malformed JSON body")
+		return
+	}
+	if payload.Loss == nil {
+		writeError(w, http.StatusBadRequest, "Field \"loss\" is required")
+		return
+	}
+
+	switch err := s.SetLinkLoss(a, b, *payload.Loss); {
+	case errors.Is(err, ErrNodeNotFound):
+		writeError(w, http.StatusNotFound, "Node not found")
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, s.Links())
+	}
+}
+
+// getLinks handles HTTP requests to retrieve the message loss matrix and
+// delivery counters.
+func (s *Simulator) getLinks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Links())
+}
+
+// kvWriteRequest is the JSON payload accepted by putKV.
+type kvWriteRequest struct {
+	Value  *string `json:"value"`
+	Leader *int    `json:"leader,omitempty"` // Node coordinating the write with its fencing token.
+	Token  uint64  `json:"token,omitempty"`  // Fencing token overriding the leader's.
+}
+
+// putKV handles HTTP requests to write a key to a write quorum of replicas,
+// through a leader if the body names one. It returns 503 if fewer than W
+// replicas are up and 409 if the write carries a stale fencing token.
+func (s *Simulator) putKV(w http.ResponseWriter, r *http.Request) {
+	var payload kvWriteRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "Malformed JSON body")
+		return
+	}
+	if payload.Value == nil {
+		writeError(w, http.StatusBadRequest, "Field \"value\" is required")
+		return
+	}
+
+	if payload.Token != 0 && payload.Leader == nil {
+		writeError(w, http.StatusBadRequest, "Field \"token\" requires \"leader\"")
+		return
+	}
+
+	ttl, err := durationParam(r.URL.Query(), "ttl", 0)
+	if err != nil || (r.URL.Query().Has("ttl") && ttl <= 0) {
+		writeError(w, http.StatusBadRequest, "Query parameter \"ttl\" must be a positive duration")
+		return
+	}
+
+	t := newTracer(r)
+	defer s.keepTrace(t)
+	var result KVResult
+	if payload.Leader != nil {
+		result, err = s.kvPutFenced(t, r.PathValue("key"), *payload.Value, *payload.Leader, payload.Token, ttl)
+	} else {
+		result, err = s.kvPutTTL(t, r.PathValue("key"), *payload.Value, ttl)
+	}
+	if err != nil {
+		writeKVError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// getKV handles HTTP requests to read a key from a read quorum of replicas,
+// from a single replica with a consistency query parameter, or by a vote of
+// replicas with consistency=majority.
+func (s *Simulator) getKV(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("consistency") == ConsistencyMajority {
+		s.getKVMajority(w, r)
+		return
+	}
+	if r.URL.Query().Has("consistency") {
+		s.getKVConsistent(w, r)
+		return
+	}
+	t := newTracer(r)
+	defer s.keepTrace(t)
+	result, err := s.kvGet(t, r.PathValue("key"))
+	if err != nil {
+		writeKVError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// getKVReplicas handles HTTP requests to show which replicas hold a key and
+// whether they are in sync.
+func (s *Simulator) getKVReplicas(w http.ResponseWriter, r *http.Request) {
+	replicas, err := s.KVReplicas(r.PathValue("key"))
+	if err != nil {
+		writeKVError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, replicas)
+}
+
+// getHints handles HTTP requests to list the hints held for down replicas.
+func (s *Simulator) getHints(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Hints())
+}
+
+// getAntiEntropyStats handles HTTP requests for the totals of anti-entropy
+// reconciliations.
+func (s *Simulator) getAntiEntropyStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.AntiEntropyStats())
+}
+
+// writeKVError maps a key-value store error to an HTTP error response.
+func writeKVError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrQuorumUnavailable):
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+	case errors.Is(err, ErrKeyNotFound), errors.Is(err, ErrNodeNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrNodeDown):
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+	case errors.Is(err, ErrStaleToken), errors.Is(err, ErrNoFencingToken), errors.Is(err, ErrNoMajority):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, ErrInvalidFaults):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// getRing handles HTTP requests to retrieve the token ranges each node owns
+// on the consistent-hash ring.
+func (s *Simulator) getRing(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Ring())
+}
+
+// ringLocateResponse is the JSON body returned by getRingLocate.
+type ringLocateResponse struct {
+	Key     string `json:"key"`
+	Nodes   []int  `json:"nodes"`
+	Primary *int   `json:"primary,omitempty"` // Omitted while the ring is empty.
+}
+
+// getRingLocate handles HTTP requests to find the nodes responsible for the
+// key given in the "key" query parameter.
+func (s *Simulator) getRingLocate(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		writeError(w, http.StatusBadRequest, "Query parameter \"key\" is required")
+		return
+	}
+
+	response := ringLocateResponse{Key: key, Nodes: s.Locate(key)}
+	if len(response.Nodes) > 0 {
+		response.Primary = &response.Nodes[0]
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// logAppendRequest is the JSON payload accepted by appendLog.
+type logAppendRequest struct {
+	Command *string `json:"command"`
+}
+
+// appendLog handles HTTP requests to append a command to the Raft log. It
+// returns 201 once the entry is committed, 503 if there is no leader or the
+// entry cannot reach a majority yet, and 409 outside raft mode.
+func (s *Simulator) appendLog(w http.ResponseWriter, r *http.Request) {
+	var payload logAppendRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "Malformed JSON body")
+		return
+	}
+	if payload.Command == nil {
+		writeError(w, http.StatusBadRequest, "Field \"command\" is required")
+		return
+	}
+
+	entry, err := s.AppendLog(*payload.Command)
+	switch {
+	case errors.Is(err, ErrNotRaftMode):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, ErrNoLeader), errors.Is(err, ErrQuorumUnavailable):
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		writeJSON(w, http.StatusCreated, entry)
+	}
+}
+
+// getLog handles HTTP requests to retrieve the committed Raft log.
+func (s *Simulator) getLog(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.CommittedLog())
+}
+
+// getNodeLog handles HTTP requests to retrieve a node's local Raft log.
+func (s *Simulator) getNodeLog(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseNodeID(w, r)
+	if !ok {
+		return
+	}
+
+	nodeLog, found := s.NodeLog(id)
+	if !found {
+		writeError(w, http.StatusNotFound, "Node not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, nodeLog)
+}
+
+// transactionRequest is the JSON payload accepted by createTransaction.
+type transactionRequest struct {
+	Writes []TxWrite `json:"writes"`
+}
+
+// createTransaction handles HTTP requests to run a two-phase commit over a
+// set of node writes. It returns 201 with the transaction record whether the
+// transaction committed or aborted, and 400 for invalid writes.
+func (s *Simulator) createTransaction(w http.ResponseWriter, r *http.Request) {
+	var payload transactionRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "Malformed JSON body")
+		return
+	}
+
+	t := newTracer(r)
+	defer s.keepTrace(t)
+	tx, err := s.runTransaction(t, payload.Writes)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, tx)
+}
+
+// getTransaction handles HTTP requests to retrieve a transaction record.
+func (s *Simulator) getTransaction(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid transaction ID")
+		return
+	}
+
+	tx, found := s.Transaction(id)
+	if !found {
+		writeError(w, http.StatusNotFound, "Transaction not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, tx)
+}
+
+// getEventHistory handles HTTP requests to page through the event log with
+// the optional query parameters "since" (a sequence number) and "limit".
+func (s *Simulator) getEventHistory(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var since uint64
+	if v := query.Get("since"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Query parameter \"since\" must be a sequence number")
+			return
+		}
+		since = n
+	}
+	limit := DefaultHistoryLimit
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxHistoryLimit {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Query parameter \"limit\" must be between 1 and %d", MaxHistoryLimit))
+			return
+		}
+		limit = n
+	}
+
+	writeJSON(w, http.StatusOK, s.EventHistory(since, limit))
+}
+
+// replayEvents handles HTTP requests to rebuild the nodes by replaying the
+// event log.
+func (s *Simulator) replayEvents(w http.ResponseWriter, r *http.Request) {
+	result, err := s.Replay()
+	if err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// saveSnapshot handles HTTP requests to save the nodes to a snapshot file.
+func (s *Simulator) saveSnapshot(w http.ResponseWriter, r *http.Request) {
+	info, err := s.SaveSnapshot()
+	if err != nil {
+		writeSnapshotError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, info)
+}
+
+// restoreSnapshot handles HTTP requests to restore the nodes from the
+// snapshot file named by the "file" query parameter, or from the newest
+// snapshot if it is omitted.
+func (s *Simulator) restoreSnapshot(w http.ResponseWriter, r *http.Request) {
+	var info SnapshotInfo
+	var err error
+	if file := r.URL.Query().Get("file"); file != "" {
+		info, err = s.RestoreSnapshot(file)
+	} else {
+		info, err = s.RestoreLatest()
+	}
+	if err != nil {
+		writeSnapshotError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// writeSnapshotError maps a snapshot error to an HTTP error response.
+func writeSnapshotError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNoDataDir):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, ErrNoSnapshot):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrInvalidSnapshot):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// getDetector handles HTTP requests to retrieve each node's last heartbeat
+// and suspicion level.
+func (s *Simulator) getDetector(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Detector())
+}
+
+// pauseHeartbeats handles HTTP requests to drop a node's heartbeats.
+func (s *Simulator) pauseHeartbeats(w http.ResponseWriter, r *http.Request) {
+	s.setHeartbeats(w, r, s.PauseHeartbeats)
+}
+
+// resumeHeartbeats handles HTTP requests to restore a node's heartbeats.
+func (s *Simulator) resumeHeartbeats(w http.ResponseWriter, r *http.Request) {
+	s.setHeartbeats(w, r, s.ResumeHeartbeats)
+}
+
+// setHeartbeats applies change to the node named in the request path and
+// writes 204 on success.
+func (s *Simulator) setHeartbeats(w http.ResponseWriter, r *http.Request, change func(int) bool) {
+	id, ok := parseNodeID(w, r)
+	if !ok {
+		return
+	}
+	if !change(id) {
+		writeError(w, http.StatusNotFound, "Node not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getLeader handles HTTP requests to retrieve the current leader. It returns
+// 503 when no node is up to lead.
+func (s *Simulator) getLeader(w http.ResponseWriter, r *http.Request) {
+	leader, ok := s.Leader()
+	if !ok {
+		writeError(w, http.StatusServiceUnavailable, "No leader: every node is down or suspected")
+		return
+	}
+	writeJSON(w, http.StatusOK, leader)
+}
+
+// getConvergence handles HTTP requests to report how many nodes agree on the
+// latest value.
+func (s *Simulator) getConvergence(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Convergence())
+}
+
+// getChaosStats handles HTTP requests to retrieve failure statistics.
+func (s *Simulator) getChaosStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.ChaosStats())
+}
+
+// rootHandler provides a welcome message at the root endpoint.
+func (s *Simulator) rootHandler(w http.ResponseWriter, r *http.Request) {
+	message := map[string]string{
+		"message": "Welcome to the Distributed System Simulator! Visit /nodes to get node data.",
+	}
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		slog.Error("failed to marshal response", "err", err)
+		writeError(w, http.StatusInternalServerError, "Failed to marshal message")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(data)
+	if err != nil {
+		slog.Error("failed to write response", "err", err)
+	}
+}
+
+// healthHandler reports that the process is alive. It always succeeds.
+func (s *Simulator) healthHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// readyHandler reports whether the simulator is ready to serve traffic. It
+// returns 503 until the nodes are initialized and the updater has started,
+// and again once the simulator is draining for shutdown.
+func (s *Simulator) readyHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.Ready() {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "unavailable"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// parseNodeID parses the {id} path value of r. It writes a 400 response and
+// returns false if the ID is not numeric.
+func parseNodeID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid node ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// writeJSON marshals v and writes it to w with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		slog.Error("failed to marshal response", "err", err)
+		writeError(w, http.StatusInternalServerError, "Failed to marshal data")
+		return
+	}
+	writeJSONData(w, status, data)
+}
+
+// writeJSONData writes data, which is already marshaled JSON, with the given
+// status code.
+func writeJSONData(w http.ResponseWriter, status int, data []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if _, err := w.Write(data); err != nil {
+		slog.Error("failed to write response", "err", err)
+	}
+}
@@ -0,0 +1,777 @@
+package simulator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestGetNodeData tests the behavior of the getNodeData handler.
+func TestGetNodeData(t *testing.T) {
+	// Initialize test data.
+	s := New(Config{})
+	s.Init(testNodeCount)
+
+	// Create a test HTTP request.
+	req, err := http.NewRequest("GET", "/nodes", nil)
+	if err != nil {
+		t.Fatalf("Failed to create test request: %v", err)
+	}
+
+	// Create a ResponseRecorder to capture the response.
+	rr := httptest.NewRecorder()
+
+	// Call the handler function.
+	s.Handler().ServeHTTP(rr, req)
+
+	// Check the response status code.
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Expected status code %d, but got %d", http.StatusOK, status)
+	}
+
+	// Check the response body.
+	var respNodes []NodeData
+	err = json.Unmarshal(rr.Body.Bytes(), &respNodes)
+	if err != nil {
+		t.Errorf("Failed to unmarshal response body: %v", err)
+	}
+
+	// Check if the response nodes match the expected nodes. The expected
+	// nodes are round-tripped through JSON so monotonic clock readings and
+	// time zone pointers don't cause spurious mismatches.
+	var expectedNodes []NodeData
+	jsonRoundTrip(t, s.nodes, &expectedNodes)
+	if !reflect.DeepEqual(respNodes, expectedNodes) {
+		t.Errorf("Response nodes do not match expected nodes")
+	}
+}
+
+// TestGetNodeDataConsistent tests that GET /nodes returns the nodes at the
+// single version its ETag names while updates run, and reuses its copy of
+// the nodes until they change.
+func TestGetNodeDataConsistent(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	// Each update advances one node's Version and vector clock entry and the
+	// cluster version by one, so a response taken between updates has every
+	// node's Version ahead of its entry by the same amount, and its nodes'
+	// Versions sum to the version in its ETag plus a fixed offset.
+	get := func() (nodes []NodeData, version uint64) {
+		t.Helper()
+		rr := doRequest(t, h, "GET", "/nodes", "")
+		expectCode(t, rr, http.StatusOK)
+		decodeBody(t, rr, &nodes)
+		etag := strings.Trim(rr.Header().Get("ETag"), `"`)
+		if _, err := fmt.Sscanf(etag[strings.Index(etag, "-")+1:], "%x", &version); err != nil {
+			t.Fatalf("Malformed ETag %q: %v", etag, err)
+		}
+		return nodes, version
+	}
+	sum := func(nodes []NodeData) (total uint64) {
+		for _, node := range nodes {
+			total += node.Version
+		}
+		return total
+	}
+	initial, initialVersion := get()
+	offset := sum(initial) - initialVersion
+
+	stop := make(chan struct{})
+	var updaters sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		updaters.Add(1)
+		go func() {
+			defer updaters.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					s.Update()
+				}
+			}
+		}()
+	}
+	for i := 0; i < 50; i++ {
+		nodes, version := get()
+		if got := sum(nodes) - version; got != offset {
+			t.Fatalf("Expected the nodes to match their ETag's version %d, off by %d", version, int64(got-offset))
+		}
+		for j, node := range nodes {
+			if want := initial[j].Version - initial[j].VectorClock[node.ID]; node.Version-node.VectorClock[node.ID] != want {
+				t.Fatalf("Node %d was half-updated: %+v", node.ID, node)
+			}
+		}
+	}
+	close(stop)
+	updaters.Wait()
+
+	s.mu.RLock()
+	first, second := s.sharedNodes(), s.sharedNodes()
+	s.mu.RUnlock()
+	if first != second {
+		t.Errorf("Expected unchanged nodes to be copied once")
+	}
+	s.Update()
+	s.mu.RLock()
+	third := s.sharedNodes()
+	s.mu.RUnlock()
+	if third == first {
+		t.Errorf("Expected a new copy once the nodes changed")
+	}
+}
+
+// TestGetNodeDataCache tests that the JSON node list is marshaled once
+// between changes, and that any change, not only updates, invalidates it.
+func TestGetNodeDataCache(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	first := doRequest(t, h, "GET", "/nodes", "")
+	cached := s.nodesCache.Load()
+	if cached == nil || cached.json == nil {
+		t.Fatalf("Expected the node list to be cached")
+	}
+	if second := doRequest(t, h, "GET", "/nodes", ""); second.Body.String() != first.Body.String() || s.nodesCache.Load() != cached {
+		t.Errorf("Expected an unchanged node list to be served from the cache")
+	}
+
+	for _, change := range []struct {
+		method, path, body string
+	}{
+		{"PUT", "/nodes/1", `{"name":"renamed","value":77}`},
+		{"POST", "/nodes/2/fail", ""},
+		{"DELETE", "/nodes/3", ""},
+	} {
+		before := doRequest(t, h, "GET", "/nodes", "").Body.String()
+		if rr := doRequest(t, h, change.method, change.path, change.body); rr.Code >= 300 {
+			t.Fatalf("%s %s failed with %d", change.method, change.path, rr.Code)
+		}
+		rr := doRequest(t, h, "GET", "/nodes", "")
+		if rr.Body.String() == before {
+			t.Errorf("Expected %s %s to invalidate the cached node list", change.method, change.path)
+		}
+		var nodes, want []NodeData
+		decodeBody(t, rr, &nodes)
+		jsonRoundTrip(t, s.Snapshot(), &want)
+		if !reflect.DeepEqual(nodes, want) {
+			t.Errorf("After %s %s: expected the current nodes\ngot  %+v\nwant %+v", change.method, change.path, nodes, want)
+		}
+	}
+}
+
+// BenchmarkGetNodeData measures listing 1000 unchanged nodes as JSON,
+// marshaling them on every request as before they were cached, and served
+// from the cache.
+func BenchmarkGetNodeData(b *testing.B) {
+	s := New(Config{Seed: 1})
+	s.Init(1000)
+	req := httptest.NewRequest("GET", "/nodes", nil)
+
+	b.Run("marshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			s.mu.RLock()
+			nodes := s.sharedNodes().nodes
+			s.mu.RUnlock()
+			writeNodes(httptest.NewRecorder(), mediaJSON, nodes, nil)
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			s.getNodeData(httptest.NewRecorder(), req)
+		}
+	})
+}
+
+// BenchmarkUpdateDuringNodeList measures Update while four clients list
+// 1000 nodes as JSON at once. The encode-under-lock case holds the node
+// locks while encoding, as GET /nodes did before it encoded a copy.
+func BenchmarkUpdateDuringNodeList(b *testing.B) {
+	for _, underLock := range []bool{true, false} {
+		name := "copy"
+		if underLock {
+			name = "encode-under-lock"
+		}
+		b.Run(name, func(b *testing.B) {
+			s := New(Config{Seed: 1, Logger: slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError}))})
+			s.Init(1000)
+			list := s.getNodeData
+			if underLock {
+				list = func(w http.ResponseWriter, r *http.Request) {
+					s.mu.RLock()
+					defer s.mu.RUnlock()
+					s.rlockNodes()
+					defer s.runlockNodes()
+					writeNodes(w, mediaJSON, s.nodes, nil)
+				}
+			}
+
+			stop := make(chan struct{})
+			var readers sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				readers.Add(1)
+				go func() {
+					defer readers.Done()
+					for {
+						select {
+						case <-stop:
+							return
+						default:
+							list(httptest.NewRecorder(), httptest.NewRequest("GET", "/nodes", nil))
+						}
+					}
+				}()
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				s.Update()
+			}
+			b.StopTimer()
+			close(stop)
+			readers.Wait()
+		})
+	}
+}
+
+// TestGetSingleNode tests the behavior of the getSingleNode handler.
+func TestGetSingleNode(t *testing.T) {
+	// Initialize test data.
+	s := New(Config{})
+	s.Init(testNodeCount)
+
+	mux := s.Handler()
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+	}{
+		{"found", "/nodes/2", http.StatusOK},
+		{"not found", "/nodes/99", http.StatusNotFound},
+		{"malformed ID", "/nodes/abc", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", tt.path, nil)
+			if err != nil {
+				t.Fatalf("Failed to create test request: %v", err)
+			}
+
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Fatalf("Expected status code %d, but got %d", tt.wantStatus, status)
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Expected JSON content type, but got %q", ct)
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				var respError ErrorResponse
+				if err := json.Unmarshal(rr.Body.Bytes(), &respError); err != nil {
+					t.Fatalf("Failed to unmarshal error body: %v", err)
+				}
+				if respError.Error.Message == "" {
+					t.Errorf("Expected an error message in the response body")
+				}
+				return
+			}
+
+			var respNode NodeData
+			if err := json.Unmarshal(rr.Body.Bytes(), &respNode); err != nil {
+				t.Fatalf("Failed to unmarshal response body: %v", err)
+			}
+
+			var expectedNode NodeData
+			jsonRoundTrip(t, s.nodes[2], &expectedNode)
+			if !reflect.DeepEqual(respNode, expectedNode) {
+				t.Errorf("Response node does not match expected node")
+			}
+		})
+	}
+}
+
+// TestPutNode tests the behavior of the putNode handler.
+func TestPutNode(t *testing.T) {
+	// Initialize test data.
+	s := New(Config{})
+	s.Init(testNodeCount)
+
+	mux := s.Handler()
+
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"updated", "/nodes/1", `{"name":"Primary","value":42}`, http.StatusOK},
+		{"not found", "/nodes/99", `{"name":"Primary","value":42}`, http.StatusNotFound},
+		{"malformed ID", "/nodes/abc", `{"name":"Primary","value":42}`, http.StatusBadRequest},
+		{"malformed JSON", "/nodes/1", `{"name":`, http.StatusBadRequest},
+		{"unknown field", "/nodes/1", `{"name":"Primary","value":42,"id":7}`, http.StatusBadRequest},
+		{"missing name", "/nodes/1", `{"value":42}`, http.StatusBadRequest},
+		{"missing value", "/nodes/1", `{"name":"Primary"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := s.nodes[1]
+
+			req, err := http.NewRequest("PUT", tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("Failed to create test request: %v", err)
+			}
+
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, req)
+
+			if status := rr.Code; status != tt.wantStatus {
+				t.Fatalf("Expected status code %d, but got %d", tt.wantStatus, status)
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				if !reflect.DeepEqual(s.nodes[1], before) {
+					t.Errorf("Node was modified by a rejected request")
+				}
+				return
+			}
+
+			var respNode NodeData
+			if err := json.Unmarshal(rr.Body.Bytes(), &respNode); err != nil {
+				t.Fatalf("Failed to unmarshal response body: %v", err)
+			}
+			if respNode.ID != 1 || respNode.Name != "Primary" || respNode.Value != 42 {
+				t.Errorf("Unexpected response node: %+v", respNode)
+			}
+			if !s.nodes[1].Time.After(before.Time) {
+				t.Errorf("Expected node time to be refreshed")
+			}
+			if s.nodes[1].Name != "Primary" || s.nodes[1].Value != 42 {
+				t.Errorf("Stored node was not updated: %+v", s.nodes[1])
+			}
+		})
+	}
+}
+
+// TestCreateNode tests the behavior of the createNode handler.
+func TestCreateNode(t *testing.T) {
+	// Initialize test data.
+	s := New(Config{})
+	s.Init(testNodeCount)
+
+	mux := s.Handler()
+
+	// Add a new node.
+	req, err := http.NewRequest("POST", "/nodes", strings.NewReader(`{"name":"Node-new","value":7}`))
+	if err != nil {
+		t.Fatalf("Failed to create test request: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusCreated {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusCreated, status)
+	}
+
+	var created NodeData
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+	if created.ID != testNodeCount {
+		t.Errorf("Expected server-assigned ID %d, but got %d", testNodeCount, created.ID)
+	}
+	if created.Name != "Node-new" || created.Value != 7 || created.Time.IsZero() {
+		t.Errorf("Unexpected created node: %+v", created)
+	}
+
+	// Verify the node appears in GET /nodes.
+	req, err = http.NewRequest("GET", "/nodes", nil)
+	if err != nil {
+		t.Fatalf("Failed to create test request: %v", err)
+	}
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	var respNodes []NodeData
+	if err := json.Unmarshal(rr.Body.Bytes(), &respNodes); err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+	if len(respNodes) != testNodeCount+1 {
+		t.Fatalf("Expected %d nodes, but got %d", testNodeCount+1, len(respNodes))
+	}
+	if !reflect.DeepEqual(respNodes[testNodeCount], created) {
+		t.Errorf("Created node does not match listed node")
+	}
+
+	// A malformed payload must not create a node.
+	req, err = http.NewRequest("POST", "/nodes", strings.NewReader(`{"value":7}`))
+	if err != nil {
+		t.Fatalf("Failed to create test request: %v", err)
+	}
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, but got %d", http.StatusBadRequest, status)
+	}
+	if len(s.nodes) != testNodeCount+1 {
+		t.Errorf("Expected %d nodes after rejected request, but got %d", testNodeCount+1, len(s.nodes))
+	}
+}
+
+// TestDeleteNode tests the behavior of the deleteNode handler.
+func TestDeleteNode(t *testing.T) {
+	// Initialize test data.
+	s := New(Config{})
+	s.Init(testNodeCount)
+
+	mux := s.Handler()
+
+	tests := []struct {
+		name       string
+		path       string
+		wantStatus int
+	}{
+		{"deleted", "/nodes/3", http.StatusNoContent},
+		{"already deleted", "/nodes/3", http.StatusNotFound},
+		{"not found", "/nodes/99", http.StatusNotFound},
+		{"malformed ID", "/nodes/abc", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("DELETE", tt.path, nil)
+		if err != nil {
+			t.Fatalf("Failed to create test request: %v", err)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+
+		if status := rr.Code; status != tt.wantStatus {
+			t.Errorf("%s: expected status code %d, but got %d", tt.name, tt.wantStatus, status)
+		}
+	}
+
+	// Verify GET /nodes no longer returns the deleted node.
+	req, err := http.NewRequest("GET", "/nodes", nil)
+	if err != nil {
+		t.Fatalf("Failed to create test request: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	var respNodes []NodeData
+	if err := json.Unmarshal(rr.Body.Bytes(), &respNodes); err != nil {
+		t.Fatalf("Failed to unmarshal response body: %v", err)
+	}
+	if len(respNodes) != testNodeCount-1 {
+		t.Fatalf("Expected %d nodes, but got %d", testNodeCount-1, len(respNodes))
+	}
+	for _, node := range respNodes {
+		if node.ID == 3 {
+			t.Errorf("Deleted node is still listed")
+		}
+	}
+
+	// The updater must keep working on the shrunken slice, and must not
+	// panic once every node is gone.
+	for i := 0; i < 100; i++ {
+		s.Update()
+	}
+	for _, node := range respNodes {
+		req, err := http.NewRequest("DELETE", fmt.Sprintf("/nodes/%d", node.ID), nil)
+		if err != nil {
+			t.Fatalf("Failed to create test request: %v", err)
+		}
+		mux.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if len(s.nodes) != 0 {
+		t.Fatalf("Expected all nodes to be deleted, but %d remain", len(s.nodes))
+	}
+	s.Update()
+}
+
+// TestRootHandler tests the behavior of the rootHandler handler.
+func TestRootHandler(t *testing.T) {
+	s := New(Config{})
+
+	// Create a test HTTP request.
+	req, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatalf("Failed to create test request: %v", err)
+	}
+
+	// Create a ResponseRecorder to capture the response.
+	rr := httptest.NewRecorder()
+
+	// Call the handler function.
+	s.Handler().ServeHTTP(rr, req)
+
+	// Check the response status code.
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Expected status code %d, but got %d", http.StatusOK, status)
+	}
+
+	// Check the response body.
+	var respMessage map[string]string
+	err = json.Unmarshal(rr.Body.Bytes(), &respMessage)
+	if err != nil {
+		t.Errorf("Failed to unmarshal response body: %v", err)
+	}
+
+	expectedMessage := map[string]string{
+		"message": "Welcome to the Distributed System Simulator! Visit /nodes to get node data.",
+	}
+
+	// Check if the response message matches the expected message.
+	if !reflect.DeepEqual(respMessage, expectedMessage) {
+		t.Errorf("Response message does not match expected message")
+	}
+}
+
+// doRequest issues a request with the given method, path, and body against h
+// and returns the recorded response.
+func doRequest(t *testing.T, h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req, err := http.NewRequest(method, path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to create test request: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+// decodeBody unmarshals the JSON body of rr into out.
+func decodeBody(t *testing.T, rr *httptest.ResponseRecorder, out interface{}) {
+	t.Helper()
+
+	if err := json.Unmarshal(rr.Body.Bytes(), out); err != nil {
+		t.Fatalf("Failed to unmarshal response body %q: %v", rr.Body.String(), err)
+	}
+}
+
+// TestFailRecoverNode tests the status transitions made by the failNode and
+// recoverNode handlers and the 503 returned for down nodes.
+func TestFailRecoverNode(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	// Fail node 2.
+	rr := doRequest(t, h, "POST", "/nodes/2/fail", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, rr.Code)
+	}
+	var node NodeData
+	decodeBody(t, rr, &node)
+	if node.ID != 2 || node.Status != StatusDown {
+		t.Errorf("Expected node 2 to be down, got %+v", node)
+	}
+
+	// A down node is unreachable individually...
+	rr = doRequest(t, h, "GET", "/nodes/2", "")
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d for a down node, but got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+
+	// ...but still listed with its status.
+	var listed []NodeData
+	decodeBody(t, doRequest(t, h, "GET", "/nodes", ""), &listed)
+	for _, n := range listed {
+		want := StatusUp
+		if n.ID == 2 {
+			want = StatusDown
+		}
+		if n.Status != want {
+			t.Errorf("Expected node %d to be %q, but got %q", n.ID, want, n.Status)
+		}
+	}
+
+	// Recover node 2.
+	rr = doRequest(t, h, "POST", "/nodes/2/recover", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, rr.Code)
+	}
+	decodeBody(t, rr, &node)
+	if node.Status != StatusUp {
+		t.Errorf("Expected node 2 to be up, got %+v", node)
+	}
+	if rr := doRequest(t, h, "GET", "/nodes/2", ""); rr.Code != http.StatusOK {
+		t.Errorf("Expected status code %d for a recovered node, but got %d", http.StatusOK, rr.Code)
+	}
+
+	// Unknown and malformed IDs.
+	if rr := doRequest(t, h, "POST", "/nodes/99/fail", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, but got %d", http.StatusNotFound, rr.Code)
+	}
+	if rr := doRequest(t, h, "POST", "/nodes/abc/recover", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, but got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+// checkStatus issues a GET request for path against h and asserts the
+// response status code and JSON "status" field.
+func checkStatus(t *testing.T, h http.Handler, path string, wantCode int, wantStatus string) {
+	t.Helper()
+
+	req, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		t.Fatalf("Failed to create test request: %v", err)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+
+	if rr.Code != wantCode {
+		t.Errorf("GET %s: expected status code %d, but got %d", path, wantCode, rr.Code)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("GET %s: failed to unmarshal response body: %v", path, err)
+	}
+	if body["status"] != wantStatus {
+		t.Errorf("GET %s: expected status %q, but got %q", path, wantStatus, body["status"])
+	}
+}
+
+// TestHealthHandler tests that /healthz always reports ok.
+func TestHealthHandler(t *testing.T) {
+	s := New(Config{})
+	checkStatus(t, s.Handler(), "/healthz", http.StatusOK, "ok")
+
+	s.Init(testNodeCount)
+	s.Drain()
+	checkStatus(t, s.Handler(), "/healthz", http.StatusOK, "ok")
+}
+
+// TestReadyHandler tests the readiness transitions reported by /readyz.
+func TestReadyHandler(t *testing.T) {
+	s := New(Config{})
+	h := s.Handler()
+
+	// Not ready before Init.
+	checkStatus(t, h, "/readyz", http.StatusServiceUnavailable, "unavailable")
+
+	// Not ready until the updater has started.
+	s.Init(testNodeCount)
+	checkStatus(t, h, "/readyz", http.StatusServiceUnavailable, "unavailable")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.StartUpdater(ctx, time.Hour)
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for !s.Ready() {
+		if time.Now().After(deadline) {
+			t.Fatal("Simulator did not become ready")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	checkStatus(t, h, "/readyz", http.StatusOK, "ok")
+
+	// Not ready once draining for shutdown.
+	s.Drain()
+	checkStatus(t, h, "/readyz", http.StatusServiceUnavailable, "unavailable")
+
+	cancel()
+	<-done
+}
+
+// jsonRoundTrip marshals v and unmarshals the result into out.
+func jsonRoundTrip(t *testing.T, v interface{}, out interface{}) {
+	t.Helper()
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Failed to marshal value: %v", err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		t.Fatalf("Failed to unmarshal value: %v", err)
+	}
+}
+
+// TestRouterMethodNotAllowed tests that NewRouter rejects requests with the
+// wrong method for a known path, listing the allowed methods.
+func TestRouterMethodNotAllowed(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	h := NewRouter(s)
+
+	tests := []struct {
+		method, path string
+		wantAllow    string
+	}{
+		{"DELETE", "/nodes", "GET, HEAD, POST"},
+		{"POST", "/nodes/1", "DELETE, GET, HEAD, PUT"},
+		{"GET", "/nodes/1/fail", "POST"},
+		{"POST", "/healthz", "GET, HEAD"},
+		{"POST", "/kv/a", "DELETE, GET, HEAD, PUT"},
+		{"POST", "/", "GET, HEAD"},
+	}
+	for _, tt := range tests {
+		rr := doRequest(t, h, tt.method, tt.path, "")
+		if rr.Code != http.StatusMethodNotAllowed {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.path, http.StatusMethodNotAllowed, rr.Code)
+		}
+		if got := rr.Header().Get("Allow"); got != tt.wantAllow {
+			t.Errorf("%s %s: expected Allow %q, got %q", tt.method, tt.path, tt.wantAllow, got)
+		}
+	}
+
+	// A rejected request must not reach any handler.
+	s.mu.RLock()
+	count := len(s.nodes)
+	s.mu.RUnlock()
+	doRequest(t, h, "PATCH", "/nodes", `{"name":"x","value":1}`)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.nodes) != count {
+		t.Errorf("Expected %d nodes after a rejected request, got %d", count, len(s.nodes))
+	}
+}
+
+// TestRouterPathParameters tests that NewRouter routes requests by their
+// path parameters and 404s unknown paths.
+func TestRouterPathParameters(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	h := NewRouter(s)
+
+	for id := 0; id < testNodeCount; id++ {
+		var node NodeData
+		decodeBody(t, doRequest(t, h, "GET", fmt.Sprintf("/nodes/%d", id), ""), &node)
+		if node.ID != id {
+			t.Errorf("GET /nodes/%d: expected node %d, got %d", id, id, node.ID)
+		}
+	}
+
+	var history ValueHistory
+	decodeBody(t, doRequest(t, h, "GET", "/nodes/3/history", ""), &history)
+	if history.NodeID != 3 {
+		t.Errorf("Expected the history of node 3, got node %d", history.NodeID)
+	}
+
+	expectCode(t, doRequest(t, h, "GET", "/nodes/abc", ""), http.StatusBadRequest)
+	expectCode(t, doRequest(t, h, "GET", "/nodes/99", ""), http.StatusNotFound)
+	expectCode(t, doRequest(t, h, "GET", "/nodes/1/unknown", ""), http.StatusNotFound)
+	expectCode(t, doRequest(t, h, "GET", "/no-such-endpoint", ""), http.StatusNotFound)
+}
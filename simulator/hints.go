@@ -0,0 +1,163 @@
+package simulator
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+)
+
+// DefaultHintTTL is how long a hint is kept for a down replica when
+// Config.HintTTL is unset.
+const DefaultHintTTL = 10 * time.Minute
+
+// Hint is a key-value write held by a live node on behalf of a replica that
+// was down when the write was made.
+type Hint struct {
+	Key     string    `json:"key"`
+	Target  int       `json:"target"` // ID of the replica the write is for.
+	Entry   KVEntry   `json:"entry"`
+	Expires time.Time `json:"expires"`
+}
+
+// HintInfo lists the pending hints and the totals of hints handed off.
+type HintInfo struct {
+	Nodes     []NodeHints `json:"nodes"` // Nodes holding hints, by ID.
+	Pending   int         `json:"pending"`
+	Delivered uint64      `json:"delivered"`
+	Expired   uint64      `json:"expired"`
+}
+
+// NodeHints lists the hints one node holds, oldest first.
+type NodeHints struct {
+	ID    int    `json:"id"`
+	Hints []Hint `json:"hints"`
+}
+
+// hintHolder returns the ID of the node that should hold hints for key: the
+// first up node after the key's N replicas on the ring, or the first write
+// target if every node is a replica or down. The caller must hold s.mu.
+func (s *Simulator) hintHolder(key string, targets []int) int {
+	for _, id := range s.preferenceList(key, len(s.nodes))[len(s.preferenceList(key, s.cfg.N)):] {
+		if s.nodes[s.findNode(id)].Status == StatusUp {
+			return id
+		}
+	}
+	return targets[0]
+}
+
+// addHints records a hint for each of key's replicas that is down, so that
+// entry reaches them once they recover. The caller must hold s.mu for
+// writing.
+func (s *Simulator) addHints(key string, entry KVEntry, targets []int) {
+	var holder int
+	held := false
+	for _, id := range s.preferenceList(key, s.cfg.N) {
+		if s.nodes[s.findNode(id)].Status != StatusDown {
+			continue
+		}
+		if !held {
+			holder, held = s.hintHolder(key, targets), true
+		}
+		s.hints[holder] = append(s.hints[holder], Hint{
+			Key:     key,
+			Target:  id,
+			Entry:   entry,
+			Expires: entry.Time.Add(s.cfg.HintTTL),
+		})
+		s.logger.Debug("hint stored", "key", key, "target", id, "holder", holder)
+	}
+}
+
+// DeliverHints hands every pending hint whose holder and target are up and
+// can reach each other to its target, unless the bandwidth limit drops it
+// or every attempt under the hint retry policy is lost. The hint reaches its
+// target after the backoff and the latency of the link, and a target that by
+// then holds a newer version keeps it. Hints past Config.HintTTL are dropped
+// undelivered, as are hints for a target that a ring change has made no
+// longer responsible for the key. It returns the number of hints delivered.
+func (s *Simulator) DeliverHints() int {
+	return s.deliverHints(context.Background())
+}
+
+// deliverHints is DeliverHints, retrying lost hints until ctx is done.
+func (s *Simulator) deliverHints(ctx context.Context) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now, sent := time.Now(), s.cfg.Clock.Now()
+	delivered := 0
+	for holder, hints := range s.hints {
+		holderUp := s.nodes[s.findNode(holder)].Status == StatusUp
+		pending := hints[:0]
+		for _, hint := range hints {
+			switch {
+			case !now.Before(hint.Expires):
+				s.hintsExpired++
+				s.logger.Warn("hint expired", "key", hint.Key, "target", hint.Target, "holder", holder)
+				continue
+			case !slices.Contains(s.preferenceList(hint.Key, s.cfg.N), hint.Target):
+				continue
+			case !holderUp || s.nodes[s.findNode(hint.Target)].Status != StatusUp || !s.reachable(holder, hint.Target):
+				pending = append(pending, hint)
+				continue
+			}
+			backoff, ok := s.retryOp(ctx, RetryHint, func() error {
+				if !s.deliver(holder, hint.Target) {
+					return errMessageLost
+				}
+				return nil
+			})
+			if !ok || !s.send(sent.Add(backoff), holder, hint.Target, MessageHint, "kv/"+hint.Key, replicaPayload{Key: hint.Key, Entry: hint.Entry}, func(time.Time) {
+				s.receiveReplica(hint.Target, hint.Key, hint.Entry)
+			}) {
+				pending = append(pending, hint)
+				continue
+			}
+			s.hintsDelivered++
+			delivered++
+		}
+		if len(pending) == 0 {
+			delete(s.hints, holder)
+		} else {
+			s.hints[holder] = pending
+		}
+	}
+	if delivered > 0 {
+		s.logger.Debug("hints delivered", "count", delivered)
+	}
+	return delivered
+}
+
+// forgetHints drops the hints held by or meant for the node with the given
+// ID. The caller must hold s.mu for writing.
+func (s *Simulator) forgetHints(id int) {
+	delete(s.hints, id)
+	for holder, hints := range s.hints {
+		kept := hints[:0]
+		for _, hint := range hints {
+			if hint.Target != id {
+				kept = append(kept, hint)
+			}
+		}
+		if len(kept) == 0 {
+			delete(s.hints, holder)
+		} else {
+			s.hints[holder] = kept
+		}
+	}
+}
+
+// Hints returns the pending hints by holder and the handoff totals.
+func (s *Simulator) Hints() HintInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	info := HintInfo{Nodes: []NodeHints{}, Delivered: s.hintsDelivered, Expired: s.hintsExpired}
+	for holder, hints := range s.hints {
+		info.Nodes = append(info.Nodes, NodeHints{ID: holder, Hints: append([]Hint{}, hints...)})
+		info.Pending += len(hints)
+	}
+	sort.Slice(info.Nodes, func(i, j int) bool { return info.Nodes[i].ID < info.Nodes[j].ID })
+	return info
+}
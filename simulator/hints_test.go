@@ -0,0 +1,95 @@
+package simulator
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestHintedHandoff tests that a write made while a replica is down is held
+// as a hint by another live node and delivered once the replica recovers.
+func TestHintedHandoff(t *testing.T) {
+	s := New(Config{Seed: 1, N: 3, R: 1, W: 2})
+	s.Init(testNodeCount)
+	h := s.Handler()
+	replicas := s.Locate("color")
+	down := replicas[2]
+
+	s.Fail(down)
+	written, err := s.KVPut("color", "red")
+	if err != nil {
+		t.Fatalf("KVPut failed: %v", err)
+	}
+
+	rr := doRequest(t, h, "GET", "/hints", "")
+	expectCode(t, rr, http.StatusOK)
+	var info HintInfo
+	decodeBody(t, rr, &info)
+	if info.Pending != 1 || len(info.Nodes) != 1 || len(info.Nodes[0].Hints) != 1 {
+		t.Fatalf("Expected one pending hint, got %+v", info)
+	}
+	holder, hint := info.Nodes[0].ID, info.Nodes[0].Hints[0]
+	for _, id := range replicas {
+		if holder == id {
+			t.Errorf("Expected the hint to be held outside the replicas %v, got %d", replicas, holder)
+		}
+	}
+	if hint.Key != "color" || hint.Target != down || hint.Entry.Version != written.Version {
+		t.Errorf("Unexpected hint %+v", hint)
+	}
+
+	// Nothing is delivered while the target is down.
+	if delivered := s.DeliverHints(); delivered != 0 {
+		t.Errorf("Expected no deliveries to a down replica, got %d", delivered)
+	}
+	s.Recover(down)
+	if delivered := s.DeliverHints(); delivered != 1 {
+		t.Errorf("Expected the hint to be delivered, got %d", delivered)
+	}
+	s.mu.RLock()
+	entry := s.replicaData[down]["color"]
+	s.mu.RUnlock()
+	if entry.Value != "red" || entry.Version != written.Version {
+		t.Errorf("Expected replica %d to hold the write, got %+v", down, entry)
+	}
+
+	if info := s.Hints(); info.Pending != 0 || len(info.Nodes) != 0 || info.Delivered != 1 {
+		t.Errorf("Expected the hint queue to drain, got %+v", info)
+	}
+	rr = doRequest(t, h, "GET", "/metrics", "")
+	if !strings.Contains(rr.Body.String(), "sim_hints_total{outcome=\"delivered\"} 1\n") {
+		t.Errorf("Expected the delivered hint in the metrics")
+	}
+}
+
+// TestHintExpiry tests that hints past their TTL are dropped undelivered.
+func TestHintExpiry(t *testing.T) {
+	s := New(Config{Seed: 1, N: 3, R: 1, W: 1, HintTTL: time.Millisecond})
+	s.Init(testNodeCount)
+	replicas := s.Locate("color")
+
+	s.Fail(replicas[1])
+	s.Fail(replicas[2])
+	if _, err := s.KVPut("color", "red"); err != nil {
+		t.Fatalf("KVPut failed: %v", err)
+	}
+	if pending := s.Hints().Pending; pending != 2 {
+		t.Fatalf("Expected two pending hints, got %d", pending)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	s.Recover(replicas[1])
+	if delivered := s.DeliverHints(); delivered != 0 {
+		t.Errorf("Expected expired hints not to be delivered, got %d", delivered)
+	}
+	if info := s.Hints(); info.Pending != 0 || info.Expired != 2 {
+		t.Errorf("Expected both hints to expire, got %+v", info)
+	}
+	s.mu.RLock()
+	_, ok := s.replicaData[replicas[1]]["color"]
+	s.mu.RUnlock()
+	if ok {
+		t.Errorf("Expected the expired hint not to reach replica %d", replicas[1])
+	}
+}
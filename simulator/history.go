@@ -0,0 +1,85 @@
+package simulator
+
+import "time"
+
+// DefaultValueHistorySize is the number of samples each node's value history
+// retains when Config.ValueHistorySize is unset.
+const DefaultValueHistorySize = 256
+
+// ValueSample is a node's value at one point in time.
+type ValueSample struct {
+	Time  time.Time `json:"time"`
+	Value int       `json:"value"`
+}
+
+// ValueHistory is the recent value history of one node.
+type ValueHistory struct {
+	NodeID  int           `json:"node_id"`
+	Samples []ValueSample `json:"samples"`
+}
+
+// valueRing is a fixed-capacity ring buffer of samples that overwrites the
+// oldest sample once full.
+type valueRing struct {
+	samples []ValueSample
+	start   int // Index of the oldest sample once the buffer is full.
+}
+
+// add appends sample, evicting the oldest one if the ring is at capacity.
+func (r *valueRing) add(sample ValueSample, capacity int) {
+	if len(r.samples) < capacity {
+		r.samples = append(r.samples, sample)
+		return
+	}
+	r.samples[r.start] = sample
+	r.start = (r.start + 1) % len(r.samples)
+}
+
+// ordered returns the samples oldest first.
+func (r *valueRing) ordered() []ValueSample {
+	out := make([]ValueSample, 0, len(r.samples))
+	out = append(out, r.samples[r.start:]...)
+	return append(out, r.samples[:r.start]...)
+}
+
+// History returns up to limit of the most recent samples of the node with
+// the given ID taken after since, oldest first. A zero since returns every
+// retained sample, and a limit outside 1 to MaxHistoryLimit means
+// DefaultHistoryLimit. It returns false if no such node exists.
+func (s *Simulator) History(id int, since time.Time, limit int) (ValueHistory, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.findNode(id) < 0 {
+		return ValueHistory{}, false
+	}
+	if limit < 1 || limit > MaxHistoryLimit {
+		limit = DefaultHistoryLimit
+	}
+
+	samples := []ValueSample{}
+	s.feedMu.Lock()
+	if ring := s.history[id]; ring != nil {
+		samples = ring.ordered()
+	}
+	s.feedMu.Unlock()
+	first := len(samples)
+	for first > 0 && samples[first-1].Time.After(since) {
+		first--
+	}
+	samples = samples[max(first, len(samples)-limit):]
+	return ValueHistory{NodeID: id, Samples: samples}, true
+}
+
+// recordValue appends the current value of the node at index, sampled at
+// the given time, to its value history. The caller must hold s.mu for
+// writing, or for reading along with s.feedMu and the node's lock.
+func (s *Simulator) recordValue(index int, at time.Time) {
+	node := s.nodes[index]
+	ring := s.history[node.ID]
+	if ring == nil {
+		ring = &valueRing{}
+		s.history[node.ID] = ring
+	}
+	ring.add(ValueSample{Time: at, Value: node.Value}, s.cfg.ValueHistorySize)
+}
@@ -0,0 +1,76 @@
+package simulator
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// historyValues returns the values of the samples in h.
+func historyValues(h ValueHistory) []int {
+	values := make([]int, len(h.Samples))
+	for i, sample := range h.Samples {
+		values[i] = sample.Value
+	}
+	return values
+}
+
+// TestNodeHistory tests that GET /nodes/{id}/history returns a node's values
+// in chronological order and respects limit and since.
+func TestNodeHistory(t *testing.T) {
+	s := New(Config{Seed: 1})
+	s.Init(testNodeCount)
+	h := s.Handler()
+	initial, _ := s.Node(0)
+	for i := 1; i <= 5; i++ {
+		s.SetNode(0, "Node-0", i*10)
+	}
+	s.SetNode(1, "Node-1", 99)
+
+	var history ValueHistory
+	decodeBody(t, doRequest(t, h, "GET", "/nodes/0/history", ""), &history)
+	want := []int{initial.Value, 10, 20, 30, 40, 50}
+	if got := historyValues(history); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected values %v, got %v", want, got)
+	}
+	for i := 1; i < len(history.Samples); i++ {
+		if history.Samples[i].Time.Before(history.Samples[i-1].Time) {
+			t.Errorf("Sample %d at %v precedes sample %d at %v", i, history.Samples[i].Time, i-1, history.Samples[i-1].Time)
+		}
+	}
+
+	decodeBody(t, doRequest(t, h, "GET", "/nodes/0/history?limit=2", ""), &history)
+	if got, want := historyValues(history), []int{40, 50}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the latest values %v, got %v", want, got)
+	}
+
+	since := history.Samples[0].Time.Format(time.RFC3339Nano)
+	decodeBody(t, doRequest(t, h, "GET", "/nodes/0/history?since="+url.QueryEscape(since), ""), &history)
+	if got, want := historyValues(history), []int{50}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected values after %s to be %v, got %v", since, want, got)
+	}
+
+	expectCode(t, doRequest(t, h, "GET", "/nodes/9/history", ""), http.StatusNotFound)
+	expectCode(t, doRequest(t, h, "GET", "/nodes/0/history?limit=0", ""), http.StatusBadRequest)
+	expectCode(t, doRequest(t, h, "GET", "/nodes/0/history?since=yesterday", ""), http.StatusBadRequest)
+}
+
+// TestNodeHistoryBounded tests that a node's history keeps only the most
+// recent samples once it reaches capacity.
+func TestNodeHistoryBounded(t *testing.T) {
+	s := New(Config{ValueHistorySize: 3})
+	s.Init(testNodeCount)
+	for i := 1; i <= 10; i++ {
+		s.SetNode(0, "Node-0", i)
+	}
+
+	history, _ := s.History(0, time.Time{}, MaxHistoryLimit)
+	if got, want := historyValues(history), []int{8, 9, 10}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected values %v, got %v", want, got)
+	}
+	if got := len(s.history[0].samples); got != 3 {
+		t.Errorf("Expected the buffer to hold 3 samples, got %d", got)
+	}
+}
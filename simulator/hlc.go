@@ -0,0 +1,96 @@
+package simulator
+
+import "time"
+
+// HLC is a hybrid logical clock timestamp: the physical time in Unix
+// nanoseconds, as read from a node's possibly skewed wall clock, and a
+// logical counter that orders events the physical time cannot, such as those
+// on a node whose clock is behind the timestamps it has seen. Unlike
+// wall clocks, HLC timestamps never go backwards and always order an event
+// after every event it causally depends on, however far the nodes' clocks
+// drift apart.
+type HLC struct {
+	Physical int64  `json:"physical" xml:"physical"`
+	Logical  uint32 `json:"logical" xml:"logical"`
+}
+
+// Compare returns -1 if h is before other, 1 if it is after, and 0 if they
+// are equal.
+func (h HLC) Compare(other HLC) int {
+	switch {
+	case h.Physical < other.Physical:
+		return -1
+	case h.Physical > other.Physical:
+		return 1
+	case h.Logical < other.Logical:
+		return -1
+	case h.Logical > other.Logical:
+		return 1
+	}
+	return 0
+}
+
+// Before reports whether h is before other.
+func (h HLC) Before(other HLC) bool { return h.Compare(other) < 0 }
+
+// After reports whether h is after other.
+func (h HLC) After(other HLC) bool { return h.Compare(other) > 0 }
+
+// tick returns the timestamp of a local event happening at wall on a clock
+// that last issued h.
+func (h HLC) tick(wall time.Time) HLC {
+	if pt := wall.UnixNano(); pt > h.Physical {
+		return HLC{Physical: pt}
+	}
+	return HLC{Physical: h.Physical, Logical: h.Logical + 1}
+}
+
+// receive returns the timestamp of receiving a message stamped msg at wall
+// on a clock that last issued h. The result is after both h and msg.
+func (h HLC) receive(msg HLC, wall time.Time) HLC {
+	next := HLC{Physical: max(h.Physical, msg.Physical, wall.UnixNano())}
+	switch {
+	case next.Physical == h.Physical && next.Physical == msg.Physical:
+		next.Logical = max(h.Logical, msg.Logical) + 1
+	case next.Physical == h.Physical:
+		next.Logical = h.Logical + 1
+	case next.Physical == msg.Physical:
+		next.Logical = msg.Logical + 1
+	}
+	return next
+}
+
+// wall returns the time on n's wall clock, which is off by its Skew.
+func (n *NodeData) wall() time.Time {
+	return time.Now().Add(time.Duration(n.Skew))
+}
+
+// stamp advances n's hybrid logical clock for a local event, such as a
+// mutation or sending a message, and returns the event's timestamp.
+func (n *NodeData) stamp() HLC {
+	n.Clock = n.Clock.tick(n.wall())
+	return n.Clock
+}
+
+// observe advances n's hybrid logical clock past msg, the timestamp of a
+// message n received.
+func (n *NodeData) observe(msg HLC) {
+	n.Clock = n.Clock.receive(msg, n.wall())
+}
+
+// SetSkew sets how far the wall clock of the node with the given ID is off
+// from real time, for simulating drifting clocks. It returns the updated
+// node and false if no such node exists.
+func (s *Simulator) SetSkew(id int, skew time.Duration) (NodeData, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := s.findNode(id)
+	if index < 0 {
+		return NodeData{}, false
+	}
+	s.nodes[index].Skew = Duration(skew)
+	s.publish(EventNodeUpdated, index)
+	s.logger.Info("node clock skewed", "node_id", id, "skew", skew)
+	return s.nodes[index].clone(), true
+}
@@ -0,0 +1,114 @@
+package simulator
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestHLC tests that timestamps advance past the clock's previous timestamp
+// and every message received, whatever the wall clock says.
+func TestHLC(t *testing.T) {
+	wall := time.Unix(0, 1000)
+	h := HLC{}.tick(wall)
+	if h != (HLC{Physical: 1000}) {
+		t.Errorf("Expected the wall time with no logical part, got %+v", h)
+	}
+	// A clock that goes backwards still moves forward logically.
+	if next := h.tick(time.Unix(0, 500)); next != (HLC{Physical: 1000, Logical: 1}) {
+		t.Errorf("Expected the logical part to advance, got %+v", next)
+	}
+
+	tests := []struct {
+		clock, msg HLC
+		wall       int64
+		want       HLC
+	}{
+		{HLC{10, 0}, HLC{20, 3}, 5, HLC{20, 4}},
+		{HLC{30, 2}, HLC{20, 3}, 5, HLC{30, 3}},
+		{HLC{30, 2}, HLC{30, 7}, 5, HLC{30, 8}},
+		{HLC{10, 2}, HLC{20, 3}, 40, HLC{40, 0}},
+	}
+	for _, tt := range tests {
+		got := tt.clock.receive(tt.msg, time.Unix(0, tt.wall))
+		if got != tt.want {
+			t.Errorf("%+v receiving %+v at %d: expected %+v, got %+v", tt.clock, tt.msg, tt.wall, tt.want, got)
+		}
+		if !got.After(tt.clock) || !got.After(tt.msg) {
+			t.Errorf("Expected %+v to be after %+v and %+v", got, tt.clock, tt.msg)
+		}
+	}
+}
+
+// TestClockSkew tests that with opposing skews, the wall clocks order a
+// write before the write it caused, while HLC timestamps keep the causal
+// order and gossip and registers follow them.
+func TestClockSkew(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	rr := doRequest(t, h, "POST", "/nodes/0/skew", `{"skew":"1h"}`)
+	expectCode(t, rr, http.StatusOK)
+	var skewed NodeData
+	decodeBody(t, rr, &skewed)
+	if time.Duration(skewed.Skew) != time.Hour {
+		t.Errorf("Expected a skew of 1h, got %v", skewed.Skew)
+	}
+	expectCode(t, doRequest(t, h, "POST", "/nodes/1/skew", `{"skew":"-1h"}`), http.StatusOK)
+
+	// Node 1 sees node 0's write, then writes on top of it.
+	expectCode(t, doRequest(t, h, "PUT", "/nodes/0", `{"name":"Node-0","value":100}`), http.StatusOK)
+	s.mu.Lock()
+	s.exchange(time.Now(), 0, 1)
+	s.mu.Unlock()
+	expectCode(t, doRequest(t, h, "PUT", "/nodes/1", `{"name":"Node-1","value":200}`), http.StatusOK)
+
+	a, _ := s.Node(0)
+	b, _ := s.Node(1)
+	if !b.Time.Before(a.Time) {
+		t.Errorf("Expected node 1's wall clock to put its write before node 0's, got %v and %v", b.Time, a.Time)
+	}
+	if !a.HLC.Before(b.HLC) || b.Clock.Before(b.HLC) {
+		t.Errorf("Expected node 1's write to follow node 0's by HLC, got %+v and %+v", a.HLC, b.HLC)
+	}
+
+	rr = doRequest(t, h, "GET", "/causality?a=0&b=1", "")
+	expectCode(t, rr, http.StatusOK)
+	var causality causalityResponse
+	decodeBody(t, rr, &causality)
+	if causality.Relation != HappensBefore || causality.HLC != orderBefore || causality.Wall != orderAfter {
+		t.Errorf("Expected HLC to agree with the vector clocks against the wall clocks, got %+v", causality)
+	}
+
+	// Gossip follows the HLC, so the causally later value wins.
+	s.mu.Lock()
+	s.exchange(time.Now(), 0, 1)
+	s.mu.Unlock()
+	if node, _ := s.Node(0); node.Value != 200 {
+		t.Errorf("Expected node 0 to adopt node 1's later value, got %d", node.Value)
+	}
+
+	// So do registers.
+	if _, err := s.SetRegister("r", 0, "first"); err != nil {
+		t.Fatalf("SetRegister failed: %v", err)
+	}
+	s.mu.Lock()
+	s.mergeCRDTs(0, 1)
+	s.mu.Unlock()
+	if _, err := s.SetRegister("r", 1, "second"); err != nil {
+		t.Fatalf("SetRegister failed: %v", err)
+	}
+	s.mu.Lock()
+	s.mergeCRDTs(0, 1)
+	s.mu.Unlock()
+	register, _ := s.Register("r")
+	for _, replica := range register.Replicas[:2] {
+		if replica.Register == nil || replica.Register.Value != "second" {
+			t.Errorf("Expected node %d to hold the causally later write, got %+v", replica.ID, replica.Register)
+		}
+	}
+
+	expectCode(t, doRequest(t, h, "POST", "/nodes/99/skew", `{"skew":"1s"}`), http.StatusNotFound)
+	expectCode(t, doRequest(t, h, "POST", "/nodes/0/skew", `{"skew":1}`), http.StatusBadRequest)
+}
@@ -0,0 +1,138 @@
+package simulator
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// httpStats counts requests, errors, and latencies per route for
+// /stats/http. Requests to different routes touch different counters, and
+// requests to the same route only update atomics, so recording never takes a
+// lock once a route has been seen.
+type httpStats struct {
+	routes sync.Map // Route pattern to *routeCounters.
+}
+
+// routeCounters holds the counters of one route. buckets[i] counts requests
+// that took at most durationBuckets[i] and longer than the bound before it;
+// the last counts those beyond every bound.
+type routeCounters struct {
+	requests     atomic.Uint64
+	clientErrors atomic.Uint64
+	serverErrors atomic.Uint64
+	nanos        atomic.Int64
+	buckets      []atomic.Uint64
+}
+
+// HTTPStats reports request counts, error rates, and latency histograms per
+// route, in route order.
+type HTTPStats struct {
+	Routes []RouteStats `json:"routes"`
+}
+
+// RouteStats reports the requests served by one route, identified by its
+// method and path pattern.
+type RouteStats struct {
+	Route        string          `json:"route"`
+	Requests     uint64          `json:"requests"`
+	ClientErrors uint64          `json:"client_errors"` // 4xx responses.
+	ServerErrors uint64          `json:"server_errors"` // 5xx responses.
+	ErrorRate    float64         `json:"error_rate"`    // Fraction of requests that got a 4xx or 5xx response.
+	MeanSeconds  float64         `json:"mean_seconds"`
+	Buckets      []LatencyBucket `json:"buckets"`
+}
+
+// LatencyBucket counts the requests that took at most LE, a duration such as
+// "25ms", and longer than the previous bucket's bound. The last bucket's LE
+// is "+Inf".
+type LatencyBucket struct {
+	LE    string `json:"le"`
+	Count uint64 `json:"count"`
+}
+
+// record records a request to route that got code after d.
+func (m *httpStats) record(route string, code int, d time.Duration) {
+	v, ok := m.routes.Load(route)
+	if !ok {
+		v, _ = m.routes.LoadOrStore(route, &routeCounters{buckets: make([]atomic.Uint64, len(durationBuckets)+1)})
+	}
+	c := v.(*routeCounters)
+
+	c.requests.Add(1)
+	switch {
+	case code >= 500:
+		c.serverErrors.Add(1)
+	case code >= 400:
+		c.clientErrors.Add(1)
+	}
+	c.nanos.Add(int64(d))
+	bucket := sort.SearchFloat64s(durationBuckets, d.Seconds())
+	c.buckets[bucket].Add(1)
+}
+
+// snapshot returns the counters of every route seen since the last reset.
+func (m *httpStats) snapshot() HTTPStats {
+	stats := HTTPStats{Routes: []RouteStats{}}
+	m.routes.Range(func(key, value interface{}) bool {
+		c := value.(*routeCounters)
+		rs := RouteStats{
+			Route:        key.(string),
+			Requests:     c.requests.Load(),
+			ClientErrors: c.clientErrors.Load(),
+			ServerErrors: c.serverErrors.Load(),
+			Buckets:      make([]LatencyBucket, len(c.buckets)),
+		}
+		if rs.Requests > 0 {
+			rs.ErrorRate = float64(rs.ClientErrors+rs.ServerErrors) / float64(rs.Requests)
+			rs.MeanSeconds = time.Duration(c.nanos.Load()).Seconds() / float64(rs.Requests)
+		}
+		for i := range c.buckets {
+			le := "+Inf"
+			if i < len(durationBuckets) {
+				le = time.Duration(durationBuckets[i] * float64(time.Second)).String()
+			}
+			rs.Buckets[i] = LatencyBucket{LE: le, Count: c.buckets[i].Load()}
+		}
+		stats.Routes = append(stats.Routes, rs)
+		return true
+	})
+	sort.Slice(stats.Routes, func(i, j int) bool { return stats.Routes[i].Route < stats.Routes[j].Route })
+	return stats
+}
+
+// reset forgets every route's counters.
+func (m *httpStats) reset() {
+	m.routes.Range(func(key, _ interface{}) bool {
+		m.routes.Delete(key)
+		return true
+	})
+}
+
+// HTTPStats returns the request counts, error rates, and latency histograms
+// of every route served since the simulator started or the stats were last
+// reset.
+func (s *Simulator) HTTPStats() HTTPStats {
+	return s.httpStats.snapshot()
+}
+
+// ResetHTTPStats clears the counters reported by HTTPStats.
+func (s *Simulator) ResetHTTPStats() {
+	s.httpStats.reset()
+}
+
+// getHTTPStats handles HTTP requests to retrieve per-route request
+// statistics.
+func (s *Simulator) getHTTPStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.HTTPStats())
+}
+
+// resetHTTPStats handles HTTP requests to clear the per-route request
+// statistics.
+func (s *Simulator) resetHTTPStats(w http.ResponseWriter, r *http.Request) {
+	s.ResetHTTPStats()
+	s.logger.Info("http stats reset")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,78 @@
+package simulator
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// routeStats returns the stats of route, failing the test if it has none.
+func routeStats(t *testing.T, stats HTTPStats, route string) RouteStats {
+	t.Helper()
+	for _, rs := range stats.Routes {
+		if rs.Route == route {
+			return rs
+		}
+	}
+	t.Fatalf("Expected stats for %s, got %+v", route, stats.Routes)
+	return RouteStats{}
+}
+
+// TestHTTPStats tests that requests delayed by a node's latency land in the
+// matching bucket, that errors are counted, and that the stats can be reset.
+func TestHTTPStats(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	h := s.Handler()
+	if _, ok := s.SetLatency(0, 60*time.Millisecond); !ok {
+		t.Fatalf("SetLatency failed")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			expectCode(t, doRequest(t, h, "GET", "/nodes/0", ""), http.StatusOK)
+		}()
+	}
+	wg.Wait()
+	expectCode(t, doRequest(t, h, "GET", "/nodes/1", ""), http.StatusOK)
+	expectCode(t, doRequest(t, h, "GET", "/nodes/99", ""), http.StatusNotFound)
+
+	rr := doRequest(t, h, "GET", "/stats/http", "")
+	expectCode(t, rr, http.StatusOK)
+	var stats HTTPStats
+	decodeBody(t, rr, &stats)
+	rs := routeStats(t, stats, "GET /nodes/{id}")
+	if rs.Requests != 5 || rs.ClientErrors != 1 || rs.ServerErrors != 0 || rs.ErrorRate != 0.2 {
+		t.Errorf("Unexpected counts %+v", rs)
+	}
+	if len(rs.Buckets) != len(durationBuckets)+1 || rs.Buckets[len(rs.Buckets)-1].LE != "+Inf" {
+		t.Fatalf("Unexpected buckets %+v", rs.Buckets)
+	}
+	for _, bucket := range rs.Buckets {
+		want := uint64(0)
+		switch bucket.LE {
+		case "5ms":
+			want = 2
+		case "100ms":
+			want = 3
+		}
+		if bucket.Count != want {
+			t.Errorf("Expected %d requests in the %s bucket, got %d", want, bucket.LE, bucket.Count)
+		}
+	}
+	if rs.MeanSeconds < 0.036 {
+		t.Errorf("Expected a mean of at least 36ms, got %v", rs.MeanSeconds)
+	}
+
+	expectCode(t, doRequest(t, h, "POST", "/stats/http/reset", ""), http.StatusNoContent)
+	var reset HTTPStats
+	decodeBody(t, doRequest(t, h, "GET", "/stats/http", ""), &reset)
+	// Only the reset itself was served since.
+	if len(reset.Routes) != 1 || reset.Routes[0].Route != "POST /stats/http/reset" {
+		t.Errorf("Expected the stats to be cleared, got %+v", reset.Routes)
+	}
+}
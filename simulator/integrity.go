@@ -0,0 +1,231 @@
+package simulator
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"sort"
+)
+
+// Parts of a node's data POST /nodes/{id}/corrupt can corrupt.
+const (
+	CorruptValue   = "value"   // The node's value.
+	CorruptData    = "data"    // A value in the node's data store.
+	CorruptReplica = "replica" // The value of a replicated key the node holds.
+)
+
+// ErrNothingToCorrupt means a node holds no data of the kind asked to be
+// corrupted.
+var ErrNothingToCorrupt = errors.New("nothing to corrupt")
+
+// Corruption describes a bit flipped in a node's stored data.
+type Corruption struct {
+	NodeID int    `json:"node_id"`
+	Target string `json:"target"`        // CorruptValue, CorruptData, or CorruptReplica.
+	Key    string `json:"key,omitempty"` // Key whose value was corrupted, unless Target is CorruptValue.
+	Bit    int    `json:"bit"`           // Index of the bit flipped, counting from the value's first byte.
+}
+
+// IntegrityReport lists the nodes whose data no longer matches the checksum
+// stored with it.
+type IntegrityReport struct {
+	Checked   int              `json:"checked"` // Number of nodes checked.
+	Healthy   bool             `json:"healthy"` // No mismatches were found.
+	Corrupted []NodeCorruption `json:"corrupted"`
+}
+
+// NodeCorruption describes a node whose checksums don't match its data.
+type NodeCorruption struct {
+	ID       int    `json:"id"`
+	Stored   uint32 `json:"stored"`   // Checksum stored when the node's data last changed.
+	Computed uint32 `json:"computed"` // Checksum of the data it holds now.
+
+	// Keys lists the replicated keys whose copies no longer match their own
+	// checksums.
+	Keys []string `json:"keys,omitempty"`
+}
+
+// sum returns the CRC-32 checksum of the parts of e that replicas compare.
+func (e KVEntry) sum() uint32 {
+	h := crc32.NewIEEE()
+	fmt.Fprintf(h, "%q %d %d %t", e.Value, e.Version, e.Token, e.Deleted)
+	return h.Sum32()
+}
+
+// sealed returns e with its checksum computed.
+func (e KVEntry) sealed() KVEntry {
+	e.Checksum = e.sum()
+	return e
+}
+
+// checksum returns the CRC-32 checksum of the data of the node at index: its
+// value, its data store, and the replicated keys it holds. The caller must
+// hold s.mu, and the node's lock if it holds s.mu only for reading.
+func (s *Simulator) checksum(index int) uint32 {
+	id := s.nodes[index].ID
+	h := crc32.NewIEEE()
+	fmt.Fprintf(h, "%d\n", s.nodes[index].Value)
+
+	keys := make([]string, 0, len(s.store[id]))
+	for key := range s.store[id] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(h, "d %q %q\n", key, s.store[id][key])
+	}
+
+	keys = keys[:0]
+	for key := range s.replicaData[id] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		e := s.replicaData[id][key]
+		fmt.Fprintf(h, "r %q %q %d %d %t\n", key, e.Value, e.Version, e.Token, e.Deleted)
+	}
+	return h.Sum32()
+}
+
+// seal stores the checksum of the data of the node with the given ID, if it
+// exists, after the data changed. The caller must hold s.mu for writing.
+func (s *Simulator) seal(id int) {
+	if index := s.findNode(id); index >= 0 {
+		s.nodes[index].Checksum = s.checksum(index)
+	}
+}
+
+// intact reports whether entry, a copy of key sent to the node with the given
+// ID, matches its checksum, or true if Config.VerifyChecksums is unset. A
+// copy that doesn't is counted and logged. The caller must hold s.mu for
+// writing.
+func (s *Simulator) intact(id int, key string, entry KVEntry) bool {
+	if !s.cfg.VerifyChecksums || entry.Checksum == entry.sum() {
+		return true
+	}
+	s.checksumRejected++
+	s.logger.Warn("corrupted copy refused", "key", key, "replica", id, "version", entry.Version)
+	return false
+}
+
+// Integrity recomputes the checksum of every node's data and reports the
+// nodes where it differs from the one stored with the data, along with the
+// replicated keys whose copies differ from their own checksums.
+func (s *Simulator) Integrity() IntegrityReport {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.rlockNodes()
+	defer s.runlockNodes()
+
+	report := IntegrityReport{Checked: len(s.nodes), Corrupted: []NodeCorruption{}}
+	for i := range s.nodes {
+		id := s.nodes[i].ID
+		node := NodeCorruption{ID: id, Stored: s.nodes[i].Checksum, Computed: s.checksum(i)}
+		for key, entry := range s.replicaData[id] {
+			if entry.Checksum != entry.sum() {
+				node.Keys = append(node.Keys, key)
+			}
+		}
+		if node.Stored != node.Computed || len(node.Keys) > 0 {
+			sort.Strings(node.Keys)
+			report.Corrupted = append(report.Corrupted, node)
+		}
+	}
+	report.Healthy = len(report.Corrupted) == 0
+	return report
+}
+
+// Corrupt flips a random bit in the data of the node with the given ID,
+// leaving its checksums as they were, to simulate disk corruption. target is
+// CorruptValue, CorruptData, or CorruptReplica, or empty to pick one at
+// random among those the node holds data for. Replicated keys are only
+// corrupted while they hold a value. It returns ErrNodeNotFound if no such
+// node exists, and an error wrapping ErrNothingToCorrupt if the node holds no
+// data of that kind or target is unknown.
+func (s *Simulator) Corrupt(id int, target string) (Corruption, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := s.findNode(id)
+	if index < 0 {
+		return Corruption{}, ErrNodeNotFound
+	}
+	candidates := map[string][]string{CorruptValue: {""}}
+	for key, value := range s.store[id] {
+		if value != "" {
+			candidates[CorruptData] = append(candidates[CorruptData], key)
+		}
+	}
+	for key, entry := range s.replicaData[id] {
+		if entry.Value != "" {
+			candidates[CorruptReplica] = append(candidates[CorruptReplica], key)
+		}
+	}
+	if target == "" {
+		targets := make([]string, 0, len(candidates))
+		for t := range candidates {
+			targets = append(targets, t)
+		}
+		sort.Strings(targets)
+		target = targets[s.rng.Intn(len(targets))]
+	}
+	keys, ok := candidates[target]
+	if !ok {
+		return Corruption{}, fmt.Errorf("%w: node %d has no %q to corrupt", ErrNothingToCorrupt, id, target)
+	}
+	sort.Strings(keys)
+
+	c := Corruption{NodeID: id, Target: target, Key: keys[s.rng.Intn(len(keys))]}
+	switch target {
+	case CorruptValue:
+		c.Bit = s.rng.Intn(32)
+		s.nodes[index].Value ^= 1 << c.Bit
+	case CorruptData:
+		var value string
+		value, c.Bit = s.flipBit(s.store[id][c.Key])
+		s.store[id][c.Key] = value
+	case CorruptReplica:
+		entry := s.replicaData[id][c.Key]
+		entry.Value, c.Bit = s.flipBit(entry.Value)
+		s.replicaData[id][c.Key] = entry
+	}
+	s.version++ // The node's value may have changed without an event.
+	s.logger.Warn("node data corrupted", "node_id", id, "target", target, "key", c.Key, "bit", c.Bit)
+	return c, nil
+}
+
+// flipBit returns v, which must not be empty, with one of the low seven bits
+// of a random byte flipped, and the index of the bit. The caller must hold
+// s.mu for writing.
+func (s *Simulator) flipBit(v string) (string, int) {
+	b := []byte(v)
+	i, bit := s.rng.Intn(len(b)), s.rng.Intn(7)
+	b[i] ^= 1 << bit
+	return string(b), 8*i + bit
+}
+
+// getIntegrity handles HTTP requests to verify every node's data against its
+// checksums.
+func (s *Simulator) getIntegrity(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Integrity())
+}
+
+// corruptNode handles HTTP requests to flip a bit in a node's data, in the
+// part named by the optional "target" query parameter.
+func (s *Simulator) corruptNode(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseNodeID(w, r)
+	if !ok {
+		return
+	}
+
+	c, err := s.Corrupt(id, r.URL.Query().Get("target"))
+	switch {
+	case errors.Is(err, ErrNodeNotFound):
+		writeError(w, http.StatusNotFound, "Node not found")
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, c)
+	}
+}
@@ -0,0 +1,105 @@
+package simulator
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestIntegrity tests that GET /integrity flags exactly the nodes whose data
+// was corrupted.
+func TestIntegrity(t *testing.T) {
+	s := New(Config{Seed: 1, N: 5, W: 5})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	expectCode(t, doRequest(t, h, "PUT", "/kv/color", `{"value":"blue"}`), http.StatusOK)
+	expectCode(t, doRequest(t, h, "PUT", "/nodes/3/data/city", `{"value":"Oslo"}`), http.StatusOK)
+	var report IntegrityReport
+	decodeBody(t, doRequest(t, h, "GET", "/integrity", ""), &report)
+	if !report.Healthy || report.Checked != testNodeCount || len(report.Corrupted) != 0 {
+		t.Fatalf("Expected every node to pass, got %+v", report)
+	}
+
+	var c Corruption
+	decodeBody(t, doRequest(t, h, "POST", "/nodes/2/corrupt?target=replica", ""), &c)
+	if c.NodeID != 2 || c.Target != CorruptReplica || c.Key != "color" {
+		t.Fatalf("Expected node 2's copy of color to be corrupted, got %+v", c)
+	}
+	decodeBody(t, doRequest(t, h, "GET", "/integrity", ""), &report)
+	if report.Healthy || len(report.Corrupted) != 1 {
+		t.Fatalf("Expected only node 2 to be flagged, got %+v", report)
+	}
+	if got := report.Corrupted[0]; got.ID != 2 || got.Stored == got.Computed || !reflect.DeepEqual(got.Keys, []string{"color"}) {
+		t.Errorf("Expected node 2 and its copy of color to fail, got %+v", got)
+	}
+
+	// Corrupting a data store or a value is caught by the node checksum.
+	decodeBody(t, doRequest(t, h, "POST", "/nodes/3/corrupt?target=data", ""), &c)
+	if c.Key != "city" {
+		t.Errorf("Expected node 3's city to be corrupted, got %+v", c)
+	}
+	s.Corrupt(4, CorruptValue)
+	var ids []int
+	for _, node := range s.Integrity().Corrupted {
+		ids = append(ids, node.ID)
+	}
+	if !reflect.DeepEqual(ids, []int{2, 3, 4}) {
+		t.Errorf("Expected nodes 2, 3, and 4 to be flagged, got %v", ids)
+	}
+
+	expectCode(t, doRequest(t, h, "POST", "/nodes/0/corrupt?target=data", ""), http.StatusBadRequest)
+	expectCode(t, doRequest(t, h, "POST", "/nodes/0/corrupt?target=disk", ""), http.StatusBadRequest)
+	expectCode(t, doRequest(t, h, "POST", "/nodes/99/corrupt", ""), http.StatusNotFound)
+
+	// Writing a node's value again stores a fresh checksum.
+	s.SetNode(4, "", 7)
+	for _, node := range s.Integrity().Corrupted {
+		if node.ID == 4 {
+			t.Errorf("Expected node 4 to pass once rewritten, got %+v", node)
+		}
+	}
+}
+
+// TestVerifyChecksums tests that replicas refuse corrupted copies only when
+// Config.VerifyChecksums is set.
+func TestVerifyChecksums(t *testing.T) {
+	for _, verify := range []bool{false, true} {
+		s := New(Config{Seed: 1, N: 3, W: 1, VerifyChecksums: verify})
+		s.Init(testNodeCount)
+		if _, err := s.KVPut("color", "blue"); err != nil {
+			t.Fatalf("KVPut failed: %v", err)
+		}
+		var holder int
+		for id, data := range s.replicaData {
+			if _, ok := data["color"]; ok {
+				holder = id
+			}
+		}
+		if _, err := s.Corrupt(holder, CorruptReplica); err != nil {
+			t.Fatalf("Corrupt failed: %v", err)
+		}
+		s.ReplicationRound()
+
+		copies := 0
+		for _, data := range s.replicaData {
+			if _, ok := data["color"]; ok {
+				copies++
+			}
+		}
+		if verify && copies != 1 {
+			t.Errorf("Expected the corrupted copy to be refused, got %d copies", copies)
+		}
+		if !verify && copies != 3 {
+			t.Errorf("Expected the corrupted copy to spread without verification, got %d copies", copies)
+		}
+		body := doRequest(t, s.Handler(), "GET", "/metrics", "").Body.String()
+		if rejected := !strings.Contains(body, "sim_checksum_rejected_total 0\n"); rejected != verify {
+			t.Errorf("With verification %t, expected rejections to be counted only when verifying", verify)
+		}
+		if report := s.Integrity(); len(report.Corrupted) < 1 {
+			t.Errorf("Expected the corrupted holder to stay flagged, got %+v", report)
+		}
+	}
+}
@@ -0,0 +1,381 @@
+package simulator
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// KVEntry is one replica's copy of a key in the replicated key-value store.
+type KVEntry struct {
+	Value   string    `json:"value"`
+	Version uint64    `json:"version"`
+	Token   uint64    `json:"token,omitempty"` // Fencing token of the write; see KVPutFenced.
+	Time    time.Time `json:"time"`
+
+	// Expires is when the entry expires on the simulation clock if it was
+	// written with a TTL. Deleted marks a tombstone, left by KVDelete or by
+	// an entry expiring, and DeletedAt is when on the simulation clock the
+	// key was deleted or expired; see SweepKV.
+	Expires   *time.Time `json:"expires,omitempty"`
+	Deleted   bool       `json:"deleted,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+
+	// Checksum covers the value, version, token, and tombstone mark, so
+	// that replicas can tell a copy corrupted on disk or in transit.
+	Checksum uint32 `json:"checksum"`
+}
+
+// newer reports whether e is a newer copy than other: it was written under a
+// higher fencing token, or under the same one with a higher version, or it
+// is the tombstone of the same write. A write coordinated by a deposed
+// leader thus loses to the writes of its successor, however late it comes.
+func (e KVEntry) newer(other KVEntry) bool {
+	if e.Token != other.Token {
+		return e.Token > other.Token
+	}
+	if e.Version != other.Version {
+		return e.Version > other.Version
+	}
+	return e.Deleted && !other.Deleted
+}
+
+// KVResult describes the outcome of a quorum read or write.
+type KVResult struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Version  uint64 `json:"version"`
+	Replicas []int  `json:"replicas"` // IDs of the replicas contacted.
+	Deleted  bool   `json:"deleted,omitempty"`
+
+	// Expires is when the value expires on the simulation clock, if it was
+	// written with a TTL.
+	Expires *time.Time `json:"expires,omitempty"`
+
+	// Repaired lists the contacted replicas that a read found holding an
+	// older version, or none, and brought up to date.
+	Repaired []int `json:"repaired,omitempty"`
+}
+
+// Errors returned by KVPut and KVGet.
+var (
+	// ErrQuorumUnavailable means fewer replicas are up than the operation's
+	// quorum requires.
+	ErrQuorumUnavailable = errors.New("not enough replicas are up to reach quorum")
+
+	// ErrKeyNotFound means none of the contacted replicas hold the key.
+	ErrKeyNotFound = errors.New("key not found")
+)
+
+// KVPut writes value for key to W of the key's N replicas. The replicas are
+// chosen at random among the key's up replicas, so the remaining replicas
+// keep whatever version they held before. Replicas that are down get the
+// write later through a hint held by a live node. The write carries the
+// latest fencing token issued. It returns ErrQuorumUnavailable without
+// writing anything if fewer than W replicas are up.
+func (s *Simulator) KVPut(key, value string) (KVResult, error) {
+	return s.KVPutTTL(key, value, 0)
+}
+
+// KVPutTTL is KVPut for a value that expires ttl from now on the simulation
+// clock, or never if ttl is not positive. Every copy carries the expiry, so
+// the replicas expire it together however late they receive it.
+func (s *Simulator) KVPutTTL(key, value string, ttl time.Duration) (KVResult, error) {
+	return s.kvPutTTL(nil, key, value, ttl)
+}
+
+// kvPutTTL is KVPutTTL, tracing the write with t, coordinated by the first
+// replica written.
+func (s *Simulator) kvPutTTL(t *tracer, key, value string, ttl time.Duration) (KVResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.cfg.Clock.Now()
+	targets, err := s.quorum(key, s.cfg.W, -1)
+	if err != nil {
+		t.record(0, "kv.put", -1, now, now, err)
+		return KVResult{}, err
+	}
+	s.traceQuorum(t, "kv.put", "replica.write", targets[0], targets, now)
+
+	entry := s.kvEntry(value, s.fencingToken, ttl)
+	for _, id := range targets {
+		s.storeReplica(id, key, entry)
+	}
+	s.addHints(key, entry, targets)
+	s.shipWrite(key, entry)
+
+	return KVResult{Key: key, Value: value, Version: entry.Version, Replicas: targets, Expires: entry.Expires}, nil
+}
+
+// kvEntry returns a new write of value under token with the next version and
+// its checksum, expiring ttl from now if ttl is positive. The caller must
+// hold s.mu for writing.
+func (s *Simulator) kvEntry(value string, token uint64, ttl time.Duration) KVEntry {
+	s.kvVersion++
+	entry := KVEntry{Value: value, Version: s.kvVersion, Token: token, Time: time.Now()}
+	if ttl > 0 {
+		expires := s.cfg.Clock.Now().Add(ttl)
+		entry.Expires = &expires
+	}
+	return entry.sealed()
+}
+
+// KVGet reads key from R of its N replicas, chosen at random among the key's
+// up replicas, and returns the newest version any of them holds. Contacted
+// replicas holding an older version, or none, are repaired with the newest
+// one. When R+W is not greater than N, the contacted replicas may all have
+// missed the latest write, so the result can be stale. Leaving nodes that
+// still hold a copy are contacted too. It returns ErrQuorumUnavailable if
+// fewer than R replicas are up and ErrKeyNotFound if no contacted replica
+// holds the key or the newest copy has expired.
+func (s *Simulator) KVGet(key string) (KVResult, error) {
+	return s.kvGet(nil, key)
+}
+
+// kvGet is KVGet, tracing the read and any repairs with t, coordinated by
+// the first replica read.
+func (s *Simulator) kvGet(t *tracer, key string) (KVResult, error) {
+	// Choosing replicas consumes the random source, so a write lock is
+	// needed even though no data changes.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.cfg.Clock.Now()
+	targets, err := s.quorum(key, s.cfg.R, -1)
+	if err != nil {
+		t.record(0, "kv.get", -1, now, now, err)
+		return KVResult{}, err
+	}
+	targets = append(targets, s.handing(key)...)
+	coordinator := targets[0]
+	root, answered := s.traceQuorum(t, "kv.get", "replica.read", coordinator, targets, now)
+
+	var newest KVEntry
+	found := false
+	for _, id := range targets {
+		entry, ok := s.replicaData[id][key]
+		if ok {
+			entry = s.replyEntry(id, entry)
+		}
+		if ok && (!found || entry.newer(newest)) {
+			newest = entry
+			found = true
+		}
+	}
+	if !found {
+		t.end(root, answered, ErrKeyNotFound)
+		return KVResult{Key: key, Replicas: targets}, ErrKeyNotFound
+	}
+
+	result := KVResult{Key: key, Value: newest.Value, Version: newest.Version, Replicas: targets, Expires: newest.Expires}
+	end := answered
+	for _, id := range targets {
+		if s.wants(id, key, newest, now) {
+			s.storeReplica(id, key, newest)
+			result.Repaired = append(result.Repaired, id)
+			// Repairs are sent once every replica has answered.
+			repaired := answered.Add(s.roundTripLatency(coordinator, id))
+			t.record(root, "replica.repair", id, answered, repaired, nil)
+			end = later(end, repaired)
+		}
+	}
+	t.end(root, end, nil)
+	if len(result.Repaired) > 0 {
+		s.logger.Debug("read repair", "key", key, "version", newest.Version, "replicas", result.Repaired)
+	}
+	if !newest.live(now) {
+		return KVResult{Key: key, Replicas: targets, Repaired: result.Repaired}, ErrKeyNotFound
+	}
+	return result, nil
+}
+
+// quorum picks size random up replicas of key, returned in preference-list
+// order. If via is a node ID, only replicas it can reach are picked. The
+// caller must hold s.mu for writing.
+func (s *Simulator) quorum(key string, size, via int) ([]int, error) {
+	var up []int
+	for _, id := range s.preferenceList(key, s.cfg.N) {
+		if s.nodes[s.findNode(id)].Status == StatusUp && (via < 0 || s.reachable(via, id)) {
+			up = append(up, id)
+		}
+	}
+	if len(up) < size {
+		return nil, fmt.Errorf("%w: need %d, have %d", ErrQuorumUnavailable, size, len(up))
+	}
+
+	chosen := make(map[int]bool, size)
+	for _, i := range s.rng.Perm(len(up))[:size] {
+		chosen[up[i]] = true
+	}
+	targets := make([]int, 0, size)
+	for _, id := range up {
+		if chosen[id] {
+			targets = append(targets, id)
+		}
+	}
+	return targets, nil
+}
+
+// storeReplica stores entry as the copy of key held by the node with the
+// given ID, raising the node's fence to the entry's token and storing the
+// node's checksum. A copy replaced by
+// an older write under a higher token was written by a deposed leader, and
+// is counted as rolled back. The caller must hold s.mu for writing.
+func (s *Simulator) storeReplica(id int, key string, entry KVEntry) {
+	if current, ok := s.replicaData[id][key]; ok && current.Version > entry.Version && current.Token < entry.Token {
+		s.recordStaleWrite(StaleWrite{Key: key, Replica: id, Token: current.Token, Fence: entry.Token, Outcome: StaleRolledBack})
+	}
+	if entry.Token > s.fences[id] {
+		s.fences[id] = entry.Token
+	}
+	if s.replicaData[id] == nil {
+		s.replicaData[id] = make(map[string]KVEntry)
+	}
+	s.replicaData[id][key] = entry
+	s.seal(id)
+}
+
+// preferenceList returns the IDs of the n nodes responsible for key. The
+// caller must hold s.mu.
+func (s *Simulator) preferenceList(key string, n int) []int {
+	return s.ring.Locate(key, n)
+}
+
+// Rebalance summarizes the key movement caused by a ring membership change.
+type Rebalance struct {
+	Trigger   string    `json:"trigger"` // For example "node 5 added".
+	KeysMoved int       `json:"keys_moved"`
+	Time      time.Time `json:"time"`
+}
+
+// kvKeys returns every key held by any replica. The caller must hold s.mu.
+func (s *Simulator) kvKeys() []string {
+	seen := make(map[string]bool)
+	for _, entries := range s.replicaData {
+		for key := range entries {
+			seen[key] = true
+		}
+	}
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// changeMembership applies change to the ring and hands every key whose
+// replica set changed over to its new replicas: the newest version any
+// replica holds is copied to each new replica, and replicas that are no
+// longer responsible drop their copy. It records and returns the number of
+// keys moved. The caller must hold s.mu for writing.
+func (s *Simulator) changeMembership(trigger string, change func(*HashRing)) int {
+	keys := s.kvKeys()
+	before := make(map[string][]int, len(keys))
+	for _, key := range keys {
+		before[key] = s.preferenceList(key, s.cfg.N)
+	}
+
+	change(s.ring)
+
+	now := s.cfg.Clock.Now()
+	moved := 0
+	for _, key := range keys {
+		after := s.preferenceList(key, s.cfg.N)
+		if sameIDs(before[key], after) {
+			continue
+		}
+		moved++
+
+		var newest KVEntry
+		found := false
+		for _, entries := range s.replicaData {
+			if entry, ok := entries[key]; ok && (!found || entry.newer(newest)) {
+				newest, found = entry, true
+			}
+		}
+		responsible := make(map[int]bool, len(after))
+		for _, id := range after {
+			responsible[id] = true
+			if s.wants(id, key, newest, now) {
+				s.storeReplica(id, key, newest)
+			}
+		}
+		for id, entries := range s.replicaData {
+			if _, ok := entries[key]; ok && !responsible[id] {
+				delete(entries, key)
+				s.seal(id)
+			}
+		}
+	}
+
+	s.lastRebalance = &Rebalance{Trigger: trigger, KeysMoved: moved, Time: time.Now()}
+	if moved > 0 {
+		s.logger.Info("ring rebalanced", "trigger", trigger, "keys_moved", moved)
+	}
+	return moved
+}
+
+// sameIDs reports whether a and b hold the same IDs, ignoring order.
+func sameIDs(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := make(map[int]bool, len(a))
+	for _, id := range a {
+		set[id] = true
+	}
+	for _, id := range b {
+		if !set[id] {
+			return false
+		}
+	}
+	return true
+}
+
+// RingInfo describes the consistent-hash ring used to place keys.
+type RingInfo struct {
+	VirtualNodes  int        `json:"virtual_nodes"`
+	Nodes         []RingNode `json:"nodes"`
+	LastRebalance *Rebalance `json:"last_rebalance,omitempty"`
+}
+
+// RingNode describes the part of the ring one node owns as a primary.
+type RingNode struct {
+	ID        int          `json:"id"`
+	Ownership float64      `json:"ownership"` // Fraction of the ring.
+	Ranges    []TokenRange `json:"ranges"`
+}
+
+// Ring returns the current ring layout.
+func (s *Simulator) Ring() RingInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	info := RingInfo{VirtualNodes: s.ring.VirtualNodes()}
+	if s.lastRebalance != nil {
+		last := *s.lastRebalance
+		info.LastRebalance = &last
+	}
+	ranges := s.ring.Ranges()
+	ownership := s.ring.Ownership()
+	for i := range s.nodes {
+		id := s.nodes[i].ID
+		info.Nodes = append(info.Nodes, RingNode{
+			ID:        id,
+			Ownership: ownership[id],
+			Ranges:    ranges[id],
+		})
+	}
+	return info
+}
+
+// Locate returns the IDs of the N nodes responsible for key, primary first.
+func (s *Simulator) Locate(key string) []int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.preferenceList(key, s.cfg.N)
+}
@@ -0,0 +1,137 @@
+package simulator
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+// TestKVQuorumWrite tests a successful quorum write and that every read with
+// R+W>N returns it.
+func TestKVQuorumWrite(t *testing.T) {
+	s := New(Config{Seed: 1, N: 3, R: 2, W: 2})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	rr := doRequest(t, h, "PUT", "/kv/color", `{"value":"red"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, rr.Code, rr.Body)
+	}
+	var written KVResult
+	decodeBody(t, rr, &written)
+	if len(written.Replicas) != 2 {
+		t.Errorf("Expected the write to reach 2 replicas, got %v", written.Replicas)
+	}
+
+	doRequest(t, h, "PUT", "/kv/color", `{"value":"blue"}`)
+	for i := 0; i < 50; i++ {
+		rr := doRequest(t, h, "GET", "/kv/color", "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d", http.StatusOK, rr.Code)
+		}
+		var read KVResult
+		decodeBody(t, rr, &read)
+		if read.Value != "blue" || len(read.Replicas) != 2 {
+			t.Fatalf("Expected to read the latest write from 2 replicas, got %+v", read)
+		}
+	}
+
+	// "stats" is a key like any other.
+	expectCode(t, doRequest(t, h, "PUT", "/kv/stats", `{"value":"green"}`), http.StatusOK)
+	var stats KVResult
+	rr = doRequest(t, h, "GET", "/kv/stats", "")
+	expectCode(t, rr, http.StatusOK)
+	decodeBody(t, rr, &stats)
+	if stats.Key != "stats" || stats.Value != "green" {
+		t.Errorf("Expected to read back the key \"stats\", got %+v", stats)
+	}
+
+	if rr := doRequest(t, h, "GET", "/kv/missing", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d for a missing key, but got %d", http.StatusNotFound, rr.Code)
+	}
+	if rr := doRequest(t, h, "PUT", "/kv/color", `{"colour":"red"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d for a malformed write, but got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+// TestKVQuorumUnavailable tests that writes and reads fail with 503 when too
+// many replicas are down.
+func TestKVQuorumUnavailable(t *testing.T) {
+	s := New(Config{Seed: 1, N: 3, R: 2, W: 2})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	s.mu.RLock()
+	replicas := s.preferenceList("color", 3)
+	s.mu.RUnlock()
+	s.Fail(replicas[0])
+	s.Fail(replicas[1])
+
+	if rr := doRequest(t, h, "PUT", "/kv/color", `{"value":"red"}`); rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+	if rr := doRequest(t, h, "GET", "/kv/color", ""); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status code %d, but got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+
+	// The failed write must not have reached the remaining replica.
+	s.Recover(replicas[0])
+	s.Recover(replicas[1])
+	if _, err := s.KVGet("color"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected the failed write to leave no data, got %v", err)
+	}
+}
+
+// TestKVStaleRead tests that reads can return stale data when R+W<=N.
+func TestKVStaleRead(t *testing.T) {
+	s := New(Config{Seed: 1, N: 3, R: 1, W: 1})
+	s.Init(testNodeCount)
+
+	if _, err := s.KVPut("color", "red"); err != nil {
+		t.Fatalf("KVPut failed: %v", err)
+	}
+	latest, err := s.KVPut("color", "blue")
+	if err != nil {
+		t.Fatalf("KVPut failed: %v", err)
+	}
+
+	stale := 0
+	for i := 0; i < 50; i++ {
+		result, err := s.KVGet("color")
+		if errors.Is(err, ErrKeyNotFound) || (err == nil && result.Version < latest.Version) {
+			stale++
+		} else if err != nil {
+			t.Fatalf("KVGet failed: %v", err)
+		}
+	}
+	if stale == 0 {
+		t.Error("Expected some reads to miss the latest write with R+W<=N")
+	}
+}
+
+// TestPreferenceList tests that a key's preference list holds distinct nodes
+// and is stable for the same membership.
+func TestPreferenceList(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+
+	s.mu.RLock()
+	first := s.preferenceList("some-key", 3)
+	second := s.preferenceList("some-key", 3)
+	all := s.preferenceList("some-key", 100)
+	s.mu.RUnlock()
+
+	seen := make(map[int]bool)
+	for i, id := range first {
+		if seen[id] {
+			t.Errorf("Node %d appears twice in %v", id, first)
+		}
+		seen[id] = true
+		if second[i] != id {
+			t.Errorf("Preference list changed between calls: %v vs %v", first, second)
+		}
+	}
+	if len(all) != testNodeCount {
+		t.Errorf("Expected the list to be capped at %d nodes, got %v", testNodeCount, all)
+	}
+}
@@ -0,0 +1,128 @@
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Duration is a time.Duration that is encoded in JSON, XML, and CSV as a
+// string such as "150ms".
+type Duration time.Duration
+
+// MarshalJSON encodes d as a duration string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON decodes a duration string such as "150ms".
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("duration must be a string: %w", err)
+	}
+	parsed, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalText encodes d as a duration string, which XML and CSV output use.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText decodes a duration string such as "150ms".
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// SetLatency sets the simulated network latency of the node with the given
+// ID, overriding Config.Latency. It returns the updated node and false if no
+// such node exists.
+func (s *Simulator) SetLatency(id int, latency time.Duration) (NodeData, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := s.findNode(id)
+	if index < 0 {
+		return NodeData{}, false
+	}
+	s.nodes[index].Latency = Duration(latency)
+	s.publish(EventNodeUpdated, index)
+	return s.nodes[index].clone(), true
+}
+
+// requestLatency returns how long to delay a request to path from a client
+// in region: the latency of the node it addresses, or Tunables.Latency if it
+// addresses no existing node, plus Config.InterRegionLatency if the node is
+// in another region than the client, plus a random jitter of up to
+// Tunables.Jitter.
+func (s *Simulator) requestLatency(path, region string) time.Duration {
+	t := s.Tunables()
+	latency := time.Duration(t.Latency)
+	if rest, ok := strings.CutPrefix(path, "/nodes/"); ok {
+		segment, _, _ := strings.Cut(rest, "/")
+		if id, err := strconv.Atoi(segment); err == nil {
+			s.mu.RLock()
+			if index := s.findNode(id); index >= 0 {
+				latency = s.nodeLatency(&s.nodes[index], region)
+			}
+			s.mu.RUnlock()
+		}
+	}
+
+	// Jitter comes from the global source rather than s.rng, so request
+	// timing doesn't perturb the seeded simulation.
+	if t.Jitter > 0 {
+		latency += time.Duration(rand.Int63n(int64(t.Jitter) + 1))
+	}
+	return latency
+}
+
+// nodeLatency returns the latency of a request to node from a client in
+// region, jitter aside: the node's latency, plus Config.InterRegionLatency if
+// the node is in another region than the client. The caller must hold s.mu.
+func (s *Simulator) nodeLatency(node *NodeData, region string) time.Duration {
+	latency := time.Duration(node.Latency)
+	if region != "" && node.Region != "" && node.Region != region {
+		latency += s.cfg.InterRegionLatency
+	}
+	return latency
+}
+
+// withLatency delays every request except the health probes by its
+// simulated latency before passing it to next. Requests for another
+// cluster's API are delayed by that cluster instead. The delay happens
+// without holding s.mu, so a slow node doesn't hold up requests to other
+// nodes.
+func (s *Simulator) withLatency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, ok := clusterPath(r.URL.Path); ok || r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if latency := s.requestLatency(r.URL.Path, s.clientRegion(r)); latency > 0 {
+			timer := time.NewTimer(latency)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-r.Context().Done():
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
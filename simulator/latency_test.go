@@ -0,0 +1,146 @@
+package simulator
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// timedRequest performs a GET of path on h and returns how long it took.
+func timedRequest(t *testing.T, h http.Handler, path string) time.Duration {
+	t.Helper()
+
+	start := time.Now()
+	rr := doRequest(t, h, "GET", path, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("GET %s: expected status code %d, but got %d", path, http.StatusOK, rr.Code)
+	}
+	return time.Since(start)
+}
+
+// TestNodeLatency tests that a slow node delays requests to it without
+// delaying requests to other nodes, even when they run concurrently.
+func TestNodeLatency(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	rr := doRequest(t, h, "POST", "/nodes/1/latency", `{"latency":"100ms"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, rr.Code, rr.Body)
+	}
+
+	var slow, fast time.Duration
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		slow = timedRequest(t, h, "/nodes/1")
+	}()
+	go func() {
+		defer wg.Done()
+		time.Sleep(10 * time.Millisecond)
+		fast = timedRequest(t, h, "/nodes/2")
+	}()
+	wg.Wait()
+
+	if slow < 100*time.Millisecond {
+		t.Errorf("Expected the request to node 1 to take at least 100ms, took %v", slow)
+	}
+	if fast >= 50*time.Millisecond {
+		t.Errorf("Expected the request to node 2 to be unaffected, took %v", fast)
+	}
+
+	// GET /nodes reports each node's latency.
+	var nodes []map[string]interface{}
+	if err := json.Unmarshal(doRequest(t, h, "GET", "/nodes", "").Body.Bytes(), &nodes); err != nil {
+		t.Fatalf("Failed to unmarshal nodes: %v", err)
+	}
+	if nodes[1]["latency"] != "100ms" || nodes[2]["latency"] != "0s" {
+		t.Errorf("Expected latencies 100ms and 0s, got %v and %v", nodes[1]["latency"], nodes[2]["latency"])
+	}
+
+	for body, want := range map[string]int{
+		`{"latency":"-1s"}`:  http.StatusBadRequest,
+		`{"latency":"slow"}`: http.StatusBadRequest,
+		`{}`:                 http.StatusBadRequest,
+	} {
+		if rr := doRequest(t, h, "POST", "/nodes/1/latency", body); rr.Code != want {
+			t.Errorf("POST %s: expected status code %d, but got %d", body, want, rr.Code)
+		}
+	}
+	if rr := doRequest(t, h, "POST", "/nodes/99/latency", `{"latency":"1ms"}`); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, but got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+// TestRequestLatency tests that the base latency and jitter apply to every
+// request except the health probes.
+func TestRequestLatency(t *testing.T) {
+	s := New(Config{Latency: 20 * time.Millisecond, Jitter: 10 * time.Millisecond})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	for _, path := range []string{"/nodes", "/nodes/0", "/leader"} {
+		if took := timedRequest(t, h, path); took < 20*time.Millisecond {
+			t.Errorf("GET %s: expected at least 20ms of latency, took %v", path, took)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		if latency := s.requestLatency("/nodes", ""); latency < 20*time.Millisecond || latency > 30*time.Millisecond {
+			t.Fatalf("Expected latency between 20ms and 30ms, got %v", latency)
+		}
+	}
+
+	s.initialized.Store(true)
+	s.updaterRunning.Store(true)
+	if took := timedRequest(t, h, "/readyz"); took >= 20*time.Millisecond {
+		t.Errorf("Expected the readiness probe not to be delayed, took %v", took)
+	}
+}
+
+// TestRegionLatency tests that requests to nodes in another region than the
+// client's pay the inter-region latency, and requests within it don't.
+func TestRegionLatency(t *testing.T) {
+	s := New(Config{Latency: 5 * time.Millisecond, InterRegionLatency: 80 * time.Millisecond, ClientRegion: "us-east"})
+	s.InitTopology([]Region{{Name: "us-east", Nodes: 2}, {Name: "eu-west", Nodes: 2}, {Nodes: 1}})
+
+	intra, inter := 5*time.Millisecond, 85*time.Millisecond
+	for _, tt := range []struct {
+		path, region string
+		want         time.Duration
+	}{
+		{"/nodes/0", "us-east", intra},
+		{"/nodes/1/history", "us-east", intra},
+		{"/nodes/2", "us-east", inter},
+		{"/nodes/2", "eu-west", intra},
+		{"/nodes/0", "eu-west", inter},
+		{"/nodes/4", "eu-west", intra}, // Node 4 is in no region.
+		{"/nodes/2", "", intra},        // Nor is the client.
+		{"/nodes", "eu-west", intra},   // Nor does the request address a node.
+	} {
+		if got := s.requestLatency(tt.path, tt.region); got != tt.want {
+			t.Errorf("%s from %q: expected %v, got %v", tt.path, tt.region, tt.want, got)
+		}
+	}
+
+	// The region defaults to Config.ClientRegion and follows the node when
+	// it moves.
+	h := s.Handler()
+	if took := timedRequest(t, h, "/nodes/2"); took < inter {
+		t.Errorf("Expected a request from us-east to eu-west to take at least %v, took %v", inter, took)
+	}
+	req := httptest.NewRequest("GET", "/nodes/2", nil)
+	req.Header.Set("X-Client-Region", "eu-west")
+	if got := s.clientRegion(req); got != "eu-west" {
+		t.Errorf("Expected the X-Client-Region header to name the client's region, got %q", got)
+	}
+	region := "us-east"
+	s.PatchMetadata(2, MetadataPatch{Region: &region})
+	if got := s.requestLatency("/nodes/2", "us-east"); got != intra {
+		t.Errorf("Expected the moved node to be within the region, got %v", got)
+	}
+}
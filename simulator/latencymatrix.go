@@ -0,0 +1,302 @@
+package simulator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LatencyModel sets how long messages between nodes take to arrive. The
+// delay of a message is a base latency chosen by where its sender and
+// receiver are, or the override for the pair if there is one, plus a random
+// jitter of up to Jitter. Gossip exchanges, replication copies, heartbeats,
+// and the rounds of a two-phase commit are all delayed by it. The zero value
+// delivers every message at once.
+type LatencyModel struct {
+	IntraZone   Duration `json:"intra_zone"`   // Between nodes in the same region and zone.
+	IntraRegion Duration `json:"intra_region"` // Between nodes in the same region, or both in none.
+	InterRegion Duration `json:"inter_region"` // Between nodes in different regions.
+	Jitter      Duration `json:"jitter"`
+
+	// Overrides maps sender IDs to receiver IDs to the base latency of the
+	// messages between them, in place of the one their placement gives.
+	Overrides map[int]map[int]Duration `json:"overrides,omitempty"`
+}
+
+// LatencyMatrix is the latency model in use with the base latency it gives
+// every ordered pair of distinct nodes.
+type LatencyMatrix struct {
+	LatencyModel
+
+	// Pairs maps sender IDs to receiver IDs to the base latency of the
+	// messages between them, before jitter.
+	Pairs map[int]map[int]Duration `json:"pairs"`
+}
+
+// clone returns a copy of m that shares no memory with it.
+func (m LatencyModel) clone() LatencyModel {
+	overrides := m.Overrides
+	m.Overrides = nil
+	for from, row := range overrides {
+		for to, latency := range row {
+			m.setOverride(from, to, latency)
+		}
+	}
+	return m
+}
+
+// setOverride sets the base latency of messages from node from to node to.
+func (m *LatencyModel) setOverride(from, to int, latency Duration) {
+	if m.Overrides == nil {
+		m.Overrides = make(map[int]map[int]Duration)
+	}
+	if m.Overrides[from] == nil {
+		m.Overrides[from] = make(map[int]Duration)
+	}
+	m.Overrides[from][to] = latency
+}
+
+// ErrInvalidLatency means a latency model was rejected.
+var ErrInvalidLatency = errors.New("invalid latency model")
+
+// validate returns an error wrapping ErrInvalidLatency if a latency of m is
+// negative or an override links a node to itself.
+func (m LatencyModel) validate() error {
+	for name, latency := range map[string]Duration{"intra_zone": m.IntraZone, "intra_region": m.IntraRegion, "inter_region": m.InterRegion, "jitter": m.Jitter} {
+		if latency < 0 {
+			return fmt.Errorf("%w: %s must not be negative", ErrInvalidLatency, name)
+		}
+	}
+	for from, row := range m.Overrides {
+		for to, latency := range row {
+			if from == to {
+				return fmt.Errorf("%w: node %d cannot override its latency to itself", ErrInvalidLatency, from)
+			}
+			if latency < 0 {
+				return fmt.Errorf("%w: the latency from node %d to node %d must not be negative", ErrInvalidLatency, from, to)
+			}
+		}
+	}
+	return nil
+}
+
+// ParseLatencyModel parses a latency model such as
+// "intra-zone=1ms,intra-region=5ms,inter-region=80ms,jitter=2ms". Latencies
+// left out are zero.
+func ParseLatencyModel(spec string) (LatencyModel, error) {
+	var m LatencyModel
+	fields := map[string]*Duration{"intra-zone": &m.IntraZone, "intra-region": &m.IntraRegion, "inter-region": &m.InterRegion, "jitter": &m.Jitter}
+	for _, part := range strings.Split(spec, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		field, ok := fields[name]
+		if !ok {
+			return LatencyModel{}, fmt.Errorf("unknown latency %q, expected intra-zone, intra-region, inter-region, or jitter", name)
+		}
+		latency, err := time.ParseDuration(value)
+		if err != nil {
+			return LatencyModel{}, fmt.Errorf("latency %s: %v", name, err)
+		}
+		*field = Duration(latency)
+	}
+	return m, m.validate()
+}
+
+// message is a message between nodes delivered after a delay by send.
+type message struct {
+	from, to int
+	topic    string // What the message carries, for inFlightTo, or empty.
+	arrives  time.Time
+	apply    func(arrived time.Time)
+}
+
+// SetLatencyModel replaces the latency model of messages between nodes.
+// Messages already in flight keep their delays. It returns ErrNodeNotFound
+// if an override names a node that doesn't exist and an error wrapping
+// ErrInvalidLatency if m is otherwise invalid.
+func (s *Simulator) SetLatencyModel(m LatencyModel) error {
+	if err := m.validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for from, row := range m.Overrides {
+		for to := range row {
+			if s.findNode(from) < 0 || s.findNode(to) < 0 {
+				return ErrNodeNotFound
+			}
+		}
+	}
+	s.latencyModel = m.clone()
+	s.logger.Info("latency model changed", "intra_zone", time.Duration(m.IntraZone), "intra_region", time.Duration(m.IntraRegion),
+		"inter_region", time.Duration(m.InterRegion), "jitter", time.Duration(m.Jitter))
+	return nil
+}
+
+// LatencyMatrix returns the latency model in use and the base latency it
+// gives every pair of nodes.
+func (s *Simulator) LatencyMatrix() LatencyMatrix {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	matrix := LatencyMatrix{LatencyModel: s.latencyModel.clone(), Pairs: make(map[int]map[int]Duration)}
+	for i := range s.nodes {
+		from := s.nodes[i].ID
+		matrix.Pairs[from] = make(map[int]Duration, len(s.nodes)-1)
+		for j := range s.nodes {
+			if i != j {
+				matrix.Pairs[from][s.nodes[j].ID] = Duration(s.baseLatency(i, j))
+			}
+		}
+	}
+	return matrix
+}
+
+// baseLatency returns the latency of messages from the node at index i to
+// the node at index j before jitter. The caller must hold s.mu.
+func (s *Simulator) baseLatency(i, j int) time.Duration {
+	a, b := &s.nodes[i], &s.nodes[j]
+	if latency, ok := s.latencyModel.Overrides[a.ID][b.ID]; ok {
+		return time.Duration(latency)
+	}
+	switch {
+	case a.Region != b.Region:
+		return time.Duration(s.latencyModel.InterRegion)
+	case a.Zone != "" && a.Zone == b.Zone:
+		return time.Duration(s.latencyModel.IntraZone)
+	default:
+		return time.Duration(s.latencyModel.IntraRegion)
+	}
+}
+
+// messageDelay returns the delay of a message from the node with ID from to
+// the node with ID to, drawing its jitter from the random source. Messages a
+// node sends itself, and those between nodes that don't exist, take no time.
+// Without jitter the random source is not consumed, so seeded runs without
+// it are unaffected. The caller must hold s.mu for writing.
+func (s *Simulator) messageDelay(from, to int) time.Duration {
+	i, j := s.findNode(from), s.findNode(to)
+	if i < 0 || j < 0 || i == j {
+		return 0
+	}
+	delay := s.baseLatency(i, j)
+	if jitter := s.latencyModel.Jitter; jitter > 0 {
+		delay += time.Duration(s.rng.Int63n(int64(jitter) + 1))
+	}
+	return delay
+}
+
+// send sends a message of the given kind carrying payload from node from to
+// node to at now, calling apply once it arrives: at once if it takes no time,
+// otherwise in the first gossip, replication, or heartbeat round after its
+// delay has passed on the simulation clock. The message is counted in the
+// link's traffic and held to its bandwidth limit; send returns false if the
+// limit drops it. Whether the message is lost is up to the caller, with
+// deliver. Messages a node sends itself are neither counted nor limited. The
+// caller must hold s.mu for writing.
+func (s *Simulator) send(now time.Time, from, to int, kind, topic string, payload any, apply func(arrived time.Time)) bool {
+	if from == to {
+		apply(now)
+		return true
+	}
+	size := messageSize(payload)
+	queued, ok := s.throttle(now, link{from, to}, size)
+	if !ok {
+		return false
+	}
+	s.traffic.record(link{from, to}, kind, size)
+	if kind == MessageReplication || kind == MessageHint {
+		s.usage.charge(from, messageCPUTime)
+		s.usage.charge(to, messageCPUTime)
+	}
+
+	delay := queued + s.messageDelay(from, to)
+	if delay <= 0 {
+		apply(now)
+		return true
+	}
+	s.inFlight = append(s.inFlight, message{from: from, to: to, topic: topic, arrives: now.Add(delay), apply: apply})
+	return true
+}
+
+// deliverArrived applies every in-flight message that has arrived by now, in
+// order of arrival. The caller must hold s.mu for writing.
+func (s *Simulator) deliverArrived(now time.Time) {
+	var arrived []message
+	pending := s.inFlight[:0]
+	for _, m := range s.inFlight {
+		if m.arrives.After(now) {
+			pending = append(pending, m)
+		} else {
+			arrived = append(arrived, m)
+		}
+	}
+	clear(s.inFlight[len(pending):])
+	s.inFlight = pending
+
+	sort.SliceStable(arrived, func(i, j int) bool { return arrived[i].arrives.Before(arrived[j].arrives) })
+	for _, m := range arrived {
+		m.apply(m.arrives)
+	}
+}
+
+// inFlightTo reports whether a message about topic is on its way to the node
+// with the given ID. The caller must hold s.mu.
+func (s *Simulator) inFlightTo(to int, topic string) bool {
+	for _, m := range s.inFlight {
+		if m.to == to && m.topic == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// forgetLatencies drops the latency overrides and in-flight messages to or
+// from the node with the given ID. The caller must hold s.mu for writing.
+func (s *Simulator) forgetLatencies(id int) {
+	delete(s.latencyModel.Overrides, id)
+	for _, row := range s.latencyModel.Overrides {
+		delete(row, id)
+	}
+	pending := s.inFlight[:0]
+	for _, m := range s.inFlight {
+		if m.from != id && m.to != id {
+			pending = append(pending, m)
+		}
+	}
+	clear(s.inFlight[len(pending):])
+	s.inFlight = pending
+}
+
+// getLatencyMatrix handles HTTP requests to retrieve the latency of messages
+// between every pair of nodes.
+func (s *Simulator) getLatencyMatrix(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.LatencyMatrix())
+}
+
+// putLatencyMatrix handles HTTP requests to replace the latency model from a
+// body like {"intra_region":"5ms","inter_region":"80ms","overrides":{"0":{"3":"1s"}}}.
+func (s *Simulator) putLatencyMatrix(w http.ResponseWriter, r *http.Request) {
+	var payload LatencyModel
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "Malformed JSON body")
+		return
+	}
+
+	err := s.SetLatencyModel(payload)
+	switch {
+	case errors.Is(err, ErrNodeNotFound):
+		writeError(w, http.StatusNotFound, "Node not found")
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, s.LatencyMatrix())
+	}
+}
@@ -0,0 +1,229 @@
+package simulator
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// latencyClock returns a paused virtual clock that each Step advances by a
+// second, so a round run after each step stands for one tick.
+func latencyClock(t *testing.T) *VirtualClock {
+	t.Helper()
+	clock := NewVirtualClock(time.Unix(0, 0))
+	clock.Pause()
+	ticker := clock.NewTicker(time.Second)
+	t.Cleanup(ticker.Stop)
+	return clock
+}
+
+// TestLatencyMatrix tests inspecting and replacing the latency model over
+// HTTP.
+func TestLatencyMatrix(t *testing.T) {
+	s := New(Config{MessageLatency: LatencyModel{IntraRegion: Duration(5 * time.Millisecond), InterRegion: Duration(80 * time.Millisecond)}})
+	s.InitTopology([]Region{{Name: "us-east", Nodes: 2}, {Name: "eu-west", Nodes: 1}})
+	zone := "us-east-1a"
+	s.PatchMetadata(0, MetadataPatch{Zone: &zone})
+	s.PatchMetadata(1, MetadataPatch{Zone: &zone})
+	h := s.Handler()
+
+	var matrix LatencyMatrix
+	decodeBody(t, doRequest(t, h, "GET", "/latency-matrix", ""), &matrix)
+	if got := matrix.Pairs[0][1]; got != 0 {
+		t.Errorf("Expected no intra-zone latency, got %v", got)
+	}
+	if got := matrix.Pairs[0][2]; got != Duration(80*time.Millisecond) {
+		t.Errorf("Expected an inter-region latency of 80ms, got %v", got)
+	}
+	if _, ok := matrix.Pairs[0][0]; ok || len(matrix.Pairs) != 3 {
+		t.Errorf("Expected every pair of distinct nodes, got %v", matrix.Pairs)
+	}
+
+	rr := doRequest(t, h, "PUT", "/latency-matrix", `{"intra_zone":"1ms","intra_region":"5ms","inter_region":"2s","overrides":{"2":{"0":"3s"}}}`)
+	expectCode(t, rr, http.StatusOK)
+	decodeBody(t, rr, &matrix)
+	for _, tt := range []struct {
+		from, to int
+		want     time.Duration
+	}{
+		{0, 1, time.Millisecond},
+		{0, 2, 2 * time.Second},
+		{2, 0, 3 * time.Second},
+		{2, 1, 2 * time.Second},
+	} {
+		if got := time.Duration(matrix.Pairs[tt.from][tt.to]); got != tt.want {
+			t.Errorf("Expected a latency of %v from node %d to node %d, got %v", tt.want, tt.from, tt.to, got)
+		}
+	}
+
+	for body, want := range map[string]int{
+		`{"jitter":"-1ms"}`:                  http.StatusBadRequest,
+		`{"overrides":{"1":{"1":"1s"}}}`:     http.StatusBadRequest,
+		`{"overrides":{"0":{"9":"1s"}}}`:     http.StatusNotFound,
+		`{"pairs":{"0":{"1":"1s"}}}`:         http.StatusBadRequest,
+		`{"inter_region":"far"}`:             http.StatusBadRequest,
+		`{"inter_region":"1s","extra":true}`: http.StatusBadRequest,
+	} {
+		expectCode(t, doRequest(t, h, "PUT", "/latency-matrix", body), want)
+	}
+	if got := s.LatencyMatrix().Pairs[2][0]; got != Duration(3*time.Second) {
+		t.Errorf("Expected rejected models to leave the matrix alone, got %v", got)
+	}
+
+	// Removing a node drops its overrides.
+	s.RemoveNode(2)
+	if overrides := s.LatencyMatrix().Overrides; len(overrides) != 0 {
+		t.Errorf("Expected the removed node's overrides to be dropped, got %v", overrides)
+	}
+}
+
+// TestParseLatencyModel tests parsing the -message-latency flag.
+func TestParseLatencyModel(t *testing.T) {
+	m, err := ParseLatencyModel("intra-zone=1ms, inter-region=80ms,jitter=2ms")
+	if err != nil {
+		t.Fatalf("ParseLatencyModel failed: %v", err)
+	}
+	if m.IntraZone != Duration(time.Millisecond) || m.IntraRegion != 0 || m.InterRegion != Duration(80*time.Millisecond) || m.Jitter != Duration(2*time.Millisecond) {
+		t.Errorf("Unexpected model %+v", m)
+	}
+	for _, spec := range []string{"", "inter-region", "inter-region=far", "cross-planet=1s", "jitter=-1ms"} {
+		if _, err := ParseLatencyModel(spec); err == nil {
+			t.Errorf("Expected %q to be rejected", spec)
+		}
+	}
+}
+
+// TestReplicationLatency tests that replication to a distant region takes
+// as many more ticks as its latency is longer.
+func TestReplicationLatency(t *testing.T) {
+	clock := latencyClock(t)
+	s := New(Config{Seed: 1, Clock: clock, N: 4, R: 1, W: 1, MessageLatency: LatencyModel{
+		IntraRegion: Duration(time.Second),
+		InterRegion: Duration(10 * time.Second),
+	}})
+	s.InitTopology([]Region{{Name: "us-east", Nodes: 2}, {Name: "eu-west", Nodes: 2}})
+
+	result, err := s.KVPut("k", "v")
+	if err != nil {
+		t.Fatalf("KVPut failed: %v", err)
+	}
+	writer, _ := s.Node(result.Replicas[0])
+
+	arrived := make(map[int]int) // Node ID to the tick the write reached it.
+	for tick := 0; tick <= 12 && len(arrived) < 3; tick++ {
+		if tick > 0 {
+			if err := clock.Step(); err != nil {
+				t.Fatalf("Step failed: %v", err)
+			}
+		}
+		s.ReplicationRound()
+		info, _ := s.KVReplicas("k")
+		for _, replica := range info.Replicas {
+			if _, seen := arrived[replica.ID]; !seen && replica.ID != writer.ID && replica.InSync {
+				arrived[replica.ID] = tick
+			}
+		}
+	}
+
+	for _, node := range s.Snapshot() {
+		if node.ID == writer.ID {
+			continue
+		}
+		want := 10
+		if node.Region == writer.Region {
+			want = 1
+		}
+		if got, ok := arrived[node.ID]; !ok || got != want {
+			t.Errorf("Expected the write to reach node %d in %s after %d ticks, got %d", node.ID, node.Region, want, got)
+		}
+	}
+	if n := len(s.inFlight); n != 0 {
+		t.Errorf("Expected no copies left in flight, got %d", n)
+	}
+}
+
+// TestGossipLatency tests that a value gossiped from one region converges
+// there before the distant region hears of it.
+func TestGossipLatency(t *testing.T) {
+	clock := latencyClock(t)
+	s := New(Config{Seed: 1, Clock: clock, Mode: ModeGossip, MessageLatency: LatencyModel{InterRegion: Duration(time.Hour)}})
+	s.InitTopology([]Region{{Name: "us-east", Nodes: 3}, {Name: "eu-west", Nodes: 3}})
+	s.SetNode(0, "Node-0", 555)
+
+	for i := 0; i < 30; i++ {
+		s.GossipRound()
+	}
+	for _, node := range s.Snapshot() {
+		if sawUpdate := node.Value == 555; sawUpdate != (node.Region == "us-east") {
+			t.Errorf("Expected only the local region to see the update before the hour is up, node %d in %s has %d", node.ID, node.Region, node.Value)
+		}
+	}
+	if s.Convergence().Converged {
+		t.Errorf("Expected the cluster not to have converged")
+	}
+
+	if err := s.SetLatencyModel(LatencyModel{}); err != nil {
+		t.Fatalf("SetLatencyModel failed: %v", err)
+	}
+	for i := 0; i < 30 && !s.Convergence().Converged; i++ {
+		s.GossipRound()
+	}
+	if c := s.Convergence(); !c.Converged || c.LatestValue != 555 {
+		t.Errorf("Expected convergence on 555 once the latency is gone, got %+v", c)
+	}
+}
+
+// TestHeartbeatLatency tests that heartbeats count from when they reach the
+// leader, so a distant node is suspected once its latency exceeds the
+// timeout.
+func TestHeartbeatLatency(t *testing.T) {
+	s := New(Config{SuspectTimeout: 3 * time.Second, MessageLatency: LatencyModel{InterRegion: Duration(5 * time.Second)}})
+	s.InitTopology([]Region{{Name: "us-east", Nodes: 2}, {Name: "eu-west", Nodes: 1}})
+
+	start := s.cfg.Clock.Now()
+	for i := 1; i <= 4; i++ {
+		s.heartbeatRound(start.Add(time.Duration(i) * time.Second))
+	}
+	if node, _ := s.Node(1); node.Suspected {
+		t.Errorf("Expected node 1, next to the leader, not to be suspected")
+	}
+	if node, _ := s.Node(2); !node.Suspected {
+		t.Errorf("Expected node 2 to be suspected while its heartbeats are in flight")
+	}
+}
+
+// TestTransactionDuration tests that the simulated commit time of a
+// transaction follows the latency model.
+func TestTransactionDuration(t *testing.T) {
+	s := New(Config{})
+	s.InitTopology([]Region{{Name: "us-east", Nodes: 2}, {Name: "eu-west", Nodes: 1}})
+	writes := []TxWrite{{NodeID: 0, Value: 1}, {NodeID: 1, Value: 2}, {NodeID: 2, Value: 3}}
+
+	tx, err := s.RunTransaction(writes)
+	if err != nil || tx.Duration != 0 {
+		t.Fatalf("Expected an instant commit without latency, got %+v, %v", tx, err)
+	}
+
+	s.SetLatencyModel(LatencyModel{IntraRegion: Duration(10 * time.Millisecond), InterRegion: Duration(100 * time.Millisecond)})
+	tx, _ = s.RunTransaction(writes)
+	if want := Duration(400 * time.Millisecond); tx.Duration != want {
+		t.Errorf("Expected two round trips to eu-west taking %v, got %v", want, tx.Duration)
+	}
+	tx, _ = s.RunTransaction(writes[:2])
+	if want := Duration(40 * time.Millisecond); tx.Duration != want {
+		t.Errorf("Expected two round trips within us-east taking %v, got %v", want, tx.Duration)
+	}
+
+	body := doRequest(t, s.Handler(), "GET", "/metrics", "").Body.String()
+	for _, want := range []string{
+		`sim_transaction_duration_seconds_bucket{le="0.005"} 1`,
+		`sim_transaction_duration_seconds_bucket{le="0.05"} 2`,
+		`sim_transaction_duration_seconds_count 3`,
+		"sim_messages_in_flight 0",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected /metrics to contain %q", want)
+		}
+	}
+}
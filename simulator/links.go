@@ -0,0 +1,99 @@
+package simulator
+
+import (
+	"errors"
+	"fmt"
+)
+
+// link identifies the one-way connection from one node to another.
+type link struct {
+	from, to int
+}
+
+// LinkInfo reports the configured loss rate of every lossy link and how many
+// messages between nodes have been delivered and dropped.
+type LinkInfo struct {
+	// Loss maps a sender ID to receiver IDs to the probability that a
+	// message on that link is lost. Links that are not listed lose nothing.
+	Loss      map[int]map[int]float64 `json:"loss"`
+	Delivered uint64                  `json:"delivered"`
+	Dropped   uint64                  `json:"dropped"`
+}
+
+// Errors returned by SetLinkLoss.
+var (
+	// ErrNodeNotFound means a link endpoint is not an existing node.
+	ErrNodeNotFound = errors.New("node not found")
+
+	// ErrInvalidLink means a link's endpoints or loss rate were rejected.
+	ErrInvalidLink = errors.New("invalid link")
+)
+
+// SetLinkLoss sets the probability that a message sent from node a to node b
+// is lost. Loss is directional: the link from b to a keeps its own rate. A
+// rate of 0 makes the link reliable again. It returns ErrNodeNotFound if
+// either node doesn't exist and an error wrapping ErrInvalidLink if a equals b
+// or loss is outside [0, 1].
+func (s *Simulator) SetLinkLoss(a, b int, loss float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.findNode(a) < 0 || s.findNode(b) < 0 {
+		return ErrNodeNotFound
+	}
+	if a == b {
+		return fmt.Errorf("%w: a node cannot link to itself", ErrInvalidLink)
+	}
+	if loss < 0 || loss > 1 {
+		return fmt.Errorf("%w: loss must be between 0 and 1, got %v", ErrInvalidLink, loss)
+	}
+
+	if loss == 0 {
+		delete(s.linkLoss, link{a, b})
+	} else {
+		s.linkLoss[link{a, b}] = loss
+	}
+	return nil
+}
+
+// Links returns the loss rate of every lossy link and the message counters.
+func (s *Simulator) Links() LinkInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	info := LinkInfo{
+		Loss:      make(map[int]map[int]float64),
+		Delivered: s.delivered,
+		Dropped:   s.dropped,
+	}
+	for l, loss := range s.linkLoss {
+		if info.Loss[l.from] == nil {
+			info.Loss[l.from] = make(map[int]float64)
+		}
+		info.Loss[l.from][l.to] = loss
+	}
+	return info
+}
+
+// deliver reports whether a message from node from to node to survives the
+// link's loss rate, counting it as delivered or dropped. Reliable links don't
+// consume the random source, so seeded runs without loss are unaffected. The
+// caller must hold s.mu for writing.
+func (s *Simulator) deliver(from, to int) bool {
+	if loss := s.linkLoss[link{from, to}]; loss > 0 && s.rng.Float64() < loss {
+		s.dropped++
+		return false
+	}
+	s.delivered++
+	return true
+}
+
+// forgetLinks removes every link to or from the node with the given ID. The
+// caller must hold s.mu for writing.
+func (s *Simulator) forgetLinks(id int) {
+	for l := range s.linkLoss {
+		if l.from == id || l.to == id {
+			delete(s.linkLoss, l)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package simulator
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// TestLinkLossBlocksGossip tests that values don't cross links that lose
+// every message, while the remaining links still converge.
+func TestLinkLossBlocksGossip(t *testing.T) {
+	s := New(Config{Seed: 1, Mode: ModeGossip})
+	s.Init(4)
+	h := s.Handler()
+
+	// Cut every link into node 3; links out of it stay reliable.
+	for _, from := range []int{0, 1, 2} {
+		path := fmt.Sprintf("/links/%d/3", from)
+		if rr := doRequest(t, h, "POST", path, `{"loss":1}`); rr.Code != http.StatusOK {
+			t.Fatalf("POST %s: expected status code %d, but got %d: %s", path, http.StatusOK, rr.Code, rr.Body)
+		}
+	}
+
+	s.SetNode(0, "Node-0", 1234)
+	for i := 0; i < 50; i++ {
+		s.GossipRound()
+	}
+	for _, node := range s.Snapshot() {
+		if node.ID == 3 && node.Value == 1234 {
+			t.Error("Value crossed a link with 100% loss")
+		}
+		if node.ID != 3 && node.Value != 1234 {
+			t.Errorf("Node %d has value %d, expected 1234", node.ID, node.Value)
+		}
+	}
+
+	var info LinkInfo
+	decodeBody(t, doRequest(t, h, "GET", "/links", ""), &info)
+	if info.Loss[0][3] != 1 || info.Loss[3][0] != 0 {
+		t.Errorf("Unexpected loss matrix: %v", info.Loss)
+	}
+	if info.Dropped == 0 || info.Delivered == 0 {
+		t.Errorf("Expected both dropped and delivered messages, got %+v", info)
+	}
+
+	// Loss is directional, so a newer value on node 3 still spreads out.
+	s.SetNode(3, "Node-3", 5678)
+	for i := 0; i < 50 && !s.Convergence().Converged; i++ {
+		s.GossipRound()
+	}
+	if c := s.Convergence(); !c.Converged || c.LatestValue != 5678 {
+		t.Errorf("Expected node 3's value to spread, got %+v", c)
+	}
+}
+
+// TestSetLinkLossValidation tests the errors returned by POST /links/{a}/{b}.
+func TestSetLinkLossValidation(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	tests := []struct {
+		path, body string
+		want       int
+	}{
+		{"/links/0/1", `{"loss":0.3}`, http.StatusOK},
+		{"/links/0/1", `{"loss":1.5}`, http.StatusBadRequest},
+		{"/links/0/0", `{"loss":0.3}`, http.StatusBadRequest},
+		{"/links/0/9", `{"loss":0.3}`, http.StatusNotFound},
+		{"/links/x/1", `{"loss":0.3}`, http.StatusBadRequest},
+		{"/links/0/1", `{}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if rr := doRequest(t, h, "POST", tt.path, tt.body); rr.Code != tt.want {
+			t.Errorf("POST %s %s: expected status code %d, but got %d", tt.path, tt.body, tt.want, rr.Code)
+		}
+	}
+
+	// Setting a loss of 0 removes the link from the matrix, and removing a
+	// node forgets its links.
+	s.SetLinkLoss(1, 2, 0.5)
+	s.SetLinkLoss(0, 1, 0)
+	s.RemoveNode(2)
+	if loss := s.Links().Loss; len(loss) != 0 {
+		t.Errorf("Expected an empty loss matrix, got %v", loss)
+	}
+}
+
+// TestLinkLossBlocksReplication tests that a follower behind a lossy link
+// misses Raft entries until the link recovers.
+func TestLinkLossBlocksReplication(t *testing.T) {
+	s := New(Config{Mode: ModeRaft})
+	s.Init(3)
+
+	s.SetLinkLoss(0, 2, 1)
+	appendCommands(t, s, "a")
+	if nodeLog, _ := s.NodeLog(2); len(nodeLog.Entries) != 0 {
+		t.Errorf("Expected node 2 to miss the entry, got %v", nodeLog.Entries)
+	}
+
+	s.SetLinkLoss(0, 2, 0)
+	appendCommands(t, s, "b")
+	if nodeLog, _ := s.NodeLog(2); len(nodeLog.Entries) != 2 {
+		t.Errorf("Expected node 2 to catch up to 2 entries, got %v", nodeLog.Entries)
+	}
+}
@@ -0,0 +1,406 @@
+package simulator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Load-balancing strategies of the synthetic request generator.
+const (
+	BalanceRoundRobin     = "round-robin"     // Each node in turn.
+	BalanceRandom         = "random"          // A node chosen at random.
+	BalanceLeastLoaded    = "least-loaded"    // The node with the fewest requests in flight.
+	BalanceConsistentHash = "consistent-hash" // The node owning the request's key on the hash ring.
+)
+
+// Defaults of the synthetic request generator.
+const (
+	// DefaultLoadGenKeys is the number of distinct keys requests are spread
+	// over when LoadGenSettings.Keys is unset.
+	DefaultLoadGenKeys = 100
+
+	// loadServiceTime is how long a node takes to serve a request with no
+	// others in flight. Each request already in flight adds as much again.
+	loadServiceTime = 10 * time.Millisecond
+)
+
+// Errors returned by GenerateLoad and StopLoad.
+var (
+	// ErrInvalidLoadGen means the settings of the request generator were
+	// rejected.
+	ErrInvalidLoadGen = errors.New("invalid load generator settings")
+
+	// ErrLoadGenStopped means the request generator is not running.
+	ErrLoadGenStopped = errors.New("simulator: load generator not running")
+)
+
+// balancer picks the node each synthetic request is sent to.
+type balancer interface {
+	// pick returns the index in s.nodes of the node of candidates, which
+	// are node indices in order and never empty, to send a request for key
+	// to at now. s.mu is held for writing.
+	pick(s *Simulator, candidates []int, key string, now time.Time) int
+}
+
+// balancers holds a constructor of every load-balancing strategy by name.
+var balancers = map[string]func() balancer{
+	BalanceRoundRobin:     func() balancer { return &roundRobin{} },
+	BalanceRandom:         func() balancer { return randomBalancer{} },
+	BalanceLeastLoaded:    func() balancer { return leastLoaded{} },
+	BalanceConsistentHash: func() balancer { return consistentHash{} },
+}
+
+// roundRobin sends requests to each candidate in turn.
+type roundRobin struct {
+	next int
+}
+
+func (b *roundRobin) pick(s *Simulator, candidates []int, key string, now time.Time) int {
+	index := candidates[b.next%len(candidates)]
+	b.next++
+	return index
+}
+
+// randomBalancer sends each request to a candidate chosen at random.
+type randomBalancer struct{}
+
+func (randomBalancer) pick(s *Simulator, candidates []int, key string, now time.Time) int {
+	return candidates[s.rng.Intn(len(candidates))]
+}
+
+// leastLoaded sends each request to the candidate with the fewest requests
+// in flight, the first of them on a tie.
+type leastLoaded struct{}
+
+func (leastLoaded) pick(s *Simulator, candidates []int, key string, now time.Time) int {
+	best, bestLoad := -1, 0
+	for _, index := range candidates {
+		if load := s.loadGen.node(s.nodes[index].ID).inFlight(now); best < 0 || load < bestLoad {
+			best, bestLoad = index, load
+		}
+	}
+	return best
+}
+
+// consistentHash sends every request for a key to the same node: the first
+// candidate in the key's order on the hash ring.
+type consistentHash struct{}
+
+func (consistentHash) pick(s *Simulator, candidates []int, key string, now time.Time) int {
+	for _, id := range s.ring.Locate(key, len(s.nodes)) {
+		if index := s.findNode(id); slices.Contains(candidates, index) {
+			return index
+		}
+	}
+	return candidates[0]
+}
+
+// LoadGenSettings configure the synthetic request generator.
+type LoadGenSettings struct {
+	Rate     float64 `json:"rate"`     // Requests per second.
+	Strategy string  `json:"strategy"` // One of the Balance strategies.
+	Keys     int     `json:"keys"`     // Distinct keys requests are spread over.
+
+	// BreakerThreshold is the number of consecutive failed requests to a
+	// node that open its circuit breaker, and BreakerCooldown how long the
+	// breaker stays open before it lets a probe through.
+	BreakerThreshold int      `json:"breaker_threshold"`
+	BreakerCooldown  Duration `json:"breaker_cooldown"`
+}
+
+// validate returns an error wrapping ErrInvalidLoadGen if l is invalid.
+func (l LoadGenSettings) validate() error {
+	if l.Rate <= 0 || math.IsInf(l.Rate, 0) {
+		return fmt.Errorf("%w: rate must be a positive number", ErrInvalidLoadGen)
+	}
+	if _, ok := balancers[l.Strategy]; !ok {
+		return fmt.Errorf("%w: unknown strategy %q, expected round-robin, random, least-loaded, or consistent-hash", ErrInvalidLoadGen, l.Strategy)
+	}
+	if l.Keys < 1 {
+		return fmt.Errorf("%w: keys must be at least 1", ErrInvalidLoadGen)
+	}
+	if l.BreakerThreshold < 1 {
+		return fmt.Errorf("%w: breaker_threshold must be at least 1", ErrInvalidLoadGen)
+	}
+	if l.BreakerCooldown <= 0 {
+		return fmt.Errorf("%w: breaker_cooldown must be positive", ErrInvalidLoadGen)
+	}
+	return nil
+}
+
+// LoadGenStats reports the requests sent by the synthetic request generator
+// since it was last started.
+type LoadGenStats struct {
+	Running bool `json:"running"`
+	LoadGenSettings
+	Requests       uint64 `json:"requests"`
+	Errors         uint64 `json:"errors"`          // Requests sent to a node that was down.
+	Rejected       uint64 `json:"rejected"`        // Requests refused by an overloaded node.
+	ShortCircuited uint64 `json:"short_circuited"` // Requests failed at once by an open circuit breaker.
+
+	// Latency describes the latencies of the most recent successful
+	// requests.
+	Latency LatencyPercentiles `json:"latency"`
+
+	Nodes []NodeLoad `json:"nodes"` // Nodes sent requests, by ID.
+}
+
+// NodeLoad is the share of the synthetic requests one node was sent.
+type NodeLoad struct {
+	ID             int     `json:"id"`
+	Requests       uint64  `json:"requests"`
+	Errors         uint64  `json:"errors"`
+	Rejected       uint64  `json:"rejected"`
+	ShortCircuited uint64  `json:"short_circuited"`
+	InFlight       int     `json:"in_flight"`
+	Share          float64 `json:"share"` // Fraction of all requests sent to the node.
+}
+
+// nodeLoad is the load the request generator has put on one node.
+type nodeLoad struct {
+	requests, errors, rejected, shortCircuited uint64
+	done                                       []time.Time // When each request in flight completes.
+	breaker                                    breaker
+}
+
+// inFlight returns the number of requests still in flight at now, dropping
+// those that have completed.
+func (n *nodeLoad) inFlight(now time.Time) int {
+	n.done = slices.DeleteFunc(n.done, func(t time.Time) bool { return !t.After(now) })
+	return len(n.done)
+}
+
+// loadGen is the state of the synthetic request generator.
+type loadGen struct {
+	running  bool
+	settings LoadGenSettings
+	balancer balancer
+	credit   float64   // Fraction of a request the generator is partway through.
+	last     time.Time // Time of the last round.
+
+	requests, errors, rejected, shortCircuited uint64
+	nodes                                      map[int]*nodeLoad
+	latencies                                  durationRing
+	transitions                                map[string]uint64 // Circuit breaker transitions by the state entered.
+}
+
+// node returns the load on the node with the given ID, creating it if
+// needed.
+func (g *loadGen) node(id int) *nodeLoad {
+	if g.nodes == nil {
+		g.nodes = make(map[int]*nodeLoad)
+	}
+	n := g.nodes[id]
+	if n == nil {
+		n = &nodeLoad{breaker: breaker{state: BreakerClosed}}
+		g.nodes[id] = n
+	}
+	return n
+}
+
+// GenerateLoad starts sending synthetic requests with the given settings,
+// discarding the stats and circuit breakers of the last run. Zero Keys,
+// BreakerThreshold, and BreakerCooldown mean DefaultLoadGenKeys,
+// DefaultBreakerThreshold, and DefaultBreakerCooldown. If the generator is
+// already running, it carries on with the new settings. It returns an error
+// wrapping ErrInvalidLoadGen if settings is invalid.
+func (s *Simulator) GenerateLoad(settings LoadGenSettings) (LoadGenStats, error) {
+	if settings.Keys == 0 {
+		settings.Keys = DefaultLoadGenKeys
+	}
+	if settings.BreakerThreshold == 0 {
+		settings.BreakerThreshold = DefaultBreakerThreshold
+	}
+	if settings.BreakerCooldown == 0 {
+		settings.BreakerCooldown = Duration(DefaultBreakerCooldown)
+	}
+	if err := settings.validate(); err != nil {
+		return LoadGenStats{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.loadGen = loadGen{
+		running:  true,
+		settings: settings,
+		balancer: balancers[settings.Strategy](),
+		last:     s.cfg.Clock.Now(),
+	}
+	s.logger.Info("load generator started", "rate", settings.Rate, "strategy", settings.Strategy, "keys", settings.Keys)
+	return s.loadGenStats(), nil
+}
+
+// StopLoad stops sending synthetic requests, keeping the stats of the run.
+// It returns ErrLoadGenStopped if the generator is not running.
+func (s *Simulator) StopLoad() (LoadGenStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.loadGen.running {
+		return LoadGenStats{}, ErrLoadGenStopped
+	}
+	s.loadGen.running = false
+	s.logger.Info("load generator stopped", "requests", s.loadGen.requests, "errors", s.loadGen.errors)
+	return s.loadGenStats(), nil
+}
+
+// StartLoadGen runs a load generator round once per interval until ctx is
+// cancelled. It blocks, so callers typically run it in its own goroutine.
+func (s *Simulator) StartLoadGen(ctx context.Context, interval time.Duration) {
+	ticker := s.cfg.Clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			s.LoadGenRound()
+		}
+	}
+}
+
+// LoadGenRound sends the synthetic requests due since the last round, if the
+// generator is running, spread evenly over that time. Each goes to a node the
+// failure detector doesn't suspect, chosen by the strategy; if every node is
+// suspected, to any node. A request to a node whose circuit breaker is open
+// fails at once, and one to a node that is down or overloaded fails and
+// counts towards opening the breaker. Otherwise it takes the service time
+// once for itself and once more for every request already in flight on the
+// node, slowed down the closer the node is to its CPU limit, on top of the
+// node's latency. Each request served costs the node the service time of
+// CPU; see ResourceRound.
+func (s *Simulator) LoadGenRound() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := &s.loadGen
+	now := s.cfg.Clock.Now()
+	if !g.running || len(s.nodes) == 0 || !now.After(g.last) {
+		return
+	}
+	elapsed := now.Sub(g.last)
+	g.credit += g.settings.Rate * elapsed.Seconds()
+	n := int(g.credit)
+	g.credit -= float64(n)
+
+	var candidates []int
+	for i := range s.nodes {
+		if !s.nodes[i].Suspected {
+			candidates = append(candidates, i)
+		}
+	}
+	if len(candidates) == 0 {
+		for i := range s.nodes {
+			candidates = append(candidates, i)
+		}
+	}
+	for i := 0; i < n; i++ {
+		at := g.last.Add(elapsed * time.Duration(i+1) / time.Duration(n))
+		key := "key-" + strconv.Itoa(s.rng.Intn(g.settings.Keys))
+		node := &s.nodes[g.balancer.pick(s, candidates, key, at)]
+		load := g.node(node.ID)
+		g.requests++
+		load.requests++
+		if !s.allowRequest(node.ID, &load.breaker, at) {
+			g.shortCircuited++
+			load.shortCircuited++
+			continue
+		}
+		s.recordResult(node.ID, &load.breaker, node.Status == StatusUp && !node.Resources.Overloaded, at)
+		if node.Status != StatusUp {
+			g.errors++
+			load.errors++
+			continue
+		}
+		if node.Resources.Overloaded {
+			g.rejected++
+			load.rejected++
+			continue
+		}
+		service := time.Duration(float64(loadServiceTime) * s.overloadSlowdown(node.Resources))
+		latency := service*time.Duration(1+load.inFlight(at)) + time.Duration(node.Latency)
+		load.done = append(load.done, at.Add(latency))
+		s.usage.charge(node.ID, loadServiceTime)
+		g.latencies.add(latency)
+	}
+	g.last = now
+}
+
+// loadGenStats returns the stats of the request generator. The caller must
+// hold s.mu for writing, as reading the load drops completed requests.
+func (s *Simulator) loadGenStats() LoadGenStats {
+	g := &s.loadGen
+	stats := LoadGenStats{
+		Running:         g.running,
+		LoadGenSettings: g.settings,
+		Requests:        g.requests,
+		Errors:          g.errors,
+		Rejected:        g.rejected,
+		ShortCircuited:  g.shortCircuited,
+		Latency:         latencyPercentiles(slices.Clone(g.latencies.samples)),
+		Nodes:           []NodeLoad{},
+	}
+	now := s.cfg.Clock.Now()
+	for id, n := range g.nodes {
+		load := NodeLoad{ID: id, Requests: n.requests, Errors: n.errors, Rejected: n.rejected, ShortCircuited: n.shortCircuited, InFlight: n.inFlight(now)}
+		if g.requests > 0 {
+			load.Share = float64(n.requests) / float64(g.requests)
+		}
+		stats.Nodes = append(stats.Nodes, load)
+	}
+	sort.Slice(stats.Nodes, func(i, j int) bool { return stats.Nodes[i].ID < stats.Nodes[j].ID })
+	return stats
+}
+
+// LoadGenStats returns the stats of the synthetic request generator's
+// current or last run.
+func (s *Simulator) LoadGenStats() LoadGenStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.loadGenStats()
+}
+
+// startLoadGen handles HTTP requests to start the synthetic request
+// generator from a body like {"rate":100,"strategy":"least-loaded"}.
+func (s *Simulator) startLoadGen(w http.ResponseWriter, r *http.Request) {
+	var payload LoadGenSettings
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "Malformed JSON body")
+		return
+	}
+
+	stats, err := s.GenerateLoad(payload)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// stopLoadGen handles HTTP requests to stop the synthetic request generator.
+func (s *Simulator) stopLoadGen(w http.ResponseWriter, r *http.Request) {
+	stats, err := s.StopLoad()
+	if err != nil {
+		writeError(w, http.StatusConflict, "The load generator is not running")
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// getLoadGenStats handles HTTP requests for the stats of the synthetic
+// request generator.
+func (s *Simulator) getLoadGenStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.LoadGenStats())
+}
@@ -0,0 +1,150 @@
+package simulator
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// runLoadGen steps clock and runs a load generator round n times.
+func runLoadGen(t *testing.T, s *Simulator, clock *VirtualClock, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := clock.Step(); err != nil {
+			t.Fatalf("Step failed: %v", err)
+		}
+		s.LoadGenRound()
+	}
+}
+
+// TestLoadGenRoundRobin tests that round-robin spreads requests evenly and
+// that requests to a node that is down fail.
+func TestLoadGenRoundRobin(t *testing.T) {
+	clock := latencyClock(t)
+	s := New(Config{Clock: clock, Seed: 1})
+	s.Init(5)
+	h := s.Handler()
+
+	expectCode(t, doRequest(t, h, "POST", "/loadgen/stop", ""), http.StatusConflict)
+	expectCode(t, doRequest(t, h, "POST", "/loadgen/start", `{"rate":100,"strategy":"round-robin"}`), http.StatusOK)
+	runLoadGen(t, s, clock, 2)
+
+	var stats LoadGenStats
+	decodeBody(t, doRequest(t, h, "GET", "/loadgen/stats", ""), &stats)
+	if !stats.Running || stats.Requests != 200 || stats.Errors != 0 || len(stats.Nodes) != 5 {
+		t.Fatalf("Expected 200 requests over 5 nodes, got %+v", stats)
+	}
+	for _, n := range stats.Nodes {
+		if n.Requests != 40 || n.Share != 0.2 {
+			t.Errorf("Expected node %d to get 40 requests, got %+v", n.ID, n)
+		}
+	}
+	if stats.Latency.P50 <= 0 || stats.Latency.P50 > stats.Latency.Max {
+		t.Errorf("Expected positive latencies, got %+v", stats.Latency)
+	}
+
+	// Until the detector suspects it, a failed node still gets its share.
+	// The first 5 of those requests fail and open its circuit breaker, which
+	// fails the rest at once.
+	s.Fail(0)
+	runLoadGen(t, s, clock, 1)
+	stats = s.LoadGenStats()
+	if got := stats.Nodes[0]; stats.Errors != 5 || got.Errors != 5 || got.ShortCircuited != 15 || stats.Nodes[1].Errors != 0 {
+		t.Errorf("Expected 5 of the 20 requests to node 0 to fail and the rest to short-circuit, got %+v", stats)
+	}
+
+	rr := doRequest(t, h, "POST", "/loadgen/stop", "")
+	expectCode(t, rr, http.StatusOK)
+	runLoadGen(t, s, clock, 1)
+	if stats := s.LoadGenStats(); stats.Running || stats.Requests != 300 {
+		t.Errorf("Expected no requests once stopped, got %+v", stats)
+	}
+
+	for _, body := range []string{
+		`{"rate":0,"strategy":"random"}`,
+		`{"rate":10,"strategy":"fastest"}`,
+		`{"rate":10,"strategy":"random","keys":-1}`,
+		`{"rate":10,"strategy":"random","breaker_threshold":-1}`,
+		`{"rate":10,"strategy":"random","breaker_cooldown":"-1s"}`,
+		`{"rate":10,"strategy":"random","burst":5}`,
+	} {
+		expectCode(t, doRequest(t, h, "POST", "/loadgen/start", body), http.StatusBadRequest)
+	}
+}
+
+// TestLoadGenConsistentHash tests that consistent hashing sends every request
+// for a key to the same node and that least-loaded skips suspected nodes.
+func TestLoadGenConsistentHash(t *testing.T) {
+	clock := latencyClock(t)
+	s := New(Config{Clock: clock, Seed: 1})
+	s.Init(5)
+
+	if _, err := s.GenerateLoad(LoadGenSettings{Rate: 50, Strategy: BalanceConsistentHash, Keys: 1}); err != nil {
+		t.Fatalf("GenerateLoad failed: %v", err)
+	}
+	runLoadGen(t, s, clock, 3)
+	stats := s.LoadGenStats()
+	owner := s.Locate("key-0")[0]
+	if len(stats.Nodes) != 1 || stats.Nodes[0].ID != owner || stats.Nodes[0].Requests != 150 {
+		t.Errorf("Expected all 150 requests to go to node %d, got %+v", owner, stats.Nodes)
+	}
+
+	s.mu.Lock()
+	s.nodes[s.findNode(owner)].Suspected = true
+	s.mu.Unlock()
+	if _, err := s.GenerateLoad(LoadGenSettings{Rate: 50, Strategy: BalanceLeastLoaded}); err != nil {
+		t.Fatalf("GenerateLoad failed: %v", err)
+	}
+	runLoadGen(t, s, clock, 1)
+	for _, n := range s.LoadGenStats().Nodes {
+		if n.ID == owner {
+			t.Errorf("Expected the suspected node to get no requests, got %+v", n)
+		}
+	}
+}
+
+// TestLoadGenBreaker tests that a node's circuit breaker opens after the
+// threshold of consecutive failures and closes after a successful probe once
+// the node recovers.
+func TestLoadGenBreaker(t *testing.T) {
+	clock := latencyClock(t)
+	s := New(Config{Clock: clock})
+	s.Init(2)
+	h := s.Handler()
+
+	// Node 0 gets every other request, 5 a second.
+	expectCode(t, doRequest(t, h, "POST", "/loadgen/start", `{"rate":10,"strategy":"round-robin","breaker_threshold":3,"breaker_cooldown":"2s"}`), http.StatusOK)
+	s.Fail(0)
+	runLoadGen(t, s, clock, 1)
+
+	var breakers []Breaker
+	decodeBody(t, doRequest(t, h, "GET", "/loadgen/breakers", ""), &breakers)
+	if len(breakers) != 2 || breakers[0].State != BreakerOpen || breakers[0].Failures != 3 || breakers[0].ShortCircuited != 2 {
+		t.Fatalf("Expected node 0's breaker to open after 3 failures, got %+v", breakers)
+	}
+	if breakers[1].State != BreakerClosed || breakers[1].Failures != 0 {
+		t.Errorf("Expected node 1's breaker to stay closed, got %+v", breakers[1])
+	}
+
+	// The breaker stays open for the cool-down even once the node recovers,
+	// then the probe succeeds and closes it.
+	s.Recover(0)
+	runLoadGen(t, s, clock, 1)
+	if b := s.Breakers()[0]; b.State != BreakerOpen {
+		t.Errorf("Expected the breaker to stay open during the cool-down, got %+v", b)
+	}
+	runLoadGen(t, s, clock, 1)
+	if b := s.Breakers()[0]; b.State != BreakerClosed || b.Failures != 0 || b.Opens != 1 {
+		t.Errorf("Expected the probe to close the breaker, got %+v", b)
+	}
+	if stats := s.LoadGenStats(); stats.Errors != 3 || stats.ShortCircuited != 9 {
+		t.Errorf("Expected 3 failures and 9 short-circuited requests, got %+v", stats)
+	}
+
+	body := doRequest(t, h, "GET", "/metrics", "").Body.String()
+	for _, state := range []string{BreakerOpen, BreakerHalfOpen, BreakerClosed} {
+		if want := `sim_loadgen_breaker_transitions_total{state="` + state + `"} 1`; !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q", want)
+		}
+	}
+}
@@ -0,0 +1,338 @@
+package simulator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultLockTTL is how long a lease lasts when an acquire sets no TTL.
+const DefaultLockTTL = 10 * time.Second
+
+// lockPollInterval is how often, in simulation time, an acquire waiting for a
+// lock checks whether the lease holding it has expired.
+const lockPollInterval = 100 * time.Millisecond
+
+// lockCommandPrefix starts the Raft log commands that change the lock table.
+const lockCommandPrefix = "lock "
+
+// Errors returned by AcquireLock and ReleaseLock.
+var (
+	// ErrLockHeld means a lock is leased to another owner.
+	ErrLockHeld = errors.New("lock is held by another owner")
+
+	// ErrLockNotHeld means a lock released is not leased to anyone.
+	ErrLockNotHeld = errors.New("lock is not held")
+
+	// ErrInvalidLock means a lock request was rejected.
+	ErrInvalidLock = errors.New("invalid lock request")
+)
+
+// Lease is an owner's hold on a named lock until it expires or is released.
+type Lease struct {
+	Name      string    `json:"name"`
+	Owner     string    `json:"owner"`
+	Token     uint64    `json:"token"`  // Increases with every lease granted, to fence off earlier holders.
+	Leader    int       `json:"leader"` // ID of the leader that granted or last renewed the lease.
+	Acquired  time.Time `json:"acquired"`
+	Expires   time.Time `json:"expires"`
+	Remaining Duration  `json:"remaining"` // Time left on the simulation clock.
+}
+
+// lockCommand is a change to the lock table, replicated as a Raft log
+// command in raft mode.
+type lockCommand struct {
+	Op    string `json:"op"` // "acquire" or "release".
+	Lease Lease  `json:"lease"`
+}
+
+// lockTable is the lock manager's state: the leases granted and the
+// acquires waiting for one to end.
+type lockTable struct {
+	leases map[string]Lease // Leases by lock name.
+	tokens uint64           // Token of the last lease granted.
+	freed  chan struct{}    // Closed when a lease ends, then replaced; nil until waited on.
+}
+
+// AcquireLock leases the lock name to owner for ttl on the simulation clock,
+// granted by the current leader. An owner acquiring a lock it holds renews
+// the lease. If another owner holds the lock, AcquireLock waits up to wait
+// for the lease to be released or expire, and then returns an error wrapping
+// ErrLockHeld. In raft mode the lease is granted through the Raft log, so it
+// only takes effect once a majority holds it and survives a change of
+// leader; elsewhere the lock table is shared by every node. It returns an
+// error wrapping ErrInvalidLock for an empty name or owner, a TTL that is not
+// positive, or a negative wait, ErrNoLeader if no leader is elected, an error
+// wrapping ErrQuorumUnavailable if the lease could not be committed, and
+// ctx's error if it is done first.
+func (s *Simulator) AcquireLock(ctx context.Context, name, owner string, ttl, wait time.Duration) (Lease, error) {
+	switch {
+	case name == "" || owner == "":
+		return Lease{}, fmt.Errorf("%w: name and owner are required", ErrInvalidLock)
+	case ttl <= 0:
+		return Lease{}, fmt.Errorf("%w: TTL must be positive", ErrInvalidLock)
+	case wait < 0:
+		return Lease{}, fmt.Errorf("%w: wait must not be negative", ErrInvalidLock)
+	}
+
+	deadline := s.cfg.Clock.Now().Add(wait)
+	var poll Ticker
+	for {
+		lease, freed, err := s.tryAcquire(name, owner, ttl)
+		if !errors.Is(err, ErrLockHeld) || !s.cfg.Clock.Now().Before(deadline) {
+			return lease, err
+		}
+		if poll == nil {
+			poll = s.cfg.Clock.NewTicker(lockPollInterval)
+			defer poll.Stop()
+		}
+		select {
+		case <-ctx.Done():
+			return Lease{}, ctx.Err()
+		case <-freed:
+		case <-poll.C():
+		}
+	}
+}
+
+// tryAcquire makes one attempt of AcquireLock. If the lock is held, it
+// returns the holder's lease and a channel closed once a lease ends.
+func (s *Simulator) tryAcquire(name, owner string, ttl time.Duration) (Lease, <-chan struct{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	leader := s.topLeader()
+	if leader < 0 {
+		return Lease{}, nil, ErrNoLeader
+	}
+	now := s.cfg.Clock.Now()
+	s.expireLocks(now)
+
+	lease, held := s.locks.leases[name]
+	switch {
+	case held && lease.Owner != owner:
+		if s.locks.freed == nil {
+			s.locks.freed = make(chan struct{})
+		}
+		return leaseAt(lease, now), s.locks.freed, fmt.Errorf("%w: %s holds %q for %v", ErrLockHeld, lease.Owner, name, lease.Expires.Sub(now))
+	case !held:
+		s.locks.tokens++
+		lease = Lease{Name: name, Owner: owner, Token: s.locks.tokens, Acquired: now}
+	}
+	lease.Leader, lease.Expires = s.nodes[leader].ID, now.Add(ttl)
+
+	if err := s.changeLocks(lockCommand{Op: "acquire", Lease: lease}); err != nil {
+		return Lease{}, nil, err
+	}
+	s.logger.Info("lock acquired", "lock", name, "owner", owner, "token", lease.Token, "expires", lease.Expires)
+	return leaseAt(lease, now), nil, nil
+}
+
+// ReleaseLock releases the lease owner holds on the lock name, through the
+// Raft log in raft mode. It returns an error wrapping ErrLockNotHeld if
+// nobody holds the lock, one wrapping ErrLockHeld if another owner does,
+// ErrNoLeader if no leader is elected, and an error wrapping
+// ErrQuorumUnavailable if the release could not be committed.
+func (s *Simulator) ReleaseLock(name, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.topLeader() < 0 {
+		return ErrNoLeader
+	}
+	s.expireLocks(s.cfg.Clock.Now())
+	lease, held := s.locks.leases[name]
+	switch {
+	case !held:
+		return fmt.Errorf("%w: %q", ErrLockNotHeld, name)
+	case lease.Owner != owner:
+		return fmt.Errorf("%w: %s holds %q", ErrLockHeld, lease.Owner, name)
+	}
+	if err := s.changeLocks(lockCommand{Op: "release", Lease: lease}); err != nil {
+		return err
+	}
+	s.logger.Info("lock released", "lock", name, "owner", owner, "token", lease.Token)
+	return nil
+}
+
+// changeLocks applies cmd to the lock table, in raft mode by appending it to
+// the Raft log and applying it once committed. The caller must hold s.mu for
+// writing.
+func (s *Simulator) changeLocks(cmd lockCommand) error {
+	if s.Mode() != ModeRaft {
+		s.applyLock(cmd)
+		return nil
+	}
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+	_, err = s.appendCommand(lockCommandPrefix + string(data))
+	return err
+}
+
+// applyCommitted applies the lock commands among entries, which have just
+// been committed, in order. The caller must hold s.mu for writing.
+func (s *Simulator) applyCommitted(entries []LogEntry) {
+	for _, entry := range entries {
+		data, ok := strings.CutPrefix(entry.Command, lockCommandPrefix)
+		if !ok {
+			continue
+		}
+		var cmd lockCommand
+		if err := json.Unmarshal([]byte(data), &cmd); err != nil {
+			s.logger.Warn("malformed lock command", "index", entry.Index, "error", err)
+			continue
+		}
+		s.applyLock(cmd)
+	}
+}
+
+// applyLock applies cmd to the lock table. An acquire is ignored if another
+// owner's lease has been applied since it was proposed, and a release if the
+// lease released has been replaced. The caller must hold s.mu for writing.
+func (s *Simulator) applyLock(cmd lockCommand) {
+	lease := cmd.Lease
+	current, held := s.locks.leases[lease.Name]
+	switch cmd.Op {
+	case "acquire":
+		if held && current.Token != lease.Token && s.cfg.Clock.Now().Before(current.Expires) {
+			return
+		}
+		if s.locks.leases == nil {
+			s.locks.leases = make(map[string]Lease)
+		}
+		s.locks.leases[lease.Name] = lease
+		s.locks.tokens = max(s.locks.tokens, lease.Token)
+	case "release":
+		if held && current.Token == lease.Token {
+			delete(s.locks.leases, lease.Name)
+			s.freeLocks()
+		}
+	}
+}
+
+// expireLocks drops the leases that have expired by now. The caller must
+// hold s.mu for writing.
+func (s *Simulator) expireLocks(now time.Time) {
+	for name, lease := range s.locks.leases {
+		if !now.Before(lease.Expires) {
+			delete(s.locks.leases, name)
+			s.logger.Info("lock lease expired", "lock", name, "owner", lease.Owner, "token", lease.Token)
+			s.freeLocks()
+		}
+	}
+}
+
+// freeLocks wakes the acquires waiting for a lease to end. The caller must
+// hold s.mu for writing.
+func (s *Simulator) freeLocks() {
+	if s.locks.freed != nil {
+		close(s.locks.freed)
+		s.locks.freed = nil
+	}
+}
+
+// leaseAt returns lease with the time it has left at now.
+func leaseAt(lease Lease, now time.Time) Lease {
+	lease.Remaining = Duration(lease.Expires.Sub(now))
+	return lease
+}
+
+// Locks returns the leases that have yet to expire, by lock name.
+func (s *Simulator) Locks() []Lease {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := s.cfg.Clock.Now()
+	leases := make([]Lease, 0, len(s.locks.leases))
+	for _, lease := range s.locks.leases {
+		if now.Before(lease.Expires) {
+			leases = append(leases, leaseAt(lease, now))
+		}
+	}
+	sort.Slice(leases, func(i, j int) bool { return leases[i].Name < leases[j].Name })
+	return leases
+}
+
+// durationParam returns the duration query parameter name, or fallback if it
+// is absent.
+func durationParam(values url.Values, name string, fallback time.Duration) (time.Duration, error) {
+	if !values.Has(name) {
+		return fallback, nil
+	}
+	return time.ParseDuration(values.Get(name))
+}
+
+// acquireLock handles HTTP requests to lease a lock to the owner query
+// parameter for ttl (default 10s), waiting up to wait (default 0) if another
+// owner holds it.
+func (s *Simulator) acquireLock(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	owner := values.Get("owner")
+	if owner == "" {
+		writeError(w, http.StatusBadRequest, "Query parameter \"owner\" is required")
+		return
+	}
+	ttl, err := durationParam(values, "ttl", DefaultLockTTL)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Query parameter \"ttl\" must be a duration")
+		return
+	}
+	wait, err := durationParam(values, "wait", 0)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Query parameter \"wait\" must be a duration")
+		return
+	}
+
+	lease, err := s.AcquireLock(r.Context(), r.PathValue("name"), owner, ttl, wait)
+	switch {
+	case errors.Is(err, ErrInvalidLock):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrLockHeld):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, ErrNoLeader), errors.Is(err, ErrQuorumUnavailable):
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+	case r.Context().Err() != nil:
+		// The client has gone.
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, lease)
+	}
+}
+
+// releaseLock handles HTTP requests to release the lease the owner query
+// parameter holds on a lock.
+func (s *Simulator) releaseLock(w http.ResponseWriter, r *http.Request) {
+	owner := r.URL.Query().Get("owner")
+	if owner == "" {
+		writeError(w, http.StatusBadRequest, "Query parameter \"owner\" is required")
+		return
+	}
+
+	err := s.ReleaseLock(r.PathValue("name"), owner)
+	switch {
+	case errors.Is(err, ErrLockNotHeld):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, ErrLockHeld):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, ErrNoLeader), errors.Is(err, ErrQuorumUnavailable):
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// getLocks handles HTTP requests to list the current lease holders.
+func (s *Simulator) getLocks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Locks())
+}
@@ -0,0 +1,134 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// acquireLater acquires name for owner in the background, waiting up to
+// wait, and returns a channel delivering the error once it is done.
+func acquireLater(s *Simulator, name, owner string, wait time.Duration) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.AcquireLock(context.Background(), name, owner, 10*time.Second, wait)
+		done <- err
+	}()
+	return done
+}
+
+// stepUntil steps clock until done delivers an error, and returns it.
+func stepUntil(t *testing.T, clock *VirtualClock, done <-chan error) error {
+	t.Helper()
+	for i := 0; i < 1000; i++ {
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(5 * time.Millisecond):
+		}
+		if err := clock.Step(); err != nil {
+			t.Fatalf("Step failed: %v", err)
+		}
+	}
+	t.Fatal("Timed out waiting for the acquire")
+	return nil
+}
+
+// TestLocks tests contention for a lock, renewing, releasing, and leases
+// expiring on the simulation clock.
+func TestLocks(t *testing.T) {
+	clock := latencyClock(t)
+	s := New(Config{Clock: clock})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	var lease Lease
+	rr := doRequest(t, h, "POST", "/locks/jobs/acquire?owner=c1&ttl=10s", "")
+	expectCode(t, rr, http.StatusOK)
+	decodeBody(t, rr, &lease)
+	if lease.Owner != "c1" || lease.Token != 1 || lease.Leader != 0 || lease.Remaining != Duration(10*time.Second) {
+		t.Fatalf("Expected c1 to lease the lock for 10s from node 0, got %+v", lease)
+	}
+	expectCode(t, doRequest(t, h, "POST", "/locks/jobs/acquire?owner=c2", ""), http.StatusConflict)
+	expectCode(t, doRequest(t, h, "POST", "/locks/jobs/release?owner=c2", ""), http.StatusConflict)
+	for _, query := range []string{"", "?owner=c2&ttl=0s", "?owner=c2&ttl=soon", "?owner=c2&wait=-1s"} {
+		expectCode(t, doRequest(t, h, "POST", "/locks/jobs/acquire"+query, ""), http.StatusBadRequest)
+	}
+
+	// Renewing keeps the token and restarts the TTL.
+	clock.Step()
+	rr = doRequest(t, h, "POST", "/locks/jobs/acquire?owner=c1&ttl=3s", "")
+	decodeBody(t, rr, &lease)
+	if lease.Token != 1 || lease.Remaining != Duration(3*time.Second) {
+		t.Errorf("Expected the renewal to keep token 1 for 3s, got %+v", lease)
+	}
+	var leases []Lease
+	decodeBody(t, doRequest(t, h, "GET", "/locks", ""), &leases)
+	if len(leases) != 1 || leases[0].Name != "jobs" || leases[0].Owner != "c1" {
+		t.Fatalf("Expected c1 to hold the one lease, got %+v", leases)
+	}
+
+	// A waiter gets the lock once the lease expires, 3s later.
+	if err := stepUntil(t, clock, acquireLater(s, "jobs", "c2", time.Minute)); err != nil {
+		t.Fatalf("Expected c2 to get the lock once the lease expired, got %v", err)
+	}
+	if leases := s.Locks(); len(leases) != 1 || leases[0].Owner != "c2" || leases[0].Token != 2 {
+		t.Fatalf("Expected c2 to hold the lock with token 2, got %+v", leases)
+	}
+
+	// A waiter whose wait runs out first is refused, and one waiting on a
+	// release gets the lock at once.
+	if err := stepUntil(t, clock, acquireLater(s, "jobs", "c3", time.Second)); !errors.Is(err, ErrLockHeld) {
+		t.Errorf("Expected c3 to give up waiting, got %v", err)
+	}
+	done := acquireLater(s, "jobs", "c3", time.Minute)
+	time.Sleep(10 * time.Millisecond)
+	expectCode(t, doRequest(t, h, "POST", "/locks/jobs/release?owner=c2", ""), http.StatusNoContent)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected c3 to get the released lock, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the release to wake c3")
+	}
+	expectCode(t, doRequest(t, h, "POST", "/locks/jobs/release?owner=c3", ""), http.StatusNoContent)
+	expectCode(t, doRequest(t, h, "POST", "/locks/jobs/release?owner=c3", ""), http.StatusNotFound)
+}
+
+// TestLocksFailover tests that leases granted through the Raft log survive
+// a change of leader and still expire on time, and that no lease is granted
+// without a leader.
+func TestLocksFailover(t *testing.T) {
+	clock := latencyClock(t)
+	s := New(Config{Clock: clock, Mode: ModeRaft})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	expectCode(t, doRequest(t, h, "POST", "/locks/jobs/acquire?owner=c1&ttl=30s", ""), http.StatusOK)
+	expectCode(t, doRequest(t, h, "POST", "/locks/cron/acquire?owner=c2&ttl=2s", ""), http.StatusOK)
+	if log := s.CommittedLog(); len(log.Entries) != 2 {
+		t.Fatalf("Expected both leases in the committed log, got %+v", log.Entries)
+	}
+
+	s.Fail(0)
+	if leader, _ := s.Leader(); leader.ID != 1 {
+		t.Fatalf("Expected node 1 to take over, got %+v", leader)
+	}
+	expectCode(t, doRequest(t, h, "POST", "/locks/jobs/acquire?owner=c3", ""), http.StatusConflict)
+	clock.Step()
+	clock.Step()
+	leases := s.Locks()
+	if len(leases) != 1 || leases[0].Name != "jobs" || leases[0].Leader != 0 {
+		t.Fatalf("Expected only node 0's 30s lease to outlive the 2s one, got %+v", leases)
+	}
+	expectCode(t, doRequest(t, h, "POST", "/locks/jobs/release?owner=c1", ""), http.StatusNoContent)
+
+	// Without a majority no node leads, so no lease can be granted.
+	if err := s.SetPartition([][]int{{1, 2}, {3, 4}}); err != nil {
+		t.Fatalf("SetPartition failed: %v", err)
+	}
+	expectCode(t, doRequest(t, h, "POST", "/locks/jobs/acquire?owner=c3", ""), http.StatusServiceUnavailable)
+}
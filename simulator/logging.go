@@ -0,0 +1,33 @@
+package simulator
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// withLogging logs the method, path, status, duration, remote address, and
+// request ID of every request passed to next once it has been served.
+func (s *Simulator) withLogging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.code == 0 {
+			rec.code = http.StatusOK
+		}
+
+		level := slog.LevelInfo
+		if rec.code >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		s.logger.LogAttrs(r.Context(), level, "http request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.code),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("remote_addr", r.RemoteAddr),
+			slog.String("request_id", RequestIDFromContext(r.Context())),
+		)
+	})
+}
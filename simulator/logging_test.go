@@ -0,0 +1,101 @@
+package simulator
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+)
+
+// captureHandler is a slog.Handler that keeps every record it handles.
+type captureHandler struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (h *captureHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *captureHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, r)
+	return nil
+}
+
+func (h *captureHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h *captureHandler) WithGroup(string) slog.Handler { return h }
+
+// find returns the attributes of the first record with the given message and
+// false if there is none.
+func (h *captureHandler) find(message string) (map[string]slog.Value, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, r := range h.records {
+		if r.Message != message {
+			continue
+		}
+		attrs := make(map[string]slog.Value)
+		r.Attrs(func(a slog.Attr) bool {
+			attrs[a.Key] = a.Value
+			return true
+		})
+		return attrs, true
+	}
+	return nil, false
+}
+
+// TestRequestLogging tests that every request is logged with its method,
+// path, status, duration, and remote address.
+func TestRequestLogging(t *testing.T) {
+	capture := &captureHandler{}
+	s := New(Config{Logger: slog.New(capture)})
+	s.Init(testNodeCount)
+
+	doRequest(t, s.Handler(), "GET", "/nodes/99", "")
+
+	attrs, ok := capture.find("http request")
+	if !ok {
+		t.Fatal("No request was logged")
+	}
+	for key, want := range map[string]string{"method": "GET", "path": "/nodes/99", "status": "404"} {
+		if got := attrs[key].String(); got != want {
+			t.Errorf("Expected %s=%s, got %q", key, want, got)
+		}
+	}
+	for _, key := range []string{"duration", "remote_addr"} {
+		if _, ok := attrs[key]; !ok {
+			t.Errorf("Expected the request log to have %s", key)
+		}
+	}
+}
+
+// TestLifecycleLogging tests that node updates, failures, and recoveries
+// are logged with the node's ID and value.
+func TestLifecycleLogging(t *testing.T) {
+	capture := &captureHandler{}
+	s := New(Config{Logger: slog.New(capture)})
+	s.Init(testNodeCount)
+
+	s.Update()
+	s.Fail(3)
+	s.Recover(3)
+
+	for _, message := range []string{"node updated", "node failed", "node recovered"} {
+		attrs, ok := capture.find(message)
+		if !ok {
+			t.Errorf("Expected a %q record", message)
+			continue
+		}
+		if _, ok := attrs["node_id"]; !ok {
+			t.Errorf("%q: expected a node_id attribute", message)
+		}
+		if _, ok := attrs["value"]; !ok {
+			t.Errorf("%q: expected a value attribute", message)
+		}
+	}
+	if attrs, _ := capture.find("node failed"); attrs["node_id"].Int64() != 3 {
+		t.Errorf("Expected the failure of node 3 to be logged, got node_id=%v", attrs["node_id"])
+	}
+}
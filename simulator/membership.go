@@ -0,0 +1,362 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Membership states of a node.
+const (
+	MemberJoining = "joining" // Receiving its share of the keys before it joins the ring.
+	MemberActive  = "active"  // On the ring, owning its share of the keys.
+	MemberLeaving = "leaving" // Off the ring, handing its keys off before it is removed.
+)
+
+// DefaultTransferBatch is the number of keys a joining or leaving node
+// transfers per round, used when Config.TransferBatch is unset.
+const DefaultTransferBatch = 16
+
+// ErrMembershipChange means a node is joining or leaving the cluster, so it
+// can't be asked to leave, or to change role, until that is done.
+var ErrMembershipChange = errors.New("node is joining or leaving")
+
+// Kinds of membership transfer.
+const (
+	TransferJoin  = "join"
+	TransferLeave = "leave"
+)
+
+// TransferStatus describes the transfer of keys to a joining node or from a
+// leaving one.
+type TransferStatus struct {
+	ID          int        `json:"id"`
+	Membership  string     `json:"membership"`
+	Kind        string     `json:"kind"`        // TransferJoin or TransferLeave.
+	Total       int        `json:"total"`       // Keys to transfer.
+	Transferred int        `json:"transferred"` // Keys transferred so far.
+	Pending     []string   `json:"pending"`     // Keys yet to be transferred, in the order they will be.
+	Started     time.Time  `json:"started"`
+	Finished    *time.Time `json:"finished,omitempty"` // When the node became active, or was removed.
+}
+
+// transfer is the progress of a node's join or leave.
+type transfer struct {
+	kind        string
+	total       int
+	transferred int
+	pending     []string
+	started     time.Time
+	finished    *time.Time
+}
+
+// joinNode adds a node in the joining state, off the ring, that the
+// transfer rounds send its share of the keys to before it becomes active.
+// If it has no keys to receive, it becomes active at once. It returns the node
+// and the number of keys moved if it became active. The caller must hold s.mu
+// for writing.
+func (s *Simulator) joinNode(node NodeData) (NodeData, int) {
+	node.Membership = MemberJoining
+	s.nodes = append(s.nodes, node)
+	index := len(s.nodes) - 1
+
+	future := s.ringWith(func(ring *HashRing) { ring.Add(node.ID) })
+	var pending []string
+	for _, key := range s.kvKeys() {
+		for _, id := range future.Locate(key, s.cfg.N) {
+			if id == node.ID {
+				pending = append(pending, key)
+			}
+		}
+	}
+	s.transfers[node.ID] = &transfer{kind: TransferJoin, total: len(pending), pending: pending, started: s.cfg.Clock.Now()}
+	s.publish(EventNodeAdded, index)
+	if len(pending) > 0 {
+		s.logger.Info("node joining", "node_id", node.ID, "keys", len(pending))
+		return s.nodes[index].clone(), 0
+	}
+	moved := s.activate(index)
+	return s.nodes[index].clone(), moved
+}
+
+// LeaveNode starts handing off the keys of the node with the given ID: the
+// node leaves the ring at once, so writes go to the active nodes that take
+// over its keys, but it keeps serving reads of the keys it holds until the
+// transfer rounds have copied each of them to its new replicas. Then it is
+// removed. A node with no keys, or one still joining, is removed at once.
+// It returns the node and true if it was removed at once, ErrNodeNotFound if
+// no such node exists, and ErrMembershipChange if it is already leaving.
+func (s *Simulator) LeaveNode(id int) (NodeData, bool, error) {
+	node, _, removed, err := s.leaveNode(id)
+	return node, removed, err
+}
+
+// leaveNode implements LeaveNode and also returns the number of keys moved if
+// the node was removed at once.
+func (s *Simulator) leaveNode(id int) (NodeData, int, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := s.findNode(id)
+	if index < 0 {
+		return NodeData{}, 0, false, ErrNodeNotFound
+	}
+	return s.leave(index)
+}
+
+// leave implements leaveNode for the node at index. The caller must hold s.mu
+// for writing.
+func (s *Simulator) leave(index int) (NodeData, int, bool, error) {
+	node := &s.nodes[index]
+	id := node.ID
+	switch node.Membership {
+	case MemberLeaving:
+		return node.clone(), 0, false, ErrMembershipChange
+	case MemberJoining:
+		removed := node.clone()
+		s.remove(index, 0)
+		return removed, 0, true, nil
+	}
+
+	var pending []string
+	for key := range s.replicaData[id] {
+		pending = append(pending, key)
+	}
+	sort.Strings(pending)
+	if len(pending) == 0 {
+		removed := node.clone()
+		moved := s.changeMembership(fmt.Sprintf("node %d removed", id), func(ring *HashRing) {
+			ring.Remove(id)
+		})
+		s.remove(index, moved)
+		return removed, moved, true, nil
+	}
+
+	node.Membership = MemberLeaving
+	s.ring.Remove(id)
+	s.transfers[id] = &transfer{kind: TransferLeave, total: len(pending), pending: pending, started: s.cfg.Clock.Now()}
+	s.electLeader()
+	s.publish(EventNodeUpdated, index)
+	s.logger.Info("node leaving", "node_id", id, "keys", len(pending))
+	return s.nodes[index].clone(), 0, false, nil
+}
+
+// ringWith returns a copy of the ring with change applied. The caller must
+// hold s.mu.
+func (s *Simulator) ringWith(change func(*HashRing)) *HashRing {
+	ring := s.ring.clone()
+	change(ring)
+	return ring
+}
+
+// StartTransfers runs a transfer round and a rebalance round once per
+// interval until ctx is cancelled. It blocks, so callers typically run it in
+// its own goroutine.
+func (s *Simulator) StartTransfers(ctx context.Context, interval time.Duration) {
+	ticker := s.cfg.Clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			s.TransferRound()
+			s.RebalanceRound()
+		}
+	}
+}
+
+// TransferRound moves up to Config.TransferBatch keys for every joining or
+// leaving node. A joining node receives the newest copy an up replica it can
+// reach holds, and becomes active, joining the ring, once it has every key it
+// will be a replica of; the keys written meanwhile are handed over as it
+// joins. A leaving node sends its copies to its keys' new replicas, and is
+// removed once every key is handed off. Keys that can't be moved this round,
+// because the nodes involved are down or partitioned, are retried in a later
+// one. It returns the number of keys moved.
+func (s *Simulator) TransferRound() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]int, 0, len(s.transfers))
+	for id, t := range s.transfers {
+		if t.finished == nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+
+	now := s.cfg.Clock.Now()
+	moved := 0
+	for _, id := range ids {
+		t := s.transfers[id]
+		index := s.findNode(id)
+		if index < 0 || s.nodes[index].Status != StatusUp {
+			continue
+		}
+		var retry []string
+		for i, key := range t.pending {
+			if i >= s.cfg.TransferBatch || !s.transferKey(t.kind, id, key, now) {
+				retry = append(retry, key)
+				continue
+			}
+			t.transferred++
+			moved++
+		}
+		t.pending = retry
+		if len(t.pending) > 0 {
+			continue
+		}
+		if t.kind == TransferJoin {
+			s.activate(index)
+		} else {
+			s.remove(index, t.transferred)
+		}
+	}
+	if moved > 0 {
+		s.logger.Debug("transfer round", "keys", moved)
+	}
+	return moved
+}
+
+// transferKey moves key for the joining or leaving node with the given ID,
+// reporting whether it is done with. The caller must hold s.mu for writing.
+func (s *Simulator) transferKey(kind string, id int, key string, now time.Time) bool {
+	if kind == TransferJoin {
+		replicas := s.preferenceList(key, s.cfg.N)
+		source, newest, ok := s.newestUpReplica(key, replicas)
+		if !ok {
+			// Done with if no replica holds the key any more.
+			for _, id := range replicas {
+				if _, held := s.replicaData[id][key]; held {
+					return false
+				}
+			}
+			return true
+		}
+		if !s.reachable(source, id) || !s.deliver(source, id) {
+			return false
+		}
+		if entry := s.replyEntry(source, newest); s.wants(id, key, entry, now) && s.intact(id, key, entry) {
+			s.storeReplica(id, key, entry)
+		}
+		return true
+	}
+
+	entry, ok := s.replicaData[id][key]
+	if !ok {
+		return true
+	}
+	sent := s.replyEntry(id, entry)
+	done := true
+	for _, target := range s.preferenceList(key, s.cfg.N) {
+		if !s.wants(target, key, sent, now) {
+			continue
+		}
+		if s.nodes[s.findNode(target)].Status != StatusUp || !s.reachable(id, target) || !s.deliver(id, target) {
+			done = false
+			continue
+		}
+		if s.intact(target, key, sent) {
+			s.storeReplica(target, key, sent)
+		}
+	}
+	return done
+}
+
+// activate puts the joining node at index on the ring, handing it every key
+// it is now a replica of, and returns the number of keys moved. The caller
+// must hold s.mu for writing.
+func (s *Simulator) activate(index int) int {
+	id := s.nodes[index].ID
+	moved := s.changeMembership(fmt.Sprintf("node %d added", id), func(ring *HashRing) {
+		ring.Add(id)
+	})
+	s.nodes[index].Membership = MemberActive
+	if t, ok := s.transfers[id]; ok {
+		t.finished = new(time.Time)
+		*t.finished = s.cfg.Clock.Now()
+	}
+	s.electLeader()
+	s.publish(EventNodeUpdated, index)
+	s.logger.Info("node joined", "node_id", id, "keys_moved", moved)
+	return moved
+}
+
+// remove removes the node at index, which is off the ring, after moved keys
+// were handed off from it. The caller must hold s.mu for writing.
+func (s *Simulator) remove(index, moved int) {
+	id := s.nodes[index].ID
+	s.publish(EventNodeRemoved, index)
+	s.nodes = append(s.nodes[:index], s.nodes[index+1:]...)
+	s.ring.Remove(id)
+	s.forgetNode(id)
+	s.lastRebalance = &Rebalance{Trigger: fmt.Sprintf("node %d removed", id), KeysMoved: moved, Time: time.Now()}
+	s.electLeader()
+	s.logger.Info("node removed", "node_id", id, "keys_moved", moved)
+}
+
+// handing returns the IDs of the up leaving nodes that still hold a copy of
+// key, in ID order, so reads can reach copies not yet handed off. The caller
+// must hold s.mu.
+func (s *Simulator) handing(key string) []int {
+	var ids []int
+	for id, t := range s.transfers {
+		if t.kind != TransferLeave || t.finished != nil {
+			continue
+		}
+		if _, ok := s.replicaData[id][key]; ok && s.nodes[s.findNode(id)].Status == StatusUp {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// Transfer returns the progress of the latest join or leave of the node with
+// the given ID, and false if no such node exists or it has never joined nor
+// left through the membership protocol.
+func (s *Simulator) Transfer(id int) (TransferStatus, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	index := s.findNode(id)
+	t, ok := s.transfers[id]
+	if index < 0 || !ok {
+		return TransferStatus{}, false
+	}
+	status := TransferStatus{
+		ID:          id,
+		Membership:  s.nodes[index].Membership,
+		Kind:        t.kind,
+		Total:       t.total,
+		Transferred: t.transferred,
+		Pending:     append([]string{}, t.pending...),
+		Started:     t.started,
+	}
+	if t.finished != nil {
+		finished := *t.finished
+		status.Finished = &finished
+	}
+	return status, true
+}
+
+// getJoinStatus handles HTTP requests for the progress of a node's join or
+// leave.
+func (s *Simulator) getJoinStatus(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseNodeID(w, r)
+	if !ok {
+		return
+	}
+
+	status, found := s.Transfer(id)
+	if !found {
+		writeError(w, http.StatusNotFound, "Node not found or never joined")
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
@@ -0,0 +1,102 @@
+package simulator
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+// TestMembership tests that a node joining a loaded cluster receives its
+// keys over several rounds before it joins the ring, that a leaving node
+// hands its keys off before it is removed, and that every key stays readable
+// throughout.
+func TestMembership(t *testing.T) {
+	const keys = 200
+
+	// Reading a single replica makes a key whose copy hasn't arrived yet
+	// unreadable.
+	s := New(Config{Seed: 1, N: 3, R: 1, W: 3, TransferBatch: 20})
+	s.Init(testNodeCount)
+	h := s.Handler()
+	for k := 0; k < keys; k++ {
+		if _, err := s.KVPut(fmt.Sprintf("key-%d", k), strconv.Itoa(k)); err != nil {
+			t.Fatalf("KVPut failed: %v", err)
+		}
+	}
+	checkKeys := func(when string) {
+		t.Helper()
+		for k := 0; k < keys; k++ {
+			result, err := s.KVGet(fmt.Sprintf("key-%d", k))
+			if err != nil || result.Value != strconv.Itoa(k) {
+				t.Fatalf("%s: key-%d read %+v, %v", when, k, result, err)
+			}
+		}
+	}
+
+	var node NodeData
+	rr := doRequest(t, h, "POST", "/nodes", `{"name":"Node-new","value":1}`)
+	expectCode(t, rr, http.StatusCreated)
+	decodeBody(t, rr, &node)
+	if node.Membership != MemberJoining || s.ring.ids[node.ID] {
+		t.Fatalf("Expected the new node to join off the ring, got %+v", node)
+	}
+	var status TransferStatus
+	decodeBody(t, doRequest(t, h, "GET", "/nodes/5/join-status", ""), &status)
+	if status.Kind != TransferJoin || status.Total == 0 || len(status.Pending) != status.Total {
+		t.Fatalf("Expected keys pending for the joining node, got %+v", status)
+	}
+	expectCode(t, doRequest(t, h, "PATCH", "/nodes/5/role", `{"role":"witness"}`), http.StatusConflict)
+
+	rounds := 0
+	for node.Membership == MemberJoining {
+		s.TransferRound()
+		rounds++
+		checkKeys(fmt.Sprintf("join round %d", rounds))
+		node, _ = s.Node(5)
+	}
+	if rounds < 2 || node.Membership != MemberActive || !s.ring.ids[5] {
+		t.Fatalf("Expected the node to become active after several rounds, got %+v after %d", node, rounds)
+	}
+	decodeBody(t, doRequest(t, h, "GET", "/nodes/5/join-status", ""), &status)
+	if status.Transferred != status.Total || len(status.Pending) != 0 || status.Finished == nil {
+		t.Errorf("Expected every key transferred, got %+v", status)
+	}
+	if held := len(s.replicaData[5]); held != status.Total {
+		t.Errorf("Expected the joined node to hold its %d keys, got %d", status.Total, held)
+	}
+
+	rr = doRequest(t, h, "DELETE", "/nodes/0", "")
+	expectCode(t, rr, http.StatusAccepted)
+	decodeBody(t, rr, &node)
+	if node.Membership != MemberLeaving || s.ring.ids[0] {
+		t.Fatalf("Expected node 0 to leave the ring at once, got %+v", node)
+	}
+	if leader, _ := s.Leader(); leader.ID == 0 {
+		t.Errorf("Expected the leaving node to give up the lead")
+	}
+	expectCode(t, doRequest(t, h, "DELETE", "/nodes/0", ""), http.StatusConflict)
+	checkKeys("after leaving")
+
+	// A write during the leave goes to the nodes taking over.
+	expectCode(t, doRequest(t, h, "PUT", "/kv/fresh", `{"value":"new"}`), http.StatusOK)
+	if _, ok := s.replicaData[0]["fresh"]; ok {
+		t.Errorf("Expected the leaving node to take no writes")
+	}
+
+	for rounds = 0; ; rounds++ {
+		if _, ok := s.Node(0); !ok {
+			break
+		}
+		s.TransferRound()
+		checkKeys(fmt.Sprintf("leave round %d", rounds))
+	}
+	if rounds < 2 {
+		t.Errorf("Expected the leave to take several rounds, got %d", rounds)
+	}
+	if _, ok := s.replicaData[0]; ok {
+		t.Error("Removed node still holds replica data")
+	}
+	expectCode(t, doRequest(t, h, "GET", "/nodes/0/join-status", ""), http.StatusNotFound)
+	checkKeys("after removal")
+}
@@ -0,0 +1,364 @@
+package simulator
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// durationBuckets are the upper bounds, in seconds, of the HTTP request
+// duration histogram. They match the Prometheus client defaults.
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// requestKey identifies one series of the HTTP request counter.
+type requestKey struct {
+	handler, method, code string
+}
+
+// histogram is a cumulative Prometheus histogram over durationBuckets.
+type histogram struct {
+	counts []uint64 // Observations at or below each bucket bound.
+	count  uint64
+	sum    float64
+}
+
+// observe records one observation of v seconds.
+func (h *histogram) observe(v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(durationBuckets))
+	}
+	for i, bound := range durationBuckets {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// httpMetrics counts HTTP requests and their durations per handler. It has
+// its own lock so recording a request never contends with s.mu.
+type httpMetrics struct {
+	mu        sync.Mutex
+	requests  map[requestKey]uint64
+	durations map[string]*histogram
+}
+
+// record records a request served by handler.
+func (m *httpMetrics) record(handler, method string, code int, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.requests == nil {
+		m.requests = make(map[requestKey]uint64)
+		m.durations = make(map[string]*histogram)
+	}
+	m.requests[requestKey{handler, method, strconv.Itoa(code)}]++
+	h, ok := m.durations[handler]
+	if !ok {
+		h = &histogram{}
+		m.durations[handler] = h
+	}
+	h.observe(d.Seconds())
+}
+
+// statusRecorder records the status code written through it. It passes
+// flushes and hijacks through so streaming handlers keep working.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+// WriteHeader records code and writes it.
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Write writes b, recording an implicit 200 status.
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush flushes the underlying writer if it supports flushing.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hijacks the underlying connection, recording it as a protocol
+// switch.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	if r.code == 0 {
+		r.code = http.StatusSwitchingProtocols
+	}
+	return h.Hijack()
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// withMetrics records the status and duration of every request passed to
+// next, labelled by the mux pattern that serves it, for both /metrics and
+// /stats/http.
+func (s *Simulator) withMetrics(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		if pattern == "" {
+			pattern = "unmatched"
+		}
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.code == 0 {
+			rec.code = http.StatusOK
+		}
+		took := time.Since(start)
+		s.httpMetrics.record(pattern, r.Method, rec.code, took)
+		s.httpStats.record(pattern, rec.code, took)
+	})
+}
+
+// getMetrics handles HTTP requests for metrics in the Prometheus text
+// exposition format.
+func (s *Simulator) getMetrics(w http.ResponseWriter, r *http.Request) {
+	var b strings.Builder
+
+	s.mu.RLock()
+	writeMetricHeader(&b, "sim_node_value", "gauge", "Current value of each node.")
+	nodes := make([]NodeData, len(s.nodes))
+	for i := range s.nodes {
+		nodes[i] = s.nodeCopy(i)
+		fmt.Fprintf(&b, "sim_node_value{node=%s,name=%s} %d\n", quoteLabel(strconv.Itoa(nodes[i].ID)), quoteLabel(nodes[i].Name), nodes[i].Value)
+	}
+	writeMetricHeader(&b, "sim_node_cpu_percent", "gauge", "Simulated CPU usage of each node over the last tick, in percent of one core.")
+	for _, node := range nodes {
+		fmt.Fprintf(&b, "sim_node_cpu_percent{node=%s} %g\n", quoteLabel(strconv.Itoa(node.ID)), node.Resources.CPU)
+	}
+	writeMetricHeader(&b, "sim_node_memory_bytes", "gauge", "Simulated memory taken by the keys each node holds.")
+	for _, node := range nodes {
+		fmt.Fprintf(&b, "sim_node_memory_bytes{node=%s} %d\n", quoteLabel(strconv.Itoa(node.ID)), node.Resources.Memory)
+	}
+	writeMetricHeader(&b, "sim_node_disk_bytes", "gauge", "Simulated disk taken by the log of each node.")
+	for _, node := range nodes {
+		fmt.Fprintf(&b, "sim_node_disk_bytes{node=%s} %d\n", quoteLabel(strconv.Itoa(node.ID)), node.Resources.Disk)
+	}
+	writeMetricHeader(&b, "sim_node_overloaded", "gauge", "Whether each node is over its resource limits, as 1 or 0.")
+	for _, node := range nodes {
+		overloaded := 0
+		if node.Resources.Overloaded {
+			overloaded = 1
+		}
+		fmt.Fprintf(&b, "sim_node_overloaded{node=%s} %d\n", quoteLabel(strconv.Itoa(node.ID)), overloaded)
+	}
+	up := len(s.indicesWithStatus(StatusUp))
+	writeMetricHeader(&b, "sim_nodes", "gauge", "Number of nodes by status.")
+	fmt.Fprintf(&b, "sim_nodes{status=\"up\"} %d\n", up)
+	fmt.Fprintf(&b, "sim_nodes{status=\"down\"} %d\n", len(s.nodes)-up)
+	writeMetricHeader(&b, "sim_updates_total", "counter", "Number of node updates made by the background updater.")
+	fmt.Fprintf(&b, "sim_updates_total %d\n", s.updates.Load())
+	writeMetricHeader(&b, "sim_failures_total", "counter", "Number of node failures.")
+	fmt.Fprintf(&b, "sim_failures_total %d\n", s.failures)
+	writeMetricHeader(&b, "sim_recoveries_total", "counter", "Number of node recoveries.")
+	fmt.Fprintf(&b, "sim_recoveries_total %d\n", s.recoveries)
+	writeMetricHeader(&b, "sim_messages_total", "counter", "Number of messages between nodes by outcome.")
+	fmt.Fprintf(&b, "sim_messages_total{outcome=\"delivered\"} %d\n", s.delivered)
+	fmt.Fprintf(&b, "sim_messages_total{outcome=\"dropped\"} %d\n", s.dropped)
+	writeMetricHeader(&b, "sim_messages_in_flight", "gauge", "Number of messages between nodes sent but yet to arrive.")
+	fmt.Fprintf(&b, "sim_messages_in_flight %d\n", len(s.inFlight))
+	writeMetricHeader(&b, "sim_message_bytes_total", "counter", "Estimated bytes of messages sent between nodes by kind.")
+	for _, kind := range []string{MessageGossip, MessageReplication, MessageHeartbeat, MessageHint, MessageBus} {
+		fmt.Fprintf(&b, "sim_message_bytes_total{kind=%s} %d\n", quoteLabel(kind), s.traffic.kinds[kind].Bytes)
+	}
+	writeMetricHeader(&b, "sim_messages_throttled_total", "counter", "Number of messages between nodes held back or dropped by the bandwidth limit by outcome.")
+	fmt.Fprintf(&b, "sim_messages_throttled_total{outcome=\"queued\"} %d\n", s.traffic.queued)
+	fmt.Fprintf(&b, "sim_messages_throttled_total{outcome=\"dropped\"} %d\n", s.traffic.throttled)
+	writeMetricHeader(&b, "sim_retries_total", "counter", "Number of retries of operations by operation.")
+	for _, operation := range []string{RetryReplication, RetryHint, RetryPrepare, RetryWebhook} {
+		fmt.Fprintf(&b, "sim_retries_total{operation=%s} %d\n", quoteLabel(operation), s.retries[operation].Retries)
+	}
+	writeMetricHeader(&b, "sim_retries_exhausted_total", "counter", "Number of operations given up on after every attempt failed, by operation.")
+	for _, operation := range []string{RetryReplication, RetryHint, RetryPrepare, RetryWebhook} {
+		fmt.Fprintf(&b, "sim_retries_exhausted_total{operation=%s} %d\n", quoteLabel(operation), s.retries[operation].Exhausted)
+	}
+	leaders := 0
+	for i := range s.nodes {
+		if s.nodes[i].Leader {
+			leaders++
+		}
+	}
+	writeMetricHeader(&b, "sim_leaders", "gauge", "Number of nodes that are leader, more than one during a split brain.")
+	fmt.Fprintf(&b, "sim_leaders %d\n", leaders)
+	writeMetricHeader(&b, "sim_stale_writes_total", "counter", "Number of writes of deposed leaders fenced off by outcome.")
+	fmt.Fprintf(&b, "sim_stale_writes_total{outcome=%s} %d\n", quoteLabel(StaleRejected), s.staleWrites.rejected)
+	fmt.Fprintf(&b, "sim_stale_writes_total{outcome=%s} %d\n", quoteLabel(StaleRolledBack), s.staleWrites.rolledBack)
+	writeMetricHeader(&b, "sim_transaction_duration_seconds", "histogram", "Simulated duration of two-phase commits under the latency model.")
+	writeHistogram(&b, "sim_transaction_duration_seconds", "", &s.txDurations)
+	writeMetricHeader(&b, "sim_restart_duration_seconds", "histogram", "Simulated downtime of restarted nodes.")
+	writeHistogram(&b, "sim_restart_duration_seconds", "", &s.restartDurations)
+	writeMetricHeader(&b, "sim_queue_depth", "gauge", "Number of tasks waiting in the work queue.")
+	fmt.Fprintf(&b, "sim_queue_depth %d\n", len(s.queue.tasks))
+	writeMetricHeader(&b, "sim_queue_tasks_total", "counter", "Number of work queue tasks by outcome.")
+	fmt.Fprintf(&b, "sim_queue_tasks_total{outcome=\"produced\"} %d\n", s.queue.produced)
+	fmt.Fprintf(&b, "sim_queue_tasks_total{outcome=\"completed\"} %d\n", s.queue.completed)
+	fmt.Fprintf(&b, "sim_queue_tasks_total{outcome=\"dropped\"} %d\n", s.queue.dropped)
+	writeMetricHeader(&b, "sim_loadgen_requests_total", "counter", "Number of synthetic load generator requests by outcome.")
+	fmt.Fprintf(&b, "sim_loadgen_requests_total{outcome=\"ok\"} %d\n", s.loadGen.requests-s.loadGen.errors-s.loadGen.rejected-s.loadGen.shortCircuited)
+	fmt.Fprintf(&b, "sim_loadgen_requests_total{outcome=\"error\"} %d\n", s.loadGen.errors)
+	fmt.Fprintf(&b, "sim_loadgen_requests_total{outcome=\"rejected\"} %d\n", s.loadGen.rejected)
+	fmt.Fprintf(&b, "sim_loadgen_requests_total{outcome=\"short_circuited\"} %d\n", s.loadGen.shortCircuited)
+	writeMetricHeader(&b, "sim_loadgen_breaker_transitions_total", "counter", "Number of load generator circuit breaker transitions by the state entered.")
+	for _, state := range []string{BreakerOpen, BreakerHalfOpen, BreakerClosed} {
+		fmt.Fprintf(&b, "sim_loadgen_breaker_transitions_total{state=%s} %d\n", quoteLabel(state), s.loadGen.transitions[state])
+	}
+	pending := 0
+	for _, hints := range s.hints {
+		pending += len(hints)
+	}
+	writeMetricHeader(&b, "sim_hints_pending", "gauge", "Number of key-value writes held as hints for down replicas.")
+	fmt.Fprintf(&b, "sim_hints_pending %d\n", pending)
+	writeMetricHeader(&b, "sim_hints_total", "counter", "Number of hints handed off by outcome.")
+	fmt.Fprintf(&b, "sim_hints_total{outcome=\"delivered\"} %d\n", s.hintsDelivered)
+	fmt.Fprintf(&b, "sim_hints_total{outcome=\"expired\"} %d\n", s.hintsExpired)
+
+	byzantine := 0
+	for i := range s.nodes {
+		if s.nodes[i].Byzantine {
+			byzantine++
+		}
+	}
+	writeMetricHeader(&b, "sim_byzantine_nodes", "gauge", "Number of nodes reporting corrupted values.")
+	fmt.Fprintf(&b, "sim_byzantine_nodes %d\n", byzantine)
+	writeMetricHeader(&b, "sim_byzantine_disagreements_total", "counter", "Number of majority reads where some replica disagreed, by outcome.")
+	fmt.Fprintf(&b, "sim_byzantine_disagreements_total{outcome=\"masked\"} %d\n", s.disagreements.masked)
+	fmt.Fprintf(&b, "sim_byzantine_disagreements_total{outcome=\"unresolved\"} %d\n", s.disagreements.unresolved)
+
+	writeMetricHeader(&b, "sim_checksum_rejected_total", "counter", "Number of key-value copies refused for not matching their checksums.")
+	fmt.Fprintf(&b, "sim_checksum_rejected_total %d\n", s.checksumRejected)
+
+	kv := s.kvStats()
+	writeMetricHeader(&b, "sim_kv_deletes_total", "counter", "Number of key-value deletes.")
+	fmt.Fprintf(&b, "sim_kv_deletes_total %d\n", kv.Deletes)
+	writeMetricHeader(&b, "sim_kv_expired_total", "counter", "Number of replica copies of key-value entries expired by their TTL.")
+	fmt.Fprintf(&b, "sim_kv_expired_total %d\n", kv.Expired)
+	writeMetricHeader(&b, "sim_kv_tombstones", "gauge", "Number of replica copies held as tombstones of deleted or expired entries.")
+	fmt.Fprintf(&b, "sim_kv_tombstones %d\n", kv.Tombstones)
+	writeMetricHeader(&b, "sim_kv_tombstones_purged_total", "counter", "Number of tombstones dropped after the grace period.")
+	fmt.Fprintf(&b, "sim_kv_tombstones_purged_total %d\n", kv.Purged)
+
+	links := s.outboundLinks()
+	s.mu.RUnlock()
+	if len(links) > 0 {
+		writeMetricHeader(&b, "sim_replication_pending", "gauge", "Number of key-value writes awaiting a replication link, by target cluster.")
+		for _, l := range links {
+			fmt.Fprintf(&b, "sim_replication_pending{to=%q} %d\n", l.To, l.Pending)
+		}
+		writeMetricHeader(&b, "sim_replication_lag_seconds", "gauge", "Age of the oldest key-value write awaiting a replication link, by target cluster.")
+		for _, l := range links {
+			fmt.Fprintf(&b, "sim_replication_lag_seconds{to=%q} %g\n", l.To, time.Duration(l.Behind).Seconds())
+		}
+		writeMetricHeader(&b, "sim_replication_replicated_total", "counter", "Number of key-value writes applied by a replication link, by target cluster.")
+		for _, l := range links {
+			fmt.Fprintf(&b, "sim_replication_replicated_total{to=%q} %d\n", l.To, l.Replicated)
+		}
+		writeMetricHeader(&b, "sim_replication_conflicts_total", "counter", "Number of replicated key-value writes that conflicted with a concurrent write, by target cluster.")
+		for _, l := range links {
+			fmt.Fprintf(&b, "sim_replication_conflicts_total{to=%q} %d\n", l.To, l.Conflicts)
+		}
+	}
+
+	s.httpMetrics.write(&b)
+
+	writeMetricHeader(&b, "go_goroutines", "gauge", "Number of goroutines that currently exist.")
+	fmt.Fprintf(&b, "go_goroutines %d\n", runtime.NumGoroutine())
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(b.String()))
+}
+
+// write writes the HTTP metrics to b in a stable order.
+func (m *httpMetrics) write(b *strings.Builder) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]requestKey, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.handler != b.handler {
+			return a.handler < b.handler
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.code < b.code
+	})
+	writeMetricHeader(b, "sim_http_requests_total", "counter", "Number of HTTP requests by handler, method, and status code.")
+	for _, key := range keys {
+		fmt.Fprintf(b, "sim_http_requests_total{handler=%s,method=%s,code=%s} %d\n",
+			quoteLabel(key.handler), quoteLabel(key.method), quoteLabel(key.code), m.requests[key])
+	}
+
+	handlers := make([]string, 0, len(m.durations))
+	for handler := range m.durations {
+		handlers = append(handlers, handler)
+	}
+	sort.Strings(handlers)
+	writeMetricHeader(b, "sim_http_request_duration_seconds", "histogram", "Duration of HTTP requests by handler.")
+	for _, handler := range handlers {
+		writeHistogram(b, "sim_http_request_duration_seconds", "handler="+quoteLabel(handler), m.durations[handler])
+	}
+}
+
+// writeHistogram writes the bucket, sum, and count series of the histogram
+// h named name, each with the given labels, such as handler="x", if any.
+func writeHistogram(b *strings.Builder, name, labels string, h *histogram) {
+	prefix, suffix := labels, ""
+	if labels != "" {
+		prefix, suffix = labels+",", "{"+labels+"}"
+	}
+	for i, bound := range durationBuckets {
+		var count uint64
+		if h.counts != nil {
+			count = h.counts[i]
+		}
+		fmt.Fprintf(b, "%s_bucket{%sle=\"%s\"} %d\n", name, prefix, strconv.FormatFloat(bound, 'g', -1, 64), count)
+	}
+	fmt.Fprintf(b, "%s_bucket{%sle=\"+Inf\"} %d\n", name, prefix, h.count)
+	fmt.Fprintf(b, "%s_sum%s %g\n", name, suffix, h.sum)
+	fmt.Fprintf(b, "%s_count%s %d\n", name, suffix, h.count)
+}
+
+// writeMetricHeader writes the HELP and TYPE lines of a metric.
+func writeMetricHeader(b *strings.Builder, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// quoteLabel quotes a label value, escaping backslashes, quotes, and
+// newlines as the exposition format requires.
+func quoteLabel(v string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v) + `"`
+}
@@ -0,0 +1,99 @@
+package simulator
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// scrape fetches /metrics from h and returns the value of every sample,
+// keyed by the metric name and labels as they appear in the output.
+func scrape(t *testing.T, h http.Handler) map[string]float64 {
+	t.Helper()
+
+	rr := doRequest(t, h, "GET", "/metrics", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, rr.Code)
+	}
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Expected a text/plain Content-Type, got %q", ct)
+	}
+
+	samples := make(map[string]float64)
+	for _, line := range strings.Split(strings.TrimSpace(rr.Body.String()), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndex(line, " ")
+		v, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			t.Fatalf("Malformed sample %q: %v", line, err)
+		}
+		samples[line[:i]] = v
+	}
+	return samples
+}
+
+// TestMetrics tests that /metrics exposes node, update, and HTTP metrics and
+// that the counters increase.
+func TestMetrics(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	s.Update()
+	s.Fail(1)
+	doRequest(t, h, "GET", "/nodes/0", "")
+	before := scrape(t, h)
+
+	for name, want := range map[string]float64{
+		`sim_updates_total`:        1,
+		`sim_nodes{status="up"}`:   testNodeCount - 1,
+		`sim_nodes{status="down"}`: 1,
+		`sim_failures_total`:       1,
+		`sim_http_requests_total{handler="GET /nodes/{id}",method="GET",code="200"}`: 1,
+		`sim_http_request_duration_seconds_count{handler="GET /nodes/{id}"}`:         1,
+	} {
+		if got, ok := before[name]; !ok || got != want {
+			t.Errorf("Expected %s = %v, got %v (present: %v)", name, want, got, ok)
+		}
+	}
+	node, _ := s.Node(2)
+	if got := before[`sim_node_value{node="2",name="Node-2"}`]; got != float64(node.Value) {
+		t.Errorf("Expected node 2's value %d, got %v", node.Value, got)
+	}
+	if before["go_goroutines"] < 1 {
+		t.Errorf("Expected a goroutine count, got %v", before["go_goroutines"])
+	}
+
+	s.Update()
+	s.Update()
+	doRequest(t, h, "GET", "/nodes/0", "")
+	doRequest(t, h, "GET", "/nodes/99", "")
+	after := scrape(t, h)
+
+	for name, want := range map[string]float64{
+		`sim_updates_total`: 3,
+		`sim_http_requests_total{handler="GET /nodes/{id}",method="GET",code="200"}`:    2,
+		`sim_http_requests_total{handler="GET /nodes/{id}",method="GET",code="404"}`:    1,
+		`sim_http_requests_total{handler="GET /metrics",method="GET",code="200"}`:       1,
+		`sim_http_request_duration_seconds_bucket{handler="GET /nodes/{id}",le="+Inf"}`: 3,
+	} {
+		if got := after[name]; got != want {
+			t.Errorf("Expected %s = %v, got %v", name, want, got)
+		}
+	}
+}
+
+// TestQuoteLabel tests escaping of label values.
+func TestQuoteLabel(t *testing.T) {
+	got := quoteLabel("a\"b\\c\nd")
+	if want := `"a\"b\\c\nd"`; got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if !regexp.MustCompile(`^"[^\n]*"$`).MatchString(got) {
+		t.Errorf("Quoted label spans lines: %q", got)
+	}
+}
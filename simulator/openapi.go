@@ -0,0 +1,263 @@
+package simulator
+
+import (
+	"encoding"
+	"encoding/json"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// openAPIVersion is the version of the OpenAPI specification the document
+// served at /openapi.json follows.
+const openAPIVersion = "3.0.3"
+
+// pathParam matches a wildcard in a ServeMux path pattern.
+var pathParam = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// pathParamTypes gives the schema type of each path wildcard. Wildcards not
+// listed are strings.
+var pathParamTypes = map[string]string{"id": "integer", "a": "integer", "b": "integer"}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// schemaBuilder derives JSON schemas from Go types, collecting named struct
+// types as reusable components.
+type schemaBuilder struct {
+	components map[string]interface{}
+}
+
+// schema returns the JSON schema of values of type t as encoded by
+// encoding/json. Named struct types are referenced from components.
+func (b *schemaBuilder) schema(t reflect.Type) map[string]interface{} {
+	if t.Kind() == reflect.Pointer {
+		elem := b.schema(t.Elem())
+		if _, isRef := elem["$ref"]; isRef {
+			return elem
+		}
+		elem["nullable"] = true
+		return elem
+	}
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Implements(textMarshalerType):
+		return map[string]interface{}{"type": "string"}
+	case t.Implements(jsonMarshalerType):
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t)
+		}
+		name := componentName(t)
+		if _, seen := b.components[name]; !seen {
+			b.components[name] = nil // Reserve the name before recursing.
+			b.components[name] = b.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// object returns the schema of the JSON object encoding the struct type t.
+func (b *schemaBuilder) object(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	b.fields(t, properties)
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+// fields adds the schema of every JSON field of the struct type t to
+// properties, flattening embedded structs as encoding/json does.
+func (b *schemaBuilder) fields(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			b.fields(field.Type, properties)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = b.schema(field.Type)
+	}
+}
+
+// componentName returns the name of the named type t in the components of
+// the document, capitalized so unexported request types read like the rest.
+func componentName(t reflect.Type) string {
+	return strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+}
+
+// OpenAPI returns the OpenAPI 3 document describing every route of the HTTP
+// API, generated from the same table the routes are mounted from.
+func (s *Simulator) OpenAPI() map[string]interface{} {
+	b := &schemaBuilder{components: map[string]interface{}{}}
+	errorSchema := b.schema(reflect.TypeOf(ErrorResponse{}))
+
+	paths := map[string]interface{}{}
+	for _, rt := range s.apiRoutes() {
+		operation := map[string]interface{}{
+			"summary":     rt.summary,
+			"operationId": operationID(rt),
+		}
+
+		var params []interface{}
+		for _, match := range pathParam.FindAllStringSubmatch(rt.apiPath(), -1) {
+			kind := pathParamTypes[match[1]]
+			if kind == "" {
+				kind = "string"
+			}
+			params = append(params, map[string]interface{}{
+				"name":     match[1],
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": kind},
+			})
+		}
+		if params != nil {
+			operation["parameters"] = params
+		}
+
+		if rt.request != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					mediaJSON: map[string]interface{}{"schema": b.schema(reflect.TypeOf(rt.request))},
+				},
+			}
+		}
+
+		status := rt.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := map[string]interface{}{"description": http.StatusText(status)}
+		if media := rt.media; rt.response != nil || media != "" {
+			if media == "" {
+				media = mediaJSON
+			}
+			content := map[string]interface{}{}
+			if rt.response != nil {
+				content["schema"] = b.schema(reflect.TypeOf(rt.response))
+			}
+			success["content"] = map[string]interface{}{media: content}
+		}
+		operation["responses"] = map[string]interface{}{
+			strconv.Itoa(status): success,
+			"default": map[string]interface{}{
+				"description": "Error",
+				"content": map[string]interface{}{
+					mediaJSON: map[string]interface{}{"schema": errorSchema},
+				},
+			},
+		}
+
+		path := rt.apiPath()
+		item, _ := paths[path].(map[string]interface{})
+		if item == nil {
+			item = map[string]interface{}{}
+			paths[path] = item
+		}
+		item[strings.ToLower(rt.method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": openAPIVersion,
+		"info": map[string]interface{}{
+			"title":   "Distributed System Simulator",
+			"version": "1.0.0",
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": b.components},
+	}
+}
+
+// operationID returns a unique identifier for rt built from its method and
+// path, such as "get_nodes_id".
+func operationID(rt route) string {
+	id := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(rt.apiPath()))
+	return strings.ToLower(rt.method) + strings.TrimRight(strings.ReplaceAll(id, "__", "_"), "_")
+}
+
+// getOpenAPI serves the OpenAPI document.
+func (s *Simulator) getOpenAPI(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.OpenAPI())
+}
+
+// docsTemplate renders the endpoint listing served at /docs.
+var docsTemplate = template.Must(template.New("docs").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Distributed System Simulator API</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+td, th { padding: 0.3em 1em; text-align: left; border-bottom: 1px solid #ddd; }
+code { font-size: 1.05em; }
+</style>
+</head>
+<body>
+<h1>Distributed System Simulator API</h1>
+<p>The machine-readable description is at <a href="/openapi.json">/openapi.json</a>.</p>
+<table>
+<tr><th>Method</th><th>Path</th><th>Summary</th></tr>
+{{range .}}<tr><td><code>{{.Method}}</code></td><td><code>{{.Path}}</code></td><td>{{.Summary}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// getDocs serves an HTML listing of every route.
+func (s *Simulator) getDocs(w http.ResponseWriter, r *http.Request) {
+	type entry struct{ Method, Path, Summary string }
+	var entries []entry
+	for _, rt := range s.apiRoutes() {
+		entries = append(entries, entry{rt.method, rt.apiPath(), rt.summary})
+	}
+
+	w.Header().Set("Content-Type", mediaHTML+"; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := docsTemplate.Execute(w, entries); err != nil {
+		slog.Error("failed to write response", "err", err)
+	}
+}
@@ -0,0 +1,94 @@
+package simulator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// openAPIDoc is the part of the OpenAPI document the tests inspect.
+type openAPIDoc struct {
+	OpenAPI    string                                       `json:"openapi"`
+	Paths      map[string]map[string]map[string]interface{} `json:"paths"`
+	Components struct {
+		Schemas map[string]interface{} `json:"schemas"`
+	} `json:"components"`
+}
+
+// TestOpenAPICoversRoutes tests that /openapi.json documents every route
+// the router mounts.
+func TestOpenAPICoversRoutes(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	mux := s.routes()
+
+	rr := doRequest(t, s.Handler(), "GET", "/openapi.json", "")
+	expectCode(t, rr, http.StatusOK)
+	var doc openAPIDoc
+	decodeBody(t, rr, &doc)
+	if doc.OpenAPI != openAPIVersion {
+		t.Errorf("Expected OpenAPI version %q, got %q", openAPIVersion, doc.OpenAPI)
+	}
+
+	for _, rt := range s.apiRoutes() {
+		// The route is mounted under its own pattern.
+		path := pathParam.ReplaceAllString(rt.apiPath(), "1")
+		if _, pattern := mux.Handler(httptest.NewRequest(rt.method, path, nil)); pattern != rt.pattern() {
+			t.Errorf("%s %s: expected the mux to route it to %q, got %q", rt.method, path, rt.pattern(), pattern)
+		}
+		// And documented under its path.
+		operation := doc.Paths[rt.apiPath()][strings.ToLower(rt.method)]
+		if operation == nil {
+			t.Errorf("%s %s is missing from the OpenAPI document", rt.method, rt.apiPath())
+			continue
+		}
+		if operation["summary"] != rt.summary {
+			t.Errorf("%s %s: expected summary %q, got %v", rt.method, rt.apiPath(), rt.summary, operation["summary"])
+		}
+	}
+
+	// Every referenced schema is defined.
+	for _, match := range regexp.MustCompile(`"#/components/schemas/(\w+)"`).FindAllStringSubmatch(rr.Body.String(), -1) {
+		if doc.Components.Schemas[match[1]] == nil {
+			t.Errorf("Schema %s is referenced but not defined", match[1])
+		}
+	}
+}
+
+// TestOpenAPISchema tests that struct schemas follow their JSON encoding.
+func TestOpenAPISchema(t *testing.T) {
+	s := New(Config{})
+	var doc openAPIDoc
+	jsonRoundTrip(t, s.OpenAPI(), &doc)
+
+	node, _ := doc.Components.Schemas["NodeData"].(map[string]interface{})
+	properties, _ := node["properties"].(map[string]interface{})
+	for name, want := range map[string]string{"id": "integer", "name": "string", "value": "integer", "time": "string", "vector_clock": "object"} {
+		property, _ := properties[name].(map[string]interface{})
+		if property["type"] != want {
+			t.Errorf("NodeData.%s: expected type %q, got %v", name, want, property["type"])
+		}
+	}
+
+	params := doc.Paths["/nodes/{id}"]["get"]["parameters"].([]interface{})
+	if param := params[0].(map[string]interface{}); param["name"] != "id" || param["in"] != "path" {
+		t.Errorf("Expected an id path parameter, got %v", param)
+	}
+}
+
+// TestDocs tests that /docs lists every route in HTML.
+func TestDocs(t *testing.T) {
+	s := New(Config{})
+	rr := doRequest(t, s.Handler(), "GET", "/docs", "")
+	expectCode(t, rr, http.StatusOK)
+	if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, mediaHTML) {
+		t.Errorf("Expected HTML, got %q", ct)
+	}
+	for _, rt := range s.apiRoutes() {
+		if !strings.Contains(rr.Body.String(), "<code>"+rt.apiPath()+"</code>") {
+			t.Errorf("Expected /docs to list %s", rt.apiPath())
+		}
+	}
+}
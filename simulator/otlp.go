@@ -0,0 +1,235 @@
+package simulator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// otlpServiceName is the service.name of the resource everything exported
+// over OTLP belongs to.
+const otlpServiceName = "DistributedSystemSimulator"
+
+// otlpScopeName is the name of the instrumentation scope of everything
+// exported over OTLP.
+const otlpScopeName = "DistributedSystemSimulator/simulator"
+
+// otlpTimeout bounds how long an OTLP export may take.
+const otlpTimeout = 10 * time.Second
+
+// otlpExporter is a TelemetryExporter speaking OTLP/HTTP with JSON
+// payloads, as every OpenTelemetry collector accepts.
+type otlpExporter struct {
+	endpoint string
+	client   *http.Client
+}
+
+// NewOTLPExporter returns a TelemetryExporter that posts spans and metrics
+// to the OpenTelemetry collector at endpoint, such as
+// "http://localhost:4318", under its /v1/traces and /v1/metrics paths, in
+// the JSON encoding of OTLP/HTTP.
+func NewOTLPExporter(endpoint string) TelemetryExporter {
+	return &otlpExporter{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		client:   &http.Client{Timeout: otlpTimeout},
+	}
+}
+
+// The OTLP/HTTP JSON payloads, of which only the fields sent are declared.
+// Integers of 64 bits, such as times in nanoseconds, are encoded as strings.
+type (
+	otlpTraces struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		Name              string         `json:"name"`
+		Kind              int            `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Status            otlpStatus     `json:"status"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code,omitempty"` // 2 for an error, or 0 for unset.
+		Message string `json:"message,omitempty"`
+	}
+
+	otlpMetrics struct {
+		ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+	}
+	otlpResourceMetrics struct {
+		Resource     otlpResource       `json:"resource"`
+		ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+	}
+	otlpScopeMetrics struct {
+		Scope   otlpScope    `json:"scope"`
+		Metrics []otlpMetric `json:"metrics"`
+	}
+	otlpMetric struct {
+		Name        string     `json:"name"`
+		Description string     `json:"description,omitempty"`
+		Unit        string     `json:"unit,omitempty"`
+		Gauge       *otlpGauge `json:"gauge,omitempty"`
+		Sum         *otlpSum   `json:"sum,omitempty"`
+	}
+	otlpGauge struct {
+		DataPoints []otlpDataPoint `json:"dataPoints"`
+	}
+	otlpSum struct {
+		DataPoints             []otlpDataPoint `json:"dataPoints"`
+		AggregationTemporality int             `json:"aggregationTemporality"` // 2 for cumulative.
+		IsMonotonic            bool            `json:"isMonotonic"`
+	}
+	otlpDataPoint struct {
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano,omitempty"`
+		TimeUnixNano      string         `json:"timeUnixNano"`
+		AsDouble          float64        `json:"asDouble"`
+	}
+
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpKeyValue struct {
+		Key   string       `json:"key"`
+		Value otlpAnyValue `json:"value"`
+	}
+	otlpAnyValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+	}
+)
+
+// ExportSpans posts spans to the collector's /v1/traces.
+func (e *otlpExporter) ExportSpans(ctx context.Context, spans []TelemetrySpan) error {
+	out := make([]otlpSpan, len(spans))
+	for i, span := range spans {
+		out[i] = otlpSpan{
+			TraceID:           span.TraceID,
+			SpanID:            span.SpanID,
+			ParentSpanID:      span.ParentSpanID,
+			Name:              span.Name,
+			Kind:              span.Kind,
+			StartTimeUnixNano: otlpTime(span.Start),
+			EndTimeUnixNano:   otlpTime(span.End),
+			Attributes:        otlpAttributes(span.Attributes),
+		}
+		if span.Error != "" {
+			out[i].Status = otlpStatus{Code: 2, Message: span.Error}
+		}
+	}
+	return e.post(ctx, "/v1/traces", otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpServiceResource(),
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: otlpScopeName}, Spans: out}},
+	}}})
+}
+
+// ExportMetrics posts metrics to the collector's /v1/metrics.
+func (e *otlpExporter) ExportMetrics(ctx context.Context, metrics []TelemetryMetric) error {
+	out := make([]otlpMetric, len(metrics))
+	for i, m := range metrics {
+		points := make([]otlpDataPoint, len(m.Points))
+		for j, p := range m.Points {
+			points[j] = otlpDataPoint{Attributes: otlpAttributes(p.Attributes), TimeUnixNano: otlpTime(p.Time), AsDouble: p.Value}
+			if m.Kind == MetricSum {
+				points[j].StartTimeUnixNano = otlpTime(m.Start)
+			}
+		}
+		out[i] = otlpMetric{Name: m.Name, Description: m.Description, Unit: m.Unit}
+		if m.Kind == MetricSum {
+			out[i].Sum = &otlpSum{DataPoints: points, AggregationTemporality: 2, IsMonotonic: true}
+		} else {
+			out[i].Gauge = &otlpGauge{DataPoints: points}
+		}
+	}
+	return e.post(ctx, "/v1/metrics", otlpMetrics{ResourceMetrics: []otlpResourceMetrics{{
+		Resource:     otlpServiceResource(),
+		ScopeMetrics: []otlpScopeMetrics{{Scope: otlpScope{Name: otlpScopeName}, Metrics: out}},
+	}}})
+}
+
+// post posts payload as JSON to path on the collector, failing unless it
+// responds with a 2xx status.
+func (e *otlpExporter) post(ctx context.Context, path string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body) // Lets the connection be reused.
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("otlp: POST %s: %s", path, resp.Status)
+	}
+	return nil
+}
+
+// otlpServiceResource returns the resource everything exported belongs to.
+func otlpServiceResource() otlpResource {
+	return otlpResource{Attributes: otlpAttributes(map[string]any{"service.name": otlpServiceName})}
+}
+
+// otlpTime returns t in nanoseconds since the Unix epoch, as a string.
+func otlpTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// otlpAttributes returns attrs as OTLP key-values, ordered by key. Values of
+// types OTLP has no counterpart of are sent as strings.
+func otlpAttributes(attrs map[string]any) []otlpKeyValue {
+	kvs := make([]otlpKeyValue, 0, len(attrs))
+	for key, value := range attrs {
+		var v otlpAnyValue
+		switch value := value.(type) {
+		case string:
+			v.StringValue = &value
+		case int:
+			s := strconv.Itoa(value)
+			v.IntValue = &s
+		case int64:
+			s := strconv.FormatInt(value, 10)
+			v.IntValue = &s
+		case bool:
+			v.BoolValue = &value
+		case float64:
+			v.DoubleValue = &value
+		default:
+			s := fmt.Sprint(value)
+			v.StringValue = &s
+		}
+		kvs = append(kvs, otlpKeyValue{Key: key, Value: v})
+	}
+	sort.Slice(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+	return kvs
+}
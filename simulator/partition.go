@@ -0,0 +1,109 @@
+package simulator
+
+import "fmt"
+
+// SetPartition splits the cluster into the given groups of node IDs. While
+// partitioned, nodes only exchange values with nodes in their own group;
+// nodes not listed in any group are isolated. In raft mode, only a group
+// holding a majority can elect a leader. Every ID must belong to an
+// existing node and appear at most once.
+func (s *Simulator) SetPartition(groups [][]int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.setPartition(groups)
+}
+
+// setPartition implements SetPartition. The caller must hold s.mu for
+// writing.
+func (s *Simulator) setPartition(groups [][]int) error {
+	group := make(map[int]int)
+	for g, ids := range groups {
+		if len(ids) == 0 {
+			return fmt.Errorf("group %d is empty", g)
+		}
+		for _, id := range ids {
+			if s.findNode(id) < 0 {
+				return fmt.Errorf("node %d does not exist", id)
+			}
+			if _, dup := group[id]; dup {
+				return fmt.Errorf("node %d appears in more than one group", id)
+			}
+			group[id] = g
+		}
+	}
+
+	s.groups = make([][]int, len(groups))
+	for g, ids := range groups {
+		s.groups[g] = append([]int{}, ids...)
+	}
+	s.group = group
+	s.electLeader()
+	return nil
+}
+
+// HealPartition removes any partition so every node can reach every other.
+func (s *Simulator) HealPartition() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.groups = nil
+	s.group = nil
+	s.electLeader()
+}
+
+// Partition returns the current partition groups, or nil if the cluster is
+// not partitioned.
+func (s *Simulator) Partition() [][]int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.groups == nil {
+		return nil
+	}
+	groups := make([][]int, len(s.groups))
+	for g, ids := range s.groups {
+		groups[g] = append([]int{}, ids...)
+	}
+	return groups
+}
+
+// reachable reports whether the nodes with IDs a and b can exchange messages
+// under the current partition. The caller must hold s.mu.
+func (s *Simulator) reachable(a, b int) bool {
+	if s.group == nil {
+		return true
+	}
+	ga, okA := s.group[a]
+	gb, okB := s.group[b]
+	return okA && okB && ga == gb
+}
+
+// forgetPartitionMember removes the node with the given ID from the partition
+// groups, dropping any group left empty. The caller must hold s.mu for
+// writing.
+func (s *Simulator) forgetPartitionMember(id int) {
+	if _, ok := s.group[id]; !ok {
+		return
+	}
+
+	var groups [][]int
+	for _, ids := range s.groups {
+		var kept []int
+		for _, member := range ids {
+			if member != id {
+				kept = append(kept, member)
+			}
+		}
+		if len(kept) > 0 {
+			groups = append(groups, kept)
+		}
+	}
+
+	s.groups = groups
+	s.group = make(map[int]int)
+	for g, ids := range groups {
+		for _, member := range ids {
+			s.group[member] = g
+		}
+	}
+}
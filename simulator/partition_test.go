@@ -0,0 +1,138 @@
+package simulator
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// TestPartition tests that a partition stops values propagating between
+// groups and that healing it lets the cluster converge.
+func TestPartition(t *testing.T) {
+	s := New(Config{Seed: 1, Mode: ModeGossip})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	rr := doRequest(t, h, "POST", "/partitions", `{"groups":[[0,1],[2,3,4]]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, rr.Code, rr.Body)
+	}
+
+	var layout partitionLayout
+	decodeBody(t, doRequest(t, h, "GET", "/partitions", ""), &layout)
+	if want := [][]int{{0, 1}, {2, 3, 4}}; !reflect.DeepEqual(layout.Groups, want) {
+		t.Fatalf("Expected groups %v, but got %v", want, layout.Groups)
+	}
+
+	// Update a node in the first group and let gossip run.
+	s.SetNode(0, "Node-0", 555)
+	for i := 0; i < 50; i++ {
+		s.GossipRound()
+	}
+
+	for _, node := range s.Snapshot() {
+		sawUpdate := node.Value == 555
+		if node.ID <= 1 && !sawUpdate {
+			t.Errorf("Node %d in the updated group did not see the update", node.ID)
+		}
+		if node.ID >= 2 && sawUpdate {
+			t.Errorf("Node %d across the partition saw the update", node.ID)
+		}
+	}
+
+	// Convergence shows divergence between the groups.
+	var c Convergence
+	decodeBody(t, doRequest(t, h, "GET", "/convergence", ""), &c)
+	if c.Converged || len(c.Groups) != 2 {
+		t.Fatalf("Expected divergent groups, got %+v", c)
+	}
+	if !c.Groups[0].Converged || c.Groups[0].LatestValue != 555 {
+		t.Errorf("Expected the first group to converge on 555, got %+v", c.Groups[0])
+	}
+	if !c.Groups[1].Converged || c.Groups[1].LatestValue == 555 {
+		t.Errorf("Expected the second group to converge on its own value, got %+v", c.Groups[1])
+	}
+
+	// Heal and let the cluster reconcile.
+	if rr := doRequest(t, h, "DELETE", "/partitions", ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusNoContent, rr.Code)
+	}
+	decodeBody(t, doRequest(t, h, "GET", "/partitions", ""), &layout)
+	if len(layout.Groups) != 0 {
+		t.Errorf("Expected no groups after healing, got %v", layout.Groups)
+	}
+	for i := 0; i < 50 && !s.Convergence().Converged; i++ {
+		s.GossipRound()
+	}
+	if c := s.Convergence(); !c.Converged || c.LatestValue != 555 || len(c.Groups) != 0 {
+		t.Errorf("Expected convergence on 555 after healing, got %+v", c)
+	}
+}
+
+// TestPartitionRegions tests partitioning the cluster by region.
+func TestPartitionRegions(t *testing.T) {
+	s := New(Config{})
+	s.InitTopology([]Region{{Name: "us-east", Nodes: 2}, {Name: "eu-west", Nodes: 2}, {Name: "ap-south", Nodes: 1}, {Nodes: 1}})
+	h := s.Handler()
+
+	rr := doRequest(t, h, "POST", "/partitions", `{"regions":[["us-east"],["eu-west","ap-south"]]}`)
+	expectCode(t, rr, http.StatusOK)
+	var layout partitionLayout
+	decodeBody(t, rr, &layout)
+	if want := [][]int{{0, 1}, {2, 3, 4}}; !reflect.DeepEqual(layout.Groups, want) {
+		t.Errorf("Expected groups %v, but got %v", want, layout.Groups)
+	}
+	if s.reachable(0, 2) || !s.reachable(2, 4) || s.reachable(5, 0) {
+		t.Errorf("Expected each group of regions to be isolated from the others and node 5 from all")
+	}
+
+	for _, body := range []string{
+		`{"regions":[["us-east"],["us-east"]]}`,
+		`{"regions":[["us-east"],[]]}`,
+		`{"regions":[["mars"]]}`,
+		`{"groups":[[0]],"regions":[["us-east"]]}`,
+	} {
+		expectCode(t, doRequest(t, h, "POST", "/partitions", body), http.StatusBadRequest)
+	}
+	if groups := s.Partition(); len(groups) != 2 {
+		t.Errorf("Expected rejected layouts to leave the partition alone, got %v", groups)
+	}
+}
+
+// TestPartitionValidation tests that invalid partition layouts are rejected
+// without changing the current layout.
+func TestPartitionValidation(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	for _, body := range []string{
+		`{"groups":[[0,1],[1,2]]}`,
+		`{"groups":[[0,9]]}`,
+		`{"groups":[[0],[]]}`,
+		`{"groups":[]}`,
+		`{"groups":`,
+	} {
+		if rr := doRequest(t, h, "POST", "/partitions", body); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status code %d, but got %d", body, http.StatusBadRequest, rr.Code)
+		}
+	}
+	if groups := s.Partition(); groups != nil {
+		t.Errorf("Expected no partition, got %v", groups)
+	}
+}
+
+// TestPartitionForgetsRemovedNodes tests that removing a node drops it from
+// the partition layout.
+func TestPartitionForgetsRemovedNodes(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+
+	if err := s.SetPartition([][]int{{0, 1}, {2}}); err != nil {
+		t.Fatalf("SetPartition failed: %v", err)
+	}
+	s.RemoveNode(2)
+	if want := [][]int{{0, 1}}; !reflect.DeepEqual(s.Partition(), want) {
+		t.Errorf("Expected groups %v, but got %v", want, s.Partition())
+	}
+}
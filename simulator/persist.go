@@ -0,0 +1,201 @@
+package simulator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// snapshotVersion is the format version written to snapshot files. Files
+// with a different version are rejected.
+const snapshotVersion = 1
+
+// Snapshot file names are snapshotPrefix, a UTC timestamp in
+// snapshotTimeFormat, and snapshotSuffix, so they sort chronologically.
+const (
+	snapshotPrefix     = "snapshot-"
+	snapshotSuffix     = ".json"
+	snapshotTimeFormat = "20060102T150405.000000000Z"
+)
+
+// Errors returned by SaveSnapshot, RestoreSnapshot, and RestoreLatest.
+var (
+	// ErrNoDataDir means the simulator was created without Config.DataDir.
+	ErrNoDataDir = errors.New("snapshots require a data directory")
+
+	// ErrNoSnapshot means the requested snapshot file doesn't exist, or the
+	// data directory holds no snapshots at all.
+	ErrNoSnapshot = errors.New("snapshot not found")
+
+	// ErrInvalidSnapshot means a snapshot file is corrupt, has an
+	// unsupported version, or has an invalid name.
+	ErrInvalidSnapshot = errors.New("invalid snapshot")
+)
+
+// snapshotFile is the on-disk format of a snapshot.
+type snapshotFile struct {
+	Version  int        `json:"version"`
+	Time     time.Time  `json:"time"`
+	NextID   int        `json:"next_id"`
+	EventSeq uint64     `json:"event_seq"`
+	Nodes    []NodeData `json:"nodes"`
+}
+
+// SnapshotInfo describes a snapshot that was saved or restored.
+type SnapshotInfo struct {
+	File     string    `json:"file"`
+	Time     time.Time `json:"time"`
+	Nodes    int       `json:"nodes"`
+	EventSeq uint64    `json:"event_seq"`
+}
+
+// SaveSnapshot writes the nodes and the event sequence number to a new file
+// in the data directory and returns its description. The file is written
+// atomically, so a crash never leaves a partial snapshot behind.
+func (s *Simulator) SaveSnapshot() (SnapshotInfo, error) {
+	if s.cfg.DataDir == "" {
+		return SnapshotInfo{}, ErrNoDataDir
+	}
+
+	s.mu.RLock()
+	s.rlockNodes()
+	snap := snapshotFile{
+		Version:  snapshotVersion,
+		Time:     time.Now().UTC(),
+		NextID:   s.nextID,
+		EventSeq: s.eventSeq,
+		Nodes:    cloneNodes(s.nodes),
+	}
+	s.runlockNodes()
+	s.mu.RUnlock()
+
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	if err := os.MkdirAll(s.cfg.DataDir, 0o755); err != nil {
+		return SnapshotInfo{}, err
+	}
+	name := snapshotPrefix + snap.Time.Format(snapshotTimeFormat) + snapshotSuffix
+	tmp, err := os.CreateTemp(s.cfg.DataDir, name+".tmp*")
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return SnapshotInfo{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return SnapshotInfo{}, err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(s.cfg.DataDir, name)); err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	s.logger.Info("snapshot saved", "file", name, "nodes", len(snap.Nodes))
+	return snap.info(name), nil
+}
+
+// RestoreSnapshot replaces the nodes with those in the named snapshot file
+// in the data directory. Like Init, it discards state derived from the old
+// nodes, such as replicated keys and the event log; event sequence numbers
+// continue from the snapshot's. name must be a plain file name. Nothing
+// changes if the file is missing, corrupt, or has an unsupported version.
+func (s *Simulator) RestoreSnapshot(name string) (SnapshotInfo, error) {
+	if s.cfg.DataDir == "" {
+		return SnapshotInfo{}, ErrNoDataDir
+	}
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return SnapshotInfo{}, fmt.Errorf("%w: %q is not a snapshot file name", ErrInvalidSnapshot, name)
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.cfg.DataDir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return SnapshotInfo{}, fmt.Errorf("%w: %s", ErrNoSnapshot, name)
+	}
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	snap, err := parseSnapshot(data)
+	if err != nil {
+		return SnapshotInfo{}, fmt.Errorf("%w: %s: %v", ErrInvalidSnapshot, name, err)
+	}
+
+	s.mu.Lock()
+	nextID := snap.NextID
+	for _, node := range snap.Nodes {
+		nextID = max(nextID, node.ID+1)
+	}
+	s.reset(snap.Nodes, nextID)
+	s.eventSeq = max(s.eventSeq, snap.EventSeq)
+	s.mu.Unlock()
+	s.initialized.Store(true)
+
+	s.logger.Info("snapshot restored", "file", name, "nodes", len(snap.Nodes))
+	return snap.info(name), nil
+}
+
+// RestoreLatest restores the newest snapshot in the data directory. It
+// returns ErrNoSnapshot if there is none.
+func (s *Simulator) RestoreLatest() (SnapshotInfo, error) {
+	if s.cfg.DataDir == "" {
+		return SnapshotInfo{}, ErrNoDataDir
+	}
+
+	entries, err := os.ReadDir(s.cfg.DataDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return SnapshotInfo{}, ErrNoSnapshot
+	}
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasPrefix(name, snapshotPrefix) && strings.HasSuffix(name, snapshotSuffix) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return SnapshotInfo{}, ErrNoSnapshot
+	}
+	sort.Strings(names)
+	return s.RestoreSnapshot(names[len(names)-1])
+}
+
+// parseSnapshot decodes and validates a snapshot file.
+func parseSnapshot(data []byte) (snapshotFile, error) {
+	var snap snapshotFile
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return snapshotFile{}, fmt.Errorf("malformed JSON: %v", err)
+	}
+	if snap.Version != snapshotVersion {
+		return snapshotFile{}, fmt.Errorf("unsupported version %d, expected %d", snap.Version, snapshotVersion)
+	}
+
+	seen := make(map[int]bool, len(snap.Nodes))
+	for _, node := range snap.Nodes {
+		if node.ID < 0 || seen[node.ID] {
+			return snapshotFile{}, fmt.Errorf("invalid or duplicate node ID %d", node.ID)
+		}
+		seen[node.ID] = true
+		if node.Status != StatusUp && node.Status != StatusDown {
+			return snapshotFile{}, fmt.Errorf("node %d has unknown status %q", node.ID, node.Status)
+		}
+	}
+	if snap.Nodes == nil {
+		snap.Nodes = []NodeData{}
+	}
+	return snap, nil
+}
+
+// info describes snap as saved to or restored from the file name.
+func (snap snapshotFile) info(name string) SnapshotInfo {
+	return SnapshotInfo{File: name, Time: snap.Time, Nodes: len(snap.Nodes), EventSeq: snap.EventSeq}
+}
@@ -0,0 +1,103 @@
+package simulator
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestSnapshotRestore tests that restoring a snapshot rolls back changes
+// made after it was taken.
+func TestSnapshotRestore(t *testing.T) {
+	s := New(Config{DataDir: t.TempDir()})
+	s.Init(testNodeCount)
+	s.Fail(1)
+	h := s.Handler()
+
+	rr := doRequest(t, h, "POST", "/snapshot", "")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusCreated, rr.Code, rr.Body)
+	}
+	var info SnapshotInfo
+	decodeBody(t, rr, &info)
+	if info.Nodes != testNodeCount || info.File == "" {
+		t.Fatalf("Unexpected snapshot info: %+v", info)
+	}
+	want := s.Snapshot()
+
+	// Mutate the cluster after the snapshot.
+	s.SetNode(0, "changed", 1000)
+	s.Recover(1)
+	s.RemoveNode(4)
+	s.AddNode("extra", 1)
+	seq := s.EventHistory(0, MaxHistoryLimit).Next
+
+	rr = doRequest(t, h, "POST", "/restore?file="+info.File, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusOK, rr.Code, rr.Body)
+	}
+	var got, saved []NodeData
+	jsonRoundTrip(t, s.Snapshot(), &got)
+	jsonRoundTrip(t, want, &saved)
+	if !reflect.DeepEqual(got, saved) {
+		t.Errorf("Restored nodes differ:\ngot  %+v\nwant %+v", got, saved)
+	}
+
+	// Event sequence numbers keep increasing across the restore.
+	s.AddNode("later", 1)
+	if page := s.EventHistory(0, MaxHistoryLimit); len(page.Events) != 1 || page.Events[0].Seq <= seq {
+		t.Errorf("Expected one event after sequence %d, got %+v", seq, page.Events)
+	}
+}
+
+// TestRestoreRejectsBadSnapshots tests that corrupt, version-mismatched, and
+// escaping snapshot files are rejected without changing the nodes.
+func TestRestoreRejectsBadSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	s := New(Config{DataDir: dir})
+	s.Init(testNodeCount)
+	h := s.Handler()
+	want := s.Snapshot()
+
+	files := map[string]string{
+		"corrupt.json":   `{"version":1,"nodes":[`,
+		"version.json":   `{"version":99,"nodes":[]}`,
+		"duplicate.json": `{"version":1,"nodes":[{"id":1,"status":"up"},{"id":1,"status":"up"}]}`,
+		"status.json":    `{"version":1,"nodes":[{"id":1,"status":"sleeping"}]}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for file, code := range map[string]int{
+		"corrupt.json":    http.StatusBadRequest,
+		"version.json":    http.StatusBadRequest,
+		"duplicate.json":  http.StatusBadRequest,
+		"status.json":     http.StatusBadRequest,
+		"../etc/passwd":   http.StatusBadRequest,
+		"missing.json":    http.StatusNotFound,
+		"snapshot-x.json": http.StatusNotFound,
+	} {
+		rr := doRequest(t, h, "POST", "/restore?file="+file, "")
+		if rr.Code != code {
+			t.Errorf("Restore %s: expected status code %d, but got %d: %s", file, code, rr.Code, rr.Body)
+		}
+	}
+	if got := s.Snapshot(); !reflect.DeepEqual(got, want) {
+		t.Error("A rejected restore changed the nodes")
+	}
+
+	// Without a newest snapshot to restore, or a data directory at all,
+	// restoring fails cleanly.
+	if _, err := New(Config{DataDir: t.TempDir()}).RestoreLatest(); !errors.Is(err, ErrNoSnapshot) {
+		t.Errorf("Expected ErrNoSnapshot, got %v", err)
+	}
+	if rr := doRequest(t, New(Config{}).Handler(), "POST", "/snapshot", ""); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status code %d without a data directory, but got %d", http.StatusConflict, rr.Code)
+	}
+}
@@ -0,0 +1,212 @@
+package simulator
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NodeQuery filters, sorts, and pages the nodes listed by GET /nodes.
+type NodeQuery struct {
+	Status     string // Only nodes with this status, or any status if empty.
+	MinValue   *int   // Only nodes with at least this value, if set.
+	MaxValue   *int   // Only nodes with at most this value, if set.
+	NamePrefix string // Only nodes whose name starts with this prefix.
+	Region     string // Only nodes in this region, or any region if empty.
+	Zone       string // Only nodes in this zone, or any zone if empty.
+	Tags       Tags   // Only nodes carrying every one of these tags.
+	Role       string // Only nodes with this role, or any role if empty.
+	Sort       string // Field to sort by: id, name, value, or time. Empty keeps the stored order.
+	Desc       bool   // Sort in descending order.
+	Offset     int    // Number of matching nodes to skip.
+	Limit      int    // Maximum number of nodes to return, or 0 for all.
+}
+
+// NodePage is one page of the nodes matching a NodeQuery.
+type NodePage struct {
+	Nodes []NodeData `json:"nodes"`
+
+	// Total is the number of nodes matching the query across all pages.
+	Total int `json:"total"`
+
+	// NextOffset is the offset of the following page, or nil if this is
+	// the last one.
+	NextOffset *int `json:"next_offset"`
+}
+
+// nodeQueryParams are the query parameters parseNodeQuery understands.
+var nodeQueryParams = []string{"limit", "offset", "status", "min_value", "max_value", "name_prefix", "region", "zone", "tag", "role", "sort", "order"}
+
+// parseNodeQuery parses a NodeQuery from the query parameters of GET /nodes.
+// It returns nil if none of them is present, in which case the plain node
+// list is served. It writes a 400 response and returns false if a parameter
+// is invalid.
+func parseNodeQuery(w http.ResponseWriter, r *http.Request) (*NodeQuery, bool) {
+	values := r.URL.Query()
+	present := false
+	for _, name := range nodeQueryParams {
+		if values.Has(name) {
+			present = true
+		}
+	}
+	if !present {
+		return nil, true
+	}
+
+	q := &NodeQuery{NamePrefix: values.Get("name_prefix"), Region: values.Get("region"), Zone: values.Get("zone")}
+	for _, tag := range values["tag"] {
+		key, value, ok := strings.Cut(tag, ":")
+		if !ok || key == "" {
+			writeError(w, http.StatusBadRequest, "Query parameter \"tag\" must be key:value")
+			return nil, false
+		}
+		if q.Tags == nil {
+			q.Tags = Tags{}
+		}
+		q.Tags[key] = value
+	}
+	if role := values.Get("role"); role != "" {
+		if validRole(role) != nil {
+			writeError(w, http.StatusBadRequest, "Query parameter \"role\" must be primary, replica, or witness")
+			return nil, false
+		}
+		q.Role = role
+	}
+	switch status := values.Get("status"); status {
+	case "", StatusUp, StatusDown:
+		q.Status = status
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Query parameter \"status\" must be %q or %q", StatusUp, StatusDown))
+		return nil, false
+	}
+
+	switch key := values.Get("sort"); key {
+	case "", "id", "name", "value", "time":
+		q.Sort = key
+	default:
+		writeError(w, http.StatusBadRequest, "Query parameter \"sort\" must be one of id, name, value, or time")
+		return nil, false
+	}
+	switch order := values.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		writeError(w, http.StatusBadRequest, "Query parameter \"order\" must be asc or desc")
+		return nil, false
+	}
+	if q.Desc && q.Sort == "" {
+		q.Sort = "id"
+	}
+
+	var err error
+	if q.Offset, err = intParam(values, "offset"); err != nil || q.Offset < 0 {
+		writeError(w, http.StatusBadRequest, "Query parameter \"offset\" must be a non-negative integer")
+		return nil, false
+	}
+	if q.Limit, err = intParam(values, "limit"); err != nil || (values.Has("limit") && q.Limit < 1) {
+		writeError(w, http.StatusBadRequest, "Query parameter \"limit\" must be a positive integer")
+		return nil, false
+	}
+	for _, bound := range []struct {
+		name string
+		dst  **int
+	}{{"min_value", &q.MinValue}, {"max_value", &q.MaxValue}} {
+		if !values.Has(bound.name) {
+			continue
+		}
+		n, err := strconv.Atoi(values.Get(bound.name))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Query parameter %q must be an integer", bound.name))
+			return nil, false
+		}
+		*bound.dst = &n
+	}
+	if q.MinValue != nil && q.MaxValue != nil && *q.MinValue > *q.MaxValue {
+		writeError(w, http.StatusBadRequest, "Query parameter \"min_value\" must not exceed \"max_value\"")
+		return nil, false
+	}
+	return q, true
+}
+
+// intParam returns the integer query parameter name, or 0 if it is absent.
+func intParam(values url.Values, name string) (int, error) {
+	if !values.Has(name) {
+		return 0, nil
+	}
+	return strconv.Atoi(values.Get(name))
+}
+
+// matches reports whether node satisfies the filters of q.
+func (q NodeQuery) matches(node NodeData) bool {
+	switch {
+	case q.Status != "" && node.Status != q.Status:
+		return false
+	case q.MinValue != nil && node.Value < *q.MinValue:
+		return false
+	case q.MaxValue != nil && node.Value > *q.MaxValue:
+		return false
+	case q.Region != "" && node.Region != q.Region:
+		return false
+	case q.Zone != "" && node.Zone != q.Zone:
+		return false
+	case q.Role != "" && node.Role != q.Role:
+		return false
+	}
+	for key, value := range q.Tags {
+		if got, ok := node.Tags[key]; !ok || got != value {
+			return false
+		}
+	}
+	return strings.HasPrefix(node.Name, q.NamePrefix)
+}
+
+// less reports whether a sorts before b in ascending order of q.Sort.
+func (q NodeQuery) less(a, b NodeData) bool {
+	switch q.Sort {
+	case "name":
+		return a.Name < b.Name
+	case "value":
+		return a.Value < b.Value
+	case "time":
+		return a.Time.Before(b.Time)
+	default:
+		return a.ID < b.ID
+	}
+}
+
+// apply returns the page of nodes selected by q. Sorting is stable, so nodes
+// that compare equal keep their stored order in either direction. The result
+// shares no memory with nodes.
+func (q NodeQuery) apply(nodes []NodeData) NodePage {
+	matched := []NodeData{}
+	for _, node := range nodes {
+		if q.matches(node) {
+			matched = append(matched, node)
+		}
+	}
+
+	if q.Sort != "" {
+		sort.SliceStable(matched, func(i, j int) bool {
+			if q.Desc {
+				return q.less(matched[j], matched[i])
+			}
+			return q.less(matched[i], matched[j])
+		})
+	}
+
+	page := NodePage{Nodes: []NodeData{}, Total: len(matched)}
+	if q.Offset >= len(matched) {
+		return page
+	}
+	end := len(matched)
+	if q.Limit > 0 && q.Offset+q.Limit < end {
+		end = q.Offset + q.Limit
+		page.NextOffset = &end
+	}
+	page.Nodes = cloneNodes(matched[q.Offset:end])
+	return page
+}
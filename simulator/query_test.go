@@ -0,0 +1,215 @@
+package simulator
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// TestNodePaging tests paging through a 50-node cluster with limit and
+// offset.
+func TestNodePaging(t *testing.T) {
+	s := New(Config{})
+	s.Init(50)
+	h := s.Handler()
+
+	var ids []int
+	offset := 0
+	for pages := 0; ; pages++ {
+		if pages == 10 {
+			t.Fatal("Paging did not terminate")
+		}
+		var page NodePage
+		decodeBody(t, doRequest(t, h, "GET", fmt.Sprintf("/nodes?limit=15&offset=%d", offset), ""), &page)
+		if page.Total != 50 {
+			t.Errorf("Expected a total of 50 nodes, got %d", page.Total)
+		}
+		if len(page.Nodes) > 15 {
+			t.Errorf("Expected at most 15 nodes per page, got %d", len(page.Nodes))
+		}
+		for _, node := range page.Nodes {
+			ids = append(ids, node.ID)
+		}
+		if page.NextOffset == nil {
+			break
+		}
+		offset = *page.NextOffset
+	}
+
+	if len(ids) != 50 {
+		t.Fatalf("Expected 50 nodes across all pages, got %d", len(ids))
+	}
+	for i, id := range ids {
+		if id != i {
+			t.Fatalf("Expected node %d at position %d, got %d", i, i, id)
+		}
+	}
+
+	var page NodePage
+	decodeBody(t, doRequest(t, h, "GET", "/nodes?offset=60", ""), &page)
+	if len(page.Nodes) != 0 || page.Total != 50 || page.NextOffset != nil {
+		t.Errorf("Expected an empty last page past the end, got %+v", page)
+	}
+}
+
+// TestNodeFilters tests filtering GET /nodes by status, value, and name.
+func TestNodeFilters(t *testing.T) {
+	s := New(Config{})
+	s.Init(50)
+	h := s.Handler()
+	for id := 0; id < 50; id++ {
+		s.SetNode(id, fmt.Sprintf("Node-%d", id), id)
+		if id%5 == 0 {
+			s.Fail(id)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  int
+		check func(NodeData) bool
+	}{
+		{"status=down", 10, func(n NodeData) bool { return n.Status == StatusDown }},
+		{"status=up", 40, func(n NodeData) bool { return n.Status == StatusUp }},
+		{"min_value=10&max_value=19", 10, func(n NodeData) bool { return n.Value >= 10 && n.Value <= 19 }},
+		{"name_prefix=Node-4", 11, func(n NodeData) bool { return n.ID == 4 || n.ID/10 == 4 }},
+		{"status=down&min_value=20", 6, func(n NodeData) bool { return n.Status == StatusDown && n.Value >= 20 }},
+	}
+	for _, tt := range tests {
+		var page NodePage
+		decodeBody(t, doRequest(t, h, "GET", "/nodes?"+tt.query, ""), &page)
+		if page.Total != tt.want || len(page.Nodes) != tt.want {
+			t.Errorf("%s: expected %d nodes, got %d of %d", tt.query, tt.want, len(page.Nodes), page.Total)
+		}
+		for _, node := range page.Nodes {
+			if !tt.check(node) {
+				t.Errorf("%s: node %+v doesn't match", tt.query, node)
+			}
+		}
+	}
+}
+
+// TestNodeMetadataFilters tests filtering GET /nodes by region, zone, and
+// tags.
+func TestNodeMetadataFilters(t *testing.T) {
+	s := New(Config{})
+	s.InitTopology([]Region{{Name: "us-east", Nodes: 3}, {Name: "eu-west", Nodes: 2}, {Nodes: 1}})
+	h := s.Handler()
+	zone, rack, canary := "us-east-1a", "r1", "true"
+	s.PatchMetadata(0, MetadataPatch{Zone: &zone, Tags: map[string]*string{"rack": &rack}})
+	s.PatchMetadata(1, MetadataPatch{Zone: &zone, Tags: map[string]*string{"rack": &rack, "canary": &canary}})
+	s.PatchMetadata(3, MetadataPatch{Tags: map[string]*string{"rack": &rack}})
+
+	for query, want := range map[string][]int{
+		"region=us-east":                            {0, 1, 2},
+		"region=eu-west":                            {3, 4},
+		"region=ap-south":                           {},
+		"zone=us-east-1a":                           {0, 1},
+		"tag=rack:r1":                               {0, 1, 3},
+		"tag=rack:r1&tag=canary:true":               {1},
+		"tag=rack:r2":                               {},
+		"region=eu-west&tag=rack:r1":                {3},
+		"region=us-east&sort=id&order=desc":         {2, 1, 0},
+		"tag=rack:r1&limit=2&sort=id":               {0, 1},
+		"zone=us-east-1a&tag=canary:true&status=up": {1},
+	} {
+		var page NodePage
+		decodeBody(t, doRequest(t, h, "GET", "/nodes?"+query, ""), &page)
+		ids := []int{}
+		for _, node := range page.Nodes {
+			ids = append(ids, node.ID)
+		}
+		if !reflect.DeepEqual(ids, want) {
+			t.Errorf("%s: expected nodes %v, got %v", query, want, ids)
+		}
+	}
+}
+
+// TestNodeQueryInvalid tests that invalid GET /nodes parameters return 400.
+func TestNodeQueryInvalid(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	for _, query := range []string{
+		"limit=0",
+		"limit=many",
+		"offset=-1",
+		"status=sleeping",
+		"min_value=low",
+		"min_value=10&max_value=5",
+		"tag=rack",
+		"tag=:r1",
+	} {
+		rr := doRequest(t, h, "GET", "/nodes?"+query, "")
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status code %d, got %d", query, http.StatusBadRequest, rr.Code)
+			continue
+		}
+		var body ErrorResponse
+		decodeBody(t, rr, &body)
+		if body.Error.Code != ErrorCodeBadRequest || body.Error.Message == "" {
+			t.Errorf("%s: expected an error message, got %s", query, rr.Body)
+		}
+	}
+}
+
+// TestNodeSort tests sorting GET /nodes by each key, the stability of equal
+// values, and sorting combined with paging.
+func TestNodeSort(t *testing.T) {
+	s := New(Config{})
+	s.Init(6)
+	h := s.Handler()
+	// Values repeat so stability is observable; names sort in reverse ID
+	// order.
+	for id, value := range []int{30, 10, 30, 20, 10, 30} {
+		s.SetNode(id, fmt.Sprintf("Node-%c", 'f'-id), value)
+	}
+	s.SetNode(2, "Node-d", 30) // Node 2 now has the latest time.
+
+	ids := func(query string) []int {
+		t.Helper()
+		var page NodePage
+		decodeBody(t, doRequest(t, h, "GET", "/nodes?"+query, ""), &page)
+		out := make([]int, len(page.Nodes))
+		for i, node := range page.Nodes {
+			out[i] = node.ID
+		}
+		return out
+	}
+
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		{"sort=id", []int{0, 1, 2, 3, 4, 5}},
+		{"sort=id&order=desc", []int{5, 4, 3, 2, 1, 0}},
+		{"sort=name", []int{5, 4, 3, 2, 1, 0}},
+		{"sort=value", []int{1, 4, 3, 0, 2, 5}},
+		{"sort=value&order=desc", []int{0, 2, 5, 3, 1, 4}},
+		{"sort=time", []int{0, 1, 3, 4, 5, 2}},
+		{"sort=time&order=desc", []int{2, 5, 4, 3, 1, 0}},
+		{"sort=value&order=desc&limit=2", []int{0, 2}},
+		{"sort=value&order=desc&limit=2&offset=2", []int{5, 3}},
+		{"sort=value&status=up&min_value=20", []int{3, 0, 2, 5}},
+	}
+	for _, tt := range tests {
+		if got := ids(tt.query); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected IDs %v, got %v", tt.query, tt.want, got)
+		}
+	}
+
+	// The stored order is unchanged.
+	for i, node := range s.Snapshot() {
+		if node.ID != i {
+			t.Fatalf("Expected node %d at position %d, got %d", i, i, node.ID)
+		}
+	}
+
+	for _, query := range []string{"sort=hotness", "order=sideways"} {
+		if rr := doRequest(t, h, "GET", "/nodes?"+query, ""); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status code %d, got %d", query, http.StatusBadRequest, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package simulator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// DefaultQueueCapacity is the number of tasks the work queue holds before it
+// drops new ones, until SetQueueConfig changes it.
+const DefaultQueueCapacity = 100
+
+// queueThroughputWindow is the span of simulation time QueueStats measures
+// throughput over.
+const queueThroughputWindow = 10 * time.Second
+
+// ErrInvalidQueue means a work queue configuration was rejected.
+var ErrInvalidQueue = errors.New("invalid queue configuration")
+
+// QueueConfig sets up the simulated work queue: producer nodes put tasks on
+// a bounded queue and consumer nodes take them off it, one at a time each.
+type QueueConfig struct {
+	Producers   []int    `json:"producers"`    // IDs of the nodes producing tasks.
+	Consumers   []int    `json:"consumers"`    // IDs of the nodes serving tasks.
+	ArrivalRate float64  `json:"arrival_rate"` // Tasks per second each up producer generates.
+	ServiceTime Duration `json:"service_time"` // How long a consumer takes to serve a task.
+	Capacity    int      `json:"capacity"`     // Tasks the queue holds before it drops new ones.
+}
+
+// validate returns an error wrapping ErrInvalidQueue if c is invalid.
+func (c QueueConfig) validate() error {
+	switch {
+	case c.ArrivalRate < 0 || math.IsNaN(c.ArrivalRate) || math.IsInf(c.ArrivalRate, 0):
+		return fmt.Errorf("%w: arrival_rate must be a non-negative number", ErrInvalidQueue)
+	case c.ServiceTime < 0 || c.ServiceTime == 0 && len(c.Consumers) > 0:
+		return fmt.Errorf("%w: service_time must be positive", ErrInvalidQueue)
+	case c.Capacity < 1:
+		return fmt.Errorf("%w: capacity must be at least 1", ErrInvalidQueue)
+	}
+	for _, ids := range [][]int{c.Producers, c.Consumers} {
+		seen := make(map[int]bool, len(ids))
+		for _, id := range ids {
+			if seen[id] {
+				return fmt.Errorf("%w: node %d is listed twice", ErrInvalidQueue, id)
+			}
+			seen[id] = true
+		}
+	}
+	return nil
+}
+
+// clone returns a copy of c that shares no memory with it, with empty rather
+// than nil node lists.
+func (c QueueConfig) clone() QueueConfig {
+	c.Producers = append([]int{}, c.Producers...)
+	c.Consumers = append([]int{}, c.Consumers...)
+	return c
+}
+
+// QueueStats reports the state of the work queue and how it has fared.
+type QueueStats struct {
+	Config    QueueConfig `json:"config"`
+	Depth     int         `json:"depth"`      // Tasks waiting in the queue.
+	InService int         `json:"in_service"` // Tasks being served by a consumer.
+	Produced  uint64      `json:"produced"`
+	Completed uint64      `json:"completed"`
+	Dropped   uint64      `json:"dropped"` // Tasks dropped because the queue was full.
+
+	// Offered and Throughput are the tasks produced and completed per
+	// second over the last ten seconds of simulation time.
+	Offered    float64 `json:"offered"`
+	Throughput float64 `json:"throughput"`
+
+	// Latency describes the time from a task being produced to its being
+	// served, over the most recently completed tasks.
+	Latency LatencyPercentiles `json:"latency"`
+}
+
+// queuedTask is a task in the work queue.
+type queuedTask struct {
+	producer int
+	created  time.Time
+}
+
+// queueConsumer is what a consumer is serving.
+type queueConsumer struct {
+	task   queuedTask
+	busy   bool
+	doneAt time.Time
+}
+
+// queueSample is the work queue's counters at the end of a round.
+type queueSample struct {
+	at                  time.Time
+	produced, completed uint64
+}
+
+// workQueue is the state of the simulated work queue.
+type workQueue struct {
+	cfg       QueueConfig
+	tasks     []queuedTask // Oldest first.
+	consumers map[int]*queueConsumer
+	credit    map[int]float64 // Fractions of a task each producer is partway through.
+	last      time.Time       // Time of the last round, or zero before the first.
+
+	produced, completed, dropped uint64
+
+	latencies durationRing  // Recent task latencies.
+	samples   []queueSample // Recent rounds, oldest first.
+}
+
+// requeue puts the task the consumer with the given ID is serving back at
+// the front of the queue, if it is serving one.
+func (q *workQueue) requeue(id int) {
+	if c := q.consumers[id]; c != nil && c.busy {
+		q.tasks = append([]queuedTask{c.task}, q.tasks...)
+		c.busy = false
+	}
+}
+
+// observe records the latency of a completed task.
+func (q *workQueue) observe(latency time.Duration) {
+	q.completed++
+	q.latencies.add(latency)
+}
+
+// SetQueueConfig replaces the configuration of the work queue. Tasks already
+// queued stay, except those beyond a smaller capacity, which are dropped,
+// and consumers no longer listed put the task they are serving back at the
+// front of the queue. It returns ErrNodeNotFound if a listed node doesn't
+// exist and an error wrapping ErrInvalidQueue if cfg is otherwise invalid.
+func (s *Simulator) SetQueueConfig(cfg QueueConfig) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range append(slices.Clone(cfg.Producers), cfg.Consumers...) {
+		if s.findNode(id) < 0 {
+			return ErrNodeNotFound
+		}
+	}
+	q := &s.queue
+	for id := range q.consumers {
+		if !slices.Contains(cfg.Consumers, id) {
+			q.requeue(id)
+			delete(q.consumers, id)
+		}
+	}
+	for id := range q.credit {
+		if !slices.Contains(cfg.Producers, id) {
+			delete(q.credit, id)
+		}
+	}
+	if excess := len(q.tasks) - cfg.Capacity; excess > 0 {
+		q.tasks = q.tasks[:cfg.Capacity]
+		q.dropped += uint64(excess)
+	}
+	q.cfg = cfg.clone()
+	if q.last.IsZero() {
+		q.last = s.cfg.Clock.Now()
+	}
+	s.logger.Info("queue configured", "producers", len(cfg.Producers), "consumers", len(cfg.Consumers),
+		"arrival_rate", cfg.ArrivalRate, "service_time", time.Duration(cfg.ServiceTime), "capacity", cfg.Capacity)
+	return nil
+}
+
+// StartQueue runs a work queue round once per interval until ctx is
+// cancelled. It blocks, so callers typically run it in its own goroutine.
+func (s *Simulator) StartQueue(ctx context.Context, interval time.Duration) {
+	ticker := s.cfg.Clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			s.QueueRound()
+		}
+	}
+}
+
+// QueueRound advances the work queue to the current simulation time. Up
+// consumers serve queued tasks one after another, each taking the service
+// time, over the time since the last round; a consumer that is down puts the
+// task it was serving back at the front of the queue. Then every up producer
+// adds the tasks its arrival rate generated in that time, dropping those
+// that find the queue full. A round before the queue is configured only
+// starts the clock.
+func (s *Simulator) QueueRound() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.cfg.Clock.Now()
+	q := &s.queue
+	if q.last.IsZero() || !now.After(q.last) {
+		q.last = now
+		return
+	}
+	s.serveTasks(now)
+	s.produceTasks(now)
+	q.last = now
+
+	q.samples = append(q.samples, queueSample{at: now, produced: q.produced, completed: q.completed})
+	for len(q.samples) > 2 && !q.samples[1].at.After(now.Add(-queueThroughputWindow)) {
+		q.samples = q.samples[1:]
+	}
+}
+
+// serveTasks has every up consumer serve queued tasks until now. The caller
+// must hold s.mu for writing.
+func (s *Simulator) serveTasks(now time.Time) {
+	q := &s.queue
+	if q.consumers == nil {
+		q.consumers = make(map[int]*queueConsumer)
+	}
+	for _, id := range q.cfg.Consumers {
+		if s.nodes[s.findNode(id)].Status != StatusUp {
+			q.requeue(id)
+			continue
+		}
+		c := q.consumers[id]
+		if c == nil {
+			c = &queueConsumer{}
+			q.consumers[id] = c
+		}
+		free := q.last
+		for {
+			if c.busy {
+				if c.doneAt.After(now) {
+					break
+				}
+				q.observe(c.doneAt.Sub(c.task.created))
+				free, c.busy = c.doneAt, false
+			}
+			if len(q.tasks) == 0 {
+				break
+			}
+			task := q.tasks[0]
+			q.tasks = q.tasks[1:]
+			start := free
+			if task.created.After(start) {
+				start = task.created
+			}
+			c.task, c.busy, c.doneAt = task, true, start.Add(time.Duration(q.cfg.ServiceTime))
+		}
+	}
+}
+
+// produceTasks adds the tasks every up producer generated since the last
+// round to the queue. The caller must hold s.mu for writing.
+func (s *Simulator) produceTasks(now time.Time) {
+	q := &s.queue
+	if q.credit == nil {
+		q.credit = make(map[int]float64)
+	}
+	elapsed := now.Sub(q.last).Seconds()
+	for _, id := range q.cfg.Producers {
+		if s.nodes[s.findNode(id)].Status != StatusUp {
+			continue
+		}
+		credit := q.credit[id] + q.cfg.ArrivalRate*elapsed
+		n := int(credit)
+		q.credit[id] = credit - float64(n)
+		for ; n > 0; n-- {
+			q.produced++
+			if len(q.tasks) >= q.cfg.Capacity {
+				q.dropped++
+				continue
+			}
+			q.tasks = append(q.tasks, queuedTask{producer: id, created: now})
+		}
+	}
+}
+
+// forgetQueueNode removes the node with the given ID from the producers and
+// consumers, putting the task it was serving back at the front of the
+// queue. The caller must hold s.mu for writing.
+func (s *Simulator) forgetQueueNode(id int) {
+	q := &s.queue
+	q.cfg.Producers = slices.DeleteFunc(q.cfg.Producers, func(p int) bool { return p == id })
+	q.cfg.Consumers = slices.DeleteFunc(q.cfg.Consumers, func(c int) bool { return c == id })
+	q.requeue(id)
+	delete(q.consumers, id)
+	delete(q.credit, id)
+}
+
+// QueueStats returns the state of the work queue and its throughput and
+// latency.
+func (s *Simulator) QueueStats() QueueStats {
+	s.mu.RLock()
+	q := &s.queue
+	stats := QueueStats{
+		Config:    q.cfg.clone(),
+		Depth:     len(q.tasks),
+		Produced:  q.produced,
+		Completed: q.completed,
+		Dropped:   q.dropped,
+	}
+	for _, c := range q.consumers {
+		if c.busy {
+			stats.InService++
+		}
+	}
+	if n := len(q.samples); n > 1 {
+		first, last := q.samples[0], q.samples[n-1]
+		span := last.at.Sub(first.at).Seconds()
+		stats.Offered = float64(last.produced-first.produced) / span
+		stats.Throughput = float64(last.completed-first.completed) / span
+	}
+	latencies := slices.Clone(q.latencies.samples)
+	s.mu.RUnlock()
+
+	stats.Latency = latencyPercentiles(latencies)
+	return stats
+}
+
+// getQueueStats handles HTTP requests for the state of the work queue.
+func (s *Simulator) getQueueStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.QueueStats())
+}
+
+// patchQueueConfig handles HTTP requests to change the work queue from a
+// body like {"arrival_rate":20,"service_time":"50ms"}. Fields left out keep
+// their current values.
+func (s *Simulator) patchQueueConfig(w http.ResponseWriter, r *http.Request) {
+	payload := s.QueueStats().Config
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "Malformed JSON body")
+		return
+	}
+
+	err := s.SetQueueConfig(payload)
+	switch {
+	case errors.Is(err, ErrNodeNotFound):
+		writeError(w, http.StatusNotFound, "Node not found")
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, s.QueueStats())
+	}
+}
@@ -0,0 +1,100 @@
+package simulator
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// runQueue steps clock and runs a work queue round n times.
+func runQueue(t *testing.T, s *Simulator, clock *VirtualClock, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := clock.Step(); err != nil {
+			t.Fatalf("Step failed: %v", err)
+		}
+		s.QueueRound()
+	}
+}
+
+// TestQueueSaturation tests that tasks arriving faster than they are served
+// fill the queue and are then dropped.
+func TestQueueSaturation(t *testing.T) {
+	clock := latencyClock(t)
+	s := New(Config{Clock: clock})
+	s.Init(3)
+	h := s.Handler()
+
+	// Two producers offer 4 tasks a second against one consumer serving 2.
+	rr := doRequest(t, h, "PATCH", "/queue/config", `{"producers":[0,1],"consumers":[2],"arrival_rate":2,"service_time":"500ms","capacity":10}`)
+	expectCode(t, rr, http.StatusOK)
+	runQueue(t, s, clock, 20)
+
+	var stats QueueStats
+	decodeBody(t, doRequest(t, h, "GET", "/queue/stats", ""), &stats)
+	if stats.Depth != 10 {
+		t.Errorf("Expected the queue to saturate at 10 tasks, got %d", stats.Depth)
+	}
+	if stats.Dropped == 0 || stats.Produced != stats.Completed+stats.Dropped+uint64(stats.Depth+stats.InService) {
+		t.Errorf("Expected drops and every task accounted for, got %+v", stats)
+	}
+	if stats.Offered != 4 || stats.Throughput != 2 {
+		t.Errorf("Expected 4 tasks offered and 2 served per second, got %v and %v", stats.Offered, stats.Throughput)
+	}
+	if stats.Latency.P99 < Duration(5*time.Second) || stats.Latency.P50 > stats.Latency.P99 || stats.Latency.P99 > stats.Latency.Max {
+		t.Errorf("Expected tasks to wait behind a full queue, got latencies %+v", stats.Latency)
+	}
+
+	// Speeding up the consumer at runtime drains the queue, leaving only
+	// the 4 tasks produced at the end of the last round.
+	expectCode(t, doRequest(t, h, "PATCH", "/queue/config", `{"service_time":"100ms"}`), http.StatusOK)
+	runQueue(t, s, clock, 5)
+	if stats := s.QueueStats(); stats.Depth != 4 || stats.Config.ArrivalRate != 2 || len(stats.Config.Producers) != 2 {
+		t.Errorf("Expected the faster consumer to drain the queue and the rest of the config to stay, got %+v", stats)
+	}
+
+	for body, want := range map[string]int{
+		`{"capacity":0}`:            http.StatusBadRequest,
+		`{"arrival_rate":-1}`:       http.StatusBadRequest,
+		`{"service_time":"0s"}`:     http.StatusBadRequest,
+		`{"consumers":[2,2]}`:       http.StatusBadRequest,
+		`{"producers":[9]}`:         http.StatusNotFound,
+		`{"rate":1}`:                http.StatusBadRequest,
+		`{"service_time":"slowly"}`: http.StatusBadRequest,
+	} {
+		expectCode(t, doRequest(t, h, "PATCH", "/queue/config", body), want)
+	}
+}
+
+// TestQueueConsumerFailure tests that the queue grows while its consumer is
+// down and drains once it recovers.
+func TestQueueConsumerFailure(t *testing.T) {
+	clock := latencyClock(t)
+	s := New(Config{Clock: clock})
+	s.Init(2)
+	if err := s.SetQueueConfig(QueueConfig{Producers: []int{0}, Consumers: []int{1}, ArrivalRate: 1, ServiceTime: Duration(100 * time.Millisecond), Capacity: 100}); err != nil {
+		t.Fatalf("SetQueueConfig failed: %v", err)
+	}
+	runQueue(t, s, clock, 5)
+	if depth := s.QueueStats().Depth; depth > 1 {
+		t.Fatalf("Expected a consumer faster than the load to keep up, got depth %d", depth)
+	}
+
+	s.Fail(1)
+	runQueue(t, s, clock, 5)
+	if depth := s.QueueStats().Depth; depth < 5 {
+		t.Errorf("Expected the queue to grow while the consumer is down, got depth %d", depth)
+	}
+
+	s.Recover(1)
+	runQueue(t, s, clock, 2)
+	if stats := s.QueueStats(); stats.Depth > 1 || stats.Dropped != 0 {
+		t.Errorf("Expected the recovered consumer to drain the queue, got %+v", stats)
+	}
+
+	// Removing the consumer takes it off the queue.
+	s.RemoveNode(1)
+	if stats := s.QueueStats(); len(stats.Config.Consumers) != 0 {
+		t.Errorf("Expected no consumers left, got %v", stats.Config.Consumers)
+	}
+}
@@ -0,0 +1,228 @@
+package simulator
+
+import (
+	"errors"
+	"fmt"
+)
+
+// LogEntry is one entry of a node's replicated log. Indices start at 1.
+type LogEntry struct {
+	Index   int    `json:"index"`
+	Term    uint64 `json:"term"`
+	Command string `json:"command"`
+}
+
+// RaftLog describes the cluster's committed log.
+type RaftLog struct {
+	Term        uint64     `json:"term"`
+	Leader      *int       `json:"leader"` // Nil while no leader is elected.
+	CommitIndex int        `json:"commit_index"`
+	Entries     []LogEntry `json:"entries"`
+}
+
+// NodeLog describes one node's local copy of the replicated log, which may
+// lag behind or run ahead of the committed log.
+type NodeLog struct {
+	ID      int        `json:"id"`
+	Term    uint64     `json:"term"`
+	Entries []LogEntry `json:"entries"`
+}
+
+// Errors returned by AppendLog.
+var (
+	// ErrNotRaftMode means the simulator is not running in ModeRaft.
+	ErrNotRaftMode = errors.New("log replication requires raft mode")
+
+	// ErrNoLeader means no node could gather a majority to become leader.
+	ErrNoLeader = errors.New("no leader is elected")
+)
+
+// AppendLog appends command to the leader's log and replicates it to every
+// up follower the leader can reach. The entry is committed once a majority of
+// the cluster holds it. If it cannot be committed yet, AppendLog returns the
+// entry along with an error wrapping ErrQuorumUnavailable; the entry stays in
+// the leader's log and commits once enough followers catch up.
+func (s *Simulator) AppendLog(command string) (LogEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.appendCommand(command)
+}
+
+// appendCommand implements AppendLog. The caller must hold s.mu for writing.
+func (s *Simulator) appendCommand(command string) (LogEntry, error) {
+	if s.Mode() != ModeRaft {
+		return LogEntry{}, ErrNotRaftMode
+	}
+	leader := s.findNode(s.raftLeader)
+	if s.raftLeader < 0 || leader < 0 {
+		return LogEntry{}, ErrNoLeader
+	}
+
+	id := s.nodes[leader].ID
+	entry := LogEntry{Index: len(s.raftLogs[id]) + 1, Term: s.term, Command: command}
+	s.raftLogs[id] = append(s.raftLogs[id], entry)
+	if acks := s.replicate(); !s.majority(acks) {
+		return entry, fmt.Errorf("%w: entry %d reached %d of %d nodes", ErrQuorumUnavailable, entry.Index, acks, len(s.nodes))
+	}
+	return entry, nil
+}
+
+// CommittedLog returns the cluster's committed log.
+func (s *Simulator) CommittedLog() RaftLog {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	committed := RaftLog{
+		Term:        s.term,
+		CommitIndex: len(s.committed),
+		Entries:     append([]LogEntry{}, s.committed...),
+	}
+	if s.raftLeader >= 0 {
+		leader := s.raftLeader
+		committed.Leader = &leader
+	}
+	return committed
+}
+
+// NodeLog returns the local log of the node with the given ID and false if no
+// such node exists.
+func (s *Simulator) NodeLog(id int) (NodeLog, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	index := s.findNode(id)
+	if index < 0 {
+		return NodeLog{}, false
+	}
+	return NodeLog{
+		ID:      id,
+		Term:    s.nodes[index].Term,
+		Entries: append([]LogEntry{}, s.raftLogs[id]...),
+	}, true
+}
+
+// raftCandidate returns the index of the node that wins a Raft election, or
+// -1 if no node can. A candidate must be able to lead, and it wins with votes
+// from a majority of the cluster. An up node it can reach votes for it unless
+// the voter's own log is more up to date, so the winner holds every committed
+// entry. Among candidates that could win, the lowest ID wins. The caller must
+// hold s.mu.
+func (s *Simulator) raftCandidate() int {
+	winner := -1
+	for i, node := range s.nodes {
+		if !s.canLead(i) {
+			continue
+		}
+		if winner >= 0 && s.nodes[winner].ID < node.ID {
+			continue
+		}
+		votes := 0
+		for _, voter := range s.nodes {
+			if voter.Status == StatusUp && s.reachable(node.ID, voter.ID) && !s.moreUpToDate(voter.ID, node.ID) {
+				votes++
+			}
+		}
+		if s.majority(votes) {
+			winner = i
+		}
+	}
+	return winner
+}
+
+// moreUpToDate reports whether the log of node a is strictly more up to date
+// than the log of node b: its last entry has a later term, or the same term
+// and a higher index. The caller must hold s.mu.
+func (s *Simulator) moreUpToDate(a, b int) bool {
+	la, lb := s.raftLogs[a], s.raftLogs[b]
+	var ta, tb uint64
+	if len(la) > 0 {
+		ta = la[len(la)-1].Term
+	}
+	if len(lb) > 0 {
+		tb = lb[len(lb)-1].Term
+	}
+	if ta != tb {
+		return ta > tb
+	}
+	return len(la) > len(lb)
+}
+
+// raftElected records the outcome of an election that chose the node at
+// index, or no node if index is negative. A new leader starts a new term.
+// The caller must hold s.mu for writing.
+func (s *Simulator) raftElected(index int) {
+	if index < 0 {
+		if s.raftLeader >= 0 {
+			s.logger.Warn("raft leader lost", "node_id", s.raftLeader, "term", s.term)
+		}
+		s.raftLeader = -1
+		return
+	}
+
+	if id := s.nodes[index].ID; id != s.raftLeader {
+		s.term++
+		s.raftLeader = id
+		s.nodes[index].Term = s.term
+		s.version++
+		s.logger.Info("raft leader elected", "node_id", id, "term", s.term)
+	}
+	s.replicate()
+}
+
+// replicate copies the leader's log to every up follower it can reach,
+// overwriting any conflicting entries, and advances the commit index if a
+// majority of the cluster acknowledges the leader's log. On a lossy link
+// either the entries or the acknowledgement may be lost. It returns the
+// number of acknowledgements, counting the leader's own. The caller must hold
+// s.mu for writing.
+func (s *Simulator) replicate() int {
+	leader := s.findNode(s.raftLeader)
+	if s.raftLeader < 0 || leader < 0 {
+		return 0
+	}
+
+	entries := s.raftLogs[s.raftLeader]
+	acks := 1
+	for i := range s.nodes {
+		follower := &s.nodes[i]
+		if i == leader || follower.Status != StatusUp || !s.reachable(s.raftLeader, follower.ID) {
+			continue
+		}
+		if !s.deliver(s.raftLeader, follower.ID) {
+			continue
+		}
+		s.raftLogs[follower.ID] = appendEntries(s.raftLogs[follower.ID], entries)
+		if follower.Term != s.term {
+			follower.Term = s.term
+			s.version++
+		}
+		if s.deliver(follower.ID, s.raftLeader) {
+			acks++
+		}
+	}
+
+	// Like Raft, only commit by counting replicas of an entry from the
+	// current term; earlier entries are committed along with it.
+	if s.majority(acks) && len(entries) > len(s.committed) && entries[len(entries)-1].Term == s.term {
+		start := len(s.committed)
+		s.committed = append(s.committed, entries[start:]...)
+		s.applyCommitted(s.committed[start:])
+	}
+	return acks
+}
+
+// appendEntries returns local updated to match the leader's entries: it
+// keeps the longest prefix that agrees with the leader and replaces the rest.
+func appendEntries(local, entries []LogEntry) []LogEntry {
+	match := 0
+	for match < len(local) && match < len(entries) && local[match].Term == entries[match].Term {
+		match++
+	}
+	return append(local[:match], entries[match:]...)
+}
+
+// majority reports whether count nodes form a majority of the cluster. The
+// caller must hold s.mu.
+func (s *Simulator) majority(count int) bool {
+	return count*2 > len(s.nodes)
+}
@@ -0,0 +1,183 @@
+package simulator
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// appendCommands appends each command to s's log and fails the test if any
+// is not committed.
+func appendCommands(t *testing.T, s *Simulator, commands ...string) {
+	t.Helper()
+
+	for _, command := range commands {
+		if _, err := s.AppendLog(command); err != nil {
+			t.Fatalf("AppendLog(%q): %v", command, err)
+		}
+	}
+}
+
+// expectCode fails the test unless rr has the wanted status code.
+func expectCode(t *testing.T, rr *httptest.ResponseRecorder, want int) {
+	t.Helper()
+
+	if rr.Code != want {
+		t.Fatalf("Expected status code %d, but got %d: %s", want, rr.Code, rr.Body)
+	}
+}
+
+// commands returns the commands of entries in order.
+func commands(entries []LogEntry) []string {
+	var out []string
+	for _, entry := range entries {
+		out = append(out, entry.Command)
+	}
+	return out
+}
+
+// TestRaftFollowerCatchesUp tests that a follower that misses entries while
+// down receives them when it recovers, so every log converges on the
+// committed log.
+func TestRaftFollowerCatchesUp(t *testing.T) {
+	s := New(Config{Mode: ModeRaft})
+	s.Init(testNodeCount)
+
+	appendCommands(t, s, "a", "b")
+	s.Fail(3)
+	appendCommands(t, s, "c", "d")
+
+	if got := commands(s.CommittedLog().Entries); !reflect.DeepEqual(got, []string{"a", "b", "c", "d"}) {
+		t.Fatalf("Expected committed log [a b c d], got %v", got)
+	}
+	if lagging, _ := s.NodeLog(3); len(lagging.Entries) != 2 {
+		t.Fatalf("Expected failed node 3 to hold 2 entries, got %d", len(lagging.Entries))
+	}
+
+	s.Recover(3)
+	committed := s.CommittedLog()
+	for id := 0; id < testNodeCount; id++ {
+		nodeLog, _ := s.NodeLog(id)
+		if !reflect.DeepEqual(nodeLog.Entries, committed.Entries) {
+			t.Errorf("Node %d log %v does not match committed log %v", id, nodeLog.Entries, committed.Entries)
+		}
+		if nodeLog.Term != committed.Term {
+			t.Errorf("Node %d is in term %d, expected %d", id, nodeLog.Term, committed.Term)
+		}
+	}
+}
+
+// TestRaftLeaderFailover tests that failing the leader starts a new term
+// under a new leader that keeps every committed entry.
+func TestRaftLeaderFailover(t *testing.T) {
+	s := New(Config{Mode: ModeRaft})
+	s.Init(testNodeCount)
+
+	first := s.CommittedLog()
+	if first.Leader == nil || *first.Leader != 0 || first.Term != 1 {
+		t.Fatalf("Expected node 0 to lead term 1, got leader %v in term %d", first.Leader, first.Term)
+	}
+	appendCommands(t, s, "a", "b")
+
+	// Node 1 misses entry c while down, so when it recovers after the
+	// leader fails its stale log keeps it from winning despite its lower ID.
+	s.Fail(1)
+	appendCommands(t, s, "c")
+	s.Fail(0)
+	s.Recover(1)
+
+	second := s.CommittedLog()
+	if second.Leader == nil || *second.Leader != 2 || second.Term != 2 {
+		t.Fatalf("Expected node 2 to lead term 2, got leader %v in term %d", second.Leader, second.Term)
+	}
+	if leader, ok := s.Leader(); !ok || leader.ID != 2 || leader.Term != 2 {
+		t.Errorf("Expected node 2 to lead with term 2, got %+v", leader)
+	}
+
+	entry, err := s.AppendLog("d")
+	if err != nil {
+		t.Fatalf("AppendLog after failover: %v", err)
+	}
+	if entry.Index != 4 || entry.Term != 2 {
+		t.Errorf("Expected entry 4 in term 2, got %+v", entry)
+	}
+	if got := commands(s.CommittedLog().Entries); !reflect.DeepEqual(got, []string{"a", "b", "c", "d"}) {
+		t.Errorf("Expected committed log [a b c d], got %v", got)
+	}
+
+	// Losing a majority leaves no leader.
+	s.Fail(2)
+	s.Fail(3)
+	if _, err := s.AppendLog("e"); !errors.Is(err, ErrNoLeader) {
+		t.Errorf("Expected ErrNoLeader without a majority, got %v", err)
+	}
+}
+
+// TestRaftPartition tests that only the majority side of a partition can
+// elect a leader, and that the isolated node catches up once the partition
+// heals.
+func TestRaftPartition(t *testing.T) {
+	s := New(Config{Mode: ModeRaft})
+	s.Init(3)
+	appendCommands(t, s, "a")
+
+	if err := s.SetPartition([][]int{{0}, {1, 2}}); err != nil {
+		t.Fatalf("SetPartition: %v", err)
+	}
+	if leader, ok := s.Leader(); !ok || leader.ID != 1 || leader.Term != 2 {
+		t.Fatalf("Expected node 1 to lead the majority in term 2, got %+v", leader)
+	}
+	appendCommands(t, s, "b")
+	if isolated, _ := s.NodeLog(0); len(isolated.Entries) != 1 || isolated.Term != 1 {
+		t.Errorf("Expected isolated node 0 to stay at 1 entry in term 1, got %+v", isolated)
+	}
+
+	// Node 0's log is behind, so it cannot win back leadership.
+	s.HealPartition()
+	if leader, ok := s.Leader(); !ok || leader.ID != 1 || leader.Term != 2 {
+		t.Errorf("Expected node 1 to keep leading term 2, got %+v", leader)
+	}
+	if healed, _ := s.NodeLog(0); !reflect.DeepEqual(commands(healed.Entries), []string{"a", "b"}) {
+		t.Errorf("Expected node 0 to catch up to [a b], got %v", commands(healed.Entries))
+	}
+}
+
+// TestLogHandlers tests POST /log, GET /log, and GET /nodes/{id}/log.
+func TestLogHandlers(t *testing.T) {
+	s := New(Config{Mode: ModeRaft})
+	s.Init(3)
+	h := s.Handler()
+
+	rr := doRequest(t, h, "POST", "/log", `{"command":"set x=1"}`)
+	expectCode(t, rr, http.StatusCreated)
+	var entry LogEntry
+	decodeBody(t, rr, &entry)
+	if entry != (LogEntry{Index: 1, Term: 1, Command: "set x=1"}) {
+		t.Errorf("Unexpected entry: %+v", entry)
+	}
+
+	var committed RaftLog
+	decodeBody(t, doRequest(t, h, "GET", "/log", ""), &committed)
+	if committed.CommitIndex != 1 || len(committed.Entries) != 1 || committed.Leader == nil || *committed.Leader != 0 {
+		t.Errorf("Unexpected committed log: %+v", committed)
+	}
+
+	var nodeLog NodeLog
+	decodeBody(t, doRequest(t, h, "GET", "/nodes/2/log", ""), &nodeLog)
+	if nodeLog.ID != 2 || nodeLog.Term != 1 || len(nodeLog.Entries) != 1 {
+		t.Errorf("Unexpected node log: %+v", nodeLog)
+	}
+
+	expectCode(t, doRequest(t, h, "GET", "/nodes/9/log", ""), http.StatusNotFound)
+	expectCode(t, doRequest(t, h, "POST", "/log", `{}`), http.StatusBadRequest)
+
+	s.Fail(1)
+	s.Fail(2)
+	expectCode(t, doRequest(t, h, "POST", "/log", `{"command":"set x=2"}`), http.StatusServiceUnavailable)
+
+	other := New(Config{})
+	other.Init(3)
+	expectCode(t, doRequest(t, other.Handler(), "POST", "/log", `{"command":"set x=1"}`), http.StatusConflict)
+}
@@ -0,0 +1,115 @@
+package simulator
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimitSweepInterval is how often the rate limiter forgets clients whose
+// buckets have refilled, which keeps its memory bounded by the number of
+// recently active clients.
+const rateLimitSweepInterval = time.Minute
+
+// bucket is the token bucket of one client.
+type bucket struct {
+	tokens float64   // Tokens available at last.
+	last   time.Time // When tokens was last brought up to date.
+}
+
+// rateLimiter is a token-bucket rate limiter keyed by client. Each client
+// may make burst requests at once and rate requests per second on average.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// newRateLimiter returns a rate limiter allowing rate requests per second
+// with bursts of up to burst requests per client.
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: float64(burst), buckets: make(map[string]*bucket)}
+}
+
+// allow takes a token from the bucket of client at time now. If none is
+// left, it returns false and how long until one is.
+func (l *rateLimiter) allow(client string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		l.sweep(now)
+	}
+
+	b := l.buckets[client]
+	if b == nil {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep forgets the clients whose buckets would be full by now, since a new
+// bucket behaves the same. The caller must hold l.mu.
+func (l *rateLimiter) sweep(now time.Time) {
+	for client, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+	l.lastSweep = now
+}
+
+// clientIP returns the IP address r came from. If trustProxy is set, the
+// last address in X-Forwarded-For, which the trusted proxy appended, takes
+// precedence over the address of the connection.
+func clientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+		if ip := strings.TrimSpace(forwarded[len(forwarded)-1]); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// withRateLimit rejects requests from clients exceeding Config.RateLimit
+// with 429 Too Many Requests and a Retry-After header. The health probes
+// are never limited. It does nothing unless Config.RateLimit is set.
+func (s *Simulator) withRateLimit(next http.Handler) http.Handler {
+	if s.cfg.RateLimit <= 0 {
+		return next
+	}
+	limiter := newRateLimiter(s.cfg.RateLimit, s.cfg.RateBurst)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ok, wait := limiter.allow(clientIP(r, s.cfg.TrustProxy), time.Now())
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeError(w, http.StatusTooManyRequests, "Rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,100 @@
+package simulator
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// requestFrom issues GET /nodes from the given remote address and
+// X-Forwarded-For header.
+func requestFrom(h http.Handler, remoteAddr, forwardedFor string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/nodes", nil)
+	req.RemoteAddr = remoteAddr
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+// TestRateLimit tests that a client exceeding the limit gets 429 with
+// Retry-After, that other clients are unaffected, and that the client
+// recovers once its bucket refills.
+func TestRateLimit(t *testing.T) {
+	s := New(Config{RateLimit: 20, RateBurst: 3})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	for i := 0; i < 3; i++ {
+		if rr := requestFrom(h, "10.0.0.1:1234", ""); rr.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected status code %d within the burst, got %d", i, http.StatusOK, rr.Code)
+		}
+	}
+	rr := requestFrom(h, "10.0.0.1:1234", "")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status code %d above the limit, got %d", http.StatusTooManyRequests, rr.Code)
+	}
+	if got := rr.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Expected Retry-After 1, got %q", got)
+	}
+	if rr := requestFrom(h, "10.0.0.2:1234", ""); rr.Code != http.StatusOK {
+		t.Errorf("Expected another client to be unaffected, got %d", rr.Code)
+	}
+	req := httptest.NewRequest("GET", "/healthz", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	probe := httptest.NewRecorder()
+	h.ServeHTTP(probe, req)
+	if probe.Code != http.StatusOK {
+		t.Errorf("Expected the health probe to be exempt, got %d", probe.Code)
+	}
+
+	// At 20 requests per second, a token is back after 50ms.
+	time.Sleep(100 * time.Millisecond)
+	if rr := requestFrom(h, "10.0.0.1:1234", ""); rr.Code != http.StatusOK {
+		t.Errorf("Expected the client to recover, got %d", rr.Code)
+	}
+}
+
+// TestRateLimitForwardedFor tests that X-Forwarded-For identifies clients
+// only behind a trusted proxy.
+func TestRateLimitForwardedFor(t *testing.T) {
+	for _, trust := range []bool{false, true} {
+		t.Run(fmt.Sprintf("trust=%v", trust), func(t *testing.T) {
+			s := New(Config{RateLimit: 1, RateBurst: 1, TrustProxy: trust})
+			s.Init(testNodeCount)
+			h := s.Handler()
+
+			// Two clients behind the same proxy.
+			requestFrom(h, "10.0.0.9:80", "203.0.113.1")
+			rr := requestFrom(h, "10.0.0.9:80", "198.51.100.7, 203.0.113.2")
+			want := http.StatusTooManyRequests
+			if trust {
+				want = http.StatusOK
+			}
+			if rr.Code != want {
+				t.Errorf("Expected status code %d, got %d", want, rr.Code)
+			}
+		})
+	}
+}
+
+// TestRateLimiterEviction tests that idle clients are forgotten.
+func TestRateLimiterEviction(t *testing.T) {
+	l := newRateLimiter(10, 5)
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		l.allow(fmt.Sprintf("client-%d", i), start)
+	}
+	if len(l.buckets) != 100 {
+		t.Fatalf("Expected 100 tracked clients, got %d", len(l.buckets))
+	}
+
+	l.allow("active", start.Add(rateLimitSweepInterval))
+	if len(l.buckets) != 1 {
+		t.Errorf("Expected idle clients to be evicted, %d remain", len(l.buckets))
+	}
+}
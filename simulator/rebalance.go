@@ -0,0 +1,329 @@
+package simulator
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+)
+
+// DefaultMaxConcurrentTransfers is the number of rebalance moves that
+// transfer keys at once, used when Config.MaxConcurrentTransfers is unset.
+const DefaultMaxConcurrentTransfers = 2
+
+// rebalanceTolerance is how far, as a fraction of the mean, the number of
+// keys a node is primary for may be from the mean before a rebalance plan
+// moves keys to or from it.
+const rebalanceTolerance = 0.1
+
+// ErrRebalanceRunning means a rebalance is already being executed.
+var ErrRebalanceRunning = errors.New("rebalance already running")
+
+// States of a rebalance move.
+const (
+	MovePending      = "pending"      // Waiting for a transfer slot.
+	MoveTransferring = "transferring" // Copying its keys to the new owner.
+	MoveDone         = "done"         // The new owner took over the range.
+	MoveSkipped      = "skipped"      // The new owner left the ring first.
+)
+
+// RebalanceMove hands part of a node's token range, and the keys in it, to
+// another node.
+type RebalanceMove struct {
+	From  int        `json:"from"`
+	To    int        `json:"to"`
+	Range TokenRange `json:"range"` // Part of the range From owns that To takes over.
+	Keys  int        `json:"keys"`  // Keys in the range when the move was planned.
+}
+
+// KeyLoad is the number of keys a node is primary for before and after a
+// rebalance.
+type KeyLoad struct {
+	ID     int `json:"id"`
+	Before int `json:"before"`
+	After  int `json:"after"`
+}
+
+// RebalancePlan lists the moves that would even out the number of keys each
+// node on the ring is primary for.
+type RebalancePlan struct {
+	Mean      float64         `json:"mean"` // Keys per node if they were spread evenly.
+	Moves     []RebalanceMove `json:"moves"`
+	Nodes     []KeyLoad       `json:"nodes"`
+	KeysMoved int             `json:"keys_moved"`
+}
+
+// MoveStatus is the progress of a rebalance move.
+type MoveStatus struct {
+	RebalanceMove
+	State       string `json:"state"`
+	Transferred int    `json:"transferred"` // Keys copied to To so far.
+}
+
+// RebalanceStatus is the progress of the latest rebalance executed.
+type RebalanceStatus struct {
+	Running       bool         `json:"running"`
+	MaxConcurrent int          `json:"max_concurrent"` // Moves that transfer keys at once.
+	Moves         []MoveStatus `json:"moves"`
+	Nodes         []KeyLoad    `json:"nodes"` // The loads the plan expected.
+	Started       time.Time    `json:"started"`
+	Finished      *time.Time   `json:"finished,omitempty"`
+}
+
+// rebalanceRun is the execution of a rebalance plan.
+type rebalanceRun struct {
+	moves    []*rebalanceMove
+	nodes    []KeyLoad
+	started  time.Time
+	finished *time.Time
+}
+
+// rebalanceMove is the progress of a move of a rebalanceRun.
+type rebalanceMove struct {
+	RebalanceMove
+	state       string
+	pending     []string
+	transferred int
+}
+
+// RebalancePlan computes, without moving anything, the moves that would
+// even out the number of keys each node on the ring is primary for, to within
+// a tenth of the mean. Each move splits the fullest token range of the most
+// loaded node, handing the first half of the difference to the least loaded
+// node.
+func (s *Simulator) RebalancePlan() RebalancePlan {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	plan, _ := s.rebalancePlan()
+	return plan
+}
+
+// rebalancePlan implements RebalancePlan, and also returns the keys each
+// move hands over. The caller must hold s.mu.
+func (s *Simulator) rebalancePlan() (RebalancePlan, [][]string) {
+	ring := s.ring.clone()
+	keys := s.kvKeys()
+	ids := make([]int, 0, len(ring.ids))
+	for id := range ring.ids {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	owned := func() map[int][]string {
+		owners := make(map[int][]string, len(ids))
+		for _, key := range keys {
+			owner := ring.Locate(key, 1)[0]
+			owners[owner] = append(owners[owner], key)
+		}
+		return owners
+	}
+
+	plan := RebalancePlan{Moves: []RebalanceMove{}, Nodes: []KeyLoad{}}
+	if len(ids) == 0 {
+		return plan, nil
+	}
+	plan.Mean = float64(len(keys)) / float64(len(ids))
+	before := owned()
+	owners := before
+	var handed [][]string
+	for {
+		from, to := ids[0], ids[0]
+		for _, id := range ids {
+			if len(owners[id]) > len(owners[from]) {
+				from = id
+			}
+			if len(owners[id]) < len(owners[to]) {
+				to = id
+			}
+		}
+		high, low := len(owners[from]), len(owners[to])
+		balanced := float64(high) <= plan.Mean*(1+rebalanceTolerance) && float64(low) >= plan.Mean*(1-rebalanceTolerance)
+		if high-low <= 1 || balanced {
+			break
+		}
+
+		// Split the range of from's token holding the most keys.
+		ranges := make(map[int][]string)
+		for _, key := range owners[from] {
+			i := ring.search(hashString(key)) % len(ring.tokens)
+			ranges[i] = append(ranges[i], key)
+		}
+		fullest := -1
+		for i, r := range ranges {
+			if fullest < 0 || len(r) > len(ranges[fullest]) || len(r) == len(ranges[fullest]) && i < fullest {
+				fullest = i
+			}
+		}
+		start := ring.tokens[(fullest+len(ring.tokens)-1)%len(ring.tokens)].hash
+		group := ranges[fullest]
+		// Unsigned subtraction orders the range that wraps around zero.
+		sort.Slice(group, func(a, b int) bool { return hashString(group[a])-start < hashString(group[b])-start })
+		n := min((high-low)/2, len(group))
+		end := hashString(group[n-1])
+		ring.Split(end, to)
+
+		plan.Moves = append(plan.Moves, RebalanceMove{From: from, To: to, Range: TokenRange{Start: start, End: end}, Keys: n})
+		plan.KeysMoved += n
+		handed = append(handed, group[:n])
+		owners = owned()
+	}
+	for _, id := range ids {
+		plan.Nodes = append(plan.Nodes, KeyLoad{ID: id, Before: len(before[id]), After: len(owners[id])})
+	}
+	return plan, handed
+}
+
+// ExecuteRebalance starts executing a fresh rebalance plan. Every
+// RebalanceRound, up to Config.MaxConcurrentTransfers moves copy up to
+// Config.TransferBatch of their keys each to the new owner, and a move whose
+// keys are all copied hands its range over once every earlier move has, so
+// writes keep going to the old owner until then. It returns
+// ErrRebalanceRunning, along with its progress, if a rebalance is already
+// running.
+func (s *Simulator) ExecuteRebalance() (RebalanceStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.rebalance != nil && s.rebalance.finished == nil {
+		return s.rebalanceStatus(), ErrRebalanceRunning
+	}
+	plan, handed := s.rebalancePlan()
+	run := &rebalanceRun{nodes: plan.Nodes, started: s.cfg.Clock.Now()}
+	for i, move := range plan.Moves {
+		run.moves = append(run.moves, &rebalanceMove{RebalanceMove: move, state: MovePending, pending: handed[i]})
+	}
+	if len(run.moves) == 0 {
+		run.finished = &run.started
+	}
+	s.rebalance = run
+	s.logger.Info("rebalance started", "moves", len(plan.Moves), "keys", plan.KeysMoved)
+	return s.rebalanceStatus(), nil
+}
+
+// RebalanceRound advances the running rebalance, if any, by one round; see
+// ExecuteRebalance. Keys are copied from the newest up replica the new owner
+// can reach, so keys that can't be copied this round, because the nodes
+// involved are down or partitioned, are retried in a later one, and a move
+// to a node that has left the ring is skipped. It returns the number of keys
+// copied.
+func (s *Simulator) RebalanceRound() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run := s.rebalance
+	if run == nil || run.finished != nil {
+		return 0
+	}
+	now := s.cfg.Clock.Now()
+	copied, active := 0, 0
+	ordered := true // Every earlier move is done or skipped.
+	for _, m := range run.moves {
+		if m.state == MoveDone || m.state == MoveSkipped {
+			continue
+		}
+		if !s.ring.ids[m.To] {
+			m.state = MoveSkipped
+			s.logger.Warn("rebalance move skipped", "from", m.From, "to", m.To)
+			continue
+		}
+		if m.state == MovePending {
+			if active >= s.cfg.MaxConcurrentTransfers {
+				ordered = false
+				continue
+			}
+			m.state = MoveTransferring
+		}
+		active++
+
+		if s.nodes[s.findNode(m.To)].Status == StatusUp {
+			var retry []string
+			for i, key := range m.pending {
+				if i >= s.cfg.TransferBatch || !s.transferKey(TransferJoin, m.To, key, now) {
+					retry = append(retry, key)
+					continue
+				}
+				m.transferred++
+				copied++
+			}
+			m.pending = retry
+		}
+		if len(m.pending) > 0 || !ordered {
+			ordered = false
+			continue
+		}
+		moved := s.changeMembership(fmt.Sprintf("rebalance from node %d to node %d", m.From, m.To), func(ring *HashRing) {
+			ring.Split(m.Range.End, m.To)
+		})
+		m.state = MoveDone
+		active--
+		s.logger.Info("rebalance move done", "from", m.From, "to", m.To, "keys_moved", moved)
+	}
+
+	if !slices.ContainsFunc(run.moves, func(m *rebalanceMove) bool { return m.state != MoveDone && m.state != MoveSkipped }) {
+		run.finished = &now
+		s.logger.Info("rebalance finished", "moves", len(run.moves))
+	}
+	return copied
+}
+
+// Rebalance returns the progress of the latest rebalance executed, and false
+// if none has been.
+func (s *Simulator) Rebalance() (RebalanceStatus, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.rebalance == nil {
+		return RebalanceStatus{}, false
+	}
+	return s.rebalanceStatus(), true
+}
+
+// rebalanceStatus returns the progress of s.rebalance, which must not be
+// nil. The caller must hold s.mu.
+func (s *Simulator) rebalanceStatus() RebalanceStatus {
+	run := s.rebalance
+	status := RebalanceStatus{
+		Running:       run.finished == nil,
+		MaxConcurrent: s.cfg.MaxConcurrentTransfers,
+		Moves:         make([]MoveStatus, 0, len(run.moves)),
+		Nodes:         slices.Clone(run.nodes),
+		Started:       run.started,
+	}
+	for _, m := range run.moves {
+		status.Moves = append(status.Moves, MoveStatus{RebalanceMove: m.RebalanceMove, State: m.state, Transferred: m.transferred})
+	}
+	if run.finished != nil {
+		finished := *run.finished
+		status.Finished = &finished
+	}
+	return status
+}
+
+// getRebalancePlan handles HTTP requests for the moves that would rebalance
+// the ring.
+func (s *Simulator) getRebalancePlan(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.RebalancePlan())
+}
+
+// executeRebalance handles HTTP requests to start rebalancing the ring.
+func (s *Simulator) executeRebalance(w http.ResponseWriter, r *http.Request) {
+	status, err := s.ExecuteRebalance()
+	if errors.Is(err, ErrRebalanceRunning) {
+		writeError(w, http.StatusConflict, "A rebalance is already running")
+		return
+	}
+	writeJSON(w, http.StatusAccepted, status)
+}
+
+// getRebalanceStatus handles HTTP requests for the progress of the latest
+// rebalance.
+func (s *Simulator) getRebalanceStatus(w http.ResponseWriter, r *http.Request) {
+	status, ok := s.Rebalance()
+	if !ok {
+		writeError(w, http.StatusNotFound, "No rebalance has been executed")
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
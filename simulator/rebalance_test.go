@@ -0,0 +1,96 @@
+package simulator
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+// TestRebalance tests that executing the plan for a lopsided ring moves keys
+// no more than a few ranges at a time, keeps every key readable, and leaves
+// every node holding close to the mean number of keys.
+func TestRebalance(t *testing.T) {
+	const keys = 500
+
+	// Two virtual nodes apiece spread the keys unevenly, and a replication
+	// factor of one makes each node's key count its primary load.
+	s := New(Config{Seed: 1, N: 1, R: 1, W: 1, VirtualNodes: 2, TransferBatch: 20, MaxConcurrentTransfers: 2})
+	s.Init(testNodeCount)
+	h := s.Handler()
+	for k := 0; k < keys; k++ {
+		if _, err := s.KVPut(fmt.Sprintf("key-%d", k), strconv.Itoa(k)); err != nil {
+			t.Fatalf("KVPut failed: %v", err)
+		}
+	}
+	spread := func() (low, high int) {
+		low = keys
+		for id := 0; id < testNodeCount; id++ {
+			low, high = min(low, len(s.replicaData[id])), max(high, len(s.replicaData[id]))
+		}
+		return low, high
+	}
+	if low, high := spread(); high-low < keys/testNodeCount/2 {
+		t.Fatalf("Expected a lopsided ring to start with, got %d to %d keys", low, high)
+	}
+	expectCode(t, doRequest(t, h, "GET", "/rebalance/status", ""), http.StatusNotFound)
+
+	var plan RebalancePlan
+	decodeBody(t, doRequest(t, h, "GET", "/rebalance/plan", ""), &plan)
+	if len(plan.Moves) < 3 || plan.KeysMoved == 0 || plan.Mean != keys/testNodeCount {
+		t.Fatalf("Expected several moves, got %+v", plan)
+	}
+	for _, load := range plan.Nodes {
+		if got := len(s.replicaData[load.ID]); got != load.Before {
+			t.Errorf("Expected planning to move nothing, node %d holds %d keys, planned from %d", load.ID, got, load.Before)
+		}
+	}
+
+	var status RebalanceStatus
+	rr := doRequest(t, h, "POST", "/rebalance/execute", "")
+	expectCode(t, rr, http.StatusAccepted)
+	decodeBody(t, rr, &status)
+	if !status.Running || len(status.Moves) != len(plan.Moves) || status.MaxConcurrent != 2 {
+		t.Fatalf("Expected the plan to be running, got %+v", status)
+	}
+	expectCode(t, doRequest(t, h, "POST", "/rebalance/execute", ""), http.StatusConflict)
+
+	for rounds := 1; status.Running; rounds++ {
+		s.RebalanceRound()
+		decodeBody(t, doRequest(t, h, "GET", "/rebalance/status", ""), &status)
+		transferring := 0
+		for _, m := range status.Moves {
+			if m.State == MoveTransferring {
+				transferring++
+			}
+		}
+		if transferring > status.MaxConcurrent {
+			t.Fatalf("Round %d: expected at most %d moves transferring, got %d", rounds, status.MaxConcurrent, transferring)
+		}
+		for k := 0; k < keys; k++ {
+			if result, err := s.KVGet(fmt.Sprintf("key-%d", k)); err != nil || result.Value != strconv.Itoa(k) {
+				t.Fatalf("Round %d: key-%d read %+v, %v", rounds, k, result, err)
+			}
+		}
+		if rounds > 100 {
+			t.Fatalf("Rebalance still running after %d rounds: %+v", rounds, status)
+		}
+	}
+	for _, m := range status.Moves {
+		if m.State != MoveDone || m.Transferred != m.Keys {
+			t.Errorf("Expected every move done with its keys, got %+v", m)
+		}
+	}
+
+	mean := float64(keys) / testNodeCount
+	for id := 0; id < testNodeCount; id++ {
+		if held := float64(len(s.replicaData[id])); math.Abs(held-mean) > mean*rebalanceTolerance+1 {
+			t.Errorf("Expected node %d to hold about %.0f keys, got %.0f", id, mean, held)
+		}
+	}
+	decodeBody(t, doRequest(t, h, "GET", "/rebalance/plan", ""), &plan)
+	if len(plan.Moves) != 0 {
+		t.Errorf("Expected a balanced ring to need no moves, got %+v", plan.Moves)
+	}
+}
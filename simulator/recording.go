@@ -0,0 +1,347 @@
+package simulator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// traceVersion is the format version of exported traces. Traces with a
+// different version are rejected.
+const traceVersion = 1
+
+// Errors returned by StartRecording, StopRecording, and Trace.
+var (
+	// ErrRecording means a recording is already in progress.
+	ErrRecording = errors.New("simulator: already recording")
+
+	// ErrNotRecording means no recording is in progress.
+	ErrNotRecording = errors.New("simulator: not recording")
+
+	// ErrNoTrace means nothing has been recorded yet.
+	ErrNoTrace = errors.New("simulator: no trace recorded")
+)
+
+// Trace is a recorded run: the nodes as they were when recording started and
+// every change made to them after, each stamped with the tick of the updater
+// it happened in. The changes carry the resulting nodes rather than the
+// random decisions behind them, so replaying a trace reproduces the run
+// exactly, whatever the seed.
+type Trace struct {
+	Version int          `json:"version"`
+	Mode    string       `json:"mode"`
+	Started time.Time    `json:"started"`
+	Ticks   int          `json:"ticks"`   // Updater ticks recorded.
+	NextID  int          `json:"next_id"` // ID of the next node created at runtime when recording started.
+	Nodes   []NodeData   `json:"nodes"`
+	Events  []TraceEvent `json:"events"` // Ordered by Tick.
+}
+
+// TraceEvent is a change recorded in a Trace. Changes made before the first
+// updater tick are at tick 0.
+type TraceEvent struct {
+	Tick int `json:"tick"`
+	Event
+}
+
+// RecordingStatus describes the trace being or last recorded.
+type RecordingStatus struct {
+	Recording bool      `json:"recording"`
+	Started   time.Time `json:"started"`
+	Ticks     int       `json:"ticks"`
+	Events    int       `json:"events"`
+}
+
+// replayRun is a trace being replayed and the progress through it.
+type replayRun struct {
+	trace *Trace
+	tick  int // Ticks replayed.
+	next  int // Index of the next event to replay.
+}
+
+// StartRecording starts recording a new trace, discarding the last one. It
+// returns ErrRecording if a recording is already in progress.
+func (s *Simulator) StartRecording() (RecordingStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.recording {
+		return RecordingStatus{}, ErrRecording
+	}
+	s.recording = true
+	s.trace = &Trace{
+		Version: traceVersion,
+		Mode:    s.Mode(),
+		Started: time.Now().UTC(),
+		NextID:  s.nextID,
+		Nodes:   cloneNodes(s.nodes),
+		Events:  []TraceEvent{},
+	}
+	s.logger.Info("recording started")
+	return s.recordingStatus(), nil
+}
+
+// StopRecording stops the recording in progress, keeping the trace for
+// Trace. It returns ErrNotRecording if there is none.
+func (s *Simulator) StopRecording() (RecordingStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.recording {
+		return RecordingStatus{}, ErrNotRecording
+	}
+	s.recording = false
+	s.logger.Info("recording stopped", "ticks", s.trace.Ticks, "events", len(s.trace.Events))
+	return s.recordingStatus(), nil
+}
+
+// recordingStatus describes the trace being or last recorded. The caller
+// must hold s.mu.
+func (s *Simulator) recordingStatus() RecordingStatus {
+	return RecordingStatus{
+		Recording: s.recording,
+		Started:   s.trace.Started,
+		Ticks:     s.trace.Ticks,
+		Events:    len(s.trace.Events),
+	}
+}
+
+// Trace returns a copy of the trace being or last recorded, or ErrNoTrace if
+// nothing has been recorded.
+func (s *Simulator) Trace() (Trace, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.feedMu.Lock()
+	defer s.feedMu.Unlock()
+
+	if s.trace == nil {
+		return Trace{}, ErrNoTrace
+	}
+	trace := *s.trace
+	trace.Nodes = cloneNodes(trace.Nodes)
+	trace.Events = make([]TraceEvent, len(s.trace.Events))
+	for i, e := range s.trace.Events {
+		e.Node = e.Node.clone()
+		trace.Events[i] = e
+	}
+	return trace, nil
+}
+
+// traceTick starts the next tick of the trace being recorded, if any.
+func (s *Simulator) traceTick() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.recording {
+		s.trace.Ticks++
+	}
+}
+
+// ReadTrace reads and parses the trace file at path.
+func ReadTrace(path string) (*Trace, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	trace, err := ParseTrace(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return trace, nil
+}
+
+// ParseTrace parses and validates an exported trace.
+func ParseTrace(data []byte) (*Trace, error) {
+	var trace Trace
+	if err := json.Unmarshal(data, &trace); err != nil {
+		return nil, fmt.Errorf("malformed JSON: %v", err)
+	}
+	if trace.Version != traceVersion {
+		return nil, fmt.Errorf("unsupported version %d, expected %d", trace.Version, traceVersion)
+	}
+
+	seen := make(map[int]bool, len(trace.Nodes))
+	for _, node := range trace.Nodes {
+		if node.ID < 0 || seen[node.ID] {
+			return nil, fmt.Errorf("invalid or duplicate node ID %d", node.ID)
+		}
+		seen[node.ID] = true
+	}
+	tick := 0
+	for i, e := range trace.Events {
+		if e.Tick < tick || e.Tick > trace.Ticks {
+			return nil, fmt.Errorf("event %d is at tick %d, out of order or past the last tick %d", i, e.Tick, trace.Ticks)
+		}
+		tick = e.Tick
+		switch e.Type {
+		case EventNodeUpdated, EventNodeFailed, EventNodeRecovered, EventNodeAdded, EventNodeRemoved:
+		default:
+			return nil, fmt.Errorf("event %d has unknown type %q", i, e.Type)
+		}
+	}
+	return &trace, nil
+}
+
+// LoadTrace replaces the nodes with those the trace started from, as Init
+// does, and makes it the trace StartReplay replays.
+func (s *Simulator) LoadTrace(trace *Trace) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.reset(cloneNodes(trace.Nodes), trace.NextID)
+	s.replay = &replayRun{trace: trace}
+}
+
+// Replaying reports whether a trace has been loaded with LoadTrace.
+func (s *Simulator) Replaying() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.replay != nil
+}
+
+// StartReplay replays the loaded trace in place of StartUpdater: the changes
+// recorded at tick 0 at once, then those of one tick per interval, or per
+// Tunables.UpdateInterval once SetTunables changes it, until the last tick
+// has been replayed or ctx is cancelled. Each tick leaves the nodes as they
+// were at the end of the same tick of the recorded run. It returns at once if
+// no trace is loaded. It blocks, so callers typically run it in its own
+// goroutine.
+func (s *Simulator) StartReplay(ctx context.Context, interval time.Duration) {
+	s.mu.RLock()
+	run := s.replay
+	s.mu.RUnlock()
+	if run == nil {
+		return
+	}
+
+	s.updaterRunning.Store(true)
+	defer s.updaterRunning.Store(false)
+
+	s.logger.Info("replay started", "ticks", run.trace.Ticks, "events", len(run.trace.Events))
+	if s.replayStep(false) {
+		return
+	}
+	ticker := s.newIntervalTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.changed():
+			ticker.refresh()
+		case <-ticker.C():
+			finished := s.replayStep(true)
+			s.sampleTick()
+			if finished {
+				return
+			}
+		}
+	}
+}
+
+// replayStep advances the replay by a tick if advance is set, then applies
+// every change recorded up to it. It reports whether the trace is finished.
+func (s *Simulator) replayStep(advance bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run := s.replay
+	if advance {
+		run.tick++
+	}
+	events := run.trace.Events
+	for ; run.next < len(events) && events[run.next].Tick <= run.tick; run.next++ {
+		if !s.replayEvent(events[run.next].Event) {
+			s.logger.Warn("replayed event for unknown node", "tick", run.tick, "node_id", events[run.next].Node.ID)
+		}
+	}
+	s.electLeader()
+
+	finished := run.tick >= run.trace.Ticks
+	if finished {
+		s.logger.Info("replay finished", "ticks", run.tick)
+	}
+	return finished
+}
+
+// replayEvent applies the recorded change e to the nodes and announces it.
+// It returns false if e refers to a node that doesn't exist. The caller must
+// hold s.mu for writing.
+func (s *Simulator) replayEvent(e Event) bool {
+	id, node := e.Node.ID, e.Node.clone()
+	if node.Membership == "" {
+		node.Membership = MemberActive // Recorded before membership was.
+	}
+	if e.Type == EventNodeAdded {
+		s.nodes = append(s.nodes, node)
+		s.nextID = max(s.nextID, id+1)
+		if node.Membership != MemberJoining {
+			s.changeMembership(fmt.Sprintf("node %d added", id), func(ring *HashRing) {
+				ring.Add(id)
+			})
+		}
+		s.announce(e.Type, len(s.nodes)-1)
+		return true
+	}
+
+	index := s.findNode(id)
+	if index < 0 {
+		return false
+	}
+	previous := s.nodes[index].Membership
+	s.nodes[index] = node
+	s.announce(e.Type, index)
+	switch membership := node.Membership; {
+	case previous == MemberJoining && membership == MemberActive:
+		s.changeMembership(fmt.Sprintf("node %d added", id), func(ring *HashRing) {
+			ring.Add(id)
+		})
+	case previous == MemberActive && membership == MemberLeaving:
+		s.ring.Remove(id)
+	}
+	if e.Type == EventNodeRemoved {
+		s.nodes = append(s.nodes[:index], s.nodes[index+1:]...)
+		s.changeMembership(fmt.Sprintf("node %d removed", id), func(ring *HashRing) {
+			ring.Remove(id)
+		})
+		s.forgetNode(id)
+	}
+	return true
+}
+
+// startRecording handles HTTP requests to start recording a trace.
+func (s *Simulator) startRecording(w http.ResponseWriter, r *http.Request) {
+	status, err := s.StartRecording()
+	if err != nil {
+		writeError(w, http.StatusConflict, "A recording is already in progress")
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// stopRecording handles HTTP requests to stop recording a trace.
+func (s *Simulator) stopRecording(w http.ResponseWriter, r *http.Request) {
+	status, err := s.StopRecording()
+	if err != nil {
+		writeError(w, http.StatusConflict, "No recording is in progress")
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// exportRecording handles HTTP requests to download the trace being or last
+// recorded, which -replay accepts.
+func (s *Simulator) exportRecording(w http.ResponseWriter, r *http.Request) {
+	trace, err := s.Trace()
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Nothing has been recorded")
+		return
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="trace.json"`)
+	writeJSON(w, http.StatusOK, trace)
+}
@@ -0,0 +1,129 @@
+package simulator
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// replayTick returns the number of ticks s has replayed so far.
+func replayTick(s *Simulator) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.replay.tick
+}
+
+// TestRecordAndReplay tests that replaying a recorded trace under a
+// different seed reproduces the nodes of the recorded run at every tick.
+func TestRecordAndReplay(t *testing.T) {
+	clock := NewVirtualClock(time.Unix(0, 0))
+	clock.Pause()
+	s := New(Config{Seed: 1, Clock: clock})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	expectCode(t, doRequest(t, h, "GET", "/recording/export", ""), http.StatusNotFound)
+	expectCode(t, doRequest(t, h, "POST", "/recording/stop", ""), http.StatusConflict)
+	expectCode(t, doRequest(t, h, "POST", "/recording/start", ""), http.StatusOK)
+	expectCode(t, doRequest(t, h, "POST", "/recording/start", ""), http.StatusConflict)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.StartUpdater(ctx, 5*time.Second)
+	waitFor(t, func() bool { return tickerCount(clock) == 1 })
+
+	// Changes made through the API between ticks are recorded too.
+	s.Fail(0)
+	snapshots := [][]NodeData{s.Snapshot()}
+	for tick := 1; tick <= 6; tick++ {
+		if err := clock.Step(); err != nil {
+			t.Fatalf("Step failed: %v", err)
+		}
+		waitFor(t, func() bool { return updateCount(s) == tick })
+		switch tick {
+		case 2:
+			s.AddNode("added", 42)
+		case 3:
+			s.RemoveNode(1)
+			s.Recover(0)
+		case 5:
+			s.SetNode(2, "renamed", 7)
+		}
+		snapshots = append(snapshots, s.Snapshot())
+	}
+	cancel()
+
+	rr := doRequest(t, h, "POST", "/recording/stop", "")
+	expectCode(t, rr, http.StatusOK)
+	var status RecordingStatus
+	decodeBody(t, rr, &status)
+	if status.Recording || status.Ticks != 6 || status.Events < 10 {
+		t.Errorf("Unexpected recording status %+v", status)
+	}
+
+	rr = doRequest(t, h, "GET", "/recording/export", "")
+	expectCode(t, rr, http.StatusOK)
+	if got := rr.Header().Get("Content-Disposition"); !strings.Contains(got, "trace.json") {
+		t.Errorf("Expected the trace to download as trace.json, got %q", got)
+	}
+	trace, err := ParseTrace(rr.Body.Bytes())
+	if err != nil {
+		t.Fatalf("ParseTrace failed: %v", err)
+	}
+
+	replayClock := NewVirtualClock(time.Unix(0, 0))
+	replayClock.Pause()
+	replayed := New(Config{Seed: 99, Clock: replayClock})
+	replayed.Init(testNodeCount)
+	replayed.LoadTrace(trace)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		replayed.StartReplay(ctx, 5*time.Second)
+		close(done)
+	}()
+	waitFor(t, func() bool { return tickerCount(replayClock) == 1 })
+	for tick, want := range snapshots {
+		if tick > 0 {
+			if err := replayClock.Step(); err != nil {
+				t.Fatalf("Step failed: %v", err)
+			}
+			waitFor(t, func() bool { return replayTick(replayed) == tick })
+		}
+		// The trace went through JSON, which drops monotonic clock readings
+		// and checksums.
+		var exported []NodeData
+		jsonRoundTrip(t, want, &exported)
+		for i := range exported {
+			exported[i].Checksum = want[i].Checksum
+		}
+		if got := replayed.Snapshot(); !reflect.DeepEqual(got, exported) {
+			t.Errorf("Tick %d: expected the replayed nodes to match the recording\ngot  %+v\nwant %+v", tick, got, want)
+		}
+	}
+	<-done
+	if _, ok := replayed.Node(1); ok {
+		t.Errorf("Expected the removed node to stay removed")
+	}
+}
+
+// TestParseTraceErrors tests that invalid traces are rejected.
+func TestParseTraceErrors(t *testing.T) {
+	for _, data := range []string{
+		`not json`,
+		`{"version": 2}`,
+		`{"version": 1, "nodes": [{"id": 1}, {"id": 1}]}`,
+		`{"version": 1, "ticks": 1, "nodes": [{"id": 0}], "events": [{"tick": 2, "type": "node.updated", "node": {"id": 0}}]}`,
+		`{"version": 1, "ticks": 2, "nodes": [{"id": 0}], "events": [{"tick": 2, "type": "node.updated"}, {"tick": 1, "type": "node.updated"}]}`,
+		`{"version": 1, "ticks": 1, "nodes": [{"id": 0}], "events": [{"tick": 1, "type": "node.exploded"}]}`,
+	} {
+		if _, err := ParseTrace([]byte(data)); err == nil {
+			t.Errorf("Expected %s to be rejected", data)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package simulator
+
+import (
+	"context"
+	"time"
+)
+
+// KVReplicas describes where the copies of a key live and whether they
+// agree.
+type KVReplicas struct {
+	Key      string      `json:"key"`
+	Version  uint64      `json:"version"` // Version of the newest copy any replica holds.
+	InSync   bool        `json:"in_sync"` // Every replica holds Version.
+	Replicas []KVReplica `json:"replicas"`
+}
+
+// KVReplica is one replica's copy of a key.
+type KVReplica struct {
+	ID      int    `json:"id"`
+	Primary bool   `json:"primary"`
+	Status  string `json:"status"`
+	Present bool   `json:"present"`           // The replica holds some version of the key.
+	Value   string `json:"value,omitempty"`   // Omitted unless Present.
+	Version uint64 `json:"version,omitempty"` // Omitted unless Present.
+	Deleted bool   `json:"deleted,omitempty"` // The copy is the tombstone of a deleted or expired write.
+	InSync  bool   `json:"in_sync"`           // The replica holds the newest version.
+}
+
+// StartReplication delivers pending hints and runs a replication round once
+// per interval until ctx is cancelled. It blocks, so callers typically run it
+// in its own goroutine.
+func (s *Simulator) StartReplication(ctx context.Context, interval time.Duration) {
+	ticker := s.cfg.Clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			s.deliverHints(ctx)
+			s.replicationRound(ctx)
+		}
+	}
+}
+
+// ReplicationRound copies every key in the replicated key-value store to
+// those of its N replicas that missed the latest write. A quorum write only
+// reaches W replicas, so this is how the rest catch up. The newest version
+// held by an up replica is sent to every other up replica it can reach. A
+// lost copy is retried under the replication retry policy, leaving after the
+// backoff, and given up on for this round once every attempt is lost; down
+// and partitioned replicas catch up in a later round. Copies sent in earlier
+// rounds that have arrived by now are stored first, and no copy of a key is
+// sent to a replica that already has one on the way. It returns the number of
+// copies sent.
+func (s *Simulator) ReplicationRound() int {
+	return s.replicationRound(context.Background())
+}
+
+// replicationRound is ReplicationRound, retrying lost copies until ctx is
+// done.
+func (s *Simulator) replicationRound(ctx context.Context) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.cfg.Clock.Now()
+	s.deliverArrived(now)
+
+	copied := 0
+	for _, key := range s.kvKeys() {
+		replicas := s.preferenceList(key, s.cfg.N)
+		source, newest, ok := s.newestUpReplica(key, replicas)
+		if !ok {
+			continue
+		}
+		for _, id := range replicas {
+			if s.nodes[s.findNode(id)].Status != StatusUp || !s.reachable(source, id) {
+				continue
+			}
+			if !s.wants(id, key, newest, now) {
+				continue
+			}
+			topic := "kv/" + key
+			if s.inFlightTo(id, topic) {
+				continue
+			}
+			backoff, ok := s.retryOp(ctx, RetryReplication, func() error {
+				if !s.deliver(source, id) {
+					return errMessageLost
+				}
+				return nil
+			})
+			if !ok {
+				continue
+			}
+			sent := s.replyEntry(source, newest)
+			if s.send(now.Add(backoff), source, id, MessageReplication, topic, replicaPayload{Key: key, Entry: sent}, func(time.Time) {
+				s.receiveReplica(id, key, sent)
+			}) {
+				copied++
+			}
+		}
+	}
+	if copied > 0 {
+		s.logger.Debug("replication round", "copies", copied)
+	}
+	return copied
+}
+
+// receiveReplica stores entry, a copy of key that has arrived at the node
+// with the given ID, unless the node has gone or is down or doesn't want it,
+// or it fails checksum verification. The caller must hold s.mu for writing.
+func (s *Simulator) receiveReplica(id int, key string, entry KVEntry) {
+	index := s.findNode(id)
+	if index < 0 || s.nodes[index].Status != StatusUp {
+		return
+	}
+	if !s.wants(id, key, entry, s.cfg.Clock.Now()) || !s.intact(id, key, entry) {
+		return
+	}
+	s.storeReplica(id, key, entry)
+}
+
+// newestUpReplica returns the ID of the up replica among replicas holding the
+// newest version of key, and that version. It returns false if no up replica
+// holds the key. The caller must hold s.mu.
+func (s *Simulator) newestUpReplica(key string, replicas []int) (int, KVEntry, bool) {
+	source, found := -1, false
+	var newest KVEntry
+	for _, id := range replicas {
+		if s.nodes[s.findNode(id)].Status != StatusUp {
+			continue
+		}
+		if entry, ok := s.replicaData[id][key]; ok && (!found || entry.newer(newest)) {
+			source, newest, found = id, entry, true
+		}
+	}
+	return source, newest, found
+}
+
+// KVReplicas returns the copies of key held by each of its N replicas,
+// primary first. It returns ErrKeyNotFound if no replica holds the key.
+func (s *Simulator) KVReplicas(key string) (KVReplicas, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	info := KVReplicas{Key: key, InSync: true}
+	var newest KVEntry
+	found := false
+	for i, id := range s.preferenceList(key, s.cfg.N) {
+		replica := KVReplica{ID: id, Primary: i == 0, Status: s.nodes[s.findNode(id)].Status}
+		if entry, ok := s.replicaData[id][key]; ok {
+			replica.Present, replica.Value, replica.Version, replica.Deleted = true, entry.Value, entry.Version, entry.Deleted
+			if !found || entry.newer(newest) {
+				newest = entry
+			}
+			found = true
+		}
+		info.Replicas = append(info.Replicas, replica)
+	}
+	if !found {
+		return KVReplicas{}, ErrKeyNotFound
+	}
+	info.Version = newest.Version
+	for i := range info.Replicas {
+		replica := &info.Replicas[i]
+		replica.InSync = replica.Present && replica.Version == info.Version && replica.Deleted == newest.Deleted
+		info.InSync = info.InSync && replica.InSync
+	}
+	return info, nil
+}
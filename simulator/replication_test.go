@@ -0,0 +1,138 @@
+package simulator
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// getReplicas fetches /kv/{key}/replicas and fails the test unless it
+// returns 200.
+func getReplicas(t *testing.T, h http.Handler, key string) KVReplicas {
+	t.Helper()
+	rr := doRequest(t, h, "GET", "/kv/"+key+"/replicas", "")
+	expectCode(t, rr, http.StatusOK)
+	var info KVReplicas
+	decodeBody(t, rr, &info)
+	return info
+}
+
+// TestReplicationRound tests that a write reaching one replica is copied to
+// the rest in the background, skipping down replicas until they recover.
+func TestReplicationRound(t *testing.T) {
+	s := New(Config{Seed: 1, N: 3, R: 1, W: 1})
+	s.Init(testNodeCount)
+	h := s.Handler()
+	replicas := s.Locate("color")
+
+	written, err := s.KVPut("color", "red")
+	if err != nil {
+		t.Fatalf("KVPut failed: %v", err)
+	}
+	info := getReplicas(t, h, "color")
+	if info.InSync || info.Version != written.Version {
+		t.Errorf("Expected one of three replicas to hold version %d, got %+v", written.Version, info)
+	}
+	ids := make([]int, len(info.Replicas))
+	for i, replica := range info.Replicas {
+		ids[i] = replica.ID
+		if replica.Primary != (i == 0) {
+			t.Errorf("Expected only the first replica to be the primary, got %+v", info.Replicas)
+		}
+	}
+	if !reflect.DeepEqual(ids, replicas) {
+		t.Errorf("Expected replicas %v, got %v", replicas, ids)
+	}
+
+	// A down replica misses the round.
+	var down int
+	for _, id := range replicas {
+		if id != written.Replicas[0] {
+			down = id
+			break
+		}
+	}
+	s.Fail(down)
+	if copied := s.ReplicationRound(); copied != 1 {
+		t.Errorf("Expected 1 copy while a replica is down, got %d", copied)
+	}
+	s.Recover(down)
+	if copied := s.ReplicationRound(); copied != 1 {
+		t.Errorf("Expected the recovered replica to catch up, got %d copies", copied)
+	}
+	if copied := s.ReplicationRound(); copied != 0 {
+		t.Errorf("Expected nothing to copy once in sync, got %d", copied)
+	}
+
+	info = getReplicas(t, h, "color")
+	if !info.InSync {
+		t.Errorf("Expected every replica to be in sync, got %+v", info)
+	}
+	for _, replica := range info.Replicas {
+		if !replica.Present || replica.Value != "red" || replica.Version != written.Version || !replica.InSync {
+			t.Errorf("Expected replica %d to hold red at version %d, got %+v", replica.ID, written.Version, replica)
+		}
+	}
+
+	expectCode(t, doRequest(t, h, "GET", "/kv/missing/replicas", ""), http.StatusNotFound)
+}
+
+// TestReadRepair tests that a read which finds replicas disagreeing repairs
+// the stale ones, and that reads fall through to replicas when the primary
+// is down.
+func TestReadRepair(t *testing.T) {
+	s := New(Config{Seed: 1, N: 3, R: 3, W: 3})
+	s.Init(testNodeCount)
+	h := s.Handler()
+	replicas := s.Locate("color")
+
+	written, err := s.KVPut("color", "red")
+	if err != nil {
+		t.Fatalf("KVPut failed: %v", err)
+	}
+
+	// Corrupt one replica with an older version.
+	stale := replicas[1]
+	s.mu.Lock()
+	s.replicaData[stale]["color"] = KVEntry{Value: "stale", Version: written.Version - 1}
+	s.mu.Unlock()
+	info := getReplicas(t, h, "color")
+	if info.InSync || info.Replicas[1].InSync || info.Replicas[1].Value != "stale" {
+		t.Errorf("Expected replica %d to be out of sync, got %+v", stale, info)
+	}
+
+	rr := doRequest(t, h, "GET", "/kv/color", "")
+	expectCode(t, rr, http.StatusOK)
+	var read KVResult
+	decodeBody(t, rr, &read)
+	if read.Value != "red" || !reflect.DeepEqual(read.Repaired, []int{stale}) {
+		t.Errorf("Expected to read red and repair replica %d, got %+v", stale, read)
+	}
+	if info := getReplicas(t, h, "color"); !info.InSync {
+		t.Errorf("Expected read repair to bring every replica in sync, got %+v", info)
+	}
+
+	rr = doRequest(t, h, "GET", "/kv/color", "")
+	var again KVResult
+	decodeBody(t, rr, &again)
+	if len(again.Repaired) != 0 {
+		t.Errorf("Expected nothing to repair, got %v", again.Repaired)
+	}
+
+	// With the primary down, a smaller read quorum is served by the others.
+	s = New(Config{Seed: 1, N: 3, R: 2, W: 3})
+	s.Init(testNodeCount)
+	if _, err := s.KVPut("color", "red"); err != nil {
+		t.Fatalf("KVPut failed: %v", err)
+	}
+	s.Fail(replicas[0])
+	result, err := s.KVGet("color")
+	if err != nil || result.Value != "red" {
+		t.Fatalf("Expected to read red without the primary, got %+v, %v", result, err)
+	}
+	for _, id := range result.Replicas {
+		if id == replicas[0] {
+			t.Errorf("Expected the down primary not to be contacted, got %v", result.Replicas)
+		}
+	}
+}
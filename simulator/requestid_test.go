@@ -0,0 +1,82 @@
+package simulator
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// uuidPattern matches a version 4 UUID.
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+// TestRequestIDGenerated tests that a request without an ID gets a fresh
+// UUID in the response header, the error body, and the request log.
+func TestRequestIDGenerated(t *testing.T) {
+	capture := &captureHandler{}
+	s := New(Config{Logger: slog.New(capture)})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	rr := doRequest(t, h, "GET", "/nodes/99", "")
+	id := rr.Header().Get(RequestIDHeader)
+	if !uuidPattern.MatchString(id) {
+		t.Fatalf("Expected a generated UUID, got %q", id)
+	}
+	var body ErrorResponse
+	decodeBody(t, rr, &body)
+	if body.Error.RequestID != id {
+		t.Errorf("Expected the error body to carry request ID %q, got %q", id, body.Error.RequestID)
+	}
+	if attrs, _ := capture.find("http request"); attrs["request_id"].String() != id {
+		t.Errorf("Expected the request log to carry request ID %q, got %q", id, attrs["request_id"])
+	}
+
+	if other := doRequest(t, h, "GET", "/nodes/0", "").Header().Get(RequestIDHeader); other == id {
+		t.Error("Expected each request to get a different ID")
+	}
+}
+
+// TestRequestIDPropagated tests that a client-supplied ID is kept and made
+// available to handlers through the context, while invalid IDs are
+// replaced.
+func TestRequestIDPropagated(t *testing.T) {
+	var seen string
+	h := withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestIDFromContext(r.Context())
+	}))
+
+	for _, tt := range []struct {
+		header string
+		keep   bool
+	}{
+		{"chaos-run-42", true},
+		{"", false},
+		{"has spaces", false},
+		{strings.Repeat("x", maxRequestIDLength+1), false},
+	} {
+		req := httptest.NewRequest("GET", "/nodes", nil)
+		if tt.header != "" {
+			req.Header.Set(RequestIDHeader, tt.header)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		got := rr.Header().Get(RequestIDHeader)
+		if got != seen {
+			t.Errorf("Header %q: context ID %q differs from response ID %q", tt.header, seen, got)
+		}
+		if tt.keep && got != tt.header {
+			t.Errorf("Expected request ID %q to be propagated, got %q", tt.header, got)
+		}
+		if !tt.keep && !uuidPattern.MatchString(got) {
+			t.Errorf("Header %q: expected a generated UUID, got %q", tt.header, got)
+		}
+	}
+
+	if id := RequestIDFromContext(httptest.NewRequest("GET", "/", nil).Context()); id != "" {
+		t.Errorf("Expected no request ID outside the middleware, got %q", id)
+	}
+}
@@ -0,0 +1,145 @@
+package simulator
+
+import "time"
+
+// Costs of the simulated resource model.
+const (
+	// messageCPUTime is the CPU time a node spends sending or receiving a
+	// replication copy or a hint. Serving a synthetic request takes
+	// loadServiceTime.
+	messageCPUTime = time.Millisecond
+
+	// kvEntryOverhead is the memory, in bytes, a key held by a node takes
+	// on top of the key and its value.
+	kvEntryOverhead = 64
+
+	// logEntryDiskSize is the disk space, in bytes, of an entry of a node's
+	// Raft log.
+	logEntryDiskSize = 128
+
+	// maxOverloadSlowdown bounds how many times slower a node close to its
+	// CPU limit serves synthetic requests.
+	maxOverloadSlowdown = 10
+)
+
+// Resources is the simulated resource usage of a node, sampled at the end
+// of every updater tick by ResourceRound.
+type Resources struct {
+	// CPU is the percentage of one core the node was busy for during the
+	// last tick, serving synthetic requests and replication traffic.
+	CPU float64 `json:"cpu" xml:"cpu"`
+
+	// Memory is the bytes taken by the keys the node holds, replicated and
+	// in its data store.
+	Memory int64 `json:"memory" xml:"memory"`
+
+	// Disk is the bytes taken by the node's Raft log.
+	Disk int64 `json:"disk" xml:"disk"`
+
+	// Overloaded is set while any of the usages is over its limit in
+	// Config.ResourceLimits. An overloaded node rejects synthetic requests
+	// and requests to its data store.
+	Overloaded bool `json:"overloaded" xml:"overloaded"`
+}
+
+// ResourceLimits are the resource usages past which a node is overloaded: a
+// node exactly at a limit is not. A zero limit means no limit.
+type ResourceLimits struct {
+	CPU    float64 `json:"cpu"`    // Percent of one core.
+	Memory int64   `json:"memory"` // Bytes.
+	Disk   int64   `json:"disk"`   // Bytes.
+}
+
+// over reports whether r is over any of the limits of l.
+func (l ResourceLimits) over(r Resources) bool {
+	return l.CPU > 0 && r.CPU > l.CPU ||
+		l.Memory > 0 && r.Memory > l.Memory ||
+		l.Disk > 0 && r.Disk > l.Disk
+}
+
+// resourceUsage accumulates the CPU time nodes spend between resource
+// rounds.
+type resourceUsage struct {
+	since time.Time             // When on the simulation clock the last round ended.
+	busy  map[int]time.Duration // CPU time spent since by node ID.
+}
+
+// charge adds d to the CPU time of the node with the given ID.
+func (u *resourceUsage) charge(id int, d time.Duration) {
+	if u.busy == nil {
+		u.busy = make(map[int]time.Duration)
+	}
+	u.busy[id] += d
+}
+
+// ResourceRound samples the resource usage of every node: the CPU time it
+// spent since the last round, over the simulation time that has passed, and
+// the memory and disk its data takes now. Nodes over Config.ResourceLimits
+// become overloaded, and those back under them recover. StartUpdater runs
+// it at the end of every tick.
+func (s *Simulator) ResourceRound() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.cfg.Clock.Now()
+	elapsed := now.Sub(s.usage.since)
+	for i := range s.nodes {
+		n := &s.nodes[i]
+		r := Resources{Memory: s.nodeMemory(n.ID), Disk: int64(len(s.raftLogs[n.ID])) * logEntryDiskSize}
+		if elapsed > 0 {
+			r.CPU = 100 * float64(s.usage.busy[n.ID]) / float64(elapsed)
+		}
+		r.Overloaded = s.cfg.ResourceLimits.over(r)
+		if r.Overloaded != n.Resources.Overloaded {
+			if r.Overloaded {
+				s.logger.Warn("node overloaded", "node_id", n.ID, "cpu", r.CPU, "memory", r.Memory, "disk", r.Disk)
+			} else {
+				s.logger.Info("node no longer overloaded", "node_id", n.ID)
+			}
+		}
+		n.Resources = r
+	}
+	s.usage = resourceUsage{since: now}
+	s.version++ // Resources change without an event.
+}
+
+// nodeMemory returns the bytes taken by the keys the node with the given ID
+// holds. The caller must hold s.mu.
+func (s *Simulator) nodeMemory(id int) int64 {
+	var size int64
+	for key, entry := range s.replicaData[id] {
+		size += int64(len(key) + len(entry.Value) + kvEntryOverhead)
+	}
+	for key, value := range s.store[id] {
+		size += int64(len(key) + len(value) + kvEntryOverhead)
+	}
+	return size
+}
+
+// overloadSlowdown returns how many times its service time a synthetic
+// request to a node with usage r takes: more the closer the node is to its
+// CPU limit, as work queues up, and 1 without a limit. The caller must hold
+// s.mu.
+func (s *Simulator) overloadSlowdown(r Resources) float64 {
+	limit := s.cfg.ResourceLimits.CPU
+	if limit <= 0 || r.CPU <= 0 {
+		return 1
+	}
+	if r.CPU >= limit*(1-1.0/maxOverloadSlowdown) {
+		return maxOverloadSlowdown
+	}
+	return 1 / (1 - r.CPU/limit)
+}
+
+// servingNode is like upNode, but also returns ErrNodeOverloaded if the node
+// is overloaded. The caller must hold s.mu.
+func (s *Simulator) servingNode(id int) (int, error) {
+	index, err := s.upNode(id)
+	if err != nil {
+		return -1, err
+	}
+	if s.nodes[index].Resources.Overloaded {
+		return -1, ErrNodeOverloaded
+	}
+	return index, nil
+}
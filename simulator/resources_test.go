@@ -0,0 +1,107 @@
+package simulator
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestResourceOverload tests that load driven at one node raises its CPU
+// usage until the node is overloaded, that it then rejects requests until
+// its usage falls back under the limit, and that a usage at a limit is not
+// over it.
+func TestResourceOverload(t *testing.T) {
+	clock := latencyClock(t)
+	s := New(Config{Clock: clock, Seed: 1, ResourceLimits: ResourceLimits{CPU: 50}})
+	s.Init(testNodeCount)
+	h := s.Handler()
+	owner := s.Locate("key-0")[0]
+	data := "/nodes/" + strconv.Itoa(owner) + "/data/k"
+
+	if _, err := s.GenerateLoad(LoadGenSettings{Rate: 20, Strategy: BalanceConsistentHash, Keys: 1}); err != nil {
+		t.Fatalf("GenerateLoad failed: %v", err)
+	}
+	round := func() Resources {
+		t.Helper()
+		runLoadGen(t, s, clock, 1)
+		s.ResourceRound()
+		node, _ := s.Node(owner)
+		return node.Resources
+	}
+
+	// 20 requests a second of 10ms each keep a fifth of a core busy.
+	if got := round(); got.CPU != 20 || got.Overloaded {
+		t.Fatalf("Expected 20%% CPU, got %+v", got)
+	}
+	if other, _ := s.Node((owner + 1) % testNodeCount); other.Resources.CPU != 0 {
+		t.Errorf("Expected the other nodes idle, got %+v", other.Resources)
+	}
+	expectCode(t, doRequest(t, h, "PUT", data, `{"value":"v"}`), http.StatusOK)
+
+	if _, err := s.GenerateLoad(LoadGenSettings{Rate: 80, Strategy: BalanceConsistentHash, Keys: 1}); err != nil {
+		t.Fatalf("GenerateLoad failed: %v", err)
+	}
+	if got := round(); got.CPU != 80 || !got.Overloaded || got.Memory == 0 {
+		t.Fatalf("Expected the node overloaded at 80%% CPU, got %+v", got)
+	}
+	rr := doRequest(t, h, "GET", data, "")
+	expectCode(t, rr, http.StatusServiceUnavailable)
+	if !strings.Contains(rr.Body.String(), "overloaded") {
+		t.Errorf("Expected an overloaded error, got %s", rr.Body)
+	}
+	rr = doRequest(t, h, "GET", "/metrics", "")
+	if want := "sim_node_cpu_percent{node=\"" + strconv.Itoa(owner) + "\"} 80\n"; !strings.Contains(rr.Body.String(), want) {
+		t.Errorf("Expected %q in the metrics", want)
+	}
+
+	// Refused requests cost nothing, so the node recovers a tick later.
+	if got := round(); got.CPU != 0 || got.Overloaded {
+		t.Errorf("Expected the node to recover, got %+v", got)
+	}
+	// The first rejections open the node's circuit breaker, which fails the
+	// rest at once.
+	stats := s.LoadGenStats()
+	if stats.Rejected != DefaultBreakerThreshold || stats.Nodes[0].Rejected != stats.Rejected || stats.ShortCircuited != 80-DefaultBreakerThreshold || stats.Errors != 0 {
+		t.Errorf("Expected %d rejected requests, got %+v", DefaultBreakerThreshold, stats)
+	}
+	expectCode(t, doRequest(t, h, "GET", data, ""), http.StatusOK)
+
+	// A node is overloaded past a limit, not at it.
+	limits := ResourceLimits{CPU: 50, Memory: 1024, Disk: 512}
+	for _, tt := range []struct {
+		usage Resources
+		want  bool
+	}{
+		{Resources{CPU: 50, Memory: 1024, Disk: 512}, false},
+		{Resources{CPU: 50.5}, true},
+		{Resources{Memory: 1025}, true},
+		{Resources{Disk: 513}, true},
+	} {
+		if got := limits.over(tt.usage); got != tt.want {
+			t.Errorf("%+v: expected overloaded %v, got %v", tt.usage, tt.want, got)
+		}
+	}
+}
+
+// TestResourceSlowdown tests that requests to a node slow down as it nears
+// its CPU limit.
+func TestResourceSlowdown(t *testing.T) {
+	s := New(Config{Seed: 1, ResourceLimits: ResourceLimits{CPU: 50}})
+	for _, tt := range []struct {
+		cpu  float64
+		want float64
+	}{
+		{0, 1},
+		{25, 2},
+		{45, maxOverloadSlowdown},
+		{60, maxOverloadSlowdown},
+	} {
+		if got := s.overloadSlowdown(Resources{CPU: tt.cpu}); got != tt.want {
+			t.Errorf("%v%% CPU: expected a slowdown of %v, got %v", tt.cpu, tt.want, got)
+		}
+	}
+	if got := New(Config{Seed: 1}).overloadSlowdown(Resources{CPU: 99}); got != 1 {
+		t.Errorf("Expected no slowdown without a limit, got %v", got)
+	}
+}
@@ -0,0 +1,407 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+)
+
+// DefaultRestartDuration is how long a restarting node stays down, used when
+// Config.RestartDuration is unset.
+const DefaultRestartDuration = 2 * time.Second
+
+// DefaultRestartTimeout is how long a rolling restart waits for a node to
+// become healthy once it is back up, used when RestartOptions.Timeout is
+// unset.
+const DefaultRestartTimeout = 30 * time.Second
+
+// restartPollInterval is how often, in simulation time, a rolling restart
+// checks whether the node it restarted has become healthy.
+const restartPollInterval = 100 * time.Millisecond
+
+// Where a restarting node reloads its state from.
+const (
+	ReloadSnapshot = "snapshot" // The state it held as it went down, as if saved to disk.
+	ReloadReplicas = "replicas" // The newest copies the other replicas of its keys hold; its data store is lost.
+	ReloadNone     = "none"     // Nothing: it comes back empty and relies on hints, read repair, and anti-entropy.
+)
+
+// Errors returned by Restart and RollingRestart.
+var (
+	// ErrInvalidRestart means a restart was asked for with an unknown
+	// reload source or a negative duration or timeout.
+	ErrInvalidRestart = errors.New("invalid restart")
+
+	// ErrRestarting means a node asked to restart is already restarting,
+	// or a rolling restart is already running.
+	ErrRestarting = errors.New("restart already in progress")
+
+	// ErrRestartTimeout means a node restarted by a rolling restart did
+	// not become healthy in time.
+	ErrRestartTimeout = errors.New("restarted node did not become healthy")
+)
+
+// RestartOptions configures a restart. Zero fields mean Config.RestartReload
+// and Config.RestartDuration, and DefaultRestartTimeout.
+type RestartOptions struct {
+	Reload   string        // ReloadSnapshot, ReloadReplicas, or ReloadNone.
+	Duration time.Duration // How long the node stays down, on the simulation clock.
+	Timeout  time.Duration // How long a rolling restart waits for each node to become healthy.
+}
+
+// Restart describes the restart of one node.
+type Restart struct {
+	NodeID   int       `json:"node_id"`
+	Reload   string    `json:"reload"`
+	Duration Duration  `json:"duration"` // How long the node stays down.
+	Started  time.Time `json:"started"`  // When it went down, on the simulation clock.
+
+	// Downtime is how long the node was down, set once it is back up.
+	Downtime Duration `json:"downtime,omitempty"`
+}
+
+// RollingRestart describes a rolling restart of the cluster.
+type RollingRestart struct {
+	Restarts []Restart `json:"restarts"`          // In the order the nodes were restarted.
+	Skipped  []int     `json:"skipped,omitempty"` // Nodes that were down or gone when their turn came.
+	MinUp    int       `json:"min_up"`            // Fewest nodes seen up at once while it ran.
+	Duration Duration  `json:"duration"`          // How long it took, on the simulation clock.
+}
+
+// restartState tracks a node's restart until it is back up.
+type restartState struct {
+	Restart
+	store    map[string]string  // The node's data store as it went down.
+	replicas map[string]KVEntry // The node's replicated keys as it went down.
+	hints    []Hint             // The hints the node held as it went down.
+	done     chan struct{}      // Closed once the node is back up, or the restart is abandoned.
+}
+
+// withDefaults returns opts with its zero fields filled in from cfg.
+func (opts RestartOptions) withDefaults(cfg Config) (RestartOptions, error) {
+	if opts.Reload == "" {
+		opts.Reload = cfg.RestartReload
+	}
+	if opts.Duration == 0 {
+		opts.Duration = cfg.RestartDuration
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultRestartTimeout
+	}
+	switch {
+	case opts.Reload != ReloadSnapshot && opts.Reload != ReloadReplicas && opts.Reload != ReloadNone:
+		return opts, fmt.Errorf("%w: reload must be %q, %q, or %q, got %q", ErrInvalidRestart, ReloadSnapshot, ReloadReplicas, ReloadNone, opts.Reload)
+	case opts.Duration < 0 || opts.Timeout < 0:
+		return opts, fmt.Errorf("%w: duration and timeout must not be negative", ErrInvalidRestart)
+	}
+	return opts, nil
+}
+
+// Restart takes the node with the given ID down for opts.Duration on the
+// simulation clock, then brings it back up, as a process restart would. The
+// node loses its volatile state as it goes down: its data store, its copies
+// of replicated keys, and the hints it holds. As it comes back up, it
+// reloads them from the source opts.Reload names, and sends the failure
+// detector a heartbeat. The leader is re-elected both times as for any
+// failure and recovery. Restart returns at once, before the node is back. It
+// returns ErrNodeNotFound or ErrNodeDown if the node cannot be restarted, an
+// error wrapping ErrInvalidRestart for invalid options, and ErrRestarting if
+// the node is already restarting.
+func (s *Simulator) Restart(id int, opts RestartOptions) (Restart, error) {
+	state, err := s.restart(id, opts)
+	if err != nil {
+		return Restart{}, err
+	}
+	return s.restartRecord(state), nil
+}
+
+// restart implements Restart, returning the restart's state.
+func (s *Simulator) restart(id int, opts RestartOptions) (*restartState, error) {
+	opts, err := opts.withDefaults(s.cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.restarts[id]; ok {
+		return nil, ErrRestarting
+	}
+	index, err := s.upNode(id)
+	if err != nil {
+		return nil, err
+	}
+	state := &restartState{
+		Restart: Restart{NodeID: id, Reload: opts.Reload, Duration: Duration(opts.Duration), Started: s.cfg.Clock.Now()},
+		done:    make(chan struct{}),
+	}
+	if opts.Reload == ReloadSnapshot {
+		state.store, state.replicas, state.hints = s.store[id], s.replicaData[id], s.hints[id]
+	}
+	delete(s.store, id)
+	delete(s.replicaData, id)
+	delete(s.hints, id)
+	s.transition(index, StatusDown)
+	s.restarts[id] = state
+	s.logger.Info("node restarting", "node_id", id, "reload", opts.Reload, "duration", opts.Duration)
+
+	ticker := s.cfg.Clock.NewTicker(opts.Duration)
+	go func() {
+		defer ticker.Stop()
+		<-ticker.C()
+		s.finishRestart(state)
+	}()
+	return state, nil
+}
+
+// finishRestart brings the node of a restart back up once its duration has
+// passed, reloading its state, unless the restart was abandoned meanwhile.
+func (s *Simulator) finishRestart(state *restartState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := state.NodeID
+	index := s.findNode(id)
+	if s.restarts[id] != state || index < 0 {
+		return
+	}
+	delete(s.restarts, id)
+
+	now := s.cfg.Clock.Now()
+	switch state.Reload {
+	case ReloadSnapshot:
+		if state.store != nil {
+			s.store[id] = state.store
+		}
+		if state.replicas != nil {
+			s.replicaData[id] = state.replicas
+		}
+		if state.hints != nil {
+			s.hints[id] = state.hints
+		}
+	case ReloadReplicas:
+		s.reloadReplicas(id, now)
+	}
+	s.heartbeat(id).last = now
+	state.Downtime = Duration(now.Sub(state.Started))
+	s.restartDurations.observe(now.Sub(state.Started).Seconds())
+	s.transition(index, StatusUp)
+	close(state.done)
+	s.logger.Info("node restarted", "node_id", id, "reload", state.Reload, "downtime", now.Sub(state.Started))
+}
+
+// reloadReplicas copies to the node with the given ID, which is coming back
+// up, the newest copy of every key it is a replica of from the up replicas it
+// can reach. The caller must hold s.mu for writing.
+func (s *Simulator) reloadReplicas(id int, now time.Time) {
+	reloaded := 0
+	for _, key := range s.kvKeys() {
+		replicas := s.preferenceList(key, s.cfg.N)
+		if !slices.Contains(replicas, id) {
+			continue
+		}
+		source, newest, ok := s.newestUpReplica(key, replicas)
+		if !ok || !s.reachable(source, id) {
+			continue
+		}
+		entry := s.replyEntry(source, newest)
+		if s.wants(id, key, entry, now) && s.intact(id, key, entry) {
+			s.storeReplica(id, key, entry)
+			reloaded++
+		}
+	}
+	s.logger.Debug("replicas reloaded", "node_id", id, "keys", reloaded)
+}
+
+// abandonRestart forgets the pending restart of the node with the given ID,
+// if any, so that it doesn't bring the node up again: the node has been
+// recovered some other way, or removed. The caller must hold s.mu for
+// writing.
+func (s *Simulator) abandonRestart(id int) {
+	if state, ok := s.restarts[id]; ok {
+		delete(s.restarts, id)
+		close(state.done)
+	}
+}
+
+// healthy reports whether the node with the given ID exists, is up, isn't
+// suspected by the failure detector, and isn't restarting. The caller must
+// hold s.mu.
+func (s *Simulator) healthy(id int) bool {
+	index := s.findNode(id)
+	if index < 0 {
+		return false
+	}
+	_, restarting := s.restarts[id]
+	return s.nodes[index].Status == StatusUp && !s.nodes[index].Suspected && !restarting
+}
+
+// RollingRestart restarts the nodes one at a time, as Restart does, waiting
+// for each to become healthy again, up and unsuspected, before restarting the
+// next, so that at most one node is down for it at once. The leaders are
+// restarted last, so that the leader changes as few times as possible. Nodes
+// that are down when their turn comes are skipped. It returns
+// ErrRestarting if a rolling restart is already running, an error wrapping
+// ErrInvalidRestart for invalid options, an error wrapping ErrRestartTimeout
+// if a node isn't healthy opts.Timeout after it is back up, and ctx's error
+// if it is done first; the rolling restart stops there, and the restarts
+// made so far are returned with the error.
+func (s *Simulator) RollingRestart(ctx context.Context, opts RestartOptions) (RollingRestart, error) {
+	opts, err := opts.withDefaults(s.cfg)
+	if err != nil {
+		return RollingRestart{}, err
+	}
+	if !s.rolling.CompareAndSwap(false, true) {
+		return RollingRestart{}, ErrRestarting
+	}
+	defer s.rolling.Store(false)
+
+	s.mu.RLock()
+	started := s.cfg.Clock.Now()
+	ids := make([]int, len(s.nodes))
+	for i, node := range s.nodes {
+		ids[i] = node.ID
+	}
+	sort.SliceStable(ids, func(i, j int) bool {
+		return !s.nodes[s.findNode(ids[i])].Leader && s.nodes[s.findNode(ids[j])].Leader
+	})
+	report := RollingRestart{MinUp: s.upCount()}
+	s.mu.RUnlock()
+
+	poll := s.cfg.Clock.NewTicker(restartPollInterval)
+	defer poll.Stop()
+	for _, id := range ids {
+		state, err := s.restart(id, opts)
+		if errors.Is(err, ErrNodeDown) || errors.Is(err, ErrNodeNotFound) {
+			report.Skipped = append(report.Skipped, id)
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+
+		var deadline time.Time
+		for {
+			s.mu.RLock()
+			report.MinUp = min(report.MinUp, s.upCount())
+			healthy := s.healthy(id)
+			back := s.restarts[id] != state
+			now := s.cfg.Clock.Now()
+			s.mu.RUnlock()
+			if back && deadline.IsZero() {
+				deadline = now.Add(opts.Timeout)
+			}
+			if healthy {
+				break
+			}
+			if back && !now.Before(deadline) {
+				report.Restarts = append(report.Restarts, s.restartRecord(state))
+				return report, fmt.Errorf("%w: node %d within %v", ErrRestartTimeout, id, opts.Timeout)
+			}
+			select {
+			case <-ctx.Done():
+				return report, ctx.Err()
+			case <-poll.C():
+			}
+		}
+		report.Restarts = append(report.Restarts, s.restartRecord(state))
+	}
+	report.Duration = Duration(s.cfg.Clock.Now().Sub(started))
+	s.logger.Info("rolling restart finished", "restarted", len(report.Restarts), "skipped", len(report.Skipped), "min_up", report.MinUp)
+	return report, nil
+}
+
+// restartRecord returns the record of a restart, read under s.mu.
+func (s *Simulator) restartRecord(state *restartState) Restart {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return state.Restart
+}
+
+// upCount returns the number of up nodes. The caller must hold s.mu.
+func (s *Simulator) upCount() int {
+	up := 0
+	for i := range s.nodes {
+		if s.nodes[i].Status == StatusUp {
+			up++
+		}
+	}
+	return up
+}
+
+// restartOptions parses the "reload", "duration", and "timeout" query
+// parameters of a restart request, writing a 400 response if one is invalid.
+func restartOptions(w http.ResponseWriter, r *http.Request) (RestartOptions, bool) {
+	values := r.URL.Query()
+	opts := RestartOptions{Reload: values.Get("reload")}
+	var err error
+	if opts.Duration, err = durationParam(values, "duration", 0); err != nil {
+		writeError(w, http.StatusBadRequest, "Query parameter \"duration\" must be a duration")
+		return RestartOptions{}, false
+	}
+	if opts.Timeout, err = durationParam(values, "timeout", 0); err != nil {
+		writeError(w, http.StatusBadRequest, "Query parameter \"timeout\" must be a duration")
+		return RestartOptions{}, false
+	}
+	return opts, true
+}
+
+// writeRestartError maps a restart error to an HTTP error response.
+func writeRestartError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNodeNotFound):
+		writeError(w, http.StatusNotFound, "Node not found")
+	case errors.Is(err, ErrInvalidRestart):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrNodeDown), errors.Is(err, ErrRestarting):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, ErrRestartTimeout):
+		writeError(w, http.StatusGatewayTimeout, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// restartNode handles HTTP requests to restart a node. It returns 202 once
+// the node is down, before it comes back up.
+func (s *Simulator) restartNode(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseNodeID(w, r)
+	if !ok {
+		return
+	}
+	opts, ok := restartOptions(w, r)
+	if !ok {
+		return
+	}
+
+	restart, err := s.Restart(id, opts)
+	if err != nil {
+		writeRestartError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, restart)
+}
+
+// rollingRestart handles HTTP requests to restart every node in turn. It
+// responds once the last node is healthy again.
+func (s *Simulator) rollingRestart(w http.ResponseWriter, r *http.Request) {
+	opts, ok := restartOptions(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := s.RollingRestart(r.Context(), opts)
+	switch {
+	case r.Context().Err() != nil:
+		// The client has gone.
+	case err != nil:
+		writeRestartError(w, err)
+	default:
+		writeJSON(w, http.StatusOK, report)
+	}
+}
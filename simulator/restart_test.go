@@ -0,0 +1,136 @@
+package simulator
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRestart tests that a restarted node is down for the restart duration
+// and comes back with the state its reload source gives it.
+func TestRestart(t *testing.T) {
+	clock := latencyClock(t)
+	s := New(Config{Clock: clock, N: 5, W: 5})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	expectCode(t, doRequest(t, h, "PUT", "/kv/color", `{"value":"blue"}`), http.StatusOK)
+	restart := func(reload string) {
+		t.Helper()
+		expectCode(t, doRequest(t, h, "PUT", "/nodes/1/data/city", `{"value":"Oslo"}`), http.StatusOK)
+		var r Restart
+		rr := doRequest(t, h, "POST", "/nodes/1/restart?duration=2s&reload="+reload, "")
+		expectCode(t, rr, http.StatusAccepted)
+		decodeBody(t, rr, &r)
+		if r.NodeID != 1 || r.Reload != reload || r.Duration != Duration(2*time.Second) {
+			t.Fatalf("Unexpected restart %+v", r)
+		}
+		expectCode(t, doRequest(t, h, "GET", "/nodes/1/data/city", ""), http.StatusServiceUnavailable)
+		expectCode(t, doRequest(t, h, "POST", "/nodes/1/restart", ""), http.StatusConflict)
+		clock.Step()
+		if node, _ := s.Node(1); node.Status != StatusDown {
+			t.Fatalf("Expected node 1 to stay down for 2s, got %+v", node)
+		}
+		clock.Step()
+		waitFor(t, func() bool {
+			node, _ := s.Node(1)
+			return node.Status == StatusUp
+		})
+	}
+
+	restart(ReloadSnapshot)
+	expectCode(t, doRequest(t, h, "GET", "/nodes/1/data/city", ""), http.StatusOK)
+	if replicas, _ := s.KVReplicas("color"); !replicas.InSync {
+		t.Errorf("Expected node 1 to reload its copy of color, got %+v", replicas)
+	}
+
+	restart(ReloadReplicas)
+	expectCode(t, doRequest(t, h, "GET", "/nodes/1/data/city", ""), http.StatusNotFound)
+	if replicas, _ := s.KVReplicas("color"); !replicas.InSync {
+		t.Errorf("Expected node 1 to reload color from the other replicas, got %+v", replicas)
+	}
+
+	restart(ReloadNone)
+	expectCode(t, doRequest(t, h, "GET", "/nodes/1/data/city", ""), http.StatusNotFound)
+	if replicas, _ := s.KVReplicas("color"); replicas.InSync {
+		t.Errorf("Expected node 1 to come back without color, got %+v", replicas)
+	}
+
+	s.Fail(2)
+	expectCode(t, doRequest(t, h, "POST", "/nodes/2/restart", ""), http.StatusConflict)
+	expectCode(t, doRequest(t, h, "POST", "/nodes/9/restart", ""), http.StatusNotFound)
+	for _, query := range []string{"reload=disk", "duration=-1s", "duration=soon"} {
+		expectCode(t, doRequest(t, h, "POST", "/nodes/3/restart?"+query, ""), http.StatusBadRequest)
+	}
+
+	// Recovering a restarting node by hand ends the restart.
+	expectCode(t, doRequest(t, h, "POST", "/nodes/3/restart?duration=1s", ""), http.StatusAccepted)
+	s.Recover(3)
+	expectCode(t, doRequest(t, h, "PUT", "/nodes/3/data/city", `{"value":"Rome"}`), http.StatusOK)
+	clock.Step()
+	time.Sleep(10 * time.Millisecond)
+	if entry, err := s.GetData(3, "city"); err != nil || entry.Value != "Rome" {
+		t.Errorf("Expected the abandoned restart to leave node 3 alone, got %+v and %v", entry, err)
+	}
+
+	body := doRequest(t, h, "GET", "/metrics", "").Body.String()
+	if !strings.Contains(body, "sim_restart_duration_seconds_count 3\n") || !strings.Contains(body, "sim_restart_duration_seconds_sum 6\n") {
+		t.Errorf("Expected three 2s restarts in the metrics, got\n%s", body)
+	}
+}
+
+// TestRollingRestart tests that a rolling restart over five nodes keeps at
+// least four of them up, ends with the leader, and loses no data.
+func TestRollingRestart(t *testing.T) {
+	for _, reload := range []string{ReloadSnapshot, ReloadReplicas} {
+		clock := latencyClock(t)
+		s := New(Config{Clock: clock, RestartReload: reload})
+		s.Init(testNodeCount)
+		h := s.Handler()
+		ctx, cancel := context.WithCancel(context.Background())
+		go s.StartHeartbeats(ctx, time.Second)
+
+		keys := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+		for i, key := range keys {
+			if _, err := s.KVPut(key, strconv.Itoa(i)); err != nil {
+				t.Fatalf("KVPut failed: %v", err)
+			}
+		}
+
+		var report RollingRestart
+		done := make(chan error, 1)
+		go func() {
+			var err error
+			report, err = s.RollingRestart(context.Background(), RestartOptions{})
+			done <- err
+		}()
+		if err := stepUntil(t, clock, done); err != nil {
+			t.Fatalf("Rolling restart with %s reload failed: %v", reload, err)
+		}
+		cancel()
+
+		if report.MinUp < testNodeCount-1 || len(report.Restarts) != testNodeCount || len(report.Skipped) != 0 {
+			t.Fatalf("Expected every node restarted with at least 4 up, got %+v", report)
+		}
+		if last := report.Restarts[testNodeCount-1]; last.NodeID != 0 {
+			t.Errorf("Expected the leader, node 0, to be restarted last, got %+v", report.Restarts)
+		}
+		for _, r := range report.Restarts {
+			if r.Downtime < Duration(DefaultRestartDuration) {
+				t.Errorf("Expected node %d to be down for the restart duration, got %v", r.NodeID, r.Downtime)
+			}
+		}
+		if leader, ok := s.Leader(); !ok || leader.ID != 0 {
+			t.Errorf("Expected node 0 to lead again, got %+v", leader)
+		}
+		for i, key := range keys {
+			if result, err := s.KVGet(key); err != nil || result.Value != strconv.Itoa(i) {
+				t.Errorf("With %s reload, expected %s=%d to survive, got %+v and %v", reload, key, i, result, err)
+			}
+		}
+		expectCode(t, doRequest(t, h, "POST", "/cluster/rolling-restart?reload=disk", ""), http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,250 @@
+package simulator
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrNoResultsDir means results were exported by a simulator created without
+// Config.ResultsDir.
+var ErrNoResultsDir = errors.New("exporting results requires a results directory")
+
+// maxTickSamples is the number of tick samples retained before the oldest is
+// evicted: over 18 hours of ticks at a one-second update interval.
+const maxTickSamples = 1 << 16
+
+// Names of the files ExportResults writes.
+const (
+	resultsNodesFile   = "nodes.csv"
+	resultsEventsFile  = "events.csv"
+	resultsMetricsFile = "metrics.csv"
+)
+
+// TickSample aggregates the nodes as they were at the end of one tick of
+// the updater, or of a replay.
+type TickSample struct {
+	Tick       int       `json:"tick"` // Counts from 1.
+	Time       time.Time `json:"time"` // On the simulation clock.
+	Nodes      int       `json:"nodes"`
+	Up         int       `json:"up"`
+	Down       int       `json:"down"`
+	Suspected  int       `json:"suspected"`
+	MeanValue  float64   `json:"mean_value"` // Over every node, or 0 without any.
+	MinValue   int       `json:"min_value"`
+	MaxValue   int       `json:"max_value"`
+	Leader     *int      `json:"leader"`     // ID of the leader, or nil for none.
+	Updates    int64     `json:"updates"`    // Updates performed so far.
+	Failures   int       `json:"failures"`   // Failures so far.
+	Recoveries int       `json:"recoveries"` // Recoveries so far.
+}
+
+// tickLog retains the latest tick samples, oldest first. It has its own
+// lock, so exporting doesn't hold up the simulation.
+type tickLog struct {
+	mu      sync.Mutex
+	tick    int
+	samples []TickSample
+}
+
+// ResultsInfo describes the files written by ExportResults.
+type ResultsInfo struct {
+	Dir    string   `json:"dir"`
+	Files  []string `json:"files"`
+	Nodes  int      `json:"nodes"`  // Rows of nodes.csv.
+	Events int      `json:"events"` // Rows of events.csv.
+	Ticks  int      `json:"ticks"`  // Rows of metrics.csv.
+}
+
+// eventsCSVHeader names the columns of events.csv: the event's, then its
+// node's, prefixed by "node_".
+var eventsCSVHeader = func() []string {
+	header := []string{"seq", "type", "time"}
+	for _, column := range csvHeader {
+		header = append(header, "node_"+column)
+	}
+	return header
+}()
+
+// metricsCSVHeader names the columns of metrics.csv, matching the JSON field
+// names of TickSample.
+var metricsCSVHeader = []string{"tick", "time", "nodes", "up", "down", "suspected", "mean_value", "min_value", "max_value", "leader", "updates", "failures", "recoveries"}
+
+// sampleTick records a TickSample of the nodes as they are now.
+func (s *Simulator) sampleTick() {
+	s.mu.RLock()
+	s.rlockNodes()
+	sample := TickSample{
+		Time:       s.cfg.Clock.Now(),
+		Nodes:      len(s.nodes),
+		Updates:    s.updates.Load(),
+		Failures:   s.failures,
+		Recoveries: s.recoveries,
+	}
+	sum := 0
+	for i, node := range s.nodes {
+		switch node.Status {
+		case StatusUp:
+			sample.Up++
+		case StatusDown:
+			sample.Down++
+		}
+		if node.Suspected {
+			sample.Suspected++
+		}
+		sum += node.Value
+		if i == 0 || node.Value < sample.MinValue {
+			sample.MinValue = node.Value
+		}
+		if i == 0 || node.Value > sample.MaxValue {
+			sample.MaxValue = node.Value
+		}
+	}
+	if len(s.nodes) > 0 {
+		sample.MeanValue = float64(sum) / float64(len(s.nodes))
+	}
+	if i := s.topLeader(); i >= 0 {
+		id := s.nodes[i].ID
+		sample.Leader = &id
+	}
+	s.runlockNodes()
+	s.mu.RUnlock()
+
+	s.ticks.mu.Lock()
+	defer s.ticks.mu.Unlock()
+	s.ticks.tick++
+	sample.Tick = s.ticks.tick
+	if len(s.ticks.samples) >= maxTickSamples {
+		s.ticks.samples = append(s.ticks.samples[:0], s.ticks.samples[1:]...)
+	}
+	s.ticks.samples = append(s.ticks.samples, sample)
+}
+
+// TickSamples returns the retained tick samples, oldest first.
+func (s *Simulator) TickSamples() []TickSample {
+	s.ticks.mu.Lock()
+	defer s.ticks.mu.Unlock()
+	return append([]TickSample{}, s.ticks.samples...)
+}
+
+// metricsRecord returns the CSV columns of sample.
+func metricsRecord(sample TickSample) []string {
+	leader := ""
+	if sample.Leader != nil {
+		leader = strconv.Itoa(*sample.Leader)
+	}
+	return []string{
+		strconv.Itoa(sample.Tick),
+		sample.Time.Format(time.RFC3339Nano),
+		strconv.Itoa(sample.Nodes),
+		strconv.Itoa(sample.Up),
+		strconv.Itoa(sample.Down),
+		strconv.Itoa(sample.Suspected),
+		strconv.FormatFloat(sample.MeanValue, 'f', -1, 64),
+		strconv.Itoa(sample.MinValue),
+		strconv.Itoa(sample.MaxValue),
+		leader,
+		strconv.FormatInt(sample.Updates, 10),
+		strconv.Itoa(sample.Failures),
+		strconv.Itoa(sample.Recoveries),
+	}
+}
+
+// ExportResults writes the results of the run so far to Config.ResultsDir,
+// replacing any written before: the nodes as they are now to nodes.csv, the
+// retained event log to events.csv, and the retained tick samples to
+// metrics.csv. Every file starts with a header row and has its columns in a
+// fixed order, with times in RFC 3339 format. It returns ErrNoResultsDir
+// without a Config.ResultsDir.
+func (s *Simulator) ExportResults() (ResultsInfo, error) {
+	if s.cfg.ResultsDir == "" {
+		return ResultsInfo{}, ErrNoResultsDir
+	}
+
+	s.mu.RLock()
+	s.rlockNodes()
+	nodes := cloneNodes(s.nodes)
+	s.runlockNodes()
+	s.feedMu.Lock()
+	events := append([]Event{}, s.eventLog...)
+	s.feedMu.Unlock()
+	s.mu.RUnlock()
+	samples := s.TickSamples()
+
+	nodeRecords := [][]string{csvHeader}
+	for _, node := range nodes {
+		nodeRecords = append(nodeRecords, csvRecord(node))
+	}
+	eventRecords := [][]string{eventsCSVHeader}
+	for _, e := range events {
+		record := []string{strconv.FormatUint(e.Seq, 10), e.Type, e.Time.Format(time.RFC3339Nano)}
+		eventRecords = append(eventRecords, append(record, csvRecord(e.Node)...))
+	}
+	metricRecords := [][]string{metricsCSVHeader}
+	for _, sample := range samples {
+		metricRecords = append(metricRecords, metricsRecord(sample))
+	}
+
+	if err := os.MkdirAll(s.cfg.ResultsDir, 0o755); err != nil {
+		return ResultsInfo{}, err
+	}
+	files := []struct {
+		name    string
+		records [][]string
+	}{
+		{resultsNodesFile, nodeRecords},
+		{resultsEventsFile, eventRecords},
+		{resultsMetricsFile, metricRecords},
+	}
+	info := ResultsInfo{Dir: s.cfg.ResultsDir, Nodes: len(nodes), Events: len(events), Ticks: len(samples)}
+	for _, f := range files {
+		if err := writeCSVFile(filepath.Join(s.cfg.ResultsDir, f.name), f.records); err != nil {
+			return ResultsInfo{}, err
+		}
+		info.Files = append(info.Files, f.name)
+	}
+
+	s.logger.Info("results exported", "dir", info.Dir, "nodes", info.Nodes, "events", info.Events, "ticks", info.Ticks)
+	return info, nil
+}
+
+// writeCSVFile writes records to the file at path as CSV, through a
+// temporary file so the file is never left half-written.
+func writeCSVFile(path string, records [][]string) error {
+	var buf bytes.Buffer
+	if err := csv.NewWriter(&buf).WriteAll(records); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// exportResults handles HTTP requests to export the results of the run.
+func (s *Simulator) exportResults(w http.ResponseWriter, r *http.Request) {
+	info, err := s.ExportResults()
+	switch {
+	case errors.Is(err, ErrNoResultsDir):
+		writeError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		writeJSON(w, http.StatusCreated, info)
+	}
+}
@@ -0,0 +1,99 @@
+package simulator
+
+import (
+	"context"
+	"encoding/csv"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// readCSV parses the CSV file name in dir.
+func readCSV(t *testing.T, dir, name string) [][]string {
+	t.Helper()
+	f, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", name, err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to parse %s: %v", name, err)
+	}
+	return records
+}
+
+// TestExportResults tests that a short simulation samples every updater
+// tick, and that POST /export writes the nodes, event log, and samples as
+// CSV files with fixed headers and one row each.
+func TestExportResults(t *testing.T) {
+	clock := NewVirtualClock(time.Unix(0, 0))
+	clock.Pause()
+	dir := t.TempDir()
+	s := New(Config{Seed: 1, Clock: clock, UpdateInterval: time.Second, ResultsDir: dir})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.StartUpdater(ctx, time.Second)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	waitFor(t, func() bool { return tickerCount(clock) == 1 })
+	for tick := 1; tick <= 3; tick++ {
+		if tick == 2 {
+			s.Fail(0)
+		}
+		if err := clock.Step(); err != nil {
+			t.Fatalf("Step failed: %v", err)
+		}
+		waitFor(t, func() bool { return len(s.TickSamples()) == tick })
+	}
+
+	samples := s.TickSamples()
+	if got := samples[1]; got.Tick != 2 || !got.Time.Equal(time.Unix(2, 0)) || got.Up != testNodeCount-1 || got.Down != 1 || got.Failures != 1 || got.Updates != 2 || got.Leader == nil || *got.Leader != 1 {
+		t.Errorf("Expected the second tick with node 0 down and node 1 leading, got %+v", got)
+	}
+
+	rr := doRequest(t, h, "POST", "/export", "")
+	expectCode(t, rr, http.StatusCreated)
+	var info ResultsInfo
+	decodeBody(t, rr, &info)
+	events := s.EventHistory(0, MaxHistoryLimit).Events
+	if info.Dir != dir || info.Nodes != testNodeCount || info.Events != len(events) || info.Ticks != 3 || !slices.Equal(info.Files, []string{"nodes.csv", "events.csv", "metrics.csv"}) {
+		t.Errorf("Unexpected export: %+v", info)
+	}
+
+	nodes := readCSV(t, dir, "nodes.csv")
+	if !slices.Equal(nodes[0], csvHeader) || len(nodes) != testNodeCount+1 || nodes[1][4] != StatusDown {
+		t.Errorf("Expected a header and %d nodes with node 0 down, got %q", testNodeCount, nodes)
+	}
+	eventRows := readCSV(t, dir, "events.csv")
+	if len(eventRows) != len(events)+1 || eventRows[0][0] != "seq" || eventRows[0][3] != "node_id" || len(eventRows[0]) != 3+len(csvHeader) {
+		t.Fatalf("Expected a header and %d events, got %q", len(events), eventRows)
+	}
+	for i, e := range events {
+		if row := eventRows[i+1]; row[0] != strconv.FormatUint(e.Seq, 10) || row[1] != e.Type || row[2] != e.Time.Format(time.RFC3339Nano) {
+			t.Errorf("Row %d: expected event %d, got %q", i+1, e.Seq, row)
+		}
+	}
+	metrics := readCSV(t, dir, "metrics.csv")
+	if !slices.Equal(metrics[0], metricsCSVHeader) || len(metrics) != 4 {
+		t.Fatalf("Expected a header and 3 ticks, got %q", metrics)
+	}
+	if row := metrics[2]; row[0] != "2" || row[1] != "1970-01-01T00:00:02Z" || row[4] != "1" || row[9] != "1" {
+		t.Errorf("Expected the second tick with one node down and node 1 leading, got %q", row)
+	}
+
+	// Without a results directory, nothing is exported.
+	expectCode(t, doRequest(t, New(Config{Seed: 1}).Handler(), "POST", "/export", ""), http.StatusConflict)
+}
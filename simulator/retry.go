@@ -0,0 +1,194 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Operations that are retried under a RetryPolicy.
+const (
+	RetryReplication = "replication" // A copy of a key sent by ReplicationRound.
+	RetryHint        = "hint"        // A hinted write handed off to its replica.
+	RetryPrepare     = "prepare"     // A two-phase commit's prepare call to a participant.
+	RetryWebhook     = "webhook"     // A notification POSTed to a webhook.
+)
+
+// Defaults of Config.Retry.
+const (
+	DefaultRetryAttempts  = 3
+	DefaultRetryBaseDelay = 100 * time.Millisecond
+	DefaultRetryMaxDelay  = time.Second
+)
+
+// ErrInvalidRetry means a retry policy was rejected.
+var ErrInvalidRetry = errors.New("invalid retry policy")
+
+// Why an attempt of an operation between nodes failed.
+var (
+	errMessageLost = errors.New("message lost")
+	errNodeDown    = errors.New("node down")
+)
+
+// RetryPolicy decides how often an operation between nodes is attempted and
+// how long it backs off between attempts. The backoff before a retry is
+// drawn with full jitter: uniformly at random up to BaseDelay doubled for
+// every earlier retry, capped at MaxDelay.
+type RetryPolicy struct {
+	MaxAttempts int      `json:"max_attempts"` // Attempts in all, the first included; 1 means no retries.
+	BaseDelay   Duration `json:"base_delay"`
+	MaxDelay    Duration `json:"max_delay"`
+}
+
+// withDefaults returns p with its zero fields taken from base.
+func (p RetryPolicy) withDefaults(base RetryPolicy) RetryPolicy {
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = base.MaxAttempts
+	}
+	if p.BaseDelay == 0 {
+		p.BaseDelay = base.BaseDelay
+	}
+	if p.MaxDelay == 0 {
+		p.MaxDelay = base.MaxDelay
+	}
+	return p
+}
+
+// validate returns an error wrapping ErrInvalidRetry if p is invalid.
+func (p RetryPolicy) validate() error {
+	switch {
+	case p.MaxAttempts < 1:
+		return fmt.Errorf("%w: max attempts must be at least 1", ErrInvalidRetry)
+	case p.BaseDelay < 0:
+		return fmt.Errorf("%w: base delay must not be negative", ErrInvalidRetry)
+	case p.MaxDelay < p.BaseDelay:
+		return fmt.Errorf("%w: max delay must be at least the base delay", ErrInvalidRetry)
+	}
+	return nil
+}
+
+// backoff returns the delay before retry n, counting from 1, drawn from rng.
+func (p RetryPolicy) backoff(n int, rng *rand.Rand) time.Duration {
+	ceiling := time.Duration(p.MaxDelay)
+	if n <= 62 {
+		if d := time.Duration(p.BaseDelay) << (n - 1); d > 0 && d < ceiling {
+			ceiling = d
+		}
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rng.Int63n(int64(ceiling) + 1))
+}
+
+// retry calls op until it returns nil or has been called p.MaxAttempts
+// times, calling wait with the backoff before each retry. It stops as soon
+// as ctx is done or wait fails. It returns the number of calls made and the
+// error of the last, or the error of ctx or wait if retrying was cut short.
+func retry(ctx context.Context, p RetryPolicy, rng *rand.Rand, wait func(context.Context, time.Duration) error, op func(attempt int) error) (int, error) {
+	var err error
+	for attempt := 1; attempt <= p.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			if werr := wait(ctx, p.backoff(attempt-1, rng)); werr != nil {
+				return attempt - 1, werr
+			}
+		}
+		if cerr := ctx.Err(); cerr != nil {
+			return attempt - 1, cerr
+		}
+		if err = op(attempt); err == nil {
+			return attempt, nil
+		}
+	}
+	return p.MaxAttempts, err
+}
+
+// ParseRetryOverrides parses retry policies by operation such as
+// "replication=5:50ms:2s,prepare=1", where each policy gives the maximum
+// attempts, base delay, and maximum delay. Those left out are taken from
+// base.
+func ParseRetryOverrides(spec string, base RetryPolicy) (map[string]RetryPolicy, error) {
+	overrides := make(map[string]RetryPolicy)
+	for _, part := range strings.Split(spec, ",") {
+		operation, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		if operation != RetryReplication && operation != RetryHint && operation != RetryPrepare && operation != RetryWebhook {
+			return nil, fmt.Errorf("unknown operation %q, expected replication, hint, prepare, or webhook", operation)
+		}
+		fields := strings.Split(value, ":")
+		if len(fields) > 3 {
+			return nil, fmt.Errorf("retry %s: expected attempts[:base-delay[:max-delay]], got %q", operation, value)
+		}
+		policy := base
+		attempts, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("retry %s: invalid attempts %q", operation, fields[0])
+		}
+		policy.MaxAttempts = attempts
+		for i, delay := range []*Duration{&policy.BaseDelay, &policy.MaxDelay} {
+			if len(fields) <= i+1 {
+				break
+			}
+			d, err := time.ParseDuration(fields[i+1])
+			if err != nil {
+				return nil, fmt.Errorf("retry %s: %v", operation, err)
+			}
+			*delay = Duration(d)
+		}
+		if err := policy.validate(); err != nil {
+			return nil, fmt.Errorf("retry %s: %w", operation, err)
+		}
+		overrides[operation] = policy
+	}
+	return overrides, nil
+}
+
+// RetryCount is the number of retries made of an operation and the number of
+// times it was given up on.
+type RetryCount struct {
+	Retries   uint64 `json:"retries"`
+	Exhausted uint64 `json:"exhausted"`
+}
+
+// retryPolicy returns the retry policy of operation. The caller must hold
+// s.mu.
+func (s *Simulator) retryPolicy(operation string) RetryPolicy {
+	if p, ok := s.cfg.RetryOverrides[operation]; ok {
+		return p.withDefaults(s.cfg.Retry)
+	}
+	return s.cfg.Retry
+}
+
+// retryOp runs op under the retry policy of operation, counting its retries.
+// Backoffs pass in simulation time, so they don't block: it returns how long
+// they added up to, for the caller to delay the operation's message by, and
+// whether op succeeded. The caller must hold s.mu for writing.
+func (s *Simulator) retryOp(ctx context.Context, operation string, op func() error) (time.Duration, bool) {
+	var waited time.Duration
+	wait := func(ctx context.Context, d time.Duration) error {
+		waited += d
+		return ctx.Err()
+	}
+	attempts, err := retry(ctx, s.retryPolicy(operation), s.rng, wait, func(int) error { return op() })
+	s.countRetries(operation, attempts, err)
+	return waited, err == nil
+}
+
+// countRetries counts the retries of an operation that took the given
+// attempts and ended with err. The caller must hold s.mu for writing.
+func (s *Simulator) countRetries(operation string, attempts int, err error) {
+	if s.retries == nil {
+		s.retries = make(map[string]RetryCount)
+	}
+	c := s.retries[operation]
+	if attempts > 1 {
+		c.Retries += uint64(attempts - 1)
+	}
+	if err != nil {
+		c.Exhausted++
+	}
+	s.retries[operation] = c
+}
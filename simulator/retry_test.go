@@ -0,0 +1,152 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRetry tests that an operation failing transiently is retried until it
+// succeeds, with backoffs under the exponential ceiling, and that one that
+// keeps failing is given up on after the maximum attempts.
+func TestRetry(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 4, BaseDelay: Duration(100 * time.Millisecond), MaxDelay: Duration(250 * time.Millisecond)}
+	rng := rand.New(rand.NewSource(1))
+	var waits []time.Duration
+	wait := func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+
+	transient := errors.New("transient")
+	attempts, err := retry(context.Background(), policy, rng, wait, func(attempt int) error {
+		if attempt < 3 {
+			return transient
+		}
+		return nil
+	})
+	if attempts != 3 || err != nil {
+		t.Fatalf("Expected success on the third attempt, got %d attempts and %v", attempts, err)
+	}
+	if len(waits) != 2 || waits[0] > 100*time.Millisecond || waits[1] > 200*time.Millisecond {
+		t.Errorf("Expected two backoffs of at most 100ms and 200ms, got %v", waits)
+	}
+
+	waits = nil
+	attempts, err = retry(context.Background(), policy, rng, wait, func(int) error { return transient })
+	if attempts != 4 || !errors.Is(err, transient) {
+		t.Errorf("Expected 4 attempts ending in the last error, got %d and %v", attempts, err)
+	}
+	for _, d := range waits {
+		if d < 0 || d > 250*time.Millisecond {
+			t.Errorf("Expected backoffs capped at 250ms, got %v", waits)
+		}
+	}
+}
+
+// TestRetryCancel tests that cancelling the context aborts a retry waiting
+// out its backoff.
+func TestRetryCancel(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: Duration(time.Hour), MaxDelay: Duration(time.Hour)}
+	sleep := func(ctx context.Context, d time.Duration) error {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return nil
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	start := time.Now()
+	attempts, err := retry(ctx, policy, rand.New(rand.NewSource(1)), sleep, func(int) error { return errMessageLost })
+	if attempts != 1 || !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected one attempt then cancellation, got %d and %v", attempts, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected cancellation to abort the backoff promptly, took %v", elapsed)
+	}
+
+	// A context already done stops retrying before the next attempt.
+	calls := 0
+	attempts, err = retry(ctx, policy, rand.New(rand.NewSource(1)), func(context.Context, time.Duration) error { return nil }, func(int) error {
+		calls++
+		return nil
+	})
+	if calls != 0 || attempts != 0 || !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected no attempts with a done context, got %d calls and %v", calls, err)
+	}
+}
+
+// TestOperationRetries tests that lost replication copies and unanswered
+// prepare calls are retried under their policies and counted in metrics.
+func TestOperationRetries(t *testing.T) {
+	s := New(Config{Seed: 1, N: 2, W: 1, Retry: RetryPolicy{MaxAttempts: 4}, RetryOverrides: map[string]RetryPolicy{RetryPrepare: {MaxAttempts: 2}}})
+	s.Init(2)
+	h := s.Handler()
+
+	if _, err := s.KVPut("k", "v"); err != nil {
+		t.Fatalf("KVPut failed: %v", err)
+	}
+	replicas := s.Locate("k")
+	source, target := replicas[0], replicas[1]
+	if _, ok := s.replicaData[target]["k"]; ok {
+		source, target = target, source
+	}
+	s.SetLinkLoss(source, target, 1)
+	if copied := s.ReplicationRound(); copied != 0 {
+		t.Fatalf("Expected the copy to be lost, got %d copies", copied)
+	}
+	if c := s.retries[RetryReplication]; c.Retries != 3 || c.Exhausted != 1 {
+		t.Errorf("Expected 3 retries of the lost copy before giving up, got %+v", c)
+	}
+
+	// A down participant is asked once more under the prepare override,
+	// then votes no.
+	s.Fail(1)
+	tx, err := s.RunTransaction([]TxWrite{{NodeID: 0, Value: 1}, {NodeID: 1, Value: 2}})
+	if err != nil || tx.Outcome != TxAborted {
+		t.Fatalf("Expected the transaction to abort, got %+v and %v", tx, err)
+	}
+	if c := s.retries[RetryPrepare]; c.Retries != 1 || c.Exhausted != 1 {
+		t.Errorf("Expected 1 retry of the unanswered prepare, got %+v", c)
+	}
+
+	body := doRequest(t, h, "GET", "/metrics", "").Body.String()
+	for _, want := range []string{
+		`sim_retries_total{operation="replication"} 3`,
+		`sim_retries_total{operation="prepare"} 1`,
+		`sim_retries_exhausted_total{operation="replication"} 1`,
+		`sim_retries_total{operation="hint"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q", want)
+		}
+	}
+}
+
+// TestParseRetryOverrides tests parsing retry policies by operation.
+func TestParseRetryOverrides(t *testing.T) {
+	base := RetryPolicy{MaxAttempts: 3, BaseDelay: Duration(100 * time.Millisecond), MaxDelay: Duration(time.Second)}
+	got, err := ParseRetryOverrides("replication=5:50ms:2s, prepare=1", base)
+	if err != nil {
+		t.Fatalf("ParseRetryOverrides failed: %v", err)
+	}
+	if want := (RetryPolicy{MaxAttempts: 5, BaseDelay: Duration(50 * time.Millisecond), MaxDelay: Duration(2 * time.Second)}); got[RetryReplication] != want {
+		t.Errorf("Expected replication policy %+v, got %+v", want, got[RetryReplication])
+	}
+	if want := (RetryPolicy{MaxAttempts: 1, BaseDelay: base.BaseDelay, MaxDelay: base.MaxDelay}); got[RetryPrepare] != want {
+		t.Errorf("Expected prepare policy %+v, got %+v", want, got[RetryPrepare])
+	}
+	for _, spec := range []string{"gossip=2", "hint=", "hint=0", "hint=2:1s:10ms", "hint=2:soon", "hint=1:1s:2s:3s"} {
+		if _, err := ParseRetryOverrides(spec, base); err == nil {
+			t.Errorf("ParseRetryOverrides(%q): expected an error", spec)
+		}
+	}
+}
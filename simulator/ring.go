@@ -0,0 +1,193 @@
+package simulator
+
+import (
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"sort"
+)
+
+// DefaultVirtualNodes is the number of virtual nodes per physical node used
+// when Config.VirtualNodes is unset.
+const DefaultVirtualNodes = 64
+
+// HashRing maps keys to node IDs using consistent hashing. Each physical node
+// is placed on the ring at several virtual-node tokens so keys spread evenly
+// and adding or removing a node only moves the keys adjacent to its tokens.
+// A HashRing is not safe for concurrent use.
+type HashRing struct {
+	vnodes int
+	tokens []ringToken // Sorted by hash.
+	ids    map[int]bool
+}
+
+// ringToken is one virtual node's position on the ring.
+type ringToken struct {
+	hash uint64
+	id   int
+}
+
+// TokenRange is a range of the ring (Start, End] owned by the node whose
+// virtual node sits at End. The first range of the ring wraps around zero,
+// so its Start is greater than its End.
+type TokenRange struct {
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+}
+
+// NewHashRing returns an empty ring that places vnodes virtual nodes per
+// physical node. A non-positive vnodes means DefaultVirtualNodes.
+func NewHashRing(vnodes int) *HashRing {
+	if vnodes <= 0 {
+		vnodes = DefaultVirtualNodes
+	}
+	return &HashRing{vnodes: vnodes, ids: make(map[int]bool)}
+}
+
+// VirtualNodes returns the number of virtual nodes per physical node.
+func (h *HashRing) VirtualNodes() int {
+	return h.vnodes
+}
+
+// Add places the nodes with the given IDs on the ring. Adding a node that is
+// already present has no effect, and a token another node was given by Split
+// stays with it.
+func (h *HashRing) Add(ids ...int) {
+	taken := make(map[uint64]bool, len(h.tokens))
+	for _, t := range h.tokens {
+		taken[t.hash] = true
+	}
+	for _, id := range ids {
+		if h.ids[id] {
+			continue
+		}
+		h.ids[id] = true
+		for v := 0; v < h.vnodes; v++ {
+			if hash := hashString(fmt.Sprintf("node-%d-vnode-%d", id, v)); !taken[hash] {
+				h.tokens = append(h.tokens, ringToken{hash: hash, id: id})
+			}
+		}
+	}
+	sort.Slice(h.tokens, func(i, j int) bool { return h.tokens[i].hash < h.tokens[j].hash })
+}
+
+// Split places a token of the node with the given ID at hash, so it takes
+// over the keys from the previous token up to and including hash. If a token
+// already sits at hash, the node is given that token's whole range instead.
+// It returns false if the node is not on the ring.
+func (h *HashRing) Split(hash uint64, id int) bool {
+	if !h.ids[id] {
+		return false
+	}
+	i := h.search(hash)
+	if i < len(h.tokens) && h.tokens[i].hash == hash {
+		h.tokens[i].id = id
+		return true
+	}
+	h.tokens = slices.Insert(h.tokens, i, ringToken{hash: hash, id: id})
+	return true
+}
+
+// clone returns a copy of h that shares no memory with it.
+func (h *HashRing) clone() *HashRing {
+	c := &HashRing{vnodes: h.vnodes, tokens: slices.Clone(h.tokens), ids: make(map[int]bool, len(h.ids))}
+	for id := range h.ids {
+		c.ids[id] = true
+	}
+	return c
+}
+
+// search returns the index of the first token at or after hash, which is
+// len(h.tokens) if hash is past the last token.
+func (h *HashRing) search(hash uint64) int {
+	return sort.Search(len(h.tokens), func(i int) bool { return h.tokens[i].hash >= hash })
+}
+
+// Remove takes the node with the given ID off the ring.
+func (h *HashRing) Remove(id int) {
+	if !h.ids[id] {
+		return
+	}
+	delete(h.ids, id)
+	kept := h.tokens[:0]
+	for _, t := range h.tokens {
+		if t.id != id {
+			kept = append(kept, t)
+		}
+	}
+	h.tokens = kept
+}
+
+// Len returns the number of physical nodes on the ring.
+func (h *HashRing) Len() int {
+	return len(h.ids)
+}
+
+// Locate returns the IDs of the n distinct nodes responsible for key, found
+// by walking the ring clockwise from the key's position. The first ID is the
+// key's primary owner. Fewer than n IDs are returned if the ring holds fewer
+// nodes.
+func (h *HashRing) Locate(key string, n int) []int {
+	if n > len(h.ids) {
+		n = len(h.ids)
+	}
+	if n <= 0 {
+		return nil
+	}
+
+	start := h.search(hashString(key))
+	ids := make([]int, 0, n)
+	seen := make(map[int]bool, n)
+	for i := 0; len(ids) < n; i++ {
+		t := h.tokens[(start+i)%len(h.tokens)]
+		if !seen[t.id] {
+			seen[t.id] = true
+			ids = append(ids, t.id)
+		}
+	}
+	return ids
+}
+
+// Ranges returns the token ranges each node owns as a primary.
+func (h *HashRing) Ranges() map[int][]TokenRange {
+	ranges := make(map[int][]TokenRange, len(h.ids))
+	for i, t := range h.tokens {
+		prev := h.tokens[(i+len(h.tokens)-1)%len(h.tokens)]
+		ranges[t.id] = append(ranges[t.id], TokenRange{Start: prev.hash, End: t.hash})
+	}
+	return ranges
+}
+
+// Ownership returns the fraction of the ring each node owns as a primary.
+func (h *HashRing) Ownership() map[int]float64 {
+	ownership := make(map[int]float64, len(h.ids))
+	for id, ranges := range h.Ranges() {
+		var owned float64
+		for _, r := range ranges {
+			// Unsigned subtraction handles the range that wraps around zero.
+			owned += float64(r.End - r.Start)
+		}
+		ownership[id] = owned / (1 << 64)
+	}
+	if len(h.tokens) == 1 {
+		// A single token's range wraps all the way around the ring.
+		ownership[h.tokens[0].id] = 1
+	}
+	return ownership
+}
+
+// hashString returns a well-mixed 64-bit hash of str. FNV-1a alone clusters
+// short strings that differ only in their last characters, such as
+// "key-1" and "key-2", so its result is passed through the MurmurHash3
+// 64-bit finalizer to spread them around the ring.
+func hashString(str string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(str))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,205 @@
+package simulator
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+// TestHashRingDistribution tests that keys spread evenly across nodes.
+func TestHashRingDistribution(t *testing.T) {
+	const nodes, keys = 10, 20000
+
+	ring := NewHashRing(128)
+	for id := 0; id < nodes; id++ {
+		ring.Add(id)
+	}
+
+	counts := make(map[int]int)
+	for k := 0; k < keys; k++ {
+		counts[ring.Locate(fmt.Sprintf("key-%d", k), 1)[0]]++
+	}
+
+	mean := float64(keys) / nodes
+	for id := 0; id < nodes; id++ {
+		if deviation := math.Abs(float64(counts[id])-mean) / mean; deviation > 0.25 {
+			t.Errorf("Node %d owns %d keys, %.0f%% away from the mean of %.0f", id, counts[id], deviation*100, mean)
+		}
+	}
+
+	var total float64
+	for _, fraction := range ring.Ownership() {
+		total += fraction
+	}
+	if math.Abs(total-1) > 1e-9 {
+		t.Errorf("Expected ownership to sum to 1, got %v", total)
+	}
+}
+
+// TestHashRingMinimalMovement tests that adding a node only moves keys to the
+// new node, and roughly its fair share of them.
+func TestHashRingMinimalMovement(t *testing.T) {
+	const nodes, keys = 10, 20000
+
+	ring := NewHashRing(128)
+	for id := 0; id < nodes; id++ {
+		ring.Add(id)
+	}
+	before := make([]int, keys)
+	for k := range before {
+		before[k] = ring.Locate(fmt.Sprintf("key-%d", k), 1)[0]
+	}
+
+	ring.Add(nodes)
+	moved := 0
+	for k := range before {
+		after := ring.Locate(fmt.Sprintf("key-%d", k), 1)[0]
+		if after == before[k] {
+			continue
+		}
+		moved++
+		if after != nodes {
+			t.Fatalf("Key %d moved from node %d to existing node %d", k, before[k], after)
+		}
+	}
+
+	// The new node should take about 1/(nodes+1) of the keys.
+	fair := float64(keys) / (nodes + 1)
+	if float64(moved) > 1.5*fair || float64(moved) < 0.5*fair {
+		t.Errorf("Expected about %.0f keys to move, but %d moved", fair, moved)
+	}
+
+	// Removing the node again restores the original placement.
+	ring.Remove(nodes)
+	for k := range before {
+		if got := ring.Locate(fmt.Sprintf("key-%d", k), 1)[0]; got != before[k] {
+			t.Fatalf("Key %d is on node %d after removal, expected %d", k, got, before[k])
+		}
+	}
+}
+
+// TestHashRingLocate tests that Locate returns distinct nodes, capped at the
+// ring size.
+func TestHashRingLocate(t *testing.T) {
+	ring := NewHashRing(8)
+	if ids := ring.Locate("key", 3); len(ids) != 0 {
+		t.Errorf("Expected no nodes on an empty ring, got %v", ids)
+	}
+
+	ring.Add(0, 1, 2)
+	ids := ring.Locate("key", 5)
+	if len(ids) != 3 {
+		t.Fatalf("Expected 3 nodes, got %v", ids)
+	}
+	seen := make(map[int]bool)
+	for _, id := range ids {
+		if seen[id] {
+			t.Errorf("Node %d appears twice in %v", id, ids)
+		}
+		seen[id] = true
+	}
+}
+
+// TestRingEndpoints tests GET /ring and GET /ring/locate.
+func TestRingEndpoints(t *testing.T) {
+	s := New(Config{N: 3, VirtualNodes: 16})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	var info RingInfo
+	decodeBody(t, doRequest(t, h, "GET", "/ring", ""), &info)
+	if info.VirtualNodes != 16 || len(info.Nodes) != testNodeCount {
+		t.Fatalf("Unexpected ring info: %+v", info)
+	}
+	for _, node := range info.Nodes {
+		if len(node.Ranges) != 16 || node.Ownership <= 0 {
+			t.Errorf("Node %d: expected 16 ranges and positive ownership, got %d ranges and %v", node.ID, len(node.Ranges), node.Ownership)
+		}
+	}
+
+	var located struct {
+		Key     string `json:"key"`
+		Nodes   []int  `json:"nodes"`
+		Primary int    `json:"primary"`
+	}
+	decodeBody(t, doRequest(t, h, "GET", "/ring/locate?key=foo", ""), &located)
+	if located.Key != "foo" || len(located.Nodes) != 3 || located.Primary != located.Nodes[0] {
+		t.Errorf("Unexpected locate response: %+v", located)
+	}
+	if want := s.Locate("foo"); fmt.Sprint(want) != fmt.Sprint(located.Nodes) {
+		t.Errorf("Expected nodes %v, got %v", want, located.Nodes)
+	}
+
+	if rr := doRequest(t, h, "GET", "/ring/locate", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d without a key, but got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+// TestRingRebalance tests that adding and force-removing nodes through the
+// API rebalances the ring, reports the keys moved, and keeps every key
+// readable.
+func TestRingRebalance(t *testing.T) {
+	const keys = 200
+
+	s := New(Config{Seed: 1, N: 3, R: 2, W: 2})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	for k := 0; k < keys; k++ {
+		if _, err := s.KVPut(fmt.Sprintf("key-%d", k), strconv.Itoa(k)); err != nil {
+			t.Fatalf("KVPut failed: %v", err)
+		}
+	}
+
+	checkKeys := func(when string) {
+		t.Helper()
+		for k := 0; k < keys; k++ {
+			result, err := s.KVGet(fmt.Sprintf("key-%d", k))
+			if err != nil || result.Value != strconv.Itoa(k) {
+				t.Fatalf("%s: key-%d read %+v, %v", when, k, result, err)
+			}
+		}
+	}
+
+	movedHeader := func(rr interface{ Header() http.Header }) int {
+		t.Helper()
+		moved, err := strconv.Atoi(rr.Header().Get("X-Keys-Moved"))
+		if err != nil {
+			t.Fatalf("Invalid X-Keys-Moved header: %v", err)
+		}
+		return moved
+	}
+
+	var node NodeData
+	decodeBody(t, doRequest(t, h, "POST", "/nodes", `{"name":"Node-new","value":1}`), &node)
+	for node.Membership == MemberJoining {
+		s.TransferRound()
+		node, _ = s.Node(node.ID)
+	}
+	checkKeys("after addition")
+
+	var info RingInfo
+	decodeBody(t, doRequest(t, h, "GET", "/ring", ""), &info)
+	if info.LastRebalance == nil || info.LastRebalance.KeysMoved == 0 || info.LastRebalance.KeysMoved == keys {
+		t.Errorf("Expected some but not all keys to move on addition, got %+v", info.LastRebalance)
+	}
+
+	rr := doRequest(t, h, "DELETE", "/nodes/0?force=true", "")
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusNoContent, rr.Code)
+	}
+	if removed := movedHeader(rr); removed == 0 {
+		t.Error("Expected keys to move when a node is removed")
+	}
+	checkKeys("after removal")
+
+	// No replica data is left behind on the removed node.
+	s.mu.RLock()
+	_, ok := s.replicaData[0]
+	s.mu.RUnlock()
+	if ok {
+		t.Error("Removed node still holds replica data")
+	}
+}
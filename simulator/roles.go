@@ -0,0 +1,237 @@
+package simulator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Node roles.
+const (
+	// RolePrimary nodes accept client writes in the replicated modes.
+	RolePrimary = "primary"
+
+	// RoleReplica nodes serve reads and are promoted to primary when every
+	// primary is down.
+	RoleReplica = "replica"
+
+	// RoleWitness nodes vote in elections and count towards Raft majorities
+	// but store no data: they are left off the consistent-hash ring, take no
+	// part in gossip, and never lead. They keep the Raft log, which their
+	// votes depend on.
+	RoleWitness = "witness"
+)
+
+// Errors returned by SetRole and acceptsWrites.
+var (
+	// ErrInvalidRole means a role other than RolePrimary, RoleReplica, or
+	// RoleWitness was given.
+	ErrInvalidRole = errors.New("invalid role")
+
+	// ErrLastPrimary means a role change would leave no primary up.
+	ErrLastPrimary = errors.New("simulator: last primary up")
+
+	// ErrNotPrimary means a client write went to a node other than a
+	// primary in a replicated mode.
+	ErrNotPrimary = errors.New("simulator: node is not a primary")
+
+	// ErrWitness means a data store write went to a witness.
+	ErrWitness = errors.New("simulator: witnesses store no data")
+)
+
+// validRole returns an error wrapping ErrInvalidRole unless role is one of
+// the node roles.
+func validRole(role string) error {
+	switch role {
+	case RolePrimary, RoleReplica, RoleWitness:
+		return nil
+	}
+	return fmt.Errorf("%w %q, expected primary, replica, or witness", ErrInvalidRole, role)
+}
+
+// replicated reports whether nodes replicate each other's values, so that
+// only primaries accept client writes: in gossip and raft mode.
+func (s *Simulator) replicated() bool {
+	mode := s.Mode()
+	return mode == ModeGossip || mode == ModeRaft
+}
+
+// primaryUp returns the index of the first primary that is up, or -1 if none
+// is. The caller must hold s.mu.
+func (s *Simulator) primaryUp() int {
+	for i := range s.nodes {
+		if s.nodes[i].Role == RolePrimary && s.nodes[i].Status == StatusUp {
+			return i
+		}
+	}
+	return -1
+}
+
+// failOver makes the elected leader at index leader the primary if no
+// primary is up, demoting the primaries that are down to replicas. It does
+// nothing if no leader was elected. Like leadership, a role changed here
+// leaves the node's version alone, but the change is announced so that
+// recordings replay it. The caller must hold s.mu for writing.
+func (s *Simulator) failOver(leader int) {
+	if leader < 0 || s.primaryUp() >= 0 {
+		return
+	}
+	for i := range s.nodes {
+		if s.nodes[i].Role == RolePrimary {
+			s.nodes[i].Role = RoleReplica
+			s.announce(EventNodeUpdated, i)
+		}
+	}
+	s.nodes[leader].Role = RolePrimary
+	s.announce(EventNodeUpdated, leader)
+	s.logger.Info("primary promoted", "node_id", s.nodes[leader].ID)
+}
+
+// SetRole changes the role of the node with the given ID. A node becoming a
+// witness leaves the consistent-hash ring, handing its keys to other
+// replicas, and drops its data store; a witness taking another role rejoins
+// the ring. It returns the updated node and the number of keys moved. It
+// returns ErrNodeNotFound if no such node exists, an error wrapping
+// ErrInvalidRole if role is unknown, ErrMembershipChange if the node is
+// joining or leaving, and ErrLastPrimary if the node is the only primary up
+// and role is not RolePrimary.
+func (s *Simulator) SetRole(id int, role string) (NodeData, int, error) {
+	if err := validRole(role); err != nil {
+		return NodeData{}, 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := s.findNode(id)
+	if index < 0 {
+		return NodeData{}, 0, ErrNodeNotFound
+	}
+	node := &s.nodes[index]
+	previous := node.Role
+	if previous == role {
+		return node.clone(), 0, nil
+	}
+	if node.Membership != MemberActive {
+		return NodeData{}, 0, ErrMembershipChange
+	}
+	if previous == RolePrimary && node.Status == StatusUp && role != RolePrimary {
+		others := 0
+		for i := range s.nodes {
+			if i != index && s.nodes[i].Role == RolePrimary && s.nodes[i].Status == StatusUp {
+				others++
+			}
+		}
+		if others == 0 {
+			return NodeData{}, 0, ErrLastPrimary
+		}
+	}
+
+	node.Role = role
+	moved := 0
+	switch {
+	case role == RoleWitness:
+		moved = s.changeMembership(fmt.Sprintf("node %d became a witness", id), func(ring *HashRing) {
+			ring.Remove(id)
+		})
+		delete(s.store, id)
+	case previous == RoleWitness:
+		moved = s.changeMembership(fmt.Sprintf("node %d became a %s", id, role), func(ring *HashRing) {
+			ring.Add(id)
+		})
+	}
+	s.electLeader()
+	s.publish(EventNodeUpdated, index)
+	s.logger.Info("node role changed", "node_id", id, "from", previous, "to", role, "keys_moved", moved)
+	return s.nodes[index].clone(), moved, nil
+}
+
+// acceptsWrites returns nil if the node with the given ID accepts client
+// writes, to its data store if data is set: any node but a witness's data
+// store outside the replicated modes, and only primaries in them. Otherwise
+// it returns ErrWitness or ErrNotPrimary, along with the ID of a primary that
+// is up to send the write to instead, or -1 if none is up. A node that
+// doesn't exist accepts writes, which fail on their own.
+func (s *Simulator) acceptsWrites(id int, data bool) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	index := s.findNode(id)
+	if index < 0 {
+		return -1, nil
+	}
+	primary := -1
+	if i := s.primaryUp(); i >= 0 {
+		primary = s.nodes[i].ID
+	}
+	switch role := s.nodes[index].Role; {
+	case s.replicated() && role != RolePrimary:
+		return primary, ErrNotPrimary
+	case data && role == RoleWitness:
+		return primary, ErrWitness
+	}
+	return -1, nil
+}
+
+// checkWritable answers a client write to the node with the given ID that
+// it doesn't accept: with a 307 redirect to the same path on a primary that
+// is up, or 403 if none is or the node is a witness outside the replicated
+// modes. It reports whether the write may go ahead.
+func (s *Simulator) checkWritable(w http.ResponseWriter, r *http.Request, id int, data bool) bool {
+	primary, err := s.acceptsWrites(id, data)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, ErrNotPrimary) && primary >= 0:
+		location := *r.URL
+		location.Path = "/nodes/" + strconv.Itoa(primary) + strings.TrimPrefix(r.URL.Path, "/nodes/"+r.PathValue("id"))
+		w.Header().Set("Location", location.RequestURI())
+		writeError(w, http.StatusTemporaryRedirect, fmt.Sprintf("Node %d is not a primary; write to node %d", id, primary))
+	case errors.Is(err, ErrNotPrimary):
+		writeError(w, http.StatusForbidden, fmt.Sprintf("Node %d is not a primary, and no primary is up", id))
+	default:
+		writeError(w, http.StatusForbidden, fmt.Sprintf("Node %d is a witness and stores no data", id))
+	}
+	return false
+}
+
+// roleRequest is the JSON body accepted by patchNodeRole.
+type roleRequest struct {
+	Role string `json:"role"`
+}
+
+// patchNodeRole handles HTTP requests to change a node's role from a body
+// like {"role":"witness"}.
+func (s *Simulator) patchNodeRole(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseNodeID(w, r)
+	if !ok {
+		return
+	}
+
+	var payload roleRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "Malformed JSON body")
+		return
+	}
+
+	node, moved, err := s.SetRole(id, payload.Role)
+	switch {
+	case errors.Is(err, ErrNodeNotFound):
+		writeError(w, http.StatusNotFound, "Node not found")
+	case errors.Is(err, ErrLastPrimary):
+		writeError(w, http.StatusConflict, "The node is the only primary up; promote another node first")
+	case errors.Is(err, ErrMembershipChange):
+		writeError(w, http.StatusConflict, "The node is joining or leaving; wait for it to finish")
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		w.Header().Set("X-Keys-Moved", strconv.Itoa(moved))
+		w.Header().Set("ETag", nodeETag(node))
+		writeJSON(w, http.StatusOK, node)
+	}
+}
@@ -0,0 +1,85 @@
+package simulator
+
+import (
+	"net/http"
+	"testing"
+)
+
+// TestRoles tests that only the primary accepts writes in gossip mode, that
+// writes to a replica are redirected to it, and that a replica is promoted
+// once it goes down.
+func TestRoles(t *testing.T) {
+	s := New(Config{Seed: 1, Mode: ModeGossip, Witnesses: 1})
+	s.Init(3)
+	h := s.Handler()
+
+	var page NodePage
+	decodeBody(t, doRequest(t, h, "GET", "/nodes?role=primary", ""), &page)
+	if page.Total != 1 || page.Nodes[0].ID != 0 {
+		t.Fatalf("Expected node 0 to be the only primary, got %+v", page)
+	}
+	if node, _ := s.Node(2); node.Role != RoleWitness {
+		t.Errorf("Expected node 2 to be a witness, got %q", node.Role)
+	}
+
+	rr := doRequest(t, h, "PUT", "/nodes/1?trace=1", `{"name":"n","value":5}`)
+	expectCode(t, rr, http.StatusTemporaryRedirect)
+	if got := rr.Header().Get("Location"); got != "/nodes/0?trace=1" {
+		t.Errorf("Expected a redirect to /nodes/0?trace=1, got %q", got)
+	}
+	expectCode(t, doRequest(t, h, "PUT", "/nodes/0", `{"name":"n","value":5}`), http.StatusOK)
+	rr = doRequest(t, h, "PUT", "/nodes/1/data/k", `{"value":"v"}`)
+	expectCode(t, rr, http.StatusTemporaryRedirect)
+	if got := rr.Header().Get("Location"); got != "/nodes/0/data/k" {
+		t.Errorf("Expected a redirect to /nodes/0/data/k, got %q", got)
+	}
+
+	// The witness never leads, so node 1 takes over.
+	s.Fail(0)
+	if node, _ := s.Node(1); node.Role != RolePrimary || !node.Leader {
+		t.Fatalf("Expected node 1 to be promoted, got %+v", node)
+	}
+	expectCode(t, doRequest(t, h, "PUT", "/nodes/1", `{"name":"n","value":6}`), http.StatusOK)
+	s.Recover(0)
+	if node, _ := s.Node(0); node.Role != RoleReplica {
+		t.Errorf("Expected the recovered node 0 to stay a replica, got %q", node.Role)
+	}
+
+	s.Fail(0)
+	s.Fail(1)
+	expectCode(t, doRequest(t, h, "PUT", "/nodes/2", `{"name":"n","value":7}`), http.StatusForbidden)
+}
+
+// TestSetRole tests changing roles over HTTP, and that a witness holds no
+// replicated keys.
+func TestSetRole(t *testing.T) {
+	s := New(Config{Seed: 1, N: 2, W: 1})
+	s.Init(3)
+	h := s.Handler()
+
+	expectCode(t, doRequest(t, h, "PATCH", "/nodes/0/role", `{"role":"replica"}`), http.StatusConflict)
+	expectCode(t, doRequest(t, h, "PATCH", "/nodes/0/role", `{"role":"leader"}`), http.StatusBadRequest)
+	expectCode(t, doRequest(t, h, "PATCH", "/nodes/9/role", `{"role":"replica"}`), http.StatusNotFound)
+
+	var node NodeData
+	decodeBody(t, doRequest(t, h, "PATCH", "/nodes/2/role", `{"role":"witness"}`), &node)
+	if node.Role != RoleWitness {
+		t.Fatalf("Expected node 2 to become a witness, got %+v", node)
+	}
+	expectCode(t, doRequest(t, h, "PUT", "/nodes/2/data/k", `{"value":"v"}`), http.StatusForbidden)
+	for i := 0; i < 20; i++ {
+		if _, err := s.KVPut(string(rune('a'+i)), "v"); err != nil {
+			t.Fatalf("KVPut failed: %v", err)
+		}
+	}
+	s.ReplicationRound()
+	if keys := len(s.replicaData[2]); keys != 0 {
+		t.Errorf("Expected the witness to hold no keys, got %d", keys)
+	}
+
+	expectCode(t, doRequest(t, h, "PATCH", "/nodes/1/role", `{"role":"primary"}`), http.StatusOK)
+	expectCode(t, doRequest(t, h, "PATCH", "/nodes/0/role", `{"role":"replica"}`), http.StatusOK)
+	if node, _ := s.Node(1); node.Role != RolePrimary {
+		t.Errorf("Expected node 1 to be the primary, got %q", node.Role)
+	}
+}
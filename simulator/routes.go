@@ -0,0 +1,175 @@
+package simulator
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Media types of responses that are not plain JSON documents.
+const (
+	mediaNDJSON = "application/x-ndjson"
+	mediaSSE    = "text/event-stream"
+	mediaText   = "text/plain"
+	mediaHTML   = "text/html"
+)
+
+// route is one endpoint of the HTTP API. The same table mounts the handlers
+// and generates the OpenAPI document, so the two cannot drift apart.
+type route struct {
+	method  string
+	path    string // ServeMux path pattern, such as "/nodes/{id}".
+	handler http.HandlerFunc
+	summary string
+
+	request  interface{} // Zero value of the JSON request body, or nil for none.
+	response interface{} // Zero value of the success response body, or nil for none.
+	status   int         // Success status, or 0 for 200.
+	media    string      // Media type of the response, or "" for application/json.
+}
+
+// pattern returns the ServeMux pattern of rt.
+func (rt route) pattern() string {
+	return rt.method + " " + rt.path
+}
+
+// apiPath returns the path of rt in OpenAPI form, without the ServeMux
+// markers {$} and {name...}.
+func (rt route) apiPath() string {
+	return strings.NewReplacer("{$}", "", "...}", "}").Replace(rt.path)
+}
+
+// apiRoutes returns every endpoint of the HTTP API, in the order they are
+// documented.
+func (s *Simulator) apiRoutes() []route {
+	return []route{
+		{method: "GET", path: "/{$}", handler: s.rootHandler, summary: "Welcome message", response: map[string]string{}},
+		{method: "GET", path: "/nodes", handler: s.getNodeData, summary: "List the nodes, optionally filtered, sorted, and paged", response: []NodeData{}},
+		{method: "POST", path: "/nodes", handler: s.createNode, summary: "Add a node, joining it once its keys are transferred", request: nodeUpdateRequest{}, response: NodeData{}, status: http.StatusCreated},
+		{method: "POST", path: "/nodes/batch", handler: s.batchUpdate, summary: "Update many nodes at once", request: batchRequest{}, response: BatchResult{}},
+		{method: "GET", path: "/nodes/export", handler: s.exportNodes, summary: "Export every node as NDJSON", response: NodeData{}, media: mediaNDJSON},
+		{method: "GET", path: "/nodes/{id}", handler: s.getSingleNode, summary: "Get a node", response: NodeData{}},
+		{method: "PUT", path: "/nodes/{id}", handler: s.putNode, summary: "Update a node", request: nodeUpdateRequest{}, response: NodeData{}},
+		{method: "DELETE", path: "/nodes/{id}", handler: s.deleteNode, summary: "Remove a node, handing its keys off first", status: http.StatusNoContent},
+		{method: "GET", path: "/rebalance/plan", handler: s.getRebalancePlan, summary: "Plan the moves that would even out the keys each node owns", response: RebalancePlan{}},
+		{method: "POST", path: "/rebalance/execute", handler: s.executeRebalance, summary: "Start executing a rebalance plan", response: RebalanceStatus{}, status: http.StatusAccepted},
+		{method: "GET", path: "/rebalance/status", handler: s.getRebalanceStatus, summary: "Get the progress of the latest rebalance", response: RebalanceStatus{}},
+		{method: "GET", path: "/nodes/watch", handler: s.watchEvents, summary: "Wait for events after a sequence number", response: EventPage{}},
+		{method: "GET", path: "/nodes/{id}/watch", handler: s.watchNode, summary: "Wait for a node's version to exceed a given one", response: NodeData{}},
+		{method: "GET", path: "/nodes/{id}/join-status", handler: s.getJoinStatus, summary: "Get the progress of a node's join or leave", response: TransferStatus{}},
+		{method: "POST", path: "/nodes/{id}/fail", handler: s.failNode, summary: "Mark a node down", response: NodeData{}},
+		{method: "POST", path: "/nodes/{id}/recover", handler: s.recoverNode, summary: "Mark a node up", response: NodeData{}},
+		{method: "POST", path: "/nodes/{id}/latency", handler: s.setNodeLatency, summary: "Set a node's simulated latency", request: latencyRequest{}, response: NodeData{}},
+		{method: "POST", path: "/nodes/{id}/skew", handler: s.setNodeSkew, summary: "Set a node's clock skew", request: skewRequest{}, response: NodeData{}},
+		{method: "POST", path: "/nodes/{id}/byzantine", handler: s.toggleByzantine, summary: "Make a node byzantine, or honest again", response: NodeData{}},
+		{method: "POST", path: "/nodes/{id}/corrupt", handler: s.corruptNode, summary: "Flip a bit in a node's stored data", response: Corruption{}},
+		{method: "POST", path: "/nodes/{id}/restart", handler: s.restartNode, summary: "Restart a node, reloading its state once it is back up", response: Restart{}, status: http.StatusAccepted},
+		{method: "POST", path: "/cluster/rolling-restart", handler: s.rollingRestart, summary: "Restart every node in turn, waiting for each to become healthy", response: RollingRestart{}},
+		{method: "GET", path: "/integrity", handler: s.getIntegrity, summary: "Verify every node's data against its checksums", response: IntegrityReport{}},
+		{method: "PATCH", path: "/nodes/{id}/role", handler: s.patchNodeRole, summary: "Change a node's role", request: roleRequest{}, response: NodeData{}},
+		{method: "PATCH", path: "/nodes/{id}/metadata", handler: s.patchNodeMetadata, summary: "Change a node's region, zone, and tags", request: MetadataPatch{}, response: NodeData{}},
+		{method: "GET", path: "/nodes/{id}/history", handler: s.getNodeHistory, summary: "Get a node's recent values", response: ValueHistory{}},
+		{method: "GET", path: "/nodes/{id}/inbox", handler: s.getInbox, summary: "Get the messages recently delivered to a node", response: NodeInbox{}},
+		{method: "GET", path: "/nodes/{id}/clock", handler: s.getNodeClock, summary: "Get a node's vector clock", response: nodeClockResponse{}},
+		{method: "GET", path: "/nodes/{id}/data", handler: s.listDataKeys, summary: "List the keys in a node's data store", response: DataKeys{}},
+		{method: "GET", path: "/nodes/{id}/data/{key}", handler: s.getDataKey, summary: "Get a key from a node's data store", response: DataEntry{}},
+		{method: "PUT", path: "/nodes/{id}/data/{key}", handler: s.putDataKey, summary: "Set a key in a node's data store", request: dataRequest{}, response: DataEntry{}},
+		{method: "DELETE", path: "/nodes/{id}/data/{key}", handler: s.deleteDataKey, summary: "Delete a key from a node's data store", status: http.StatusNoContent},
+		{method: "GET", path: "/causality", handler: s.getCausality, summary: "Compare two nodes' clocks", response: causalityResponse{}},
+		{method: "GET", path: "/partitions", handler: s.getPartitions, summary: "Get the partition layout", response: partitionLayout{}},
+		{method: "POST", path: "/partitions", handler: s.createPartitions, summary: "Partition the cluster", request: partitionLayout{}, response: partitionLayout{}},
+		{method: "DELETE", path: "/partitions", handler: s.deletePartitions, summary: "Heal every partition", status: http.StatusNoContent},
+		{method: "GET", path: "/links", handler: s.getLinks, summary: "Get the message loss matrix", response: LinkInfo{}},
+		{method: "POST", path: "/links/{a}/{b}", handler: s.setLinkLoss, summary: "Set the loss rate of a link", request: linkRequest{}, response: LinkInfo{}},
+		{method: "GET", path: "/latency-matrix", handler: s.getLatencyMatrix, summary: "Get the latency of messages between nodes", response: LatencyMatrix{}},
+		{method: "PUT", path: "/latency-matrix", handler: s.putLatencyMatrix, summary: "Replace the latency model of messages between nodes", request: LatencyModel{}, response: LatencyMatrix{}},
+		{method: "GET", path: "/traffic", handler: s.getTraffic, summary: "Get the messages and bytes sent between nodes", response: TrafficInfo{}},
+		{method: "PUT", path: "/traffic/bandwidth", handler: s.putBandwidth, summary: "Set the bandwidth limit of every link", request: Bandwidth{}, response: TrafficInfo{}},
+		{method: "GET", path: "/queue/stats", handler: s.getQueueStats, summary: "Get the state of the work queue", response: QueueStats{}},
+		{method: "PATCH", path: "/queue/config", handler: s.patchQueueConfig, summary: "Change the producers, consumers, and rates of the work queue", request: QueueConfig{}, response: QueueStats{}},
+		{method: "POST", path: "/loadgen/start", handler: s.startLoadGen, summary: "Start sending synthetic requests to the nodes", request: LoadGenSettings{}, response: LoadGenStats{}},
+		{method: "POST", path: "/loadgen/stop", handler: s.stopLoadGen, summary: "Stop sending synthetic requests", response: LoadGenStats{}},
+		{method: "GET", path: "/loadgen/stats", handler: s.getLoadGenStats, summary: "Get how the synthetic requests were spread over the nodes", response: LoadGenStats{}},
+		{method: "GET", path: "/loadgen/breakers", handler: s.getBreakers, summary: "Get the load generator's circuit breaker for each node", response: []Breaker{}},
+		{method: "GET", path: "/autoscaler", handler: s.getAutoscaler, summary: "Get the autoscaler's settings, cooldown, and decisions", response: AutoscalerStatus{}},
+		{method: "PATCH", path: "/autoscaler", handler: s.patchAutoscaler, summary: "Enable, disable, or tune the autoscaler", request: AutoscalerSettings{}, response: AutoscalerStatus{}},
+		{method: "GET", path: "/topics", handler: s.getTopics, summary: "List the topics of the message bus", response: []TopicInfo{}},
+		{method: "PUT", path: "/topics/{name}/subscribers/{id}", handler: s.subscribe, summary: "Subscribe a node to a topic", response: TopicInfo{}},
+		{method: "DELETE", path: "/topics/{name}/subscribers/{id}", handler: s.unsubscribe, summary: "Unsubscribe a node from a topic", response: TopicInfo{}},
+		{method: "POST", path: "/topics/{name}/publish", handler: s.publishMessage, summary: "Publish a message to a topic", request: publishRequest{}, response: PublishResult{}, status: http.StatusAccepted},
+		{method: "GET", path: "/kv/{key}", handler: s.getKV, summary: "Read a key from a read quorum", response: KVResult{}},
+		{method: "PUT", path: "/kv/{key}", handler: s.putKV, summary: "Write a key to a write quorum", request: kvWriteRequest{}, response: KVResult{}},
+		{method: "DELETE", path: "/kv/{key}", handler: s.deleteKV, summary: "Delete a key from a write quorum", response: KVResult{}},
+		{method: "GET", path: "/locks", handler: s.getLocks, summary: "List the current lock leases", response: []Lease{}},
+		{method: "POST", path: "/locks/{name}/acquire", handler: s.acquireLock, summary: "Lease a lock to an owner", response: Lease{}},
+		{method: "POST", path: "/locks/{name}/release", handler: s.releaseLock, summary: "Release an owner's lease on a lock", status: http.StatusNoContent},
+		{method: "GET", path: "/splitbrain", handler: s.getSplitBrain, summary: "Show the current leaders and fenced stale writes", response: SplitBrainStatus{}},
+		{method: "GET", path: "/kv/{key}/replicas", handler: s.getKVReplicas, summary: "Show where a key's copies live", response: KVReplicas{}},
+		{method: "GET", path: "/hints", handler: s.getHints, summary: "List hints held for down replicas", response: HintInfo{}},
+		{method: "GET", path: "/antientropy/stats", handler: s.getAntiEntropyStats, summary: "Get anti-entropy totals", response: AntiEntropyStats{}},
+		{method: "POST", path: "/crdt/counter/{name}/increment", handler: s.incrementCounter, summary: "Increment a counter CRDT on a node", response: CounterState{}},
+		{method: "GET", path: "/crdt/counter/{name}", handler: s.getCounter, summary: "Get a counter CRDT", response: CounterState{}},
+		{method: "PUT", path: "/crdt/register/{name}", handler: s.putRegister, summary: "Write a register CRDT on a node", request: registerRequest{}, response: RegisterState{}},
+		{method: "GET", path: "/crdt/register/{name}", handler: s.getRegister, summary: "Get a register CRDT", response: RegisterState{}},
+		{method: "GET", path: "/ring", handler: s.getRing, summary: "Get the consistent-hash ring", response: RingInfo{}},
+		{method: "GET", path: "/ring/locate", handler: s.getRingLocate, summary: "Find the replicas of a key", response: ringLocateResponse{}},
+		{method: "GET", path: "/log", handler: s.getLog, summary: "Get the committed Raft log", response: RaftLog{}},
+		{method: "POST", path: "/log", handler: s.appendLog, summary: "Append a command to the Raft log", request: logAppendRequest{}, response: LogEntry{}, status: http.StatusCreated},
+		{method: "GET", path: "/nodes/{id}/log", handler: s.getNodeLog, summary: "Get a node's local Raft log", response: NodeLog{}},
+		{method: "POST", path: "/transactions", handler: s.createTransaction, summary: "Run a two-phase commit", request: transactionRequest{}, response: Transaction{}, status: http.StatusCreated},
+		{method: "GET", path: "/transactions/{id}", handler: s.getTransaction, summary: "Get a transaction", response: Transaction{}},
+		{method: "POST", path: "/sagas", handler: s.createSaga, summary: "Run a saga of compensable node writes", request: sagaRequest{}, response: Saga{}, status: http.StatusCreated},
+		{method: "GET", path: "/sagas/{id}", handler: s.getSaga, summary: "Get a saga", response: Saga{}},
+		{method: "GET", path: "/detector", handler: s.getDetector, summary: "Get the failure detector state", response: DetectorInfo{}},
+		{method: "POST", path: "/nodes/{id}/heartbeats/pause", handler: s.pauseHeartbeats, summary: "Drop a node's heartbeats", status: http.StatusNoContent},
+		{method: "POST", path: "/nodes/{id}/heartbeats/resume", handler: s.resumeHeartbeats, summary: "Restore a node's heartbeats", status: http.StatusNoContent},
+		{method: "GET", path: "/config", handler: s.getConfig, summary: "Get the effective configuration", response: map[string]Setting{}},
+		{method: "PATCH", path: "/config", handler: s.patchConfig, summary: "Change the settings tunable at runtime", request: Tunables{}, response: map[string]Setting{}},
+		{method: "POST", path: "/config/reload", handler: s.reloadConfig, summary: "Reload the configuration, applying the settings tunable at runtime", response: ReloadResult{}},
+		{method: "GET", path: "/audit", handler: s.getAudit, summary: "List the recent mutating requests", response: []AuditEntry{}},
+		{method: "GET", path: "/traces", handler: s.getTraces, summary: "List the recent request traces", response: []TraceSummary{}},
+		{method: "GET", path: "/traces/{request_id}", handler: s.getTrace, summary: "Get the span tree of a request", response: RequestTrace{}},
+		{method: "POST", path: "/webhooks", handler: s.createWebhook, summary: "Register a URL to be notified of events", request: webhookRequest{}, response: Webhook{}, status: http.StatusCreated},
+		{method: "GET", path: "/webhooks", handler: s.getWebhooks, summary: "List the registered webhooks", response: []Webhook{}},
+		{method: "DELETE", path: "/webhooks/{id}", handler: s.deleteWebhook, summary: "Stop notifying a webhook", status: http.StatusNoContent},
+		{method: "GET", path: "/ws", handler: s.serveWS, summary: "Stream node changes over a WebSocket", status: http.StatusSwitchingProtocols},
+		{method: "GET", path: "/events", handler: s.streamEvents, summary: "Stream node changes as Server-Sent Events", response: Event{}, media: mediaSSE},
+		{method: "GET", path: "/events/export", handler: s.exportEvents, summary: "Export the event log as NDJSON", response: Event{}, media: mediaNDJSON},
+		{method: "GET", path: "/events/history", handler: s.getEventHistory, summary: "Page through the event log", response: EventPage{}},
+		{method: "POST", path: "/replay", handler: s.replayEvents, summary: "Rebuild the nodes from the event log", response: ReplayResult{}},
+		{method: "POST", path: "/export", handler: s.exportResults, summary: "Write the nodes, event log, and tick samples to CSV files", response: ResultsInfo{}, status: http.StatusCreated},
+		{method: "POST", path: "/snapshot", handler: s.saveSnapshot, summary: "Save the nodes to disk", response: SnapshotInfo{}, status: http.StatusCreated},
+		{method: "POST", path: "/restore", handler: s.restoreSnapshot, summary: "Restore the nodes from disk", response: SnapshotInfo{}},
+		{method: "GET", path: "/leader", handler: s.getLeader, summary: "Get the current leader", response: NodeData{}},
+		{method: "GET", path: "/convergence", handler: s.getConvergence, summary: "Get gossip convergence", response: Convergence{}},
+		{method: "GET", path: "/clock", handler: s.getClock, summary: "Get the simulation clock", response: ClockState{}},
+		{method: "POST", path: "/clock/pause", handler: s.pauseClock, summary: "Pause the simulation clock", response: ClockState{}},
+		{method: "POST", path: "/clock/resume", handler: s.resumeClock, summary: "Resume the simulation clock", response: ClockState{}},
+		{method: "POST", path: "/clock/speed", handler: s.setClockSpeed, summary: "Change the speed of the simulation clock", request: speedRequest{}, response: ClockState{}},
+		{method: "POST", path: "/clock/step", handler: s.stepClock, summary: "Advance the paused simulation clock by one tick", response: ClockState{}},
+		{method: "POST", path: "/recording/start", handler: s.startRecording, summary: "Start recording a trace", response: RecordingStatus{}},
+		{method: "POST", path: "/recording/stop", handler: s.stopRecording, summary: "Stop recording the trace", response: RecordingStatus{}},
+		{method: "GET", path: "/recording/export", handler: s.exportRecording, summary: "Download the recorded trace", response: Trace{}},
+		{method: "GET", path: "/scenario", handler: s.getScenario, summary: "Get the progress through the loaded scenario", response: ScenarioStatus{}},
+		{method: "GET", path: "/clusters", handler: s.getClusters, summary: "List the clusters", response: []ClusterInfo{}},
+		{method: "POST", path: "/clusters", handler: s.createCluster, summary: "Create a cluster", request: clusterRequest{}, response: ClusterInfo{}, status: http.StatusCreated},
+		{method: "GET", path: "/clusters/{name}", handler: s.getCluster, summary: "Describe a cluster", response: ClusterInfo{}},
+		{method: "DELETE", path: "/clusters/{name}", handler: s.deleteCluster, summary: "Delete a cluster and stop its loops", status: http.StatusNoContent},
+		{method: "POST", path: "/clusters/{name}/replicate-to/{to}", handler: s.startReplication, summary: "Replicate a cluster's key-value writes to another", request: replicationRequest{}, response: ReplicationLink{}, status: http.StatusCreated},
+		{method: "GET", path: "/clusters/{name}/replicate-to/{to}", handler: s.getReplication, summary: "Describe a replication link", response: ReplicationLink{}},
+		{method: "DELETE", path: "/clusters/{name}/replicate-to/{to}", handler: s.stopReplication, summary: "Stop a replication link", status: http.StatusNoContent},
+		{method: "POST", path: "/clusters/{name}/replicate-to/{to}/pause", handler: s.pauseReplication, summary: "Pause a replication link", response: ReplicationLink{}},
+		{method: "POST", path: "/clusters/{name}/replicate-to/{to}/resume", handler: s.resumeReplication, summary: "Resume a replication link", response: ReplicationLink{}},
+		{method: "GET", path: "/stats", handler: s.getStats, summary: "Get cluster-wide statistics", response: ClusterStats{}},
+		{method: "GET", path: "/stats/http", handler: s.getHTTPStats, summary: "Get per-route request counts, error rates, and latency histograms", response: HTTPStats{}},
+		{method: "POST", path: "/stats/http/reset", handler: s.resetHTTPStats, summary: "Clear the per-route request statistics", status: http.StatusNoContent},
+		{method: "GET", path: "/stats/kv", handler: s.getKVStats, summary: "Count the keys and tombstones of the key-value store", response: KVStats{}},
+		{method: "GET", path: "/chaos/stats", handler: s.getChaosStats, summary: "Get failure statistics", response: ChaosStats{}},
+		{method: "GET", path: "/metrics", handler: s.getMetrics, summary: "Prometheus metrics", media: mediaText},
+		{method: "GET", path: "/healthz", handler: s.healthHandler, summary: "Liveness probe", response: map[string]string{}},
+		{method: "GET", path: "/readyz", handler: s.readyHandler, summary: "Readiness probe", response: map[string]string{}},
+		{method: "GET", path: "/openapi.json", handler: s.getOpenAPI, summary: "This OpenAPI document", response: map[string]interface{}{}},
+		{method: "GET", path: "/docs", handler: s.getDocs, summary: "HTML listing of the endpoints", media: mediaHTML},
+		{method: "GET", path: "/ui", handler: s.serveUI, summary: "Dashboard of the nodes", media: mediaHTML},
+		{method: "GET", path: "/ui/{file...}", handler: s.serveUIAsset, summary: "Dashboard scripts and styles"},
+	}
+}
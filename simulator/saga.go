@@ -0,0 +1,232 @@
+package simulator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Saga outcomes.
+const (
+	SagaCompleted   = "completed"   // Every step was applied.
+	SagaCompensated = "compensated" // A step failed, and every step applied before it was undone.
+	SagaFailed      = "failed"      // A step failed, and some step applied before it could not be undone.
+)
+
+// Statuses of a saga step.
+const (
+	StepCompleted          = "completed"           // The write was applied and stands.
+	StepFailed             = "failed"              // The write could not be applied.
+	StepSkipped            = "skipped"             // An earlier step failed, so the write was never sent.
+	StepCompensated        = "compensated"         // The write was applied, then undone.
+	StepCompensationFailed = "compensation_failed" // The write was applied, and undoing it failed.
+)
+
+// ErrInvalidSaga means a saga's steps were rejected before it started.
+var ErrInvalidSaga = errors.New("invalid saga")
+
+// SagaStep is one step of a saga: the value to set on a node. Crash fails
+// the node just as the step reaches it, to simulate a node failing mid-saga.
+type SagaStep struct {
+	NodeID int  `json:"node_id"`
+	Value  int  `json:"value"`
+	Crash  bool `json:"crash,omitempty"`
+}
+
+// SagaStepRecord records how one step of a saga went.
+type SagaStepRecord struct {
+	NodeID   int    `json:"node_id"`
+	Value    int    `json:"value"`
+	Previous *int   `json:"previous,omitempty"` // Value the step replaced, which compensation restores; set once applied.
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"` // Why the step or its compensation failed.
+}
+
+// Saga records a saga and its outcome.
+type Saga struct {
+	ID          int              `json:"id"`
+	Coordinator int              `json:"coordinator"` // ID of the leader that ran it.
+	Steps       []SagaStepRecord `json:"steps"`
+	Outcome     string           `json:"outcome"`
+	FailedStep  *int             `json:"failed_step,omitempty"` // Index of the step that failed, if one did.
+	Time        time.Time        `json:"time"`
+
+	// Duration is how long the saga took in simulated time: a round trip
+	// from the coordinator under the latency model for every step sent and
+	// every compensation, one after another.
+	Duration Duration `json:"duration"`
+}
+
+// clone returns a copy of saga that shares no memory with the simulator's
+// state.
+func (saga Saga) clone() Saga {
+	saga.Steps = append([]SagaStepRecord{}, saga.Steps...)
+	return saga
+}
+
+// RunSaga applies steps in order from the current leader, the saga's
+// coordinator. A step fails if its node is down or the coordinator's message
+// to it is lost. Then the later steps are skipped, and the steps already
+// applied are compensated in reverse order by restoring the values they
+// replaced, which fails in turn for a node that is down or can't be reached.
+// The saga is recorded and returned whatever its outcome. It returns an error
+// wrapping ErrInvalidSaga if steps is empty or names a missing node, and
+// ErrNoLeader if no leader is elected to coordinate it.
+func (s *Simulator) RunSaga(steps []SagaStep) (Saga, error) {
+	return s.runSaga(nil, steps)
+}
+
+// runSaga is RunSaga, tracing every step and compensation with t.
+func (s *Simulator) runSaga(t *tracer, steps []SagaStep) (Saga, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(steps) == 0 {
+		return Saga{}, fmt.Errorf("%w: no steps", ErrInvalidSaga)
+	}
+	for _, step := range steps {
+		if s.findNode(step.NodeID) < 0 {
+			return Saga{}, fmt.Errorf("%w: node %d does not exist", ErrInvalidSaga, step.NodeID)
+		}
+	}
+	leader := s.topLeader()
+	if leader < 0 {
+		return Saga{}, ErrNoLeader
+	}
+
+	s.nextSagaID++
+	coordinator := s.nodes[leader].ID
+	saga := Saga{ID: s.nextSagaID, Coordinator: coordinator, Outcome: SagaCompleted, Time: time.Now()}
+	now := s.cfg.Clock.Now()
+	root := t.start(0, "saga", coordinator, now)
+	var duration time.Duration
+	for i, step := range steps {
+		record := SagaStepRecord{NodeID: step.NodeID, Value: step.Value, Status: StepSkipped}
+		if saga.FailedStep == nil {
+			sent := now.Add(duration)
+			duration += s.messageDelay(coordinator, step.NodeID) + s.messageDelay(step.NodeID, coordinator)
+			index := s.findNode(step.NodeID)
+			if step.Crash && s.nodes[index].Status == StatusUp {
+				s.transition(index, StatusDown)
+			}
+			err := s.sagaReach(coordinator, step.NodeID)
+			if err != nil {
+				record.Status, record.Error = StepFailed, err.Error()
+				saga.FailedStep = &i
+			} else {
+				previous := s.nodes[index].Value
+				record.Previous, record.Status = &previous, StepCompleted
+				s.setSagaValue(index, step.Value)
+			}
+			t.record(root, "saga.step", step.NodeID, sent, now.Add(duration), err)
+		}
+		saga.Steps = append(saga.Steps, record)
+	}
+
+	if saga.FailedStep != nil {
+		saga.Outcome = SagaCompensated
+		for i := *saga.FailedStep - 1; i >= 0; i-- {
+			record := &saga.Steps[i]
+			sent := now.Add(duration)
+			duration += s.messageDelay(coordinator, record.NodeID) + s.messageDelay(record.NodeID, coordinator)
+			err := s.sagaReach(coordinator, record.NodeID)
+			t.record(root, "saga.compensate", record.NodeID, sent, now.Add(duration), err)
+			if err != nil {
+				record.Status, record.Error = StepCompensationFailed, err.Error()
+				saga.Outcome = SagaFailed
+				continue
+			}
+			s.setSagaValue(s.findNode(record.NodeID), *record.Previous)
+			record.Status = StepCompensated
+		}
+	}
+	saga.Duration = Duration(duration)
+	t.end(root, now.Add(duration), nil)
+
+	s.sagas[saga.ID] = saga
+	s.logger.Info("saga finished", "saga_id", saga.ID, "outcome", saga.Outcome, "steps", len(saga.Steps))
+	return saga.clone(), nil
+}
+
+// sagaReach returns an error unless the coordinator's message reaches the
+// node with the given ID and the node is up to act on it. The caller must
+// hold s.mu for writing.
+func (s *Simulator) sagaReach(coordinator, id int) error {
+	if id != coordinator && (!s.reachable(coordinator, id) || !s.deliver(coordinator, id)) {
+		return errMessageLost
+	}
+	if s.nodes[s.findNode(id)].Status != StatusUp {
+		return errNodeDown
+	}
+	return nil
+}
+
+// setSagaValue sets the value of the node at index for a saga. The caller
+// must hold s.mu for writing.
+func (s *Simulator) setSagaValue(index, value int) {
+	s.nodes[index].Value = value
+	s.nodes[index].tick()
+	s.publish(EventNodeUpdated, index)
+}
+
+// Saga returns the record of the saga with the given ID and false if no such
+// saga exists.
+func (s *Simulator) Saga(id int) (Saga, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	saga, ok := s.sagas[id]
+	if !ok {
+		return Saga{}, false
+	}
+	return saga.clone(), true
+}
+
+// sagaRequest is the JSON payload accepted by createSaga.
+type sagaRequest struct {
+	Steps []SagaStep `json:"steps"`
+}
+
+// createSaga handles HTTP requests to run a saga over an ordered list of node
+// writes. It returns 201 with the saga record whatever its outcome, 400 for
+// invalid steps, and 503 if no leader is elected.
+func (s *Simulator) createSaga(w http.ResponseWriter, r *http.Request) {
+	var payload sagaRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "Malformed JSON body")
+		return
+	}
+
+	t := newTracer(r)
+	defer s.keepTrace(t)
+	saga, err := s.runSaga(t, payload.Steps)
+	switch {
+	case errors.Is(err, ErrNoLeader):
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeJSON(w, http.StatusCreated, saga)
+	}
+}
+
+// getSaga handles HTTP requests to retrieve a saga record.
+func (s *Simulator) getSaga(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid saga ID")
+		return
+	}
+
+	saga, found := s.Saga(id)
+	if !found {
+		writeError(w, http.StatusNotFound, "Saga not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, saga)
+}
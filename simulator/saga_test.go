@@ -0,0 +1,80 @@
+package simulator
+
+import (
+	"net/http"
+	"testing"
+)
+
+// TestSagaCompensate tests that a node failing at step 3 of a saga skips the
+// later steps and compensates steps 1 and 2 in reverse order, leaving every
+// node's value unchanged.
+func TestSagaCompensate(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	h := s.Handler()
+	before := make(map[int]int)
+	for _, node := range s.Snapshot() {
+		before[node.ID] = node.Value
+	}
+
+	rr := doRequest(t, h, "POST", "/sagas", `{"steps":[{"node_id":1,"value":11},{"node_id":2,"value":22},{"node_id":3,"value":33,"crash":true},{"node_id":4,"value":44},{"node_id":1,"value":55}]}`)
+	expectCode(t, rr, http.StatusCreated)
+	var saga Saga
+	decodeBody(t, rr, &saga)
+	if saga.ID != 1 || saga.Coordinator != 0 || saga.Outcome != SagaCompensated || saga.FailedStep == nil || *saga.FailedStep != 2 {
+		t.Fatalf("Expected saga 1 run by node 0 to fail at step 3 and be compensated, got %+v", saga)
+	}
+	for i, want := range []string{StepCompensated, StepCompensated, StepFailed, StepSkipped, StepSkipped} {
+		if step := saga.Steps[i]; step.Status != want {
+			t.Errorf("Expected step %d to be %s, got %+v", i+1, want, step)
+		}
+	}
+	if step := saga.Steps[0]; step.Previous == nil || *step.Previous != before[1] {
+		t.Errorf("Expected step 1 to record node 1's value %d, got %+v", before[1], step)
+	}
+	if node, _ := s.Node(3); node.Status != StatusDown {
+		t.Errorf("Expected node 3 to have crashed, got %+v", node)
+	}
+	for _, node := range s.Snapshot() {
+		if node.Value != before[node.ID] {
+			t.Errorf("Expected node %d to hold %d again, got %d", node.ID, before[node.ID], node.Value)
+		}
+	}
+
+	var got Saga
+	decodeBody(t, doRequest(t, h, "GET", "/sagas/1", ""), &got)
+	if got.Outcome != SagaCompensated || len(got.Steps) != 5 || got.Steps[1].Status != StepCompensated {
+		t.Errorf("Expected the saga's record, got %+v", got)
+	}
+	expectCode(t, doRequest(t, h, "GET", "/sagas/2", ""), http.StatusNotFound)
+	expectCode(t, doRequest(t, h, "GET", "/sagas/abc", ""), http.StatusBadRequest)
+}
+
+// TestSagaOutcomes tests a saga that completes, one whose compensation can't
+// reach a crashed node, and sagas rejected before they start.
+func TestSagaOutcomes(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	saga, err := s.RunSaga([]SagaStep{{NodeID: 1, Value: 11}, {NodeID: 2, Value: 22}})
+	if err != nil || saga.Outcome != SagaCompleted || saga.FailedStep != nil {
+		t.Fatalf("Expected the saga to complete, got %+v and %v", saga, err)
+	}
+	if node, _ := s.Node(2); node.Value != 22 {
+		t.Errorf("Expected node 2 to hold 22, got %d", node.Value)
+	}
+
+	// Node 1 crashes at step 2, so step 1's write on it can't be undone.
+	saga, err = s.RunSaga([]SagaStep{{NodeID: 1, Value: 12}, {NodeID: 1, Value: 13, Crash: true}})
+	if err != nil || saga.Outcome != SagaFailed || saga.Steps[0].Status != StepCompensationFailed {
+		t.Fatalf("Expected step 1's compensation to fail, got %+v and %v", saga, err)
+	}
+	if node, _ := s.Node(1); node.Value != 12 {
+		t.Errorf("Expected node 1 to keep 12, got %d", node.Value)
+	}
+
+	for _, body := range []string{`{"steps":[]}`, `{"steps":[{"node_id":99,"value":1}]}`, `{"writes":[]}`} {
+		expectCode(t, doRequest(t, h, "POST", "/sagas", body), http.StatusBadRequest)
+	}
+}
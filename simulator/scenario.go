@@ -0,0 +1,367 @@
+package simulator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+)
+
+// DefaultScenarioTick is the simulation time between scenario ticks, used
+// when a scenario leaves "tick" unset.
+const DefaultScenarioTick = time.Second
+
+// Scenario event types accepted in ScenarioEvent.Type.
+const (
+	ScenarioFail             = "fail"              // Mark Node down.
+	ScenarioRecover          = "recover"           // Mark Node up.
+	ScenarioPartition        = "partition"         // Split the cluster into Groups.
+	ScenarioHeal             = "heal"              // Remove any partition.
+	ScenarioLoss             = "loss"              // Set the loss rate of the link From -> To to Loss.
+	ScenarioPauseHeartbeats  = "pause_heartbeats"  // Drop Node's heartbeats.
+	ScenarioResumeHeartbeats = "resume_heartbeats" // Restore Node's heartbeats.
+)
+
+// Scenario is a reproducible script for a simulation: the nodes to start
+// with, the seed of the random source, and a timeline of events to inject.
+type Scenario struct {
+	Name     string          `json:"name,omitempty"`
+	Nodes    int             `json:"nodes"`
+	Seed     int64           `json:"seed"`
+	Tick     Duration        `json:"tick,omitempty"` // Simulation time per tick; DefaultScenarioTick if unset.
+	Timeline []ScenarioEvent `json:"timeline"`       // Ordered by At.
+}
+
+// ScenarioEvent is one step of a scenario's timeline, run once At ticks of
+// the simulation clock have passed since the scenario started. Which of the
+// other fields are required depends on Type.
+type ScenarioEvent struct {
+	At     int      `json:"at"`
+	Type   string   `json:"event"`
+	Node   *int     `json:"node,omitempty"`
+	Groups [][]int  `json:"groups,omitempty"`
+	From   *int     `json:"from,omitempty"`
+	To     *int     `json:"to,omitempty"`
+	Loss   *float64 `json:"loss,omitempty"`
+
+	// Line is the line of the scenario file the event starts on. It is set
+	// by ParseScenario.
+	Line int `json:"line,omitempty"`
+}
+
+// ScenarioStatus reports the progress of a Simulator through its scenario.
+type ScenarioStatus struct {
+	Name     string         `json:"name,omitempty"`
+	Tick     int            `json:"tick"`
+	Executed int            `json:"executed"`
+	Total    int            `json:"total"`
+	Done     bool           `json:"done"`
+	Timeline []ScenarioStep `json:"timeline"`
+}
+
+// ScenarioStep is an event of a scenario's timeline and its outcome.
+type ScenarioStep struct {
+	ScenarioEvent
+	Executed bool   `json:"executed"`
+	Error    string `json:"error,omitempty"` // Why the event failed, if it did.
+}
+
+// ErrNoScenario is returned when no scenario has been loaded.
+var ErrNoScenario = errors.New("simulator: no scenario loaded")
+
+// scenarioRun is a loaded scenario and the progress through its timeline.
+type scenarioRun struct {
+	scenario *Scenario
+	tick     int            // Ticks passed since the scenario started.
+	steps    []ScenarioStep // Mirrors scenario.Timeline.
+	next     int            // Index of the next step to run.
+}
+
+// ReadScenario reads and parses the scenario file at path.
+func ReadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	scenario, err := ParseScenario(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return scenario, nil
+}
+
+// ParseScenario parses and validates a JSON scenario such as
+//
+//	{"nodes": 5, "seed": 42, "timeline": [
+//	  {"at": 10, "event": "fail", "node": 2},
+//	  {"at": 20, "event": "partition", "groups": [[0, 1], [2, 3, 4]]},
+//	  {"at": 30, "event": "heal"}
+//	]}
+//
+// Errors in the timeline, such as an unknown event type or a node outside
+// the scenario, name the line the event starts on.
+func ParseScenario(data []byte) (*Scenario, error) {
+	var scenario Scenario
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&scenario); err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr):
+			return nil, fmt.Errorf("line %d: %w", lineAt(data, syntaxErr.Offset), err)
+		case errors.As(err, &typeErr):
+			return nil, fmt.Errorf("line %d: %w", lineAt(data, typeErr.Offset), err)
+		}
+		return nil, err
+	}
+
+	if scenario.Nodes < 1 {
+		return nil, fmt.Errorf("node count must be at least 1, got %d", scenario.Nodes)
+	}
+	if scenario.Tick < 0 {
+		return nil, fmt.Errorf("tick must be positive, got %v", scenario.Tick)
+	}
+	if scenario.Tick == 0 {
+		scenario.Tick = Duration(DefaultScenarioTick)
+	}
+	lines := timelineLines(data)
+	for i := range scenario.Timeline {
+		event := &scenario.Timeline[i]
+		event.Line = lines[i]
+		if err := event.validate(scenario.Nodes); err != nil {
+			return nil, fmt.Errorf("line %d: %w", event.Line, err)
+		}
+	}
+	slices.SortStableFunc(scenario.Timeline, func(a, b ScenarioEvent) int { return a.At - b.At })
+	return &scenario, nil
+}
+
+// validate checks that e is a known event type with the fields it requires,
+// naming nodes of a scenario with the given node count.
+func (e ScenarioEvent) validate(nodes int) error {
+	if e.At < 0 {
+		return fmt.Errorf("tick must not be negative, got %d", e.At)
+	}
+	checkNode := func(field string, id *int) error {
+		if id == nil {
+			return fmt.Errorf("%s event requires %q", e.Type, field)
+		}
+		if *id < 0 || *id >= nodes {
+			return fmt.Errorf("node %d does not exist", *id)
+		}
+		return nil
+	}
+
+	switch e.Type {
+	case ScenarioFail, ScenarioRecover, ScenarioPauseHeartbeats, ScenarioResumeHeartbeats:
+		return checkNode("node", e.Node)
+	case ScenarioPartition:
+		if len(e.Groups) == 0 {
+			return fmt.Errorf("partition event requires \"groups\"")
+		}
+		for _, group := range e.Groups {
+			for _, id := range group {
+				if err := checkNode("groups", &id); err != nil {
+					return err
+				}
+			}
+		}
+	case ScenarioHeal:
+	case ScenarioLoss:
+		if err := checkNode("from", e.From); err != nil {
+			return err
+		}
+		if err := checkNode("to", e.To); err != nil {
+			return err
+		}
+		if e.Loss == nil || *e.Loss < 0 || *e.Loss > 1 {
+			return fmt.Errorf("loss event requires \"loss\" between 0 and 1")
+		}
+	default:
+		return fmt.Errorf("unknown event type %q", e.Type)
+	}
+	return nil
+}
+
+// timelineLines returns the line each element of the "timeline" array in
+// data starts on. data must hold a valid scenario.
+func timelineLines(data []byte) []int {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.Token() // The opening brace.
+	for decoder.More() {
+		key, _ := decoder.Token()
+		if key != "timeline" {
+			var skip json.RawMessage
+			decoder.Decode(&skip)
+			continue
+		}
+		if token, _ := decoder.Token(); token != json.Delim('[') {
+			return nil
+		}
+		var lines []int
+		for decoder.More() {
+			lines = append(lines, lineAt(data, decoder.InputOffset()))
+			var skip json.RawMessage
+			decoder.Decode(&skip)
+		}
+		return lines
+	}
+	return nil
+}
+
+// lineAt returns the line of data holding the first character at or after
+// offset that is not whitespace or a comma.
+func lineAt(data []byte, offset int64) int {
+	for offset < int64(len(data)) && bytes.IndexByte([]byte(" \t\r\n,"), data[offset]) >= 0 {
+		offset++
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+// LoadScenario makes scenario the timeline StartScenario plays, starting
+// from tick 0. The nodes and seed it names are up to the caller to apply.
+func (s *Simulator) LoadScenario(scenario *Scenario) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run := &scenarioRun{scenario: scenario, steps: make([]ScenarioStep, len(scenario.Timeline))}
+	for i, event := range scenario.Timeline {
+		run.steps[i].ScenarioEvent = event
+	}
+	s.scenario = run
+}
+
+// StartScenario plays the loaded scenario, running the events due at tick 0
+// and then one tick of the timeline per Scenario.Tick of the simulation
+// clock, until every event has run or ctx is cancelled. It returns at once if
+// no scenario is loaded. It blocks, so callers typically run it in its own
+// goroutine.
+func (s *Simulator) StartScenario(ctx context.Context) {
+	s.mu.RLock()
+	run := s.scenario
+	s.mu.RUnlock()
+	if run == nil {
+		return
+	}
+
+	s.logger.Info("scenario started", "name", run.scenario.Name, "events", len(run.steps))
+	if s.scenarioStep(false) {
+		return
+	}
+	ticker := s.cfg.Clock.NewTicker(time.Duration(run.scenario.Tick))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			if s.scenarioStep(true) {
+				return
+			}
+		}
+	}
+}
+
+// scenarioStep advances the scenario by a tick if advance is set, then runs
+// every event that is due. It reports whether the timeline is finished.
+func (s *Simulator) scenarioStep(advance bool) bool {
+	s.mu.Lock()
+	run := s.scenario
+	if advance {
+		run.tick++
+	}
+	tick, first := run.tick, run.next
+	for run.next < len(run.steps) && run.steps[run.next].At <= tick {
+		run.next++
+	}
+	due := slices.Clone(run.steps[first:run.next])
+	s.mu.Unlock()
+
+	// The events take the lock themselves.
+	for i := range due {
+		if err := s.applyScenarioEvent(due[i].ScenarioEvent); err != nil {
+			due[i].Error = err.Error()
+			s.logger.Warn("scenario step failed", "tick", tick, "line", due[i].Line, "event", due[i].Type, "error", err)
+		} else {
+			s.logger.Info("scenario step", "tick", tick, "line", due[i].Line, "event", due[i].Type)
+		}
+		due[i].Executed = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copy(run.steps[first:], due)
+	finished := run.next == len(run.steps)
+	if finished && len(due) > 0 {
+		s.logger.Info("scenario finished", "name", run.scenario.Name, "tick", tick)
+	}
+	return finished
+}
+
+// applyScenarioEvent injects the event e into the simulation.
+func (s *Simulator) applyScenarioEvent(e ScenarioEvent) error {
+	found := true
+	switch e.Type {
+	case ScenarioFail:
+		_, found = s.Fail(*e.Node)
+	case ScenarioRecover:
+		_, found = s.Recover(*e.Node)
+	case ScenarioPartition:
+		return s.SetPartition(e.Groups)
+	case ScenarioHeal:
+		s.HealPartition()
+	case ScenarioLoss:
+		return s.SetLinkLoss(*e.From, *e.To, *e.Loss)
+	case ScenarioPauseHeartbeats:
+		found = s.PauseHeartbeats(*e.Node)
+	case ScenarioResumeHeartbeats:
+		found = s.ResumeHeartbeats(*e.Node)
+	}
+	if !found {
+		return ErrNodeNotFound
+	}
+	return nil
+}
+
+// ScenarioStatus returns the progress through the loaded scenario, or
+// ErrNoScenario if there is none.
+func (s *Simulator) ScenarioStatus() (ScenarioStatus, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	run := s.scenario
+	if run == nil {
+		return ScenarioStatus{}, ErrNoScenario
+	}
+	status := ScenarioStatus{
+		Name:     run.scenario.Name,
+		Tick:     run.tick,
+		Total:    len(run.steps),
+		Done:     run.next == len(run.steps),
+		Timeline: slices.Clone(run.steps),
+	}
+	for _, step := range run.steps {
+		if step.Executed {
+			status.Executed++
+		}
+	}
+	return status, nil
+}
+
+// getScenario handles HTTP requests to retrieve the progress through the
+// loaded scenario.
+func (s *Simulator) getScenario(w http.ResponseWriter, r *http.Request) {
+	status, err := s.ScenarioStatus()
+	if err != nil {
+		writeError(w, http.StatusNotFound, "No scenario is loaded")
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
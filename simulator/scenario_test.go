@@ -0,0 +1,133 @@
+package simulator
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testScenario fails a node and partitions and heals the cluster. Its
+// events are out of order to test that the timeline is sorted.
+const testScenario = `{
+  "name": "demo",
+  "nodes": 5,
+  "seed": 7,
+  "timeline": [
+    {"at": 2, "event": "partition", "groups": [[0, 1], [2, 3, 4]]},
+    {"at": 0, "event": "loss", "from": 0, "to": 1, "loss": 0.5},
+    {"at": 1, "event": "fail", "node": 2},
+    {"at": 3, "event": "heal"},
+    {"at": 3, "event": "recover", "node": 9}
+  ]
+}`
+
+// TestScenario tests that a scenario's events run at their ticks as the
+// simulation clock is stepped.
+func TestScenario(t *testing.T) {
+	scenario, err := ParseScenario([]byte(strings.Replace(testScenario, `"node": 9`, `"node": 4`, 1)))
+	if err != nil {
+		t.Fatalf("ParseScenario failed: %v", err)
+	}
+	if scenario.Tick != Duration(DefaultScenarioTick) {
+		t.Errorf("Expected the default tick, got %v", scenario.Tick)
+	}
+	for i, want := range []int{7, 8, 6, 9, 10} {
+		if got := scenario.Timeline[i].Line; got != want {
+			t.Errorf("Expected event %d to start on line %d, got %d", i, want, got)
+		}
+	}
+
+	clock := NewVirtualClock(time.Unix(0, 0))
+	clock.Pause()
+	s := New(Config{Seed: scenario.Seed, Clock: clock})
+	s.Init(scenario.Nodes)
+	h := s.Handler()
+	expectCode(t, doRequest(t, h, "GET", "/scenario", ""), http.StatusNotFound)
+	s.LoadScenario(scenario)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		s.StartScenario(ctx)
+		close(done)
+	}()
+	waitFor(t, func() bool { return tickerCount(clock) == 1 })
+	if links := s.Links(); links.Loss[0][1] != 0.5 {
+		t.Errorf("Expected the tick 0 event to run at once, got %+v", links.Loss)
+	}
+
+	step := func(tick int) {
+		t.Helper()
+		if err := clock.Step(); err != nil {
+			t.Fatalf("Step failed: %v", err)
+		}
+		waitFor(t, func() bool {
+			status, _ := s.ScenarioStatus()
+			return status.Tick == tick
+		})
+	}
+	step(1)
+	if node, _ := s.Node(2); node.Status != StatusDown {
+		t.Errorf("Expected node 2 to be failed at tick 1")
+	}
+	step(2)
+	if groups := s.Partition(); len(groups) != 2 {
+		t.Errorf("Expected a partition at tick 2, got %v", groups)
+	}
+
+	rr := doRequest(t, h, "GET", "/scenario", "")
+	expectCode(t, rr, http.StatusOK)
+	var status ScenarioStatus
+	decodeBody(t, rr, &status)
+	if status.Name != "demo" || status.Tick != 2 || status.Executed != 3 || status.Total != 5 || status.Done {
+		t.Errorf("Unexpected progress %+v", status)
+	}
+	if !status.Timeline[2].Executed || status.Timeline[3].Executed {
+		t.Errorf("Expected the first three events to have run, got %+v", status.Timeline)
+	}
+
+	step(3)
+	<-done
+	if groups := s.Partition(); groups != nil {
+		t.Errorf("Expected the partition to be healed, got %v", groups)
+	}
+	if node, _ := s.Node(4); node.Status != StatusUp {
+		t.Errorf("Expected node 4 to be up")
+	}
+	status, _ = s.ScenarioStatus()
+	if !status.Done || status.Executed != 5 {
+		t.Errorf("Expected the scenario to be done, got %+v", status)
+	}
+	if tickerCount(clock) != 0 {
+		t.Errorf("Expected the finished scenario to stop its ticker")
+	}
+}
+
+// TestParseScenarioErrors tests that invalid scenarios are rejected, naming
+// the offending line where there is one.
+func TestParseScenarioErrors(t *testing.T) {
+	tests := []struct {
+		name, scenario, want string
+	}{
+		{"node outside scenario", testScenario, "line 10: node 9 does not exist"},
+		{"unknown event", strings.Replace(testScenario, `"heal"`, `"explode"`, 1), `line 9: unknown event type "explode"`},
+		{"missing node", strings.Replace(testScenario, `, "node": 2`, "", 1), `line 8: fail event requires "node"`},
+		{"bad loss", strings.Replace(testScenario, `0.5`, `2`, 1), "line 7: loss event requires"},
+		{"negative tick", strings.Replace(testScenario, `"at": 1`, `"at": -1`, 1), "line 8: tick must not be negative"},
+		{"wrong type", strings.Replace(testScenario, `"at": 3`, `"at": "3"`, 1), "line 9:"},
+		{"syntax", strings.Replace(testScenario, `"heal"}`, `"heal"`, 1), "line 10:"},
+		{"unknown field", strings.Replace(testScenario, `"seed"`, `"sed"`, 1), "unknown field"},
+		{"no nodes", `{"nodes": 0}`, "node count must be at least 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseScenario([]byte(tt.scenario))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected an error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
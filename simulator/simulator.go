@@ -0,0 +1,1234 @@
+// Package simulator simulates a set of nodes in a distributed system and
+// exposes them over HTTP.
+package simulator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Node statuses reported in NodeData.Status.
+const (
+	StatusUp   = "up"   // The node is reachable.
+	StatusDown = "down" // The node has failed and is unreachable.
+)
+
+// NodeData represents the data structure for a single node in the distributed system.
+type NodeData struct {
+	ID     int       `json:"id" xml:"id"`
+	Name   string    `json:"name" xml:"name"`
+	Value  int       `json:"value" xml:"value"`
+	Time   time.Time `json:"time" xml:"time"`
+	Status string    `json:"status" xml:"status"`
+	Leader bool      `json:"leader" xml:"leader"`
+
+	// Term is the latest Raft term the node has seen. It is only advanced
+	// in raft mode.
+	Term uint64 `json:"term" xml:"term"`
+
+	// Latency is the simulated network delay of requests to this node. It
+	// starts at Config.Latency and can be overridden per node.
+	Latency Duration `json:"latency" xml:"latency"`
+
+	// Suspected is set by the failure detector when the node's heartbeats
+	// have stopped arriving. Unlike Status, it is the cluster's belief about
+	// the node rather than the node's actual state.
+	Suspected bool `json:"suspected" xml:"suspected"`
+
+	// VectorClock records the events this node's state causally depends on.
+	// It ticks on local updates and merges when nodes exchange values.
+	VectorClock VectorClock `json:"vector_clock" xml:"vector_clock"`
+
+	// Version starts at 1 and increases by one with every change to the
+	// node, so clients can make conditional updates with If-Match.
+	Version uint64 `json:"version" xml:"version"`
+
+	// HLC is the hybrid logical clock timestamp of the node's current
+	// value. Time is the same event on the node's wall clock, which may be
+	// skewed, so unlike HLC it can disagree with causality.
+	HLC HLC `json:"hlc" xml:"hlc"`
+
+	// Clock is the latest timestamp the node's hybrid logical clock has
+	// issued, for a mutation or a message sent or received. It is never
+	// before HLC.
+	Clock HLC `json:"clock" xml:"clock"`
+
+	// Skew is how far the node's wall clock is off from real time.
+	Skew Duration `json:"skew" xml:"skew"`
+
+	// Region and Zone place the node in the simulated topology. Requests
+	// from clients in another region pay Config.InterRegionLatency on top
+	// of Latency.
+	Region string `json:"region,omitempty" xml:"region,omitempty"`
+	Zone   string `json:"zone,omitempty" xml:"zone,omitempty"`
+
+	// Tags are free-form labels that GET /nodes can filter on.
+	Tags Tags `json:"tags,omitempty" xml:"tags,omitempty"`
+
+	// Role is RolePrimary, RoleReplica, or RoleWitness. When every primary
+	// is down, the next elected leader is promoted to primary.
+	Role string `json:"role" xml:"role"`
+
+	// Byzantine marks a node that reports corrupted values; see
+	// Simulator.ToggleByzantine.
+	Byzantine bool `json:"byzantine,omitempty" xml:"byzantine,omitempty"`
+
+	// Membership is MemberActive for a node on the consistent-hash ring,
+	// and MemberJoining or MemberLeaving while keys are transferred to or
+	// from it; see Simulator.TransferRound.
+	Membership string `json:"membership" xml:"membership"`
+
+	// Resources is the node's simulated CPU, memory, and disk usage; see
+	// Simulator.ResourceRound.
+	Resources Resources `json:"resources" xml:"resources"`
+
+	// Checksum is the checksum of the node's value, data store, and
+	// replicated keys, stored whenever they change; see Simulator.Integrity.
+	Checksum uint32 `json:"-" xml:"-"`
+}
+
+// clone returns a copy of n that shares no memory with the simulator's state,
+// so it can be used after s.mu is released.
+func (n NodeData) clone() NodeData {
+	n.VectorClock = n.VectorClock.clone()
+	n.Tags = n.Tags.clone()
+	return n
+}
+
+// tick records a local event on n, refreshing its time and hybrid logical
+// clock timestamp and advancing its own vector clock entry.
+func (n *NodeData) tick() {
+	n.Time = n.wall()
+	n.HLC = n.stamp()
+	if n.VectorClock == nil {
+		n.VectorClock = VectorClock{}
+	}
+	n.VectorClock[n.ID]++
+}
+
+// Simulator holds the state of one simulated distributed system. Each
+// Simulator owns its nodes, lock, and random source, so several can run in
+// the same process without interfering with each other.
+type Simulator struct {
+	mu      sync.RWMutex // RWMutex for thread-safe data access; see nodeLock for how Update shares it.
+	nodes   []NodeData   // Slice to hold node data.
+	nextID  int          // ID assigned to the next node created at runtime.
+	updates atomic.Int64 // Number of updates performed by Update.
+	rng     *rand.Rand   // Seeded random source for node values; guarded by mu, and by rngMu while mu is read-locked.
+	rngMu   sync.Mutex   // Guards rng between updates holding mu for reading.
+	cfg     Config       // Configuration the simulator was created with.
+	logger  *slog.Logger // Logger for node lifecycle and request logs.
+
+	nodeLocks [nodeLockShards]sync.RWMutex // Node locks sharded by node ID; see nodeLock.
+	feedMu    sync.Mutex                   // Guards the event fields below while mu is read-locked; see announce.
+
+	failures   int // Number of up-to-down transitions; guarded by mu.
+	recoveries int // Number of down-to-up transitions; guarded by mu.
+
+	groups [][]int     // Partition groups of node IDs, or nil; guarded by mu.
+	group  map[int]int // Partition group index by node ID, or nil; guarded by mu.
+
+	replicaData map[int]map[string]KVEntry // Replicated KV entries by node ID; guarded by mu.
+	kvVersion   uint64                     // Version assigned to the last KV write; guarded by mu.
+	kvClock     HLC                        // Hybrid logical clock stamping KV writes for replication links; guarded by mu.
+	kvStamps    map[string]kvStamp         // Stamp of the last write to each key; guarded by mu.
+	outbound    []*replicationLink         // Replication links from this cluster; guarded by mu.
+
+	hints          map[int][]Hint // Pending hints by the ID of the node holding them; guarded by mu.
+	hintsDelivered uint64         // Hints handed to their target; guarded by mu.
+	hintsExpired   uint64         // Hints dropped after Config.HintTTL; guarded by mu.
+
+	disagreements struct{ masked, unresolved uint64 } // Majority reads some replica disagreed with; guarded by mu.
+
+	checksumRejected uint64 // Copies of KV entries refused for not matching their checksums; guarded by mu.
+
+	kvDeletes        uint64 // KV deletes made; guarded by mu.
+	kvExpired        uint64 // Replica copies of KV entries replaced by tombstones on expiry; guarded by mu.
+	tombstonesPurged uint64 // Tombstones dropped after Config.TombstoneGrace; guarded by mu.
+
+	antiEntropy AntiEntropyStats // Totals of anti-entropy reconciliations; guarded by mu.
+
+	store map[int]map[string]string // Per-node data store by node ID; guarded by mu.
+	crdts map[int]*crdtState        // CRDT replicas by node ID; guarded by mu.
+
+	ring          *HashRing  // Consistent-hash ring of all nodes; guarded by mu.
+	lastRebalance *Rebalance // Outcome of the last membership change; guarded by mu.
+
+	heartbeats map[int]*heartbeatState // Failure detector state by node ID; guarded by mu.
+
+	raftLogs   map[int][]LogEntry // Local Raft log by node ID; guarded by mu.
+	committed  []LogEntry         // Committed prefix of the Raft log; guarded by mu.
+	term       uint64             // Current Raft term; guarded by mu.
+	raftLeader int                // ID of the Raft leader, or -1; guarded by mu.
+
+	fencingToken uint64         // Fencing token issued to the last leader elected; guarded by mu.
+	tokens       map[int]uint64 // Fencing token each node was last issued as leader, by ID; guarded by mu.
+	fences       map[int]uint64 // Highest fencing token each replica has stored, by ID; guarded by mu.
+	staleWrites  staleWriteLog  // Writes of deposed leaders rejected or rolled back; guarded by mu.
+
+	transactions map[int]Transaction // Two-phase commit records by ID; guarded by mu.
+	nextTxID     int                 // ID of the last transaction; guarded by mu.
+	sagas        map[int]Saga        // Saga records by ID; guarded by mu.
+	nextSagaID   int                 // ID of the last saga; guarded by mu.
+
+	restarts         map[int]*restartState // Pending restarts by node ID; guarded by mu.
+	restartDurations histogram             // Simulated downtimes of restarted nodes; guarded by mu.
+	rolling          atomic.Bool           // Set while RollingRestart is running.
+
+	transfers map[int]*transfer // Latest join or leave of each node, by ID; guarded by mu.
+	rebalance *rebalanceRun     // Latest rebalance executed, or nil; guarded by mu.
+
+	linkLoss  map[link]float64 // Message loss rate by directed link; guarded by mu.
+	delivered uint64           // Messages delivered between nodes; guarded by mu.
+	dropped   uint64           // Messages lost between nodes; guarded by mu.
+
+	latencyModel LatencyModel          // Delays of messages between nodes; guarded by mu.
+	inFlight     []message             // Messages sent but yet to arrive; guarded by mu.
+	txDurations  histogram             // Simulated durations of two-phase commits; guarded by mu.
+	bandwidth    Bandwidth             // Bandwidth limit of every link; guarded by mu.
+	traffic      trafficStats          // Messages and bytes sent between nodes; guarded by mu.
+	usage        resourceUsage         // CPU time nodes spent since the last ResourceRound; guarded by mu.
+	autoscaler   autoscaler            // Adds and removes nodes by their CPU usage; guarded by mu.
+	retries      map[string]RetryCount // Retries of operations between nodes by name; guarded by mu.
+
+	topics     map[string]*topicState // Message bus topics by name; guarded by mu.
+	busPending []busDelivery          // Published messages yet to be sent to a subscriber; guarded by mu.
+	busSeq     uint64                 // ID of the last published message; guarded by mu.
+	inboxes    map[int]*inboxRing     // Messages delivered to each node by ID; guarded by mu.
+	queue      workQueue              // Simulated work queue; guarded by mu.
+	loadGen    loadGen                // Synthetic request generator; guarded by mu.
+	locks      lockTable              // Leases of the lock manager; guarded by mu.
+
+	httpMetrics httpMetrics // Counts HTTP requests and their durations.
+	httpStats   httpStats   // Per-route request statistics for /stats/http.
+
+	events    hub        // Broadcasts node changes to stream subscribers.
+	eventSeq  uint64     // Sequence number of the last event; guarded by mu and feedMu.
+	eventLog  []Event    // Retained events, oldest first; guarded by mu and feedMu.
+	eventBase []NodeData // Nodes as they were before the oldest retained event; guarded by mu and feedMu.
+	watch     watchers   // Wakes long-polling watches; guarded by feedMu.
+
+	webhooks  webhookTable // Registered webhooks and their queued notifications.
+	audit     auditLog     // Recent mutating HTTP requests.
+	traces    traceCache   // Spans of recent requests' multi-node operations.
+	telemetry *telemetry   // Spans queued for Config.Telemetry, shared with created clusters, or nil if it is unset.
+	ticks     tickLog      // Aggregates of the nodes at the end of every updater tick.
+	persist   storeQueue   // Changes yet to be written to Config.Store.
+	clusters  clusterTable // Clusters created by CreateCluster.
+	cluster   string       // Name of the cluster if created by CreateCluster, or "" for the default one.
+	leaderID  int          // ID of the leader webhooks were last told of, or -1; guarded by mu.
+
+	history map[int]*valueRing // Recent value samples by node ID; guarded by mu and feedMu.
+
+	scenario *scenarioRun // Loaded scenario and its progress, or nil; guarded by mu.
+
+	recording bool       // Set while changes are appended to trace; guarded by mu.
+	trace     *Trace     // Trace being or last recorded, or nil; guarded by mu and feedMu.
+	replay    *replayRun // Trace being replayed and its progress, or nil; guarded by mu.
+
+	version uint64 // Incremented on every change to nodes; guarded by mu and feedMu.
+	epoch   int64  // Distinguishes versions of different Simulators in ETags.
+
+	nodesCache atomic.Pointer[nodesSnapshot] // Shared copy of the nodes for GET /nodes; see sharedNodes.
+
+	tunables atomic.Pointer[tunableState] // Settings changeable at runtime; see SetTunables.
+
+	started time.Time // When New created the Simulator, for /debug/vars.
+
+	// Readiness state reported by /readyz.
+	initialized    atomic.Bool   // Set once Init has completed.
+	updaterRunning atomic.Bool   // Set while StartUpdater or StartReplay is running.
+	draining       atomic.Bool   // Set once Drain has been called.
+	drained        chan struct{} // Closed once Drain has been called.
+}
+
+// nodeLockShards is the number of locks the nodes are sharded over.
+const nodeLockShards = 64
+
+// nodeLock returns the lock of the node with the given ID, shared with the
+// other nodes whose IDs are equal modulo nodeLockShards. Update changes a
+// node holding s.mu only for reading, and the node's lock for writing, so
+// that updates to different nodes and reads of the cluster don't wait for
+// each other. Holding s.mu for writing still excludes every update, so code
+// that does may read and change any node without its lock, but code holding
+// s.mu for reading must hold the node's lock for reading to read its
+// Value, Time, HLC, Clock, VectorClock, Version, or Checksum. Its other
+// fields are only ever changed under the write lock.
+func (s *Simulator) nodeLock(id int) *sync.RWMutex {
+	return &s.nodeLocks[id%nodeLockShards]
+}
+
+// rlockNodes read-locks the lock of every node, so the nodes can be read
+// together without any update running in between. The caller must hold
+// s.mu.
+func (s *Simulator) rlockNodes() {
+	for i := range s.nodeLocks {
+		s.nodeLocks[i].RLock()
+	}
+}
+
+// runlockNodes releases the locks taken by rlockNodes.
+func (s *Simulator) runlockNodes() {
+	for i := range s.nodeLocks {
+		s.nodeLocks[i].RUnlock()
+	}
+}
+
+// nodeCopy returns a copy of the node at index under its lock. The caller
+// must hold s.mu.
+func (s *Simulator) nodeCopy(index int) NodeData {
+	lock := s.nodeLock(s.nodes[index].ID)
+	lock.RLock()
+	defer lock.RUnlock()
+	return s.nodes[index].clone()
+}
+
+// snapshot returns a copy of the nodes at a single point between updates.
+// The caller must hold s.mu.
+func (s *Simulator) snapshot() []NodeData {
+	s.rlockNodes()
+	defer s.runlockNodes()
+	return cloneNodes(s.nodes)
+}
+
+// nodesSnapshot is an immutable copy of the nodes as of a version, along
+// with their JSON encoding once it has been asked for.
+type nodesSnapshot struct {
+	version uint64
+	nodes   []NodeData
+
+	jsonOnce sync.Once
+	json     []byte
+	jsonErr  error
+}
+
+// marshalJSON returns the JSON encoding of the nodes, marshaling them on the
+// first call only.
+func (n *nodesSnapshot) marshalJSON() ([]byte, error) {
+	n.jsonOnce.Do(func() {
+		n.json, n.jsonErr = json.Marshal(n.nodes)
+	})
+	return n.json, n.jsonErr
+}
+
+// sharedNodes returns a copy of the nodes at a single point between updates.
+// Unlike snapshot, the copy is shared with other callers until the nodes
+// change, so reading an unchanged cluster again copies and encodes nothing.
+// The caller must hold s.mu, and must not modify the returned nodes.
+func (s *Simulator) sharedNodes() *nodesSnapshot {
+	s.rlockNodes()
+	defer s.runlockNodes()
+	if cached := s.nodesCache.Load(); cached != nil && cached.version == s.version {
+		return cached
+	}
+	cached := &nodesSnapshot{version: s.version, nodes: cloneNodes(s.nodes)}
+	s.nodesCache.Store(cached)
+	return cached
+}
+
+// Simulation modes selectable with Config.Mode.
+const (
+	// ModeIndependent leaves each node's value independent of its peers.
+	ModeIndependent = "independent"
+
+	// ModeGossip propagates node values between peers in gossip rounds.
+	ModeGossip = "gossip"
+
+	// ModeRaft elects a leader that replicates a log of client commands to
+	// its followers with Raft-style majority commits.
+	ModeRaft = "raft"
+)
+
+// Config configures a Simulator. FailProb, RecoverProb, UpdateInterval,
+// GossipFanout, Latency, and Jitter only set the initial Tunables, which
+// SetTunables can change.
+type Config struct {
+	// Seed seeds the random source used for all node value generation and
+	// update choices. Simulators created with the same seed produce the same
+	// sequence of node values.
+	Seed int64
+
+	// FailProb is the probability, per chaos tick, that a random up node is
+	// marked down. It must be between 0 and 1.
+	FailProb float64
+
+	// RecoverProb is the probability, per chaos tick, that a random down
+	// node is marked up again. It must be between 0 and 1.
+	RecoverProb float64
+
+	// UpdateInterval is the interval to run StartUpdater, StartChaos, and
+	// StartReplay at, as reported by Simulator.UpdateInterval. The zero
+	// value means DefaultUpdateInterval.
+	UpdateInterval time.Duration
+
+	// Updaters is the number of workers StartUpdater runs, each updating a
+	// random node of its own choosing once per interval. The zero value
+	// means 1.
+	Updaters int
+
+	// GossipFanout is the number of peers each node exchanges values with
+	// per gossip round. The zero value means 1.
+	GossipFanout int
+
+	// Mode selects how node values relate to each other. The zero value
+	// means ModeIndependent.
+	Mode string
+
+	// N is the number of replicas each key in the replicated key-value
+	// store is placed on. The zero value means DefaultN.
+	N int
+
+	// R is the number of replicas a key-value read must reach. The zero
+	// value means DefaultR.
+	R int
+
+	// W is the number of replicas a key-value write must reach. The zero
+	// value means DefaultW.
+	W int
+
+	// HintTTL is how long a write for a down replica is held as a hint
+	// before it is dropped undelivered. The zero value means DefaultHintTTL.
+	HintTTL time.Duration
+
+	// VerifyChecksums makes replicas refuse copies of key-value entries
+	// that arrive through replication, hints, or anti-entropy not matching
+	// their checksums, as when the sender's copy was corrupted.
+	VerifyChecksums bool
+
+	// TombstoneGrace is how long the tombstone of a deleted or expired
+	// key-value entry is kept, so that replicas that missed the delete
+	// don't bring back older copies, before it is dropped. The zero value
+	// means DefaultTombstoneGrace.
+	TombstoneGrace time.Duration
+
+	// RestartDuration is how long Restart keeps a node down. The zero
+	// value means DefaultRestartDuration.
+	RestartDuration time.Duration
+
+	// RestartReload is where a restarted node reloads its state from,
+	// unless the restart names its own: ReloadSnapshot, ReloadReplicas, or
+	// ReloadNone. The zero value means ReloadSnapshot.
+	RestartReload string
+
+	// TransferBatch is the number of keys each joining or leaving node
+	// transfers per TransferRound. The zero value means
+	// DefaultTransferBatch.
+	TransferBatch int
+
+	// MaxConcurrentTransfers is the number of rebalance moves that transfer
+	// keys at once; see Simulator.ExecuteRebalance. The zero value means
+	// DefaultMaxConcurrentTransfers.
+	MaxConcurrentTransfers int
+
+	// WebhookMaxFailures is the number of deliveries in a row a webhook may
+	// fail, after retrying each, before it is dropped; see
+	// Simulator.StartWebhooks. The zero value means
+	// DefaultWebhookMaxFailures.
+	WebhookMaxFailures int
+
+	// AntiEntropyBuckets is the number of buckets anti-entropy splits each
+	// node's replicated keys into, so that only buckets whose digests differ
+	// are transferred. The zero value means DefaultAntiEntropyBuckets.
+	AntiEntropyBuckets int
+
+	// VirtualNodes is the number of virtual nodes each node is placed at on
+	// the consistent-hash ring. The zero value means DefaultVirtualNodes.
+	VirtualNodes int
+
+	// SuspectTimeout is how long a node may go without a heartbeat before
+	// the failure detector suspects it. The zero value means
+	// DefaultSuspectTimeout.
+	SuspectTimeout time.Duration
+
+	// Latency is the simulated network delay added to every HTTP request.
+	// Individual nodes can override it with SetLatency.
+	Latency time.Duration
+
+	// Jitter is the maximum random delay added on top of the latency of
+	// each request.
+	Jitter time.Duration
+
+	// InterRegionLatency is the simulated delay added to requests to a node
+	// in a region other than the client's, on top of the node's latency.
+	InterRegionLatency time.Duration
+
+	// MessageLatency is the initial latency model of messages between
+	// nodes, which SetLatencyModel replaces. The zero value delivers every
+	// message at once.
+	MessageLatency LatencyModel
+
+	// Retry is how often replication, hint deliveries, and two-phase commit
+	// prepare calls are attempted and how long they back off between
+	// attempts. Zero fields mean DefaultRetryAttempts,
+	// DefaultRetryBaseDelay, and DefaultRetryMaxDelay.
+	Retry RetryPolicy
+
+	// RetryOverrides replaces Retry for the operations it lists by name:
+	// RetryReplication, RetryHint, or RetryPrepare. Zero fields are taken
+	// from Retry.
+	RetryOverrides map[string]RetryPolicy
+
+	// LinkBandwidth is the initial number of bytes each link between nodes
+	// may carry per tick of UpdateInterval, which SetBandwidth replaces.
+	// The zero value means no limit.
+	LinkBandwidth int
+
+	// BandwidthPolicy is what happens to messages over LinkBandwidth:
+	// BandwidthQueue or BandwidthDrop. The zero value means BandwidthQueue.
+	BandwidthPolicy string
+
+	// ClientRegion is the region HTTP clients are in, unless a request
+	// names its own in an X-Client-Region header. Requests from clients in
+	// no region, or to nodes in none, never pay InterRegionLatency.
+	ClientRegion string
+
+	// EventLogSize is the number of events the event log retains before it
+	// evicts the oldest. The zero value means DefaultEventLogSize.
+	EventLogSize int
+
+	// AuditLogSize is the number of mutating HTTP requests the audit log
+	// retains before it evicts the oldest. The zero value means
+	// DefaultAuditLogSize.
+	AuditLogSize int
+
+	// AuditWriter, if set, receives every audit log entry as a line of
+	// JSON.
+	AuditWriter io.Writer
+
+	// Settings is the effective value of every command-line option, served
+	// by GET /config. Secret values should already be redacted.
+	Settings map[string]Setting
+
+	// Reload, if set, re-reads the configuration for Simulator.Reload,
+	// returning every setting as Settings holds them.
+	Reload func() (map[string]Setting, error)
+
+	// ValueHistorySize is the number of value samples retained per node
+	// before the oldest is overwritten. The zero value means
+	// DefaultValueHistorySize.
+	ValueHistorySize int
+
+	// Witnesses is the number of nodes Init makes witnesses, which vote but
+	// store no data.
+	Witnesses int
+
+	// SplitBrain lets every side of a partition elect a leader of its own
+	// outside raft mode, instead of the cluster electing one. Leaders then
+	// keep leading their side while they can, and when sides merge the
+	// leader holding the highest fencing token stays.
+	SplitBrain bool
+
+	// InboxSize is the number of messages each node's inbox retains before
+	// the oldest is overwritten. The zero value means DefaultInboxSize.
+	InboxSize int
+
+	// MaxNodeKeys is the number of keys each node's data store may hold.
+	// The zero value means DefaultMaxNodeKeys.
+	MaxNodeKeys int
+
+	// ResourceLimits are the CPU, memory, and disk usages past which a node
+	// is overloaded. The zero value means no limits.
+	ResourceLimits ResourceLimits
+
+	// Autoscaler configures the autoscaler, which adds and removes nodes as
+	// their CPU usage rises and falls. Zero fields mean the defaults; it is
+	// disabled unless Enabled is set.
+	Autoscaler AutoscalerSettings
+
+	// TraceCapacity is the number of request traces retained before the
+	// least recently used is evicted. The zero value means
+	// DefaultTraceCapacity.
+	TraceCapacity int
+
+	// Compress enables gzip compression of JSON responses for clients that
+	// accept it.
+	Compress bool
+
+	// CompressMinSize is the smallest response body, in bytes, that is
+	// compressed. The zero value means DefaultCompressMinSize.
+	CompressMinSize int
+
+	// CORSOrigins lists the origins browsers may call the API from, or "*"
+	// for any origin. CORS is disabled when it is empty.
+	CORSOrigins []string
+
+	// APIKey is the key that mutating requests must present in an
+	// Authorization: Bearer or X-API-Key header. Authentication is disabled
+	// when it is empty.
+	APIKey string
+
+	// ProtectReads also requires the API key for read requests, except the
+	// health probes.
+	ProtectReads bool
+
+	// RateLimit is the average number of requests per second each client IP
+	// may make. Rate limiting is disabled when it is zero.
+	RateLimit float64
+
+	// RateBurst is the number of requests a client may make at once. The
+	// zero value means the rate limit rounded up.
+	RateBurst int
+
+	// TrustProxy identifies clients by the last address in X-Forwarded-For
+	// rather than the connection's address. Set it only behind a proxy that
+	// appends to the header.
+	TrustProxy bool
+
+	// Logger receives the simulator's structured logs. The zero value means
+	// slog.Default().
+	Logger *slog.Logger
+
+	// DataDir is the directory snapshots are saved to and restored from.
+	// Snapshots are disabled when it is empty.
+	DataDir string
+
+	// ResultsDir is the directory ExportResults writes CSV files of the
+	// run's results to. Exporting is disabled when it is empty.
+	ResultsDir string
+
+	// Store, if set, persists the nodes and the event log, so Resume can
+	// pick up where a previous run left off. Changes are queued as they
+	// are made and written by StartPersist and SyncStore.
+	Store Store
+
+	// Telemetry, if set, receives a span of every HTTP request and of the
+	// simulated steps of the multi-node operations it runs, and the node and
+	// update metrics, as StartTelemetry and FlushTelemetry export them.
+	// Telemetry is disabled, at no cost to requests, when it is nil.
+	Telemetry TelemetryExporter
+
+	// Clock is the time source the background loops started with
+	// StartUpdater, StartChaos, and the like tick from. The zero value means
+	// RealClock; pass a VirtualClock to pause, speed up, or step the
+	// simulation.
+	Clock Clock
+
+	// Debug serves the net/http/pprof profiles under /debug/pprof/ and the
+	// runtime state at /debug/vars. They are not routed at all when it is
+	// false.
+	Debug bool
+}
+
+// DefaultUpdateInterval is the update interval used when Config leaves it
+// unset.
+const DefaultUpdateInterval = 5 * time.Second
+
+// Default quorum settings used when Config leaves them unset. With R+W>N,
+// every read overlaps the most recent successful write.
+const (
+	DefaultN = 3
+	DefaultR = 2
+	DefaultW = 2
+)
+
+// New returns a Simulator with no nodes. Call Init to populate it.
+func New(cfg Config) *Simulator {
+	if cfg.N == 0 {
+		cfg.N = DefaultN
+	}
+	if cfg.R == 0 {
+		cfg.R = DefaultR
+	}
+	if cfg.W == 0 {
+		cfg.W = DefaultW
+	}
+	if cfg.HintTTL == 0 {
+		cfg.HintTTL = DefaultHintTTL
+	}
+	if cfg.TombstoneGrace == 0 {
+		cfg.TombstoneGrace = DefaultTombstoneGrace
+	}
+	if cfg.RestartDuration == 0 {
+		cfg.RestartDuration = DefaultRestartDuration
+	}
+	if cfg.RestartReload == "" {
+		cfg.RestartReload = ReloadSnapshot
+	}
+	if cfg.TransferBatch == 0 {
+		cfg.TransferBatch = DefaultTransferBatch
+	}
+	if cfg.MaxConcurrentTransfers == 0 {
+		cfg.MaxConcurrentTransfers = DefaultMaxConcurrentTransfers
+	}
+	if cfg.WebhookMaxFailures == 0 {
+		cfg.WebhookMaxFailures = DefaultWebhookMaxFailures
+	}
+	if cfg.AntiEntropyBuckets == 0 {
+		cfg.AntiEntropyBuckets = DefaultAntiEntropyBuckets
+	}
+	if cfg.SuspectTimeout == 0 {
+		cfg.SuspectTimeout = DefaultSuspectTimeout
+	}
+	if cfg.EventLogSize == 0 {
+		cfg.EventLogSize = DefaultEventLogSize
+	}
+	if cfg.AuditLogSize == 0 {
+		cfg.AuditLogSize = DefaultAuditLogSize
+	}
+	if cfg.ValueHistorySize == 0 {
+		cfg.ValueHistorySize = DefaultValueHistorySize
+	}
+	if cfg.InboxSize == 0 {
+		cfg.InboxSize = DefaultInboxSize
+	}
+	if cfg.MaxNodeKeys == 0 {
+		cfg.MaxNodeKeys = DefaultMaxNodeKeys
+	}
+	if cfg.TraceCapacity == 0 {
+		cfg.TraceCapacity = DefaultTraceCapacity
+	}
+	if cfg.CompressMinSize == 0 {
+		cfg.CompressMinSize = DefaultCompressMinSize
+	}
+	if cfg.RateBurst == 0 {
+		cfg.RateBurst = int(math.Ceil(cfg.RateLimit))
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = RealClock{}
+	}
+	if cfg.UpdateInterval == 0 {
+		cfg.UpdateInterval = DefaultUpdateInterval
+	}
+	if cfg.Updaters == 0 {
+		cfg.Updaters = 1
+	}
+	if cfg.GossipFanout == 0 {
+		cfg.GossipFanout = 1
+	}
+	if cfg.BandwidthPolicy == "" {
+		cfg.BandwidthPolicy = BandwidthQueue
+	}
+	cfg.Autoscaler = cfg.Autoscaler.withDefaults()
+	cfg.Retry = cfg.Retry.withDefaults(RetryPolicy{
+		MaxAttempts: DefaultRetryAttempts,
+		BaseDelay:   Duration(DefaultRetryBaseDelay),
+		MaxDelay:    Duration(DefaultRetryMaxDelay),
+	})
+
+	started := time.Now()
+	s := &Simulator{
+		rng:         rand.New(rand.NewSource(cfg.Seed)),
+		cfg:         cfg,
+		logger:      cfg.Logger,
+		replicaData: make(map[int]map[string]KVEntry),
+		hints:       make(map[int][]Hint),
+		store:       make(map[int]map[string]string),
+		crdts:       make(map[int]*crdtState),
+		ring:        NewHashRing(cfg.VirtualNodes),
+		heartbeats:  make(map[int]*heartbeatState),
+		raftLogs:    make(map[int][]LogEntry),
+		raftLeader:  -1,
+		leaderID:    -1,
+		tokens:      make(map[int]uint64),
+		fences:      make(map[int]uint64),
+
+		transactions: make(map[int]Transaction),
+		sagas:        make(map[int]Saga),
+		restarts:     make(map[int]*restartState),
+		transfers:    make(map[int]*transfer),
+		linkLoss:     make(map[link]float64),
+		latencyModel: cfg.MessageLatency.clone(),
+		bandwidth:    Bandwidth{Limit: cfg.LinkBandwidth, Policy: cfg.BandwidthPolicy},
+		usage:        resourceUsage{since: cfg.Clock.Now()},
+		autoscaler:   autoscaler{settings: cfg.Autoscaler},
+		topics:       make(map[string]*topicState),
+		inboxes:      make(map[int]*inboxRing),
+		queue:        workQueue{cfg: QueueConfig{Capacity: DefaultQueueCapacity}},
+		history:      make(map[int]*valueRing),
+		epoch:        started.UnixNano(),
+		started:      started,
+		drained:      make(chan struct{}),
+	}
+	if cfg.Telemetry != nil {
+		s.telemetry = newTelemetry(cfg.Telemetry)
+	}
+	s.initTunables()
+	return s
+}
+
+// Init replaces the simulated nodes with count nodes holding random data.
+func (s *Simulator) Init(count int) {
+	s.InitTopology([]Region{{Nodes: count}})
+}
+
+// InitTopology is like Init, but places the nodes in regions: the first
+// regions[0].Nodes nodes in the first region, and so on. The first node is
+// the primary, the last Config.Witnesses nodes short of it are witnesses,
+// and the rest are replicas.
+func (s *Simulator) InitTopology(regions []Region) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	nodes := make([]NodeData, 0, TopologySize(regions))
+	for _, region := range regions {
+		for i := 0; i < region.Nodes; i++ {
+			j := len(nodes)
+			nodes = append(nodes, NodeData{
+				ID:      j,
+				Name:    fmt.Sprintf("Node-%d", j),
+				Value:   s.rng.Intn(100),
+				Status:  StatusUp,
+				Latency: s.Tunables().Latency,
+				Version: 1,
+				Region:  region.Name,
+				Role:    RoleReplica,
+			})
+			nodes[j].tick()
+		}
+	}
+	if len(nodes) > 0 {
+		nodes[0].Role = RolePrimary
+	}
+	for j := max(len(nodes)-s.cfg.Witnesses, 1); j < len(nodes); j++ {
+		nodes[j].Role = RoleWitness
+	}
+	s.reset(nodes, len(nodes))
+	s.initialized.Store(true)
+}
+
+// reset replaces the simulated nodes with nodes and discards all state
+// derived from the previous ones: replicated keys, hints, and expiry,
+// anti-entropy, majority read, and checksum totals, node data stores and
+// CRDTs, partitions, links, latency overrides, messages in flight and traffic
+// and retry counters, message bus topics and inboxes, the work queue's tasks
+// and roles, the load generator, the autoscaler's decisions, lock leases,
+// detector, Raft, fencing, transaction, and saga state, pending restarts and
+// their durations, joins, leaves, and rebalances, the event log, and the
+// value histories, which restart from the nodes' current values. The nodes'
+// checksums are stored afresh, nodes without a role become replicas, and
+// every node becomes active. Node IDs created later start at nextID. The
+// caller must hold s.mu for writing.
+func (s *Simulator) reset(nodes []NodeData, nextID int) {
+	s.nodes = nodes
+	s.version++
+	s.nextID = nextID
+	s.replicaData = make(map[int]map[string]KVEntry)
+	s.kvStamps = make(map[string]kvStamp)
+	s.hints = make(map[int][]Hint)
+	s.hintsDelivered, s.hintsExpired = 0, 0
+	s.kvDeletes, s.kvExpired, s.tombstonesPurged = 0, 0, 0
+	s.disagreements.masked, s.disagreements.unresolved = 0, 0
+	s.checksumRejected = 0
+	s.antiEntropy = AntiEntropyStats{}
+	s.store = make(map[int]map[string]string)
+	s.crdts = make(map[int]*crdtState)
+	s.ring = NewHashRing(s.cfg.VirtualNodes)
+	s.lastRebalance = nil
+	s.groups, s.group = nil, nil
+	s.heartbeats = make(map[int]*heartbeatState)
+	s.raftLogs = make(map[int][]LogEntry)
+	s.committed = nil
+	s.term = 0
+	s.raftLeader = -1
+	s.fencingToken = 0
+	s.tokens = make(map[int]uint64)
+	s.fences = make(map[int]uint64)
+	s.staleWrites = staleWriteLog{}
+	s.transactions = make(map[int]Transaction)
+	s.txDurations = histogram{}
+	s.nextTxID = 0
+	s.sagas = make(map[int]Saga)
+	s.nextSagaID = 0
+	for id := range s.restarts {
+		s.abandonRestart(id)
+	}
+	s.restartDurations = histogram{}
+	s.transfers = make(map[int]*transfer)
+	s.rebalance = nil
+	s.linkLoss = make(map[link]float64)
+	s.delivered, s.dropped = 0, 0
+	s.latencyModel.Overrides = nil
+	s.inFlight = nil
+	s.traffic = trafficStats{}
+	s.retries = nil
+	s.topics = make(map[string]*topicState)
+	s.busPending = nil
+	s.inboxes = make(map[int]*inboxRing)
+	queue := s.queue.cfg
+	queue.Producers, queue.Consumers = nil, nil
+	s.queue = workQueue{cfg: queue}
+	s.loadGen = loadGen{}
+	s.autoscaler = autoscaler{settings: s.autoscaler.settings}
+	s.freeLocks()
+	s.locks = lockTable{}
+	s.history = make(map[int]*valueRing)
+
+	now := time.Now()
+	ids := make([]int, 0, len(nodes))
+	for j := range nodes {
+		if nodes[j].Role == "" {
+			nodes[j].Role = RoleReplica
+		}
+		nodes[j].Membership = MemberActive
+		if nodes[j].Role != RoleWitness {
+			ids = append(ids, nodes[j].ID)
+		}
+		nodes[j].Checksum = s.checksum(j)
+		s.recordValue(j, now)
+	}
+	s.ring.Add(ids...)
+	s.resetEventLog()
+	s.feedMu.Lock()
+	s.wakeWatchers(-1) // The nodes changed without events.
+	s.feedMu.Unlock()
+	s.electLeader()
+}
+
+// Update updates a random node that is up with new data. Nodes that are down
+// are skipped. It only read-locks s.mu, locking the chosen node alone, so
+// updates of different nodes run concurrently; see nodeLock.
+func (s *Simulator) Update() {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	up := s.indicesWithStatus(StatusUp)
+	if len(up) == 0 {
+		return
+	}
+
+	s.rngMu.Lock()
+	index := up[s.rng.Intn(len(up))]
+	value := s.rng.Intn(100)
+	s.rngMu.Unlock()
+
+	lock := s.nodeLock(s.nodes[index].ID)
+	lock.Lock()
+	defer lock.Unlock()
+	s.nodes[index].Value = value
+	s.nodes[index].tick()
+	s.updates.Add(1)
+	s.publish(EventNodeUpdated, index)
+	s.logger.Info("node updated", "node_id", s.nodes[index].ID, "value", s.nodes[index].Value)
+}
+
+// Node returns the node with the given ID and false if no such node exists.
+func (s *Simulator) Node(id int) (NodeData, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	index := s.findNode(id)
+	if index < 0 {
+		return NodeData{}, false
+	}
+	return s.nodeCopy(index), true
+}
+
+// AddNode adds an up node with the given name and value, assigning it the
+// next available ID, and returns it. The node joins the consistent-hash ring
+// and takes over its share of the replicated keys at once.
+func (s *Simulator) AddNode(name string, value int) NodeData {
+	node, _ := s.addNode(name, value, NodeMetadata{}, false)
+	return node
+}
+
+// JoinNode is like AddNode, but the node joins through the membership
+// protocol: it stays off the ring, joining, until the transfer rounds have
+// sent it its share of the keys; see TransferRound.
+func (s *Simulator) JoinNode(name string, value int) NodeData {
+	node, _ := s.addNode(name, value, NodeMetadata{}, true)
+	return node
+}
+
+// addNode implements AddNode, and JoinNode if join is set, placing the node
+// as meta says, and also returns the number of keys moved.
+func (s *Simulator) addNode(name string, value int, meta NodeMetadata, join bool) (NodeData, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.insertNode(name, value, meta, join)
+}
+
+// insertNode implements addNode. The caller must hold s.mu for writing.
+func (s *Simulator) insertNode(name string, value int, meta NodeMetadata, join bool) (NodeData, int) {
+	node := NodeData{
+		ID:      s.nextID,
+		Name:    name,
+		Value:   value,
+		Status:  StatusUp,
+		Latency: s.Tunables().Latency,
+		Region:  meta.Region,
+		Zone:    meta.Zone,
+		Tags:    meta.Tags.clone(),
+		Role:    RoleReplica,
+	}
+	node.tick()
+	s.nextID++
+	if join {
+		return s.joinNode(node)
+	}
+	node.Membership = MemberActive
+	s.nodes = append(s.nodes, node)
+	moved := s.changeMembership(fmt.Sprintf("node %d added", node.ID), func(ring *HashRing) {
+		ring.Add(node.ID)
+	})
+	s.electLeader()
+	s.publish(EventNodeAdded, len(s.nodes)-1)
+	s.logger.Info("node added", "node_id", node.ID, "name", name, "value", value, "keys_moved", moved)
+	return s.nodes[len(s.nodes)-1].clone(), moved
+}
+
+// ErrVersionMismatch means a conditional update named a node version other
+// than the current one.
+var ErrVersionMismatch = errors.New("node version mismatch")
+
+// SetNode sets the name and value of the node with the given ID and refreshes
+// its time. It returns the updated node and false if no such node exists.
+func (s *Simulator) SetNode(id int, name string, value int) (NodeData, bool) {
+	node, err := s.setNode(id, name, value, nil)
+	return node, err == nil
+}
+
+// SetNodeIfVersion is like SetNode, but only updates the node if its Version
+// is version. It returns ErrNodeNotFound if no such node exists, and
+// ErrVersionMismatch, along with the current node, if another update got
+// there first.
+func (s *Simulator) SetNodeIfVersion(id int, name string, value int, version uint64) (NodeData, error) {
+	return s.setNode(id, name, value, &version)
+}
+
+// setNode implements SetNode and SetNodeIfVersion. A nil version updates the
+// node unconditionally.
+func (s *Simulator) setNode(id int, name string, value int, version *uint64) (NodeData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := s.findNode(id)
+	if index < 0 {
+		return NodeData{}, ErrNodeNotFound
+	}
+	if version != nil && s.nodes[index].Version != *version {
+		return s.nodes[index].clone(), ErrVersionMismatch
+	}
+	s.nodes[index].Name = name
+	s.nodes[index].Value = value
+	s.nodes[index].tick()
+	s.publish(EventNodeUpdated, index)
+	s.logger.Info("node set", "node_id", id, "name", name, "value", value)
+	return s.nodes[index].clone(), nil
+}
+
+// RemoveNode removes the node with the given ID. It returns false if no such
+// node exists. The node leaves the consistent-hash ring and hands its
+// replicated keys over to their new replicas at once; LeaveNode hands them
+// over through the membership protocol instead.
+func (s *Simulator) RemoveNode(id int) bool {
+	_, ok := s.removeNode(id)
+	return ok
+}
+
+// removeNode implements RemoveNode and also returns the number of keys moved.
+func (s *Simulator) removeNode(id int) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := s.findNode(id)
+	if index < 0 {
+		return 0, false
+	}
+	s.publish(EventNodeRemoved, index)
+	s.nodes = append(s.nodes[:index], s.nodes[index+1:]...)
+	moved := s.changeMembership(fmt.Sprintf("node %d removed", id), func(ring *HashRing) {
+		ring.Remove(id)
+	})
+	s.forgetNode(id)
+	s.electLeader()
+	s.logger.Info("node removed", "node_id", id, "keys_moved", moved)
+	return moved, true
+}
+
+// forgetNode discards the state kept for the removed node with the given
+// ID. The caller must hold s.mu for writing.
+func (s *Simulator) forgetNode(id int) {
+	s.forgetPartitionMember(id)
+	delete(s.replicaData, id)
+	s.forgetHints(id)
+	delete(s.store, id)
+	delete(s.crdts, id)
+	delete(s.heartbeats, id)
+	delete(s.raftLogs, id)
+	delete(s.tokens, id)
+	delete(s.fences, id)
+	delete(s.history, id)
+	s.forgetLinks(id)
+	s.forgetLatencies(id)
+	s.forgetTraffic(id)
+	s.forgetSubscriber(id)
+	s.forgetQueueNode(id)
+	delete(s.loadGen.nodes, id)
+	s.abandonRestart(id)
+	delete(s.transfers, id)
+}
+
+// Fail marks the node with the given ID as down. It returns the updated node
+// and false if no such node exists.
+func (s *Simulator) Fail(id int) (NodeData, bool) {
+	return s.setStatus(id, StatusDown)
+}
+
+// Recover marks the node with the given ID as up, ending any restart of the
+// node early without reloading its state. It returns the updated node and
+// false if no such node exists.
+func (s *Simulator) Recover(id int) (NodeData, bool) {
+	return s.setStatus(id, StatusUp)
+}
+
+// setStatus sets the status of the node with the given ID.
+func (s *Simulator) setStatus(id int, status string) (NodeData, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := s.findNode(id)
+	if index < 0 {
+		return NodeData{}, false
+	}
+	s.transition(index, status)
+	return s.nodeCopy(index), true
+}
+
+// transition sets the status of the node at index and records the failure or
+// recovery if the status changed. Bringing up a restarting node ends its
+// restart. The caller must hold s.mu for writing.
+func (s *Simulator) transition(index int, status string) {
+	if s.nodes[index].Status == status {
+		return
+	}
+
+	s.abandonRestart(s.nodes[index].ID)
+	s.nodes[index].Status = status
+	switch status {
+	case StatusDown:
+		s.failures++
+	case StatusUp:
+		s.recoveries++
+	}
+	s.electLeader()
+	if status == StatusDown {
+		s.publish(EventNodeFailed, index)
+		s.logger.Warn("node failed", "node_id", s.nodes[index].ID, "value", s.nodes[index].Value)
+	} else {
+		s.publish(EventNodeRecovered, index)
+		s.logger.Info("node recovered", "node_id", s.nodes[index].ID, "value", s.nodes[index].Value)
+	}
+}
+
+// Snapshot returns a copy of the current nodes.
+func (s *Simulator) Snapshot() []NodeData {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.snapshot()
+}
+
+// StartUpdater runs Config.Updaters workers, each updating a random node once
+// per interval on its own ticker, until ctx is cancelled. The interval is
+// replaced by Tunables.UpdateInterval once SetTunables changes it. Each
+// interval is a tick of any trace being recorded. Workers updating different
+// nodes don't wait for each other; see Update. It blocks until every worker
+// has returned, so callers typically run it in its own goroutine.
+func (s *Simulator) StartUpdater(ctx context.Context, interval time.Duration) {
+	s.updaterRunning.Store(true)
+	defer s.updaterRunning.Store(false)
+
+	var wg sync.WaitGroup
+	for i := 0; i < s.cfg.Updaters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// The first worker alone advances the trace, so a tick still
+			// spans one interval however many workers run.
+			s.runUpdater(ctx, interval, i == 0)
+		}()
+	}
+	wg.Wait()
+}
+
+// runUpdater is one worker of StartUpdater. If traceTicks is set, it starts
+// the next trace tick before each update, and after it samples the nodes'
+// resources, lets the autoscaler act on them, and samples the nodes for
+// TickSamples.
+func (s *Simulator) runUpdater(ctx context.Context, interval time.Duration, traceTicks bool) {
+	ticker := s.newIntervalTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.changed():
+			ticker.refresh()
+		case <-ticker.C():
+			if traceTicks {
+				s.traceTick()
+			}
+			s.Update()
+			if traceTicks {
+				s.ResourceRound()
+				s.AutoscaleRound()
+				s.sampleTick()
+			}
+		}
+	}
+}
+
+// UpdateInterval returns the interval the updater, chaos, and replay loops
+// are meant to tick at.
+func (s *Simulator) UpdateInterval() time.Duration {
+	return time.Duration(s.Tunables().UpdateInterval)
+}
+
+// Mode returns the simulation mode.
+func (s *Simulator) Mode() string {
+	if s.cfg.Mode == "" {
+		return ModeIndependent
+	}
+	return s.cfg.Mode
+}
+
+// Drain marks the simulator as shutting down so that it reports itself as not
+// ready, letting load balancers stop routing traffic to it. It also ends any
+// open event streams and releases any blocked watches, which would otherwise
+// keep the server from shutting down.
+func (s *Simulator) Drain() {
+	if s.draining.CompareAndSwap(false, true) {
+		close(s.drained)
+	}
+}
+
+// Ready reports whether the simulator has been initialized, its updater is
+// running, and it is not draining.
+func (s *Simulator) Ready() bool {
+	return s.initialized.Load() && s.updaterRunning.Load() && !s.draining.Load()
+}
+
+// indicesWithStatus returns the indices of all nodes with the given status.
+// The caller must hold s.mu.
+func (s *Simulator) indicesWithStatus(status string) []int {
+	indices := make([]int, 0, len(s.nodes))
+	for i := range s.nodes {
+		if s.nodes[i].Status == status {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+// findNode returns the index of the node with the given ID, or -1 if no such
+// node exists. The caller must hold s.mu.
+func (s *Simulator) findNode(id int) int {
+	for i := range s.nodes {
+		if s.nodes[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
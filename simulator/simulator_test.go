@@ -0,0 +1,428 @@
+package simulator
+
+import (
+	"context"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testNodeCount is the number of nodes most tests initialize.
+const testNodeCount = 5
+
+// TestMain silences the simulator's logging so test output stays readable.
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// TestInit tests that Init creates the requested number of nodes.
+func TestInit(t *testing.T) {
+	s := New(Config{})
+	for _, count := range []int{1, 5, 50, 500} {
+		s.Init(count)
+
+		if len(s.nodes) != count {
+			t.Errorf("Init(%d): expected %d nodes, but got %d", count, count, len(s.nodes))
+		}
+		if s.nextID != count {
+			t.Errorf("Init(%d): expected next ID %d, but got %d", count, count, s.nextID)
+		}
+	}
+}
+
+// TestUpdate tests the behavior of the Update method.
+func TestUpdate(t *testing.T) {
+	// Initialize test data.
+	s := New(Config{})
+	s.Init(testNodeCount)
+
+	// Store the initial state of the nodes.
+	initialNodes := make([]NodeData, len(s.nodes))
+	copy(initialNodes, s.nodes)
+
+	// Call the Update method.
+	s.Update()
+
+	// Check if at least one node has been updated.
+	updated := false
+	for i := range s.nodes {
+		if !reflect.DeepEqual(s.nodes[i], initialNodes[i]) {
+			updated = true
+			break
+		}
+	}
+
+	if !updated {
+		t.Error("No node was updated by the Update method")
+	}
+}
+
+// TestUpdateSkipsDownNodes tests that Update never modifies a node that is
+// down.
+func TestUpdateSkipsDownNodes(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	for id := 1; id < testNodeCount; id++ {
+		s.Fail(id)
+	}
+
+	before := s.Snapshot()
+	for i := 0; i < 50; i++ {
+		s.Update()
+	}
+	after := s.Snapshot()
+
+	for i := 1; i < testNodeCount; i++ {
+		if !reflect.DeepEqual(before[i], after[i]) {
+			t.Errorf("Down node %d was updated", after[i].ID)
+		}
+	}
+	if updateCount(s) != 50 {
+		t.Errorf("Expected 50 updates of the remaining up node, but got %d", updateCount(s))
+	}
+
+	// With every node down, Update does nothing.
+	s.Fail(0)
+	s.Update()
+	if updateCount(s) != 50 {
+		t.Errorf("Expected no updates with every node down, but got %d", updateCount(s)-50)
+	}
+}
+
+// TestSnapshot tests that Snapshot returns a copy that callers may modify
+// without affecting the simulator.
+func TestSnapshot(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+
+	snapshot := s.Snapshot()
+	if !reflect.DeepEqual(snapshot, s.nodes) {
+		t.Fatalf("Snapshot does not match nodes")
+	}
+
+	snapshot[0].Value = -1
+	if s.nodes[0].Value == -1 {
+		t.Errorf("Modifying the snapshot modified the simulator")
+	}
+}
+
+// valueSequence initializes a Simulator with the given seed, performs a number
+// of updates, and returns the node values observed after each step.
+func valueSequence(seed int64, updates int) [][]int {
+	s := New(Config{Seed: seed})
+	s.Init(testNodeCount)
+
+	var sequence [][]int
+	for i := 0; i <= updates; i++ {
+		if i > 0 {
+			s.Update()
+		}
+		values := make([]int, 0, testNodeCount)
+		for _, node := range s.Snapshot() {
+			values = append(values, node.Value)
+		}
+		sequence = append(sequence, values)
+	}
+	return sequence
+}
+
+// TestSeedDeterminism tests that simulators with the same seed produce the
+// same node values and update sequences, and that different seeds diverge.
+func TestSeedDeterminism(t *testing.T) {
+	const updates = 50
+
+	first := valueSequence(42, updates)
+	second := valueSequence(42, updates)
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("Expected identical value sequences for the same seed")
+	}
+
+	other := valueSequence(43, updates)
+	if reflect.DeepEqual(first, other) {
+		t.Errorf("Expected different value sequences for different seeds")
+	}
+}
+
+// updateCount returns the number of updates s has performed so far.
+func updateCount(s *Simulator) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return int(s.updates.Load())
+}
+
+// TestStartUpdater tests that StartUpdater keeps updating nodes until its
+// context is cancelled, and stops within one tick afterwards.
+func TestStartUpdater(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+
+	const interval = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.StartUpdater(ctx, interval)
+	}()
+
+	// Wait for a few updates to happen.
+	start := updateCount(s)
+	deadline := time.Now().Add(2 * time.Second)
+	for updateCount(s)-start < 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("StartUpdater did not perform any updates")
+		}
+		time.Sleep(interval)
+	}
+
+	cancelled := updateCount(s)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("StartUpdater did not return after cancellation")
+	}
+
+	// At most the tick already in flight may complete after cancellation.
+	stopped := updateCount(s)
+	if stopped-cancelled > 1 {
+		t.Errorf("Expected at most one update after cancellation, but got %d", stopped-cancelled)
+	}
+
+	// No further updates may happen once StartUpdater has returned.
+	time.Sleep(5 * interval)
+	if got := updateCount(s); got != stopped {
+		t.Errorf("Expected no updates after cancellation, but got %d more", got-stopped)
+	}
+}
+
+// TestConcurrentUpdaters tests that every updater worker updates a node on
+// each tick of the simulation clock.
+func TestConcurrentUpdaters(t *testing.T) {
+	const workers, ticks = 4, 5
+	clock := NewVirtualClock(time.Unix(0, 0))
+	clock.Pause()
+	s := New(Config{Clock: clock, Updaters: workers})
+	s.Init(testNodeCount)
+	if got := s.UpdateInterval(); got != DefaultUpdateInterval {
+		t.Errorf("Expected the default update interval, got %v", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.StartUpdater(ctx, time.Second)
+	}()
+	waitFor(t, func() bool { return tickerCount(clock) == workers })
+
+	for tick := 1; tick <= ticks; tick++ {
+		if err := clock.Step(); err != nil {
+			t.Fatalf("Step failed: %v", err)
+		}
+		waitFor(t, func() bool { return updateCount(s) == tick*workers })
+	}
+	cancel()
+	<-done
+	if got := s.Stats().Updates; got != ticks*workers {
+		t.Errorf("Expected %d updates, got %d", ticks*workers, got)
+	}
+	if tickerCount(clock) != 0 {
+		t.Errorf("Expected every worker to stop its ticker")
+	}
+}
+
+// TestNodeLocks tests that a node being updated doesn't hold up reads of
+// other nodes, while reads of the whole cluster wait for the update.
+func TestNodeLocks(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+
+	// Hold node 1's lock as an update in progress does.
+	lock := s.nodeLock(1)
+	s.mu.RLock()
+	lock.Lock()
+	s.mu.RUnlock()
+
+	if _, ok := s.Node(3); !ok {
+		t.Fatalf("Expected node 3 to be readable")
+	}
+	snapshot := make(chan []NodeData)
+	go func() { snapshot <- s.Snapshot() }()
+	select {
+	case <-snapshot:
+		t.Fatal("Expected Snapshot to wait for the update to node 1")
+	case <-time.After(20 * time.Millisecond):
+	}
+	lock.Unlock()
+	if nodes := <-snapshot; len(nodes) != testNodeCount {
+		t.Errorf("Expected %d nodes, got %d", testNodeCount, len(nodes))
+	}
+}
+
+// TestConcurrentUpdatesAndReads runs updates alongside the read endpoints so
+// the race detector can check that reads lock the nodes they look at.
+func TestConcurrentUpdatesAndReads(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	stop := make(chan struct{})
+	var updaters sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		updaters.Add(1)
+		go func() {
+			defer updaters.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					s.Update()
+				}
+			}
+		}()
+	}
+
+	paths := []string{
+		"/nodes", "/nodes?sort=value", "/nodes/export", "/nodes/1", "/nodes/1/history", "/nodes/1/clock",
+		"/causality?a=1&b=2", "/leader", "/convergence", "/stats", "/metrics", "/events/history", "/events/export",
+	}
+	var wg sync.WaitGroup
+	for _, path := range paths {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				expectCode(t, doRequest(t, h, "GET", path, ""), http.StatusOK)
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	updaters.Wait()
+}
+
+// TestSimulatorsAreIndependent tests that two Simulator instances running
+// concurrently do not share nodes or update counts.
+func TestSimulatorsAreIndependent(t *testing.T) {
+	a := New(Config{})
+	a.Init(3)
+	b := New(Config{})
+	b.Init(7)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for _, sim := range []*Simulator{a, b} {
+		wg.Add(1)
+		go func(sim *Simulator) {
+			defer wg.Done()
+			sim.StartUpdater(ctx, time.Millisecond)
+		}(sim)
+	}
+
+	// Mutate a through its API while both updaters are running.
+	handler := a.Handler()
+	for i := 0; i < 20; i++ {
+		req, err := http.NewRequest("POST", "/nodes", strings.NewReader(`{"name":"extra","value":1}`))
+		if err != nil {
+			t.Fatalf("Failed to create test request: %v", err)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status code %d, but got %d", http.StatusCreated, rr.Code)
+		}
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	if got := len(a.Snapshot()); got != 23 {
+		t.Errorf("Expected a to have 23 nodes, but got %d", got)
+	}
+	if got := len(b.Snapshot()); got != 7 {
+		t.Errorf("Expected b to have 7 nodes, but got %d", got)
+	}
+	for _, node := range b.Snapshot() {
+		if node.Name == "extra" {
+			t.Errorf("Node created on a leaked into b: %+v", node)
+		}
+	}
+	if updateCount(a) == 0 || updateCount(b) == 0 {
+		t.Errorf("Expected both simulators to perform updates, got a=%d b=%d", updateCount(a), updateCount(b))
+	}
+}
+
+// BenchmarkConcurrentAccess measures 16 updaters writing random nodes while
+// 16 readers fetch single nodes of a 256-node cluster, with every 64th read
+// fetching the whole cluster as GET /nodes does. The global-lock case wraps
+// every call in one RWMutex, as the nodes were guarded before they had locks
+// of their own.
+func BenchmarkConcurrentAccess(b *testing.B) {
+	const workers, nodes = 16, 256
+	for _, bc := range []struct {
+		name   string
+		global bool
+	}{
+		{"global-lock", true},
+		{"node-locks", false},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			s := New(Config{Seed: 1, Logger: slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError}))})
+			s.Init(nodes)
+			var global sync.RWMutex
+			write, read := s.Update, func(i int) {
+				if i%64 == 0 {
+					s.Snapshot()
+				} else {
+					s.Node(i % nodes)
+				}
+			}
+			if bc.global {
+				update, get := write, read
+				write = func() {
+					global.Lock()
+					defer global.Unlock()
+					update()
+				}
+				read = func(i int) {
+					global.RLock()
+					defer global.RUnlock()
+					get(i)
+				}
+			}
+
+			var wg sync.WaitGroup
+			b.ResetTimer()
+			for w := 0; w < workers; w++ {
+				wg.Add(2)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < b.N/workers; i++ {
+						write()
+					}
+				}()
+				go func() {
+					defer wg.Done()
+					for i := 0; i < b.N/workers; i++ {
+						read(w*31 + i)
+					}
+				}()
+			}
+			wg.Wait()
+		})
+	}
+}
@@ -0,0 +1,5 @@
+// Package simulatorpb holds the Protocol Buffers messages and gRPC service of
+// the simulator's gRPC API, generated from simulator.proto.
+package simulatorpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative simulator.proto
@@ -0,0 +1,253 @@
+package simulator
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// maxStaleWrites is the number of stale writes GET /splitbrain lists.
+const maxStaleWrites = 100
+
+// What happened to a write of a deposed leader.
+const (
+	StaleRejected   = "rejected"    // A replica that had seen a higher fencing token refused it.
+	StaleRolledBack = "rolled_back" // It was stored, then replaced by a write under a higher token.
+)
+
+// Errors returned by KVPutFenced.
+var (
+	// ErrStaleToken means a write carried a fencing token lower than one a
+	// replica it was sent to has already seen.
+	ErrStaleToken = errors.New("stale fencing token")
+
+	// ErrNoFencingToken means a write went through a node that has never
+	// led and so holds no fencing token.
+	ErrNoFencingToken = errors.New("node holds no fencing token")
+)
+
+// StaleWrite describes a write of a deposed leader that one replica rejected
+// or rolled back.
+type StaleWrite struct {
+	Key     string    `json:"key"`
+	Replica int       `json:"replica"`
+	Token   uint64    `json:"token"` // Fencing token of the stale write.
+	Fence   uint64    `json:"fence"` // Higher token the replica had seen or was given.
+	Outcome string    `json:"outcome"`
+	Time    time.Time `json:"time"`
+}
+
+// staleWriteLog keeps the most recent stale writes and counts them by
+// outcome.
+type staleWriteLog struct {
+	recent     []StaleWrite
+	rejected   uint64
+	rolledBack uint64
+}
+
+// FencedLeader describes a current leader and the side of the partition it
+// leads.
+type FencedLeader struct {
+	ID    int    `json:"id"`
+	Token uint64 `json:"token"` // Fencing token issued when it was elected.
+	Side  []int  `json:"side"`  // IDs of the nodes it can reach, itself included.
+}
+
+// SplitBrainStatus describes the current leaders and the stale writes the
+// replicated store has fenced off.
+type SplitBrainStatus struct {
+	Enabled     bool           `json:"enabled"` // Whether every side of a partition elects a leader.
+	Token       uint64         `json:"token"`   // Last fencing token issued.
+	Leaders     []FencedLeader `json:"leaders"` // More than one during a split brain, highest token first.
+	Rejected    uint64         `json:"rejected"`
+	RolledBack  uint64         `json:"rolled_back"`
+	StaleWrites []StaleWrite   `json:"stale_writes"` // The most recent, oldest first.
+}
+
+// issueToken issues the next fencing token to the node at index, which has
+// just been elected leader. The caller must hold s.mu for writing.
+func (s *Simulator) issueToken(index int) {
+	s.fencingToken++
+	id := s.nodes[index].ID
+	s.tokens[id] = s.fencingToken
+	s.logger.Info("leader elected", "node_id", id, "token", s.fencingToken)
+}
+
+// side returns the side of the partition the node with the given ID is on:
+// its group, or a side of its own if it is in none. The caller must hold
+// s.mu.
+func (s *Simulator) side(id int) int {
+	if s.group == nil {
+		return 0
+	}
+	if g, ok := s.group[id]; ok {
+		return g
+	}
+	return -1 - id
+}
+
+// splitBrainLeaders returns the indices of the nodes leading each side of the
+// partition, in index order. A leader that can still lead keeps its side; if
+// a side holds several, as once a partition heals, the one holding the
+// highest fencing token stays and the others are demoted. A side without one
+// elects the node with the lowest ID that can lead. The caller must hold s.mu.
+func (s *Simulator) splitBrainLeaders() []int {
+	best := make(map[int]int)
+	for i := range s.nodes {
+		if !s.canLead(i) {
+			continue
+		}
+		side := s.side(s.nodes[i].ID)
+		if j, ok := best[side]; !ok || s.leadsOver(i, j) {
+			best[side] = i
+		}
+	}
+
+	leaders := make([]int, 0, len(best))
+	for _, i := range best {
+		leaders = append(leaders, i)
+	}
+	sort.Ints(leaders)
+	for i := range s.nodes {
+		if s.nodes[i].Leader && s.canLead(i) && best[s.side(s.nodes[i].ID)] != i {
+			winner := s.nodes[best[s.side(s.nodes[i].ID)]].ID
+			s.logger.Info("deposed leader demoted", "node_id", s.nodes[i].ID, "token", s.tokens[s.nodes[i].ID], "leader", winner, "leader_token", s.tokens[winner])
+		}
+	}
+	return leaders
+}
+
+// leadsOver reports whether the node at index a rather than the one at index
+// b leads their side: a current leader over any other node, a higher
+// fencing token between leaders, and otherwise the lower ID. The caller must
+// hold s.mu.
+func (s *Simulator) leadsOver(a, b int) bool {
+	na, nb := &s.nodes[a], &s.nodes[b]
+	switch {
+	case na.Leader != nb.Leader:
+		return na.Leader
+	case na.Leader:
+		return s.tokens[na.ID] > s.tokens[nb.ID]
+	}
+	return na.ID < nb.ID
+}
+
+// recordStaleWrite records w, which happened now. The caller must hold s.mu
+// for writing.
+func (s *Simulator) recordStaleWrite(w StaleWrite) {
+	w.Time = time.Now()
+	log := &s.staleWrites
+	if w.Outcome == StaleRejected {
+		log.rejected++
+	} else {
+		log.rolledBack++
+	}
+	log.recent = append(log.recent, w)
+	if len(log.recent) > maxStaleWrites {
+		log.recent = log.recent[len(log.recent)-maxStaleWrites:]
+	}
+	s.logger.Warn("stale write fenced", "key", w.Key, "replica", w.Replica, "token", w.Token, "fence", w.Fence, "outcome", w.Outcome)
+}
+
+// KVPutFenced writes value for key through the node with the given ID, as
+// its leader would: to W random up replicas of the key that the node can
+// reach, carrying token, or the fencing token the node was last issued if
+// token is 0, and expiring after ttl as with KVPutTTL. A replica that has
+// stored a write under a higher token rejects it, and then nothing is
+// written. Since copies under a higher token win
+// over newer versions, a deposed leader's write that got through on its side
+// of a partition is rolled back once the sides merge. It returns
+// ErrNodeNotFound if no such node exists, ErrNodeDown if it is down,
+// ErrNoFencingToken if it has never led and token is 0, an error wrapping
+// ErrQuorumUnavailable if it reaches fewer than W up replicas, and one
+// wrapping ErrStaleToken if a replica rejects the write.
+func (s *Simulator) KVPutFenced(key, value string, id int, token uint64, ttl time.Duration) (KVResult, error) {
+	return s.kvPutFenced(nil, key, value, id, token, ttl)
+}
+
+// kvPutFenced is KVPutFenced, tracing the write with t, coordinated by the
+// node with the given ID.
+func (s *Simulator) kvPutFenced(t *tracer, key, value string, id int, token uint64, ttl time.Duration) (KVResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := s.findNode(id)
+	switch {
+	case index < 0:
+		return KVResult{}, ErrNodeNotFound
+	case s.nodes[index].Status != StatusUp:
+		return KVResult{}, ErrNodeDown
+	}
+	if token == 0 {
+		token = s.tokens[id]
+	}
+	if token == 0 {
+		return KVResult{}, ErrNoFencingToken
+	}
+
+	now := s.cfg.Clock.Now()
+	targets, err := s.quorum(key, s.cfg.W, id)
+	if err != nil {
+		t.record(0, "kv.put", id, now, now, err)
+		return KVResult{}, err
+	}
+	root, answered := s.traceQuorum(t, "kv.put", "replica.write", id, targets, now)
+	var fence uint64
+	for _, replica := range targets {
+		if f := s.fences[replica]; f > token {
+			s.recordStaleWrite(StaleWrite{Key: key, Replica: replica, Token: token, Fence: f, Outcome: StaleRejected})
+			fence = max(fence, f)
+		}
+	}
+	if fence > 0 {
+		err := fmt.Errorf("%w: token %d, replicas have seen %d", ErrStaleToken, token, fence)
+		t.end(root, answered, err)
+		return KVResult{Key: key, Replicas: targets}, err
+	}
+
+	entry := s.kvEntry(value, token, ttl)
+	for _, replica := range targets {
+		s.storeReplica(replica, key, entry)
+	}
+	s.addHints(key, entry, targets)
+	s.shipWrite(key, entry)
+	return KVResult{Key: key, Value: value, Version: entry.Version, Replicas: targets, Expires: entry.Expires}, nil
+}
+
+// SplitBrain returns the current leaders and the stale writes fenced off.
+func (s *Simulator) SplitBrain() SplitBrainStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	status := SplitBrainStatus{
+		Enabled:     s.cfg.SplitBrain && s.Mode() != ModeRaft,
+		Token:       s.fencingToken,
+		Leaders:     []FencedLeader{},
+		Rejected:    s.staleWrites.rejected,
+		RolledBack:  s.staleWrites.rolledBack,
+		StaleWrites: append([]StaleWrite{}, s.staleWrites.recent...),
+	}
+	for i := range s.nodes {
+		if !s.nodes[i].Leader {
+			continue
+		}
+		id := s.nodes[i].ID
+		leader := FencedLeader{ID: id, Token: s.tokens[id], Side: []int{}}
+		for _, node := range s.nodes {
+			if s.reachable(id, node.ID) || node.ID == id {
+				leader.Side = append(leader.Side, node.ID)
+			}
+		}
+		status.Leaders = append(status.Leaders, leader)
+	}
+	sort.Slice(status.Leaders, func(i, j int) bool { return status.Leaders[i].Token > status.Leaders[j].Token })
+	return status
+}
+
+// getSplitBrain handles HTTP requests for the current leaders and the stale
+// writes fenced off.
+func (s *Simulator) getSplitBrain(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.SplitBrain())
+}
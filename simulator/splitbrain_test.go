@@ -0,0 +1,80 @@
+package simulator
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestSplitBrain tests that both sides of a partition elect a leader, that
+// healing it demotes the leader with the lower fencing token, and that only
+// the writes of the leader with the higher token survive.
+func TestSplitBrain(t *testing.T) {
+	s := New(Config{Seed: 1, N: 3, R: 1, W: 1, SplitBrain: true})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	if err := s.SetPartition([][]int{{0, 1}, {2, 3, 4}}); err != nil {
+		t.Fatalf("SetPartition failed: %v", err)
+	}
+	var status SplitBrainStatus
+	decodeBody(t, doRequest(t, h, "GET", "/splitbrain", ""), &status)
+	if len(status.Leaders) != 2 || status.Leaders[0].ID != 2 || status.Leaders[0].Token != 2 || status.Leaders[1].ID != 0 || status.Leaders[1].Token != 1 {
+		t.Fatalf("Expected node 2 with token 2 and node 0 with token 1 to lead, got %+v", status.Leaders)
+	}
+	if side := status.Leaders[0].Side; len(side) != 3 {
+		t.Errorf("Expected node 2 to lead a side of 3 nodes, got %v", side)
+	}
+
+	// Pick a key with replicas on both sides, so both leaders can write it.
+	key := ""
+	for k := 0; key == ""; k++ {
+		sides := map[bool]bool{}
+		for _, id := range s.Locate(fmt.Sprintf("key-%d", k)) {
+			sides[id < 2] = true
+		}
+		if len(sides) == 2 {
+			key = fmt.Sprintf("key-%d", k)
+		}
+	}
+
+	// The deposed leader writes last, so its write has the higher version.
+	expectCode(t, doRequest(t, h, "PUT", "/kv/"+key, `{"value":"new","leader":2}`), http.StatusOK)
+	expectCode(t, doRequest(t, h, "PUT", "/kv/"+key, `{"value":"old","leader":0}`), http.StatusOK)
+
+	s.HealPartition()
+	if got := leaderID(t, h); got != 2 {
+		t.Fatalf("Expected node 2 to stay leader after the heal, got %d", got)
+	}
+	s.ReplicationRound()
+	info, err := s.KVReplicas(key)
+	if err != nil || !info.InSync {
+		t.Fatalf("Expected the replicas to converge, got %+v and %v", info, err)
+	}
+	for _, replica := range info.Replicas {
+		if replica.Value != "new" {
+			t.Errorf("Expected only the write under token 2 to survive, got %+v", replica)
+		}
+	}
+
+	// The deposed leader's token is now behind every replica's fence.
+	expectCode(t, doRequest(t, h, "PUT", "/kv/"+key, `{"value":"late","leader":0}`), http.StatusConflict)
+	expectCode(t, doRequest(t, h, "PUT", "/kv/"+key, `{"value":"late","token":1}`), http.StatusBadRequest)
+	status = s.SplitBrain()
+	if len(status.Leaders) != 1 || status.Rejected == 0 || status.RolledBack == 0 {
+		t.Errorf("Expected one leader and both rejected and rolled-back writes, got %+v", status)
+	}
+	body := doRequest(t, h, "GET", "/metrics", "").Body.String()
+	for _, want := range []string{"sim_leaders 1", fmt.Sprintf(`sim_stale_writes_total{outcome="rejected"} %d`, status.Rejected)} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q", want)
+		}
+	}
+
+	// A new leader takes the next token.
+	s.Fail(2)
+	if got := s.SplitBrain(); got.Leaders[0].ID != 0 || got.Leaders[0].Token != 3 {
+		t.Errorf("Expected node 0 to lead with token 3, got %+v", got.Leaders)
+	}
+}
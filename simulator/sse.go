@@ -0,0 +1,91 @@
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// sseKeepAlive is how often an idle /events stream sends a comment so that
+// proxies don't close the connection.
+var sseKeepAlive = 15 * time.Second
+
+// streamEvents handles HTTP requests to stream node changes as Server-Sent
+// Events. Each event carries its sequence number as the SSE id, so a client
+// that reconnects with a Last-Event-ID header first receives the recent
+// events it missed.
+func (s *Simulator) streamEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "Streaming is not supported")
+		return
+	}
+
+	header := r.Header.Get("Last-Event-ID")
+	var lastID uint64
+	if header != "" {
+		id, err := strconv.ParseUint(header, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid Last-Event-ID")
+			return
+		}
+		lastID = id
+	}
+
+	// Subscribe while holding the event feed lock so no event falls between
+	// the backlog and the live stream.
+	s.feedMu.Lock()
+	events := s.events.subscribe()
+	var backlog []Event
+	if header != "" {
+		backlog = s.eventsSince(lastID)
+	}
+	s.feedMu.Unlock()
+	defer s.events.unsubscribe(events)
+
+	w.Header().Set("Content-Type", mediaSSE)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	for _, e := range backlog {
+		if err := writeSSE(w, e); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.drained:
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-events:
+			if !ok {
+				s.logger.Warn("dropped slow event stream client", "remote_addr", r.RemoteAddr)
+				return
+			}
+			if err := writeSSE(w, e); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// writeSSE writes e to w in Server-Sent Events format.
+func writeSSE(w http.ResponseWriter, e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.Seq, e.Type, data)
+	return err
+}
@@ -0,0 +1,172 @@
+package simulator
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sseEvent is one event read from a Server-Sent Events stream.
+type sseEvent struct {
+	id, event string
+	data      Event
+}
+
+// openStream connects to /events on server, optionally resuming after
+// lastID, and returns a function reading the next event. Comments are
+// returned as events of type "comment".
+func openStream(t *testing.T, server *httptest.Server, lastID string) func() sseEvent {
+	t.Helper()
+
+	req, err := http.NewRequest("GET", server.URL+"/events", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected Content-Type text/event-stream, got %q", ct)
+	}
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	return func() sseEvent {
+		t.Helper()
+
+		var e sseEvent
+		for {
+			var line string
+			select {
+			case l, ok := <-lines:
+				if !ok {
+					t.Fatal("Stream closed unexpectedly")
+				}
+				line = l
+			case <-time.After(2 * time.Second):
+				t.Fatal("Timed out waiting for an event")
+			}
+
+			switch {
+			case line == "":
+				return e
+			case strings.HasPrefix(line, ":"):
+				e.event = "comment"
+			case strings.HasPrefix(line, "id: "):
+				e.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				e.event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e.data); err != nil {
+					t.Fatalf("Failed to unmarshal event data %q: %v", line, err)
+				}
+			}
+		}
+	}
+}
+
+// TestEventStream tests that /events streams changes in order and resumes
+// from Last-Event-ID.
+func TestEventStream(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	server := httptest.NewServer(s.Handler())
+	t.Cleanup(server.Close)
+
+	next := openStream(t, server, "")
+	s.SetNode(1, "Node-1", 10)
+	s.Fail(2)
+	s.Recover(2)
+
+	want := []string{EventNodeUpdated, EventNodeFailed, EventNodeRecovered}
+	for i, eventType := range want {
+		e := next()
+		if e.event != eventType || e.data.Type != eventType {
+			t.Errorf("Event %d: expected %s, got %s", i, eventType, e.event)
+		}
+		if wantID := string(rune('1' + i)); e.id != wantID || e.data.Seq != uint64(i+1) {
+			t.Errorf("Event %d: expected id %s, got %s (seq %d)", i, wantID, e.id, e.data.Seq)
+		}
+	}
+
+	// A client resuming after event 1 first receives events 2 and 3, then
+	// live events.
+	resumed := openStream(t, server, "1")
+	for _, wantID := range []string{"2", "3"} {
+		if e := resumed(); e.id != wantID {
+			t.Errorf("Expected resumed event %s, got %s", wantID, e.id)
+		}
+	}
+	s.AddNode("extra", 1)
+	if e := resumed(); e.id != "4" || e.event != EventNodeAdded {
+		t.Errorf("Expected live event 4 of type %s, got %s of type %s", EventNodeAdded, e.id, e.event)
+	}
+}
+
+// TestEventStreamKeepAlive tests that an idle stream sends keep-alive
+// comments.
+func TestEventStreamKeepAlive(t *testing.T) {
+	defer func(d time.Duration) { sseKeepAlive = d }(sseKeepAlive)
+	sseKeepAlive = 10 * time.Millisecond
+
+	s := New(Config{})
+	s.Init(testNodeCount)
+	server := httptest.NewServer(s.Handler())
+	t.Cleanup(server.Close)
+
+	if e := openStream(t, server, "")(); e.event != "comment" {
+		t.Errorf("Expected a keep-alive comment, got %+v", e)
+	}
+
+	req := httptest.NewRequest("GET", "/events", nil)
+	req.Header.Set("Last-Event-ID", "abc")
+	rr := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, but got %d", http.StatusBadRequest, rr.Code)
+	}
+}
+
+// TestEventStreamEndsOnDrain tests that draining the simulator ends open
+// streams so graceful shutdown isn't held up.
+func TestEventStreamEndsOnDrain(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	server := httptest.NewServer(s.Handler())
+	t.Cleanup(server.Close)
+
+	resp, err := http.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		io.Copy(io.Discard, resp.Body)
+	}()
+	s.Drain()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Stream stayed open after Drain")
+	}
+}
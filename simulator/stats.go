@@ -0,0 +1,136 @@
+package simulator
+
+import (
+	"math"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// ClusterStats summarizes the whole cluster in one response, so dashboards
+// need not fetch every node.
+type ClusterStats struct {
+	Nodes        int        `json:"nodes"`
+	Up           int        `json:"up"`
+	Down         int        `json:"down"`
+	Suspected    int        `json:"suspected"`
+	Value        ValueStats `json:"value"`
+	OldestUpdate time.Time  `json:"oldest_update"`  // Earliest Time of any node.
+	NewestUpdate time.Time  `json:"newest_update"`  // Latest Time of any node.
+	Updates      int        `json:"updates"`        // Updates made by the background updater.
+	Uptime       float64    `json:"uptime_seconds"` // Time since the Simulator was created.
+}
+
+// ValueStats describes the distribution of node values. It is all zeros for
+// an empty cluster.
+type ValueStats struct {
+	Min    int     `json:"min"`
+	Max    int     `json:"max"`
+	Mean   float64 `json:"mean"`
+	Median float64 `json:"median"` // The mean of the middle two values for an even count.
+	P95    int     `json:"p95"`    // The nearest-rank 95th percentile.
+}
+
+// Stats returns statistics of every node. The locks are only held to copy
+// the values and times out; sorting them happens after they are released.
+func (s *Simulator) Stats() ClusterStats {
+	s.mu.RLock()
+	s.rlockNodes()
+	stats := ClusterStats{Nodes: len(s.nodes), Updates: int(s.updates.Load())}
+	values := make([]int, len(s.nodes))
+	times := make([]time.Time, len(s.nodes))
+	for i, node := range s.nodes {
+		values[i], times[i] = node.Value, node.Time
+		if node.Status == StatusUp {
+			stats.Up++
+		} else {
+			stats.Down++
+		}
+		if node.Suspected {
+			stats.Suspected++
+		}
+	}
+	s.runlockNodes()
+	s.mu.RUnlock()
+
+	stats.Uptime = time.Since(s.started).Seconds()
+	stats.Value = valueStats(values)
+	for i, t := range times {
+		if i == 0 || t.Before(stats.OldestUpdate) {
+			stats.OldestUpdate = t
+		}
+		if i == 0 || t.After(stats.NewestUpdate) {
+			stats.NewestUpdate = t
+		}
+	}
+	return stats
+}
+
+// valueStats describes values, sorting it in place.
+func valueStats(values []int) ValueStats {
+	n := len(values)
+	if n == 0 {
+		return ValueStats{}
+	}
+	slices.Sort(values)
+
+	sum := 0
+	for _, v := range values {
+		sum += v
+	}
+	median := float64(values[n/2])
+	if n%2 == 0 {
+		median = float64(values[n/2-1]+values[n/2]) / 2
+	}
+	return ValueStats{
+		Min:    values[0],
+		Max:    values[n-1],
+		Mean:   float64(sum) / float64(n),
+		Median: median,
+		P95:    values[int(math.Ceil(0.95*float64(n)))-1],
+	}
+}
+
+// latencySamples is the number of latencies a durationRing keeps.
+const latencySamples = 1024
+
+// durationRing is a ring buffer of the latencySamples most recent latencies.
+type durationRing struct {
+	samples []time.Duration
+	next    int // Index to overwrite once the buffer is full.
+}
+
+// add records d, evicting the oldest latency if the ring is full.
+func (r *durationRing) add(d time.Duration) {
+	if len(r.samples) < latencySamples {
+		r.samples = append(r.samples, d)
+		return
+	}
+	r.samples[r.next] = d
+	r.next = (r.next + 1) % len(r.samples)
+}
+
+// LatencyPercentiles holds nearest-rank percentiles of a set of latencies.
+// It is all zeros for an empty set.
+type LatencyPercentiles struct {
+	P50 Duration `json:"p50"`
+	P95 Duration `json:"p95"`
+	P99 Duration `json:"p99"`
+	Max Duration `json:"max"`
+}
+
+// latencyPercentiles describes latencies, sorting it in place.
+func latencyPercentiles(latencies []time.Duration) LatencyPercentiles {
+	n := len(latencies)
+	if n == 0 {
+		return LatencyPercentiles{}
+	}
+	slices.Sort(latencies)
+	rank := func(p float64) Duration { return Duration(latencies[int(math.Ceil(p*float64(n)))-1]) }
+	return LatencyPercentiles{P50: rank(0.5), P95: rank(0.95), P99: rank(0.99), Max: Duration(latencies[n-1])}
+}
+
+// getStats handles HTTP requests to retrieve cluster-wide statistics.
+func (s *Simulator) getStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Stats())
+}
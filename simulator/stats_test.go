@@ -0,0 +1,65 @@
+package simulator
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// TestStats tests the cluster statistics of nodes with known values and
+// times.
+func TestStats(t *testing.T) {
+	s := New(Config{})
+	s.Init(20)
+	s.Update()
+	s.Fail(5)
+	s.Fail(6)
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.mu.Lock()
+	for i := range s.nodes {
+		// Values 1 to 20, with node 19 updated first and node 0 last.
+		s.nodes[i].Value = i + 1
+		s.nodes[i].Time = base.Add(time.Duration(19-i) * time.Minute)
+	}
+	s.nodes[3].Suspected = true
+	s.mu.Unlock()
+
+	rr := doRequest(t, s.Handler(), "GET", "/stats", "")
+	expectCode(t, rr, http.StatusOK)
+	var stats ClusterStats
+	decodeBody(t, rr, &stats)
+	if stats.Nodes != 20 || stats.Up != 18 || stats.Down != 2 || stats.Suspected != 1 || stats.Updates != 1 {
+		t.Errorf("Unexpected counts %+v", stats)
+	}
+	if want := (ValueStats{Min: 1, Max: 20, Mean: 10.5, Median: 10.5, P95: 19}); stats.Value != want {
+		t.Errorf("Expected value stats %+v, got %+v", want, stats.Value)
+	}
+	if !stats.OldestUpdate.Equal(base) || !stats.NewestUpdate.Equal(base.Add(19*time.Minute)) {
+		t.Errorf("Expected updates between %v and %v, got %v and %v", base, base.Add(19*time.Minute), stats.OldestUpdate, stats.NewestUpdate)
+	}
+	if stats.Uptime <= 0 {
+		t.Errorf("Expected a positive uptime, got %v", stats.Uptime)
+	}
+}
+
+// TestValueStats tests the statistics of odd, single, and empty sets of
+// values.
+func TestValueStats(t *testing.T) {
+	tests := []struct {
+		values []int
+		want   ValueStats
+	}{
+		{[]int{5, 1, 9, 3, 7}, ValueStats{Min: 1, Max: 9, Mean: 5, Median: 5, P95: 9}},
+		{[]int{42}, ValueStats{Min: 42, Max: 42, Mean: 42, Median: 42, P95: 42}},
+		{nil, ValueStats{}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.values), func(t *testing.T) {
+			if got := valueStats(tt.values); got != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
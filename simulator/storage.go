@@ -0,0 +1,289 @@
+package simulator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Buckets of Config.Store.
+const (
+	bucketNodes  = "nodes"  // The nodes, by ID.
+	bucketBase   = "base"   // The nodes before the oldest retained event, by ID.
+	bucketEvents = "events" // The retained event log, by sequence number.
+)
+
+// ErrNoStore means the simulator was created without Config.Store.
+var ErrNoStore = errors.New("persisting state requires a store")
+
+// storeOp is a change queued to be written to Config.Store.
+type storeOp struct {
+	event   Event       // Appended to the event log, or evicted from it if evicted is set.
+	evicted bool        // Whether event was evicted into the base.
+	reset   *storeState // If set, the whole state, replacing the store's contents.
+}
+
+// storeState is everything the simulator keeps in Config.Store.
+type storeState struct {
+	nodes, base []NodeData
+	events      []Event
+}
+
+// storeQueue holds the changes yet to be written to Config.Store. It has its
+// own lock, so the simulator queues changes while holding s.mu and writes
+// them to the store without it.
+type storeQueue struct {
+	mu      sync.Mutex
+	pending []storeOp
+	ready   chan struct{} // Signalled when changes are queued; nil until needed.
+	writeMu sync.Mutex    // Held while writing, so changes reach the store in order.
+}
+
+// readyChan returns the channel signalled when changes are queued. The
+// caller must hold q.mu.
+func (q *storeQueue) readyChan() chan struct{} {
+	if q.ready == nil {
+		q.ready = make(chan struct{}, 1)
+	}
+	return q.ready
+}
+
+// push queues op. A reset supersedes the changes queued before it.
+func (q *storeQueue) push(op storeOp) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if op.reset != nil {
+		q.pending = nil
+	}
+	q.pending = append(q.pending, op)
+	select {
+	case q.readyChan() <- struct{}{}:
+	default:
+	}
+}
+
+// queueStore queues op to be written to Config.Store, if set. The caller
+// must hold s.mu for writing or s.feedMu, so changes are queued in the order
+// they were made.
+func (s *Simulator) queueStore(op storeOp) {
+	if s.cfg.Store != nil {
+		s.persist.push(op)
+	}
+}
+
+// queueStoreReset queues the nodes and event log as they are now to replace
+// the contents of Config.Store, if set. The caller must hold s.mu for
+// writing, or for reading along with the node locks and s.feedMu.
+func (s *Simulator) queueStoreReset() {
+	if s.cfg.Store == nil {
+		return
+	}
+	s.persist.push(storeOp{reset: &storeState{
+		nodes:  cloneNodes(s.nodes),
+		base:   cloneNodes(s.eventBase),
+		events: append([]Event{}, s.eventLog...),
+	}})
+}
+
+// StartPersist writes the changes to the nodes and the event log to
+// Config.Store as they are made, until ctx is cancelled. The writes happen
+// here, without holding the simulator's locks, so a slow disk delays
+// persistence rather than the simulation. Changes that publish no events,
+// such as Raft terms, are only written by SyncStore, which callers
+// typically call once this returns. It returns at once without a
+// Config.Store, and otherwise blocks, so callers typically run it in its own
+// goroutine.
+func (s *Simulator) StartPersist(ctx context.Context) {
+	if s.cfg.Store == nil {
+		return
+	}
+	for {
+		s.persist.mu.Lock()
+		ready := s.persist.readyChan()
+		s.persist.mu.Unlock()
+
+		if err := s.flushStore(); err != nil {
+			s.logger.Error("failed to persist state", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ready:
+		}
+	}
+}
+
+// SyncStore queues the nodes and the event log as they are now to replace
+// the contents of Config.Store and returns once every queued change has
+// been written. It returns ErrNoStore without a Config.Store.
+func (s *Simulator) SyncStore() error {
+	if s.cfg.Store == nil {
+		return ErrNoStore
+	}
+	s.mu.RLock()
+	s.rlockNodes()
+	s.feedMu.Lock()
+	s.queueStoreReset()
+	s.feedMu.Unlock()
+	s.runlockNodes()
+	s.mu.RUnlock()
+	return s.flushStore()
+}
+
+// flushStore writes the queued changes to Config.Store, returning the first
+// error. A change that fails is dropped.
+func (s *Simulator) flushStore() error {
+	q := &s.persist
+	q.writeMu.Lock()
+	defer q.writeMu.Unlock()
+	q.mu.Lock()
+	batch := q.pending
+	q.pending = nil
+	q.mu.Unlock()
+
+	var first error
+	for _, op := range batch {
+		if err := s.writeStore(op); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// writeStore writes op to Config.Store. An event is stored under its
+// sequence number and its node is put or deleted alongside; an evicted one
+// is deleted and its node applied to the base instead.
+func (s *Simulator) writeStore(op storeOp) error {
+	store := s.cfg.Store
+	if op.reset != nil {
+		nodes, base, events := make(map[string]any), make(map[string]any), make(map[string]any)
+		for _, node := range op.reset.nodes {
+			nodes[nodeKey(node.ID)] = node
+		}
+		for _, node := range op.reset.base {
+			base[nodeKey(node.ID)] = node
+		}
+		for _, e := range op.reset.events {
+			events[eventKey(e.Seq)] = e
+		}
+		for bucket, values := range map[string]map[string]any{bucketNodes: nodes, bucketBase: base, bucketEvents: events} {
+			if err := replaceBucket(store, bucket, values); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	e := op.event
+	bucket := bucketNodes
+	if op.evicted {
+		bucket = bucketBase
+		if err := store.Delete(bucketEvents, eventKey(e.Seq)); err != nil {
+			return err
+		}
+	} else if err := putJSON(store, bucketEvents, eventKey(e.Seq), e); err != nil {
+		return err
+	}
+	if e.Type == EventNodeRemoved {
+		return store.Delete(bucket, nodeKey(e.Node.ID))
+	}
+	return putJSON(store, bucket, nodeKey(e.Node.ID), e.Node)
+}
+
+// replaceBucket makes values, by key, the only contents of bucket.
+func replaceBucket(store Store, bucket string, values map[string]any) error {
+	items, err := store.List(bucket)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if _, ok := values[item.Key]; !ok {
+			if err := store.Delete(bucket, item.Key); err != nil {
+				return err
+			}
+		}
+	}
+	for key, value := range values {
+		if err := putJSON(store, bucket, key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// putJSON puts value in bucket under key, encoded as JSON.
+func putJSON(store Store, bucket, key string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return store.Put(bucket, key, data)
+}
+
+// nodeKey and eventKey return the keys of a node and an event, padded so
+// they sort numerically.
+func nodeKey(id int) string      { return fmt.Sprintf("%010d", id) }
+func eventKey(seq uint64) string { return fmt.Sprintf("%020d", seq) }
+
+// loadBucket decodes every value in bucket into a T, ordered by key.
+func loadBucket[T any](store Store, bucket string) ([]T, error) {
+	items, err := store.List(bucket)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]T, len(items))
+	for i, item := range items {
+		if err := json.Unmarshal(item.Value, &values[i]); err != nil {
+			return nil, fmt.Errorf("%s %s: %v", bucket, item.Key, err)
+		}
+	}
+	return values, nil
+}
+
+// Resume replaces the nodes and the event log with those in Config.Store,
+// as the previous run left them, and reports whether the store held any
+// nodes; nothing changes if it held none. Like RestoreSnapshot, it discards
+// state derived from the old nodes, such as replicated keys, and event
+// sequence numbers continue from the stored log's. It returns ErrNoStore
+// without a Config.Store.
+func (s *Simulator) Resume() (bool, error) {
+	if s.cfg.Store == nil {
+		return false, ErrNoStore
+	}
+	nodes, err := loadBucket[NodeData](s.cfg.Store, bucketNodes)
+	if err != nil || len(nodes) == 0 {
+		return false, err
+	}
+	base, err := loadBucket[NodeData](s.cfg.Store, bucketBase)
+	if err != nil {
+		return false, err
+	}
+	events, err := loadBucket[Event](s.cfg.Store, bucketEvents)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	nextID := 0
+	for _, node := range append(nodes, base...) {
+		nextID = max(nextID, node.ID+1)
+	}
+	for _, e := range events {
+		nextID = max(nextID, e.Node.ID+1)
+		s.eventSeq = max(s.eventSeq, e.Seq)
+	}
+	s.reset(nodes, nextID)
+	// Keep the events reset published, such as for a new leader, after
+	// the stored ones.
+	s.eventBase = base
+	s.eventLog = append(events, s.eventLog...)
+	s.trimEventLog()
+	s.queueStoreReset()
+	s.mu.Unlock()
+	s.initialized.Store(true)
+
+	s.logger.Info("state resumed", "nodes", len(nodes), "events", len(events))
+	return true, nil
+}
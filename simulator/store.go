@@ -0,0 +1,319 @@
+package simulator
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Storage backends, as named by the -storage flag.
+const (
+	StorageMemory = "memory"
+	StorageFile   = "file"
+	StorageBolt   = "bolt" // Alias of StorageFile.
+)
+
+// ErrStoreClosed means a Store was used after Close.
+var ErrStoreClosed = errors.New("store is closed")
+
+// Store holds values under keys in named buckets. The simulator keeps its
+// nodes and event log in one, through Config.Store; see StartPersist.
+// Implementations must be safe for concurrent use.
+type Store interface {
+	// Get returns the value of key in bucket, and false if there is none.
+	Get(bucket, key string) ([]byte, bool, error)
+
+	// Put sets the value of key in bucket, creating the bucket if needed.
+	Put(bucket, key string, value []byte) error
+
+	// Delete removes key from bucket. Deleting a missing key is not an
+	// error.
+	Delete(bucket, key string) error
+
+	// List returns every key in bucket and its value, ordered by key.
+	List(bucket string) ([]StoreItem, error)
+
+	// Close releases the store. It may not be used afterwards.
+	Close() error
+}
+
+// StoreItem is a key of a Store bucket and its value.
+type StoreItem struct {
+	Key   string
+	Value []byte
+}
+
+// buckets is the contents of a store, by bucket and key.
+type buckets map[string]map[string][]byte
+
+// put sets key in bucket to value, which it takes ownership of.
+func (b buckets) put(bucket, key string, value []byte) {
+	if b[bucket] == nil {
+		b[bucket] = make(map[string][]byte)
+	}
+	b[bucket][key] = value
+}
+
+// list returns a copy of the items in bucket, ordered by key.
+func (b buckets) list(bucket string) []StoreItem {
+	items := make([]StoreItem, 0, len(b[bucket]))
+	for key, value := range b[bucket] {
+		items = append(items, StoreItem{Key: key, Value: bytes.Clone(value)})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Key < items[j].Key })
+	return items
+}
+
+// size returns the number of keys in every bucket.
+func (b buckets) size() int {
+	n := 0
+	for _, keys := range b {
+		n += len(keys)
+	}
+	return n
+}
+
+// memoryStore is a Store that keeps everything in memory, so nothing
+// survives a restart.
+type memoryStore struct {
+	mu     sync.Mutex
+	data   buckets
+	closed bool
+}
+
+// NewMemoryStore returns an empty Store held in memory.
+func NewMemoryStore() Store {
+	return &memoryStore{data: make(buckets)}
+}
+
+func (m *memoryStore) Get(bucket, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, false, ErrStoreClosed
+	}
+	value, ok := m.data[bucket][key]
+	return bytes.Clone(value), ok, nil
+}
+
+func (m *memoryStore) Put(bucket, key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrStoreClosed
+	}
+	m.data.put(bucket, key, bytes.Clone(value))
+	return nil
+}
+
+func (m *memoryStore) Delete(bucket, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrStoreClosed
+	}
+	delete(m.data[bucket], key)
+	return nil
+}
+
+func (m *memoryStore) List(bucket string) ([]StoreItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil, ErrStoreClosed
+	}
+	return m.data.list(bucket), nil
+}
+
+func (m *memoryStore) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+	return nil
+}
+
+// fileCompactSlack is how many records a file store appends beyond twice
+// its live keys before it compacts.
+const fileCompactSlack = 1024
+
+// fileRecord is one line of a file store, putting or deleting a key.
+type fileRecord struct {
+	Bucket  string `json:"b"`
+	Key     string `json:"k"`
+	Value   []byte `json:"v,omitempty"`
+	Deleted bool   `json:"d,omitempty"`
+}
+
+// fileStore is a Store backed by a single file of JSON records, one per
+// line, each putting or deleting a key. It keeps the contents in memory,
+// appends every change to the file, and rewrites the file with only the
+// live keys when it is opened and whenever the dead records outnumber them.
+type fileStore struct {
+	mu      sync.Mutex
+	path    string
+	f       *os.File // Nil once closed.
+	data    buckets
+	records int // Records in the file.
+}
+
+// OpenFileStore opens the Store in the file at path, creating it if it
+// doesn't exist. A record cut short by a crash at the end of the file is
+// dropped; a corrupt record anywhere else is an error.
+func OpenFileStore(path string) (Store, error) {
+	s := &fileStore{path: path, data: make(buckets)}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for line := 1; scanner.Scan(); line++ {
+		var r fileRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			if line == bytes.Count(data, []byte("\n"))+1 {
+				break // The last record was never completely written.
+			}
+			return nil, fmt.Errorf("%s: line %d: %v", path, line, err)
+		}
+		if r.Deleted {
+			delete(s.data[r.Bucket], r.Key)
+		} else {
+			s.data.put(r.Bucket, r.Key, r.Value)
+		}
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// compact rewrites the file with a record for every live key, through a
+// temporary file so it is never left half-written, and reopens it for
+// appending. The caller must hold s.mu unless s is being opened.
+func (s *fileStore) compact() error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	bucketNames := make([]string, 0, len(s.data))
+	for bucket := range s.data {
+		bucketNames = append(bucketNames, bucket)
+	}
+	sort.Strings(bucketNames)
+	for _, bucket := range bucketNames {
+		for _, item := range s.data.list(bucket) {
+			if err := encoder.Encode(fileRecord{Bucket: bucket, Key: item.Key, Value: item.Value}); err != nil {
+				return err
+			}
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if s.f != nil {
+		s.f.Close()
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		s.f = nil
+		return err
+	}
+	s.f, err = os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0)
+	s.records = s.data.size()
+	return err
+}
+
+// write appends r to the file, compacting it if the dead records
+// outnumber the live keys. The caller must hold s.mu.
+func (s *fileStore) write(r fileRecord) error {
+	if s.f == nil {
+		return ErrStoreClosed
+	}
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err := s.f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	s.records++
+	if s.records > 2*s.data.size()+fileCompactSlack {
+		return s.compact()
+	}
+	return nil
+}
+
+func (s *fileStore) Get(bucket, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return nil, false, ErrStoreClosed
+	}
+	value, ok := s.data[bucket][key]
+	return bytes.Clone(value), ok, nil
+}
+
+func (s *fileStore) Put(bucket, key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return ErrStoreClosed
+	}
+	value = bytes.Clone(value)
+	s.data.put(bucket, key, value)
+	return s.write(fileRecord{Bucket: bucket, Key: key, Value: value})
+}
+
+func (s *fileStore) Delete(bucket, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return ErrStoreClosed
+	}
+	if _, ok := s.data[bucket][key]; !ok {
+		return nil
+	}
+	delete(s.data[bucket], key)
+	return s.write(fileRecord{Bucket: bucket, Key: key, Deleted: true})
+}
+
+func (s *fileStore) List(bucket string) ([]StoreItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return nil, ErrStoreClosed
+	}
+	return s.data.list(bucket), nil
+}
+
+// Close flushes the file to disk and closes it.
+func (s *fileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return ErrStoreClosed
+	}
+	err := s.f.Sync()
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+	s.f = nil
+	return err
+}
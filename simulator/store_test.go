@@ -0,0 +1,193 @@
+package simulator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestStore tests the Store operations on every backend.
+func TestStore(t *testing.T) {
+	backends := map[string]func(t *testing.T) Store{
+		StorageMemory: func(*testing.T) Store { return NewMemoryStore() },
+		StorageFile: func(t *testing.T) Store {
+			store, err := OpenFileStore(filepath.Join(t.TempDir(), "sim.db"))
+			if err != nil {
+				t.Fatalf("OpenFileStore failed: %v", err)
+			}
+			return store
+		},
+	}
+	for name, open := range backends {
+		store := open(t)
+		for _, put := range []StoreItem{{"b", []byte("2")}, {"a", []byte("1")}, {"c", nil}, {"b", []byte("3")}} {
+			if err := store.Put("nodes", put.Key, put.Value); err != nil {
+				t.Fatalf("%s: Put failed: %v", name, err)
+			}
+		}
+		store.Put("events", "a", []byte("other bucket"))
+		if err := store.Delete("nodes", "c"); err != nil {
+			t.Errorf("%s: Delete failed: %v", name, err)
+		}
+		if err := store.Delete("nodes", "missing"); err != nil {
+			t.Errorf("%s: expected deleting a missing key to succeed, got %v", name, err)
+		}
+
+		if value, ok, err := store.Get("nodes", "b"); err != nil || !ok || string(value) != "3" {
+			t.Errorf("%s: expected b to be 3, got %q %v %v", name, value, ok, err)
+		}
+		if _, ok, err := store.Get("nodes", "c"); err != nil || ok {
+			t.Errorf("%s: expected c to be deleted, got %v %v", name, ok, err)
+		}
+		items, err := store.List("nodes")
+		if want := []StoreItem{{"a", []byte("1")}, {"b", []byte("3")}}; err != nil || !reflect.DeepEqual(items, want) {
+			t.Errorf("%s: expected %q, got %q %v", name, want, items, err)
+		}
+		if items, err := store.List("empty"); err != nil || len(items) != 0 {
+			t.Errorf("%s: expected an empty bucket, got %q %v", name, items, err)
+		}
+
+		if err := store.Close(); err != nil {
+			t.Errorf("%s: Close failed: %v", name, err)
+		}
+		if err := store.Put("nodes", "a", nil); err != ErrStoreClosed {
+			t.Errorf("%s: expected ErrStoreClosed after Close, got %v", name, err)
+		}
+	}
+}
+
+// TestFileStoreReopen tests that a file store holds its contents across
+// reopening, compacted to the live keys, and drops a record cut short at the
+// end of the file.
+func TestFileStoreReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sim.db")
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileStore failed: %v", err)
+	}
+	for i := 0; i < 3*fileCompactSlack; i++ {
+		store.Put("events", eventKey(uint64(i)), []byte("e"))
+		store.Delete("events", eventKey(uint64(i-1)))
+	}
+	store.Put("nodes", "a", []byte("1"))
+	store.Close()
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"b":"nodes","k":"b","v":`)
+	f.Close()
+
+	store, err = OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("Reopening failed: %v", err)
+	}
+	defer store.Close()
+	nodes, _ := store.List("nodes")
+	events, _ := store.List("events")
+	if len(nodes) != 1 || nodes[0].Key != "a" || len(events) != 1 || events[0].Key != eventKey(3*fileCompactSlack-1) {
+		t.Errorf("Expected node a and the last event, got %q and %q", nodes, events)
+	}
+	data, _ := os.ReadFile(path)
+	if lines := bytes.Count(data, []byte("\n")); lines != 2 {
+		t.Errorf("Expected the file compacted to 2 records, got %d", lines)
+	}
+
+	os.WriteFile(path, []byte("{}\nnot json\n{}\n"), 0o644)
+	if _, err := OpenFileStore(path); err == nil {
+		t.Error("Expected a corrupt record to be rejected")
+	}
+}
+
+// jsonString returns v encoded as JSON.
+func jsonString(t *testing.T, v any) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Failed to encode %v: %v", v, err)
+	}
+	return string(data)
+}
+
+// TestResumeFromFileStore tests that a simulator persisting to a file store
+// resumes, after a restart, with the nodes and event log it had, with event
+// sequence numbers continuing from there.
+func TestResumeFromFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sim.db")
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileStore failed: %v", err)
+	}
+	s := New(Config{Seed: 1, Store: store, EventLogSize: 4})
+	s.Init(testNodeCount)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.StartPersist(ctx)
+	}()
+	s.Fail(0)
+	s.AddNode("extra", 7)
+	s.RemoveNode(2)
+	for i := 0; i < 3; i++ {
+		s.Update()
+	}
+	// Events reach the store as they are published.
+	waitFor(t, func() bool {
+		items, _ := store.List(bucketEvents)
+		return len(items) == 4
+	})
+	cancel()
+	<-done
+	if err := s.SyncStore(); err != nil {
+		t.Fatalf("SyncStore failed: %v", err)
+	}
+	store.Close()
+	nodes := s.Snapshot()
+	events := s.EventHistory(0, MaxHistoryLimit).Events
+
+	store, err = OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("Reopening failed: %v", err)
+	}
+	defer store.Close()
+	restarted := New(Config{Seed: 2, Store: store, EventLogSize: 4})
+	restarted.Init(testNodeCount)
+	resumed, err := restarted.Resume()
+	if err != nil || !resumed {
+		t.Fatalf("Expected to resume, got %v %v", resumed, err)
+	}
+	// Compare as JSON, as stored, which drops monotonic clock readings.
+	if got, want := jsonString(t, restarted.Snapshot()), jsonString(t, nodes); got != want {
+		t.Errorf("Expected the nodes\n%s\nafter a restart, got\n%s", want, got)
+	}
+	if got, want := jsonString(t, restarted.EventHistory(0, MaxHistoryLimit).Events), jsonString(t, events); got != want {
+		t.Errorf("Expected the events\n%s\nafter a restart, got\n%s", want, got)
+	}
+	if _, err := restarted.Replay(); err != nil {
+		t.Errorf("Expected the resumed event log to replay, got %v", err)
+	}
+	if got, want := jsonString(t, restarted.Snapshot()), jsonString(t, nodes); got != want {
+		t.Errorf("Expected replaying the resumed log to rebuild the nodes, got\n%s", got)
+	}
+
+	restarted.Fail(3)
+	if e := restarted.EventHistory(0, MaxHistoryLimit).Events; e[len(e)-1].Seq != events[len(events)-1].Seq+1 {
+		t.Errorf("Expected sequence numbers to continue from %d, got %d", events[len(events)-1].Seq, e[len(e)-1].Seq)
+	}
+
+	// An empty store leaves the nodes alone.
+	fresh := New(Config{Seed: 1, Store: NewMemoryStore()})
+	fresh.Init(testNodeCount)
+	if resumed, err := fresh.Resume(); err != nil || resumed {
+		t.Errorf("Expected nothing to resume, got %v %v", resumed, err)
+	}
+	if _, err := New(Config{Seed: 1}).Resume(); err != ErrNoStore {
+		t.Errorf("Expected ErrNoStore without a store, got %v", err)
+	}
+}
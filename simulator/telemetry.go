@@ -0,0 +1,429 @@
+package simulator
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Telemetry span kinds, as OpenTelemetry numbers them.
+const (
+	SpanKindInternal = 1 // A simulated step of a multi-node operation.
+	SpanKindServer   = 2 // An HTTP request served by the API.
+)
+
+// Telemetry metric kinds.
+const (
+	MetricGauge = "gauge" // A value sampled at export time.
+	MetricSum   = "sum"   // A monotonic total since the simulator started.
+)
+
+// maxTelemetryBacklog is the number of spans queued for export before new
+// ones are dropped, so a collector that is down can't exhaust memory.
+const maxTelemetryBacklog = 4096
+
+// telemetryBatchSize is the number of spans sent in one export.
+const telemetryBatchSize = 512
+
+// ErrNoTelemetry is returned by FlushTelemetry when Config.Telemetry is
+// unset.
+var ErrNoTelemetry = errors.New("telemetry export is disabled")
+
+// TelemetrySpan is a span exported to Config.Telemetry: an HTTP request
+// served by the API, or a simulated step of a multi-node operation it ran.
+// IDs are lowercase hex, as in a W3C traceparent header.
+type TelemetrySpan struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string // "" for a root span.
+	Name         string
+	Kind         int // SpanKindServer or SpanKindInternal.
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]any // Of string, int, and bool values.
+	Error        string         // Why the span failed, or "" if it succeeded.
+}
+
+// TelemetryMetric is a metric exported to Config.Telemetry, with a point
+// per cluster.
+type TelemetryMetric struct {
+	Name        string
+	Description string
+	Unit        string
+	Kind        string    // MetricGauge or MetricSum.
+	Start       time.Time // When a sum started counting.
+	Points      []TelemetryPoint
+}
+
+// TelemetryPoint is one value of a TelemetryMetric.
+type TelemetryPoint struct {
+	Attributes map[string]any
+	Time       time.Time
+	Value      float64
+}
+
+// TelemetryExporter sends spans and metrics to a telemetry backend, such as
+// an OpenTelemetry collector; see NewOTLPExporter.
+type TelemetryExporter interface {
+	ExportSpans(ctx context.Context, spans []TelemetrySpan) error
+	ExportMetrics(ctx context.Context, metrics []TelemetryMetric) error
+}
+
+// telemetry queues the spans of a simulator and the clusters it created for
+// export to Config.Telemetry. A Simulator without an exporter has none, so
+// that the middleware and tracing skip it entirely.
+type telemetry struct {
+	exporter TelemetryExporter
+	export   sync.Mutex // Serializes exports, so queued spans leave in order.
+
+	mu      sync.Mutex
+	spans   []TelemetrySpan         // Spans yet to be exported; guarded by mu.
+	dropped int                     // Spans dropped since the last export; guarded by mu.
+	wake    chan struct{}           // Signalled when spans are queued.
+	samples map[string]updateSample // Updates at the last metric export by cluster; guarded by export.
+}
+
+// updateSample is the update count of a cluster at some time.
+type updateSample struct {
+	at      time.Time
+	updates int64
+}
+
+// newTelemetry returns a queue exporting to exporter.
+func newTelemetry(exporter TelemetryExporter) *telemetry {
+	return &telemetry{
+		exporter: exporter,
+		wake:     make(chan struct{}, 1),
+		samples:  make(map[string]updateSample),
+	}
+}
+
+// queue adds spans to the export queue, dropping them if it is full.
+func (t *telemetry) queue(spans ...TelemetrySpan) {
+	t.mu.Lock()
+	if n := maxTelemetryBacklog - len(t.spans); len(spans) > n {
+		t.dropped += len(spans) - max(n, 0)
+		spans = spans[:max(n, 0)]
+	}
+	t.spans = append(t.spans, spans...)
+	t.mu.Unlock()
+
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+}
+
+// spanContext identifies the span of an HTTP request, stored in its context
+// so the spans of the operations it runs become its children.
+type spanContext struct {
+	traceID string
+	spanID  string
+	arrived time.Time // When the request arrived, by the wall clock.
+}
+
+// telemetrySpanKey is the context key under which the spanContext of a
+// request is stored.
+type telemetrySpanKey struct{}
+
+// spanContextFrom returns the spanContext stored in ctx, and false if there
+// is none.
+func spanContextFrom(ctx context.Context) (spanContext, bool) {
+	sc, ok := ctx.Value(telemetrySpanKey{}).(spanContext)
+	return sc, ok
+}
+
+// newTraceID returns a random trace ID.
+func newTraceID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// newSpanID returns a random span ID.
+func newSpanID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// parseTraceparent returns the trace and parent span IDs of a W3C
+// traceparent header, and false if it is malformed or all zeros.
+func parseTraceparent(header string) (traceID, spanID string, ok bool) {
+	parts := strings.Split(header, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return "", "", false
+	}
+	for _, id := range parts[1:3] {
+		if _, err := hex.DecodeString(id); err != nil || strings.ToLower(id) != id || strings.Trim(id, "0") == "" {
+			return "", "", false
+		}
+	}
+	return parts[1], parts[2], true
+}
+
+// withTelemetry exports a server span of every request next serves, named
+// by the route mux matches it to, continuing the trace of a traceparent
+// header if the request has a valid one. Without Config.Telemetry it
+// returns next itself, adding nothing to requests.
+func (s *Simulator) withTelemetry(mux *http.ServeMux, next http.Handler) http.Handler {
+	if s.telemetry == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sc := spanContext{traceID: newTraceID(), spanID: newSpanID(), arrived: time.Now()}
+		traceID, parent, ok := parseTraceparent(r.Header.Get("traceparent"))
+		if ok {
+			sc.traceID = traceID
+		}
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), telemetrySpanKey{}, sc)))
+		if rec.code == 0 {
+			rec.code = http.StatusOK
+		}
+
+		route := telemetryRoute(mux, r)
+		cluster := s.name()
+		path := r.URL.Path
+		if name, rest, ok := clusterPath(path); ok {
+			cluster, path = name, rest
+		}
+		attrs := map[string]any{
+			"http.request.method":       r.Method,
+			"http.route":                route,
+			"url.path":                  r.URL.Path,
+			"http.response.status_code": rec.code,
+			"request_id":                RequestIDFromContext(r.Context()),
+			"cluster":                   cluster,
+		}
+		if node := auditNode(path); node != nil {
+			attrs["node_id"] = *node
+		}
+		span := TelemetrySpan{
+			TraceID:      sc.traceID,
+			SpanID:       sc.spanID,
+			ParentSpanID: parent,
+			Name:         r.Method + " " + route,
+			Kind:         SpanKindServer,
+			Start:        sc.arrived,
+			End:          time.Now(),
+			Attributes:   attrs,
+		}
+		if rec.code >= http.StatusInternalServerError {
+			span.Error = http.StatusText(rec.code)
+		}
+		s.telemetry.queue(span)
+	})
+}
+
+// telemetryRoute returns the path pattern mux routes r by, that of the
+// cluster's own route under "/clusters/{name}" for a request to a cluster's
+// API, or "unmatched".
+func telemetryRoute(mux *http.ServeMux, r *http.Request) string {
+	prefix := ""
+	_, pattern := mux.Handler(r)
+	if pattern == clusterRoutes {
+		_, rest, _ := clusterPath(r.URL.Path)
+		inner := r.Clone(r.Context())
+		inner.URL.Path, inner.URL.RawPath = rest, ""
+		_, pattern = mux.Handler(inner)
+		prefix = "/clusters/{name}"
+	}
+	if pattern == "" {
+		return "unmatched"
+	}
+	// API routes are registered as "METHOD /path".
+	if _, path, ok := strings.Cut(pattern, " "); ok {
+		pattern = path
+	}
+	return prefix + pattern
+}
+
+// exportTrace queues the spans t collected for export as children of the
+// server span of its request. Their times are on the simulation clock, so
+// they are shifted to start when the request arrived, keeping the simulated
+// latencies between them.
+func (s *Simulator) exportTrace(t *tracer) {
+	sc := t.parent
+	if sc.traceID == "" {
+		sc = spanContext{traceID: newTraceID(), arrived: time.Now()}
+	}
+	shift := sc.arrived.Sub(t.spans[0].Start)
+	ids := make([]string, len(t.spans))
+	spans := make([]TelemetrySpan, len(t.spans))
+	for i, span := range t.spans {
+		ids[i] = newSpanID()
+		parent := sc.spanID
+		if span.Parent != 0 {
+			parent = ids[span.Parent-1]
+		}
+		attrs := map[string]any{
+			"operation":  span.Operation,
+			"cluster":    s.name(),
+			"request_id": t.requestID,
+		}
+		if span.Node != nil {
+			attrs["node_id"] = *span.Node
+		}
+		spans[i] = TelemetrySpan{
+			TraceID:      sc.traceID,
+			SpanID:       ids[i],
+			ParentSpanID: parent,
+			Name:         span.Operation,
+			Kind:         SpanKindInternal,
+			Start:        span.Start.Add(shift),
+			End:          span.End.Add(shift),
+			Attributes:   attrs,
+			Error:        span.Error,
+		}
+	}
+	s.telemetry.queue(spans...)
+}
+
+// StartTelemetry exports queued spans to Config.Telemetry as they are
+// recorded, and the simulator's metrics once per interval, until ctx is
+// cancelled. Exports that fail are logged and not retried. It returns at
+// once if Config.Telemetry is unset, and otherwise blocks, so callers
+// typically run it in its own goroutine.
+func (s *Simulator) StartTelemetry(ctx context.Context, interval time.Duration) {
+	if s.telemetry == nil {
+		return
+	}
+	// Exports go to the real world, so they follow the wall clock rather
+	// than the simulation's.
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.telemetry.wake:
+			if err := s.exportSpans(ctx); err != nil && ctx.Err() == nil {
+				s.logger.Warn("span export failed", "err", err)
+			}
+		case <-ticker.C:
+			if err := s.exportMetrics(ctx); err != nil && ctx.Err() == nil {
+				s.logger.Warn("metric export failed", "err", err)
+			}
+		}
+	}
+}
+
+// FlushTelemetry exports the queued spans and the current metrics to
+// Config.Telemetry, returning the first error. It returns ErrNoTelemetry if
+// Config.Telemetry is unset.
+func (s *Simulator) FlushTelemetry(ctx context.Context) error {
+	if s.telemetry == nil {
+		return ErrNoTelemetry
+	}
+	return errors.Join(s.exportSpans(ctx), s.exportMetrics(ctx))
+}
+
+// exportSpans exports the queued spans in batches of telemetryBatchSize.
+func (s *Simulator) exportSpans(ctx context.Context) error {
+	t := s.telemetry
+	t.export.Lock()
+	defer t.export.Unlock()
+
+	t.mu.Lock()
+	spans, dropped := t.spans, t.dropped
+	t.spans, t.dropped = nil, 0
+	t.mu.Unlock()
+
+	if dropped > 0 {
+		s.logger.Warn("spans dropped from a full export queue", "spans", dropped)
+	}
+	for len(spans) > 0 {
+		batch := spans[:min(len(spans), telemetryBatchSize)]
+		spans = spans[len(batch):]
+		if err := t.exporter.ExportSpans(ctx, batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clusterSample holds the metrics of one cluster at export time.
+type clusterSample struct {
+	name                 string
+	started              time.Time
+	up, down             int
+	updates              int64
+	failures, recoveries int
+}
+
+// sample returns the metrics of s.
+func (s *Simulator) sample() clusterSample {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	c := clusterSample{name: s.name(), started: s.started, updates: s.updates.Load(), failures: s.failures, recoveries: s.recoveries}
+	for _, n := range s.nodes {
+		if n.Status == StatusUp {
+			c.up++
+		} else {
+			c.down++
+		}
+	}
+	return c
+}
+
+// exportMetrics exports the metrics of s and every cluster it created.
+func (s *Simulator) exportMetrics(ctx context.Context) error {
+	t := s.telemetry
+	t.export.Lock()
+	defer t.export.Unlock()
+
+	samples := []clusterSample{s.sample()}
+	s.clusters.mu.Lock()
+	sims := make([]*Simulator, 0, len(s.clusters.clusters))
+	for _, c := range s.clusters.clusters {
+		sims = append(sims, c.sim)
+	}
+	s.clusters.mu.Unlock()
+	for _, sim := range sims {
+		samples = append(samples, sim.sample())
+	}
+	sort.Slice(samples[1:], func(i, j int) bool { return samples[i+1].name < samples[j+1].name })
+
+	now := time.Now()
+	nodes := TelemetryMetric{Name: "sim.nodes", Description: "Number of nodes by status.", Unit: "{node}", Kind: MetricGauge}
+	updates := TelemetryMetric{Name: "sim.updates", Description: "Updates performed by the updater.", Unit: "{update}", Kind: MetricSum, Start: s.started}
+	rate := TelemetryMetric{Name: "sim.update.rate", Description: "Updates per second since the last export.", Unit: "{update}/s", Kind: MetricGauge}
+	failures := TelemetryMetric{Name: "sim.failures", Description: "Transitions of nodes from up to down.", Unit: "{failure}", Kind: MetricSum, Start: s.started}
+	recoveries := TelemetryMetric{Name: "sim.recoveries", Description: "Transitions of nodes from down to up.", Unit: "{recovery}", Kind: MetricSum, Start: s.started}
+	seen := make(map[string]bool, len(samples))
+	for _, c := range samples {
+		seen[c.name] = true
+		cluster := map[string]any{"cluster": c.name}
+		nodes.Points = append(nodes.Points,
+			TelemetryPoint{Attributes: map[string]any{"cluster": c.name, "status": StatusUp}, Time: now, Value: float64(c.up)},
+			TelemetryPoint{Attributes: map[string]any{"cluster": c.name, "status": StatusDown}, Time: now, Value: float64(c.down)})
+		updates.Points = append(updates.Points, TelemetryPoint{Attributes: cluster, Time: now, Value: float64(c.updates)})
+		failures.Points = append(failures.Points, TelemetryPoint{Attributes: cluster, Time: now, Value: float64(c.failures)})
+		recoveries.Points = append(recoveries.Points, TelemetryPoint{Attributes: cluster, Time: now, Value: float64(c.recoveries)})
+
+		// The first export measures the rate since the cluster started.
+		last, ok := t.samples[c.name]
+		if !ok {
+			last = updateSample{at: c.started}
+		}
+		if elapsed := now.Sub(last.at).Seconds(); elapsed > 0 {
+			rate.Points = append(rate.Points, TelemetryPoint{Attributes: cluster, Time: now, Value: float64(c.updates-last.updates) / elapsed})
+		}
+		t.samples[c.name] = updateSample{at: now, updates: c.updates}
+	}
+	for name := range t.samples {
+		if !seen[name] {
+			delete(t.samples, name) // A deleted cluster.
+		}
+	}
+	return t.exporter.ExportMetrics(ctx, []TelemetryMetric{nodes, updates, rate, failures, recoveries})
+}
@@ -0,0 +1,242 @@
+package simulator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryExporter is a TelemetryExporter keeping what it is sent.
+type memoryExporter struct {
+	mu      sync.Mutex
+	spans   []TelemetrySpan
+	metrics [][]TelemetryMetric
+}
+
+func (e *memoryExporter) ExportSpans(ctx context.Context, spans []TelemetrySpan) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *memoryExporter) ExportMetrics(ctx context.Context, metrics []TelemetryMetric) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.metrics = append(e.metrics, metrics)
+	return nil
+}
+
+// exported returns the spans exported so far.
+func (e *memoryExporter) exported() []TelemetrySpan {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]TelemetrySpan(nil), e.spans...)
+}
+
+// TestTelemetrySpans tests that HTTP requests and the operations they run
+// are exported as a tree of spans continuing the caller's trace, with the
+// node, operation, and cluster as attributes.
+func TestTelemetrySpans(t *testing.T) {
+	exp := &memoryExporter{}
+	s := New(Config{Seed: 1, N: 3, W: 3, R: 1, Telemetry: exp})
+	s.Init(testNodeCount)
+	defer s.StopClusters()
+	h := s.Handler()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.StartTelemetry(ctx, time.Hour)
+
+	const traceID, parentID = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	req := httptest.NewRequest("PUT", "/kv/k", strings.NewReader(`{"value":"v"}`))
+	req.Header.Set("traceparent", "00-"+traceID+"-"+parentID+"-01")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	waitFor(t, func() bool { return len(exp.exported()) == 5 })
+
+	spans := exp.exported()
+	byID := make(map[string]TelemetrySpan)
+	for _, span := range spans {
+		byID[span.SpanID] = span
+		if span.TraceID != traceID || span.Attributes["cluster"] != DefaultCluster {
+			t.Errorf("Expected every span in the caller's trace and the default cluster, got %+v", span)
+		}
+	}
+	// The operation's spans are queued before the request finishes.
+	server := spans[len(spans)-1]
+	if server.Name != "PUT /kv/{key}" || server.Kind != SpanKindServer || server.ParentSpanID != parentID || server.Attributes["http.response.status_code"] != http.StatusOK {
+		t.Errorf("Unexpected server span %+v", server)
+	}
+	put := spans[0]
+	if put.Name != "kv.put" || put.Kind != SpanKindInternal || put.ParentSpanID != server.SpanID || put.Attributes["operation"] != "kv.put" {
+		t.Errorf("Expected the write under the request, got %+v", put)
+	}
+	if _, ok := put.Attributes["node_id"].(int); !ok || put.Attributes["request_id"] != server.Attributes["request_id"] {
+		t.Errorf("Expected the coordinator and request ID, got %v", put.Attributes)
+	}
+	for _, span := range spans[1:4] {
+		if span.Name != "replica.write" || byID[span.ParentSpanID].Name != "kv.put" || span.Attributes["node_id"] == nil {
+			t.Errorf("Expected a replica write under the put, got %+v", span)
+		}
+		if span.Start.Before(server.Start) {
+			t.Errorf("Expected %+v to start within the request %+v", span, server)
+		}
+	}
+
+	// Requests naming a node or a cluster carry them.
+	expectCode(t, doRequest(t, h, "POST", "/nodes/2/fail", ""), http.StatusOK)
+	if _, err := s.CreateCluster(ClusterSpec{Name: "east", Nodes: 3, Seed: 1}); err != nil {
+		t.Fatal(err)
+	}
+	expectCode(t, doRequest(t, h, "PUT", "/clusters/east/kv/k", `{"value":"v"}`), http.StatusOK)
+	waitFor(t, func() bool {
+		return len(exp.exported()) > 5 && exp.exported()[len(exp.exported())-1].Attributes["cluster"] == "east"
+	})
+	spans = exp.exported()[5:]
+	if fail := spans[0]; fail.Name != "POST /nodes/{id}/fail" || fail.Attributes["node_id"] != 2 || fail.TraceID == traceID {
+		t.Errorf("Expected a fail of node 2 in a new trace, got %+v", fail)
+	}
+	last := spans[len(spans)-1]
+	if last.Attributes["http.route"] != "/clusters/{name}/kv/{key}" || spans[1].Name != "kv.put" || spans[1].Attributes["cluster"] != "east" || spans[1].ParentSpanID != last.SpanID {
+		t.Errorf("Expected the cluster's write under its request, got %+v", spans)
+	}
+}
+
+// TestTelemetryMetrics tests the node and update metrics of every cluster.
+func TestTelemetryMetrics(t *testing.T) {
+	exp := &memoryExporter{}
+	s := New(Config{Seed: 1, Telemetry: exp})
+	s.Init(testNodeCount)
+	defer s.StopClusters()
+	if _, err := s.CreateCluster(ClusterSpec{Name: "east", Nodes: 3, Seed: 1, Tunables: &Tunables{UpdateInterval: Duration(time.Hour), GossipFanout: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	s.Fail(1)
+	s.Update()
+	s.Update()
+	if err := s.FlushTelemetry(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	values := make(map[string]float64)
+	for _, m := range exp.metrics[0] {
+		for _, p := range m.Points {
+			key := m.Name + "/" + p.Attributes["cluster"].(string)
+			if status, ok := p.Attributes["status"]; ok {
+				key += "/" + status.(string)
+			}
+			values[key] = p.Value
+			if m.Kind == MetricSum && m.Start.IsZero() {
+				t.Errorf("Expected %s to have a start time", m.Name)
+			}
+		}
+	}
+	for key, want := range map[string]float64{
+		"sim.nodes/default/up":   4,
+		"sim.nodes/default/down": 1,
+		"sim.nodes/east/up":      3,
+		"sim.updates/default":    2,
+		"sim.failures/default":   1,
+		"sim.recoveries/default": 0,
+		"sim.updates/east":       0,
+	} {
+		if got, ok := values[key]; !ok || got != want {
+			t.Errorf("%s: expected %v, got %v", key, want, got)
+		}
+	}
+	if values["sim.update.rate/default"] <= 0 {
+		t.Errorf("Expected a positive update rate, got %v", values)
+	}
+}
+
+// TestTelemetryDisabled tests that nothing is traced without an exporter.
+func TestTelemetryDisabled(t *testing.T) {
+	s := New(Config{Seed: 1})
+	s.Init(testNodeCount)
+	if err := s.FlushTelemetry(context.Background()); !errors.Is(err, ErrNoTelemetry) {
+		t.Errorf("Expected ErrNoTelemetry, got %v", err)
+	}
+	s.StartTelemetry(context.Background(), time.Second) // Returns at once.
+
+	var traced bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, traced = spanContextFrom(r.Context())
+	})
+	s.withTelemetry(s.routes(), next).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/nodes", nil))
+	if traced {
+		t.Error("Expected no span without an exporter")
+	}
+}
+
+// TestOTLPExporter tests the OTLP/HTTP JSON payloads posted to a collector.
+func TestOTLPExporter(t *testing.T) {
+	var mu sync.Mutex
+	bodies := make(map[string]map[string]any)
+	status := http.StatusOK
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		var body map[string]any
+		b, _ := io.ReadAll(r.Body)
+		if r.Header.Get("Content-Type") != "application/json" || json.Unmarshal(b, &body) != nil {
+			t.Errorf("Unexpected %s payload %q", r.Header.Get("Content-Type"), b)
+		}
+		bodies[r.URL.Path] = body
+		w.WriteHeader(status)
+	}))
+	defer collector.Close()
+	exp := NewOTLPExporter(collector.URL + "/")
+	ctx := context.Background()
+
+	start := time.Unix(1, 500)
+	err := exp.ExportSpans(ctx, []TelemetrySpan{{
+		TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Name: "kv.put", Kind: SpanKindInternal,
+		Start: start, End: start.Add(time.Second), Attributes: map[string]any{"node_id": 3, "cluster": "east"}, Error: "no quorum",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = exp.ExportMetrics(ctx, []TelemetryMetric{
+		{Name: "sim.updates", Kind: MetricSum, Start: start, Points: []TelemetryPoint{{Time: start, Value: 7}}},
+		{Name: "sim.update.rate", Kind: MetricGauge, Points: []TelemetryPoint{{Time: start, Value: 0.5}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	traces, _ := json.Marshal(bodies["/v1/traces"])
+	metrics, _ := json.Marshal(bodies["/v1/metrics"])
+	mu.Unlock()
+	for _, want := range []string{
+		`"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"DistributedSystemSimulator"}}]}`,
+		`"attributes":[{"key":"cluster","value":{"stringValue":"east"}},{"key":"node_id","value":{"intValue":"3"}}]`,
+		`"startTimeUnixNano":"1000000500"`,
+		`"status":{"code":2,"message":"no quorum"}`,
+	} {
+		if !strings.Contains(string(traces), want) {
+			t.Errorf("Expected %s in the traces %s", want, traces)
+		}
+	}
+	for _, want := range []string{
+		`"sum":{"aggregationTemporality":2,"dataPoints":[{"asDouble":7,"startTimeUnixNano":"1000000500","timeUnixNano":"1000000500"}],"isMonotonic":true}`,
+		`"gauge":{"dataPoints":[{"asDouble":0.5,"timeUnixNano":"1000000500"}]}`,
+	} {
+		if !strings.Contains(string(metrics), want) {
+			t.Errorf("Expected %s in the metrics %s", want, metrics)
+		}
+	}
+
+	mu.Lock()
+	status = http.StatusServiceUnavailable
+	mu.Unlock()
+	if err := exp.ExportSpans(ctx, nil); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("Expected the collector's error, got %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package simulator
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// DefaultTombstoneGrace is how long a deleted or expired key-value entry is
+// kept as a tombstone when Config.TombstoneGrace is unset.
+const DefaultTombstoneGrace = time.Minute
+
+// KVStats counts the keys of the replicated key-value store and the
+// tombstones left by deletes and expiries.
+type KVStats struct {
+	Keys       int      `json:"keys"`       // Keys whose newest copy is live.
+	Tombstones int      `json:"tombstones"` // Replica copies held as tombstones.
+	Deletes    uint64   `json:"deletes"`
+	Expired    uint64   `json:"expired"` // Replica copies expired by their TTL.
+	Purged     uint64   `json:"purged"`  // Tombstones dropped after the grace period.
+	Grace      Duration `json:"grace"`
+}
+
+// live reports whether e is a value a read may return at now: it is not a
+// tombstone, and it has not expired.
+func (e KVEntry) live(now time.Time) bool {
+	return !e.Deleted && (e.Expires == nil || now.Before(*e.Expires))
+}
+
+// wants reports whether the node with the given ID should store entry as its
+// copy of key at now: entry is newer than the node's copy, or the node has
+// none and entry is live. A replica without a copy has nothing to delete, so
+// it is never sent a tombstone or an expired entry. The caller must hold
+// s.mu.
+func (s *Simulator) wants(id int, key string, entry KVEntry, now time.Time) bool {
+	current, ok := s.replicaData[id][key]
+	if !ok {
+		return entry.live(now)
+	}
+	return entry.newer(current)
+}
+
+// StartKVSweeper sweeps expired key-value entries once per interval until ctx
+// is cancelled. It blocks, so callers typically run it in its own goroutine.
+func (s *Simulator) StartKVSweeper(ctx context.Context, interval time.Duration) {
+	ticker := s.cfg.Clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			s.SweepKV()
+		}
+	}
+}
+
+// SweepKV replaces every replica's copy of a key whose TTL has passed on the
+// simulation clock with a tombstone, and drops tombstones once
+// Config.TombstoneGrace has passed since the key was deleted or expired. A
+// tombstone is newer than the copy it replaced, so replication, read repair,
+// and anti-entropy carry it to replicas holding that copy or an older one
+// instead of copying those back. A replica that stays away for the whole
+// grace period can still bring an older copy back. It returns the number of
+// copies expired.
+func (s *Simulator) SweepKV() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.cfg.Clock.Now()
+	expired := 0
+	for id, entries := range s.replicaData {
+		changed := false
+		for key, entry := range entries {
+			switch {
+			case entry.Deleted:
+				if !now.Before(entry.DeletedAt.Add(s.cfg.TombstoneGrace)) {
+					delete(entries, key)
+					s.tombstonesPurged++
+					changed = true
+				}
+			case entry.Expires != nil && !now.Before(*entry.Expires):
+				entry.Value, entry.Deleted, entry.DeletedAt = "", true, entry.Expires
+				entries[key] = entry.sealed()
+				expired++
+				changed = true
+			}
+		}
+		if changed {
+			s.seal(id)
+		}
+	}
+	s.kvExpired += uint64(expired)
+	if expired > 0 {
+		s.logger.Debug("keys expired", "copies", expired)
+	}
+	return expired
+}
+
+// KVDelete deletes key by writing a tombstone to W of its N replicas, chosen
+// as KVPut chooses them, so that the key is gone once the tombstone has
+// reached them all. Like any newer write, the tombstone replaces older
+// copies wherever replication, read repair, anti-entropy, or a hint carries
+// it, and a replica that missed the delete cannot copy the value back. It
+// returns ErrQuorumUnavailable without deleting anything if fewer than W
+// replicas are up.
+func (s *Simulator) KVDelete(key string) (KVResult, error) {
+	return s.kvDelete(nil, key)
+}
+
+// kvDelete is KVDelete, tracing the delete with t, coordinated by the first
+// replica written.
+func (s *Simulator) kvDelete(t *tracer, key string) (KVResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.cfg.Clock.Now()
+	targets, err := s.quorum(key, s.cfg.W, -1)
+	if err != nil {
+		t.record(0, "kv.delete", -1, now, now, err)
+		return KVResult{}, err
+	}
+	s.traceQuorum(t, "kv.delete", "replica.write", targets[0], targets, now)
+
+	entry := s.kvEntry("", s.fencingToken, 0)
+	entry.Deleted, entry.DeletedAt = true, &now
+	entry = entry.sealed()
+	for _, id := range targets {
+		s.storeReplica(id, key, entry)
+	}
+	s.addHints(key, entry, targets)
+	s.shipWrite(key, entry)
+	s.kvDeletes++
+
+	return KVResult{Key: key, Version: entry.Version, Replicas: targets, Deleted: true}, nil
+}
+
+// KVStats returns the number of live keys and tombstones and the delete and
+// expiry totals.
+func (s *Simulator) KVStats() KVStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.kvStats()
+}
+
+// kvStats is KVStats. The caller must hold s.mu.
+func (s *Simulator) kvStats() KVStats {
+	stats := KVStats{Deletes: s.kvDeletes, Expired: s.kvExpired, Purged: s.tombstonesPurged, Grace: Duration(s.cfg.TombstoneGrace)}
+	now := s.cfg.Clock.Now()
+	newest := make(map[string]KVEntry)
+	for _, entries := range s.replicaData {
+		for key, entry := range entries {
+			if entry.Deleted {
+				stats.Tombstones++
+			}
+			if current, ok := newest[key]; !ok || entry.newer(current) {
+				newest[key] = entry
+			}
+		}
+	}
+	for _, entry := range newest {
+		if entry.live(now) {
+			stats.Keys++
+		}
+	}
+	return stats
+}
+
+// deleteKV handles HTTP requests to delete a key from a write quorum of
+// replicas.
+func (s *Simulator) deleteKV(w http.ResponseWriter, r *http.Request) {
+	t := newTracer(r)
+	defer s.keepTrace(t)
+	result, err := s.kvDelete(t, r.PathValue("key"))
+	if err != nil {
+		writeKVError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// getKVStats handles HTTP requests for the key and tombstone counts of the
+// replicated key-value store.
+func (s *Simulator) getKVStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.KVStats())
+}
@@ -0,0 +1,193 @@
+package simulator
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestKVExpiry tests that a value written with a TTL expires on every
+// replica, and that neither replication nor anti-entropy brings back the
+// older copy a replica that missed the write still holds.
+func TestKVExpiry(t *testing.T) {
+	clock := latencyClock(t)
+	s := New(Config{Clock: clock, Seed: 1, N: 3, R: 1, W: 1, TombstoneGrace: 5 * time.Second})
+	s.Init(testNodeCount)
+	h := s.Handler()
+	const key = "session"
+
+	expectCode(t, doRequest(t, h, "PUT", "/kv/"+key, `{"value":"old"}`), http.StatusOK)
+	s.ReplicationRound()
+	s.ReplicationRound()
+	if info, err := s.KVReplicas(key); err != nil || !info.InSync {
+		t.Fatalf("Expected every replica to hold the old value, got %+v and %v", info, err)
+	}
+	for _, query := range []string{"?ttl=0s", "?ttl=soon"} {
+		expectCode(t, doRequest(t, h, "PUT", "/kv/"+key+query, `{"value":"new"}`), http.StatusBadRequest)
+	}
+
+	// One replica is down while the value with a TTL is written and
+	// replicated, so it keeps the old value.
+	var result KVResult
+	rr := doRequest(t, h, "PUT", "/kv/"+key+"?ttl=2s", `{"value":"new"}`)
+	expectCode(t, rr, http.StatusOK)
+	decodeBody(t, rr, &result)
+	if result.Expires == nil || !result.Expires.Equal(clock.Now().Add(2*time.Second)) {
+		t.Fatalf("Expected the write to expire in 2s, got %+v", result)
+	}
+	missed := -1
+	for _, id := range s.Locate(key) {
+		if id != result.Replicas[0] {
+			missed = id
+			break
+		}
+	}
+	s.Fail(missed)
+	s.ReplicationRound()
+	s.ReplicationRound()
+	for _, id := range s.Locate(key) {
+		entry := s.replicaData[id][key]
+		if id != missed && (entry.Expires == nil || !entry.Expires.Equal(*result.Expires)) {
+			t.Errorf("Expected replica %d to carry the expiry, got %+v", id, entry)
+		}
+	}
+	decodeBody(t, doRequest(t, h, "GET", "/kv/"+key, ""), &result)
+	if result.Value != "new" {
+		t.Errorf("Expected the value with a TTL before it expires, got %+v", result)
+	}
+
+	// Once the TTL passes, reads miss and the sweeper leaves tombstones.
+	clock.Step()
+	clock.Step()
+	expectCode(t, doRequest(t, h, "GET", "/kv/"+key, ""), http.StatusNotFound)
+	if got := s.SweepKV(); got != 2 {
+		t.Errorf("Expected 2 copies to expire, got %d", got)
+	}
+
+	// The tombstones win over the old value once the replica is back.
+	s.Recover(missed)
+	for _, id := range s.Locate(key) {
+		if id != missed {
+			if _, err := s.Reconcile(id, missed); err != nil {
+				t.Fatalf("Reconcile failed: %v", err)
+			}
+		}
+	}
+	s.ReplicationRound()
+	info, err := s.KVReplicas(key)
+	if err != nil {
+		t.Fatalf("KVReplicas failed: %v", err)
+	}
+	for _, replica := range info.Replicas {
+		if !replica.Deleted || replica.Value != "" {
+			t.Errorf("Expected replica %d to hold a tombstone, got %+v", replica.ID, replica)
+		}
+	}
+	expectCode(t, doRequest(t, h, "GET", "/kv/"+key, ""), http.StatusNotFound)
+
+	// After the grace period the tombstones are gone too, and syncing
+	// brings nothing back.
+	for i := 0; i < 5; i++ {
+		clock.Step()
+	}
+	s.SweepKV()
+	s.ReplicationRound()
+	s.AntiEntropyRound()
+	if _, err := s.KVReplicas(key); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected the key to be gone from every replica, got %v", err)
+	}
+	body := doRequest(t, h, "GET", "/metrics", "").Body.String()
+	for _, want := range []string{"sim_kv_expired_total 2", "sim_kv_tombstones 0", "sim_kv_tombstones_purged_total 3"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q", want)
+		}
+	}
+}
+
+// TestKVDelete tests that a delete made while a replica is partitioned away
+// stays deleted once the partition heals, and that the tombstones are
+// dropped after the grace period without the value coming back.
+func TestKVDelete(t *testing.T) {
+	clock := latencyClock(t)
+	s := New(Config{Clock: clock, Seed: 1, N: 3, R: 1, W: 1, TombstoneGrace: 5 * time.Second})
+	s.Init(testNodeCount)
+	h := s.Handler()
+	const key = "cart"
+
+	expectCode(t, doRequest(t, h, "PUT", "/kv/"+key, `{"value":"full"}`), http.StatusOK)
+	s.ReplicationRound()
+	s.ReplicationRound()
+	if info, err := s.KVReplicas(key); err != nil || !info.InSync {
+		t.Fatalf("Expected every replica to hold the value, got %+v and %v", info, err)
+	}
+
+	var result KVResult
+	rr := doRequest(t, h, "DELETE", "/kv/"+key, "")
+	expectCode(t, rr, http.StatusOK)
+	decodeBody(t, rr, &result)
+	if !result.Deleted || len(result.Replicas) != 1 {
+		t.Fatalf("Expected a tombstone on one replica, got %+v", result)
+	}
+
+	// Cut off a replica that missed the delete, and sync the rest.
+	lagging := -1
+	for _, id := range s.Locate(key) {
+		if id != result.Replicas[0] {
+			lagging = id
+		}
+	}
+	var others []int
+	for id := 0; id < testNodeCount; id++ {
+		if id != lagging {
+			others = append(others, id)
+		}
+	}
+	if err := s.SetPartition([][]int{{lagging}, others}); err != nil {
+		t.Fatalf("SetPartition failed: %v", err)
+	}
+	s.ReplicationRound()
+	s.ReplicationRound()
+	s.AntiEntropyRound()
+	if entry := s.replicaData[lagging][key]; entry.Deleted || entry.Value != "full" {
+		t.Fatalf("Expected the partitioned replica to keep the value, got %+v", entry)
+	}
+
+	// Once healed, the tombstone wins over the lagging replica's value.
+	s.HealPartition()
+	s.AntiEntropyRound()
+	s.ReplicationRound()
+	s.ReplicationRound()
+	info, err := s.KVReplicas(key)
+	if err != nil {
+		t.Fatalf("KVReplicas failed: %v", err)
+	}
+	for _, replica := range info.Replicas {
+		if !replica.Deleted {
+			t.Errorf("Expected replica %d to hold the tombstone, got %+v", replica.ID, replica)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		expectCode(t, doRequest(t, h, "GET", "/kv/"+key, ""), http.StatusNotFound)
+	}
+	var stats KVStats
+	decodeBody(t, doRequest(t, h, "GET", "/stats/kv", ""), &stats)
+	if stats.Keys != 0 || stats.Tombstones != 3 || stats.Deletes != 1 || stats.Purged != 0 {
+		t.Errorf("Expected 3 tombstones and no keys, got %+v", stats)
+	}
+
+	// Past the grace period the tombstones are purged.
+	for i := 0; i < 5; i++ {
+		clock.Step()
+	}
+	s.SweepKV()
+	s.AntiEntropyRound()
+	s.ReplicationRound()
+	if _, err := s.KVReplicas(key); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("Expected the key to be gone from every replica, got %v", err)
+	}
+	if stats := s.KVStats(); stats.Tombstones != 0 || stats.Purged != 3 {
+		t.Errorf("Expected the 3 tombstones to be purged, got %+v", stats)
+	}
+}
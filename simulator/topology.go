@@ -0,0 +1,266 @@
+package simulator
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Tags are free-form labels on a node, such as "rack": "r1".
+type Tags map[string]string
+
+// clone returns a copy of t that shares no memory with it. A nil t stays nil.
+func (t Tags) clone() Tags {
+	if t == nil {
+		return nil
+	}
+	c := make(Tags, len(t))
+	for k, v := range t {
+		c[k] = v
+	}
+	return c
+}
+
+// tagEntry is the XML encoding of one tag.
+type tagEntry struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// MarshalXML encodes t as one <tag key="key">value</tag> element per tag, in
+// order of key.
+func (t Tags) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	keys := make([]string, 0, len(t))
+	for k := range t {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	entries := make([]tagEntry, len(keys))
+	for i, k := range keys {
+		entries[i] = tagEntry{Key: k, Value: t[k]}
+	}
+	return e.EncodeElement(struct {
+		Entries []tagEntry `xml:"tag"`
+	}{entries}, start)
+}
+
+// UnmarshalXML decodes the encoding produced by MarshalXML.
+func (t *Tags) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var body struct {
+		Entries []tagEntry `xml:"tag"`
+	}
+	if err := d.DecodeElement(&body, &start); err != nil {
+		return err
+	}
+	*t = make(Tags, len(body.Entries))
+	for _, entry := range body.Entries {
+		(*t)[entry.Key] = entry.Value
+	}
+	return nil
+}
+
+// checkTagKey returns an error if key may not name a tag. Keys are matched
+// by ?tag=key:value, so they must be non-empty and free of colons.
+func checkTagKey(key string) error {
+	if key == "" || strings.Contains(key, ":") {
+		return fmt.Errorf("tag key %q must be non-empty and contain no colon", key)
+	}
+	return nil
+}
+
+// NodeMetadata places a node in the simulated topology and labels it. It is
+// accepted alongside the name and value when a node is created.
+type NodeMetadata struct {
+	Region string `json:"region,omitempty"`
+	Zone   string `json:"zone,omitempty"`
+	Tags   Tags   `json:"tags,omitempty"`
+}
+
+// validate returns an error describing the first invalid tag key of m.
+func (m NodeMetadata) validate() error {
+	for key := range m.Tags {
+		if err := checkTagKey(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MetadataPatch changes some of a node's metadata, leaving the rest as it
+// is: a nil Region or Zone is left unchanged, and an empty one clears it.
+// Each tag in Tags is set, or removed if its value is nil.
+type MetadataPatch struct {
+	Region *string            `json:"region,omitempty"`
+	Zone   *string            `json:"zone,omitempty"`
+	Tags   map[string]*string `json:"tags,omitempty"`
+}
+
+// validate returns an error describing the first invalid tag key of p.
+func (p MetadataPatch) validate() error {
+	for key := range p.Tags {
+		if err := checkTagKey(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PatchMetadata applies patch to the metadata of the node with the given
+// ID. It returns the updated node, or ErrNodeNotFound if no such node
+// exists.
+func (s *Simulator) PatchMetadata(id int, patch MetadataPatch) (NodeData, error) {
+	if err := patch.validate(); err != nil {
+		return NodeData{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	index := s.findNode(id)
+	if index < 0 {
+		return NodeData{}, ErrNodeNotFound
+	}
+	node := &s.nodes[index]
+	if patch.Region != nil {
+		node.Region = *patch.Region
+	}
+	if patch.Zone != nil {
+		node.Zone = *patch.Zone
+	}
+	// The tags are replaced rather than changed in place, so copies of the
+	// node that still share the old map are unaffected.
+	tags := node.Tags.clone()
+	for key, value := range patch.Tags {
+		if value == nil {
+			delete(tags, key)
+		} else if tags == nil {
+			tags = Tags{key: *value}
+		} else {
+			tags[key] = *value
+		}
+	}
+	if len(tags) == 0 {
+		tags = nil
+	}
+	node.Tags = tags
+	s.publish(EventNodeUpdated, index)
+	s.logger.Info("node metadata updated", "node_id", id, "region", node.Region, "zone", node.Zone)
+	return node.clone(), nil
+}
+
+// Region is one region of a topology passed to InitTopology.
+type Region struct {
+	Name  string // Empty for nodes in no region.
+	Nodes int
+}
+
+// ParseTopology parses a topology such as "us-east:3,eu-west:2": a comma
+// separated list of region names, each with the number of nodes in it.
+func ParseTopology(spec string) ([]Region, error) {
+	var regions []Region
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(spec, ",") {
+		name, count, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("region %q must be a name and a node count, such as us-east:3", part)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("region %q appears more than once", name)
+		}
+		seen[name] = true
+		n, err := strconv.Atoi(count)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("region %q must have a positive node count", name)
+		}
+		regions = append(regions, Region{Name: name, Nodes: n})
+	}
+	return regions, nil
+}
+
+// TopologySize returns the number of nodes of regions.
+func TopologySize(regions []Region) int {
+	n := 0
+	for _, region := range regions {
+		n += region.Nodes
+	}
+	return n
+}
+
+// PartitionRegions splits the cluster into the given groups of regions, as
+// SetPartition does for node IDs: each node joins the group its region is
+// listed in, and nodes in unlisted regions are isolated. Every region must
+// hold at least one node and appear at most once.
+func (s *Simulator) PartitionRegions(groups [][]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group := make(map[string]int)
+	for g, regions := range groups {
+		if len(regions) == 0 {
+			return fmt.Errorf("group %d is empty", g)
+		}
+		for _, region := range regions {
+			if _, dup := group[region]; dup {
+				return fmt.Errorf("region %q appears in more than one group", region)
+			}
+			group[region] = g
+		}
+	}
+
+	ids := make([][]int, len(groups))
+	for _, node := range s.nodes {
+		if g, ok := group[node.Region]; ok && node.Region != "" {
+			ids[g] = append(ids[g], node.ID)
+		}
+	}
+	for g, regions := range groups {
+		if len(ids[g]) == 0 {
+			return fmt.Errorf("regions %v hold no nodes", regions)
+		}
+	}
+	return s.setPartition(ids)
+}
+
+// clientRegion returns the region the client of r is in: the X-Client-Region
+// header if it is set, or Config.ClientRegion.
+func (s *Simulator) clientRegion(r *http.Request) string {
+	if region := r.Header.Get("X-Client-Region"); region != "" {
+		return region
+	}
+	return s.cfg.ClientRegion
+}
+
+// patchNodeMetadata handles HTTP requests to change a node's region, zone,
+// and tags from a body like {"region":"eu-west","tags":{"rack":"r1","old":null}}.
+func (s *Simulator) patchNodeMetadata(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseNodeID(w, r)
+	if !ok {
+		return
+	}
+
+	var payload MetadataPatch
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "Malformed JSON body")
+		return
+	}
+	if err := payload.validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	node, err := s.PatchMetadata(id, payload)
+	if errors.Is(err, ErrNodeNotFound) {
+		writeError(w, http.StatusNotFound, "Node not found")
+		return
+	}
+	w.Header().Set("ETag", nodeETag(node))
+	writeJSON(w, http.StatusOK, node)
+}
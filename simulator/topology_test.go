@@ -0,0 +1,94 @@
+package simulator
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// TestParseTopology tests parsing topology specs and placing nodes with
+// InitTopology.
+func TestParseTopology(t *testing.T) {
+	regions, err := ParseTopology("us-east:3, eu-west:2")
+	if err != nil {
+		t.Fatalf("ParseTopology failed: %v", err)
+	}
+	if want := []Region{{"us-east", 3}, {"eu-west", 2}}; !reflect.DeepEqual(regions, want) {
+		t.Fatalf("Expected regions %v, got %v", want, regions)
+	}
+	if n := TopologySize(regions); n != 5 {
+		t.Errorf("Expected 5 nodes, got %d", n)
+	}
+
+	s := New(Config{})
+	s.InitTopology(regions)
+	var got []string
+	for _, node := range s.Snapshot() {
+		got = append(got, node.Region)
+	}
+	if want := []string{"us-east", "us-east", "us-east", "eu-west", "eu-west"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected node regions %v, got %v", want, got)
+	}
+
+	for _, spec := range []string{"", "us-east", ":3", "us-east:0", "us-east:x", "us-east:1,us-east:2"} {
+		if _, err := ParseTopology(spec); err == nil {
+			t.Errorf("Expected %q to be rejected", spec)
+		}
+	}
+}
+
+// TestNodeMetadata tests setting metadata when creating a node and changing
+// it with PATCH /nodes/{id}/metadata.
+func TestNodeMetadata(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	rr := doRequest(t, h, "POST", "/nodes", `{"name":"edge","value":1,"region":"us-east","zone":"us-east-1a","tags":{"rack":"r1"}}`)
+	expectCode(t, rr, http.StatusCreated)
+	var node NodeData
+	decodeBody(t, rr, &node)
+	if node.Region != "us-east" || node.Zone != "us-east-1a" || !reflect.DeepEqual(node.Tags, Tags{"rack": "r1"}) {
+		t.Fatalf("Expected the new node to carry its metadata, got %+v", node)
+	}
+	id := node.ID
+
+	path := fmt.Sprintf("/nodes/%d/metadata", id)
+	rr = doRequest(t, h, "PATCH", path, `{"region":"eu-west","tags":{"canary":"true","rack":null}}`)
+	expectCode(t, rr, http.StatusOK)
+	var patched NodeData
+	decodeBody(t, rr, &patched)
+	if patched.Region != "eu-west" || patched.Zone != "us-east-1a" || !reflect.DeepEqual(patched.Tags, Tags{"canary": "true"}) {
+		t.Errorf("Expected the region and tags to change and the zone to stay, got %+v", patched)
+	}
+	if patched.Version != node.Version+1 || rr.Header().Get("ETag") != nodeETag(patched) {
+		t.Errorf("Expected the patch to bump the version to %d, got %d", node.Version+1, patched.Version)
+	}
+
+	rr = doRequest(t, h, "PATCH", path, `{"zone":"","tags":{"canary":null}}`)
+	expectCode(t, rr, http.StatusOK)
+	var cleared NodeData
+	decodeBody(t, rr, &cleared)
+	if cleared.Region != "eu-west" || cleared.Zone != "" || cleared.Tags != nil {
+		t.Errorf("Expected the zone and tags to be cleared, got %+v", cleared)
+	}
+	if node, _ := s.Node(0); node.Region != "" || node.Tags != nil {
+		t.Errorf("Expected other nodes to have no metadata, got %+v", node)
+	}
+
+	for _, tt := range []struct {
+		method, path, body string
+		want               int
+	}{
+		{"PATCH", "/nodes/99/metadata", `{"region":"eu-west"}`, http.StatusNotFound},
+		{"PATCH", path, `{"tags":{"a:b":"c"}}`, http.StatusBadRequest},
+		{"PATCH", path, `{"datacenter":"dc1"}`, http.StatusBadRequest},
+		{"POST", "/nodes", `{"name":"x","value":1,"tags":{"":"c"}}`, http.StatusBadRequest},
+		{"PUT", "/nodes/0", `{"name":"x","value":1,"region":"eu-west"}`, http.StatusBadRequest},
+	} {
+		if rr := doRequest(t, h, tt.method, tt.path, tt.body); rr.Code != tt.want {
+			t.Errorf("%s %s %s: expected status code %d, got %d", tt.method, tt.path, tt.body, tt.want, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package simulator
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultTraceCapacity is the number of request traces retained, used when
+// Config.TraceCapacity is unset.
+const DefaultTraceCapacity = 256
+
+// Span is one step of a traced request on one node: the whole of a quorum
+// read or write, a two-phase commit, or a saga on its coordinator, or the
+// round trip to a replica or participant it contacts. Times are on the
+// simulation clock, offset by the simulated latency of the messages.
+type Span struct {
+	ID        int       `json:"id"`
+	Parent    int       `json:"parent,omitempty"` // ID of the enclosing span, or 0 for a root.
+	Operation string    `json:"operation"`        // For example "kv.put" or "replica.write".
+	Node      *int      `json:"node,omitempty"`   // ID of the node the step ran on, if it reached one.
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Duration  Duration  `json:"duration"`
+	Error     string    `json:"error,omitempty"`
+
+	// Children are the spans enclosed by this one, in order of ID. They are
+	// only set in the span tree of a RequestTrace.
+	Children []Span `json:"children,omitempty"`
+}
+
+// RequestTrace is the span tree of a traced request: every multi-node
+// operation run by HTTP requests carrying its request ID.
+type RequestTrace struct {
+	RequestID string    `json:"request_id"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Duration  Duration  `json:"duration"`
+	Spans     []Span    `json:"spans"` // The root spans, each with its children.
+}
+
+// TraceSummary describes a retained trace without its spans.
+type TraceSummary struct {
+	RequestID string    `json:"request_id"`
+	Operation string    `json:"operation"` // Operation of the first root span.
+	Start     time.Time `json:"start"`
+	Duration  Duration  `json:"duration"`
+	Spans     int       `json:"spans"`
+	Errors    int       `json:"errors"` // Spans that failed.
+}
+
+// tracer collects the spans of one request's multi-node operations while
+// they run. The methods of a nil *tracer do nothing, so untraced calls,
+// made other than by an HTTP request, pass nil.
+type tracer struct {
+	requestID string
+	spans     []Span      // In order of ID, which starts at 1.
+	parent    spanContext // Telemetry span of the request, if exported.
+}
+
+// newTracer returns a tracer for r, or nil if r has no request ID.
+func newTracer(r *http.Request) *tracer {
+	id := RequestIDFromContext(r.Context())
+	if id == "" {
+		return nil
+	}
+	sc, _ := spanContextFrom(r.Context())
+	return &tracer{requestID: id, parent: sc}
+}
+
+// start opens a span of operation on the node with the given ID, or on none
+// if it is negative, at the given time, and returns its ID.
+func (t *tracer) start(parent int, operation string, node int, at time.Time) int {
+	if t == nil {
+		return 0
+	}
+	span := Span{ID: len(t.spans) + 1, Parent: parent, Operation: operation, Start: at, End: at}
+	if node >= 0 {
+		span.Node = &node
+	}
+	t.spans = append(t.spans, span)
+	return span.ID
+}
+
+// end closes the span with the given ID at the given time, failed with err
+// if it is not nil.
+func (t *tracer) end(id int, at time.Time, err error) {
+	if t == nil || id == 0 {
+		return
+	}
+	span := &t.spans[id-1]
+	span.End = at
+	span.Duration = Duration(at.Sub(span.Start))
+	if err != nil {
+		span.Error = err.Error()
+	}
+}
+
+// record adds a span from start to end and returns its ID.
+func (t *tracer) record(parent int, operation string, node int, start, end time.Time, err error) int {
+	id := t.start(parent, operation, node, start)
+	t.end(id, end, err)
+	return id
+}
+
+// roundTripLatency returns how long a message from the node with ID from to
+// the node with ID to and its reply take at the base latency of the link.
+// Spans leave out jitter so that tracing doesn't draw on the random source.
+// The caller must hold s.mu.
+func (s *Simulator) roundTripLatency(from, to int) time.Duration {
+	i, j := s.findNode(from), s.findNode(to)
+	if i < 0 || j < 0 || i == j {
+		return 0
+	}
+	return s.baseLatency(i, j) + s.baseLatency(j, i)
+}
+
+// traceQuorum records a span of operation coordinated at now by the node
+// with ID coordinator, enclosing a span of replicaOperation for the round
+// trip to each replica, and returns the root span's ID and when the slowest
+// replica answered. The caller must hold s.mu.
+func (s *Simulator) traceQuorum(t *tracer, operation, replicaOperation string, coordinator int, replicas []int, now time.Time) (int, time.Time) {
+	if t == nil {
+		return 0, now
+	}
+	root := t.start(0, operation, coordinator, now)
+	end := now
+	for _, id := range replicas {
+		answered := now.Add(s.roundTripLatency(coordinator, id))
+		t.record(root, replicaOperation, id, now, answered, nil)
+		end = later(end, answered)
+	}
+	t.end(root, end, nil)
+	return root, end
+}
+
+// later returns the later of a and b.
+func later(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+// traceCache retains the traces of the latest requests, evicting the least
+// recently recorded or retrieved once Config.TraceCapacity are held. It has
+// its own lock, so traces are read without waiting for s.mu.
+type traceCache struct {
+	mu    sync.Mutex
+	order list.List                // Of *traceEntry, most recently used first.
+	byID  map[string]*list.Element // Elements of order by request ID.
+}
+
+// traceEntry is a retained trace, its spans flat in order of ID.
+type traceEntry struct {
+	requestID string
+	spans     []Span
+}
+
+// keepTrace adds the spans t collected to the trace of its request, which
+// becomes the most recently used, and queues them for export to
+// Config.Telemetry if it is set.
+func (s *Simulator) keepTrace(t *tracer) {
+	if t == nil || len(t.spans) == 0 {
+		return
+	}
+	if s.telemetry != nil {
+		s.exportTrace(t)
+	}
+	c := &s.traces
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.byID == nil {
+		c.byID = make(map[string]*list.Element)
+	}
+	elem, ok := c.byID[t.requestID]
+	if !ok {
+		elem = c.order.PushFront(&traceEntry{requestID: t.requestID})
+		c.byID[t.requestID] = elem
+	}
+	c.order.MoveToFront(elem)
+	entry := elem.Value.(*traceEntry)
+	// A request ID reused by several requests gathers all their spans, so
+	// IDs are offset past the spans already held.
+	offset := len(entry.spans)
+	for _, span := range t.spans {
+		span.ID += offset
+		if span.Parent != 0 {
+			span.Parent += offset
+		}
+		entry.spans = append(entry.spans, span)
+	}
+	for c.order.Len() > s.cfg.TraceCapacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.byID, oldest.Value.(*traceEntry).requestID)
+	}
+}
+
+// tree returns e as a span tree.
+func (e *traceEntry) tree() RequestTrace {
+	trace := RequestTrace{RequestID: e.requestID, Start: e.spans[0].Start, End: e.spans[0].End}
+	children := make(map[int][]int)
+	var roots []int
+	for i, span := range e.spans {
+		if span.Start.Before(trace.Start) {
+			trace.Start = span.Start
+		}
+		trace.End = later(trace.End, span.End)
+		if span.Parent == 0 {
+			roots = append(roots, i)
+		} else {
+			children[span.Parent] = append(children[span.Parent], i)
+		}
+	}
+	trace.Duration = Duration(trace.End.Sub(trace.Start))
+
+	var build func(i int) Span
+	build = func(i int) Span {
+		span := e.spans[i]
+		for _, child := range children[span.ID] {
+			span.Children = append(span.Children, build(child))
+		}
+		return span
+	}
+	for _, i := range roots {
+		trace.Spans = append(trace.Spans, build(i))
+	}
+	return trace
+}
+
+// summary returns the summary of e.
+func (e *traceEntry) summary() TraceSummary {
+	trace := e.tree()
+	summary := TraceSummary{RequestID: e.requestID, Operation: e.spans[0].Operation, Start: trace.Start, Duration: trace.Duration, Spans: len(e.spans)}
+	for _, span := range e.spans {
+		if span.Error != "" {
+			summary.Errors++
+		}
+	}
+	return summary
+}
+
+// RequestTrace returns the trace of the request with the given ID, which
+// becomes the most recently used, and false if no trace of it is retained.
+func (s *Simulator) RequestTrace(requestID string) (RequestTrace, bool) {
+	c := &s.traces
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.byID[requestID]
+	if !ok {
+		return RequestTrace{}, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*traceEntry).tree(), true
+}
+
+// RequestTraces returns the summaries of the retained traces, most recently
+// used first.
+func (s *Simulator) RequestTraces() []TraceSummary {
+	c := &s.traces
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	summaries := []TraceSummary{}
+	for elem := c.order.Front(); elem != nil; elem = elem.Next() {
+		summaries = append(summaries, elem.Value.(*traceEntry).summary())
+	}
+	return summaries
+}
+
+// getTraces handles HTTP requests to list the recent request traces.
+func (s *Simulator) getTraces(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.RequestTraces())
+}
+
+// getTrace handles HTTP requests to retrieve the span tree of a request.
+func (s *Simulator) getTrace(w http.ResponseWriter, r *http.Request) {
+	trace, found := s.RequestTrace(r.PathValue("request_id"))
+	if !found {
+		writeError(w, http.StatusNotFound, "Trace not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, trace)
+}
@@ -0,0 +1,150 @@
+package simulator
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestTraceQuorumWrite tests that a quorum write is traced with one span per
+// replica written, each as long as the round trip to it, under a root as
+// long as the slowest.
+func TestTraceQuorumWrite(t *testing.T) {
+	s := New(Config{Seed: 1, N: 3, W: 3, R: 1})
+	s.Init(testNodeCount)
+	h := s.Handler()
+	s.SetLatencyModel(LatencyModel{IntraRegion: Duration(10 * time.Millisecond)})
+
+	rr := doRequest(t, h, "PUT", "/kv/traced", `{"value":"v"}`)
+	expectCode(t, rr, http.StatusOK)
+	var result KVResult
+	decodeBody(t, rr, &result)
+	id := rr.Header().Get(RequestIDHeader)
+
+	rr = doRequest(t, h, "GET", "/traces/"+id, "")
+	expectCode(t, rr, http.StatusOK)
+	var trace RequestTrace
+	decodeBody(t, rr, &trace)
+	if trace.RequestID != id || len(trace.Spans) != 1 {
+		t.Fatalf("Expected one root span for %s, got %+v", id, trace)
+	}
+	root := trace.Spans[0]
+	coordinator := result.Replicas[0]
+	if root.Operation != "kv.put" || root.Node == nil || *root.Node != coordinator || root.Error != "" {
+		t.Errorf("Expected a write coordinated by node %d, got %+v", coordinator, root)
+	}
+	if len(root.Children) != len(result.Replicas) {
+		t.Fatalf("Expected a span per replica %v, got %+v", result.Replicas, root.Children)
+	}
+	for i, span := range root.Children {
+		want := Duration(20 * time.Millisecond)
+		if result.Replicas[i] == coordinator {
+			want = 0
+		}
+		switch {
+		case span.Operation != "replica.write" || span.Parent != root.ID || span.Node == nil || *span.Node != result.Replicas[i]:
+			t.Errorf("Expected a write to replica %d, got %+v", result.Replicas[i], span)
+		case !span.Start.Equal(root.Start) || span.End.After(root.End) || span.Duration != want:
+			t.Errorf("Expected replica %d to take a %v round trip within %+v, got %+v", result.Replicas[i], want, root, span)
+		}
+	}
+	if root.Duration != Duration(20*time.Millisecond) || trace.Duration != root.Duration {
+		t.Errorf("Expected the write to take the slowest round trip, got %v and %v", root.Duration, trace.Duration)
+	}
+}
+
+// TestTraceOperations tests the spans of quorum reads, failed writes, two-
+// phase commits, and sagas, and that requests sharing an ID share a trace.
+func TestTraceOperations(t *testing.T) {
+	s := New(Config{Seed: 1})
+	s.Init(testNodeCount)
+	h := s.Handler()
+	s.KVPut("k", "v")
+
+	request := func(method, path, body, id string) {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(RequestIDHeader, id)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	spans := func(id string) []Span {
+		t.Helper()
+		trace, ok := s.RequestTrace(id)
+		if !ok {
+			t.Fatalf("Expected a trace of %s", id)
+		}
+		return trace.Spans
+	}
+
+	request("GET", "/kv/k", "", "read")
+	request("GET", "/kv/k", "", "read")
+	if got := spans("read"); len(got) != 2 || got[0].Operation != "kv.get" || len(got[0].Children) < 2 || got[1].ID != len(got[0].Children)+2 {
+		t.Errorf("Expected two reads in one trace, got %+v", got)
+	}
+
+	request("POST", "/transactions", `{"writes":[{"node_id":0,"value":1},{"node_id":1,"value":2}]}`, "2pc")
+	if got := spans("2pc"); len(got) != 1 || got[0].Operation != "2pc" || len(got[0].Children) != 4 || got[0].Children[2].Operation != "2pc.commit" {
+		t.Errorf("Expected a prepare and commit per participant, got %+v", got)
+	}
+	s.Fail(1)
+	request("POST", "/transactions", `{"writes":[{"node_id":0,"value":1},{"node_id":1,"value":2}]}`, "abort")
+	if got := spans("abort"); len(got[0].Children) != 4 || got[0].Children[1].Error != errVotedNo.Error() || got[0].Children[3].Operation != "2pc.abort" {
+		t.Errorf("Expected the down participant to vote no, got %+v", got)
+	}
+
+	request("POST", "/sagas", `{"steps":[{"node_id":0,"value":5},{"node_id":1,"value":6}]}`, "saga")
+	got := spans("saga")
+	if len(got) != 1 || got[0].Operation != "saga" {
+		t.Fatalf("Expected a saga, got %+v", got)
+	}
+	var ops []string
+	for _, span := range got[0].Children {
+		ops = append(ops, span.Operation)
+	}
+	if fmt.Sprint(ops) != "[saga.step saga.step saga.compensate]" || got[0].Children[1].Error == "" {
+		t.Errorf("Expected the second step to fail and the first to be compensated, got %v", got[0].Children)
+	}
+
+	for id := 2; id < testNodeCount; id++ {
+		s.Fail(id)
+	}
+	request("PUT", "/kv/k", `{"value":"v"}`, "unavailable")
+	if got := spans("unavailable"); len(got) != 1 || got[0].Node != nil || got[0].Error == "" {
+		t.Errorf("Expected a failed write without a coordinator, got %+v", got)
+	}
+
+	// Reads of other endpoints are not traced.
+	request("GET", "/nodes", "", "untraced")
+	if _, ok := s.RequestTrace("untraced"); ok {
+		t.Error("Expected no trace without a multi-node operation")
+	}
+	expectCode(t, doRequest(t, h, "GET", "/traces/untraced", ""), http.StatusNotFound)
+}
+
+// TestTraceEviction tests that the least recently used traces are evicted
+// once Config.TraceCapacity are retained, and that GET /traces lists the
+// rest most recently used first.
+func TestTraceEviction(t *testing.T) {
+	s := New(Config{Seed: 1, TraceCapacity: 2})
+	s.Init(testNodeCount)
+	for _, id := range []string{"a", "b"} {
+		s.keepTrace(&tracer{requestID: id, spans: []Span{{ID: 1, Operation: "op-" + id}}})
+	}
+	s.RequestTrace("a")
+	s.keepTrace(&tracer{requestID: "c", spans: []Span{{ID: 1, Operation: "op-c", Error: "failed"}}})
+
+	var summaries []TraceSummary
+	decodeBody(t, doRequest(t, s.Handler(), "GET", "/traces", ""), &summaries)
+	if len(summaries) != 2 || summaries[0].RequestID != "c" || summaries[1].RequestID != "a" {
+		t.Fatalf("Expected c and a, most recent first, got %+v", summaries)
+	}
+	if summaries[0].Operation != "op-c" || summaries[0].Spans != 1 || summaries[0].Errors != 1 {
+		t.Errorf("Unexpected summary %+v", summaries[0])
+	}
+	if _, ok := s.RequestTrace("b"); ok {
+		t.Error("Expected b to be evicted")
+	}
+}
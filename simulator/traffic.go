@@ -0,0 +1,326 @@
+package simulator
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Kinds of messages between nodes counted by Traffic.
+const (
+	MessageGossip      = "gossip"      // A gossiped node value.
+	MessageReplication = "replication" // A copy of a key sent by ReplicationRound.
+	MessageHeartbeat   = "heartbeat"   // A heartbeat to the failure detector.
+	MessageHint        = "hint"        // A hinted write handed off to its replica.
+	MessageBus         = "bus"         // A message published to a topic of the message bus.
+)
+
+// Bandwidth policies, which decide what happens to a message that would take
+// a link over its limit.
+const (
+	// BandwidthQueue holds the message back until the first tick the link
+	// has room for it in.
+	BandwidthQueue = "queue"
+
+	// BandwidthDrop drops the message.
+	BandwidthDrop = "drop"
+)
+
+// DefaultTrafficTop is the number of links and nodes Traffic lists when the
+// request doesn't say.
+const DefaultTrafficTop = 10
+
+// messageHeaderSize is the estimated size, in bytes, of the envelope every
+// message between nodes carries: its sender, receiver, kind, and send time.
+const messageHeaderSize = 32
+
+// Bandwidth limits the bytes every link may carry per tick of the update
+// interval on the simulation clock.
+type Bandwidth struct {
+	Limit  int    `json:"limit"`  // Bytes per link per tick, or 0 for no limit.
+	Policy string `json:"policy"` // BandwidthQueue or BandwidthDrop.
+}
+
+// ErrInvalidBandwidth means a bandwidth limit was rejected.
+var ErrInvalidBandwidth = errors.New("invalid bandwidth")
+
+// validate returns an error wrapping ErrInvalidBandwidth if the limit of b is
+// negative or its policy is unknown.
+func (b Bandwidth) validate() error {
+	if b.Limit < 0 {
+		return fmt.Errorf("%w: limit must not be negative", ErrInvalidBandwidth)
+	}
+	if b.Policy != BandwidthQueue && b.Policy != BandwidthDrop {
+		return fmt.Errorf("%w: unknown policy %q, expected queue or drop", ErrInvalidBandwidth, b.Policy)
+	}
+	return nil
+}
+
+// TrafficCount is a number of messages and the bytes they took.
+type TrafficCount struct {
+	Messages uint64 `json:"messages"`
+	Bytes    uint64 `json:"bytes"`
+}
+
+// add counts a message of size bytes.
+func (c *TrafficCount) add(size int) {
+	c.Messages++
+	c.Bytes += uint64(size)
+}
+
+// LinkTraffic is the traffic sent on the link from one node to another.
+type LinkTraffic struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+	TrafficCount
+}
+
+// NodeTraffic is the traffic a node has sent and received.
+type NodeTraffic struct {
+	ID       int          `json:"id"`
+	Sent     TrafficCount `json:"sent"`
+	Received TrafficCount `json:"received"`
+}
+
+// TrafficInfo reports the messages nodes have sent each other and the bytes
+// they took, by kind, link, and node.
+type TrafficInfo struct {
+	TrafficCount
+	Kinds map[string]TrafficCount `json:"kinds"`
+
+	// Links and Nodes list the busiest links and the nodes that sent and
+	// received the most bytes, busiest first.
+	Links []LinkTraffic `json:"links"`
+	Nodes []NodeTraffic `json:"nodes"`
+
+	Bandwidth Bandwidth `json:"bandwidth"`
+	Queued    uint64    `json:"queued"`    // Messages held back for a later tick by the bandwidth limit.
+	Throttled uint64    `json:"throttled"` // Messages dropped by the bandwidth limit.
+}
+
+// trafficStats accumulates the traffic between nodes. The zero value is
+// ready to use.
+type trafficStats struct {
+	total     TrafficCount
+	kinds     map[string]TrafficCount
+	links     map[link]TrafficCount
+	queued    uint64
+	throttled uint64
+
+	// windows holds the tick each link was last sent on under the
+	// bandwidth limit and the bytes sent on it in that tick.
+	windows map[link]linkWindow
+}
+
+// linkWindow is the bytes sent on a link in one tick.
+type linkWindow struct {
+	tick int64
+	used int
+}
+
+// record counts a message of size bytes of the given kind on link l.
+func (t *trafficStats) record(l link, kind string, size int) {
+	if t.kinds == nil {
+		t.kinds = make(map[string]TrafficCount)
+		t.links = make(map[link]TrafficCount)
+	}
+	t.total.add(size)
+	c := t.kinds[kind]
+	c.add(size)
+	t.kinds[kind] = c
+	c = t.links[l]
+	c.add(size)
+	t.links[l] = c
+}
+
+// gossipPayload is the body of a message carrying a gossiped value.
+type gossipPayload struct {
+	Value       int         `json:"value"`
+	Time        time.Time   `json:"time"`
+	HLC         HLC         `json:"hlc"`
+	Stamp       HLC         `json:"stamp"`
+	VectorClock VectorClock `json:"vector_clock"`
+}
+
+// replicaPayload is the body of a message carrying a copy of a key, sent by
+// replication or a hint handoff.
+type replicaPayload struct {
+	Key   string  `json:"key"`
+	Entry KVEntry `json:"entry"`
+}
+
+// heartbeatPayload is the body of a heartbeat.
+type heartbeatPayload struct {
+	ID   int       `json:"id"`
+	Sent time.Time `json:"sent"`
+}
+
+// messageSize estimates the size in bytes of a message between nodes with
+// the given payload: the header plus the payload encoded as JSON.
+func messageSize(payload any) int {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return messageHeaderSize
+	}
+	return messageHeaderSize + len(data)
+}
+
+// SetBandwidth replaces the bandwidth limit of every link. Ticks already
+// under way keep the bytes sent in them. It returns an error wrapping
+// ErrInvalidBandwidth if b is invalid.
+func (s *Simulator) SetBandwidth(b Bandwidth) error {
+	if err := b.validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.bandwidth = b
+	s.logger.Info("bandwidth changed", "limit", b.Limit, "policy", b.Policy)
+	return nil
+}
+
+// throttle applies the bandwidth limit to a message of size bytes sent on
+// link l at now. It returns how long the message is held back before it
+// leaves, or false if it is dropped. A message larger than the limit leaves
+// alone in a tick of its own under BandwidthQueue. The caller must hold s.mu
+// for writing.
+func (s *Simulator) throttle(now time.Time, l link, size int) (time.Duration, bool) {
+	limit := s.bandwidth.Limit
+	if limit <= 0 {
+		return 0, true
+	}
+	tick := int64(s.UpdateInterval())
+	current := now.UnixNano() / tick
+	w := s.traffic.windows[l]
+	if w.tick < current {
+		w = linkWindow{tick: current}
+	}
+	if w.used+size > limit {
+		if s.bandwidth.Policy == BandwidthDrop {
+			s.traffic.throttled++
+			return 0, false
+		}
+		if w.used > 0 {
+			w = linkWindow{tick: w.tick + 1}
+		}
+	}
+	w.used += size
+	if s.traffic.windows == nil {
+		s.traffic.windows = make(map[link]linkWindow)
+	}
+	s.traffic.windows[l] = w
+	if w.tick == current {
+		return 0, true
+	}
+	s.traffic.queued++
+	return time.Unix(0, w.tick*tick).Sub(now), true
+}
+
+// forgetTraffic drops the traffic counters and bandwidth use of the links to
+// or from the node with the given ID. The totals keep its traffic. The
+// caller must hold s.mu for writing.
+func (s *Simulator) forgetTraffic(id int) {
+	for l := range s.traffic.links {
+		if l.from == id || l.to == id {
+			delete(s.traffic.links, l)
+		}
+	}
+	for l := range s.traffic.windows {
+		if l.from == id || l.to == id {
+			delete(s.traffic.windows, l)
+		}
+	}
+}
+
+// Traffic returns the traffic between nodes, listing the top busiest links
+// and nodes.
+func (s *Simulator) Traffic(top int) TrafficInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	info := TrafficInfo{
+		TrafficCount: s.traffic.total,
+		Kinds:        make(map[string]TrafficCount, len(s.traffic.kinds)),
+		Links:        make([]LinkTraffic, 0, len(s.traffic.links)),
+		Nodes:        []NodeTraffic{},
+		Bandwidth:    s.bandwidth,
+		Queued:       s.traffic.queued,
+		Throttled:    s.traffic.throttled,
+	}
+	for kind, c := range s.traffic.kinds {
+		info.Kinds[kind] = c
+	}
+	nodes := make(map[int]*NodeTraffic)
+	node := func(id int) *NodeTraffic {
+		if nodes[id] == nil {
+			nodes[id] = &NodeTraffic{ID: id}
+		}
+		return nodes[id]
+	}
+	for l, c := range s.traffic.links {
+		info.Links = append(info.Links, LinkTraffic{From: l.from, To: l.to, TrafficCount: c})
+		sent, received := &node(l.from).Sent, &node(l.to).Received
+		sent.Messages, sent.Bytes = sent.Messages+c.Messages, sent.Bytes+c.Bytes
+		received.Messages, received.Bytes = received.Messages+c.Messages, received.Bytes+c.Bytes
+	}
+	for _, n := range nodes {
+		info.Nodes = append(info.Nodes, *n)
+	}
+
+	sort.Slice(info.Links, func(i, j int) bool {
+		a, b := info.Links[i], info.Links[j]
+		if a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		return a.From < b.From || a.From == b.From && a.To < b.To
+	})
+	sort.Slice(info.Nodes, func(i, j int) bool {
+		a, b := info.Nodes[i], info.Nodes[j]
+		if ta, tb := a.Sent.Bytes+a.Received.Bytes, b.Sent.Bytes+b.Received.Bytes; ta != tb {
+			return ta > tb
+		}
+		return a.ID < b.ID
+	})
+	info.Links = info.Links[:min(top, len(info.Links))]
+	info.Nodes = info.Nodes[:min(top, len(info.Nodes))]
+	return info
+}
+
+// getTraffic handles HTTP requests for the traffic between nodes. The top
+// query parameter sets how many links and nodes are listed.
+func (s *Simulator) getTraffic(w http.ResponseWriter, r *http.Request) {
+	top, err := intParam(r.URL.Query(), "top")
+	if err != nil || (r.URL.Query().Has("top") && top < 1) {
+		writeError(w, http.StatusBadRequest, "Query parameter \"top\" must be a positive integer")
+		return
+	}
+	if top == 0 {
+		top = DefaultTrafficTop
+	}
+	writeJSON(w, http.StatusOK, s.Traffic(top))
+}
+
+// putBandwidth handles HTTP requests to replace the bandwidth limit of every
+// link from a body like {"limit":4096,"policy":"drop"}.
+func (s *Simulator) putBandwidth(w http.ResponseWriter, r *http.Request) {
+	var payload Bandwidth
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "Malformed JSON body")
+		return
+	}
+	if payload.Policy == "" {
+		payload.Policy = BandwidthQueue
+	}
+	if err := s.SetBandwidth(payload); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Traffic(DefaultTrafficTop))
+}
@@ -0,0 +1,140 @@
+package simulator
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestTraffic tests that a fixed workload of a hint handoff, a replication
+// copy, and a round of heartbeats is counted at the sizes of its messages.
+func TestTraffic(t *testing.T) {
+	clock := latencyClock(t)
+	s := New(Config{Seed: 1, Clock: clock, N: 3, R: 1, W: 1})
+	s.Init(3)
+	h := s.Handler()
+
+	s.Fail(2)
+	result, err := s.KVPut("k", "v")
+	if err != nil {
+		t.Fatalf("KVPut failed: %v", err)
+	}
+	writer := result.Replicas[0]
+	s.Recover(2)
+	if n := s.DeliverHints(); n != 1 {
+		t.Fatalf("Expected 1 hint delivered, got %d", n)
+	}
+	if n := s.ReplicationRound(); n != 1 {
+		t.Fatalf("Expected 1 replication copy, got %d", n)
+	}
+	now := clock.Now()
+	s.heartbeatRound(now)
+
+	copySize := messageSize(replicaPayload{Key: "k", Entry: s.replicaData[writer]["k"]})
+	leader := -1
+	for _, node := range s.Snapshot() {
+		if node.Leader {
+			leader = node.ID
+		}
+	}
+	heartbeats := TrafficCount{}
+	for id := 0; id < 3; id++ {
+		if id != leader {
+			heartbeats.add(messageSize(heartbeatPayload{ID: id, Sent: now}))
+		}
+	}
+
+	var info TrafficInfo
+	decodeBody(t, doRequest(t, h, "GET", "/traffic", ""), &info)
+	want := map[string]TrafficCount{
+		MessageHint:        {Messages: 1, Bytes: uint64(copySize)},
+		MessageReplication: {Messages: 1, Bytes: uint64(copySize)},
+		MessageHeartbeat:   heartbeats,
+	}
+	if !reflect.DeepEqual(info.Kinds, want) {
+		t.Errorf("Expected traffic by kind %+v, got %+v", want, info.Kinds)
+	}
+	if total := (TrafficCount{Messages: 4, Bytes: 2*uint64(copySize) + heartbeats.Bytes}); info.TrafficCount != total {
+		t.Errorf("Expected total traffic %+v, got %+v", total, info.TrafficCount)
+	}
+
+	var sent, received uint64
+	for _, l := range info.Links {
+		sent += l.Bytes
+	}
+	for _, n := range info.Nodes {
+		received += n.Received.Bytes
+	}
+	if sent != info.Bytes || received != info.Bytes {
+		t.Errorf("Expected links and nodes to account for all %d bytes, got %d and %d", info.Bytes, sent, received)
+	}
+	if writer != leader && info.Nodes[0].ID != writer {
+		t.Errorf("Expected node %d, which sent both copies, to be the top talker, got %+v", writer, info.Nodes)
+	}
+
+	decodeBody(t, doRequest(t, h, "GET", "/traffic?top=1", ""), &info)
+	if len(info.Links) != 1 || len(info.Nodes) != 1 {
+		t.Errorf("Expected one link and one node with top=1, got %d and %d", len(info.Links), len(info.Nodes))
+	}
+	for _, query := range []string{"top=0", "top=x"} {
+		expectCode(t, doRequest(t, h, "GET", "/traffic?"+query, ""), http.StatusBadRequest)
+	}
+}
+
+// TestBandwidth tests that messages over a link's bandwidth limit wait for a
+// later tick under the queue policy and are dropped under the drop policy.
+func TestBandwidth(t *testing.T) {
+	for _, policy := range []string{BandwidthQueue, BandwidthDrop} {
+		t.Run(policy, func(t *testing.T) {
+			clock := latencyClock(t)
+			s := New(Config{Seed: 1, Clock: clock, UpdateInterval: time.Second, N: 2, R: 1, W: 1})
+			s.Init(2)
+
+			// Write both keys while node 1 is down, so they reach node 0
+			// alone and both copies take the same link.
+			keys, writer := []string{"a", "b"}, 0
+			s.Fail(1)
+			for _, key := range keys {
+				if _, err := s.KVPut(key, "v"); err != nil {
+					t.Fatalf("KVPut failed: %v", err)
+				}
+			}
+			s.Recover(1)
+			limit := 0
+			for _, key := range keys {
+				limit = max(limit, messageSize(replicaPayload{Key: key, Entry: s.replicaData[writer][key]}))
+			}
+			rr := doRequest(t, s.Handler(), "PUT", "/traffic/bandwidth", `{"limit":`+strconv.Itoa(limit)+`,"policy":"`+policy+`"}`)
+			expectCode(t, rr, http.StatusOK)
+
+			if n := s.ReplicationRound(); policy == BandwidthQueue && n != 2 || policy == BandwidthDrop && n != 1 {
+				t.Fatalf("Unexpected number of copies %d", n)
+			}
+			info := s.Traffic(DefaultTrafficTop)
+			if policy == BandwidthQueue && (info.Queued != 1 || len(s.inFlight) != 1) {
+				t.Errorf("Expected one copy queued for the next tick, got %d queued and %d in flight", info.Queued, len(s.inFlight))
+			}
+			if policy == BandwidthDrop && info.Throttled != 1 {
+				t.Errorf("Expected one copy dropped, got %d", info.Throttled)
+			}
+
+			// The next tick has room for the copy that didn't fit.
+			if err := clock.Step(); err != nil {
+				t.Fatalf("Step failed: %v", err)
+			}
+			s.ReplicationRound()
+			for _, key := range keys {
+				if info, _ := s.KVReplicas(key); !info.InSync {
+					t.Errorf("Expected %s to be replicated by the second tick", key)
+				}
+			}
+		})
+	}
+
+	s := New(Config{})
+	for _, body := range []string{`{"limit":-1}`, `{"limit":1,"policy":"shape"}`, `{"rate":1}`} {
+		expectCode(t, doRequest(t, s.Handler(), "PUT", "/traffic/bandwidth", body), http.StatusBadRequest)
+	}
+}
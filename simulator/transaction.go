@@ -0,0 +1,190 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Transaction outcomes and participant votes.
+const (
+	TxCommitted = "committed" // Every participant voted yes and applied its write.
+	TxAborted   = "aborted"   // Some participant voted no, so no write was applied.
+
+	VoteYes = "yes" // The participant prepared its write.
+	VoteNo  = "no"  // The participant could not prepare, e.g. because it is down.
+)
+
+// TxWrite is one write of a transaction: the value to set on a node.
+type TxWrite struct {
+	NodeID int `json:"node_id"`
+	Value  int `json:"value"`
+}
+
+// TxParticipant records how one node took part in a transaction.
+type TxParticipant struct {
+	NodeID  int    `json:"node_id"`
+	Value   int    `json:"value"`
+	Vote    string `json:"vote"`
+	Outcome string `json:"outcome"`
+}
+
+// Transaction records a two-phase commit and its outcome.
+type Transaction struct {
+	ID           int             `json:"id"`
+	Participants []TxParticipant `json:"participants"`
+	Outcome      string          `json:"outcome"`
+	Time         time.Time       `json:"time"`
+
+	// Duration is how long the commit took in simulated time: for each
+	// phase, the slowest round trip from the coordinator, the first
+	// participant, to a participant under the latency model, plus the
+	// backoff of prepare calls that were retried.
+	Duration Duration `json:"duration"`
+}
+
+// clone returns a copy of tx that shares no memory with the simulator's
+// state.
+func (tx Transaction) clone() Transaction {
+	tx.Participants = append([]TxParticipant{}, tx.Participants...)
+	return tx
+}
+
+// ErrInvalidTransaction means a transaction's writes were rejected before it
+// started.
+var ErrInvalidTransaction = errors.New("invalid transaction")
+
+// errVotedNo is the error of a traced prepare call that got no yes vote.
+var errVotedNo = errors.New("voted no")
+
+// RunTransaction applies writes atomically with a two-phase commit. In the
+// prepare phase the coordinator, the first participant, asks every
+// participant to vote, retrying under the prepare retry policy while the
+// call is lost on the link or the participant is down; one that never
+// answers votes no. If every vote is yes, the commit phase applies every
+// write, otherwise every participant aborts and no node changes. Either way
+// the transaction is recorded and returned. It returns an error wrapping
+// ErrInvalidTransaction if writes is empty or names a missing node or the
+// same node twice.
+func (s *Simulator) RunTransaction(writes []TxWrite) (Transaction, error) {
+	return s.runTransaction(nil, writes)
+}
+
+// runTransaction is RunTransaction, tracing both phases with t.
+func (s *Simulator) runTransaction(t *tracer, writes []TxWrite) (Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(writes) == 0 {
+		return Transaction{}, fmt.Errorf("%w: no writes", ErrInvalidTransaction)
+	}
+	seen := make(map[int]bool, len(writes))
+	for _, write := range writes {
+		if s.findNode(write.NodeID) < 0 {
+			return Transaction{}, fmt.Errorf("%w: node %d does not exist", ErrInvalidTransaction, write.NodeID)
+		}
+		if seen[write.NodeID] {
+			return Transaction{}, fmt.Errorf("%w: node %d is written more than once", ErrInvalidTransaction, write.NodeID)
+		}
+		seen[write.NodeID] = true
+	}
+
+	s.nextTxID++
+	tx := Transaction{ID: s.nextTxID, Outcome: TxCommitted, Time: time.Now()}
+
+	// Phase 1: prepare. The phase lasts as long as the longest backoff
+	// before a participant answered or was given up on.
+	coordinator := writes[0].NodeID
+	var backoff time.Duration
+	waits := make([]time.Duration, len(writes))
+	for i, write := range writes {
+		waited, ok := s.retryOp(context.Background(), RetryPrepare, func() error {
+			if write.NodeID != coordinator && !s.deliver(coordinator, write.NodeID) {
+				return errMessageLost
+			}
+			if s.nodes[s.findNode(write.NodeID)].Status != StatusUp {
+				return errNodeDown
+			}
+			return nil
+		})
+		backoff = max(backoff, waited)
+		waits[i] = waited
+		vote := VoteYes
+		if !ok {
+			vote = VoteNo
+			tx.Outcome = TxAborted
+		}
+		tx.Participants = append(tx.Participants, TxParticipant{NodeID: write.NodeID, Value: write.Value, Vote: vote})
+	}
+
+	prepareTrips, prepared := s.roundTrips(tx.Participants)
+	finishTrips, finished := s.roundTrips(tx.Participants)
+	tx.Duration = Duration(backoff + prepared + finished)
+
+	// The trace times each call by the round trip to its participant in its
+	// phase, after any backoff in the prepare phase.
+	now := s.cfg.Clock.Now()
+	root := t.start(0, "2pc", coordinator, now)
+	decided := now.Add(backoff + prepared)
+	for i, p := range tx.Participants {
+		var err error
+		if p.Vote == VoteNo {
+			err = errVotedNo
+		}
+		t.record(root, "2pc.prepare", p.NodeID, now, now.Add(waits[i]+prepareTrips[i]), err)
+	}
+	phase := "2pc.commit"
+	if tx.Outcome == TxAborted {
+		phase = "2pc.abort"
+	}
+	for i, p := range tx.Participants {
+		t.record(root, phase, p.NodeID, decided, decided.Add(finishTrips[i]), nil)
+	}
+	t.end(root, now.Add(time.Duration(tx.Duration)), nil)
+
+	// Phase 2: commit or abort.
+	for i := range tx.Participants {
+		p := &tx.Participants[i]
+		p.Outcome = tx.Outcome
+		if tx.Outcome == TxCommitted {
+			index := s.findNode(p.NodeID)
+			s.nodes[index].Value = p.Value
+			s.nodes[index].tick()
+			s.publish(EventNodeUpdated, index)
+		}
+	}
+
+	s.transactions[tx.ID] = tx
+	s.txDurations.observe(time.Duration(tx.Duration).Seconds())
+	s.logger.Info("transaction finished", "tx_id", tx.ID, "outcome", tx.Outcome, "participants", len(tx.Participants))
+	return tx.clone(), nil
+}
+
+// roundTrips returns the round trip of one phase of a two-phase commit from
+// the first participant, the coordinator, to each participant, and the time
+// the phase takes: the slowest of them. The caller must hold s.mu for
+// writing.
+func (s *Simulator) roundTrips(participants []TxParticipant) ([]time.Duration, time.Duration) {
+	coordinator := participants[0].NodeID
+	trips := make([]time.Duration, len(participants))
+	var slowest time.Duration
+	for i, p := range participants {
+		trips[i] = s.messageDelay(coordinator, p.NodeID) + s.messageDelay(p.NodeID, coordinator)
+		slowest = max(slowest, trips[i])
+	}
+	return trips, slowest
+}
+
+// Transaction returns the record of the transaction with the given ID and
+// false if no such transaction exists.
+func (s *Simulator) Transaction(id int) (Transaction, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tx, ok := s.transactions[id]
+	if !ok {
+		return Transaction{}, false
+	}
+	return tx.clone(), true
+}
@@ -0,0 +1,129 @@
+package simulator
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// TestTransactionCommit tests that a transaction whose participants are all
+// up commits every write.
+func TestTransactionCommit(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	rr := doRequest(t, h, "POST", "/transactions", `{"writes":[{"node_id":0,"value":10},{"node_id":2,"value":20}]}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, but got %d: %s", http.StatusCreated, rr.Code, rr.Body)
+	}
+	var tx Transaction
+	decodeBody(t, rr, &tx)
+
+	if tx.ID != 1 || tx.Outcome != TxCommitted {
+		t.Fatalf("Expected transaction 1 to commit, got %+v", tx)
+	}
+	for _, p := range tx.Participants {
+		if p.Vote != VoteYes || p.Outcome != TxCommitted {
+			t.Errorf("Expected participant %d to vote yes and commit, got %+v", p.NodeID, p)
+		}
+	}
+	for id, want := range map[int]int{0: 10, 2: 20} {
+		if node, _ := s.Node(id); node.Value != want {
+			t.Errorf("Expected node %d to hold %d, got %d", id, want, node.Value)
+		}
+	}
+}
+
+// TestTransactionAbort tests that a down participant votes no, aborting the
+// transaction without changing any node.
+func TestTransactionAbort(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	s.Fail(3)
+	before := s.Snapshot()
+
+	tx, err := s.RunTransaction([]TxWrite{{NodeID: 1, Value: 11}, {NodeID: 3, Value: 33}})
+	if err != nil {
+		t.Fatalf("RunTransaction: %v", err)
+	}
+	if tx.Outcome != TxAborted {
+		t.Fatalf("Expected the transaction to abort, got %+v", tx)
+	}
+	want := []TxParticipant{
+		{NodeID: 1, Value: 11, Vote: VoteYes, Outcome: TxAborted},
+		{NodeID: 3, Value: 33, Vote: VoteNo, Outcome: TxAborted},
+	}
+	if !reflect.DeepEqual(tx.Participants, want) {
+		t.Errorf("Expected participants %+v, got %+v", want, tx.Participants)
+	}
+	if after := s.Snapshot(); !reflect.DeepEqual(before, after) {
+		t.Errorf("Aborted transaction changed nodes: %+v", after)
+	}
+}
+
+// TestTransactionRecord tests that GET /transactions/{id} returns the same
+// record every time it is queried.
+func TestTransactionRecord(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	var created Transaction
+	decodeBody(t, doRequest(t, h, "POST", "/transactions", `{"writes":[{"node_id":4,"value":1}]}`), &created)
+
+	for i := 0; i < 2; i++ {
+		rr := doRequest(t, h, "GET", "/transactions/1", "")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status code %d, but got %d", http.StatusOK, rr.Code)
+		}
+		var got Transaction
+		decodeBody(t, rr, &got)
+		if !reflect.DeepEqual(got, created) {
+			t.Errorf("Query %d returned %+v, expected %+v", i, got, created)
+		}
+	}
+
+	// Later changes to the node don't rewrite history.
+	s.SetNode(4, "Node-4", 99)
+	var got Transaction
+	decodeBody(t, doRequest(t, h, "GET", "/transactions/1", ""), &got)
+	if got.Participants[0].Value != 1 {
+		t.Errorf("Expected the record to keep value 1, got %d", got.Participants[0].Value)
+	}
+
+	for path, want := range map[string]int{
+		"/transactions/2":   http.StatusNotFound,
+		"/transactions/abc": http.StatusBadRequest,
+	} {
+		if rr := doRequest(t, h, "GET", path, ""); rr.Code != want {
+			t.Errorf("GET %s: expected status code %d, but got %d", path, want, rr.Code)
+		}
+	}
+}
+
+// TestTransactionInvalid tests that malformed transactions are rejected
+// before the prepare phase.
+func TestTransactionInvalid(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+
+	for name, writes := range map[string][]TxWrite{
+		"empty":     nil,
+		"missing":   {{NodeID: 42, Value: 1}},
+		"duplicate": {{NodeID: 1, Value: 1}, {NodeID: 1, Value: 2}},
+	} {
+		if _, err := s.RunTransaction(writes); !errors.Is(err, ErrInvalidTransaction) {
+			t.Errorf("%s: expected ErrInvalidTransaction, got %v", name, err)
+		}
+	}
+	if _, ok := s.Transaction(1); ok {
+		t.Error("Rejected transactions must not be recorded")
+	}
+
+	rr := doRequest(t, s.Handler(), "POST", "/transactions", `{"writes":[]}`)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, but got %d", http.StatusBadRequest, rr.Code)
+	}
+}
@@ -0,0 +1,73 @@
+package simulator
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"time"
+)
+
+// uiFiles holds the dashboard served under /ui.
+//
+//go:embed ui
+var uiFiles embed.FS
+
+// uiETags maps each file in uiFiles to a strong ETag of its contents. The
+// files only change with the binary, so browsers may cache them but must
+// revalidate with If-None-Match, which answers 304 until the next build.
+var uiETags = func() map[string]string {
+	etags := map[string]string{}
+	err := fs.WalkDir(uiFiles, "ui", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := uiFiles.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		etags[name] = `"` + hex.EncodeToString(sum[:8]) + `"`
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+	return etags
+}()
+
+// serveUI serves the dashboard page.
+func (s *Simulator) serveUI(w http.ResponseWriter, r *http.Request) {
+	serveUIFile(w, r, "ui/index.html")
+}
+
+// serveUIAsset serves the dashboard file named by the {file} path value, or
+// the page itself for /ui/.
+func (s *Simulator) serveUIAsset(w http.ResponseWriter, r *http.Request) {
+	file := r.PathValue("file")
+	if file == "" {
+		file = "index.html"
+	}
+	serveUIFile(w, r, "ui/"+file)
+}
+
+// serveUIFile serves the embedded file name, answering conditional requests
+// with 304 Not Modified.
+func serveUIFile(w http.ResponseWriter, r *http.Request, name string) {
+	etag, ok := uiETags[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, "No dashboard file at "+r.URL.Path)
+		return
+	}
+	data, err := uiFiles.ReadFile(name)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to read dashboard file")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(data))
+}
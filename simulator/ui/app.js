@@ -0,0 +1,144 @@
+// Dashboard for the simulator's HTTP API. It loads /nodes, then applies the
+// changes streamed by /events, falling back to polling when the stream is
+// unavailable.
+"use strict";
+
+const pollInterval = 2000;
+
+const nodes = new Map();
+const keyInput = document.getElementById("api-key");
+const statusText = document.getElementById("status");
+const errorText = document.getElementById("error");
+
+keyInput.value = localStorage.getItem("apiKey") || "";
+keyInput.addEventListener("change", () => {
+  localStorage.setItem("apiKey", keyInput.value);
+  refresh();
+});
+
+// api calls the JSON API, sending the API key if one is set, and returns the
+// decoded response body, or null for an empty one.
+async function api(method, path, body) {
+  const headers = {};
+  if (keyInput.value) {
+    headers["X-API-Key"] = keyInput.value;
+  }
+  if (body !== undefined) {
+    headers["Content-Type"] = "application/json";
+  }
+  const resp = await fetch(path, {
+    method,
+    headers,
+    body: body === undefined ? undefined : JSON.stringify(body),
+  });
+  const text = await resp.text();
+  const data = text ? JSON.parse(text) : null;
+  if (!resp.ok) {
+    throw new Error(data && data.error ? data.error.message : resp.statusText);
+  }
+  return data;
+}
+
+// run performs an action, reporting any error below the table.
+async function run(action) {
+  try {
+    await action();
+    errorText.textContent = "";
+  } catch (err) {
+    errorText.textContent = err.message;
+  }
+}
+
+async function refresh() {
+  await run(async () => {
+    const list = await api("GET", "/nodes");
+    nodes.clear();
+    for (const node of list) {
+      nodes.set(node.id, node);
+    }
+    render();
+  });
+}
+
+function button(label, onClick) {
+  const b = document.createElement("button");
+  b.textContent = label;
+  b.addEventListener("click", onClick);
+  return b;
+}
+
+function render() {
+  const body = document.getElementById("nodes");
+  body.replaceChildren();
+  const sorted = [...nodes.values()].sort((a, b) => a.id - b.id);
+  for (const node of sorted) {
+    const row = body.insertRow();
+    row.insertCell().textContent = node.id;
+    row.insertCell().textContent = node.name;
+    const value = row.insertCell();
+    value.className = "value";
+    value.textContent = node.value;
+    const status = row.insertCell();
+    status.className = node.status;
+    status.textContent = node.status + (node.leader ? " (leader)" : "");
+    row.insertCell().textContent = new Date(node.time).toLocaleTimeString();
+
+    const actions = row.insertCell();
+    if (node.status === "up") {
+      actions.append(button("Fail", () => run(() => api("POST", `/nodes/${node.id}/fail`).then(apply))));
+    } else {
+      actions.append(button("Recover", () => run(() => api("POST", `/nodes/${node.id}/recover`).then(apply))));
+    }
+    actions.append(button("Update", () => {
+      const input = prompt(`New value for ${node.name}`, node.value);
+      if (input === null) {
+        return;
+      }
+      run(() => api("PUT", `/nodes/${node.id}`, { name: node.name, value: Number(input) }).then(apply));
+    }));
+  }
+}
+
+// apply records an updated node returned by the API and re-renders.
+function apply(node) {
+  nodes.set(node.id, node);
+  render();
+}
+
+function poll() {
+  statusText.textContent = "Polling";
+  setInterval(refresh, pollInterval);
+}
+
+function stream() {
+  if (!window.EventSource) {
+    poll();
+    return;
+  }
+  const events = new EventSource("/events");
+  let opened = false;
+  events.addEventListener("open", () => {
+    opened = true;
+    statusText.textContent = "Live";
+    refresh();
+  });
+  events.addEventListener("error", () => {
+    if (!opened) {
+      // The stream is unavailable, for example because reads need a key.
+      events.close();
+      poll();
+      return;
+    }
+    statusText.textContent = "Reconnecting…";
+  });
+  for (const type of ["node.updated", "node.failed", "node.recovered", "node.added"]) {
+    events.addEventListener(type, (e) => apply(JSON.parse(e.data).node));
+  }
+  events.addEventListener("node.removed", (e) => {
+    nodes.delete(JSON.parse(e.data).node.id);
+    render();
+  });
+}
+
+refresh();
+stream();
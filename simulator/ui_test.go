@@ -0,0 +1,68 @@
+package simulator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestUI tests that /ui serves the dashboard page and its embedded assets.
+func TestUI(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	for _, path := range []string{"/ui", "/ui/"} {
+		rr := doRequest(t, h, "GET", path, "")
+		expectCode(t, rr, http.StatusOK)
+		if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, mediaHTML) {
+			t.Errorf("GET %s: expected HTML, got %q", path, ct)
+		}
+		if !strings.Contains(rr.Body.String(), `<script src="/ui/app.js">`) {
+			t.Errorf("GET %s: expected the page to load the dashboard script", path)
+		}
+	}
+
+	for path, media := range map[string]string{"/ui/app.js": "text/javascript", "/ui/style.css": "text/css"} {
+		rr := doRequest(t, h, "GET", path, "")
+		expectCode(t, rr, http.StatusOK)
+		if ct := rr.Header().Get("Content-Type"); !strings.HasPrefix(ct, media) {
+			t.Errorf("GET %s: expected %s, got %q", path, media, ct)
+		}
+		if rr.Body.Len() == 0 {
+			t.Errorf("GET %s: expected a non-empty file", path)
+		}
+	}
+
+	expectCode(t, doRequest(t, h, "GET", "/ui/missing.js", ""), http.StatusNotFound)
+
+	// The dashboard does not shadow the JSON API.
+	var nodes []NodeData
+	decodeBody(t, doRequest(t, h, "GET", "/nodes", ""), &nodes)
+	if len(nodes) != testNodeCount {
+		t.Errorf("Expected %d nodes, got %d", testNodeCount, len(nodes))
+	}
+}
+
+// TestUICaching tests that dashboard files must be revalidated and answer a
+// matching If-None-Match with 304.
+func TestUICaching(t *testing.T) {
+	s := New(Config{})
+	h := s.Handler()
+
+	rr := doRequest(t, h, "GET", "/ui/app.js", "")
+	if got := rr.Header().Get("Cache-Control"); got != "no-cache" {
+		t.Errorf("Expected Cache-Control no-cache, got %q", got)
+	}
+	etag := rr.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("Expected an ETag")
+	}
+
+	req := httptest.NewRequest("GET", "/ui/app.js", nil)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	expectCode(t, rr, http.StatusNotModified)
+}
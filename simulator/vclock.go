@@ -0,0 +1,101 @@
+package simulator
+
+import (
+	"encoding/xml"
+	"sort"
+)
+
+// VectorClock maps node IDs to the number of events observed from each node.
+// It captures causality between node states, which timestamps alone cannot.
+type VectorClock map[int]uint64
+
+// Causal relations between two vector clocks, as returned by Compare.
+const (
+	HappensBefore = "happens-before" // Every event in a is also in b.
+	HappensAfter  = "happens-after"  // Every event in b is also in a.
+	Concurrent    = "concurrent"     // Each clock has events the other lacks.
+	Equal         = "equal"          // Both clocks contain the same events.
+)
+
+// Compare reports the causal relation of vc to other.
+func (vc VectorClock) Compare(other VectorClock) string {
+	less, greater := false, false
+	for id, n := range vc {
+		if n > other[id] {
+			greater = true
+		}
+	}
+	for id, n := range other {
+		if n > vc[id] {
+			less = true
+		}
+	}
+
+	switch {
+	case less && greater:
+		return Concurrent
+	case less:
+		return HappensBefore
+	case greater:
+		return HappensAfter
+	default:
+		return Equal
+	}
+}
+
+// clone returns a copy of vc that shares no memory with it.
+func (vc VectorClock) clone() VectorClock {
+	c := make(VectorClock, len(vc))
+	for id, n := range vc {
+		c[id] = n
+	}
+	return c
+}
+
+// merge sets every entry of vc to the maximum of its own and other's.
+func (vc VectorClock) merge(other VectorClock) {
+	for id, n := range other {
+		if n > vc[id] {
+			vc[id] = n
+		}
+	}
+}
+
+// vectorClockEntry is the XML encoding of one entry of a VectorClock.
+type vectorClockEntry struct {
+	Node  int    `xml:"node,attr"`
+	Count uint64 `xml:",chardata"`
+}
+
+// MarshalXML encodes vc as one <entry node="id">count</entry> element per
+// node, in order of node ID.
+func (vc VectorClock) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	ids := make([]int, 0, len(vc))
+	for id := range vc {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	entries := make([]vectorClockEntry, len(ids))
+	for i, id := range ids {
+		entries[i] = vectorClockEntry{Node: id, Count: vc[id]}
+	}
+	return e.EncodeElement(struct {
+		Entries []vectorClockEntry `xml:"entry"`
+	}{entries}, start)
+}
+
+// UnmarshalXML decodes the encoding produced by MarshalXML.
+func (vc *VectorClock) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var body struct {
+		Entries []vectorClockEntry `xml:"entry"`
+	}
+	if err := d.DecodeElement(&body, &start); err != nil {
+		return err
+	}
+	*vc = make(VectorClock, len(body.Entries))
+	for _, entry := range body.Entries {
+		(*vc)[entry.Node] = entry.Count
+	}
+	return nil
+}
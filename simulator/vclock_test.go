@@ -0,0 +1,92 @@
+package simulator
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// TestVectorClockCompare tests each causal relation reported by Compare.
+func TestVectorClockCompare(t *testing.T) {
+	tests := []struct {
+		a, b VectorClock
+		want string
+	}{
+		{VectorClock{}, VectorClock{}, Equal},
+		{VectorClock{0: 1, 1: 2}, VectorClock{0: 1, 1: 2}, Equal},
+		{VectorClock{0: 1}, VectorClock{0: 1, 1: 1}, HappensBefore},
+		{VectorClock{0: 2, 1: 1}, VectorClock{0: 1}, HappensAfter},
+		{VectorClock{0: 1}, VectorClock{1: 1}, Concurrent},
+		{VectorClock{0: 2, 1: 1}, VectorClock{0: 1, 1: 2}, Concurrent},
+	}
+
+	for _, tt := range tests {
+		if got := tt.a.Compare(tt.b); got != tt.want {
+			t.Errorf("%v.Compare(%v): expected %q, but got %q", tt.a, tt.b, tt.want, got)
+		}
+	}
+}
+
+// causality returns the relation reported by GET /causality for nodes a and b.
+func causality(t *testing.T, h http.Handler, a, b int) string {
+	t.Helper()
+
+	rr := doRequest(t, h, "GET", fmt.Sprintf("/causality?a=%d&b=%d", a, b), "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, rr.Code)
+	}
+	var resp causalityResponse
+	decodeBody(t, rr, &resp)
+	return resp.Relation
+}
+
+// TestCausality tests that concurrent updates on two nodes are reported as
+// concurrent, and that gossip establishes a happens-before relation.
+func TestCausality(t *testing.T) {
+	s := New(Config{Seed: 1, Mode: ModeGossip})
+	s.Init(2)
+	h := s.Handler()
+
+	// Independent updates on two nodes are concurrent.
+	s.SetNode(0, "Node-0", 10)
+	s.SetNode(1, "Node-1", 20)
+	if got := causality(t, h, 0, 1); got != Concurrent {
+		t.Errorf("Expected concurrent updates, but got %q", got)
+	}
+
+	// Once node 0 learns node 1's newer value, node 1's state happens
+	// before node 0's.
+	s.GossipRound()
+	if got := causality(t, h, 1, 0); got != HappensBefore {
+		t.Errorf("Expected node 1 to happen before node 0, but got %q", got)
+	}
+	if got := causality(t, h, 0, 1); got != HappensAfter {
+		t.Errorf("Expected node 0 to happen after node 1, but got %q", got)
+	}
+
+	// The clock endpoint reflects the merge.
+	rr := doRequest(t, h, "GET", "/nodes/0/clock", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status code %d, but got %d", http.StatusOK, rr.Code)
+	}
+	var clock struct {
+		ID          int         `json:"id"`
+		VectorClock VectorClock `json:"vector_clock"`
+	}
+	decodeBody(t, rr, &clock)
+	want := VectorClock{0: 3, 1: 2}
+	if clock.ID != 0 || clock.VectorClock.Compare(want) != Equal {
+		t.Errorf("Expected clock %v for node 0, but got %v", want, clock.VectorClock)
+	}
+
+	// Bad and unknown IDs.
+	if rr := doRequest(t, h, "GET", "/causality?a=0", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code %d, but got %d", http.StatusBadRequest, rr.Code)
+	}
+	if rr := doRequest(t, h, "GET", "/causality?a=0&b=9", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, but got %d", http.StatusNotFound, rr.Code)
+	}
+	if rr := doRequest(t, h, "GET", "/nodes/9/clock", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status code %d, but got %d", http.StatusNotFound, rr.Code)
+	}
+}
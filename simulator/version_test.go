@@ -0,0 +1,127 @@
+package simulator
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// putIfMatch sends PUT /nodes/{id} with body and an If-Match header.
+func putIfMatch(h http.Handler, id int, ifMatch, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("PUT", fmt.Sprintf("/nodes/%d", id), strings.NewReader(body))
+	req.Header.Set("If-Match", ifMatch)
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+// TestNodeVersion tests that a node's version starts at 1 and increases with
+// every change to it.
+func TestNodeVersion(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+
+	version := func() uint64 {
+		node, _ := s.Node(0)
+		return node.Version
+	}
+	if got := version(); got != 1 {
+		t.Fatalf("Expected a fresh node at version 1, got %d", got)
+	}
+	s.SetNode(0, "a", 1)
+	s.Fail(0)
+	s.Recover(0)
+	if got := version(); got != 4 {
+		t.Errorf("Expected version 4 after three changes, got %d", got)
+	}
+	if node := s.AddNode("new", 5); node.Version != 1 {
+		t.Errorf("Expected an added node at version 1, got %d", node.Version)
+	}
+}
+
+// TestConditionalPut tests PUT /nodes/{id} with If-Match and a version in
+// the body.
+func TestConditionalPut(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	rr := doRequest(t, h, "GET", "/nodes/1", "")
+	if got := rr.Header().Get("ETag"); got != `"1"` {
+		t.Fatalf("Expected ETag %q, got %q", `"1"`, got)
+	}
+
+	rr = putIfMatch(h, 1, `"1"`, `{"name":"a","value":1}`)
+	expectCode(t, rr, http.StatusOK)
+	var node NodeData
+	decodeBody(t, rr, &node)
+	if node.Version != 2 || rr.Header().Get("ETag") != `"2"` {
+		t.Errorf("Expected version 2 and ETag \"2\", got %d and %q", node.Version, rr.Header().Get("ETag"))
+	}
+
+	// A stale version conflicts and leaves the node alone.
+	rr = putIfMatch(h, 1, `"1"`, `{"name":"b","value":2}`)
+	expectCode(t, rr, http.StatusConflict)
+	var body ErrorResponse
+	decodeBody(t, rr, &body)
+	if body.Error.Code != ErrorCodeConflict {
+		t.Errorf("Expected code %q, got %q", ErrorCodeConflict, body.Error.Code)
+	}
+	if got := rr.Header().Get("ETag"); got != `"2"` {
+		t.Errorf("Expected the conflict to report the current ETag, got %q", got)
+	}
+	if current, _ := s.Node(1); current.Name != "a" {
+		t.Errorf("Expected the conflicting update to be rejected, got name %q", current.Name)
+	}
+
+	// The version can also be sent in the body.
+	expectCode(t, doRequest(t, h, "PUT", "/nodes/1", `{"name":"c","value":3,"version":1}`), http.StatusConflict)
+	expectCode(t, doRequest(t, h, "PUT", "/nodes/1", `{"name":"c","value":3,"version":2}`), http.StatusOK)
+
+	// Unconditional updates still win, and * matches any version.
+	expectCode(t, doRequest(t, h, "PUT", "/nodes/1", `{"name":"d","value":4}`), http.StatusOK)
+	expectCode(t, putIfMatch(h, 1, "*", `{"name":"e","value":5}`), http.StatusOK)
+
+	expectCode(t, putIfMatch(h, 1, "soon", `{"name":"f","value":6}`), http.StatusBadRequest)
+	expectCode(t, putIfMatch(h, 1, `"5"`, `{"name":"f","value":6,"version":4}`), http.StatusBadRequest)
+	expectCode(t, putIfMatch(h, 99, `"1"`, `{"name":"f","value":6}`), http.StatusNotFound)
+	expectCode(t, doRequest(t, h, "POST", "/nodes", `{"name":"g","value":7,"version":1}`), http.StatusBadRequest)
+}
+
+// TestConditionalPutRace tests that of several clients updating the same
+// node from the same version, exactly one succeeds.
+func TestConditionalPutRace(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	h := s.Handler()
+	const clients = 8
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	codes := make(chan int, clients)
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			codes <- putIfMatch(h, 2, `"1"`, fmt.Sprintf(`{"name":"client-%d","value":%d}`, i, i)).Code
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	close(codes)
+
+	counts := map[int]int{}
+	for code := range codes {
+		counts[code]++
+	}
+	if counts[http.StatusOK] != 1 || counts[http.StatusConflict] != clients-1 {
+		t.Errorf("Expected one success and %d conflicts, got %v", clients-1, counts)
+	}
+	if node, _ := s.Node(2); node.Version != 2 {
+		t.Errorf("Expected the node at version 2, got %d", node.Version)
+	}
+}
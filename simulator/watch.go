@@ -0,0 +1,249 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Limits on how long a watch waits for a change.
+const (
+	DefaultWatchTimeout = 30 * time.Second
+	MaxWatchTimeout     = 5 * time.Minute
+)
+
+var (
+	// ErrWatchTimeout means a watch saw no change before its timeout.
+	ErrWatchTimeout = errors.New("no change before the watch timed out")
+
+	// ErrDraining means the simulator is shutting down, so it stopped
+	// waiting.
+	ErrDraining = errors.New("simulator is draining")
+)
+
+// watchers wakes the watches waiting for a change. Each channel is closed
+// when its change happens, and is replaced by the next watch to wait.
+type watchers struct {
+	nodes map[int]chan struct{} // Closed when the node with that ID changes.
+	log   chan struct{}         // Closed when an event is logged; nil until waited on.
+}
+
+// nodeChanged returns a channel closed once the node with the given ID next
+// changes. The caller must hold s.feedMu.
+func (s *Simulator) nodeChanged(id int) <-chan struct{} {
+	if s.watch.nodes == nil {
+		s.watch.nodes = make(map[int]chan struct{})
+	}
+	ch, ok := s.watch.nodes[id]
+	if !ok {
+		ch = make(chan struct{})
+		s.watch.nodes[id] = ch
+	}
+	return ch
+}
+
+// eventLogged returns a channel closed once the next event is logged. The
+// caller must hold s.feedMu.
+func (s *Simulator) eventLogged() <-chan struct{} {
+	if s.watch.log == nil {
+		s.watch.log = make(chan struct{})
+	}
+	return s.watch.log
+}
+
+// wakeWatchers wakes the watches of the node with the given ID, or of every
+// node if id is negative, and of the event log. The caller must hold
+// s.feedMu.
+func (s *Simulator) wakeWatchers(id int) {
+	for watched, ch := range s.watch.nodes {
+		if id < 0 || watched == id {
+			close(ch)
+			delete(s.watch.nodes, watched)
+		}
+	}
+	if s.watch.log != nil {
+		close(s.watch.log)
+		s.watch.log = nil
+	}
+}
+
+// WatchNode waits until the version of the node with the given ID exceeds
+// version, and returns the node then. The wait is woken by the node's
+// changes, not by polling, and timeout is measured in real time, since it
+// bounds how long a client's request is held. A non-positive timeout means
+// DefaultWatchTimeout. It returns ErrNodeNotFound if no such node exists or
+// it is removed meanwhile, ErrWatchTimeout along with the unchanged node if
+// the timeout passes first, ErrDraining if the simulator starts draining,
+// and ctx's error if it is done first.
+func (s *Simulator) WatchNode(ctx context.Context, id int, version uint64, timeout time.Duration) (NodeData, error) {
+	timer := time.NewTimer(watchTimeout(timeout))
+	defer timer.Stop()
+
+	for {
+		// Take the channel before reading the node, so a change made in
+		// between still wakes the watch.
+		s.feedMu.Lock()
+		changed := s.nodeChanged(id)
+		s.feedMu.Unlock()
+		node, ok := s.Node(id)
+		switch {
+		case !ok:
+			// Don't keep a channel for a node that doesn't exist. Any other
+			// watch waiting on it wakes and finds the node gone too.
+			s.feedMu.Lock()
+			if ch, ok := s.watch.nodes[id]; ok {
+				close(ch)
+				delete(s.watch.nodes, id)
+			}
+			s.feedMu.Unlock()
+			return NodeData{}, ErrNodeNotFound
+		case node.Version > version:
+			return node, nil
+		}
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			return node, ErrWatchTimeout
+		case <-s.drained:
+			return node, ErrDraining
+		case <-ctx.Done():
+			return node, ctx.Err()
+		}
+	}
+}
+
+// WatchEvents waits until the event log holds events with a sequence number
+// above since, and returns up to limit of them as EventHistory does. Like
+// WatchNode, it is woken by each event logged and its timeout is real time.
+// It returns ErrWatchTimeout along with an empty page if the timeout passes
+// first, ErrDraining if the simulator starts draining, and ctx's error if it
+// is done first.
+func (s *Simulator) WatchEvents(ctx context.Context, since uint64, limit int, timeout time.Duration) (EventPage, error) {
+	timer := time.NewTimer(watchTimeout(timeout))
+	defer timer.Stop()
+
+	for {
+		s.feedMu.Lock()
+		logged := s.eventLogged()
+		s.feedMu.Unlock()
+		page := s.EventHistory(since, limit)
+		if len(page.Events) > 0 {
+			return page, nil
+		}
+
+		select {
+		case <-logged:
+		case <-timer.C:
+			return page, ErrWatchTimeout
+		case <-s.drained:
+			return page, ErrDraining
+		case <-ctx.Done():
+			return page, ctx.Err()
+		}
+	}
+}
+
+// watchTimeout returns timeout, or DefaultWatchTimeout if it is not
+// positive.
+func watchTimeout(timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		return DefaultWatchTimeout
+	}
+	return timeout
+}
+
+// watchTimeoutParam returns the "timeout" query parameter of r. It writes a
+// 400 response and returns false if it is not a duration up to
+// MaxWatchTimeout.
+func watchTimeoutParam(w http.ResponseWriter, r *http.Request) (time.Duration, bool) {
+	timeout, err := durationParam(r.URL.Query(), "timeout", DefaultWatchTimeout)
+	if err != nil || timeout <= 0 || timeout > MaxWatchTimeout {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Query parameter \"timeout\" must be a positive duration up to %v", MaxWatchTimeout))
+		return 0, false
+	}
+	return timeout, true
+}
+
+// watchNode handles HTTP requests that wait for a node's version to exceed
+// the "version" query parameter, responding 304 if it doesn't before the
+// timeout.
+func (s *Simulator) watchNode(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseNodeID(w, r)
+	if !ok {
+		return
+	}
+	var version uint64
+	if v := r.URL.Query().Get("version"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Query parameter \"version\" must be a node version")
+			return
+		}
+		version = n
+	}
+	timeout, ok := watchTimeoutParam(w, r)
+	if !ok {
+		return
+	}
+
+	node, err := s.WatchNode(r.Context(), id, version, timeout)
+	switch {
+	case errors.Is(err, ErrNodeNotFound):
+		writeError(w, http.StatusNotFound, "Node not found")
+	case errors.Is(err, ErrWatchTimeout):
+		w.Header().Set("ETag", nodeETag(node))
+		w.WriteHeader(http.StatusNotModified)
+	case errors.Is(err, ErrDraining):
+		writeError(w, http.StatusServiceUnavailable, "Simulator is shutting down")
+	case err != nil:
+		// The client went away; nobody reads the response.
+	default:
+		w.Header().Set("ETag", nodeETag(node))
+		writeJSON(w, http.StatusOK, node)
+	}
+}
+
+// watchEvents handles HTTP requests that wait for events after the
+// "since_seq" query parameter, responding 304 if none is logged before the
+// timeout.
+func (s *Simulator) watchEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var since uint64
+	if v := query.Get("since_seq"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Query parameter \"since_seq\" must be a sequence number")
+			return
+		}
+		since = n
+	}
+	limit := DefaultHistoryLimit
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxHistoryLimit {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Query parameter \"limit\" must be between 1 and %d", MaxHistoryLimit))
+			return
+		}
+		limit = n
+	}
+	timeout, ok := watchTimeoutParam(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := s.WatchEvents(r.Context(), since, limit, timeout)
+	switch {
+	case errors.Is(err, ErrWatchTimeout):
+		w.WriteHeader(http.StatusNotModified)
+	case errors.Is(err, ErrDraining):
+		writeError(w, http.StatusServiceUnavailable, "Simulator is shutting down")
+	case err != nil:
+		// The client went away; nobody reads the response.
+	default:
+		writeJSON(w, http.StatusOK, page)
+	}
+}
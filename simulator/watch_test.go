@@ -0,0 +1,140 @@
+package simulator
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// startWatch sends a GET request for path to h in its own goroutine, and
+// returns a channel that receives the response once the handler returns.
+func startWatch(h http.Handler, path string) <-chan *httptest.ResponseRecorder {
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		done <- rr
+	}()
+	return done
+}
+
+// awaitWatch returns the response from done, failing t if it takes longer
+// than a second.
+func awaitWatch(t *testing.T, done <-chan *httptest.ResponseRecorder) *httptest.ResponseRecorder {
+	t.Helper()
+	select {
+	case rr := <-done:
+		return rr
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for the watch to return")
+		return nil
+	}
+}
+
+// watching reports whether a watch is waiting on the node with the given ID.
+func watching(s *Simulator, id int) bool {
+	s.feedMu.Lock()
+	defer s.feedMu.Unlock()
+	_, ok := s.watch.nodes[id]
+	return ok
+}
+
+// TestWatchNode tests that a watch returns a node once it changes, and 304
+// if it doesn't before the timeout.
+func TestWatchNode(t *testing.T) {
+	s := New(Config{Seed: 1})
+	s.Init(testNodeCount)
+	h := s.Handler()
+	node, _ := s.Node(1)
+	version := strconv.FormatUint(node.Version, 10)
+
+	done := startWatch(h, "/nodes/1/watch?timeout=10s&version="+version)
+	waitFor(t, func() bool { return watching(s, 1) })
+	select {
+	case rr := <-done:
+		t.Fatalf("Expected the watch to block, got %d: %s", rr.Code, rr.Body)
+	default:
+	}
+	go s.SetNode(1, "watched", 42)
+
+	rr := awaitWatch(t, done)
+	expectCode(t, rr, http.StatusOK)
+	var got NodeData
+	decodeBody(t, rr, &got)
+	if got.Name != "watched" || got.Version != node.Version+1 || rr.Header().Get("ETag") != nodeETag(got) {
+		t.Errorf("Expected the updated node, got %+v with ETag %s", got, rr.Header().Get("ETag"))
+	}
+
+	// Changes to other nodes don't end the watch.
+	done = startWatch(h, "/nodes/1/watch?timeout=50ms&version="+strconv.FormatUint(got.Version, 10))
+	waitFor(t, func() bool { return watching(s, 1) })
+	s.SetNode(2, "other", 1)
+	rr = awaitWatch(t, done)
+	expectCode(t, rr, http.StatusNotModified)
+	if rr.Header().Get("ETag") != nodeETag(got) || rr.Body.Len() != 0 {
+		t.Errorf("Expected an empty 304 with the current ETag, got %s: %q", rr.Header().Get("ETag"), rr.Body)
+	}
+
+	// An older version returns at once.
+	expectCode(t, doRequest(t, h, "GET", "/nodes/1/watch?version=0", ""), http.StatusOK)
+
+	// Removing the watched node ends the watch.
+	done = startWatch(h, "/nodes/3/watch?timeout=10s&version=99")
+	waitFor(t, func() bool { return watching(s, 3) })
+	go s.RemoveNode(3)
+	expectCode(t, awaitWatch(t, done), http.StatusNotFound)
+	if watching(s, 3) {
+		t.Error("Expected no watch channel kept for a removed node")
+	}
+
+	expectCode(t, doRequest(t, h, "GET", "/nodes/9/watch", ""), http.StatusNotFound)
+	for _, query := range []string{"version=x", "timeout=soon", "timeout=0s", "timeout=1h"} {
+		expectCode(t, doRequest(t, h, "GET", "/nodes/1/watch?"+query, ""), http.StatusBadRequest)
+	}
+}
+
+// TestWatchEvents tests that a watch of the event log returns the events
+// logged after since_seq.
+func TestWatchEvents(t *testing.T) {
+	s := New(Config{Seed: 1})
+	s.Init(testNodeCount)
+	h := s.Handler()
+	s.SetNode(0, "first", 1)
+	since := s.EventHistory(0, 0).Next
+
+	done := startWatch(h, "/nodes/watch?timeout=10s&since_seq="+strconv.FormatUint(since, 10))
+	waitFor(t, func() bool {
+		s.feedMu.Lock()
+		defer s.feedMu.Unlock()
+		return s.watch.log != nil
+	})
+	go s.Fail(4)
+
+	rr := awaitWatch(t, done)
+	expectCode(t, rr, http.StatusOK)
+	var page EventPage
+	decodeBody(t, rr, &page)
+	if len(page.Events) != 1 || page.Events[0].Seq != since+1 || page.Events[0].Type != EventNodeFailed {
+		t.Fatalf("Expected the failure of node 4, got %+v", page.Events)
+	}
+
+	expectCode(t, doRequest(t, h, "GET", "/nodes/watch?timeout=20ms&since_seq="+strconv.FormatUint(page.Next, 10), ""), http.StatusNotModified)
+	expectCode(t, doRequest(t, h, "GET", "/nodes/watch?since_seq=-1", ""), http.StatusBadRequest)
+}
+
+// TestWatchDrain tests that draining the simulator releases blocked watches
+// at once.
+func TestWatchDrain(t *testing.T) {
+	s := New(Config{Seed: 1})
+	s.Init(testNodeCount)
+	h := s.Handler()
+
+	node := startWatch(h, "/nodes/0/watch?timeout=5m&version=99")
+	events := startWatch(h, "/nodes/watch?timeout=5m&since_seq=99")
+	waitFor(t, func() bool { return watching(s, 0) })
+	s.Drain()
+	expectCode(t, awaitWatch(t, node), http.StatusServiceUnavailable)
+	expectCode(t, awaitWatch(t, events), http.StatusServiceUnavailable)
+}
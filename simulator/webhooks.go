@@ -0,0 +1,411 @@
+package simulator
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// EventLeaderChanged is the type of the notification webhooks receive when
+// another node, or no node, becomes the leader. Unlike the node events, it
+// isn't kept in the event log.
+const EventLeaderChanged = "leader.changed"
+
+// DefaultWebhookMaxFailures is the number of deliveries in a row a webhook
+// may fail before it is dropped, used when Config.WebhookMaxFailures is
+// unset.
+const DefaultWebhookMaxFailures = 5
+
+// SignatureHeader is the header deliveries carry their signature in, as
+// "sha256=" followed by the hex HMAC-SHA256 of the body keyed with the
+// webhook's secret.
+const SignatureHeader = "X-Webhook-Signature"
+
+const (
+	// webhookTimeout bounds each attempt to deliver a notification.
+	webhookTimeout = 5 * time.Second
+
+	// webhookQueueSize is how many deliveries may wait for the dispatcher
+	// before the oldest are dropped.
+	webhookQueueSize = 1024
+)
+
+var (
+	// ErrInvalidWebhook means a webhook was rejected.
+	ErrInvalidWebhook = errors.New("invalid webhook")
+
+	// ErrWebhookNotFound means no webhook has the given ID.
+	ErrWebhookNotFound = errors.New("webhook not found")
+)
+
+// webhookEvents are the event types a webhook may ask for.
+var webhookEvents = []string{EventNodeUpdated, EventNodeFailed, EventNodeRecovered, EventNodeAdded, EventNodeRemoved, EventLeaderChanged}
+
+// Webhook is a URL that notifications of events are POSTed to.
+type Webhook struct {
+	ID        int       `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`           // Event types delivered; empty means every type.
+	Secret    string    `json:"secret,omitempty"` // Signs deliveries; only shown when the webhook is created.
+	Failures  int       `json:"failures"`         // Deliveries in a row that failed every attempt.
+	Delivered uint64    `json:"delivered"`
+	Created   time.Time `json:"created"`
+}
+
+// wants reports whether w is delivered events of the given type.
+func (w *Webhook) wants(eventType string) bool {
+	return len(w.Events) == 0 || slices.Contains(w.Events, eventType)
+}
+
+// WebhookPayload is the JSON body a notification is delivered with.
+type WebhookPayload struct {
+	ID             string    `json:"id"` // The same for every attempt to deliver the notification.
+	Type           string    `json:"type"`
+	Time           time.Time `json:"time"`
+	Seq            uint64    `json:"seq,omitempty"`             // Sequence number of a node event in the event log.
+	Node           *NodeData `json:"node,omitempty"`            // The node changed, or the new leader; absent if no node leads.
+	PreviousLeader *int      `json:"previous_leader,omitempty"` // ID of the node that led before a leader change, if any.
+}
+
+// webhookTable holds the registered webhooks and the notifications waiting
+// to be delivered to them. It has its own lock, so the dispatcher never
+// holds s.mu while it waits on a receiver.
+type webhookTable struct {
+	mu      sync.Mutex
+	hooks   map[int]*Webhook
+	nextID  int
+	pending []webhookDelivery
+	ready   chan struct{} // Signalled when deliveries are queued; nil until needed.
+}
+
+// webhookDelivery is a notification queued for one webhook.
+type webhookDelivery struct {
+	hook    int
+	payload WebhookPayload
+}
+
+// readyChan returns the channel signalled when deliveries are queued. The
+// caller must hold t.mu.
+func (t *webhookTable) readyChan() chan struct{} {
+	if t.ready == nil {
+		t.ready = make(chan struct{}, 1)
+	}
+	return t.ready
+}
+
+// RegisterWebhook registers url to be POSTed notifications of the given
+// event types, or of every type if there are none, signed with secret. An
+// empty secret is replaced by a random one. It returns the webhook, secret
+// included, or an error wrapping ErrInvalidWebhook if url isn't an absolute
+// HTTP or HTTPS URL or an event type is unknown.
+func (s *Simulator) RegisterWebhook(rawURL string, events []string, secret string) (Webhook, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Webhook{}, fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidWebhook)
+	}
+	for _, eventType := range events {
+		if !slices.Contains(webhookEvents, eventType) {
+			return Webhook{}, fmt.Errorf("%w: unknown event type %q", ErrInvalidWebhook, eventType)
+		}
+	}
+	if secret == "" {
+		var b [32]byte
+		rand.Read(b[:])
+		secret = hex.EncodeToString(b[:])
+	}
+
+	t := &s.webhooks
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.hooks == nil {
+		t.hooks = make(map[int]*Webhook)
+	}
+	t.nextID++
+	hook := &Webhook{ID: t.nextID, URL: u.String(), Events: slices.Clone(events), Secret: secret, Created: time.Now()}
+	t.hooks[hook.ID] = hook
+	s.logger.Info("webhook registered", "webhook_id", hook.ID, "url", hook.URL)
+	registered := *hook
+	registered.Events = slices.Clone(hook.Events)
+	return registered, nil
+}
+
+// Webhooks returns the registered webhooks in ID order, without their
+// secrets.
+func (s *Simulator) Webhooks() []Webhook {
+	t := &s.webhooks
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	hooks := make([]Webhook, 0, len(t.hooks))
+	for _, hook := range t.hooks {
+		listed := *hook
+		listed.Events = slices.Clone(hook.Events)
+		listed.Secret = ""
+		hooks = append(hooks, listed)
+	}
+	sort.Slice(hooks, func(i, j int) bool { return hooks[i].ID < hooks[j].ID })
+	return hooks
+}
+
+// DeleteWebhook stops delivering notifications to the webhook with the given
+// ID, dropping those still queued for it. It returns ErrWebhookNotFound if
+// no such webhook exists.
+func (s *Simulator) DeleteWebhook(id int) error {
+	t := &s.webhooks
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.hooks[id]; !ok {
+		return ErrWebhookNotFound
+	}
+	delete(t.hooks, id)
+	s.logger.Info("webhook deleted", "webhook_id", id)
+	return nil
+}
+
+// notifyWebhooks queues p for every webhook that wants its type. It never
+// blocks: if the queue is full, the oldest deliveries are dropped.
+func (s *Simulator) notifyWebhooks(p WebhookPayload) {
+	t := &s.webhooks
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var ids []int
+	for id, hook := range t.hooks {
+		if hook.wants(p.Type) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	sort.Ints(ids)
+	p.ID = newUUID()
+	for _, id := range ids {
+		if len(t.pending) >= webhookQueueSize {
+			t.pending = t.pending[1:]
+		}
+		t.pending = append(t.pending, webhookDelivery{hook: id, payload: p})
+	}
+	select {
+	case t.readyChan() <- struct{}{}:
+	default:
+	}
+}
+
+// noteLeader notifies the webhooks of a leader change if the node at index,
+// or no node if index is negative, isn't the leader they were last told of.
+// The caller must hold s.mu for writing.
+func (s *Simulator) noteLeader(index int) {
+	id := -1
+	if index >= 0 {
+		id = s.nodes[index].ID
+	}
+	if id == s.leaderID {
+		return
+	}
+	p := WebhookPayload{Type: EventLeaderChanged, Time: time.Now()}
+	if s.leaderID >= 0 {
+		previous := s.leaderID
+		p.PreviousLeader = &previous
+	}
+	if index >= 0 {
+		leader := s.nodes[index].clone()
+		p.Node = &leader
+	}
+	s.leaderID = id
+	s.notifyWebhooks(p)
+}
+
+// StartWebhooks delivers queued notifications to their webhooks until ctx is
+// cancelled, one at a time in the order they were queued. A delivery is
+// retried under the "webhook" retry policy, backing off in real time, until
+// the receiver responds with a 2xx status, and a webhook whose deliveries
+// fail every attempt Config.WebhookMaxFailures times in a row is dropped. It
+// blocks, so callers typically run it in its own goroutine.
+func (s *Simulator) StartWebhooks(ctx context.Context) {
+	rng := mathrand.New(mathrand.NewSource(s.cfg.Seed))
+	for {
+		t := &s.webhooks
+		t.mu.Lock()
+		ready := t.readyChan()
+		batch := t.pending
+		t.pending = nil
+		t.mu.Unlock()
+
+		if len(batch) == 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ready:
+			}
+			continue
+		}
+		for _, d := range batch {
+			if ctx.Err() != nil {
+				return
+			}
+			s.deliverWebhook(ctx, d, rng)
+		}
+	}
+}
+
+// deliverWebhook sends d to its webhook, if it is still registered,
+// retrying as StartWebhooks describes.
+func (s *Simulator) deliverWebhook(ctx context.Context, d webhookDelivery, rng *mathrand.Rand) {
+	t := &s.webhooks
+	t.mu.Lock()
+	hook, ok := t.hooks[d.hook]
+	var target, secret string
+	if ok {
+		target, secret = hook.URL, hook.Secret
+	}
+	t.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	body, err := json.Marshal(d.payload)
+	if err != nil {
+		s.logger.Error("failed to encode webhook payload", "webhook_id", d.hook, "err", err)
+		return
+	}
+	signature := SignWebhook(secret, body)
+	s.mu.RLock()
+	policy := s.retryPolicy(RetryWebhook)
+	s.mu.RUnlock()
+	attempts, err := retry(ctx, policy, rng, sleep, func(int) error {
+		return postWebhook(ctx, target, d.payload, body, signature)
+	})
+	if ctx.Err() != nil {
+		return
+	}
+	s.mu.Lock()
+	s.countRetries(RetryWebhook, attempts, err)
+	s.mu.Unlock()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.hooks[d.hook] != hook {
+		return
+	}
+	if err == nil {
+		hook.Failures = 0
+		hook.Delivered++
+		return
+	}
+	hook.Failures++
+	s.logger.Warn("webhook delivery failed", "webhook_id", hook.ID, "type", d.payload.Type, "attempts", attempts, "failures", hook.Failures, "err", err)
+	if hook.Failures >= s.cfg.WebhookMaxFailures {
+		delete(t.hooks, hook.ID)
+		s.logger.Warn("webhook dropped", "webhook_id", hook.ID, "url", hook.URL)
+	}
+}
+
+// postWebhook makes one attempt to POST body, the encoding of p, to target.
+func postWebhook(ctx context.Context, target string, p WebhookPayload, body []byte, signature string) error {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", p.Type)
+	req.Header.Set("X-Webhook-Delivery", p.ID)
+	req.Header.Set(SignatureHeader, signature)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("receiver responded %s", resp.Status)
+	}
+	return nil
+}
+
+// SignWebhook returns the SignatureHeader value of a delivery of body to a
+// webhook with the given secret, for receivers to compare theirs with.
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// sleep waits for d to pass in real time, or returns ctx's error if it is
+// done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// webhookRequest is the JSON payload accepted by createWebhook.
+type webhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret"`
+}
+
+// createWebhook handles HTTP requests to register a webhook from a body like
+// {"url":"https://example.com/hook","events":["node.failed"]}.
+func (s *Simulator) createWebhook(w http.ResponseWriter, r *http.Request) {
+	var payload webhookRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&payload); err != nil {
+		writeError(w, http.StatusBadRequest, "Malformed JSON body")
+		return
+	}
+
+	hook, err := s.RegisterWebhook(payload.URL, payload.Events, payload.Secret)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, hook)
+}
+
+// getWebhooks handles HTTP requests to list the registered webhooks.
+func (s *Simulator) getWebhooks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Webhooks())
+}
+
+// deleteWebhook handles HTTP requests to delete a webhook.
+func (s *Simulator) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid webhook ID")
+		return
+	}
+
+	if err := s.DeleteWebhook(id); err != nil {
+		writeError(w, http.StatusNotFound, "Webhook not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
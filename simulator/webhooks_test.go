@@ -0,0 +1,190 @@
+package simulator
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// delivery is a request received by a webhookReceiver.
+type delivery struct {
+	header http.Header
+	body   []byte
+}
+
+// webhookReceiver starts a server that sends every request it receives to
+// the returned channel, responding with the status respond returns for it.
+func webhookReceiver(t *testing.T, respond func() int) (*httptest.Server, <-chan delivery) {
+	t.Helper()
+	received := make(chan delivery, 16)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- delivery{header: r.Header.Clone(), body: body}
+		w.WriteHeader(respond())
+	}))
+	t.Cleanup(srv.Close)
+	return srv, received
+}
+
+// awaitDelivery returns the next request from received, failing t if it
+// takes longer than a second.
+func awaitDelivery(t *testing.T, received <-chan delivery) delivery {
+	t.Helper()
+	select {
+	case d := <-received:
+		return d
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for a webhook delivery")
+		return delivery{}
+	}
+}
+
+// startWebhooks runs s's webhook dispatcher until the test ends.
+func startWebhooks(t *testing.T, s *Simulator) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.StartWebhooks(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+}
+
+// TestWebhooks tests that a webhook is POSTed the events it asked for,
+// signed with its secret, and can be listed and deleted.
+func TestWebhooks(t *testing.T) {
+	s := New(Config{Seed: 1})
+	s.Init(testNodeCount)
+	h := s.Handler()
+	srv, received := webhookReceiver(t, func() int { return http.StatusNoContent })
+	startWebhooks(t, s)
+
+	rr := doRequest(t, h, "POST", "/webhooks", `{"url":"`+srv.URL+`","events":["node.failed","leader.changed"],"secret":"s3cret"}`)
+	expectCode(t, rr, http.StatusCreated)
+	var hook Webhook
+	decodeBody(t, rr, &hook)
+	if hook.ID != 1 || hook.Secret != "s3cret" || len(hook.Events) != 2 {
+		t.Fatalf("Expected the registered webhook, got %+v", hook)
+	}
+
+	// Failing the leader fails it and elects node 1.
+	s.Fail(0)
+	payloads := make(map[string]WebhookPayload)
+	for i := 0; i < 2; i++ {
+		d := awaitDelivery(t, received)
+		if got, want := d.header.Get(SignatureHeader), SignWebhook("s3cret", d.body); got != want {
+			t.Errorf("Expected signature %s, got %s", want, got)
+		}
+		var p WebhookPayload
+		if err := json.Unmarshal(d.body, &p); err != nil {
+			t.Fatalf("Failed to decode payload %s: %v", d.body, err)
+		}
+		if d.header.Get("X-Webhook-Event") != p.Type || d.header.Get("X-Webhook-Delivery") != p.ID {
+			t.Errorf("Expected headers naming %s %s, got %v", p.Type, p.ID, d.header)
+		}
+		payloads[p.Type] = p
+	}
+	if p := payloads[EventNodeFailed]; p.Node == nil || p.Node.ID != 0 || p.Node.Status != StatusDown || p.Seq == 0 {
+		t.Errorf("Expected the failure of node 0, got %+v", p)
+	}
+	if p := payloads[EventLeaderChanged]; p.Node == nil || p.Node.ID != 1 || p.PreviousLeader == nil || *p.PreviousLeader != 0 {
+		t.Errorf("Expected node 1 to take over from node 0, got %+v", p)
+	}
+
+	// Events of other types aren't delivered.
+	s.SetNode(2, "updated", 1)
+	s.Fail(3)
+	var p WebhookPayload
+	if err := json.Unmarshal(awaitDelivery(t, received).body, &p); err != nil || p.Type != EventNodeFailed || p.Node.ID != 3 {
+		t.Errorf("Expected only the failure of node 3, got %+v, %v", p, err)
+	}
+
+	var hooks []Webhook
+	decodeBody(t, doRequest(t, h, "GET", "/webhooks", ""), &hooks)
+	if len(hooks) != 1 || hooks[0].Secret != "" || hooks[0].URL != srv.URL {
+		t.Errorf("Expected the webhook listed without its secret, got %+v", hooks)
+	}
+	waitFor(t, func() bool { return s.Webhooks()[0].Delivered == 3 })
+
+	// Without a secret, one is generated.
+	rr = doRequest(t, h, "POST", "/webhooks", `{"url":"`+srv.URL+`"}`)
+	expectCode(t, rr, http.StatusCreated)
+	decodeBody(t, rr, &hook)
+	if len(hook.Secret) != 64 {
+		t.Errorf("Expected a generated secret, got %q", hook.Secret)
+	}
+
+	for _, body := range []string{`{"url":"/relative"}`, `{"url":"ftp://example.com"}`, `{"url":"` + srv.URL + `","events":["node.exploded"]}`, `{"url":`} {
+		expectCode(t, doRequest(t, h, "POST", "/webhooks", body), http.StatusBadRequest)
+	}
+	expectCode(t, doRequest(t, h, "DELETE", "/webhooks/1", ""), http.StatusNoContent)
+	expectCode(t, doRequest(t, h, "DELETE", "/webhooks/1", ""), http.StatusNotFound)
+	expectCode(t, doRequest(t, h, "DELETE", "/webhooks/x", ""), http.StatusBadRequest)
+	if hooks := s.Webhooks(); len(hooks) != 1 || hooks[0].ID != 2 {
+		t.Errorf("Expected only webhook 2 left, got %+v", hooks)
+	}
+}
+
+// TestWebhookRetries tests that a failed delivery is retried with the same
+// payload, and that a webhook is dropped once enough deliveries in a row fail
+// every attempt.
+func TestWebhookRetries(t *testing.T) {
+	fast := RetryPolicy{MaxAttempts: 3, BaseDelay: Duration(time.Millisecond), MaxDelay: Duration(time.Millisecond)}
+	s := New(Config{Seed: 1, WebhookMaxFailures: 2, RetryOverrides: map[string]RetryPolicy{RetryWebhook: fast}})
+	s.Init(testNodeCount)
+	var failing atomic.Int32 // Attempts left to fail, or negative to fail every one.
+	failing.Store(2)
+	srv, received := webhookReceiver(t, func() int {
+		if failing.Load() == 0 {
+			return http.StatusOK
+		}
+		failing.Add(-1)
+		return http.StatusInternalServerError
+	})
+	if _, err := s.RegisterWebhook(srv.URL, []string{EventNodeFailed}, "key"); err != nil {
+		t.Fatalf("RegisterWebhook failed: %v", err)
+	}
+	startWebhooks(t, s)
+
+	// The third attempt succeeds.
+	s.Fail(4)
+	first := awaitDelivery(t, received)
+	for i := 0; i < 2; i++ {
+		if d := awaitDelivery(t, received); string(d.body) != string(first.body) || d.header.Get(SignatureHeader) != first.header.Get(SignatureHeader) {
+			t.Errorf("Expected attempt %d to resend %s, got %s", i+2, first.body, d.body)
+		}
+	}
+	waitFor(t, func() bool { return s.Webhooks()[0].Delivered == 1 })
+
+	// Two deliveries failing all three attempts drop the webhook.
+	failing.Store(-1)
+	s.Fail(3)
+	s.Fail(2)
+	for i := 0; i < 6; i++ {
+		awaitDelivery(t, received)
+	}
+	waitFor(t, func() bool { return len(s.Webhooks()) == 0 })
+	select {
+	case d := <-received:
+		t.Errorf("Expected no delivery after the webhook was dropped, got %s", d.body)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	metrics := doRequest(t, s.Handler(), "GET", "/metrics", "").Body.String()
+	for _, want := range []string{`sim_retries_total{operation="webhook"} 6`, `sim_retries_exhausted_total{operation="webhook"} 2`} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("Expected %s in metrics", want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package simulator
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsWriteTimeout bounds how long writing one message to a WebSocket client
+// may take before the client is dropped.
+const wsWriteTimeout = 5 * time.Second
+
+// upgrader upgrades /ws requests to WebSocket connections.
+var upgrader = websocket.Upgrader{}
+
+// wsSnapshot is the first message sent to a WebSocket client.
+type wsSnapshot struct {
+	Type  string     `json:"type"` // Always "snapshot".
+	Nodes []NodeData `json:"nodes"`
+}
+
+// serveWS handles HTTP requests to stream node changes over a WebSocket. The
+// client first receives a snapshot of every node and then one Event per
+// change. A client that falls behind is disconnected.
+func (s *Simulator) serveWS(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already written an error response.
+		return
+	}
+	defer conn.Close()
+
+	// Subscribe before taking the snapshot so no change falls between the
+	// snapshot and the first event. A change made in between may show up in
+	// both, which applying the event again leaves as it is.
+	events := s.events.subscribe()
+	snapshot := wsSnapshot{Type: "snapshot", Nodes: s.Snapshot()}
+	defer s.events.unsubscribe(events)
+
+	// Read until the client goes away so close frames are handled.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if err := conn.WriteJSON(snapshot); err != nil {
+		return
+	}
+	for {
+		select {
+		case <-closed:
+			return
+		case <-s.drained:
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "shutting down"),
+				time.Now().Add(wsWriteTimeout))
+			return
+		case e, ok := <-events:
+			if !ok {
+				s.logger.Warn("dropped slow WebSocket client", "remote_addr", r.RemoteAddr)
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow"),
+					time.Now().Add(wsWriteTimeout))
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteJSON(e); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package simulator
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestWebSocketStream tests that a WebSocket client receives a snapshot on
+// connect followed by an event for each change.
+func TestWebSocketStream(t *testing.T) {
+	s := New(Config{})
+	s.Init(testNodeCount)
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Failed to dial %s: %v", url, err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	var snapshot wsSnapshot
+	if err := conn.ReadJSON(&snapshot); err != nil {
+		t.Fatalf("Failed to read snapshot: %v", err)
+	}
+	if snapshot.Type != "snapshot" || len(snapshot.Nodes) != testNodeCount {
+		t.Fatalf("Unexpected snapshot: %+v", snapshot)
+	}
+
+	s.SetNode(2, "renamed", 77)
+	s.Fail(4)
+	s.AddNode("extra", 1)
+
+	want := []struct {
+		eventType string
+		id        int
+	}{
+		{EventNodeUpdated, 2},
+		{EventNodeFailed, 4},
+		{EventNodeAdded, testNodeCount},
+	}
+	for _, w := range want {
+		var e Event
+		if err := conn.ReadJSON(&e); err != nil {
+			t.Fatalf("Failed to read event: %v", err)
+		}
+		if e.Type != w.eventType || e.Node.ID != w.id {
+			t.Errorf("Expected %s for node %d, got %s for node %d", w.eventType, w.id, e.Type, e.Node.ID)
+		}
+	}
+}
+
+// TestHubDropsSlowSubscribers tests that publishing never blocks on a
+// subscriber that stops reading; the subscriber is dropped instead.
+func TestHubDropsSlowSubscribers(t *testing.T) {
+	var h hub
+	slow := h.subscribe()
+	fast := h.subscribe()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < subscriberBuffer+1; i++ {
+			h.publish(Event{Type: EventNodeUpdated})
+			<-fast
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("publish blocked on a slow subscriber")
+	}
+
+	received := 0
+	for range slow {
+		received++
+	}
+	if received != subscriberBuffer {
+		t.Errorf("Expected the slow subscriber to get %d events before being dropped, got %d", subscriberBuffer, received)
+	}
+
+	// Unsubscribing a dropped subscriber is harmless.
+	h.unsubscribe(slow)
+	h.unsubscribe(fast)
+}
@@ -0,0 +1,528 @@
+package simulator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// replicationPoll is how often a replication link looks for writes that have
+// waited out its lag, on the source cluster's clock.
+const replicationPoll = 10 * time.Millisecond
+
+// maxReplicationBacklog bounds the writes a replication link holds for its
+// target; past it, the oldest are dropped, as a WAN link's buffer would.
+const maxReplicationBacklog = 1 << 16
+
+// Errors returned by Replicate and the other replication link operations.
+var (
+	// ErrReplicationLink means a link from a cluster to itself, or with a
+	// negative lag, was requested.
+	ErrReplicationLink = errors.New("invalid replication link")
+
+	// ErrLinkExists means a replication link between the clusters exists.
+	ErrLinkExists = errors.New("replication link already exists")
+
+	// ErrNoLink means no replication link runs between the clusters.
+	ErrNoLink = errors.New("replication link not found")
+)
+
+// ReplicationLink describes an asynchronous replication link, which applies
+// the key-value writes committed on one cluster to another.
+type ReplicationLink struct {
+	From        string     `json:"from"`
+	To          string     `json:"to"`
+	Lag         Duration   `json:"lag"` // Delay before a committed write is applied to To.
+	Paused      bool       `json:"paused"`
+	Pending     int        `json:"pending"`      // Writes committed on From yet to be applied to To.
+	Behind      Duration   `json:"behind"`       // Age of the oldest pending write on From's clock, or 0.
+	Replicated  uint64     `json:"replicated"`   // Writes applied to To.
+	Conflicts   uint64     `json:"conflicts"`    // Writes that raced a write To made concurrently.
+	Dropped     uint64     `json:"dropped"`      // Writes dropped past the backlog bound.
+	LastApplied *time.Time `json:"last_applied"` // When To last applied a write, or nil.
+}
+
+// kvStamp identifies the write a key last took: its hybrid logical clock
+// timestamp and the cluster it was made on.
+type kvStamp struct {
+	HLC    HLC
+	Origin string
+}
+
+// wins reports whether a write stamped st wins over one stamped other by last
+// writer wins: the later timestamp wins, and the cluster names break ties.
+func (st kvStamp) wins(other kvStamp) bool {
+	if c := st.HLC.Compare(other.HLC); c != 0 {
+		return c > 0
+	}
+	return st.Origin > other.Origin
+}
+
+// shippedWrite is a write committed on a cluster, queued on a replication
+// link for its target.
+type shippedWrite struct {
+	key       string
+	value     string
+	deleted   bool
+	ttl       time.Duration // Time left to live when committed, or 0 for none.
+	stamp     kvStamp
+	prev      kvStamp   // The stamp of the write it overwrote, or zero for none.
+	committed time.Time // On the source cluster's clock.
+	seq       uint64    // Position in the link's queue.
+}
+
+// replicationLink is a running replication link and its backlog.
+type replicationLink struct {
+	from, to         *Simulator
+	fromName, toName string
+	lag              time.Duration
+	cancel           context.CancelFunc // Stops run.
+	done             chan struct{}      // Closed once run has returned.
+
+	mu          sync.Mutex
+	paused      bool
+	pending     []shippedWrite
+	seq         uint64 // Of the last write queued.
+	replicated  uint64
+	conflicts   uint64
+	dropped     uint64
+	lastApplied *time.Time
+}
+
+// linkKey is the key of a replication link in clusterTable.links.
+type linkKey struct{ from, to string }
+
+// name returns the name of the cluster s is.
+func (s *Simulator) name() string {
+	if s.cluster == "" {
+		return DefaultCluster
+	}
+	return s.cluster
+}
+
+// clusterSim returns the Simulator of the cluster named name, s itself for
+// the default cluster. It returns ErrNoCluster if there is none.
+func (s *Simulator) clusterSim(name string) (*Simulator, error) {
+	if name == DefaultCluster {
+		return s, nil
+	}
+	s.clusters.mu.Lock()
+	defer s.clusters.mu.Unlock()
+	c, ok := s.clusters.clusters[name]
+	if !ok {
+		return nil, ErrNoCluster
+	}
+	return c.sim, nil
+}
+
+// shipWrite stamps entry, just committed for key, with the next timestamp of
+// s's hybrid logical clock and queues it on s's outgoing replication links.
+// The caller must hold s.mu for writing.
+func (s *Simulator) shipWrite(key string, entry KVEntry) {
+	s.kvClock = s.kvClock.tick(time.Now())
+	stamp := kvStamp{HLC: s.kvClock, Origin: s.name()}
+	prev := s.kvStamps[key]
+	s.kvStamps[key] = stamp
+	if len(s.outbound) == 0 {
+		return
+	}
+
+	now := s.cfg.Clock.Now()
+	w := shippedWrite{key: key, value: entry.Value, deleted: entry.Deleted, stamp: stamp, prev: prev, committed: now}
+	if entry.Expires != nil {
+		w.ttl = max(entry.Expires.Sub(now), time.Nanosecond)
+	}
+	for _, l := range s.outbound {
+		l.push(w)
+	}
+}
+
+// push queues w for the link's target.
+func (l *replicationLink) push(w shippedWrite) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.pending) == maxReplicationBacklog {
+		l.pending = l.pending[1:]
+		l.dropped++
+	}
+	l.seq++
+	w.seq = l.seq
+	l.pending = append(l.pending, w)
+}
+
+// applyShipped applies w, shipped from another cluster, to a write quorum of
+// s's replicas, and reports whether it conflicted: whether the key had since
+// taken a write other than the one w overwrote on its cluster, which w's
+// cluster never saw. A conflicting write is applied only if it wins by last
+// writer wins, so every cluster settles on the same value. Applied writes
+// are not shipped on, so links in both directions don't echo them back. It
+// returns ErrQuorumUnavailable if fewer than W replicas are up.
+func (s *Simulator) applyShipped(w shippedWrite) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.kvStamps[w.key]
+	conflict := ok && current != w.prev
+	if conflict && !w.stamp.wins(current) {
+		s.kvClock = s.kvClock.receive(w.stamp.HLC, time.Now())
+		return true, nil
+	}
+	targets, err := s.quorum(w.key, s.cfg.W, -1)
+	if err != nil {
+		return conflict, err
+	}
+
+	s.kvClock = s.kvClock.receive(w.stamp.HLC, time.Now())
+	entry := s.kvEntry(w.value, s.fencingToken, w.ttl)
+	if w.deleted {
+		now := s.cfg.Clock.Now()
+		entry.Deleted, entry.DeletedAt = true, &now
+		entry = entry.sealed()
+		s.kvDeletes++
+	}
+	for _, id := range targets {
+		s.storeReplica(id, w.key, entry)
+	}
+	s.addHints(w.key, entry, targets)
+	s.kvStamps[w.key] = w.stamp
+	return conflict, nil
+}
+
+// run applies the link's writes to its target once they have waited out its
+// lag, until ctx is cancelled.
+func (l *replicationLink) run(ctx context.Context) {
+	defer close(l.done)
+	ticker := l.from.cfg.Clock.NewTicker(replicationPoll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			l.deliver()
+		}
+	}
+}
+
+// deliver applies, in commit order, the pending writes that have waited out
+// the link's lag, unless it is paused. It stops at the first write the
+// target can't take, such as for want of a quorum, to retry it next time.
+func (l *replicationLink) deliver() {
+	now := l.from.cfg.Clock.Now()
+	l.mu.Lock()
+	if l.paused {
+		l.mu.Unlock()
+		return
+	}
+	n := 0
+	for n < len(l.pending) && !now.Before(l.pending[n].committed.Add(l.lag)) {
+		n++
+	}
+	batch := append([]shippedWrite{}, l.pending[:n]...)
+	l.mu.Unlock()
+
+	applied, conflicts, last := 0, uint64(0), uint64(0)
+	for _, w := range batch {
+		conflict, err := l.to.applyShipped(w)
+		if err != nil {
+			l.to.logger.Debug("replicated write deferred", "from", l.fromName, "key", w.key, "err", err)
+			break
+		}
+		applied++
+		last = w.seq
+		if conflict {
+			conflicts++
+		}
+	}
+	if applied == 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// Some may have been dropped past the backlog bound meanwhile.
+	for len(l.pending) > 0 && l.pending[0].seq <= last {
+		l.pending = l.pending[1:]
+	}
+	l.replicated += uint64(applied)
+	l.conflicts += conflicts
+	at := time.Now()
+	l.lastApplied = &at
+}
+
+// status describes the link, with its backlog's age measured at now on the
+// source cluster's clock.
+func (l *replicationLink) status(now time.Time) ReplicationLink {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	link := ReplicationLink{
+		From:        l.fromName,
+		To:          l.toName,
+		Lag:         Duration(l.lag),
+		Paused:      l.paused,
+		Pending:     len(l.pending),
+		Replicated:  l.replicated,
+		Conflicts:   l.conflicts,
+		Dropped:     l.dropped,
+		LastApplied: l.lastApplied,
+	}
+	if len(l.pending) > 0 {
+		link.Behind = Duration(max(now.Sub(l.pending[0].committed), 0))
+	}
+	return link
+}
+
+// outboundLinks describes the replication links from s. The caller must hold
+// s.mu.
+func (s *Simulator) outboundLinks() []ReplicationLink {
+	now := s.cfg.Clock.Now()
+	links := make([]ReplicationLink, len(s.outbound))
+	for i, l := range s.outbound {
+		links[i] = l.status(now)
+	}
+	return links
+}
+
+// Replicate starts a replication link from the cluster named from to the
+// one named to, either of which may be the default cluster. Every key-value
+// write committed on from afterwards, whether a put or a delete, is applied
+// to a write quorum of to's replicas once lag has passed on from's clock, in
+// commit order, as if shipped over a WAN. A write that raced one to made
+// concurrently, as with links both ways between active clusters, is counted
+// as a conflict and resolved by last writer wins on the writes' hybrid
+// logical clock timestamps. The link runs until StopReplication, or until
+// either cluster is deleted. It returns an error wrapping ErrReplicationLink
+// for a link from a cluster to itself or a negative lag, ErrNoCluster if
+// either cluster is missing, and ErrLinkExists if the link runs already.
+func (s *Simulator) Replicate(from, to string, lag time.Duration) (ReplicationLink, error) {
+	switch {
+	case from == to:
+		return ReplicationLink{}, fmt.Errorf("%w: a cluster cannot replicate to itself", ErrReplicationLink)
+	case lag < 0:
+		return ReplicationLink{}, fmt.Errorf("%w: lag must not be negative", ErrReplicationLink)
+	}
+
+	t := &s.clusters
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sims := make([]*Simulator, 2)
+	for i, name := range []string{from, to} {
+		if name == DefaultCluster {
+			sims[i] = s
+		} else if c, ok := t.clusters[name]; ok {
+			sims[i] = c.sim
+		} else {
+			return ReplicationLink{}, ErrNoCluster
+		}
+	}
+	key := linkKey{from, to}
+	if _, ok := t.links[key]; ok {
+		return ReplicationLink{}, ErrLinkExists
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &replicationLink{
+		from: sims[0], to: sims[1],
+		fromName: from, toName: to,
+		lag:    lag,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	sims[0].mu.Lock()
+	sims[0].outbound = append(sims[0].outbound, l)
+	sims[0].mu.Unlock()
+	go l.run(ctx)
+	if t.links == nil {
+		t.links = make(map[linkKey]*replicationLink)
+	}
+	t.links[key] = l
+
+	s.logger.Info("replication started", "from", from, "to", to, "lag", lag)
+	return l.status(l.from.cfg.Clock.Now()), nil
+}
+
+// replicationLink returns the link from the cluster named from to the one
+// named to. It returns ErrNoLink if there is none.
+func (s *Simulator) replicationLink(from, to string) (*replicationLink, error) {
+	s.clusters.mu.Lock()
+	defer s.clusters.mu.Unlock()
+	l, ok := s.clusters.links[linkKey{from, to}]
+	if !ok {
+		return nil, ErrNoLink
+	}
+	return l, nil
+}
+
+// Replication describes the replication link from the cluster named from to
+// the one named to. It returns ErrNoLink if there is none.
+func (s *Simulator) Replication(from, to string) (ReplicationLink, error) {
+	l, err := s.replicationLink(from, to)
+	if err != nil {
+		return ReplicationLink{}, err
+	}
+	return l.status(l.from.cfg.Clock.Now()), nil
+}
+
+// SetReplicationPaused pauses or resumes the replication link from the
+// cluster named from to the one named to, as a WAN outage would. A paused
+// link applies nothing, while writes committed on from pile up in its
+// backlog; once resumed, it catches up on them in commit order. It returns
+// ErrNoLink if there is no such link.
+func (s *Simulator) SetReplicationPaused(from, to string, paused bool) (ReplicationLink, error) {
+	l, err := s.replicationLink(from, to)
+	if err != nil {
+		return ReplicationLink{}, err
+	}
+	l.mu.Lock()
+	l.paused = paused
+	l.mu.Unlock()
+	s.logger.Info("replication paused", "from", from, "to", to, "paused", paused)
+	return l.status(l.from.cfg.Clock.Now()), nil
+}
+
+// StopReplication stops the replication link from the cluster named from to
+// the one named to, dropping its backlog. It returns ErrNoLink if there is
+// none.
+func (s *Simulator) StopReplication(from, to string) error {
+	t := &s.clusters
+	t.mu.Lock()
+	l, ok := t.links[linkKey{from, to}]
+	delete(t.links, linkKey{from, to})
+	t.mu.Unlock()
+	if !ok {
+		return ErrNoLink
+	}
+	l.stop()
+	s.logger.Info("replication stopped", "from", from, "to", to)
+	return nil
+}
+
+// stopLinks stops every replication link from or to the cluster named name.
+func (s *Simulator) stopLinks(name string) {
+	t := &s.clusters
+	t.mu.Lock()
+	var links []*replicationLink
+	for key, l := range t.links {
+		if key.from == name || key.to == name {
+			links = append(links, l)
+			delete(t.links, key)
+		}
+	}
+	t.mu.Unlock()
+	for _, l := range links {
+		l.stop()
+	}
+}
+
+// stop stops the link, waits for it to return, and takes it off its source
+// cluster's outgoing links.
+func (l *replicationLink) stop() {
+	l.cancel()
+	<-l.done
+	l.from.mu.Lock()
+	defer l.from.mu.Unlock()
+	for i, other := range l.from.outbound {
+		if other == l {
+			l.from.outbound = append(l.from.outbound[:i:i], l.from.outbound[i+1:]...)
+			break
+		}
+	}
+}
+
+// replicationRequest is the JSON payload accepted by startReplication.
+type replicationRequest struct {
+	Lag Duration `json:"lag"`
+}
+
+// writeReplicationError writes the HTTP response for an error returned by
+// Replicate or the other replication link operations.
+func writeReplicationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrReplicationLink):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrNoCluster):
+		writeError(w, http.StatusNotFound, "Cluster not found")
+	case errors.Is(err, ErrNoLink):
+		writeError(w, http.StatusNotFound, "Replication link not found")
+	case errors.Is(err, ErrLinkExists):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// startReplication handles HTTP requests to start a replication link. The
+// body is optional and the lag defaults to none.
+func (s *Simulator) startReplication(w http.ResponseWriter, r *http.Request) {
+	if s.nestedCluster(w) {
+		return
+	}
+	var payload replicationRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&payload); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, "Malformed JSON body")
+		return
+	}
+	from, to := r.PathValue("name"), r.PathValue("to")
+	link, err := s.Replicate(from, to, time.Duration(payload.Lag))
+	if err != nil {
+		writeReplicationError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/clusters/"+from+"/replicate-to/"+to)
+	writeJSON(w, http.StatusCreated, link)
+}
+
+// getReplication handles HTTP requests to describe a replication link.
+func (s *Simulator) getReplication(w http.ResponseWriter, r *http.Request) {
+	if s.nestedCluster(w) {
+		return
+	}
+	link, err := s.Replication(r.PathValue("name"), r.PathValue("to"))
+	if err != nil {
+		writeReplicationError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, link)
+}
+
+// pauseReplication and resumeReplication handle HTTP requests to pause and
+// resume a replication link.
+func (s *Simulator) pauseReplication(w http.ResponseWriter, r *http.Request) {
+	s.setReplicationPaused(w, r, true)
+}
+
+func (s *Simulator) resumeReplication(w http.ResponseWriter, r *http.Request) {
+	s.setReplicationPaused(w, r, false)
+}
+
+// setReplicationPaused is pauseReplication and resumeReplication.
+func (s *Simulator) setReplicationPaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	if s.nestedCluster(w) {
+		return
+	}
+	link, err := s.SetReplicationPaused(r.PathValue("name"), r.PathValue("to"), paused)
+	if err != nil {
+		writeReplicationError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, link)
+}
+
+// stopReplication handles HTTP requests to stop a replication link.
+func (s *Simulator) stopReplication(w http.ResponseWriter, r *http.Request) {
+	if s.nestedCluster(w) {
+		return
+	}
+	if err := s.StopReplication(r.PathValue("name"), r.PathValue("to")); err != nil {
+		writeReplicationError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
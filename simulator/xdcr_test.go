@@ -0,0 +1,210 @@
+package simulator
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clusterValue reads key from the cluster at prefix, returning the value
+// and the response code.
+func clusterValue(t *testing.T, h http.Handler, prefix, key string) (string, int) {
+	t.Helper()
+	rr := doRequest(t, h, "GET", prefix+"/kv/"+key, "")
+	if rr.Code != http.StatusOK {
+		return "", rr.Code
+	}
+	var result KVResult
+	decodeBody(t, rr, &result)
+	return result.Value, rr.Code
+}
+
+// replicationStatus describes the replication link at path.
+func replicationStatus(t *testing.T, h http.Handler, path string) ReplicationLink {
+	t.Helper()
+	rr := doRequest(t, h, "GET", path, "")
+	expectCode(t, rr, http.StatusOK)
+	var link ReplicationLink
+	decodeBody(t, rr, &link)
+	return link
+}
+
+// TestReplication tests that a replication link applies the writes committed
+// on one cluster to another after its lag, holds them while paused, and
+// catches up once resumed.
+func TestReplication(t *testing.T) {
+	s := New(Config{Seed: 1})
+	s.Init(testNodeCount)
+	h := s.Handler()
+	defer s.StopClusters()
+	for _, name := range []string{"a", "b"} {
+		expectCode(t, doRequest(t, h, "POST", "/clusters", `{"name": "`+name+`", "nodes": 3, "seed": 2}`), http.StatusCreated)
+	}
+
+	const path = "/clusters/a/replicate-to/b"
+	rr := doRequest(t, h, "POST", path, `{"lag": "20ms"}`)
+	expectCode(t, rr, http.StatusCreated)
+	var link ReplicationLink
+	decodeBody(t, rr, &link)
+	if link.From != "a" || link.To != "b" || link.Lag != Duration(20*time.Millisecond) || link.Paused {
+		t.Errorf("Unexpected link %+v", link)
+	}
+
+	expectCode(t, doRequest(t, h, "PUT", "/clusters/a/kv/k1", `{"value": "v1"}`), http.StatusOK)
+	waitFor(t, func() bool {
+		value, _ := clusterValue(t, h, "/clusters/b", "k1")
+		return value == "v1"
+	})
+
+	// Writes pile up while the link is paused.
+	rr = doRequest(t, h, "POST", path+"/pause", "")
+	expectCode(t, rr, http.StatusOK)
+	decodeBody(t, rr, &link)
+	if !link.Paused {
+		t.Errorf("Expected the link to be paused, got %+v", link)
+	}
+	for _, key := range []string{"k2", "k3", "k4"} {
+		expectCode(t, doRequest(t, h, "PUT", "/clusters/a/kv/"+key, `{"value": "v"}`), http.StatusOK)
+	}
+	expectCode(t, doRequest(t, h, "DELETE", "/clusters/a/kv/k1", ""), http.StatusOK)
+	time.Sleep(50 * time.Millisecond)
+	if link := replicationStatus(t, h, path); link.Pending != 4 || link.Behind < Duration(50*time.Millisecond) || link.Replicated != 1 {
+		t.Errorf("Expected 4 writes at least 50ms behind, got %+v", link)
+	}
+	if _, code := clusterValue(t, h, "/clusters/b", "k2"); code != http.StatusNotFound {
+		t.Errorf("Expected k2 to be missing from b while the link is paused, got %d", code)
+	}
+	rr = doRequest(t, h, "GET", "/clusters/a/metrics", "")
+	expectCode(t, rr, http.StatusOK)
+	if body := rr.Body.String(); !strings.Contains(body, `sim_replication_pending{to="b"} 4`) || !strings.Contains(body, `sim_replication_replicated_total{to="b"} 1`) {
+		t.Errorf("Expected the link's metrics, got\n%s", body)
+	}
+
+	// Once resumed, the link catches up.
+	expectCode(t, doRequest(t, h, "POST", path+"/resume", ""), http.StatusOK)
+	waitFor(t, func() bool { return replicationStatus(t, h, path).Pending == 0 })
+	for _, key := range []string{"k2", "k3", "k4"} {
+		if value, code := clusterValue(t, h, "/clusters/b", key); value != "v" {
+			t.Errorf("Expected %s to reach b, got %q %d", key, value, code)
+		}
+	}
+	if _, code := clusterValue(t, h, "/clusters/b", "k1"); code != http.StatusNotFound {
+		t.Errorf("Expected the delete of k1 to reach b, got %d", code)
+	}
+	if link := replicationStatus(t, h, path); link.Replicated != 5 || link.Conflicts != 0 || link.Behind != 0 || link.LastApplied == nil {
+		t.Errorf("Unexpected link after catching up %+v", link)
+	}
+
+	// Writes to the target go nowhere.
+	expectCode(t, doRequest(t, h, "PUT", "/clusters/b/kv/only-b", `{"value": "v"}`), http.StatusOK)
+	time.Sleep(50 * time.Millisecond)
+	if _, code := clusterValue(t, h, "/clusters/a", "only-b"); code != http.StatusNotFound {
+		t.Errorf("Expected writes to b to stay there, got %d", code)
+	}
+
+	rr = doRequest(t, h, "GET", "/clusters/a", "")
+	var info ClusterInfo
+	decodeBody(t, rr, &info)
+	if len(info.Replication) != 1 || info.Replication[0].To != "b" {
+		t.Errorf("Expected a to list its link, got %+v", info.Replication)
+	}
+	expectCode(t, doRequest(t, h, "DELETE", path, ""), http.StatusNoContent)
+	expectCode(t, doRequest(t, h, "GET", path, ""), http.StatusNotFound)
+}
+
+// TestReplicationConflicts tests that writes to the same key on two active
+// clusters replicating to each other are counted as conflicts and settle on
+// the later write on both, while writes made after seeing each other's
+// don't conflict.
+func TestReplicationConflicts(t *testing.T) {
+	s := New(Config{Seed: 1})
+	s.Init(testNodeCount)
+	h := s.Handler()
+	defer s.StopClusters()
+	expectCode(t, doRequest(t, h, "POST", "/clusters", `{"name": "east", "nodes": 3, "seed": 2}`), http.StatusCreated)
+	paths := []string{"/clusters/default/replicate-to/east", "/clusters/east/replicate-to/default"}
+	for _, path := range paths {
+		expectCode(t, doRequest(t, h, "POST", path, ""), http.StatusCreated)
+		expectCode(t, doRequest(t, h, "POST", path+"/pause", ""), http.StatusOK)
+	}
+
+	// Both sides write the key during the outage.
+	expectCode(t, doRequest(t, h, "PUT", "/kv/k", `{"value": "first"}`), http.StatusOK)
+	expectCode(t, doRequest(t, h, "PUT", "/clusters/east/kv/k", `{"value": "second"}`), http.StatusOK)
+	for _, path := range paths {
+		expectCode(t, doRequest(t, h, "POST", path+"/resume", ""), http.StatusOK)
+	}
+	settled := func() bool {
+		for _, path := range paths {
+			if replicationStatus(t, h, path).Pending != 0 {
+				return false
+			}
+		}
+		return true
+	}
+	waitFor(t, settled)
+	conflicts := func() uint64 {
+		return replicationStatus(t, h, paths[0]).Conflicts + replicationStatus(t, h, paths[1]).Conflicts
+	}
+	if n := conflicts(); n != 2 {
+		t.Errorf("Expected a conflict each way, got %d", n)
+	}
+	for _, prefix := range []string{"", "/clusters/east"} {
+		if value, _ := clusterValue(t, h, prefix, "k"); value != "second" {
+			t.Errorf("Expected %q to settle on the later write, got %q", prefix, value)
+		}
+	}
+
+	// A write made once the clusters agree overwrites without conflict.
+	expectCode(t, doRequest(t, h, "PUT", "/kv/k", `{"value": "third"}`), http.StatusOK)
+	waitFor(t, func() bool {
+		value, _ := clusterValue(t, h, "/clusters/east", "k")
+		return value == "third"
+	})
+	waitFor(t, settled)
+	if n := conflicts(); n != 2 {
+		t.Errorf("Expected no new conflicts, got %d", n)
+	}
+	if value, _ := clusterValue(t, h, "", "k"); value != "third" {
+		t.Errorf("Expected the default cluster to keep its write, got %q", value)
+	}
+
+	// Deleting a cluster stops its links.
+	expectCode(t, doRequest(t, h, "DELETE", "/clusters/east", ""), http.StatusNoContent)
+	expectCode(t, doRequest(t, h, "GET", paths[0], ""), http.StatusNotFound)
+	s.mu.RLock()
+	n := len(s.outbound)
+	s.mu.RUnlock()
+	if n != 0 {
+		t.Errorf("Expected no links left from the default cluster, got %d", n)
+	}
+}
+
+// TestReplicationErrors tests the replication link requests rejected.
+func TestReplicationErrors(t *testing.T) {
+	s := New(Config{Seed: 1})
+	s.Init(testNodeCount)
+	h := s.Handler()
+	defer s.StopClusters()
+	expectCode(t, doRequest(t, h, "POST", "/clusters", `{"name": "a"}`), http.StatusCreated)
+	expectCode(t, doRequest(t, h, "POST", "/clusters/a/replicate-to/default", ""), http.StatusCreated)
+
+	for _, tt := range []struct {
+		method, path, body string
+		code               int
+	}{
+		{"POST", "/clusters/a/replicate-to/default", "", http.StatusConflict},
+		{"POST", "/clusters/a/replicate-to/a", "", http.StatusBadRequest},
+		{"POST", "/clusters/default/replicate-to/a", `{"lag": "-1s"}`, http.StatusBadRequest},
+		{"POST", "/clusters/default/replicate-to/a", `{"lag": 5}`, http.StatusBadRequest},
+		{"POST", "/clusters/default/replicate-to/missing", "", http.StatusNotFound},
+		{"GET", "/clusters/default/replicate-to/a", "", http.StatusNotFound},
+		{"POST", "/clusters/default/replicate-to/a/pause", "", http.StatusNotFound},
+		{"DELETE", "/clusters/default/replicate-to/a", "", http.StatusNotFound},
+	} {
+		if rr := doRequest(t, h, tt.method, tt.path, tt.body); rr.Code != tt.code {
+			t.Errorf("%s %s %s: expected status %d, got %d: %s", tt.method, tt.path, tt.body, tt.code, rr.Code, rr.Body)
+		}
+	}
+}